@@ -0,0 +1,219 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+)
+
+// logFile is where the OpenRC and launchd services write the daemon's log
+const logFile = "/var/log/airprint-bridge.log"
+
+// bundle is a support bundle being assembled. A part that can't be
+// collected is noted in errors.txt instead, since bundles are most wanted
+// when something is broken.
+type bundle struct {
+	tw       *tar.Writer
+	modified time.Time
+	problems []string
+}
+
+func runSupportBundle(args []string) error {
+	fs := flag.NewFlagSet("support-bundle", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	output := fs.String("output", "", "where to write the bundle (default airprint-bridge-support-<time>.tar.gz)")
+	logLines := fs.Int("log-lines", 2000, "how many of the most recent log lines to include")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	now := time.Now()
+	if *output == "" {
+		*output = "airprint-bridge-support-" + now.Format("20060102-150405") + ".tar.gz"
+	}
+
+	f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	gz := gzip.NewWriter(f)
+	b := &bundle{tw: tar.NewWriter(gz), modified: now}
+	b.collect(flags, *logLines)
+
+	err = b.tw.Close()
+	if gzErr := gz.Close(); err == nil {
+		err = gzErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	fmt.Printf("Wrote %s\n", *output)
+	if len(b.problems) > 0 {
+		fmt.Printf("%d parts couldn't be collected, see errors.txt in the bundle\n", len(b.problems))
+	}
+	fmt.Println("Secrets are redacted, but logs and printer names may still identify people; check before sharing.")
+	return nil
+}
+
+// collect adds everything useful for diagnosing a problem
+func (b *bundle) collect(flags *configFlags, logLines int) {
+	b.add("version.txt", func(w io.Writer) error {
+		host, _ := os.Hostname()
+		fmt.Fprintf(w, "airprint-bridge %s (commit %s)\n%s %s/%s\nhost %s\n",
+			version, commit, runtime.Version(), runtime.GOOS, runtime.GOARCH, host)
+		return nil
+	})
+
+	config, loaded, err := flags.loadFile()
+	if err != nil {
+		b.problem("config", err)
+	} else {
+		b.add("config.yaml", func(w io.Writer) error { return dumpConfig(w, loaded, false) })
+		if loaded.file != "" {
+			b.add("validate.txt", func(w io.Writer) error {
+				_, err := runValidateConfig(w, loaded.file)
+				return err
+			})
+		}
+		b.add("dry-run.txt", func(w io.Writer) error {
+			log := zerolog.New(w).Level(zerolog.WarnLevel).With().Timestamp().Logger()
+			return daemon.New(config, log).DryRun(w)
+		})
+		b.addServiceFiles(config)
+		b.addAPI(config)
+	}
+
+	b.add("logs.txt", func(w io.Writer) error { return recentLogs(w, logLines) })
+
+	if len(b.problems) > 0 {
+		b.file("errors.txt", []byte(strings.Join(b.problems, "\n")+"\n"))
+	}
+}
+
+// add writes what fn produces as name, or notes why it couldn't. Output
+// written before a failure is kept.
+func (b *bundle) add(name string, fn func(w io.Writer) error) {
+	var buf bytes.Buffer
+	if err := fn(&buf); err != nil {
+		b.problem(name, err)
+	}
+	if buf.Len() > 0 {
+		b.file(name, buf.Bytes())
+	}
+}
+
+// problem notes a part that couldn't be collected
+func (b *bundle) problem(part string, err error) {
+	b.problems = append(b.problems, part+": "+err.Error())
+}
+
+// file writes one file to the bundle
+func (b *bundle) file(name string, data []byte) {
+	hdr := &tar.Header{
+		Name:    "airprint-bridge-support/" + name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: b.modified,
+	}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		b.problem(name, err)
+		return
+	}
+	if _, err := b.tw.Write(data); err != nil {
+		b.problem(name, err)
+	}
+}
+
+// addServiceFiles adds the Avahi service files the daemon has written
+func (b *bundle) addServiceFiles(config daemon.Config) {
+	if len(config.MDNSInterfaces) > 0 {
+		// Advertised by the built-in responder; dry-run.txt shows what
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(config.ServiceDir, config.FilePrefix+"*.service"))
+	if err != nil {
+		b.problem("service-files", err)
+		return
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			b.problem(path, err)
+			continue
+		}
+		b.file("service-files/"+filepath.Base(path), data)
+	}
+}
+
+// addAPI adds what the running daemon reports about itself, if its admin
+// API is enabled
+func (b *bundle) addAPI(config daemon.Config) {
+	if config.APIListen == "" {
+		return
+	}
+	client, err := newAPIClient(config, 10*time.Second)
+	if err != nil {
+		b.problem("api", err)
+		return
+	}
+	for name, path := range map[string]string{
+		"api/info.json":   "/api/v1/info",
+		"api/status.json": "/api/v1/status",
+		"api/metrics.txt": "/metrics",
+	} {
+		b.add(name, func(w io.Writer) error {
+			resp, err := client.Get(path)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if err := apiError(resp, http.StatusOK); err != nil {
+				return err
+			}
+			_, err = io.Copy(w, resp.Body)
+			return err
+		})
+	}
+}
+
+// recentLogs writes the daemon's last lines of log, from the journal or the
+// OpenRC and launchd log file
+func recentLogs(w io.Writer, lines int) error {
+	if _, err := exec.LookPath("journalctl"); err == nil {
+		out, err := exec.Command("journalctl", "-u", "airprint-bridge", "-n", strconv.Itoa(lines), "--no-pager").Output()
+		if err == nil && len(bytes.TrimSpace(out)) > 0 && !bytes.Contains(out, []byte("-- No entries --")) {
+			_, err = w.Write(out)
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		return fmt.Errorf("no journal entries and %w", err)
+	}
+	all := strings.SplitAfter(string(data), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	_, err = io.WriteString(w, strings.Join(all, ""))
+	return err
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
+	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+	"github.com/WaffleThief123/airprint-bridge/internal/dnssd"
+	"github.com/WaffleThief123/airprint-bridge/internal/e2e"
+	"github.com/WaffleThief123/airprint-bridge/internal/privsep"
+)
+
+// defaultConfigPath is where the config file is read from unless --config
+// says otherwise
+const defaultConfigPath = "/etc/airprint-bridge/airprint-bridge.yaml"
+
+// command is a subcommand, run as "airprint-bridge <name> [flags]"
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands lists the subcommands in the order usage shows them. Without
+// one, the daemon runs. Those without a summary are internal and not shown.
+var commands = []command{
+	{"run", "run the daemon (the default)", runDaemon},
+	{"list-printers", "list the printers CUPS has", runListPrinters},
+	{"list-profiles", "list the available media profiles", runListProfiles},
+	{"validate", "check the config file for mistakes", runValidate},
+	{"dry-run", "print the service files and IPP attributes each printer would get", runDryRun},
+	{"dns-sd-zone", "print unicast DNS-SD records for the advertised printers", runDNSSDZone},
+	{"dump-config", "print the effective configuration and where each setting came from", runDumpConfig},
+	{"support-bundle", "collect redacted config, logs and diagnostics into a tarball for bug reports", runSupportBundle},
+	{"cleanup", "remove service files left behind by a crashed daemon", runCleanup},
+	{"e2e", "test discovery, printing and job status end to end against a mock CUPS", runE2E},
+	{"test-print", "print a test page through the running bridge and CUPS and report how it went", runTestPrint},
+	{"maintenance", "put a printer in maintenance mode on the running daemon", runMaintenance},
+	{"resume", "return a printer from maintenance mode on the running daemon", runResume},
+	{"jobs", "list or reprint archived jobs on the running daemon", runJobsCommand},
+	{"version", "show the version", runVersion},
+	{privsep.HelperCommand, "", runPrivsepHelper},
+}
+
+// errProblemsFound ends a command that already reported what's wrong
+var errProblemsFound = errors.New("problems found")
+
+func main() {
+	name, args := commandLine(os.Args[1:])
+	if name == "help" {
+		usage(os.Stdout)
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err != nil {
+			if !errors.Is(err, errProblemsFound) {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: airprint-bridge [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		if cmd.summary != "" {
+			fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.summary)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "airprint-bridge <command> -h" for a command's flags.`)
+}
+
+// legacyFlags maps the flags that used to pick what the binary does to the
+// commands that replaced them
+var legacyFlags = map[string]string{
+	"version":         "version",
+	"list-printers":   "list-printers",
+	"list-profiles":   "list-profiles",
+	"validate-config": "validate",
+	"dry-run":         "dry-run",
+	"maintenance":     "maintenance",
+	"resume":          "resume",
+}
+
+// commandLine splits the arguments into a command and its arguments. Flags
+// without a command run the daemon, unless one of them is a legacy flag
+// standing for a command.
+func commandLine(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "run", nil
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		return "help", nil
+	}
+	if !strings.HasPrefix(args[0], "-") {
+		return args[0], args[1:]
+	}
+
+	name := "run"
+	var rest, positional []string
+	for i := 0; i < len(args); i++ {
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		cmd, ok := legacyFlags[flagName]
+		switch {
+		case flagName == "maintenance-message":
+			rest = append(rest, "--message")
+			if hasValue {
+				rest[len(rest)-1] += "=" + value
+			}
+			continue
+		case !ok || !strings.HasPrefix(args[i], "-"):
+			rest = append(rest, args[i])
+			continue
+		}
+
+		// -maintenance and -resume take the printer as their value
+		if cmd == "maintenance" || cmd == "resume" {
+			if !hasValue && i+1 < len(args) {
+				i++
+				value = args[i]
+			}
+			positional = append(positional, value)
+		} else if hasValue && value == "false" {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: --%s is deprecated, use \"airprint-bridge %s\"\n", flagName, cmd)
+		name = cmd
+	}
+	return name, append(rest, positional...)
+}
+
+// configFlags are the command line overrides of the config file, shared by
+// the commands that need the effective configuration
+type configFlags struct {
+	fs           *flag.FlagSet
+	path         *string
+	cupsHost     *string
+	cupsPort     *int
+	ippPort      *int
+	tlsCert      *string
+	tlsKey       *string
+	pollInterval *string
+	serviceDir   *string
+	sharedOnly   *bool
+	include      *string
+	logLevel     *string
+	logFormat    *string
+	logOutput    *string
+	apiToken     *string
+}
+
+// newConfigFlags registers the config override flags on fs
+func newConfigFlags(fs *flag.FlagSet) *configFlags {
+	return &configFlags{
+		fs:           fs,
+		path:         fs.String("config", defaultConfigPath, "path to config file"),
+		cupsHost:     fs.String("cups-host", "", "CUPS server host (default: localhost)"),
+		cupsPort:     fs.Int("cups-port", 0, "CUPS server port (default: 631)"),
+		ippPort:      fs.Int("ipp-port", 0, "IPP proxy server port (default: 8631)"),
+		tlsCert:      fs.String("tls-cert", "", "TLS certificate file for the IPPS listener"),
+		tlsKey:       fs.String("tls-key", "", "TLS private key file for the IPPS listener"),
+		pollInterval: fs.String("poll-interval", "", "printer polling interval (default: 30s)"),
+		serviceDir:   fs.String("service-dir", "", "Avahi services directory"),
+		sharedOnly:   fs.Bool("shared-only", true, "only advertise shared printers"),
+		include:      fs.String("include", "", "comma-separated printer names or patterns to advertise exclusively"),
+		logLevel:     fs.String("log-level", "", "log level: debug, info, warn, error"),
+		logFormat:    fs.String("log-format", "", "log format: json, console"),
+		logOutput:    fs.String("log-output", "", "where logs go: stdout, syslog, journald"),
+		apiToken:     fs.String("token", "", "bearer token for the running daemon's API (default: api.token)"),
+	}
+}
+
+// load builds the configuration from defaults, the config file, the
+// environment and command line overrides. It runs at startup and on each
+// reload.
+func (f *configFlags) load() (daemon.Config, error) {
+	config, _, err := f.loadFile()
+	return config, err
+}
+
+// loadFile is load, also returning the merged settings in config file form
+// and where each setting that isn't a default came from
+func (f *configFlags) loadFile() (daemon.Config, *loadedConfig, error) {
+	config := daemon.DefaultConfig()
+	config.ConfigFile = *f.path
+
+	// Load config file if it exists, then environment overrides
+	loaded := &loadedConfig{}
+	cfg, err := loadConfig(*f.path)
+	switch {
+	case os.IsNotExist(err):
+		cfg = &ConfigFile{}
+	case err != nil:
+		return config, nil, fmt.Errorf("failed to load config file: %w", err)
+	default:
+		loaded.file = *f.path
+	}
+	loaded.cfg = cfg
+	if loaded.env, err = applyEnv(cfg, os.Environ()); err != nil {
+		return config, nil, fmt.Errorf("invalid environment: %w", err)
+	}
+	loaded.flags = f.apply(cfg)
+	if err := applyFileConfig(&config, cfg); err != nil {
+		return config, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	for _, pattern := range append(append([]string{}, config.IncludeList...), config.ExcludeList...) {
+		if err := avahi.ValidatePattern(pattern); err != nil {
+			return config, nil, fmt.Errorf("invalid printer pattern %q: %w", pattern, err)
+		}
+	}
+	config.LogLevel = parseLogLevel(config.LogLevel).String()
+
+	return config, loaded, nil
+}
+
+// loadedConfig is the merged config file and environment and flag settings,
+// and where the settings came from
+type loadedConfig struct {
+	cfg   *ConfigFile
+	file  string            // Config file read, empty if there was none
+	env   map[string]string // YAML path -> variable that set it
+	flags map[string]string // YAML path -> flag that set it
+}
+
+// apply overrides settings in cfg with the flags given, and returns the
+// flag behind each setting, keyed by YAML path
+func (f *configFlags) apply(cfg *ConfigFile) map[string]string {
+	set := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	applied := make(map[string]string)
+	override := func(flagName, path string, apply func()) {
+		if set[flagName] {
+			apply()
+			applied[path] = "--" + flagName
+		}
+	}
+	override("cups-host", "cups.host", func() { cfg.CUPS.Host = *f.cupsHost })
+	override("cups-port", "cups.port", func() { cfg.CUPS.Port = *f.cupsPort })
+	override("ipp-port", "ipp.port", func() { cfg.IPP.Port = *f.ippPort })
+	override("tls-cert", "ipp.tls.cert_file", func() { cfg.IPP.TLS.CertFile = *f.tlsCert })
+	override("tls-key", "ipp.tls.key_file", func() { cfg.IPP.TLS.KeyFile = *f.tlsKey })
+	override("poll-interval", "monitor.poll_interval", func() { cfg.Monitor.PollInterval = *f.pollInterval })
+	override("service-dir", "avahi.service_dir", func() { cfg.Avahi.ServiceDir = *f.serviceDir })
+	override("include", "printers.include", func() {
+		cfg.Printers.Include = nil
+		for _, pattern := range strings.Split(*f.include, ",") {
+			cfg.Printers.Include = append(cfg.Printers.Include, strings.TrimSpace(pattern))
+		}
+	})
+	override("log-level", "log.level", func() { cfg.Log.Level = *f.logLevel })
+	override("log-format", "log.format", func() { cfg.Log.Format = *f.logFormat })
+	override("log-output", "log.output", func() { cfg.Log.Output = *f.logOutput })
+	override("token", "api.token", func() { cfg.API.Token = *f.apiToken })
+
+	// The flag defaults to true and used to win over the file; the
+	// environment only takes over when the flag isn't given
+	if set["shared-only"] || os.Getenv(envPrefix+"PRINTERS_SHARED_ONLY") == "" {
+		cfg.Printers.SharedOnly = *f.sharedOnly
+		applied["printers.shared_only"] = "--shared-only"
+		if !set["shared-only"] {
+			applied["printers.shared_only"] += " (default)"
+		}
+	}
+	return applied
+}
+
+// parseInterspersed parses args with fs, allowing flags after positional
+// arguments, and returns the positional ones
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for len(args) > 0 {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	return positional, nil
+}
+
+// parseConfigCommand parses the flags of a command that works from the
+// effective configuration, and loads it
+func parseConfigCommand(name string, args []string) (daemon.Config, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return daemon.Config{}, nil, err
+	}
+	config, err := flags.load()
+	return config, positional, err
+}
+
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// The settings last loaded are shown by the API, secrets redacted
+	var mu sync.Mutex
+	config, loaded, err := flags.loadFile()
+	if err != nil {
+		return err
+	}
+	reload := func() (daemon.Config, error) {
+		config, l, err := flags.loadFile()
+		if err == nil {
+			mu.Lock()
+			loaded = l
+			mu.Unlock()
+		}
+		return config, err
+	}
+	showConfig := func() (map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return configMap(loaded.cfg)
+	}
+
+	// Set up logging
+	zerolog.SetGlobalLevel(parseLogLevel(config.LogLevel))
+	log, err := newLogger(config)
+	if err != nil {
+		return err
+	}
+
+	// Create and run daemon
+	d := daemon.New(config, log)
+	d.SetReloadFunc(reload)
+	d.SetConfigFunc(showConfig)
+	d.SetBuildInfo(version, commit)
+	if err := d.Run(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("daemon failed")
+	}
+	return nil
+}
+
+func runVersion(args []string) error {
+	fmt.Printf("airprint-bridge version %s (commit %s)\n", version, commit)
+	return nil
+}
+
+func runListPrinters(args []string) error {
+	config, _, err := parseConfigCommand("list-printers", args)
+	if err != nil {
+		return err
+	}
+	return listAvailablePrinters(config)
+}
+
+func runListProfiles(args []string) error {
+	config, _, err := parseConfigCommand("list-profiles", args)
+	if err != nil {
+		return err
+	}
+	listAvailableProfiles(config)
+	return nil
+}
+
+// runValidate checks the file itself, before loading, which stops at the
+// first error and ignores unknown keys
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	path := fs.String("config", defaultConfigPath, "path to config file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ok, err := runValidateConfig(os.Stdout, *path)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errProblemsFound
+	}
+	return nil
+}
+
+func runDryRun(args []string) error {
+	config, _, err := parseConfigCommand("dry-run", args)
+	if err != nil {
+		return err
+	}
+	// Keep stdout for the output; only problems are logged
+	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+		Level(zerolog.WarnLevel).With().Timestamp().Logger()
+	return daemon.New(config, log).DryRun(os.Stdout)
+}
+
+// runDNSSDZone writes wide-area DNS-SD records for the printers that would
+// be advertised, for a unicast DNS server to publish
+func runDNSSDZone(args []string) error {
+	fs := flag.NewFlagSet("dns-sd-zone", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	format := fs.String("format", dnssd.FormatBIND, "record format: "+strings.Join(dnssd.Formats, ", "))
+	domain := fs.String("domain", "", "domain clients browse for printers, e.g. example.com")
+	host := fs.String("host", "", "DNS name of this machine, e.g. print.example.com")
+	addresses := fs.String("address", "", "comma-separated addresses to publish for the host, if it isn't in DNS already")
+	ttl := fs.Int("ttl", dnssd.DefaultTTL, "TTL of the records in seconds")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *domain == "" || *host == "" {
+		return fmt.Errorf("usage: airprint-bridge dns-sd-zone --domain DOMAIN --host HOST [--format FORMAT]")
+	}
+	known := false
+	for _, f := range dnssd.Formats {
+		known = known || f == *format
+	}
+	if !known {
+		return fmt.Errorf("unknown format %q (use %s)", *format, strings.Join(dnssd.Formats, ", "))
+	}
+	zone := dnssd.Zone{Domain: *domain, Host: *host, TTL: *ttl}
+	for _, a := range strings.Split(*addresses, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		ip := net.ParseIP(a)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", a)
+		}
+		zone.Addrs = append(zone.Addrs, ip)
+	}
+	config, err := flags.load()
+	if err != nil {
+		return err
+	}
+
+	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+		Level(zerolog.WarnLevel).With().Timestamp().Logger()
+	return daemon.New(config, log).WriteZone(os.Stdout, *format, zone)
+}
+
+// runE2E runs the bridge against a mock CUPS with a scripted client and
+// prints a pass/fail report, failing if any step did
+func runE2E(args []string) error {
+	fs := flag.NewFlagSet("e2e", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "longest each step may wait")
+	verbose := fs.Bool("verbose", false, "show the bridge's debug logs")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	level := zerolog.WarnLevel
+	if *verbose {
+		level = zerolog.DebugLevel
+	}
+	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+		Level(level).With().Timestamp().Logger()
+
+	report := e2e.Run(context.Background(), e2e.Options{Timeout: *timeout, Log: log})
+	report.Write(os.Stdout)
+	if !report.Passed() {
+		return errors.New("end-to-end test failed")
+	}
+	return nil
+}
+
+// runCleanup removes the service files a daemon that didn't shut down
+// cleanly left behind, so their printers stop being advertised
+func runCleanup(args []string) error {
+	config, _, err := parseConfigCommand("cleanup", args)
+	if err != nil {
+		return err
+	}
+	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+		Level(zerolog.InfoLevel).With().Timestamp().Logger()
+
+	manager := avahi.NewManager(config.ServiceDir, config.FilePrefix, config.CUPSPort, log)
+	if err := manager.DiscoverExisting(); err != nil {
+		return err
+	}
+	return manager.Cleanup()
+}
+
+func runMaintenance(args []string) error {
+	fs := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	message := fs.String("message", "", "message shown to users while in maintenance mode")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: airprint-bridge maintenance <printer> [--message TEXT]")
+	}
+	config, err := flags.load()
+	if err != nil {
+		return err
+	}
+	return setMaintenance(config, positional[0], *message, "")
+}
+
+func runResume(args []string) error {
+	config, positional, err := parseConfigCommand("resume", args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: airprint-bridge resume <printer>")
+	}
+	return setMaintenance(config, "", "", positional[0])
+}
+
+// runPrivsepHelper is the privileged helper the daemon starts before running
+// as security.user, writing service files on its behalf
+func runPrivsepHelper(args []string) error {
+	fs := flag.NewFlagSet(privsep.HelperCommand, flag.ExitOnError)
+	dir := fs.String("dir", "", "Avahi service directory")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return fmt.Errorf("--dir is required")
+	}
+	return privsep.RunHelper(*dir)
+}
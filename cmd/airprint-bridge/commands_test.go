@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{"no arguments", nil, "run", nil},
+		{"help", []string{"--help"}, "help", nil},
+		{"command", []string{"list-printers", "--cups-host", "cups"}, "list-printers", []string{"--cups-host", "cups"}},
+		{"daemon flags", []string{"--config", "/tmp/c.yaml"}, "run", []string{"--config", "/tmp/c.yaml"}},
+		{"legacy flag", []string{"--config=/tmp/c.yaml", "-version"}, "version", []string{"--config=/tmp/c.yaml"}},
+		{"legacy flag turned off", []string{"--dry-run=false"}, "run", nil},
+		{"renamed legacy flag", []string{"--validate-config"}, "validate", nil},
+		{"legacy printer value", []string{"--maintenance", "Office", "--maintenance-message", "toner"}, "maintenance", []string{"--message", "toner", "Office"}},
+		{"legacy printer after =", []string{"--resume=Office"}, "resume", []string{"Office"}},
+		{"legacy message after =", []string{"--maintenance=Office", "--maintenance-message=toner"}, "maintenance", []string{"--message=toner", "Office"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, args := commandLine(tt.args)
+			if name != tt.wantName || !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("commandLine(%q) = %q %q, want %q %q", tt.args, name, args, tt.wantName, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           []string
+		wantPositional []string
+		wantMessage    string
+	}{
+		{"flags first", []string{"--message", "toner", "Office"}, []string{"Office"}, "toner"},
+		{"flags after", []string{"Office", "--message", "toner"}, []string{"Office"}, "toner"},
+		{"several", []string{"Office", "--message=toner", "Lab"}, []string{"Office", "Lab"}, "toner"},
+		{"none", nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			message := fs.String("message", "", "")
+			positional, err := parseInterspersed(fs, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(positional, tt.wantPositional) || *message != tt.wantMessage {
+				t.Errorf("parseInterspersed() = %q message %q, want %q message %q", positional, *message, tt.wantPositional, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestRunCleanup(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{"airprint-Office.service", "airprint-Lab.service", "other.service", "airprint-notes.txt"}
+	for _, name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("<service-group/>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args := []string{"--config", filepath.Join(dir, "missing.yaml"), "--service-dir", dir}
+	if err := runCleanup(args); err != nil {
+		t.Fatalf("runCleanup() = %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	sort.Strings(left)
+	// Only the bridge's own service files go
+	if want := []string{"airprint-notes.txt", "other.service"}; !reflect.DeepEqual(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+)
+
+// redacted replaces secrets in dump-config output
+const redacted = "<redacted>"
+
+func runDumpConfig(args []string) error {
+	fs := flag.NewFlagSet("dump-config", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	showSecrets := fs.Bool("show-secrets", false, "print passwords and other secrets instead of hiding them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	_, loaded, err := flags.loadFile()
+	if err != nil {
+		return err
+	}
+	return dumpConfig(os.Stdout, loaded, *showSecrets)
+}
+
+// dumpConfig writes the effective settings as a config file, each value
+// commented with where it came from: a default, the file, the environment
+// or a flag
+func dumpConfig(w io.Writer, loaded *loadedConfig, showSecrets bool) error {
+	var effective, defaults, file yaml.Node
+	if err := effective.Encode(loaded.cfg); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := defaults.Encode(defaultConfigFile()); err != nil {
+		return fmt.Errorf("failed to encode defaults: %w", err)
+	}
+	if loaded.file != "" {
+		data, err := os.ReadFile(loaded.file)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	annotateSources(&effective, &defaults, documentRoot(&file), "", loaded)
+	if !showSecrets {
+		redactSecrets(&effective)
+	}
+
+	source := "no config file"
+	if loaded.file != "" {
+		source = loaded.file
+	}
+	effective.HeadComment = fmt.Sprintf("Effective configuration from defaults, %s, %s* variables and flags,\n"+
+		"later ones winning. Each setting notes where its value came from.", source, envPrefix)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(&effective)
+}
+
+// configMap returns the settings as the API shows them: in config file form,
+// secrets redacted
+func configMap(cfg *ConfigFile) (map[string]interface{}, error) {
+	var node yaml.Node
+	if err := node.Encode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	redactSecrets(&node)
+	m := make(map[string]interface{})
+	if err := node.Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return m, nil
+}
+
+// defaultConfigFile returns the daemon's defaults in config file form
+func defaultConfigFile() *ConfigFile {
+	d := daemon.DefaultConfig()
+	cfg := &ConfigFile{StateDir: d.StateDir}
+	cfg.CUPS.Host = d.CUPSHost
+	cfg.CUPS.Port = d.CUPSPort
+	cfg.IPP.Port = d.IPPPort
+	cfg.IPP.TLS.Port = d.TLSPort
+	cfg.IPP.StallTimeout = d.StallTimeout.String()
+	cfg.IPP.MaxConnsPerIP = d.MaxConnsPerIP
+	cfg.IPP.ReadTimeout = d.ReadTimeout.String()
+	cfg.IPP.WriteTimeout = d.WriteTimeout.String()
+	cfg.IPP.MaxHeaderBytes = d.MaxHeaderBytes
+	cfg.Monitor.PollInterval = d.PollInterval.String()
+	cfg.Avahi.ServiceDir = d.ServiceDir
+	cfg.Avahi.FilePrefix = d.FilePrefix
+	cfg.Avahi.LegacyFiles = d.LegacyFiles
+	cfg.Printers.SharedOnly = d.SharedOnly
+	cfg.Release.HoldTimeout = d.HoldTimeout.String()
+	cfg.Log.Level = parseLogLevel("").String()
+	cfg.Log.Output = d.LogOutput
+	maxSizeMB, maxBackups := int(d.LogMaxSize>>20), d.LogMaxBackups
+	cfg.Log.MaxSizeMB = &maxSizeMB
+	cfg.Log.MaxBackups = &maxBackups
+	cfg.Log.Syslog.Facility = d.SyslogFacility
+	cfg.Log.Syslog.Tag = d.SyslogTag
+	cfg.Display.Clock = "24h"
+	return cfg
+}
+
+// documentRoot returns the top-level mapping of a decoded document, or nil
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return nil
+}
+
+// annotateSources comments each setting of node with where it came from.
+// Settings nobody set show their default from defaults. file is the
+// matching part of the config file, nil where it has none.
+func annotateSources(node, defaults, file *yaml.Node, path string, loaded *loadedConfig) {
+	if node.Kind == yaml.DocumentNode {
+		annotateSources(node.Content[0], documentRoot(defaults), file, path, loaded)
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keyPath := path + key.Value
+		def := mappingValue(defaults, key.Value)
+		inFile := mappingValue(file, key.Value)
+
+		var source string
+		switch {
+		case loaded.flags[keyPath] != "":
+			source = "flag " + loaded.flags[keyPath]
+		case loaded.env[keyPath] != "":
+			source = "env " + loaded.env[keyPath]
+		case value.Kind == yaml.MappingNode && len(value.Content) > 0:
+			// Sections are annotated setting by setting
+			annotateSources(value, def, inFile, keyPath+".", loaded)
+			continue
+		case inFile != nil:
+			source = "file"
+		default:
+			source = "default"
+			if def != nil && def.Kind == yaml.ScalarNode {
+				*value = *def
+			}
+		}
+
+		// Comments on the key of a flow value are written on the next line
+		if value.Kind == yaml.ScalarNode || len(value.Content) == 0 {
+			value.LineComment = source
+		} else {
+			key.LineComment = source
+		}
+	}
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// redactSecrets hides the values of passwords and password hashes, including
+// those in lists
+func redactSecrets(node *yaml.Node) {
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 1 {
+			key := node.Content[i-1].Value
+			if child.Kind == yaml.ScalarNode && child.Value != "" && secretKey(key) {
+				child.Value = redacted
+				child.Tag = "!!str"
+				child.Style = 0
+			}
+		}
+		redactSecrets(child)
+	}
+}
+
+// secretKey reports whether a setting holds a password, an API token or a
+// hash of one. Hashes of short PINs are easily reversed.
+func secretKey(key string) bool {
+	return strings.Contains(key, "password") || key == "token" || strings.HasSuffix(key, "_sha256")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the names of environment variables that override settings
+// from the config file
+const envPrefix = "AIRPRINT_BRIDGE_"
+
+// envField is a setting that can be given in the environment
+type envField struct {
+	value reflect.Value
+	path  string // YAML path, e.g. ipp.port
+}
+
+// applyEnv overrides settings in cfg with the AIRPRINT_BRIDGE_* variables in
+// environ. A variable names a setting by its YAML path, e.g.
+// AIRPRINT_BRIDGE_IPP_PORT for ipp.port. Lists of strings are
+// comma-separated; per-printer lists and maps can only be set in the file.
+// It returns the variable that set each overridden setting, keyed by YAML
+// path.
+func applyEnv(cfg *ConfigFile, environ []string) (map[string]string, error) {
+	fields := make(map[string]envField)
+	envFields(reflect.ValueOf(cfg).Elem(), "", "", fields)
+
+	set := make(map[string]string)
+	var unknown []string
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+		field, ok := fields[strings.TrimPrefix(name, envPrefix)]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		if err := setEnvField(field.value, value); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		set[field.path] = name
+	}
+	if cfg.Strict && len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown environment variables (strict is on): %s", strings.Join(unknown, ", "))
+	}
+	return set, nil
+}
+
+// envFields adds the settings of struct v that can be set from the
+// environment to fields, keyed by variable name without the prefix
+func envFields(v reflect.Value, prefix, path string, fields map[string]envField) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + strings.ToUpper(name)
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			envFields(field, key+"_", path+name+".", fields)
+		case envSettable(field.Type()):
+			fields[key] = envField{value: field, path: path + name}
+		}
+	}
+}
+
+// envSettable reports whether a setting of type t can be given as a string
+func envSettable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return envSettable(t.Elem())
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func setEnvField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.Ptr:
+		ptr := reflect.New(field.Type().Elem())
+		if err := setEnvField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+	case reflect.Slice:
+		list := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item).Convert(field.Type().Elem()))
+			}
+		}
+		field.Set(list)
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	}
+	return nil
+}
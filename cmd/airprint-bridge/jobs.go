@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/api"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// runJobsCommand handles "airprint-bridge jobs ...", which works with the
+// running daemon's job archive through its API:
+//
+//	jobs list                          lists archived jobs
+//	jobs reprint <id> [--printer X]    prints an archived job again
+func runJobsCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: airprint-bridge jobs list|reprint <id> [--printer NAME]")
+	}
+
+	fs := flag.NewFlagSet("jobs "+args[0], flag.ContinueOnError)
+	flags := newConfigFlags(fs)
+	printer := fs.String("printer", "", "printer to reprint on instead of the original one")
+	command := args[0]
+
+	// Allow flags after the job ID, as in "jobs reprint 12 --printer X"
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	config, err := flags.load()
+	if err != nil {
+		return err
+	}
+	client, err := newAPIClient(config, 0)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "list":
+		return listArchivedJobs(client)
+	case "reprint":
+		if len(positional) != 1 {
+			return fmt.Errorf("usage: airprint-bridge jobs reprint <id> [--printer NAME]")
+		}
+		id, err := strconv.Atoi(positional[0])
+		if err != nil {
+			return fmt.Errorf("invalid job ID %q", positional[0])
+		}
+		return reprintJob(client, id, *printer)
+	default:
+		return fmt.Errorf("unknown jobs command %q", command)
+	}
+}
+
+func listArchivedJobs(client *api.Client) error {
+	resp, err := client.Get("/api/v1/archive")
+	if err != nil {
+		return fmt.Errorf("failed to reach daemon API: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := apiError(resp, http.StatusOK); err != nil {
+		return err
+	}
+
+	var list struct {
+		Jobs []jobs.Archived `json:"jobs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("invalid response from daemon: %w", err)
+	}
+	if len(list.Jobs) == 0 {
+		fmt.Println("No archived jobs")
+		return nil
+	}
+	for _, j := range list.Jobs {
+		fmt.Printf("%6d  %s  %-20s  %-12s  %s\n", j.ID, j.CreatedAt.Format(time.DateTime), j.Printer, j.User, j.Name)
+	}
+	return nil
+}
+
+func reprintJob(client *api.Client, id int, printer string) error {
+	body, _ := json.Marshal(map[string]string{"printer": printer})
+	resp, err := client.Do(http.MethodPost, fmt.Sprintf("/api/v1/archive/%d/reprint", id), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to reach daemon API: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := apiError(resp, http.StatusCreated); err != nil {
+		return err
+	}
+
+	var job struct {
+		JobID   int    `json:"job_id"`
+		Printer string `json:"printer"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&job)
+	fmt.Printf("Archived job %d reprinted on %s as job %d\n", id, job.Printer, job.JobID)
+	return nil
+}
+
+// apiError returns the daemon's error message if the response isn't the
+// expected status
+func apiError(resp *http.Response, want int) error {
+	if resp.StatusCode == want {
+		return nil
+	}
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = json.Unmarshal(data, &apiErr)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("daemon returned %s: pass a token from auth.api.tokens with --token, AIRPRINT_BRIDGE_API_TOKEN or api.token", resp.Status)
+	}
+	return fmt.Errorf("daemon returned %s: %s", resp.Status, apiErr.Error)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+	"github.com/WaffleThief123/airprint-bridge/internal/logfile"
+	"github.com/WaffleThief123/airprint-bridge/internal/systemd"
+)
+
+// syslogFacilities maps log.syslog.facility names to facilities
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// syslogAddress splits a log.syslog.address into the network and address to
+// dial. Without a scheme the server is reached over UDP.
+func syslogAddress(address string) (network, addr string, err error) {
+	network, addr, ok := strings.Cut(address, "://")
+	if !ok {
+		network, addr = "udp", address
+	}
+	if network != "udp" && network != "tcp" {
+		return "", "", fmt.Errorf("unsupported network %q, want udp or tcp", network)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", err
+	}
+	return network, addr, nil
+}
+
+// newLogger creates the daemon's logger, writing where log.output says, or
+// to log.file
+func newLogger(config daemon.Config) (zerolog.Logger, error) {
+	switch config.LogOutput {
+	case "syslog":
+		network, addr := "", ""
+		if config.SyslogAddress != "" {
+			network, addr, _ = syslogAddress(config.SyslogAddress)
+		}
+		w, err := syslog.Dial(network, addr, syslogFacilities[config.SyslogFacility]|syslog.LOG_INFO, config.SyslogTag)
+		if err != nil {
+			return zerolog.Logger{}, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		var out zerolog.LevelWriter = zerolog.SyslogLevelWriter(w)
+		if config.LogFormat != "json" {
+			out = syslogConsoleWriter{out}
+		}
+		return zerolog.New(out), nil
+	case "journald":
+		w, err := systemd.NewJournalWriter(config.SyslogTag)
+		if err != nil {
+			return zerolog.Logger{}, err
+		}
+		return zerolog.New(w), nil
+	}
+	if config.LogFile != "" {
+		w, err := logfile.Open(config.LogFile, logfile.Rotation{
+			MaxSize:    config.LogMaxSize,
+			MaxAge:     config.LogMaxAge,
+			MaxBackups: config.LogMaxBackups,
+		})
+		if err != nil {
+			return zerolog.Logger{}, err
+		}
+		if config.LogFormat == "json" {
+			return zerolog.New(w).With().Timestamp().Logger(), nil
+		}
+		return zerolog.New(zerolog.ConsoleWriter{Out: w, NoColor: true, TimeFormat: time.RFC3339}).
+			With().Timestamp().Logger(), nil
+	}
+	if config.LogFormat == "json" {
+		return zerolog.New(os.Stdout).With().Timestamp().Logger(), nil
+	}
+	return zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
+		With().Timestamp().Logger(), nil
+}
+
+// syslogConsoleWriter writes entries to syslog as console lines, without the
+// time and level syslog records itself
+type syslogConsoleWriter struct {
+	w zerolog.LevelWriter
+}
+
+func (s syslogConsoleWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (s syslogConsoleWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var buf bytes.Buffer
+	cw := zerolog.ConsoleWriter{
+		Out:          &buf,
+		NoColor:      true,
+		PartsExclude: []string{zerolog.TimestampFieldName, zerolog.LevelFieldName},
+	}
+	if _, err := cw.Write(p); err != nil {
+		return 0, err
+	}
+	if _, err := s.w.WriteLevel(level, bytes.TrimSuffix(buf.Bytes(), []byte("\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
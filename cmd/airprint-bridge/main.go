@@ -1,19 +1,36 @@
 package main
 
 import (
-	"context"
-	"flag"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image/png"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
 
+	"github.com/WaffleThief123/airprint-bridge/internal/airprint"
+	"github.com/WaffleThief123/airprint-bridge/internal/api"
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
 	"github.com/WaffleThief123/airprint-bridge/internal/cups"
 	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+	"github.com/WaffleThief123/airprint-bridge/internal/identify"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
 	"github.com/WaffleThief123/airprint-bridge/internal/media"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+	"github.com/WaffleThief123/airprint-bridge/internal/schedule"
 )
 
 // Version information (set at build time)
@@ -24,13 +41,64 @@ var (
 
 // ConfigFile represents the YAML configuration file structure
 type ConfigFile struct {
+	// Refuse to start on unknown or mistyped keys instead of ignoring them
+	Strict bool `yaml:"strict"`
+
+	// Where printer UUIDs, tracked jobs and the last printer list are kept
+	// across restarts
+	StateDir string `yaml:"state_dir"`
+
 	CUPS struct {
 		Host string `yaml:"host"`
 		Port int    `yaml:"port"`
+		Auth struct {
+			Username string `yaml:"username"` // Sent with every job unless the printer has its own
+			Password string `yaml:"password"`
+			Printers []struct {
+				Printer  string `yaml:"printer"`
+				Username string `yaml:"username"`
+				Password string `yaml:"password"`
+				Relay    bool   `yaml:"relay"` // Pass the client's credentials on instead
+			} `yaml:"printers"`
+		} `yaml:"auth"`
 	} `yaml:"cups"`
 
 	IPP struct {
-		Port int `yaml:"port"`
+		Port              int    `yaml:"port"`
+		SubmitTimeout     string `yaml:"submit_timeout"`  // Abandon a job that takes longer to forward
+		StatusTTL         string `yaml:"status_ttl"`      // Reuse printer status fetched from CUPS this long, 0 to report the last poll's
+		TraceJobNames     bool   `yaml:"trace_job_names"` // Append the job's trace ID to its CUPS job name
+		StallTimeout      string `yaml:"stall_timeout"`   // Abort an upload that sends nothing for this long
+		MinUploadRate     int    `yaml:"min_upload_rate"`
+		MaxConnsPerIP     int    `yaml:"max_connections_per_ip"`
+		ReadTimeout       string `yaml:"read_timeout"`                   // Limit on reading a request's headers
+		WriteTimeout      string `yaml:"write_timeout"`                  // Limit on answering once a request has arrived
+		MaxHeaderBytes    int    `yaml:"max_header_bytes"`               // Largest request headers accepted
+		MaxDocumentMB     int    `yaml:"max_document_mb"`                // Largest request, document included, 0 for no limit
+		MaxQueuedJobs     int    `yaml:"max_queued_jobs"`                // Per printer; refuse jobs as busy beyond this
+		MaxConcurrentJobs int    `yaml:"max_concurrent_jobs"`            // Jobs being sent at once; refuse more as busy
+		MaxClientJobs     int    `yaml:"max_concurrent_jobs_per_client"` // The same for one client address
+		PortBase          int    `yaml:"printer_port_base"`              // Serve each printer on its own port from here up
+		TLS               struct {
+			Port           int      `yaml:"port"`
+			CertFile       string   `yaml:"cert_file"`
+			KeyFile        string   `yaml:"key_file"`
+			MinVersion     string   `yaml:"min_version"`     // 1.2 or 1.3
+			CipherSuites   []string `yaml:"cipher_suites"`   // TLS 1.2 suites, in order of preference
+			SessionTickets *bool    `yaml:"session_tickets"` // false: full handshake on every connection
+		} `yaml:"tls"`
+		// Workarounds for clients that misbehave, matched on User-Agent
+		Quirks struct {
+			Disable []string `yaml:"disable"` // Built-in quirks to turn off, or "all"
+			Rules   []struct {
+				Name       string   `yaml:"name"`
+				UserAgent  string   `yaml:"user_agent"`  // Regular expression
+				Omit       []string `yaml:"omit"`        // Printer attributes to leave out
+				IPPVersion string   `yaml:"ipp_version"` // 1.1 or 2.0
+				Chunked    bool     `yaml:"chunked"`
+				Close      bool     `yaml:"close"` // Close the connection after each response
+			} `yaml:"rules"`
+		} `yaml:"quirks"`
 	} `yaml:"ipp"`
 
 	Monitor struct {
@@ -40,11 +108,30 @@ type ConfigFile struct {
 	Avahi struct {
 		ServiceDir string `yaml:"service_dir"`
 		FilePrefix string `yaml:"file_prefix"`
+		// What to do with AirPrint service files from airprint-generate and
+		// similar tools: keep, replace or adopt
+		LegacyFiles string `yaml:"legacy_files"`
 	} `yaml:"avahi"`
 
+	MDNS struct {
+		Interfaces []string `yaml:"interfaces"`        // Advertise only here, with the built-in responder
+		Prefer     []string `yaml:"prefer_interfaces"` // Printer URIs name the first address of these, in order
+
+		// Re-announce printers found on some interfaces on others
+		Reflect struct {
+			From     []string `yaml:"from"`
+			To       []string `yaml:"to"`
+			Include  []string `yaml:"include"` // Instance name patterns, as for printers.include
+			Exclude  []string `yaml:"exclude"`
+			Interval string   `yaml:"interval"` // How often to browse, default 30s
+		} `yaml:"reflect"`
+	} `yaml:"mdns"`
+
 	Printers struct {
-		SharedOnly bool     `yaml:"shared_only"`
-		Exclude    []string `yaml:"exclude"`
+		SharedOnly bool              `yaml:"shared_only"`
+		Include    []string          `yaml:"include"` // Only advertise these; wildcards like "Zebra-*" allowed
+		Exclude    []string          `yaml:"exclude"`
+		Rename     map[string]string `yaml:"rename"` // CUPS queue name -> name shown to clients
 	} `yaml:"printers"`
 
 	// Media overrides per printer
@@ -53,99 +140,311 @@ type ConfigFile struct {
 		Profile      string   `yaml:"profile"`       // Use a built-in profile (e.g., "zebra-4x6")
 		Sizes        []string `yaml:"sizes"`         // Or specify custom sizes
 		DefaultSize  string   `yaml:"default_size"`  // Default media size
+		AutoDetect   *bool    `yaml:"auto_detect"`   // false: no profile by make/model
 	} `yaml:"media"`
 
-	Log struct {
-		Level  string `yaml:"level"`
-		Format string `yaml:"format"`
-	} `yaml:"log"`
-}
+	// Media profiles defined here, alongside the built-in ones
+	MediaProfiles []media.ProfileConfig `yaml:"media_profiles"`
 
-func main() {
-	// Command line flags
-	var (
-		configPath    = flag.String("config", "/etc/airprint-bridge/airprint-bridge.yaml", "path to config file")
-		cupsHost      = flag.String("cups-host", "", "CUPS server host (default: localhost)")
-		cupsPort      = flag.Int("cups-port", 0, "CUPS server port (default: 631)")
-		ippPort       = flag.Int("ipp-port", 0, "IPP proxy server port (default: 8631)")
-		pollInterval  = flag.String("poll-interval", "", "printer polling interval (default: 30s)")
-		serviceDir    = flag.String("service-dir", "", "Avahi services directory")
-		sharedOnly    = flag.Bool("shared-only", true, "only advertise shared printers")
-		logLevel      = flag.String("log-level", "", "log level: debug, info, warn, error")
-		logFormat     = flag.String("log-format", "", "log format: json, console")
-		showVersion   = flag.Bool("version", false, "show version and exit")
-		listPrinters  = flag.Bool("list-printers", false, "list available printers and exit")
-		listProfiles  = flag.Bool("list-profiles", false, "list available media profiles and exit")
-	)
-	flag.Parse()
+	// Directory of *.yaml files with more media profiles, e.g. profile packs
+	ProfilesDir string `yaml:"profiles_dir"`
 
-	if *showVersion {
-		fmt.Printf("airprint-bridge version %s (commit %s)\n", version, commit)
-		os.Exit(0)
-	}
+	// Keep printed documents so they can be reprinted
+	Archive struct {
+		Dir    string `yaml:"dir"`
+		MaxAge string `yaml:"max_age"` // e.g. "168h"; empty keeps them until removed
 
-	// Start with defaults
-	config := daemon.DefaultConfig()
+		// Megabytes kept per printer before its oldest documents are removed
+		MaxMB  int `yaml:"max_mb"`
+		Quotas []struct {
+			Printer string `yaml:"printer"`
+			MaxMB   int    `yaml:"max_mb"`
+		} `yaml:"quotas"`
+	} `yaml:"archive"`
 
-	// Load config file if it exists
-	if cfg, err := loadConfig(*configPath); err == nil {
-		applyFileConfig(&config, cfg)
-	} else if !os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "Warning: failed to load config file: %v\n", err)
-	}
+	// Hot spare pairs: jobs for a stopped primary go to its backup
+	Failover []struct {
+		Primary string `yaml:"primary"`
+		Backup  string `yaml:"backup"`
+	} `yaml:"failover"`
 
-	// Apply command line overrides
-	if *cupsHost != "" {
-		config.CUPSHost = *cupsHost
-	}
-	if *cupsPort != 0 {
-		config.CUPSPort = *cupsPort
-	}
+	// Virtual AirPrint destinations backed by several CUPS queues
+	VirtualPrinters []struct {
+		Name    string   `yaml:"name"`
+		Mode    string   `yaml:"mode"`
+		Members []string `yaml:"members"`
+	} `yaml:"virtual_printers"`
 
-	if *listPrinters {
-		listAvailablePrinters(config.CUPSHost, config.CUPSPort)
-		os.Exit(0)
-	}
+	// Variants of printers advertised under a test name with their own settings
+	Staged []struct {
+		Printer     string `yaml:"printer"`
+		Name        string `yaml:"name"`
+		DisplayName string `yaml:"display_name"`
+	} `yaml:"staged"`
 
-	if *listProfiles {
-		listAvailableProfiles()
-		os.Exit(0)
-	}
+	// Test printer that accepts jobs and throws them away
+	NullPrinter struct {
+		Enabled bool   `yaml:"enabled"`
+		Name    string `yaml:"name"`
+	} `yaml:"null_printer"`
 
-	// Apply remaining command line overrides
-	if *ippPort != 0 {
-		config.IPPPort = *ippPort
-	}
-	if *pollInterval != "" {
-		if d, err := time.ParseDuration(*pollInterval); err == nil {
-			config.PollInterval = d
-		}
-	}
-	if *serviceDir != "" {
-		config.ServiceDir = *serviceDir
-	}
-	config.SharedOnly = *sharedOnly
+	Webhooks struct {
+		URLs []string `yaml:"urls"`
+	} `yaml:"webhooks"`
 
-	// Set up logging
-	level := zerolog.InfoLevel
-	if *logLevel != "" {
-		level = parseLogLevel(*logLevel)
-	}
-	zerolog.SetGlobalLevel(level)
+	// Admin HTTP API (disabled unless listen is set)
+	API struct {
+		Listen string `yaml:"listen"`
+		// Bearer token the command line tools send to the running daemon,
+		// one of auth.api.tokens
+		Token string `yaml:"token"`
+	} `yaml:"api"`
 
-	var log zerolog.Logger
-	if *logFormat == "json" {
-		log = zerolog.New(os.Stdout).With().Timestamp().Logger()
-	} else {
-		log = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339}).
-			With().Timestamp().Logger()
-	}
+	// How times are shown in the API, web pages and reports
+	Display struct {
+		TimeZone string `yaml:"timezone"` // IANA name, e.g. Europe/Berlin; empty for the host's
+		Clock    string `yaml:"clock"`    // 24h or 12h
+	} `yaml:"display"`
 
-	// Create and run daemon
-	d := daemon.New(config, log)
-	if err := d.Run(context.Background()); err != nil {
-		log.Fatal().Err(err).Msg("daemon failed")
-	}
+	Labels struct {
+		TemplateDir string `yaml:"template_dir"`
+	} `yaml:"labels"`
+
+	// Require a user name and password to print (HTTP Basic auth)
+	Auth struct {
+		Users []struct {
+			Name           string `yaml:"name"`
+			PasswordSHA256 string `yaml:"password_sha256"` // hex, e.g. from "echo -n secret | sha256sum"
+		} `yaml:"users"`
+		// Time-limited passwords for visitors, minted at /ui/guest on the API
+		GuestTokens struct {
+			Enabled     bool   `yaml:"enabled"`
+			MaxLifetime string `yaml:"max_lifetime"`
+		} `yaml:"guest_tokens"`
+		// Named sources of users: htpasswd, pam or ldap. auth.users is
+		// available as the provider "users".
+		Providers []struct {
+			Name         string `yaml:"name"`
+			Type         string `yaml:"type"`
+			File         string `yaml:"file"`    // htpasswd
+			Service      string `yaml:"service"` // pam
+			URL          string `yaml:"url"`     // ldap
+			StartTLS     bool   `yaml:"start_tls"`
+			CAFile       string `yaml:"ca_file"`
+			BindDN       string `yaml:"bind_dn"`
+			BindPassword string `yaml:"bind_password"`
+			BaseDN       string `yaml:"base_dn"`
+			UserFilter   string `yaml:"user_filter"`
+			UserDN       string `yaml:"user_dn"`
+			GroupFilter  string `yaml:"group_filter"`
+			Timeout      string `yaml:"timeout"`
+		} `yaml:"providers"`
+		// Providers asked, in order, by each listener
+		IPP struct {
+			Providers []string `yaml:"providers"`
+		} `yaml:"ipp"`
+		API struct {
+			Providers []string `yaml:"providers"`
+			// Bearer tokens for scripts and home automation
+			Tokens []struct {
+				Name        string `yaml:"name"`
+				TokenSHA256 string `yaml:"token_sha256"` // hex, e.g. from "echo -n token | sha256sum"
+			} `yaml:"tokens"`
+		} `yaml:"api"`
+		// Limit who may print to a printer by user name or directory group
+		Access []struct {
+			Printer string   `yaml:"printer"`
+			Users   []string `yaml:"users"`
+			Groups  []string `yaml:"groups"`
+			Guests  bool     `yaml:"guests"` // Also allow guest tokens
+		} `yaml:"access"`
+		Groups struct {
+			Provider string `yaml:"provider"`  // ldap provider that resolves group membership
+			CacheTTL string `yaml:"cache_ttl"` // How long memberships are remembered
+		} `yaml:"groups"`
+	} `yaml:"auth"`
+
+	// Fill in printer locations from external sources
+	Location struct {
+		Override bool `yaml:"override"` // Also replace locations set in CUPS
+		Sources  []struct {
+			Type string `yaml:"type"` // csv, dns or lldp
+			Path string `yaml:"path"` // csv: inventory file
+			Name string `yaml:"name"` // dns: TXT record name, e.g. "{queue}.printers.example.com"
+		} `yaml:"sources"`
+		// Coordinates advertised as printer-geo-location
+		Geo []struct {
+			Printer   string   `yaml:"printer"`
+			Latitude  float64  `yaml:"latitude"`
+			Longitude float64  `yaml:"longitude"`
+			Altitude  *float64 `yaml:"altitude"` // Metres, optional
+		} `yaml:"geo"`
+	} `yaml:"location"`
+
+	// PNG icons clients show for printers instead of a generic one
+	Icons []struct {
+		Printer string `yaml:"printer"`
+		File    string `yaml:"file"`
+	} `yaml:"icons"`
+
+	// Convert Apple Raster jobs for queues whose drivers can't print image/urf
+	URFConversion []struct {
+		Printer string `yaml:"printer"`
+		Format  string `yaml:"format"` // pdf or pwg
+	} `yaml:"urf_conversion"`
+
+	// Formats to retry Apple Raster jobs in when CUPS rejects the format they
+	// were sent in
+	FormatFallback []struct {
+		Printer string   `yaml:"printer"`
+		Formats []string `yaml:"formats"` // urf, pwg or pdf, tried in order
+	} `yaml:"format_fallback"`
+
+	// Per-printer document format preference; clients usually send the first
+	// listed format they support
+	DocumentFormats []struct {
+		Printer string   `yaml:"printer"`
+		Prefer  []string `yaml:"prefer"` // MIME types, e.g. application/pdf
+	} `yaml:"document_formats"`
+
+	// Per-printer adjustments to the advertised URF capability string
+	URF []struct {
+		Printer string   `yaml:"printer"`
+		Replace string   `yaml:"replace"` // Full URF string advertised instead of the generated one
+		Add     []string `yaml:"add"`     // Tokens to add, e.g. IS1, MT1-8 or RS203
+		Remove  []string `yaml:"remove"`  // Tokens to drop, e.g. SRGB24
+	} `yaml:"urf"`
+
+	// Stamp text on every page of Apple Raster jobs
+	Watermarks []struct {
+		Printer string `yaml:"printer"`
+		Text    string `yaml:"text"` // {user}, {job}, {printer}, {date} and {time} are filled in
+	} `yaml:"watermarks"`
+
+	// Experimental behaviors, enabled one printer at a time
+	Features []struct {
+		Printer string   `yaml:"printer"`
+		Enable  []string `yaml:"enable"` // strict-validate, legacy-ipp11 or urf-transcode
+	} `yaml:"features"`
+
+	// Make printers show themselves when a client sends Identify-Printer
+	Identify []struct {
+		Printer  string            `yaml:"printer"`
+		Method   string            `yaml:"method"`   // zebra or ipp
+		Address  string            `yaml:"address"`  // zebra: host[:port], default the device URI's host
+		URI      string            `yaml:"uri"`      // ipp: printer URI, default the device URI
+		Actions  []string          `yaml:"actions"`  // ipp: flash, sound or display
+		Commands map[string]string `yaml:"commands"` // zebra: command per action
+	} `yaml:"identify"`
+
+	// Render jobs to ZPL and send them to the printer's raw port instead of
+	// through the CUPS queue's filters
+	Raw []struct {
+		Printer string `yaml:"printer"`
+		Address string `yaml:"address"` // host[:port], default the device URI's host on 9100
+	} `yaml:"raw"`
+
+	// Network printers served without a CUPS queue
+	Standalone []struct {
+		Name         string   `yaml:"name"`
+		URI          string   `yaml:"uri"`      // socket://host[:port], ipp://host/path or ipps://host/path
+		Language     string   `yaml:"language"` // pdf, pwg or zpl; socket printers default to pdf
+		MakeModel    string   `yaml:"make_model"`
+		Location     string   `yaml:"location"`
+		Info         string   `yaml:"info"`
+		Color        bool     `yaml:"color"`
+		Duplex       bool     `yaml:"duplex"`
+		Resolutions  []int    `yaml:"resolutions"`
+		Media        []string `yaml:"media"`
+		MediaDefault string   `yaml:"media_default"`
+	} `yaml:"standalone"`
+
+	// Driverless IPP printers on other subnets, advertised here with the
+	// capabilities they report
+	Reexport []struct {
+		Name      string `yaml:"name"`
+		URI       string `yaml:"uri"` // ipp://host/path or ipps://host/path
+		MakeModel string `yaml:"make_model"`
+		Location  string `yaml:"location"`
+		Info      string `yaml:"info"`
+	} `yaml:"reexport"`
+
+	// Serve printers on a port of their own as well as ipp.port
+	PrinterPorts []struct {
+		Printer string `yaml:"printer"`
+		Port    int    `yaml:"port"`
+	} `yaml:"printer_ports"`
+
+	// How pages are scaled onto the media, e.g. "fill" for label printers
+	Scaling []struct {
+		Printer string `yaml:"printer"`
+		Default string `yaml:"default"` // auto, auto-fit, fill, fit or none
+		Force   bool   `yaml:"force"`   // Ignore the scaling clients ask for
+	} `yaml:"scaling"`
+
+	// Per-printer overrides of ipp.max_queued_jobs
+	QueueLimits []struct {
+		Printer string `yaml:"printer"`
+		MaxJobs int    `yaml:"max_jobs"` // 0 for no limit
+	} `yaml:"queue_limits"`
+
+	// Hold jobs until their owner releases them on the web or at a kiosk
+	Release struct {
+		Printers    []string `yaml:"printers"`
+		HoldTimeout string   `yaml:"hold_timeout"` // Cancel jobs never released after this long
+		PINs        []struct {
+			User      string `yaml:"user"`
+			PINSHA256 string `yaml:"pin_sha256"`
+		} `yaml:"pins"`
+	} `yaml:"release"`
+
+	// Per-printer availability windows, e.g. business hours only
+	Schedules []struct {
+		Printer string           `yaml:"printer"`
+		Allow   []ScheduleWindow `yaml:"allow"` // Served only inside these windows
+		Deny    []ScheduleWindow `yaml:"deny"`  // Never served inside these windows
+	} `yaml:"schedules"`
+
+	// Reload automatically when this file changes, in addition to SIGHUP
+	WatchConfig bool `yaml:"watch_config"`
+
+	// Run as an unprivileged user once ports are bound, with a helper
+	// keeping root only to write Avahi service files
+	Security struct {
+		User  string `yaml:"user"`
+		Group string `yaml:"group"` // Defaults to the user's primary group
+		// Networks IPP clients may connect from, e.g. 192.168.1.0/24; empty for any
+		AllowedNetworks []string `yaml:"allowed_networks"`
+	} `yaml:"security"`
+
+	Audit struct {
+		Enabled bool   `yaml:"enabled"`
+		File    string `yaml:"file"` // Empty for the main log
+	} `yaml:"audit"`
+
+	Log struct {
+		Level  string `yaml:"level"`
+		Format string `yaml:"format"`
+		Output string `yaml:"output"` // stdout, syslog or journald
+		File   string `yaml:"file"`   // Written instead of stdout when set
+		// Rotation of File: size in MB it's rotated at and old files kept,
+		// 0 for no limit; old files older than MaxAge are removed
+		MaxSizeMB  *int   `yaml:"max_size_mb"`
+		MaxAge     string `yaml:"max_age"`
+		MaxBackups *int   `yaml:"max_backups"`
+		Syslog     struct {
+			Facility string `yaml:"facility"`
+			Tag      string `yaml:"tag"`
+			Address  string `yaml:"address"` // Empty for the local syslog
+		} `yaml:"syslog"`
+	} `yaml:"log"`
+}
+
+// ScheduleWindow is a recurring weekly time range in a printer schedule
+type ScheduleWindow struct {
+	Days  string `yaml:"days"`  // e.g. "mon-fri" or "sat,sun"; empty means every day
+	Start string `yaml:"start"` // HH:MM
+	End   string `yaml:"end"`   // HH:MM
 }
 
 func loadConfig(path string) (*ConfigFile, error) {
@@ -155,37 +454,422 @@ func loadConfig(path string) (*ConfigFile, error) {
 	}
 
 	var cfg ConfigFile
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	err = yaml.Unmarshal(data, &cfg)
+	var typeErr *yaml.TypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	// A mistyped value still leaves strict readable, for a better error
+	if cfg.Strict {
+		if err := decodeStrict(data); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
 	return &cfg, nil
 }
 
-func applyFileConfig(config *daemon.Config, cfg *ConfigFile) {
+func applyFileConfig(config *daemon.Config, cfg *ConfigFile) error {
 	if cfg.CUPS.Host != "" {
 		config.CUPSHost = cfg.CUPS.Host
 	}
 	if cfg.CUPS.Port != 0 {
 		config.CUPSPort = cfg.CUPS.Port
 	}
+	config.CUPSUser = cfg.CUPS.Auth.Username
+	config.CUPSPassword = cfg.CUPS.Auth.Password
+	for _, p := range cfg.CUPS.Auth.Printers {
+		if p.Printer == "" {
+			return fmt.Errorf("cups.auth.printers entries need a printer")
+		}
+		if p.Relay && p.Username != "" {
+			return fmt.Errorf("cups.auth for %s: set either relay or a username, not both", p.Printer)
+		}
+		if !p.Relay && p.Username == "" {
+			return fmt.Errorf("cups.auth for %s: needs a username or relay", p.Printer)
+		}
+		if config.CUPSPrinterAuth == nil {
+			config.CUPSPrinterAuth = make(map[string]daemon.CUPSAuth)
+		}
+		config.CUPSPrinterAuth[p.Printer] = daemon.CUPSAuth{User: p.Username, Password: p.Password, Relay: p.Relay}
+	}
 	if cfg.IPP.Port != 0 {
 		config.IPPPort = cfg.IPP.Port
 	}
+	if cfg.IPP.PortBase < 0 || cfg.IPP.PortBase > 65535 {
+		return fmt.Errorf("ipp.printer_port_base %d out of range 1-65535", cfg.IPP.PortBase)
+	}
+	config.PrinterPortBase = cfg.IPP.PortBase
+	for _, pp := range cfg.PrinterPorts {
+		if pp.Printer == "" {
+			return fmt.Errorf("printer_ports entries need a printer")
+		}
+		if pp.Port < 1 || pp.Port > 65535 {
+			return fmt.Errorf("printer_ports for %s: port %d out of range 1-65535", pp.Printer, pp.Port)
+		}
+		for name, port := range config.PrinterPorts {
+			if port == pp.Port {
+				return fmt.Errorf("printer_ports: %s and %s both use port %d", name, pp.Printer, pp.Port)
+			}
+		}
+		if config.PrinterPorts == nil {
+			config.PrinterPorts = make(map[string]int)
+		}
+		config.PrinterPorts[pp.Printer] = pp.Port
+	}
+	if cfg.IPP.SubmitTimeout != "" {
+		d, err := time.ParseDuration(cfg.IPP.SubmitTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid ipp.submit_timeout: %w", err)
+		}
+		config.SubmitTimeout = d
+	}
+	if cfg.IPP.StatusTTL != "" {
+		d, err := time.ParseDuration(cfg.IPP.StatusTTL)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid ipp.status_ttl: %q", cfg.IPP.StatusTTL)
+		}
+		config.StatusTTL = d
+	}
+	config.TraceJobNames = cfg.IPP.TraceJobNames
+	if cfg.IPP.StallTimeout != "" {
+		d, err := time.ParseDuration(cfg.IPP.StallTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid ipp.stall_timeout: %w", err)
+		}
+		config.StallTimeout = d
+	}
+	if cfg.IPP.MinUploadRate < 0 {
+		return fmt.Errorf("invalid ipp.min_upload_rate: %d", cfg.IPP.MinUploadRate)
+	}
+	config.MinUploadRate = cfg.IPP.MinUploadRate
+	if cfg.IPP.MaxConnsPerIP != 0 {
+		config.MaxConnsPerIP = cfg.IPP.MaxConnsPerIP
+	}
+	if cfg.IPP.ReadTimeout != "" {
+		d, err := time.ParseDuration(cfg.IPP.ReadTimeout)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid ipp.read_timeout: %q", cfg.IPP.ReadTimeout)
+		}
+		config.ReadTimeout = d
+	}
+	if cfg.IPP.WriteTimeout != "" {
+		d, err := time.ParseDuration(cfg.IPP.WriteTimeout)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid ipp.write_timeout: %q", cfg.IPP.WriteTimeout)
+		}
+		config.WriteTimeout = d
+	}
+	if cfg.IPP.MaxHeaderBytes < 0 {
+		return fmt.Errorf("invalid ipp.max_header_bytes: %d", cfg.IPP.MaxHeaderBytes)
+	}
+	if cfg.IPP.MaxHeaderBytes != 0 {
+		config.MaxHeaderBytes = cfg.IPP.MaxHeaderBytes
+	}
+	if cfg.IPP.MaxDocumentMB < 0 {
+		return fmt.Errorf("invalid ipp.max_document_mb: %d", cfg.IPP.MaxDocumentMB)
+	}
+	config.MaxDocumentSize = int64(cfg.IPP.MaxDocumentMB) << 20
+	if cfg.IPP.MaxQueuedJobs < 0 {
+		return fmt.Errorf("invalid ipp.max_queued_jobs: %d", cfg.IPP.MaxQueuedJobs)
+	}
+	config.MaxQueuedJobs = cfg.IPP.MaxQueuedJobs
+	if cfg.IPP.MaxConcurrentJobs < 0 {
+		return fmt.Errorf("invalid ipp.max_concurrent_jobs: %d", cfg.IPP.MaxConcurrentJobs)
+	}
+	config.MaxConcurrentJobs = cfg.IPP.MaxConcurrentJobs
+	if cfg.IPP.MaxClientJobs < 0 {
+		return fmt.Errorf("invalid ipp.max_concurrent_jobs_per_client: %d", cfg.IPP.MaxClientJobs)
+	}
+	config.MaxClientJobs = cfg.IPP.MaxClientJobs
+	if cfg.IPP.TLS.Port != 0 {
+		config.TLSPort = cfg.IPP.TLS.Port
+	}
+	if cfg.IPP.TLS.CertFile != "" {
+		config.TLSCertFile = cfg.IPP.TLS.CertFile
+	}
+	if cfg.IPP.TLS.KeyFile != "" {
+		config.TLSKeyFile = cfg.IPP.TLS.KeyFile
+	}
+	if cfg.IPP.TLS.MinVersion != "" {
+		v, err := ipp.ParseTLSVersion(cfg.IPP.TLS.MinVersion)
+		if err != nil {
+			return fmt.Errorf("invalid ipp.tls.min_version: %w", err)
+		}
+		config.TLSMinVersion = v
+	}
+	if len(cfg.IPP.TLS.CipherSuites) > 0 {
+		if config.TLSMinVersion == tls.VersionTLS13 {
+			return fmt.Errorf("ipp.tls.cipher_suites only apply to TLS 1.2, but min_version is 1.3")
+		}
+		suites, err := ipp.ParseCipherSuites(cfg.IPP.TLS.CipherSuites)
+		if err != nil {
+			return fmt.Errorf("invalid ipp.tls.cipher_suites: %w", err)
+		}
+		config.TLSCipherSuites = suites
+	}
+	if cfg.IPP.TLS.SessionTickets != nil {
+		config.TLSNoTickets = !*cfg.IPP.TLS.SessionTickets
+	}
 	if cfg.Monitor.PollInterval != "" {
 		if d, err := time.ParseDuration(cfg.Monitor.PollInterval); err == nil {
 			config.PollInterval = d
 		}
 	}
+	if cfg.StateDir != "" {
+		config.StateDir = cfg.StateDir
+	}
 	if cfg.Avahi.ServiceDir != "" {
 		config.ServiceDir = cfg.Avahi.ServiceDir
 	}
 	if cfg.Avahi.FilePrefix != "" {
 		config.FilePrefix = cfg.Avahi.FilePrefix
 	}
+	switch cfg.Avahi.LegacyFiles {
+	case "":
+	case avahi.LegacyKeep, avahi.LegacyReplace, avahi.LegacyAdopt:
+		config.LegacyFiles = cfg.Avahi.LegacyFiles
+	default:
+		return fmt.Errorf("avahi.legacy_files must be one of %s", strings.Join(avahi.LegacyModes, ", "))
+	}
+	for _, name := range cfg.MDNS.Interfaces {
+		if _, err := net.InterfaceByName(name); err != nil {
+			return fmt.Errorf("invalid mdns.interfaces: %s: %w", name, err)
+		}
+	}
+	config.MDNSInterfaces = cfg.MDNS.Interfaces
+	// Preferred interfaces may come and go, so they needn't exist yet
+	config.PreferInterfaces = cfg.MDNS.Prefer
+	if err := applyReflectConfig(config, cfg); err != nil {
+		return err
+	}
+	if err := applyQuirksConfig(config, cfg); err != nil {
+		return err
+	}
 	config.SharedOnly = cfg.Printers.SharedOnly
+	if cfg.Security.Group != "" && cfg.Security.User == "" {
+		return fmt.Errorf("security.group requires security.user")
+	}
+	config.RunAsUser = cfg.Security.User
+	config.RunAsGroup = cfg.Security.Group
+	networks, err := ipp.ParseNetworks(cfg.Security.AllowedNetworks)
+	if err != nil {
+		return fmt.Errorf("invalid security.allowed_networks: %w", err)
+	}
+	if len(networks) > 0 {
+		config.AllowedNetworks = networks
+	}
+	if cfg.Audit.File != "" && !cfg.Audit.Enabled {
+		return fmt.Errorf("audit.file requires audit.enabled")
+	}
+	config.AuditLog = cfg.Audit.Enabled
+	config.AuditFile = cfg.Audit.File
+	config.LogLevel = cfg.Log.Level
+	config.LogFormat = cfg.Log.Format
+	if cfg.Log.Output != "" {
+		switch cfg.Log.Output {
+		case "stdout", "syslog", "journald":
+			config.LogOutput = cfg.Log.Output
+		default:
+			return fmt.Errorf("invalid log.output: %q", cfg.Log.Output)
+		}
+	}
+	if cfg.Log.File != "" && config.LogOutput != "stdout" {
+		return fmt.Errorf("log.file can't be combined with log.output: %s", config.LogOutput)
+	}
+	config.LogFile = cfg.Log.File
+	if cfg.Log.MaxSizeMB != nil {
+		if *cfg.Log.MaxSizeMB < 0 {
+			return fmt.Errorf("invalid log.max_size_mb: %d", *cfg.Log.MaxSizeMB)
+		}
+		config.LogMaxSize = int64(*cfg.Log.MaxSizeMB) << 20
+	}
+	if cfg.Log.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.Log.MaxAge)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid log.max_age %q", cfg.Log.MaxAge)
+		}
+		config.LogMaxAge = d
+	}
+	if cfg.Log.MaxBackups != nil {
+		if *cfg.Log.MaxBackups < 0 {
+			return fmt.Errorf("invalid log.max_backups: %d", *cfg.Log.MaxBackups)
+		}
+		config.LogMaxBackups = *cfg.Log.MaxBackups
+	}
+	if cfg.Log.Syslog.Facility != "" {
+		if _, ok := syslogFacilities[cfg.Log.Syslog.Facility]; !ok {
+			return fmt.Errorf("invalid log.syslog.facility: %q", cfg.Log.Syslog.Facility)
+		}
+		config.SyslogFacility = cfg.Log.Syslog.Facility
+	}
+	if cfg.Log.Syslog.Tag != "" {
+		config.SyslogTag = cfg.Log.Syslog.Tag
+	}
+	if cfg.Log.Syslog.Address != "" {
+		if _, _, err := syslogAddress(cfg.Log.Syslog.Address); err != nil {
+			return fmt.Errorf("invalid log.syslog.address: %w", err)
+		}
+		config.SyslogAddress = cfg.Log.Syslog.Address
+	}
+	config.WatchConfig = cfg.WatchConfig
+	config.IncludeList = cfg.Printers.Include
 	config.ExcludeList = cfg.Printers.Exclude
 
+	queues := make([]string, 0, len(cfg.Printers.Rename))
+	for queue := range cfg.Printers.Rename {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	renamedTo := make(map[string]string, len(queues))
+	for _, queue := range queues {
+		name := strings.TrimSpace(cfg.Printers.Rename[queue])
+		if name == "" {
+			return fmt.Errorf("printers.rename: empty name for %q", queue)
+		}
+		// DNS-SD instance names are limited to 63 bytes
+		if len(name) > 63 {
+			return fmt.Errorf("printers.rename: name for %q is longer than 63 bytes", queue)
+		}
+		if other, ok := renamedTo[name]; ok {
+			return fmt.Errorf("printers.rename: %q and %q are both renamed to %q", other, queue, name)
+		}
+		renamedTo[name] = queue
+		if config.DisplayNames == nil {
+			config.DisplayNames = make(map[string]string)
+		}
+		config.DisplayNames[queue] = name
+	}
+
+	for _, f := range cfg.Failover {
+		if f.Primary == "" || f.Backup == "" {
+			continue
+		}
+		if config.Failover == nil {
+			config.Failover = make(map[string]string)
+		}
+		config.Failover[f.Primary] = f.Backup
+	}
+	config.WebhookURLs = cfg.Webhooks.URLs
+	config.APIListen = cfg.API.Listen
+	config.APIToken = cfg.API.Token
+	if cfg.Display.TimeZone != "" {
+		if _, err := time.LoadLocation(cfg.Display.TimeZone); err != nil {
+			return fmt.Errorf("display.timezone: %w", err)
+		}
+		config.TimeZone = cfg.Display.TimeZone
+	}
+	switch cfg.Display.Clock {
+	case "", "24h":
+	case "12h":
+		config.Hour12 = true
+	default:
+		return fmt.Errorf("display.clock must be 24h or 12h")
+	}
+	config.LabelDir = cfg.Labels.TemplateDir
+
+	for _, u := range cfg.Auth.Users {
+		if u.Name == "" || u.PasswordSHA256 == "" {
+			return fmt.Errorf("auth users need a name and password_sha256")
+		}
+		if config.AuthUsers == nil {
+			config.AuthUsers = make(map[string]string)
+		}
+		config.AuthUsers[u.Name] = u.PasswordSHA256
+	}
+	config.GuestTokens = cfg.Auth.GuestTokens.Enabled
+	if config.GuestTokens && config.APIListen == "" {
+		return fmt.Errorf("auth.guest_tokens needs api.listen, where tokens are minted")
+	}
+	if cfg.Auth.GuestTokens.MaxLifetime != "" {
+		d, err := time.ParseDuration(cfg.Auth.GuestTokens.MaxLifetime)
+		if err != nil {
+			return fmt.Errorf("invalid auth.guest_tokens.max_lifetime: %w", err)
+		}
+		config.GuestTokenMaxTTL = d
+	}
+	if err := applyAuthProviders(config, cfg); err != nil {
+		return err
+	}
+
+	for _, v := range cfg.VirtualPrinters {
+		mode := v.Mode
+		if mode == "" {
+			mode = daemon.VirtualModeBroadcast
+		}
+		config.VirtualPrinters = append(config.VirtualPrinters, daemon.VirtualPrinter{
+			Name:    v.Name,
+			Mode:    mode,
+			Members: v.Members,
+		})
+	}
+
+	for _, st := range cfg.Staged {
+		if st.Printer == "" || st.Name == "" {
+			return fmt.Errorf("staged printers need a printer and a name")
+		}
+		if st.Name == st.Printer {
+			return fmt.Errorf("staged printer %q has the same name as its stable printer", st.Name)
+		}
+		for _, other := range config.StagedPrinters {
+			if other.Name == st.Name {
+				return fmt.Errorf("staged printer %q is defined twice", st.Name)
+			}
+		}
+		if name := strings.TrimSpace(st.DisplayName); name != "" {
+			if len(name) > 63 {
+				return fmt.Errorf("staged: display_name for %q is longer than 63 bytes", st.Name)
+			}
+			if config.DisplayNames == nil {
+				config.DisplayNames = make(map[string]string)
+			}
+			config.DisplayNames[st.Name] = name
+		}
+		config.StagedPrinters = append(config.StagedPrinters, daemon.StagedPrinter{
+			Name:    st.Name,
+			Printer: st.Printer,
+		})
+	}
+
+	if err := applyMediaProfiles(config, cfg); err != nil {
+		return err
+	}
+
+	config.ArchiveDir = cfg.Archive.Dir
+	if cfg.Archive.MaxAge != "" {
+		d, err := time.ParseDuration(cfg.Archive.MaxAge)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid archive.max_age %q", cfg.Archive.MaxAge)
+		}
+		config.ArchiveMaxAge = d
+	}
+	if cfg.Archive.MaxMB < 0 {
+		return fmt.Errorf("invalid archive.max_mb: %d", cfg.Archive.MaxMB)
+	}
+	config.ArchiveQuota = int64(cfg.Archive.MaxMB) << 20
+	for _, q := range cfg.Archive.Quotas {
+		if q.Printer == "" {
+			return fmt.Errorf("archive.quotas entries need a printer")
+		}
+		if q.MaxMB < 0 {
+			return fmt.Errorf("invalid archive.quotas max_mb for %s: %d", q.Printer, q.MaxMB)
+		}
+		if config.ArchiveQuotas == nil {
+			config.ArchiveQuotas = make(map[string]int64)
+		}
+		config.ArchiveQuotas[q.Printer] = int64(q.MaxMB) << 20
+	}
+
+	if cfg.NullPrinter.Enabled {
+		config.NullPrinter = cfg.NullPrinter.Name
+		if config.NullPrinter == "" {
+			config.NullPrinter = "AirPrint_Null"
+		}
+	}
+
 	// Apply media overrides
 	for _, m := range cfg.Media {
 		config.MediaOverrides = append(config.MediaOverrides, media.ConfigOverride{
@@ -193,8 +877,674 @@ func applyFileConfig(config *daemon.Config, cfg *ConfigFile) {
 			ProfileName:  m.Profile,
 			MediaSizes:   m.Sizes,
 			DefaultMedia: m.DefaultSize,
+			NoAutoDetect: m.AutoDetect != nil && !*m.AutoDetect,
 		})
 	}
+
+	config.LocationOverride = cfg.Location.Override
+	for _, src := range cfg.Location.Sources {
+		switch src.Type {
+		case daemon.LocationSourceCSV:
+			if src.Path == "" {
+				return fmt.Errorf("csv location source needs a path")
+			}
+		case daemon.LocationSourceDNS:
+			if src.Name == "" {
+				return fmt.Errorf("dns location source needs a name")
+			}
+		case daemon.LocationSourceLLDP:
+		default:
+			return fmt.Errorf("unknown location source type %q", src.Type)
+		}
+		config.LocationSources = append(config.LocationSources, daemon.LocationSource{
+			Type: src.Type,
+			Path: src.Path,
+			Name: src.Name,
+		})
+	}
+
+	for _, g := range cfg.Location.Geo {
+		if g.Printer == "" {
+			return fmt.Errorf("location.geo entries need a printer")
+		}
+		uri, err := geoURI(g.Latitude, g.Longitude, g.Altitude)
+		if err != nil {
+			return fmt.Errorf("invalid location.geo for %s: %w", g.Printer, err)
+		}
+		if config.GeoLocations == nil {
+			config.GeoLocations = make(map[string]string)
+		}
+		config.GeoLocations[g.Printer] = uri
+	}
+
+	for _, icon := range cfg.Icons {
+		if icon.Printer == "" || icon.File == "" {
+			return fmt.Errorf("icons need a printer and file")
+		}
+		if err := checkIcon(icon.File); err != nil {
+			return fmt.Errorf("invalid icon for %s: %w", icon.Printer, err)
+		}
+		if config.PrinterIcons == nil {
+			config.PrinterIcons = make(map[string]string)
+		}
+		config.PrinterIcons[icon.Printer] = icon.File
+	}
+
+	for _, c := range cfg.URFConversion {
+		var format string
+		switch strings.ToLower(c.Format) {
+		case "pdf":
+			format = raster.FormatPDF
+		case "pwg":
+			format = raster.FormatPWG
+		default:
+			return fmt.Errorf("urf_conversion for %s: unknown format %q (use pdf or pwg)", c.Printer, c.Format)
+		}
+		if config.URFConversion == nil {
+			config.URFConversion = make(map[string]string)
+		}
+		config.URFConversion[c.Printer] = format
+	}
+
+	for _, fb := range cfg.FormatFallback {
+		var formats []string
+		for _, f := range fb.Formats {
+			switch strings.ToLower(f) {
+			case "urf":
+				formats = append(formats, raster.FormatURF)
+			case "pwg":
+				formats = append(formats, raster.FormatPWG)
+			case "pdf":
+				formats = append(formats, raster.FormatPDF)
+			default:
+				return fmt.Errorf("format_fallback for %s: unknown format %q (use urf, pwg or pdf)", fb.Printer, f)
+			}
+		}
+		if config.FormatFallback == nil {
+			config.FormatFallback = make(map[string][]string)
+		}
+		config.FormatFallback[fb.Printer] = formats
+	}
+
+	for _, df := range cfg.DocumentFormats {
+		for _, f := range df.Prefer {
+			if !airprint.IsDocumentFormat(f) {
+				return fmt.Errorf("document_formats for %s: unsupported format %q (use one of %s)",
+					df.Printer, f, strings.Join(airprint.DocumentFormats, ", "))
+			}
+		}
+		if config.DocumentFormats == nil {
+			config.DocumentFormats = make(map[string][]string)
+		}
+		config.DocumentFormats[df.Printer] = df.Prefer
+	}
+
+	for _, u := range cfg.URF {
+		if u.Printer == "" {
+			return fmt.Errorf("urf entries need a printer")
+		}
+		override := airprint.URFOverride{Add: u.Add, Remove: u.Remove}
+		if u.Replace != "" {
+			for _, token := range strings.Split(u.Replace, ",") {
+				override.Replace = append(override.Replace, strings.TrimSpace(token))
+			}
+		}
+		for _, tokens := range [][]string{override.Replace, override.Add, override.Remove} {
+			for _, token := range tokens {
+				if err := airprint.ValidateURFToken(token); err != nil {
+					return fmt.Errorf("urf for %s: %w", u.Printer, err)
+				}
+			}
+		}
+		if config.URFOverrides == nil {
+			config.URFOverrides = make(map[string]airprint.URFOverride)
+		}
+		config.URFOverrides[u.Printer] = override
+	}
+
+	for _, sc := range cfg.Scaling {
+		if sc.Printer == "" {
+			return fmt.Errorf("scaling entries need a printer")
+		}
+		if !validScaling(sc.Default) {
+			return fmt.Errorf("scaling for %s: default must be one of %s", sc.Printer, strings.Join(ipp.PrintScalingModes, ", "))
+		}
+		if config.PrintScaling == nil {
+			config.PrintScaling = make(map[string]ipp.Scaling)
+		}
+		config.PrintScaling[sc.Printer] = ipp.Scaling{Default: sc.Default, Force: sc.Force}
+	}
+
+	for _, q := range cfg.QueueLimits {
+		if q.Printer == "" {
+			return fmt.Errorf("queue_limits entries need a printer")
+		}
+		if q.MaxJobs < 0 {
+			return fmt.Errorf("queue_limits for %s: invalid max_jobs %d", q.Printer, q.MaxJobs)
+		}
+		if config.QueueLimits == nil {
+			config.QueueLimits = make(map[string]int)
+		}
+		config.QueueLimits[q.Printer] = q.MaxJobs
+	}
+
+	if err := applyReleaseConfig(config, cfg); err != nil {
+		return err
+	}
+
+	for _, wm := range cfg.Watermarks {
+		if wm.Printer == "" || wm.Text == "" {
+			return fmt.Errorf("watermarks need a printer and text")
+		}
+		if config.Watermarks == nil {
+			config.Watermarks = make(map[string]string)
+		}
+		config.Watermarks[wm.Printer] = wm.Text
+	}
+
+	for _, f := range cfg.Features {
+		if f.Printer == "" {
+			return fmt.Errorf("features need a printer")
+		}
+		for _, feature := range f.Enable {
+			if !validFeature(feature) {
+				return fmt.Errorf("features for %s: unknown feature %q (use %s)", f.Printer, feature, strings.Join(ipp.Features, ", "))
+			}
+		}
+		if config.PrinterFeatures == nil {
+			config.PrinterFeatures = make(map[string][]string)
+		}
+		config.PrinterFeatures[f.Printer] = append(config.PrinterFeatures[f.Printer], f.Enable...)
+	}
+
+	for _, id := range cfg.Identify {
+		if id.Printer == "" {
+			return fmt.Errorf("identify entries need a printer")
+		}
+		switch id.Method {
+		case identify.MethodZebra, identify.MethodIPP:
+		default:
+			return fmt.Errorf("identify method for %s must be %s or %s", id.Printer, identify.MethodZebra, identify.MethodIPP)
+		}
+		actions := append([]string{}, id.Actions...)
+		for action := range id.Commands {
+			actions = append(actions, action)
+		}
+		for _, action := range actions {
+			if !validIdentifyAction(action) {
+				return fmt.Errorf("identify for %s: unknown action %q (use %s)", id.Printer, action, strings.Join(identify.Actions, ", "))
+			}
+		}
+		if config.Identify == nil {
+			config.Identify = make(map[string]daemon.IdentifyConfig)
+		}
+		config.Identify[id.Printer] = daemon.IdentifyConfig{
+			Method:   id.Method,
+			Address:  id.Address,
+			URI:      id.URI,
+			Actions:  id.Actions,
+			Commands: id.Commands,
+		}
+	}
+
+	for _, r := range cfg.Raw {
+		if r.Printer == "" {
+			return fmt.Errorf("raw entries need a printer")
+		}
+		if config.HoldJobs[r.Printer] {
+			return fmt.Errorf("raw printer %s can't hold jobs for release, they never reach CUPS", r.Printer)
+		}
+		if config.RawPrinters == nil {
+			config.RawPrinters = make(map[string]string)
+		}
+		config.RawPrinters[r.Printer] = r.Address
+	}
+
+	for _, sp := range cfg.Standalone {
+		if sp.Name == "" || sp.URI == "" {
+			return fmt.Errorf("standalone printers need a name and a uri")
+		}
+		for _, other := range config.Standalone {
+			if other.Name == sp.Name {
+				return fmt.Errorf("standalone printer %q is defined twice", sp.Name)
+			}
+		}
+		if _, err := ipp.NewBackend(sp.URI); err != nil {
+			return fmt.Errorf("standalone printer %s: %w", sp.Name, err)
+		}
+		socket := strings.HasPrefix(sp.URI, "socket:")
+		switch sp.Language {
+		case "":
+			if socket {
+				sp.Language = daemon.LanguagePDF
+			}
+		case daemon.LanguagePDF, daemon.LanguagePWG:
+		case daemon.LanguageZPL:
+			if !socket {
+				return fmt.Errorf("standalone printer %s: zpl is only sent to socket:// printers", sp.Name)
+			}
+		default:
+			return fmt.Errorf("standalone printer %s: invalid language %q (use pdf, pwg or zpl)", sp.Name, sp.Language)
+		}
+		if config.HoldJobs[sp.Name] {
+			return fmt.Errorf("standalone printer %s can't hold jobs for release, they never reach CUPS", sp.Name)
+		}
+		for _, dpi := range sp.Resolutions {
+			if dpi <= 0 {
+				return fmt.Errorf("standalone printer %s: invalid resolution %d", sp.Name, dpi)
+			}
+		}
+		config.Standalone = append(config.Standalone, daemon.StandalonePrinter{
+			Name:         sp.Name,
+			URI:          sp.URI,
+			Language:     sp.Language,
+			MakeModel:    sp.MakeModel,
+			Location:     sp.Location,
+			Info:         sp.Info,
+			Color:        sp.Color,
+			Duplex:       sp.Duplex,
+			Resolutions:  sp.Resolutions,
+			Media:        sp.Media,
+			MediaDefault: sp.MediaDefault,
+		})
+	}
+
+	for _, rp := range cfg.Reexport {
+		if rp.Name == "" || rp.URI == "" {
+			return fmt.Errorf("re-exported printers need a name and a uri")
+		}
+		for _, other := range config.Standalone {
+			if other.Name == rp.Name {
+				return fmt.Errorf("printer %q is defined twice in standalone and reexport", rp.Name)
+			}
+		}
+		if !strings.HasPrefix(rp.URI, "ipp:") && !strings.HasPrefix(rp.URI, "ipps:") {
+			return fmt.Errorf("re-exported printer %s: uri must be ipp:// or ipps://", rp.Name)
+		}
+		if _, err := ipp.NewBackend(rp.URI); err != nil {
+			return fmt.Errorf("re-exported printer %s: %w", rp.Name, err)
+		}
+		if config.HoldJobs[rp.Name] {
+			return fmt.Errorf("re-exported printer %s can't hold jobs for release, they never reach CUPS", rp.Name)
+		}
+		config.Standalone = append(config.Standalone, daemon.StandalonePrinter{
+			Name:      rp.Name,
+			URI:       rp.URI,
+			MakeModel: rp.MakeModel,
+			Location:  rp.Location,
+			Info:      rp.Info,
+			Reexport:  true,
+		})
+	}
+
+	for _, sc := range cfg.Schedules {
+		allow, err := parseWindows(sc.Allow)
+		if err != nil {
+			return fmt.Errorf("schedule for %s: %w", sc.Printer, err)
+		}
+		deny, err := parseWindows(sc.Deny)
+		if err != nil {
+			return fmt.Errorf("schedule for %s: %w", sc.Printer, err)
+		}
+		if config.Schedules == nil {
+			config.Schedules = make(map[string]schedule.Schedule)
+		}
+		config.Schedules[sc.Printer] = schedule.Schedule{Allow: allow, Deny: deny}
+	}
+
+	return nil
+}
+
+// applyAuthProviders validates the auth providers and the listeners that
+// use them
+func applyAuthProviders(config *daemon.Config, cfg *ConfigFile) error {
+	known := make(map[string]bool)
+	if len(config.AuthUsers) > 0 {
+		known["users"] = true
+	}
+	for _, p := range cfg.Auth.Providers {
+		if p.Name == "" {
+			return fmt.Errorf("auth.providers entries need a name")
+		}
+		if p.Name == "users" || known[p.Name] {
+			return fmt.Errorf("auth provider name %q is already used", p.Name)
+		}
+		known[p.Name] = true
+
+		provider := auth.ProviderConfig{Name: p.Name, Type: p.Type, File: p.File, Service: p.Service}
+		switch p.Type {
+		case auth.TypeHtpasswd:
+			if p.File == "" {
+				return fmt.Errorf("auth provider %s: htpasswd needs a file", p.Name)
+			}
+		case auth.TypePAM:
+		case auth.TypeLDAP:
+			if p.URL == "" || (p.BaseDN == "" && p.UserDN == "") {
+				return fmt.Errorf("auth provider %s: ldap needs a url and a base_dn or user_dn", p.Name)
+			}
+			provider.LDAP = auth.LDAPConfig{
+				URL:          p.URL,
+				StartTLS:     p.StartTLS,
+				CAFile:       p.CAFile,
+				BindDN:       p.BindDN,
+				BindPassword: p.BindPassword,
+				BaseDN:       p.BaseDN,
+				UserFilter:   p.UserFilter,
+				UserDN:       p.UserDN,
+				GroupFilter:  p.GroupFilter,
+			}
+			if p.Timeout != "" {
+				d, err := time.ParseDuration(p.Timeout)
+				if err != nil {
+					return fmt.Errorf("auth provider %s: invalid timeout: %w", p.Name, err)
+				}
+				provider.LDAP.Timeout = d
+			}
+		default:
+			return fmt.Errorf("auth provider %s: unknown type %q (expected htpasswd, pam or ldap)", p.Name, p.Type)
+		}
+		config.AuthProviders = append(config.AuthProviders, provider)
+	}
+
+	for _, listener := range []struct {
+		key   string
+		names []string
+	}{{"auth.ipp.providers", cfg.Auth.IPP.Providers}, {"auth.api.providers", cfg.Auth.API.Providers}} {
+		for _, name := range listener.names {
+			if !known[name] {
+				return fmt.Errorf("%s: unknown provider %q", listener.key, name)
+			}
+		}
+	}
+	config.IPPAuth = cfg.Auth.IPP.Providers
+	config.APIAuth = cfg.Auth.API.Providers
+	if len(config.APIAuth) > 0 && config.APIListen == "" {
+		return fmt.Errorf("auth.api.providers needs api.listen")
+	}
+	for _, t := range cfg.Auth.API.Tokens {
+		if t.Name == "" || t.TokenSHA256 == "" {
+			return fmt.Errorf("auth.api.tokens entries need a name and token_sha256")
+		}
+		if _, ok := config.APITokens[t.Name]; ok {
+			return fmt.Errorf("auth.api.tokens: duplicate name %q", t.Name)
+		}
+		if config.APITokens == nil {
+			config.APITokens = make(map[string]string)
+		}
+		config.APITokens[t.Name] = t.TokenSHA256
+	}
+	if len(config.APITokens) > 0 {
+		if config.APIListen == "" {
+			return fmt.Errorf("auth.api.tokens needs api.listen")
+		}
+		if _, err := auth.NewAPITokens(config.APITokens); err != nil {
+			return fmt.Errorf("auth.api.tokens: %w", err)
+		}
+	}
+
+	if g := cfg.Auth.Groups; g.Provider != "" {
+		if !ldapProvider(config, g.Provider) {
+			return fmt.Errorf("auth.groups.provider: %q is not an ldap provider", g.Provider)
+		}
+		config.GroupProvider = g.Provider
+		if g.CacheTTL != "" {
+			d, err := time.ParseDuration(g.CacheTTL)
+			if err != nil {
+				return fmt.Errorf("invalid auth.groups.cache_ttl: %w", err)
+			}
+			config.GroupCacheTTL = d
+		}
+	}
+	for _, a := range cfg.Auth.Access {
+		if a.Printer == "" {
+			return fmt.Errorf("auth.access entries need a printer")
+		}
+		if len(a.Groups) > 0 && config.GroupProvider == "" {
+			return fmt.Errorf("auth.access for %s names groups, which needs auth.groups.provider", a.Printer)
+		}
+		if config.PrinterAccess == nil {
+			config.PrinterAccess = make(map[string]auth.AccessRule)
+		}
+		config.PrinterAccess[a.Printer] = auth.AccessRule{Users: a.Users, Groups: a.Groups, Guests: a.Guests}
+	}
+	if len(config.PrinterAccess) > 0 && len(config.AuthUsers) == 0 && len(config.IPPAuth) == 0 && !config.GuestTokens {
+		return fmt.Errorf("auth.access needs print authentication: auth.users or auth.ipp.providers")
+	}
+	return nil
+}
+
+// applyReleaseConfig validates the printers that hold jobs for release
+func applyReleaseConfig(config *daemon.Config, cfg *ConfigFile) error {
+	r := cfg.Release
+	if len(r.Printers) == 0 {
+		if len(r.PINs) > 0 {
+			return fmt.Errorf("release.pins needs release.printers")
+		}
+		return nil
+	}
+	if config.APIListen == "" {
+		return fmt.Errorf("release needs api.listen, where jobs are released")
+	}
+	if len(cfg.Auth.Users) == 0 && len(cfg.Auth.IPP.Providers) == 0 {
+		return fmt.Errorf("release needs print authentication (auth.users or auth.ipp.providers) to know whose jobs are whose")
+	}
+
+	config.HoldJobs = make(map[string]bool)
+	for _, p := range r.Printers {
+		config.HoldJobs[p] = true
+	}
+	if r.HoldTimeout != "" {
+		d, err := time.ParseDuration(r.HoldTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid release.hold_timeout: %w", err)
+		}
+		config.HoldTimeout = d
+	}
+	for _, p := range r.PINs {
+		if p.User == "" || p.PINSHA256 == "" {
+			return fmt.Errorf("release.pins entries need a user and pin_sha256")
+		}
+		if config.ReleasePINs == nil {
+			config.ReleasePINs = make(map[string]string)
+		}
+		config.ReleasePINs[p.User] = p.PINSHA256
+	}
+	return nil
+}
+
+// applyReflectConfig validates and applies the mDNS reflector settings
+func applyReflectConfig(config *daemon.Config, cfg *ConfigFile) error {
+	r := cfg.MDNS.Reflect
+	if len(r.From) == 0 && len(r.To) == 0 {
+		return nil
+	}
+	if len(r.From) == 0 || len(r.To) == 0 {
+		return fmt.Errorf("mdns.reflect needs both from and to interfaces")
+	}
+	for _, name := range append(append([]string{}, r.From...), r.To...) {
+		if _, err := net.InterfaceByName(name); err != nil {
+			return fmt.Errorf("invalid mdns.reflect interface: %s: %w", name, err)
+		}
+	}
+	for _, from := range r.From {
+		for _, to := range r.To {
+			if from == to {
+				return fmt.Errorf("mdns.reflect: %s is both a from and a to interface", from)
+			}
+		}
+	}
+	for _, pattern := range append(append([]string{}, r.Include...), r.Exclude...) {
+		if err := avahi.ValidatePattern(pattern); err != nil {
+			return fmt.Errorf("invalid mdns.reflect pattern %q: %w", pattern, err)
+		}
+	}
+	if r.Interval != "" {
+		d, err := time.ParseDuration(r.Interval)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("invalid mdns.reflect.interval %q, use e.g. \"30s\"", r.Interval)
+		}
+		config.ReflectInterval = d
+	}
+	config.ReflectFrom = r.From
+	config.ReflectTo = r.To
+	config.ReflectInclude = r.Include
+	config.ReflectExclude = r.Exclude
+	return nil
+}
+
+// applyQuirksConfig sets the client workarounds: the built-in ones not
+// disabled, then those configured
+func applyQuirksConfig(config *daemon.Config, cfg *ConfigFile) error {
+	q := cfg.IPP.Quirks
+	disabled := make(map[string]bool)
+	for _, name := range q.Disable {
+		if name != "all" && !validQuirk(name) {
+			return fmt.Errorf("unknown built-in quirk %q in ipp.quirks.disable", name)
+		}
+		disabled[name] = true
+	}
+	config.Quirks = nil
+	for _, quirk := range ipp.BuiltinQuirks {
+		if !disabled["all"] && !disabled[quirk.Name] {
+			config.Quirks = append(config.Quirks, quirk)
+		}
+	}
+
+	for i, r := range q.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		if r.UserAgent == "" {
+			return fmt.Errorf("ipp.quirks %s needs a user_agent", name)
+		}
+		re, err := regexp.Compile(r.UserAgent)
+		if err != nil {
+			return fmt.Errorf("invalid user_agent for ipp.quirks %s: %w", name, err)
+		}
+		quirk := ipp.Quirk{Name: name, UserAgent: re, Omit: r.Omit, Chunked: r.Chunked, Close: r.Close}
+		switch r.IPPVersion {
+		case "":
+		case "1.1":
+			quirk.Version = 0x0101
+		case "2.0":
+			quirk.Version = 0x0200
+		default:
+			return fmt.Errorf("invalid ipp_version %q for ipp.quirks %s, use 1.1 or 2.0", r.IPPVersion, name)
+		}
+		config.Quirks = append(config.Quirks, quirk)
+	}
+	return nil
+}
+
+// validQuirk reports whether name is a built-in quirk
+func validQuirk(name string) bool {
+	for _, q := range ipp.BuiltinQuirks {
+		if q.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// geoURI returns the RFC 5870 geo: URI for a position
+func geoURI(latitude, longitude float64, altitude *float64) (string, error) {
+	if latitude < -90 || latitude > 90 {
+		return "", fmt.Errorf("latitude %v out of range", latitude)
+	}
+	if longitude < -180 || longitude > 180 {
+		return "", fmt.Errorf("longitude %v out of range", longitude)
+	}
+	uri := "geo:" + strconv.FormatFloat(latitude, 'f', -1, 64) + "," + strconv.FormatFloat(longitude, 'f', -1, 64)
+	if altitude != nil {
+		uri += "," + strconv.FormatFloat(*altitude, 'f', -1, 64)
+	}
+	return uri, nil
+}
+
+// checkIcon makes sure an icon file is a PNG clients can show
+func checkIcon(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := png.DecodeConfig(f); err != nil {
+		return fmt.Errorf("%s is not a PNG: %w", path, err)
+	}
+	return nil
+}
+
+// validFeature reports whether feature is an experimental behavior printers
+// can enable
+func validFeature(feature string) bool {
+	for _, f := range ipp.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMediaProfiles loads the profiles from profiles_dir, then the
+// media_profiles section, so profiles in the config file win
+func applyMediaProfiles(config *daemon.Config, cfg *ConfigFile) error {
+	if cfg.ProfilesDir != "" {
+		profiles, err := media.LoadProfileDir(cfg.ProfilesDir)
+		if err != nil {
+			return fmt.Errorf("profiles_dir: %w", err)
+		}
+		config.MediaProfiles = append(config.MediaProfiles, profiles...)
+	}
+	for _, c := range cfg.MediaProfiles {
+		p, err := c.Profile()
+		if err != nil {
+			return err
+		}
+		config.MediaProfiles = append(config.MediaProfiles, p)
+	}
+	return nil
+}
+
+// validScaling reports whether mode is a print-scaling value
+func validScaling(mode string) bool {
+	for _, m := range ipp.PrintScalingModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func validIdentifyAction(action string) bool {
+	for _, a := range identify.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ldapProvider reports whether name is a configured ldap provider
+func ldapProvider(config *daemon.Config, name string) bool {
+	for _, p := range config.AuthProviders {
+		if p.Name == name {
+			return p.Type == auth.TypeLDAP
+		}
+	}
+	return false
+}
+
+func parseWindows(windows []ScheduleWindow) ([]schedule.Window, error) {
+	parsed := make([]schedule.Window, 0, len(windows))
+	for _, w := range windows {
+		pw, err := schedule.ParseWindow(w.Days, w.Start, w.End)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, pw)
+	}
+	return parsed, nil
 }
 
 func parseLogLevel(level string) zerolog.Level {
@@ -212,19 +1562,75 @@ func parseLogLevel(level string) zerolog.Level {
 	}
 }
 
-func listAvailablePrinters(host string, port int) {
-	client := cups.NewClient(host, port)
+// apiBaseURL returns the URL the running daemon's API is reached at
+func apiBaseURL(apiListen string) (string, error) {
+	if apiListen == "" {
+		return "", fmt.Errorf("api.listen must be set in the config file to control a running daemon")
+	}
+
+	host, port, err := net.SplitHostPort(apiListen)
+	if err != nil {
+		return "", fmt.Errorf("invalid api.listen address: %w", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port), nil
+}
+
+// newAPIClient returns a client for the running daemon's API that sends
+// api.token, or --token, as its bearer token
+func newAPIClient(config daemon.Config, timeout time.Duration) (*api.Client, error) {
+	base, err := apiBaseURL(config.APIListen)
+	if err != nil {
+		return nil, err
+	}
+	return api.NewClient(base, config.APIToken, timeout), nil
+}
+
+// setMaintenance toggles maintenance mode through the running daemon's API
+func setMaintenance(config daemon.Config, printer, message, resume string) error {
+	client, err := newAPIClient(config, 0)
+	if err != nil {
+		return err
+	}
+
+	var resp *http.Response
+	if resume != "" {
+		resp, err = client.Do(http.MethodDelete, "/api/v1/printers/"+url.PathEscape(resume)+"/maintenance", nil)
+	} else {
+		body, _ := json.Marshal(map[string]string{"message": message})
+		resp, err = client.Do(http.MethodPut, "/api/v1/printers/"+url.PathEscape(printer)+"/maintenance", bytes.NewReader(body))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reach daemon API: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := apiError(resp, http.StatusNoContent); err != nil {
+		return err
+	}
+
+	if resume != "" {
+		fmt.Printf("%s returned to service\n", resume)
+	} else {
+		fmt.Printf("%s is now in maintenance mode\n", printer)
+	}
+	return nil
+}
+
+func listAvailablePrinters(config daemon.Config) error {
+	client := cups.NewClient(config.CUPSHost, config.CUPSPort)
 	printers, err := client.GetPrinters()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to get printers from CUPS: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to get printers from CUPS: %w", err)
 	}
 
 	if len(printers) == 0 {
 		fmt.Println("No printers found in CUPS")
-		return
+		return nil
 	}
 
+	stats, live := liveStats(config)
 	fmt.Println("Available printers:")
 	fmt.Println()
 	for _, p := range printers {
@@ -242,6 +1648,9 @@ func listAvailablePrinters(host string, port int) {
 		if len(p.MediaSupported) > 0 {
 			fmt.Printf("    Media: %d sizes available\n", len(p.MediaSupported))
 		}
+		if live {
+			printStats(stats.Printers, p.Name)
+		}
 		fmt.Println()
 	}
 
@@ -250,12 +1659,61 @@ func listAvailablePrinters(host string, port int) {
 	fmt.Println("  media:")
 	fmt.Printf("    - printer: %s\n", printers[0].Name)
 	fmt.Println("      profile: zebra-4x6")
+	return nil
 }
 
-func listAvailableProfiles() {
+// liveStats fetches printer stats from the running daemon. Listings fall
+// back to what CUPS and the config say when it can't be reached, so only a
+// note is printed.
+func liveStats(config daemon.Config) (api.Stats, bool) {
+	var stats api.Stats
+	if config.APIListen == "" {
+		return stats, false
+	}
+	client, err := newAPIClient(config, 3*time.Second)
+	if err != nil {
+		return stats, false
+	}
+	resp, err := client.Get("/api/v1/stats")
+	if err == nil {
+		defer resp.Body.Close()
+		err = apiError(resp, http.StatusOK)
+	}
+	if err == nil {
+		err = json.NewDecoder(resp.Body).Decode(&stats)
+	}
+	if err != nil {
+		fmt.Printf("(No live stats, daemon not reachable: %v)\n\n", err)
+		return stats, false
+	}
+	return stats, true
+}
+
+// printStats prints a printer's live stats under its listing
+func printStats(printers map[string]api.PrinterStats, name string) {
+	st, ok := printers[name]
+	if !ok {
+		fmt.Println("    Not served by the running daemon")
+		return
+	}
+	last := "none yet"
+	if st.LastJob != nil {
+		last = st.LastJob.Format("2006-01-02 15:04")
+	}
+	fmt.Printf("    Jobs today: %d, last job: %s\n", st.JobsToday, last)
+	if st.LastError != "" {
+		fmt.Printf("    Last error: %s (%s)\n", st.LastError, st.LastErrorAt.Format("2006-01-02 15:04"))
+	}
+}
+
+func listAvailableProfiles(config daemon.Config) {
 	registry := media.NewRegistry()
+	for _, p := range config.MediaProfiles {
+		registry.AddProfile(p)
+	}
 	profiles := registry.ListProfiles()
 
+	stats, live := liveStats(config)
 	fmt.Println("Available media profiles:")
 	fmt.Println()
 	for _, name := range profiles {
@@ -274,6 +1732,19 @@ func listAvailableProfiles() {
 			}
 		}
 		fmt.Printf("    Default: %s\n", p.DefaultMedia)
+		if live {
+			var users []string
+			for printer, st := range stats.Printers {
+				if st.MediaProfile == name {
+					users = append(users, fmt.Sprintf("%s (%d jobs today)", printer, st.JobsToday))
+				}
+			}
+			sort.Strings(users)
+			if len(users) == 0 {
+				users = []string{"no printers"}
+			}
+			fmt.Printf("    In use by: %s\n", strings.Join(users, ", "))
+		}
 		fmt.Println()
 	}
 
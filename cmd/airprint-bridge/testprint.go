@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	goipp "github.com/phin1x/go-ipp"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/airprint"
+	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// Test page defaults for printers that don't report their media or
+// resolution
+const (
+	testPageWidth  = 8.5 // Inches
+	testPageHeight = 11.0
+	testPageDPI    = 300
+)
+
+// testPrinter talks IPP to one printer on the running bridge, as an AirPrint
+// client would
+type testPrinter struct {
+	client *goipp.HttpAdapter
+	uri    string // printer-uri sent in requests
+	url    string // Where requests go
+	user   string
+}
+
+// runTestPrint prints a test page through the running bridge, so the whole
+// path from IPP request to CUPS job can be checked without an iPhone
+func runTestPrint(args []string) error {
+	fs := flag.NewFlagSet("test-print", flag.ExitOnError)
+	flags := newConfigFlags(fs)
+	printer := fs.String("printer", "", "printer to print on, as the bridge serves it")
+	format := fs.String("format", "urf", "document format: urf (Apple Raster, as iOS sends) or pdf")
+	user := fs.String("user", "", "user name, or name:password if the bridge requires authentication")
+	timeout := fs.Duration("timeout", 2*time.Minute, "longest to wait for the job to finish")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	if *printer == "" {
+		return fmt.Errorf("usage: airprint-bridge test-print --printer NAME [--format urf|pdf]")
+	}
+	var documentFormat string
+	switch *format {
+	case "urf":
+		documentFormat = raster.FormatURF
+	case "pdf":
+		documentFormat = raster.FormatPDF
+	default:
+		return fmt.Errorf("invalid format %q: expected urf or pdf", *format)
+	}
+	config, err := flags.load()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	name, password, _ := strings.Cut(*user, ":")
+	if name == "" {
+		name = "airprint-bridge"
+	}
+	resource := "/" + airprint.ResourcePath(url.PathEscape(*printer))
+	port := strconv.Itoa(config.IPPPort)
+	p := &testPrinter{
+		client: goipp.NewHttpAdapter("127.0.0.1", config.IPPPort, name, password, false),
+		uri:    "ipp://localhost:" + port + resource,
+		url:    "http://127.0.0.1:" + port + resource,
+		user:   name,
+	}
+
+	attrs, err := p.attributes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get %s's attributes from the bridge on port %s: %w", *printer, port, err)
+	}
+	if formats := attributeStrings(attrs, "document-format-supported"); !containsString(formats, documentFormat) {
+		return fmt.Errorf("%s doesn't accept %s, only %s", *printer, documentFormat, strings.Join(formats, ", "))
+	}
+	if state := attributeInt(attrs, "printer-state"); state == 5 {
+		fmt.Printf("Warning: %s is stopped (%s); the job will wait\n", *printer, strings.Join(attributeStrings(attrs, "printer-state-reasons"), ", "))
+	}
+
+	page, size := testPageFor(attrs, *printer)
+	var doc bytes.Buffer
+	if err := raster.WriteTestPage(&doc, documentFormat, page); err != nil {
+		return fmt.Errorf("failed to render test page: %w", err)
+	}
+	fmt.Printf("Printing a test page on %s: %s at %d dpi, %s, %d bytes\n", *printer, size, page.DPI, documentFormat, doc.Len())
+
+	start := time.Now()
+	id, err := p.print(ctx, documentFormat, doc.Bytes())
+	if err != nil {
+		return fmt.Errorf("Print-Job failed: %w", err)
+	}
+	cupsJob := "unknown"
+	if config.APIListen == "" {
+		cupsJob += " (set api.listen to see it)"
+	} else if cupsID, err := lookupCUPSJobID(config, *printer, id); err != nil {
+		cupsJob += " (" + err.Error() + ")"
+	} else {
+		cupsJob = strconv.Itoa(cupsID)
+	}
+	fmt.Printf("Bridge job %d, CUPS job %s\n", id, cupsJob)
+
+	state, reasons, err := p.follow(ctx, id)
+	if err != nil {
+		return fmt.Errorf("job %d: %w", id, err)
+	}
+	if state != jobs.StateCompleted {
+		return fmt.Errorf("job %d %s (%s)", id, jobs.StateName(state), strings.Join(reasons, ", "))
+	}
+	fmt.Printf("Test page printed in %s\n", time.Since(start).Round(100*time.Millisecond))
+	return nil
+}
+
+// testPageFor lays a test page out on the printer's default media at its
+// default resolution, describing the size for the report
+func testPageFor(attrs goipp.Attributes, printer string) (raster.TestPage, string) {
+	dpi := testPageDPI
+	if values := attrs["printer-resolution-default"]; len(values) > 0 {
+		if res, ok := values[0].Value.(goipp.Resolution); ok && res.Width > 0 {
+			dpi = int(res.Width)
+		}
+	}
+
+	width, height := testPageWidth, testPageHeight
+	size := "letter"
+	if media := attributeStrings(attrs, "media-default"); len(media) > 0 {
+		if w, h, ok := mediaSize(media[0]); ok {
+			width, height, size = w, h, media[0]
+		}
+	}
+
+	return raster.TestPage{
+		Width:  int(width*float64(dpi) + 0.5),
+		Height: int(height*float64(dpi) + 0.5),
+		DPI:    dpi,
+		Lines: []string{
+			"airprint-bridge test page",
+			"Printer: " + printer,
+			"Media: " + size,
+			fmt.Sprintf("Resolution: %d dpi", dpi),
+			"Printed: " + time.Now().Format("2006-01-02 15:04:05"),
+			"Version: " + version,
+		},
+	}, size
+}
+
+// mediaSize returns the size in inches of a PWG self-describing media name,
+// e.g. 4x6 for na_index-4x6_4x6in
+func mediaSize(name string) (width, height float64, ok bool) {
+	dims := name[strings.LastIndex(name, "_")+1:]
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(dims, "in"):
+		dims = strings.TrimSuffix(dims, "in")
+	case strings.HasSuffix(dims, "mm"):
+		dims, scale = strings.TrimSuffix(dims, "mm"), 1/25.4
+	default:
+		return 0, 0, false
+	}
+	w, h, found := strings.Cut(dims, "x")
+	if !found {
+		return 0, 0, false
+	}
+	width, err1 := strconv.ParseFloat(w, 64)
+	height, err2 := strconv.ParseFloat(h, 64)
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width * scale, height * scale, true
+}
+
+// attributes gets the printer attributes a test page is laid out from
+func (p *testPrinter) attributes(ctx context.Context) (goipp.Attributes, error) {
+	req := goipp.NewRequest(goipp.OperationGetPrinterAttributes, 1)
+	req.OperationAttributes["printer-uri"] = p.uri
+	req.OperationAttributes["requesting-user-name"] = p.user
+	req.OperationAttributes["requested-attributes"] = []string{
+		"printer-state", "printer-state-reasons", "document-format-supported",
+		"media-default", "printer-resolution-default",
+	}
+	resp, err := p.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.PrinterAttributes) == 0 {
+		return nil, errors.New("no printer attributes returned")
+	}
+	return resp.PrinterAttributes[0], nil
+}
+
+// print submits the test page and returns the bridge's job ID
+func (p *testPrinter) print(ctx context.Context, format string, doc []byte) (int, error) {
+	req := goipp.NewRequest(goipp.OperationPrintJob, 2)
+	req.OperationAttributes["printer-uri"] = p.uri
+	req.OperationAttributes["requesting-user-name"] = p.user
+	req.OperationAttributes["job-name"] = "airprint-bridge test page"
+	req.OperationAttributes["document-format"] = format
+	req.File = bytes.NewReader(doc)
+	req.FileSize = len(doc)
+	resp, err := p.send(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.JobAttributes) == 0 {
+		return 0, errors.New("no job-id returned")
+	}
+	id := attributeInt(resp.JobAttributes[0], "job-id")
+	if id == 0 {
+		return 0, errors.New("no job-id returned")
+	}
+	return id, nil
+}
+
+// follow polls the job, printing each state it enters, until it ends, and
+// returns its final state and reasons
+func (p *testPrinter) follow(ctx context.Context, id int) (int, []string, error) {
+	last := ""
+	for {
+		req := goipp.NewRequest(goipp.OperationGetJobAttributes, 3)
+		req.OperationAttributes["printer-uri"] = p.uri
+		req.OperationAttributes["job-id"] = id
+		req.OperationAttributes["requesting-user-name"] = p.user
+		resp, err := p.send(ctx, req)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(resp.JobAttributes) == 0 {
+			return 0, nil, errors.New("no job attributes returned")
+		}
+		attrs := resp.JobAttributes[0]
+		state := attributeInt(attrs, "job-state")
+		reasons := attributeStrings(attrs, "job-state-reasons")
+
+		status := jobs.StateName(state)
+		if len(reasons) > 0 && reasons[0] != "none" {
+			status += " (" + strings.Join(reasons, ", ") + ")"
+		}
+		if status != last {
+			fmt.Printf("  %s  %s\n", time.Now().Format("15:04:05"), status)
+			last = status
+		}
+		if state >= jobs.StateCanceled {
+			return state, reasons, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, nil, fmt.Errorf("still %s after the timeout", jobs.StateName(state))
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// send sends a request to the bridge and checks the response's status,
+// explaining the errors a misconfigured test is likely to hit
+func (p *testPrinter) send(ctx context.Context, req *goipp.Request) (*goipp.Response, error) {
+	resp, err := p.client.SendRequestContext(ctx, p.url, req, nil)
+	var ippErr goipp.IPPError
+	var httpErr goipp.HTTPError
+	switch {
+	case errors.As(err, &ippErr) && ippErr.Status == goipp.StatusErrorNotFound:
+		return nil, errors.New("the bridge doesn't serve this printer; see list-printers and the include and exclude settings")
+	case errors.As(err, &ippErr) && ippErr.Status == goipp.StatusErrorNotAuthenticated,
+		errors.As(err, &httpErr) && httpErr.Code == http.StatusUnauthorized:
+		return nil, errors.New("the bridge rejected the request as unauthenticated; pass --user name:password")
+	case err != nil:
+		return nil, err
+	}
+	if err := resp.CheckForErrors(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// lookupCUPSJobID asks the running daemon's API which CUPS job a bridge job
+// became
+func lookupCUPSJobID(config daemon.Config, printer string, id int) (int, error) {
+	client, err := newAPIClient(config, 10*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	query := url.Values{"printer": {printer}, "which": {"all"}}
+	resp, err := client.Get("/api/v1/jobs?" + query.Encode())
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach daemon API: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := apiError(resp, http.StatusOK); err != nil {
+		return 0, err
+	}
+
+	var list struct {
+		Jobs []struct {
+			ID        int `json:"id"`
+			CUPSJobID int `json:"cups_job_id"`
+		} `json:"jobs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return 0, fmt.Errorf("invalid response from daemon: %w", err)
+	}
+	for _, j := range list.Jobs {
+		if j.ID == id {
+			return j.CUPSJobID, nil
+		}
+	}
+	return 0, fmt.Errorf("job %d not found in the daemon's job list", id)
+}
+
+// attributeStrings returns the string values of an attribute
+func attributeStrings(attrs goipp.Attributes, name string) []string {
+	var values []string
+	for _, a := range attrs[name] {
+		if s, ok := a.Value.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// attributeInt returns the first integer or enum value of an attribute, or 0
+func attributeInt(attrs goipp.Attributes, name string) int {
+	if values := attrs[name]; len(values) > 0 {
+		if v, ok := values[0].Value.(int); ok {
+			return v
+		}
+	}
+	return 0
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
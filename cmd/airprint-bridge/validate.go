@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
+	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+	"github.com/WaffleThief123/airprint-bridge/internal/media"
+)
+
+// configProblem is one thing wrong with a config file
+type configProblem struct {
+	Line    int    // 0 when the problem isn't tied to a line
+	Column  int    // 0 when unknown
+	Field   string // e.g. "ipp.submit_timeout" or "media[2].profile"
+	Message string
+}
+
+// format writes the problem as "file:line:column: field: message", leaving
+// out what it doesn't have
+func (p configProblem) format(file string) string {
+	var b strings.Builder
+	b.WriteString(file + ":")
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "%d:", p.Line)
+		if p.Column > 0 {
+			fmt.Fprintf(&b, "%d:", p.Column)
+		}
+	}
+	if p.Field != "" {
+		b.WriteString(" " + p.Field + ":")
+	}
+	b.WriteString(" " + p.Message)
+	return b.String()
+}
+
+func (p configProblem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "line %d", p.Line)
+		if p.Column > 0 {
+			fmt.Fprintf(&b, ", column %d", p.Column)
+		}
+		b.WriteString(": ")
+	}
+	if p.Field != "" {
+		b.WriteString(p.Field + ": ")
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// configCheck collects the problems found in a config file
+type configCheck struct {
+	root     *yaml.Node
+	values   map[int]valuePos // Line -> the scalar value on it
+	problems []configProblem
+}
+
+// valuePos is where a scalar value is in the file, and its field
+type valuePos struct {
+	field  string
+	column int
+}
+
+// add records a problem with a field, finding its line in the file
+func (c *configCheck) add(field, format string, args ...interface{}) {
+	c.problems = append(c.problems, configProblem{
+		Line:    nodeLine(c.root, field),
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// runValidateConfig checks the config file at path, writes any problems to
+// w and reports whether it's valid
+func runValidateConfig(w io.Writer, path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	problems := validateConfig(data)
+	for _, p := range problems {
+		fmt.Fprintln(w, p.format(path))
+	}
+	if len(problems) > 0 {
+		return false, nil
+	}
+	fmt.Fprintf(w, "%s: OK\n", path)
+	return true, nil
+}
+
+// validateConfig checks a config file for unknown keys, values of the wrong
+// type, bad durations and ports, unknown media profiles and conflicting
+// printer filters. Problems are sorted by line.
+func validateConfig(data []byte) []configProblem {
+	c, cfg, err := checkKeys(data)
+	if err != nil {
+		return []configProblem{yamlProblem(err.Error())}
+	}
+
+	c.durations(cfg)
+	c.ports(cfg)
+	c.profiles(cfg)
+	c.filters(cfg)
+
+	// Anything else applyFileConfig rejects, once the rest is fixed
+	if len(c.problems) == 0 {
+		config := daemon.DefaultConfig()
+		if err := applyFileConfig(&config, cfg); err != nil {
+			c.problems = append(c.problems, configProblem{Message: err.Error()})
+		}
+	}
+
+	sort.SliceStable(c.problems, func(i, j int) bool { return c.problems[i].Line < c.problems[j].Line })
+	return c.problems
+}
+
+// checkKeys parses a config file, recording unknown keys and values of the
+// wrong type as problems. It fails only if the file isn't valid YAML.
+func checkKeys(data []byte) (*configCheck, *ConfigFile, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, err
+	}
+	c := &configCheck{root: &root, values: make(map[int]valuePos)}
+	if len(root.Content) > 0 {
+		c.unknownKeys(root.Content[0], reflect.TypeOf(ConfigFile{}), "")
+	}
+
+	var cfg ConfigFile
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, nil, err
+		}
+		for _, msg := range typeErr.Errors {
+			p := yamlProblem(msg)
+			if pos, ok := c.values[p.Line]; ok {
+				p.Field, p.Column = pos.field, pos.column
+			}
+			c.problems = append(c.problems, p)
+		}
+	}
+	return c, &cfg, nil
+}
+
+// decodeStrict decodes a config file rejecting unknown keys, as the strict
+// setting asks, and describes each unknown or mistyped key with its position
+func decodeStrict(data []byte) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	err := dec.Decode(&ConfigFile{})
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	c, _, checkErr := checkKeys(data)
+	if checkErr != nil || len(c.problems) == 0 {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+	sort.SliceStable(c.problems, func(i, j int) bool { return c.problems[i].Line < c.problems[j].Line })
+	lines := make([]string, len(c.problems))
+	for i, p := range c.problems {
+		lines[i] = p.String()
+	}
+	return fmt.Errorf("unknown or mistyped keys (strict is on):\n  %s", strings.Join(lines, "\n  "))
+}
+
+// yamlLine matches the "line N: " prefix of yaml errors
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlProblem converts a yaml error message, keeping its line number
+func yamlProblem(msg string) configProblem {
+	if m := yamlLine.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return configProblem{Line: line, Message: m[2]}
+	}
+	return configProblem{Message: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// unknownKeys reports mapping keys with no matching field in t, which the
+// normal loader silently ignores
+func (c *configCheck) unknownKeys(node *yaml.Node, t reflect.Type, path string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if _, seen := c.values[node.Line]; node.Kind == yaml.ScalarNode && !seen {
+		c.values[node.Line] = valuePos{field: path, column: node.Column}
+	}
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := yamlField(t, key.Value)
+			if !ok {
+				c.problems = append(c.problems, configProblem{
+					Line:    key.Line,
+					Column:  key.Column,
+					Field:   joinField(path, key.Value),
+					Message: "unknown key",
+				})
+				continue
+			}
+			c.unknownKeys(value, field.Type, joinField(path, key.Value))
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			c.unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			c.unknownKeys(node.Content[i+1], t.Elem(), joinField(path, node.Content[i].Value))
+		}
+	}
+}
+
+// yamlField returns the field of struct type t stored under key
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if name == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func joinField(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+var (
+	// fieldPart matches one step of a field path: a key, optionally indexed
+	fieldPart  = regexp.MustCompile(`^([^\[]+)((?:\[\d+\])*)$`)
+	fieldIndex = regexp.MustCompile(`\d+`)
+)
+
+// nodeLine returns the line of a field such as "auth.providers[1].timeout" in
+// the document, or 0 if it isn't there
+func nodeLine(root *yaml.Node, field string) int {
+	if root == nil || len(root.Content) == 0 {
+		return 0
+	}
+	node := root.Content[0]
+	line := 0
+	for _, part := range strings.Split(field, ".") {
+		m := fieldPart.FindStringSubmatch(part)
+		if m == nil || node.Kind != yaml.MappingNode {
+			return line
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == m[1] {
+				line, node, found = node.Content[i].Line, node.Content[i+1], true
+				break
+			}
+		}
+		if !found {
+			return line
+		}
+		for _, index := range fieldIndex.FindAllString(m[2], -1) {
+			i, _ := strconv.Atoi(index)
+			if node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+		}
+	}
+	return line
+}
+
+// durations checks every duration setting parses
+func (c *configCheck) durations(cfg *ConfigFile) {
+	durations := map[string]string{
+		"ipp.submit_timeout":             cfg.IPP.SubmitTimeout,
+		"ipp.stall_timeout":              cfg.IPP.StallTimeout,
+		"ipp.status_ttl":                 cfg.IPP.StatusTTL,
+		"ipp.read_timeout":               cfg.IPP.ReadTimeout,
+		"ipp.write_timeout":              cfg.IPP.WriteTimeout,
+		"monitor.poll_interval":          cfg.Monitor.PollInterval,
+		"archive.max_age":                cfg.Archive.MaxAge,
+		"auth.guest_tokens.max_lifetime": cfg.Auth.GuestTokens.MaxLifetime,
+		"auth.groups.cache_ttl":          cfg.Auth.Groups.CacheTTL,
+		"release.hold_timeout":           cfg.Release.HoldTimeout,
+		"mdns.reflect.interval":          cfg.MDNS.Reflect.Interval,
+		"log.max_age":                    cfg.Log.MaxAge,
+	}
+	for i, p := range cfg.Auth.Providers {
+		durations[fmt.Sprintf("auth.providers[%d].timeout", i)] = p.Timeout
+	}
+	for field, value := range durations {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil {
+			c.add(field, "invalid duration %q, use e.g. \"30s\" or \"24h\"", value)
+		} else if d < 0 {
+			c.add(field, "duration %q is negative", value)
+		}
+	}
+}
+
+// ports checks port numbers are in range and the listeners don't collide
+func (c *configCheck) ports(cfg *ConfigFile) {
+	validPort := func(field string, port int) {
+		if port < 0 || port > 65535 {
+			c.add(field, "port %d out of range 1-65535", port)
+		}
+	}
+	validPort("cups.port", cfg.CUPS.Port)
+	validPort("ipp.port", cfg.IPP.Port)
+	validPort("ipp.tls.port", cfg.IPP.TLS.Port)
+
+	defaults := daemon.DefaultConfig()
+	ippPort, tlsPort := defaults.IPPPort, defaults.TLSPort
+	if cfg.IPP.Port != 0 {
+		ippPort = cfg.IPP.Port
+	}
+	if cfg.IPP.TLS.Port != 0 {
+		tlsPort = cfg.IPP.TLS.Port
+	}
+	if cfg.IPP.TLS.CertFile != "" && tlsPort == ippPort {
+		c.add("ipp.tls.port", "same port as ipp.port (%d)", ippPort)
+	}
+	for _, pp := range cfg.PrinterPorts {
+		if pp.Port == ippPort || (cfg.IPP.TLS.CertFile != "" && pp.Port == tlsPort) {
+			c.add("printer_ports", "port %d of %s is already used by the IPP listener", pp.Port, pp.Printer)
+		}
+	}
+
+	if cfg.API.Listen != "" {
+		_, portStr, err := net.SplitHostPort(cfg.API.Listen)
+		port, convErr := strconv.Atoi(portStr)
+		switch {
+		case err != nil || convErr != nil:
+			c.add("api.listen", "invalid listen address %q, use e.g. \":8080\" or \"127.0.0.1:8080\"", cfg.API.Listen)
+		case port < 1 || port > 65535:
+			c.add("api.listen", "port %d out of range 1-65535", port)
+		case port == ippPort || (cfg.IPP.TLS.CertFile != "" && port == tlsPort):
+			c.add("api.listen", "port %d is already used by the IPP listener", port)
+		}
+	}
+}
+
+// profiles checks the defined media profiles are valid and media overrides
+// name profiles that exist
+func (c *configCheck) profiles(cfg *ConfigFile) {
+	registry := media.NewRegistry()
+	if cfg.ProfilesDir != "" {
+		profiles, err := media.LoadProfileDir(cfg.ProfilesDir)
+		if err != nil {
+			c.add("profiles_dir", "%v", err)
+		}
+		for _, p := range profiles {
+			registry.AddProfile(p)
+		}
+	}
+	for i, pc := range cfg.MediaProfiles {
+		p, err := pc.Profile()
+		if err != nil {
+			c.add(fmt.Sprintf("media_profiles[%d]", i), "%v", err)
+			continue
+		}
+		registry.AddProfile(p)
+	}
+	for i, m := range cfg.Media {
+		if m.Profile != "" && registry.GetProfileByName(m.Profile) == nil {
+			c.add(fmt.Sprintf("media[%d].profile", i), "unknown media profile %q, see airprint-bridge list-profiles", m.Profile)
+		}
+	}
+}
+
+// filters checks the include and exclude patterns, and flags printers listed
+// in both: the include list wins, so such exclude entries have no effect
+func (c *configCheck) filters(cfg *ConfigFile) {
+	included := make(map[string]bool, len(cfg.Printers.Include))
+	for i, pattern := range cfg.Printers.Include {
+		if err := avahi.ValidatePattern(pattern); err != nil {
+			c.add(fmt.Sprintf("printers.include[%d]", i), "invalid pattern %q: %v", pattern, err)
+		}
+		included[strings.ToLower(pattern)] = true
+	}
+	for i, pattern := range cfg.Printers.Exclude {
+		field := fmt.Sprintf("printers.exclude[%d]", i)
+		if err := avahi.ValidatePattern(pattern); err != nil {
+			c.add(field, "invalid pattern %q: %v", pattern, err)
+		}
+		if included[strings.ToLower(pattern)] {
+			c.add(field, "%q is also in printers.include, which takes precedence", pattern)
+		}
+	}
+}
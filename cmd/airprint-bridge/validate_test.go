@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string // Problems, as configProblem.String formats them
+	}{
+		{
+			name:   "valid",
+			config: "cups:\n  host: localhost\n  port: 631\nipp:\n  submit_timeout: 30s\n",
+			want:   nil,
+		},
+		{
+			name:   "unknown key",
+			config: "cups:\n  host: localhost\n  hots: localhost\n",
+			want:   []string{"line 3, column 3: cups.hots: unknown key"},
+		},
+		{
+			name:   "wrong type",
+			config: "ipp:\n  port: six-three-one\n",
+			want:   []string{"line 2, column 9: ipp.port: cannot unmarshal !!str `six-thr...` into int"},
+		},
+		{
+			name:   "bad duration",
+			config: "ipp:\n  submit_timeout: 30\n",
+			want:   []string{`line 2: ipp.submit_timeout: invalid duration "30", use e.g. "30s" or "24h"`},
+		},
+		{
+			name:   "negative duration",
+			config: "monitor:\n  poll_interval: -5s\n",
+			want:   []string{`line 2: monitor.poll_interval: duration "-5s" is negative`},
+		},
+		{
+			name:   "port out of range",
+			config: "cups:\n  port: 70000\n",
+			want:   []string{"line 2: cups.port: port 70000 out of range 1-65535"},
+		},
+		{
+			name:   "api on the IPP port",
+			config: "ipp:\n  port: 8631\napi:\n  listen: \":8631\"\n",
+			want:   []string{"line 4: api.listen: port 8631 is already used by the IPP listener"},
+		},
+		{
+			name:   "unknown media profile",
+			config: "media:\n  - printer: Office\n    profile: no-such-profile\n",
+			want:   []string{`line 3: media[0].profile: unknown media profile "no-such-profile", see airprint-bridge list-profiles`},
+		},
+		{
+			name:   "excluded and included",
+			config: "printers:\n  include:\n    - Office\n  exclude:\n    - Lab\n    - office\n",
+			want:   []string{`line 6: printers.exclude[1]: "office" is also in printers.include, which takes precedence`},
+		},
+		{
+			name:   "sorted by line",
+			config: "ipp:\n  submit_timeout: soon\ncups:\n  port: -1\n  hots: localhost\n",
+			want: []string{
+				`line 2: ipp.submit_timeout: invalid duration "soon", use e.g. "30s" or "24h"`,
+				"line 4: cups.port: port -1 out of range 1-65535",
+				"line 5, column 3: cups.hots: unknown key",
+			},
+		},
+		{
+			name:   "not YAML",
+			config: "cups: [\n",
+			want:   []string{"line 1: did not find expected node content"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range validateConfig([]byte(tt.config)) {
+				got = append(got, p.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateConfig() =\n  %s\nwant\n  %s", strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+			}
+		})
+	}
+}
+
+func TestConfigProblem_Format(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem configProblem
+		want    string
+	}{
+		{"everything", configProblem{Line: 3, Column: 5, Field: "cups.hots", Message: "unknown key"}, "config.yaml:3:5: cups.hots: unknown key"},
+		{"no column", configProblem{Line: 3, Field: "cups.port", Message: "out of range"}, "config.yaml:3: cups.port: out of range"},
+		{"no line", configProblem{Message: "no printers"}, "config.yaml: no printers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.problem.format("config.yaml"); got != tt.want {
+				t.Errorf("format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeLine(t *testing.T) {
+	c, _, err := checkKeys([]byte("cups:\n  host: localhost\nauth:\n  providers:\n    - name: ldap\n    - name: radius\n      timeout: 5s\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		field string
+		want  int
+	}{
+		{"cups.host", 2},
+		{"auth.providers[1].timeout", 7},
+		{"auth.providers[1]", 6},
+		{"auth.providers[5].timeout", 4}, // Missing: the nearest line found
+		{"ipp.port", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := nodeLine(c.root, tt.field); got != tt.want {
+				t.Errorf("nodeLine(%q) = %d, want %d", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string // Substring of the error, empty for none
+	}{
+		{"known keys", "cups:\n  host: localhost\n", ""},
+		{"empty", "", ""},
+		{"unknown key", "cups:\n  hots: localhost\n", "line 2, column 3: cups.hots: unknown key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decodeStrict([]byte(tt.config))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("decodeStrict() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("decodeStrict() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package airprint
+
+// DocumentFormats are the document formats the bridge accepts, in the
+// default order of preference. Clients generally send the first format they
+// support, so the order decides what a printer receives.
+var DocumentFormats = []string{
+	"image/urf",
+	"application/pdf",
+	"image/jpeg",
+	"image/png",
+}
+
+// IsDocumentFormat reports whether format is one of DocumentFormats
+func IsDocumentFormat(format string) bool {
+	for _, f := range DocumentFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderFormats returns DocumentFormats with the preferred formats first, in
+// the given order. Unknown and repeated formats are ignored.
+func OrderFormats(preferred []string) []string {
+	ordered := make([]string, 0, len(DocumentFormats))
+	seen := make(map[string]bool, len(DocumentFormats))
+	for _, f := range append(append([]string{}, preferred...), DocumentFormats...) {
+		if IsDocumentFormat(f) && !seen[f] {
+			ordered = append(ordered, f)
+			seen[f] = true
+		}
+	}
+	return ordered
+}
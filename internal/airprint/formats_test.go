@@ -0,0 +1,27 @@
+package airprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOrderFormats(t *testing.T) {
+	tests := []struct {
+		name      string
+		preferred []string
+		want      []string
+	}{
+		{"default", nil, DocumentFormats},
+		{"prefer pdf", []string{"application/pdf"}, []string{"application/pdf", "image/urf", "image/jpeg", "image/png"}},
+		{"several", []string{"image/png", "application/pdf"}, []string{"image/png", "application/pdf", "image/urf", "image/jpeg"}},
+		{"unknown and repeated", []string{"application/postscript", "image/jpeg", "image/jpeg"}, []string{"image/jpeg", "image/urf", "application/pdf", "image/png"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OrderFormats(tt.preferred); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("OrderFormats(%v) = %v, want %v", tt.preferred, got, tt.want)
+			}
+		})
+	}
+}
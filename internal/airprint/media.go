@@ -0,0 +1,151 @@
+package airprint
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// Media kinds for the kind TXT record, in the order they are listed
+var mediaKinds = []string{"document", "envelope", "label", "photo", "postcard", "roll", "disc"}
+
+// envelopeSizes are the class and size parts of PWG names for envelopes
+var envelopeSizes = map[string]bool{
+	"na_number-9": true, "na_number-10": true, "na_number-11": true, "na_number-12": true,
+	"na_monarch": true, "na_personal": true, "na_a2": true, "na_6x9": true, "na_9x12": true, "na_10x13": true,
+	"iso_dl": true, "iso_c3": true, "iso_c4": true, "iso_c5": true, "iso_c6": true, "iso_c6c5": true, "iso_c7": true,
+	"jpn_chou3": true, "jpn_chou4": true, "jpn_kaku2": true, "prc_10": true,
+}
+
+// pointSize matches the wNNNhNNN part of names CUPS makes up for custom
+// sizes, in points
+var pointSize = regexp.MustCompile(`^w(\d+(?:\.\d+)?)h(\d+(?:\.\d+)?)$`)
+
+// PaperMax limits, short and long edge in hundredths of a millimetre with a
+// millimetre to spare. A printer's PaperMax is the first whose limit its
+// largest size fits.
+var paperMaxLimits = []struct {
+	value       string
+	short, long int
+}{
+	{"<legal-A4", 20900, 0},      // Narrower than A4 and Letter
+	{"legal-A4", 21690, 35660},   // Up to Legal
+	{"tabloid-A3", 29800, 43280}, // Up to A3 and Tabloid
+	{"isoC-A2", 45900, 64900},    // Up to C2 and A2
+}
+
+// MediaKinds returns the kind TXT record values for a printer with the
+// given media: document, envelope, label, photo, postcard, roll or disc.
+// Printers whose sizes tell nothing are documents.
+func MediaKinds(media []string) []string {
+	found := make(map[string]bool)
+	for _, name := range media {
+		if kind := mediaKind(name); kind != "" {
+			found[kind] = true
+		}
+	}
+	var kinds []string
+	for _, kind := range mediaKinds {
+		if found[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return []string{"document"}
+	}
+	return kinds
+}
+
+// mediaKind classifies a PWG media name, or returns "" if it can't
+func mediaKind(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "label"):
+		return "label"
+	case strings.Contains(lower, "receipt"), strings.Contains(lower, "roll"), strings.Contains(lower, "continuous"):
+		return "roll"
+	case strings.Contains(lower, "postcard"), strings.Contains(lower, "hagaki"):
+		return "postcard"
+	case strings.Contains(lower, "photo"), strings.Contains(lower, "index-4x6"), strings.HasPrefix(lower, "na_5x7_"):
+		return "photo"
+	case strings.Contains(lower, "disc"):
+		return "disc"
+	case strings.Contains(lower, "env"):
+		return "envelope"
+	}
+	if parts := strings.Split(lower, "_"); len(parts) >= 2 && envelopeSizes[parts[0]+"_"+parts[1]] {
+		return "envelope"
+	}
+
+	short, _, ok := mediaEdges(name)
+	switch {
+	case !ok:
+		return ""
+	case short < 10000:
+		// Narrower than 10 cm: label stock
+		return "label"
+	default:
+		return "document"
+	}
+}
+
+// PaperMax returns the PaperMax TXT record value for the largest of media,
+// or "" if no size is known
+func PaperMax(media []string) string {
+	maxShort, maxLong := 0, 0
+	for _, name := range media {
+		short, long, ok := mediaEdges(name)
+		if !ok {
+			continue
+		}
+		if short > maxShort {
+			maxShort = short
+		}
+		if long > maxLong {
+			maxLong = long
+		}
+	}
+	if maxShort == 0 {
+		return ""
+	}
+	for _, limit := range paperMaxLimits {
+		if maxShort <= limit.short && (limit.long == 0 || maxLong <= limit.long) {
+			return limit.value
+		}
+	}
+	return ">isoC-A2"
+}
+
+// mediaEdges returns the short and long edge of a media size, in hundredths
+// of a millimetre
+func mediaEdges(name string) (short, long int, ok bool) {
+	width, height, ok := cups.ParseMediaSize(name)
+	if !ok {
+		width, height, ok = pointsSize(name)
+	}
+	if !ok {
+		return 0, 0, false
+	}
+	if width > height {
+		width, height = height, width
+	}
+	return width, height, true
+}
+
+// pointsSize returns the dimensions of names such as "oe_w167h288_30256",
+// whose size is only given in points
+func pointsSize(name string) (width, height int, ok bool) {
+	for _, part := range strings.Split(name, "_") {
+		matches := pointSize.FindStringSubmatch(part)
+		if matches == nil {
+			continue
+		}
+		w, _ := strconv.ParseFloat(matches[1], 64)
+		h, _ := strconv.ParseFloat(matches[2], 64)
+		width, height = int(w*2540/72+0.5), int(h*2540/72+0.5)
+		return width, height, width > 0 && height > 0
+	}
+	return 0, 0, false
+}
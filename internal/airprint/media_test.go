@@ -0,0 +1,54 @@
+package airprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMediaKinds(t *testing.T) {
+	tests := []struct {
+		name  string
+		media []string
+		want  []string
+	}{
+		{"office", []string{"na_letter_8.5x11in", "iso_a4_210x297mm", "na_number-10_4.125x9.5in", "iso_dl_110x220mm"}, []string{"document", "envelope"}},
+		{"zebra", []string{"oe_4x6-label_4x6in", "oe_2.25x1.25-label_2.25x1.25in"}, []string{"label"}},
+		{"dymo", []string{"oe_w167h288_30256", "oe_w79h252_30252"}, []string{"label"}},
+		{"brother", []string{"oe_62x100mm_62x100mm"}, []string{"label"}},
+		{"photo", []string{"na_index-4x6_4x6in", "na_5x7_5x7in", "oe_photo-l_3.5x5in", "iso_a6_105x148mm"}, []string{"document", "photo"}},
+		{"receipt", []string{"om_receipt_80x200mm"}, []string{"roll"}},
+		{"unknown", []string{"custom"}, []string{"document"}},
+		{"none", nil, []string{"document"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MediaKinds(tt.media); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MediaKinds(%v) = %v, want %v", tt.media, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaperMax(t *testing.T) {
+	tests := []struct {
+		media []string
+		want  string
+	}{
+		{[]string{"oe_4x6-label_4x6in"}, "<legal-A4"},
+		{[]string{"om_receipt-long_80x297mm"}, "<legal-A4"},
+		{[]string{"na_letter_8.5x11in", "iso_a4_210x297mm"}, "legal-A4"},
+		{[]string{"na_legal_8.5x14in"}, "legal-A4"},
+		{[]string{"iso_a4_210x297mm", "iso_a3_297x420mm"}, "tabloid-A3"},
+		{[]string{"na_ledger_11x17in"}, "tabloid-A3"},
+		{[]string{"iso_a2_420x594mm"}, "isoC-A2"},
+		{[]string{"iso_a1_594x841mm"}, ">isoC-A2"},
+		{[]string{"custom"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := PaperMax(tt.media); got != tt.want {
+			t.Errorf("PaperMax(%v) = %q, want %q", tt.media, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package airprint
+
+import "strings"
+
+// ResourcePrefix starts the resource path of every printer, which lets one
+// IPP port serve them all
+const ResourcePrefix = "printers/"
+
+// ResourcePath returns the path, without a leading slash, a printer is
+// served at on the bridge's IPP port. It is advertised as the printer's rp
+// TXT record and used in its printer URIs, so the two always agree.
+func ResourcePath(name string) string {
+	return ResourcePrefix + name
+}
+
+// PrinterFromPath returns the printer a resource path or URI path names,
+// e.g. "Zebra" for "/printers/Zebra/", or "" if it names none
+func PrinterFromPath(path string) string {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(path, "/"), ResourcePrefix)
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, "/")
+	return name
+}
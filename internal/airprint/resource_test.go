@@ -0,0 +1,28 @@
+package airprint
+
+import "testing"
+
+func TestPrinterFromPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/printers/Zebra", "Zebra"},
+		{"printers/Zebra", "Zebra"},
+		{"/printers/Zebra/", "Zebra"},
+		{"/printers/Zebra/jobs/3", "Zebra"},
+		{"/printers/", ""},
+		{"/", ""},
+		{"/ipp/print", ""},
+	}
+
+	for _, tt := range tests {
+		if got := PrinterFromPath(tt.path); got != tt.want {
+			t.Errorf("PrinterFromPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if got := PrinterFromPath("/" + ResourcePath("Office")); got != "Office" {
+		t.Errorf("PrinterFromPath(ResourcePath) = %q, want Office", got)
+	}
+}
@@ -23,7 +23,7 @@ func NewTXTRecords(printer *cups.Printer) *TXTRecords {
 	t.Set("qtotal", "1")
 
 	// Resource path for the printer
-	t.Set("rp", fmt.Sprintf("printers/%s", printer.Name))
+	t.Set("rp", ResourcePath(printer.Name))
 
 	// Printer description
 	if printer.MakeModel != "" {
@@ -41,7 +41,7 @@ func NewTXTRecords(printer *cups.Printer) *TXTRecords {
 
 	// Supported document formats (PDLs)
 	// Order matters: URF should be first for AirPrint
-	t.Set("pdl", "image/urf,application/pdf,image/jpeg,image/png")
+	t.Set("pdl", strings.Join(DocumentFormats, ","))
 
 	// URF capabilities string
 	urf := NewURFCapabilities(
@@ -65,6 +65,9 @@ func NewTXTRecords(printer *cups.Printer) *TXTRecords {
 		t.Set("Duplex", "F")
 	}
 
+	// What the printer prints on and how large
+	t.SetMedia(printer.MediaSupported)
+
 	// NOTE: We deliberately skip the "media" TXT record because:
 	// 1. It can be very long for label printers and break Avahi
 	// 2. iOS queries the printer directly via IPP for media sizes
@@ -74,6 +77,13 @@ func NewTXTRecords(printer *cups.Printer) *TXTRecords {
 	t.Set("product", fmt.Sprintf("(%s)", sanitizeProduct(printer.MakeModel)))
 	t.Set("priority", "50") // Middle priority
 
+	// Authentication required to print ("none" for open access)
+	t.Set("air", "none")
+
+	// Only printing is bridged, never faxing or scanning
+	t.Set("Fax", "F")
+	t.Set("Scan", "F")
+
 	// Transparent printing support
 	t.Set("Transparent", "F")
 
@@ -86,6 +96,17 @@ func NewTXTRecords(printer *cups.Printer) *TXTRecords {
 	return t
 }
 
+// SetMedia sets the kind and PaperMax records for the media sizes the
+// printer is advertised with, e.g. those of its media profile
+func (t *TXTRecords) SetMedia(media []string) {
+	t.Set("kind", strings.Join(MediaKinds(media), ","))
+	if paperMax := PaperMax(media); paperMax != "" {
+		t.Set("PaperMax", paperMax)
+	} else {
+		delete(t.records, "PaperMax")
+	}
+}
+
 // Set adds or updates a TXT record
 func (t *TXTRecords) Set(key, value string) {
 	t.records[key] = value
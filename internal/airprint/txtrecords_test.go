@@ -21,12 +21,17 @@ func TestNewTXTRecords(t *testing.T) {
 
 	// Check required records
 	requiredRecords := map[string]string{
-		"txtvers": "1",
-		"rp":      "printers/TestPrinter",
-		"ty":      "Test Printer Model",
-		"note":    "Office",
-		"Color":   "T",
-		"Duplex":  "T",
+		"txtvers":  "1",
+		"rp":       "printers/TestPrinter",
+		"ty":       "Test Printer Model",
+		"note":     "Office",
+		"Color":    "T",
+		"Duplex":   "T",
+		"air":      "none",
+		"kind":     "document",
+		"PaperMax": "legal-A4",
+		"Fax":      "F",
+		"Scan":     "F",
 	}
 
 	for key, want := range requiredRecords {
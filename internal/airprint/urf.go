@@ -3,6 +3,7 @@ package airprint
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -31,17 +32,43 @@ func NewURFCapabilities(colorSupported, duplexSupported bool, resolutions []int)
 		urf.Duplex = append(urf.Duplex, "DM3", "DM4")
 	}
 
-	// Ensure we have at least 300dpi
-	if len(urf.Resolutions) == 0 {
-		urf.Resolutions = []int{300}
-	}
+	urf.Resolutions = NormalizeResolutions(urf.Resolutions)
 
 	return urf
 }
 
+// NormalizeResolutions returns the distinct resolutions in ascending order,
+// or 300 dpi when none are known. The URF RS value, the pages clients render
+// and the IPP resolution attributes all follow this list.
+func NormalizeResolutions(resolutions []int) []int {
+	sorted := make([]int, 0, len(resolutions))
+	for _, dpi := range resolutions {
+		if dpi > 0 {
+			sorted = append(sorted, dpi)
+		}
+	}
+	if len(sorted) == 0 {
+		return []int{300}
+	}
+	sort.Ints(sorted)
+
+	unique := sorted[:1]
+	for _, dpi := range sorted[1:] {
+		if dpi != unique[len(unique)-1] {
+			unique = append(unique, dpi)
+		}
+	}
+	return unique
+}
+
 // String returns the URF capability string for AirPrint TXT records
 // Format: "W8,SRGB24,CP255,RS300-600,DM3"
 func (u *URFCapabilities) String() string {
+	return strings.Join(u.Tokens(), ",")
+}
+
+// Tokens returns the individual capabilities of the URF string
+func (u *URFCapabilities) Tokens() []string {
 	var parts []string
 
 	// Add color modes
@@ -56,34 +83,18 @@ func (u *URFCapabilities) String() string {
 	// Add duplex modes
 	parts = append(parts, u.Duplex...)
 
-	return strings.Join(parts, ",")
+	return parts
 }
 
-// resolutionString returns the RS portion of the URF string
+// resolutionString returns the RS portion of the URF string. Every supported
+// resolution is listed ("RS203-300-600"); RS is a list, not a range, and
+// clients only render at the listed values.
 func (u *URFCapabilities) resolutionString() string {
-	if len(u.Resolutions) == 0 {
-		return "RS300"
-	}
-
-	// Sort and deduplicate
-	sorted := make([]int, len(u.Resolutions))
-	copy(sorted, u.Resolutions)
-	sort.Ints(sorted)
-
-	// Remove duplicates
-	unique := []int{sorted[0]}
-	for i := 1; i < len(sorted); i++ {
-		if sorted[i] != sorted[i-1] {
-			unique = append(unique, sorted[i])
-		}
+	parts := make([]string, 0, len(u.Resolutions))
+	for _, dpi := range NormalizeResolutions(u.Resolutions) {
+		parts = append(parts, strconv.Itoa(dpi))
 	}
-
-	if len(unique) == 1 {
-		return fmt.Sprintf("RS%d", unique[0])
-	}
-
-	// Return range
-	return fmt.Sprintf("RS%d-%d", unique[0], unique[len(unique)-1])
+	return "RS" + strings.Join(parts, "-")
 }
 
 // DefaultURFCapabilities returns sensible defaults when printer info is unavailable
@@ -95,3 +106,71 @@ func DefaultURFCapabilities() *URFCapabilities {
 		Resolutions: []int{300, 600},
 	}
 }
+
+// URFOverride adjusts the generated URF capabilities of a printer
+type URFOverride struct {
+	Replace []string // Advertise exactly these tokens instead of the generated ones
+	Add     []string // Tokens to add; each replaces generated tokens of the same kind
+	Remove  []string // Tokens to drop
+}
+
+// IsZero reports whether the override changes nothing
+func (o URFOverride) IsZero() bool {
+	return len(o.Replace) == 0 && len(o.Add) == 0 && len(o.Remove) == 0
+}
+
+// Apply returns tokens with the override applied. Adding "RS203" drops any
+// generated RS token, while adding several tokens of one kind ("DM1", "DM3")
+// keeps them all.
+func (o URFOverride) Apply(tokens []string) []string {
+	if len(o.Replace) > 0 {
+		return append([]string(nil), o.Replace...)
+	}
+
+	added := make(map[string]bool, len(o.Add))
+	for _, t := range o.Add {
+		added[urfKind(t)] = true
+	}
+	removed := make(map[string]bool, len(o.Remove))
+	for _, t := range o.Remove {
+		removed[t] = true
+	}
+
+	result := make([]string, 0, len(tokens)+len(o.Add))
+	for _, t := range tokens {
+		if !added[urfKind(t)] && !removed[t] {
+			result = append(result, t)
+		}
+	}
+	for _, t := range o.Add {
+		if !removed[t] {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// urfKind returns the letter prefix of a URF token, e.g. "RS" for "RS300"
+func urfKind(token string) string {
+	i := 0
+	for i < len(token) && token[i] >= 'A' && token[i] <= 'Z' {
+		i++
+	}
+	return token[:i]
+}
+
+// ValidateURFToken checks that token looks like a URF capability: upper-case
+// letters followed by a number or range, e.g. "RS203", "MT1-8" or "V1.4"
+func ValidateURFToken(token string) error {
+	kind := urfKind(token)
+	rest := token[len(kind):]
+	if kind == "" || rest == "" || rest[0] < '0' || rest[0] > '9' {
+		return fmt.Errorf("invalid URF token %q", token)
+	}
+	for _, c := range rest {
+		if (c < '0' || c > '9') && c != '-' && c != '.' {
+			return fmt.Errorf("invalid URF token %q", token)
+		}
+	}
+	return nil
+}
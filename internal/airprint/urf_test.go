@@ -79,7 +79,12 @@ func TestURFCapabilities_resolutionString(t *testing.T) {
 		{
 			name:        "unsorted resolutions",
 			resolutions: []int{600, 300, 1200},
-			want:        "RS300-1200",
+			want:        "RS300-600-1200",
+		},
+		{
+			name:        "label printer",
+			resolutions: []int{203, 300},
+			want:        "RS203-300",
 		},
 		{
 			name:        "duplicate resolutions",
@@ -106,3 +111,66 @@ func TestURFCapabilities_resolutionString(t *testing.T) {
 		})
 	}
 }
+
+func TestURFOverride(t *testing.T) {
+	generated := []string{"W8", "SRGB24", "CP255", "RS300-600", "DM1", "DM3"}
+
+	tests := []struct {
+		name     string
+		override URFOverride
+		want     string
+	}{
+		{
+			name:     "none",
+			override: URFOverride{},
+			want:     "W8,SRGB24,CP255,RS300-600,DM1,DM3",
+		},
+		{
+			name:     "pin resolution",
+			override: URFOverride{Add: []string{"RS203"}},
+			want:     "W8,SRGB24,CP255,DM1,DM3,RS203",
+		},
+		{
+			name:     "add media hints",
+			override: URFOverride{Add: []string{"IS1", "MT1-8"}},
+			want:     "W8,SRGB24,CP255,RS300-600,DM1,DM3,IS1,MT1-8",
+		},
+		{
+			name:     "several tokens of one kind",
+			override: URFOverride{Add: []string{"DM1", "DM4"}},
+			want:     "W8,SRGB24,CP255,RS300-600,DM1,DM4",
+		},
+		{
+			name:     "remove",
+			override: URFOverride{Remove: []string{"SRGB24", "DM3"}},
+			want:     "W8,CP255,RS300-600,DM1",
+		},
+		{
+			name:     "replace",
+			override: URFOverride{Replace: []string{"W8", "CP1", "RS203", "DM1"}, Add: []string{"IS1"}},
+			want:     "W8,CP1,RS203,DM1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(tt.override.Apply(generated), ",")
+			if got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateURFToken(t *testing.T) {
+	for _, token := range []string{"RS203", "MT1-8", "V1.4", "IS1", "SRGB24", "PQ3-4-5"} {
+		if err := ValidateURFToken(token); err != nil {
+			t.Errorf("ValidateURFToken(%q) = %v, want nil", token, err)
+		}
+	}
+	for _, token := range []string{"", "RS", "rs300", "300", "RS 300", "RS300,DM1"} {
+		if err := ValidateURFToken(token); err == nil {
+			t.Errorf("ValidateURFToken(%q) = nil, want error", token)
+		}
+	}
+}
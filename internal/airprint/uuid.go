@@ -0,0 +1,28 @@
+package airprint
+
+import (
+	"crypto/sha1"
+	"fmt"
+)
+
+// uuidNamespace is the name-based UUID namespace printer UUIDs are derived in
+var uuidNamespace = [16]byte{
+	0x4b, 0x1f, 0x3a, 0x6e, 0x92, 0xd0, 0x4c, 0x57,
+	0x8e, 0x21, 0x0a, 0x5c, 0x7d, 0xb3, 0x19, 0xe4,
+}
+
+// PrinterUUID returns a name-based (version 5) UUID for a queue on host.
+// It stays the same across restarts, so iOS recognises the printer instead
+// of showing a new one next to a ghost of the old.
+func PrinterUUID(host, queue string) string {
+	h := sha1.New()
+	h.Write(uuidNamespace[:])
+	h.Write([]byte(host + "/" + queue))
+	sum := h.Sum(nil)
+
+	var u [16]byte
+	copy(u[:], sum)
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,35 @@
+package airprint
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPrinterUUID(t *testing.T) {
+	format := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	tests := []struct {
+		name       string
+		host, a, b string
+		wantSame   bool
+	}{
+		{"stable", "print-host", "Zebra", "Zebra", true},
+		{"per queue", "print-host", "Zebra", "Office", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := PrinterUUID(tt.host, tt.a), PrinterUUID(tt.host, tt.b)
+			if !format.MatchString(a) {
+				t.Errorf("PrinterUUID = %q, not a version 5 UUID", a)
+			}
+			if (a == b) != tt.wantSame {
+				t.Errorf("PrinterUUID(%q) = %s, PrinterUUID(%q) = %s; same = %v, want %v", tt.a, a, tt.b, b, a == b, tt.wantSame)
+			}
+		})
+	}
+
+	if PrinterUUID("host-a", "Zebra") == PrinterUUID("host-b", "Zebra") {
+		t.Error("same queue on different hosts got the same UUID")
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// Reprinter prints archived jobs again
+type Reprinter interface {
+	ArchivedJobs() ([]jobs.Archived, error)
+	Reprint(ctx context.Context, id int, printer string) (jobs.Job, error)
+}
+
+// reprintRequest is the body of a reprint request; an empty printer means
+// the one the job was first printed on
+type reprintRequest struct {
+	Printer string `json:"printer"`
+}
+
+// reprintResponse describes the job created by a reprint
+type reprintResponse struct {
+	JobID     int    `json:"job_id"`
+	CUPSJobID int    `json:"cups_job_id"`
+	TraceID   string `json:"trace_id"`
+	Printer   string `json:"printer"`
+}
+
+// EnableArchive serves the job archive:
+//
+//	GET  /api/v1/archive                lists archived jobs, newest first
+//	POST /api/v1/archive/<id>/reprint   prints an archived job again
+func (s *Server) EnableArchive(reprinter Reprinter) {
+	s.mux.HandleFunc("/api/v1/archive", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		archived, err := reprinter.ArchivedJobs()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if archived == nil {
+			archived = []jobs.Archived{}
+		}
+		for i := range archived {
+			archived[i].CreatedAt = s.clock.In(archived[i].CreatedAt)
+		}
+		s.writeJSON(w, http.StatusOK, map[string][]jobs.Archived{"jobs": archived})
+	})
+
+	s.mux.HandleFunc("/api/v1/archive/", func(w http.ResponseWriter, r *http.Request) {
+		idPart, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/archive/"), "/")
+		id, err := strconv.Atoi(idPart)
+		if err != nil || action != "reprint" {
+			s.writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if r.Method != http.MethodPost {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		var req reprintRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil && err != io.EOF {
+			s.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+
+		job, err := reprinter.Reprint(r.Context(), id, req.Printer)
+		if err != nil {
+			switch {
+			case errors.Is(err, jobs.ErrNotArchived), errors.Is(err, ipp.ErrUnknownPrinter):
+				s.writeError(w, http.StatusNotFound, err.Error())
+			case errors.Is(err, ipp.ErrMaintenance):
+				s.writeError(w, http.StatusServiceUnavailable, err.Error())
+			default:
+				if denial, ok := ipp.AsDenial(err); ok {
+					s.writeError(w, http.StatusForbidden, denial.Message)
+					return
+				}
+				s.log.Error().Err(err).Int("archive_id", id).Msg("failed to reprint job")
+				s.writeError(w, http.StatusBadGateway, "failed to submit job")
+			}
+			return
+		}
+
+		s.writeJSON(w, http.StatusCreated, reprintResponse{
+			JobID:     job.ID,
+			CUPSJobID: job.CUPSJobID,
+			TraceID:   job.TraceID,
+			Printer:   job.Printer,
+		})
+	})
+}
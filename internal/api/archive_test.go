@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// fakeArchive reprints on known printers and records the last reprint
+type fakeArchive struct {
+	archived []jobs.Archived
+	printed  string // "<id>@<printer>"
+}
+
+func (f *fakeArchive) ArchivedJobs() ([]jobs.Archived, error) {
+	return f.archived, nil
+}
+
+func (f *fakeArchive) Reprint(ctx context.Context, id int, printer string) (jobs.Job, error) {
+	for _, a := range f.archived {
+		if a.ID != id {
+			continue
+		}
+		if printer == "" {
+			printer = a.Printer
+		}
+		if printer != "Zebra" && printer != "Zebra_Spare" {
+			return jobs.Job{}, fmt.Errorf("%w: %s", ipp.ErrUnknownPrinter, printer)
+		}
+		f.printed = fmt.Sprintf("%d@%s", id, printer)
+		return jobs.Job{ID: 40, CUPSJobID: 400, Printer: printer}, nil
+	}
+	return jobs.Job{}, fmt.Errorf("%w: %d", jobs.ErrNotArchived, id)
+}
+
+func TestArchive(t *testing.T) {
+	archive := &fakeArchive{archived: []jobs.Archived{{ID: 2, Printer: "Zebra", Name: "Label"}}}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableArchive(archive)
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/archive", nil))
+	var list struct {
+		Jobs []jobs.Archived `json:"jobs"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Jobs) != 1 || list.Jobs[0].ID != 2 {
+		t.Fatalf("GET archive = %d %+v, %v", rec.Code, list, err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		code    int
+		printed string
+	}{
+		{"original printer", "/api/v1/archive/2/reprint", "", http.StatusCreated, "2@Zebra"},
+		{"other printer", "/api/v1/archive/2/reprint", `{"printer":"Zebra_Spare"}`, http.StatusCreated, "2@Zebra_Spare"},
+		{"unknown printer", "/api/v1/archive/2/reprint", `{"printer":"Nope"}`, http.StatusNotFound, ""},
+		{"not archived", "/api/v1/archive/9/reprint", "", http.StatusNotFound, ""},
+		{"bad id", "/api/v1/archive/x/reprint", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive.printed = ""
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.code || archive.printed != tt.printed {
+				t.Errorf("POST %s = %d, printed %q; want %d, %q", tt.path, rec.Code, archive.printed, tt.code, tt.printed)
+			}
+		})
+	}
+}
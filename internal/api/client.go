@@ -0,0 +1,40 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Client calls the API of a running daemon, as the command line tools do
+type Client struct {
+	base  string // e.g. http://localhost:8632
+	token string // Sent as a bearer token if set
+	http  *http.Client
+}
+
+// NewClient creates a client for the API at base that sends token, if not
+// empty, with every request. A zero timeout means none.
+func NewClient(base, token string, timeout time.Duration) *Client {
+	return &Client{base: base, token: token, http: &http.Client{Timeout: timeout}}
+}
+
+// Get requests path, e.g. /api/v1/stats
+func (c *Client) Get(path string) (*http.Response, error) {
+	return c.Do(http.MethodGet, path, nil)
+}
+
+// Do sends a request for path, with body as its JSON body if not nil
+func (c *Client) Do(method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
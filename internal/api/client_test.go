@@ -0,0 +1,64 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+)
+
+func TestClient_Token(t *testing.T) {
+	tokens, err := auth.NewAPITokens(map[string]string{
+		"cli": fmt.Sprintf("%x", sha256.Sum256([]byte("cli-token"))),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl := &fakeMaintenance{printers: make(map[string]string)}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableMaintenance(ctrl)
+	s.SetTokens(tokens.Name)
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"no token", "", http.MethodGet, "/api/v1/maintenance", "", http.StatusUnauthorized},
+		{"wrong token", "guess", http.MethodGet, "/api/v1/maintenance", "", http.StatusUnauthorized},
+		{"token", "cli-token", http.MethodGet, "/api/v1/maintenance", "", http.StatusOK},
+		{"token with body", "cli-token", http.MethodPut, "/api/v1/printers/Zebra/maintenance", `{"message": "toner"}`, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			resp, err := NewClient(ts.URL, tt.token, 5*time.Second).Do(tt.method, tt.path, body)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+	if ctrl.printers["Zebra"] != "toner" {
+		t.Errorf("maintenance message = %q, want toner", ctrl.printers["Zebra"])
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+)
+
+// clock shows times in the zone and hour style people at the site expect.
+// Times are kept in UTC; only what the API returns and its pages show is
+// converted.
+type clock struct {
+	loc    *time.Location
+	hour12 bool
+}
+
+// SetTimeDisplay sets the zone times are returned and shown in, and whether
+// pages use a 12-hour clock. It must be called before ListenAndServe.
+func (s *Server) SetTimeDisplay(loc *time.Location, hour12 bool) {
+	s.clock = clock{loc: loc, hour12: hour12}
+}
+
+// In returns t in the display zone, for JSON responses
+func (c clock) In(t time.Time) time.Time {
+	if c.loc == nil || t.IsZero() {
+		return t
+	}
+	return t.In(c.loc)
+}
+
+// Short formats t as a weekday and time, e.g. "Mon 15:04"
+func (c clock) Short(t time.Time) string {
+	return c.In(t).Format("Mon " + c.timeLayout())
+}
+
+// Long formats t as a date and time, e.g. "Mon 2 Jan 15:04"
+func (c clock) Long(t time.Time) string {
+	return c.In(t).Format("Mon 2 Jan " + c.timeLayout())
+}
+
+func (c clock) timeLayout() string {
+	if c.hour12 {
+		return "3:04 PM"
+	}
+	return "15:04"
+}
+
+// token returns a guest token with its times in the display zone
+func (c clock) token(t auth.Token) auth.Token {
+	t.Created = c.In(t.Created)
+	t.Expires = c.In(t.Expires)
+	return t
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	at := time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC) // A Monday
+
+	tests := []struct {
+		name  string
+		clock clock
+		short string
+		long  string
+	}{
+		{"utc by default", clock{}, "Mon 14:30", "Mon 4 Mar 14:30"},
+		{"zone", clock{loc: tokyo}, "Mon 23:30", "Mon 4 Mar 23:30"},
+		{"12-hour", clock{loc: tokyo, hour12: true}, "Mon 11:30 PM", "Mon 4 Mar 11:30 PM"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.clock.Short(at); got != tt.short {
+				t.Errorf("Short() = %q, want %q", got, tt.short)
+			}
+			if got := tt.clock.Long(at); got != tt.long {
+				t.Errorf("Long() = %q, want %q", got, tt.long)
+			}
+			if !tt.clock.In(at).Equal(at) {
+				t.Error("In() changed the instant")
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import "net/http"
+
+// ConfigFunc returns the configuration in config file form, secrets
+// redacted
+type ConfigFunc func() (map[string]interface{}, error)
+
+// EnableConfig serves the configuration last loaded, at startup or on
+// reload, at GET /api/v1/config. Settings that need a restart may not be in
+// effect yet.
+func (s *Server) EnableConfig(config ConfigFunc) {
+	s.mux.HandleFunc("/api/v1/config", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		c, err := config()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, c)
+	})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Connection is an open IPP client connection
+type Connection struct {
+	Remote        string         `json:"remote"`
+	Opened        time.Time      `json:"opened"`
+	State         string         `json:"state"` // "new", "active" or "idle"
+	Requests      int            `json:"requests"`
+	LastRequest   *time.Time     `json:"last_request,omitempty"`
+	LastOperation string         `json:"last_operation,omitempty"`
+	Operations    map[string]int `json:"operations,omitempty"` // IPP operation name -> requests
+}
+
+// ClientConnections sums up the open connections of one client address
+type ClientConnections struct {
+	Connections int `json:"connections"`
+	Requests    int `json:"requests"`
+}
+
+// Connections lists the open IPP client connections, with totals per
+// client address
+type Connections struct {
+	Open        int                          `json:"open"`
+	Idle        int                          `json:"idle"`
+	Clients     map[string]ClientConnections `json:"clients"`
+	Connections []Connection                 `json:"connections"`
+}
+
+// ConnectionSource reports the open IPP client connections
+type ConnectionSource interface {
+	OpenConnections() []Connection
+}
+
+// EnableConnections serves the open IPP client connections, busiest client
+// first, at GET /api/v1/debug/connections, to find clients polling the
+// printer in a loop or connections left hanging
+func (s *Server) EnableConnections(source ConnectionSource) {
+	s.mux.HandleFunc("/api/v1/debug/connections", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		conns := source.OpenConnections()
+		result := Connections{Clients: make(map[string]ClientConnections), Connections: conns}
+		for i, c := range conns {
+			result.Open++
+			if c.State == "idle" {
+				result.Idle++
+			}
+			ip, _, err := net.SplitHostPort(c.Remote)
+			if err != nil {
+				ip = c.Remote
+			}
+			client := result.Clients[ip]
+			client.Connections++
+			client.Requests += c.Requests
+			result.Clients[ip] = client
+
+			conns[i].Opened = s.clock.In(c.Opened)
+			if c.LastRequest != nil {
+				last := s.clock.In(*c.LastRequest)
+				conns[i].LastRequest = &last
+			}
+		}
+		sort.SliceStable(conns, func(i, j int) bool { return conns[i].Requests > conns[j].Requests })
+		s.writeJSON(w, http.StatusOK, result)
+	})
+}
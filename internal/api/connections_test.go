@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type fakeConnections []Connection
+
+func (f fakeConnections) OpenConnections() []Connection {
+	return append([]Connection(nil), f...)
+}
+
+func TestConnections(t *testing.T) {
+	opened := time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableConnections(fakeConnections{
+		{Remote: "192.168.1.20:50001", Opened: opened, State: "idle", Requests: 3},
+		{Remote: "192.168.1.21:50002", Opened: opened, State: "active", Requests: 240, LastOperation: "Get-Printer-Attributes"},
+		{Remote: "192.168.1.20:50003", Opened: opened, State: "idle", Requests: 5},
+		{Remote: "[fd00::1]:50004", Opened: opened, State: "new"},
+	})
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/debug/connections", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET connections = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got Connections
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Open != 4 || got.Idle != 2 {
+		t.Errorf("open, idle = %d, %d, want 4, 2", got.Open, got.Idle)
+	}
+	if c := got.Clients["192.168.1.20"]; c.Connections != 2 || c.Requests != 8 {
+		t.Errorf("192.168.1.20 = %+v, want 2 connections, 8 requests", c)
+	}
+	if _, ok := got.Clients["fd00::1"]; !ok {
+		t.Errorf("IPv6 client missing: %v", got.Clients)
+	}
+	if len(got.Connections) != 4 || got.Connections[0].Requests != 240 {
+		t.Errorf("busiest connection not first: %+v", got.Connections)
+	}
+	if got.Connections[0].LastRequest != nil {
+		t.Errorf("unset last request shown: %v", got.Connections[0].LastRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/debug/connections", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST connections = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
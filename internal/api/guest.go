@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+)
+
+// guestTokenLifetimes are the choices offered on the guest token page
+var guestTokenLifetimes = []string{"1h", "4h", "24h", "168h"}
+
+// guestTokenRequest is the body of a request to mint a guest token
+type guestTokenRequest struct {
+	TTL  string `json:"ttl"` // Go duration, e.g. "4h"
+	Note string `json:"note"`
+}
+
+// EnableGuestTokens serves guest token management:
+//
+//	GET    /ui/guest                      web page to mint a token and show its QR code
+//	GET    /api/v1/guest-tokens           lists unexpired tokens
+//	POST   /api/v1/guest-tokens           mints a token
+//	DELETE /api/v1/guest-tokens/<token>   revokes a token
+func (s *Server) EnableGuestTokens(guests *auth.GuestTokens) {
+	h := &guestHandler{server: s, guests: guests}
+	s.mux.HandleFunc("/ui/guest", h.page)
+	s.mux.HandleFunc("/api/v1/guest-tokens", h.collection)
+	s.mux.HandleFunc("/api/v1/guest-tokens/", h.revoke)
+}
+
+type guestHandler struct {
+	server *Server
+	guests *auth.GuestTokens
+}
+
+func (h *guestHandler) collection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens := h.guests.List()
+		for i := range tokens {
+			tokens[i] = h.server.clock.token(tokens[i])
+		}
+		h.server.writeJSON(w, http.StatusOK, map[string][]auth.Token{"tokens": tokens})
+
+	case http.MethodPost:
+		var req guestTokenRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil && err != io.EOF {
+			h.server.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		token, err := h.mint(req)
+		if err != nil {
+			h.server.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.server.writeJSON(w, http.StatusCreated, h.server.clock.token(token))
+
+	default:
+		h.server.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (h *guestHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.server.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !h.guests.Revoke(strings.TrimPrefix(r.URL.Path, "/api/v1/guest-tokens/")) {
+		h.server.writeError(w, http.StatusNotFound, "unknown token")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mint creates a token from a request, defaulting to the shortest lifetime
+func (h *guestHandler) mint(req guestTokenRequest) (auth.Token, error) {
+	if req.TTL == "" {
+		req.TTL = guestTokenLifetimes[0]
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		return auth.Token{}, err
+	}
+	token, err := h.guests.Mint(ttl, req.Note)
+	if err != nil {
+		return auth.Token{}, err
+	}
+	h.server.log.Info().Time("expires", token.Expires).Str("note", token.Note).Msg("minted guest token")
+	return token, nil
+}
+
+// guestPageData is rendered by guestPage
+type guestPageData struct {
+	Lifetimes []string
+	Token     *auth.Token
+	QRCode    template.URL // data: URI of a PNG
+	Error     string
+	Clock     clock
+}
+
+func (h *guestHandler) page(w http.ResponseWriter, r *http.Request) {
+	data := guestPageData{Lifetimes: guestTokenLifetimes, Clock: h.server.clock}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		token, err := h.mint(guestTokenRequest{TTL: r.FormValue("ttl"), Note: r.FormValue("note")})
+		if err != nil {
+			data.Error = err.Error()
+			break
+		}
+		data.Token = &token
+		png, err := qrcode.Encode(token.Value, qrcode.Medium, 256)
+		if err != nil {
+			h.server.log.Warn().Err(err).Msg("failed to render QR code")
+			break
+		}
+		data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	default:
+		h.server.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := guestPage.Execute(w, data); err != nil {
+		h.server.log.Debug().Err(err).Msg("failed to write guest page")
+	}
+}
+
+var guestPage = template.Must(template.New("guest").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Guest printing</title>
+<style>
+body { font-family: -apple-system, sans-serif; max-width: 28em; margin: 2em auto; padding: 0 1em; }
+.token { font: 2em monospace; letter-spacing: 0.05em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>Guest printing</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{with .Token}}
+<p>When asked for a name and password while printing, enter any name and this password:</p>
+<p class="token">{{.Value}}</p>
+{{if $.QRCode}}<p><img src="{{$.QRCode}}" width="256" height="256" alt="QR code of the password"></p>{{end}}
+<p>Valid until {{$.Clock.Long .Expires}}.</p>
+<hr>
+{{end}}
+<form method="post">
+<p><label>Valid for
+<select name="ttl">{{range .Lifetimes}}<option>{{.}}</option>{{end}}</select></label></p>
+<p><label>Note <input name="note" placeholder="Visitor name"></label></p>
+<p><button type="submit">Create password</button></p>
+</form>
+</body>
+</html>
+`))
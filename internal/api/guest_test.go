@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+)
+
+func TestGuestTokens(t *testing.T) {
+	guests := auth.NewGuestTokens(24 * time.Hour)
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableGuestTokens(guests)
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/v1/guest-tokens", "", `{"ttl": "2h", "note": "Visitor"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var token auth.Token
+	if err := json.NewDecoder(rec.Body).Decode(&token); err != nil {
+		t.Fatalf("failed to decode token: %v", err)
+	}
+	if !guests.Valid(token.Value) {
+		t.Errorf("minted token %q is not valid", token.Value)
+	}
+
+	if rec := do(http.MethodPost, "/api/v1/guest-tokens", "", `{"ttl": "48h"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST above max lifetime status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	form := url.Values{"ttl": {"1h"}, "note": {"Front desk"}}.Encode()
+	rec = do(http.MethodPost, "/ui/guest", "application/x-www-form-urlencoded", form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "data:image/png;base64,") {
+		t.Errorf("guest page did not show a QR code (status %d)", rec.Code)
+	}
+	if got := len(guests.List()); got != 2 {
+		t.Errorf("%d tokens minted, want 2", got)
+	}
+
+	if rec := do(http.MethodDelete, "/api/v1/guest-tokens/"+token.Value, "", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if guests.Valid(token.Value) {
+		t.Error("revoked token is still valid")
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"runtime"
+)
+
+// Info describes a running bridge for fleet inventory
+type Info struct {
+	Version   string        `json:"version"`
+	Commit    string        `json:"commit"`
+	GoVersion string        `json:"go_version"`
+	Features  []string      `json:"features"`
+	Printers  []PrinterInfo `json:"printers"`
+}
+
+// PrinterInfo describes how jobs for one advertised printer are handled
+type PrinterInfo struct {
+	Name        string   `json:"name"`                   // CUPS queue name
+	DisplayName string   `json:"display_name,omitempty"` // Name shown to clients, if renamed
+	Formats     []string `json:"formats"`                // Document formats in order of preference
+	Pipeline    []string `json:"pipeline"`               // Processing stages before CUPS
+	Backend     string   `json:"backend"`                // "cups", "raw", "socket", "ipp", "ipps", "failover", or a virtual printer mode
+	Targets     []string `json:"targets,omitempty"`      // Queues jobs may be sent to, for other backends
+	Features    []string `json:"features,omitempty"`     // Experimental behaviors enabled for the printer
+}
+
+// InfoSource reports the bridge's current build and configuration
+type InfoSource interface {
+	Info() Info
+}
+
+// EnableInfo serves the bridge's version, features and per-printer
+// configuration at GET /api/v1/info
+func (s *Server) EnableInfo(source InfoSource) {
+	s.mux.HandleFunc("/api/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		info := source.Info()
+		info.GoVersion = runtime.Version()
+		s.writeJSON(w, http.StatusOK, info)
+	})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+type fakeInfo struct{}
+
+func (fakeInfo) Info() Info {
+	return Info{
+		Version:  "1.2.0",
+		Commit:   "abc123",
+		Features: []string{"tls", "failover"},
+		Printers: []PrinterInfo{{Name: "Zebra", Pipeline: []string{"watermark"}, Backend: "cups"}},
+	}
+}
+
+func TestInfo(t *testing.T) {
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableInfo(fakeInfo{})
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/info", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var info Info
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("failed to decode info: %v", err)
+	}
+	if info.Version != "1.2.0" || info.GoVersion == "" {
+		t.Errorf("version = %q, go_version = %q", info.Version, info.GoVersion)
+	}
+	if want := (fakeInfo{}).Info().Printers; !reflect.DeepEqual(info.Printers, want) {
+		t.Errorf("printers = %+v, want %+v", info.Printers, want)
+	}
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/info", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
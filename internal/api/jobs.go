@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// Job is a print job submitted through the bridge
+type Job struct {
+	ID                   int        `json:"id"` // Job ID clients see
+	CUPSJobID            int        `json:"cups_job_id"`
+	TraceID              string     `json:"trace_id,omitempty"`
+	Printer              string     `json:"printer"`
+	Name                 string     `json:"name"`
+	User                 string     `json:"user,omitempty"`
+	DocumentFormat       string     `json:"document_format,omitempty"`
+	State                string     `json:"state"` // IPP job-state keyword, e.g. "processing"
+	StateReasons         []string   `json:"state_reasons,omitempty"`
+	ImpressionsCompleted int        `json:"impressions_completed"`
+	CreatedAt            time.Time  `json:"created_at"`
+	CompletedAt          *time.Time `json:"completed_at,omitempty"`
+}
+
+// JobSource lists the jobs the bridge knows of
+type JobSource interface {
+	// Jobs returns a printer's jobs, or every printer's for "", that are
+	// "completed", "not-completed" or "all", as IPP's which-jobs
+	Jobs(printer, which string) []Job
+}
+
+// EnableJobs serves the jobs submitted through the bridge at
+// GET /api/v1/jobs, optionally for one printer (?printer=) and by state
+// (?which=completed, not-completed or all; default not-completed)
+func (s *Server) EnableJobs(source JobSource) {
+	s.mux.HandleFunc("/api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		which := r.URL.Query().Get("which")
+		switch which {
+		case "":
+			which = "not-completed"
+		case "completed", "not-completed", "all":
+		default:
+			s.writeError(w, http.StatusBadRequest, "invalid which: "+which)
+			return
+		}
+		list := source.Jobs(r.URL.Query().Get("printer"), which)
+		if list == nil {
+			list = []Job{}
+		}
+		for i := range list {
+			list[i].CreatedAt = s.clock.In(list[i].CreatedAt)
+			if list[i].CompletedAt != nil {
+				t := s.clock.In(*list[i].CompletedAt)
+				list[i].CompletedAt = &t
+			}
+		}
+		s.writeJSON(w, http.StatusOK, map[string][]Job{"jobs": list})
+	})
+}
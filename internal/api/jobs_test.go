@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type fakeJobs struct {
+	printer, which string
+}
+
+func (f *fakeJobs) Jobs(printer, which string) []Job {
+	f.printer, f.which = printer, which
+	if printer == "Empty" {
+		return nil
+	}
+	return []Job{{ID: 1, Printer: "Zebra", State: "processing", CreatedAt: time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)}}
+}
+
+func TestJobs(t *testing.T) {
+	source := &fakeJobs{}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableJobs(source)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantWhich  string
+		wantJobs   int
+	}{
+		{"default", "", http.StatusOK, "not-completed", 1},
+		{"all for a printer", "?printer=Zebra&which=all", http.StatusOK, "all", 1},
+		{"none", "?printer=Empty", http.StatusOK, "not-completed", 0},
+		{"bad which", "?which=some", http.StatusBadRequest, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*source = fakeJobs{}
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/jobs"+tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var got struct {
+				Jobs []Job `json:"jobs"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Jobs == nil || len(got.Jobs) != tt.wantJobs {
+				t.Errorf("jobs = %+v, want %d", got.Jobs, tt.wantJobs)
+			}
+			if source.which != tt.wantWhich {
+				t.Errorf("which = %q, want %q", source.which, tt.wantWhich)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/labels"
+)
+
+// maxLabelRequest bounds the size of a label request body
+const maxLabelRequest = 1 << 20
+
+// JobSubmitter sends documents through the bridge's print pipeline
+type JobSubmitter interface {
+	SubmitJob(ctx context.Context, printerName string, document io.Reader, spec jobs.Job, options map[string]string) (jobs.Job, error)
+}
+
+// labelRequest is the body of a label print request
+type labelRequest struct {
+	Printer string            `json:"printer"`
+	JobName string            `json:"job_name"`
+	User    string            `json:"user"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// labelResponse describes the job created for a label
+type labelResponse struct {
+	JobID     int    `json:"job_id"`
+	CUPSJobID int    `json:"cups_job_id"`
+	TraceID   string `json:"trace_id"`
+	Printer   string `json:"printer"`
+	Template  string `json:"template"`
+}
+
+// EnableLabels serves template-based label printing:
+//
+//	GET  /api/v1/labels         lists template names
+//	POST /api/v1/labels/<name>  renders <name> with JSON fields and prints it
+func (s *Server) EnableLabels(submitter JobSubmitter, templates *labels.Registry) {
+	h := &labelHandler{server: s, submitter: submitter, templates: templates}
+	s.mux.HandleFunc("/api/v1/labels", h.list)
+	s.mux.HandleFunc("/api/v1/labels/", h.print)
+}
+
+type labelHandler struct {
+	server    *Server
+	submitter JobSubmitter
+	templates *labels.Registry
+}
+
+func (h *labelHandler) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.server.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	h.server.writeJSON(w, http.StatusOK, map[string][]string{"templates": h.templates.Names()})
+}
+
+func (h *labelHandler) print(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.server.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/labels/")
+	tmpl, ok := h.templates.Get(name)
+	if !ok {
+		h.server.writeError(w, http.StatusNotFound, "unknown template: "+name)
+		return
+	}
+
+	var req labelRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxLabelRequest)).Decode(&req); err != nil {
+		h.server.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.Printer == "" {
+		h.server.writeError(w, http.StatusBadRequest, "printer is required")
+		return
+	}
+
+	doc, err := tmpl.Render(req.Fields)
+	if err != nil {
+		h.server.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	jobName := req.JobName
+	if jobName == "" {
+		jobName = "Label: " + name
+	}
+
+	job, err := h.submitter.SubmitJob(r.Context(), req.Printer, bytes.NewReader(doc), jobs.Job{
+		Name:           jobName,
+		User:           req.User,
+		DocumentFormat: tmpl.Format,
+	}, map[string]string{"document-format": tmpl.Format})
+	if err != nil {
+		if errors.Is(err, ipp.ErrUnknownPrinter) {
+			h.server.writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if denial, ok := ipp.AsDenial(err); ok {
+			h.server.writeError(w, http.StatusForbidden, denial.Message)
+			return
+		}
+		if errors.Is(err, ipp.ErrMaintenance) {
+			h.server.writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		h.server.log.Error().Err(err).Str("template", name).Msg("failed to print label")
+		h.server.writeError(w, http.StatusBadGateway, "failed to submit job")
+		return
+	}
+
+	h.server.log.Info().
+		Str("template", name).
+		Str("printer", job.Printer).
+		Int("job_id", job.ID).
+		Msg("label printed")
+
+	h.server.writeJSON(w, http.StatusCreated, labelResponse{
+		JobID:     job.ID,
+		CUPSJobID: job.CUPSJobID,
+		TraceID:   job.TraceID,
+		Printer:   job.Printer,
+		Template:  name,
+	})
+}
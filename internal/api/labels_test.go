@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/labels"
+)
+
+type fakeSubmitter struct {
+	document string
+	spec     jobs.Job
+	options  map[string]string
+}
+
+func (f *fakeSubmitter) SubmitJob(_ context.Context, printerName string, document io.Reader, spec jobs.Job, options map[string]string) (jobs.Job, error) {
+	if printerName != "Zebra" {
+		return jobs.Job{}, fmt.Errorf("%w: %s", ipp.ErrUnknownPrinter, printerName)
+	}
+	data, _ := io.ReadAll(document)
+	f.document = string(data)
+	f.spec = spec
+	f.options = options
+	spec.ID = 1
+	spec.CUPSJobID = 42
+	spec.Printer = printerName
+	return spec, nil
+}
+
+func TestLabels_Print(t *testing.T) {
+	tmpl, err := labels.Parse("ship", labels.FormatRaw, "^XA^FD{{.to}}^FS^XZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := labels.NewRegistry(tmpl)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantDoc    string
+	}{
+		{
+			name:       "prints rendered label",
+			path:       "/api/v1/labels/ship",
+			body:       `{"printer": "Zebra", "fields": {"to": "ACME"}}`,
+			wantStatus: http.StatusCreated,
+			wantDoc:    "^XA^FDACME^FS^XZ",
+		},
+		{
+			name:       "unknown template",
+			path:       "/api/v1/labels/nope",
+			body:       `{"printer": "Zebra"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown printer",
+			path:       "/api/v1/labels/ship",
+			body:       `{"printer": "Other", "fields": {"to": "ACME"}}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "missing field",
+			path:       "/api/v1/labels/ship",
+			body:       `{"printer": "Zebra", "fields": {}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing printer",
+			path:       "/api/v1/labels/ship",
+			body:       `{"fields": {"to": "ACME"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submitter := &fakeSubmitter{}
+			s := NewServer(":0", zerolog.Nop())
+			s.EnableLabels(submitter, registry)
+
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantDoc != "" {
+				if submitter.document != tt.wantDoc {
+					t.Errorf("document = %q, want %q", submitter.document, tt.wantDoc)
+				}
+				if submitter.options["document-format"] != labels.FormatRaw {
+					t.Errorf("document-format = %q, want %q", submitter.options["document-format"], labels.FormatRaw)
+				}
+			}
+		})
+	}
+}
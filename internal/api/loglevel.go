@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogLevel is the level the daemon logs at
+type LogLevel struct {
+	Level      string     `json:"level"`
+	Configured string     `json:"configured"`      // log.level, returned to when an override ends
+	Until      *time.Time `json:"until,omitempty"` // When a temporary override ends
+}
+
+// LogLevelController changes the log level at runtime
+type LogLevelController interface {
+	LogLevel() LogLevel
+	// SetLogLevel overrides the level, returning to the configured one
+	// after d, or not until restart or reload when d is 0
+	SetLogLevel(level zerolog.Level, d time.Duration)
+	// ResetLogLevel returns to the configured level
+	ResetLogLevel()
+}
+
+// logLevelRequest is the body of a request to change the log level
+type logLevelRequest struct {
+	Level    string `json:"level"`
+	Duration string `json:"duration"` // e.g. "15m"; empty to keep the level
+}
+
+// EnableLogLevel serves runtime log level control, so debug logs of a flaky
+// print can be captured without a restart:
+//
+//	GET    /api/v1/log-level   returns the level
+//	PUT    /api/v1/log-level   sets it, optionally for a while
+//	DELETE /api/v1/log-level   returns to the configured level
+func (s *Server) EnableLogLevel(ctrl LogLevelController) {
+	s.mux.HandleFunc("/api/v1/log-level", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+
+		case http.MethodPut, http.MethodPost:
+			var req logLevelRequest
+			if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil {
+				s.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+				return
+			}
+			level, err := zerolog.ParseLevel(req.Level)
+			if err != nil || req.Level == "" {
+				s.writeError(w, http.StatusBadRequest, "invalid level: "+req.Level)
+				return
+			}
+			var d time.Duration
+			if req.Duration != "" {
+				if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+					s.writeError(w, http.StatusBadRequest, "invalid duration: "+req.Duration)
+					return
+				}
+			}
+			ctrl.SetLogLevel(level, d)
+
+		case http.MethodDelete:
+			ctrl.ResetLogLevel()
+
+		default:
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.writeJSON(w, http.StatusOK, ctrl.LogLevel())
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type fakeLogLevel struct {
+	level      zerolog.Level
+	configured zerolog.Level
+	duration   time.Duration
+}
+
+func (f *fakeLogLevel) LogLevel() LogLevel {
+	return LogLevel{Level: f.level.String(), Configured: f.configured.String()}
+}
+
+func (f *fakeLogLevel) SetLogLevel(level zerolog.Level, d time.Duration) {
+	f.level, f.duration = level, d
+}
+
+func (f *fakeLogLevel) ResetLogLevel() {
+	f.level, f.duration = f.configured, 0
+}
+
+func TestLogLevel(t *testing.T) {
+	ctrl := &fakeLogLevel{level: zerolog.InfoLevel, configured: zerolog.InfoLevel}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableLogLevel(ctrl)
+
+	do := func(method, body string) (int, LogLevel) {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(method, "/api/v1/log-level", strings.NewReader(body)))
+		var got LogLevel
+		_ = json.Unmarshal(rec.Body.Bytes(), &got)
+		return rec.Code, got
+	}
+
+	code, got := do(http.MethodPut, `{"level": "debug", "duration": "15m"}`)
+	if code != http.StatusOK || got.Level != "debug" {
+		t.Fatalf("PUT = %d %+v, want 200 and debug", code, got)
+	}
+	if ctrl.duration != 15*time.Minute {
+		t.Errorf("duration = %v, want 15m", ctrl.duration)
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"unknown level", `{"level": "loud"}`},
+		{"no level", `{}`},
+		{"bad duration", `{"level": "debug", "duration": "soon"}`},
+		{"negative duration", `{"level": "debug", "duration": "-1m"}`},
+		{"not JSON", `debug`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := do(http.MethodPut, tt.body); code != http.StatusBadRequest {
+				t.Errorf("PUT status = %d, want %d", code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	if code, got := do(http.MethodDelete, ""); code != http.StatusOK || got.Level != "info" {
+		t.Errorf("DELETE = %d %+v, want 200 and info", code, got)
+	}
+	if code, got := do(http.MethodGet, ""); code != http.StatusOK || got.Configured != "info" {
+		t.Errorf("GET = %d %+v, want 200 and configured info", code, got)
+	}
+	if code, _ := do(http.MethodPatch, ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("PATCH status = %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+// MaintenanceController toggles printer maintenance mode
+type MaintenanceController interface {
+	SetMaintenance(name, message string) error
+	ClearMaintenance(name string)
+	Maintenance() map[string]string
+}
+
+// maintenanceRequest is the body of a request to enter maintenance mode
+type maintenanceRequest struct {
+	Message string `json:"message"`
+}
+
+// EnableMaintenance serves maintenance mode control:
+//
+//	GET    /api/v1/maintenance                   lists printers in maintenance
+//	PUT    /api/v1/printers/<name>/maintenance   enters maintenance mode
+//	DELETE /api/v1/printers/<name>/maintenance   returns the printer to service
+func (s *Server) EnableMaintenance(ctrl MaintenanceController) {
+	s.mux.HandleFunc("/api/v1/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]map[string]string{"printers": ctrl.Maintenance()})
+	})
+
+	s.handlePrinterResource("maintenance", func(w http.ResponseWriter, r *http.Request, printer string) {
+		switch r.Method {
+		case http.MethodPut, http.MethodPost:
+			var req maintenanceRequest
+			if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil && err != io.EOF {
+				s.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+				return
+			}
+			if err := ctrl.SetMaintenance(printer, req.Message); err != nil {
+				if errors.Is(err, ipp.ErrUnknownPrinter) {
+					s.writeError(w, http.StatusNotFound, err.Error())
+					return
+				}
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case http.MethodDelete:
+			ctrl.ClearMaintenance(printer)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+type fakeMaintenance struct {
+	printers map[string]string
+}
+
+func (f *fakeMaintenance) SetMaintenance(name, message string) error {
+	if name != "Zebra" {
+		return fmt.Errorf("%w: %s", ipp.ErrUnknownPrinter, name)
+	}
+	f.printers[name] = message
+	return nil
+}
+
+func (f *fakeMaintenance) ClearMaintenance(name string) {
+	delete(f.printers, name)
+}
+
+func (f *fakeMaintenance) Maintenance() map[string]string {
+	return f.printers
+}
+
+func TestMaintenance(t *testing.T) {
+	ctrl := &fakeMaintenance{printers: make(map[string]string)}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableMaintenance(ctrl)
+
+	do := func(method, path, body string) int {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := do(http.MethodPut, "/api/v1/printers/Zebra/maintenance", `{"message": "Out of labels"}`); code != http.StatusNoContent {
+		t.Fatalf("PUT status = %d, want %d", code, http.StatusNoContent)
+	}
+	if ctrl.printers["Zebra"] != "Out of labels" {
+		t.Errorf("message = %q, want %q", ctrl.printers["Zebra"], "Out of labels")
+	}
+
+	if code := do(http.MethodPut, "/api/v1/printers/Other/maintenance", ""); code != http.StatusNotFound {
+		t.Errorf("PUT unknown printer status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := do(http.MethodGet, "/api/v1/printers/Zebra/unknown", ""); code != http.StatusNotFound {
+		t.Errorf("unknown resource status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := do(http.MethodDelete, "/api/v1/printers/Zebra/maintenance", ""); code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want %d", code, http.StatusNoContent)
+	}
+	if _, ok := ctrl.printers["Zebra"]; ok {
+		t.Error("printer still in maintenance after DELETE")
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+// maxPreviewBytes bounds the documents uploaded for previews
+const maxPreviewBytes = 64 << 20
+
+// PreviewRenderer renders pages as a printer would print them
+type PreviewRenderer interface {
+	Preview(printer string, document io.Reader, req ipp.PreviewRequest) (ipp.Preview, error)
+}
+
+// EnablePreview serves print previews, so apps can show users what a label
+// will look like before submitting the real job:
+//
+//	POST /api/v1/printers/<name>/preview?page=1&media=...&scaling=...
+//
+// The body is an Apple Raster, PNG or JPEG document. The response is the
+// page as a PNG, with the document's page count in X-Page-Count.
+func (s *Server) EnablePreview(renderer PreviewRenderer) {
+	s.handlePrinterResource("preview", func(w http.ResponseWriter, r *http.Request, printer string) {
+		if r.Method != http.MethodPost {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		query := r.URL.Query()
+		req := ipp.PreviewRequest{
+			Media:   query.Get("media"),
+			Scaling: query.Get("scaling"),
+			JobName: "Preview",
+		}
+		req.User, _, _ = r.BasicAuth()
+		if v := query.Get("page"); v != "" {
+			page, err := strconv.Atoi(v)
+			if err != nil || page < 1 {
+				s.writeError(w, http.StatusBadRequest, "invalid page "+strconv.Quote(v))
+				return
+			}
+			req.Page = page
+		}
+
+		body := http.MaxBytesReader(w, r.Body, maxPreviewBytes)
+		preview, err := renderer.Preview(printer, body, req)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			switch {
+			case errors.Is(err, ipp.ErrUnknownPrinter):
+				s.writeError(w, http.StatusNotFound, err.Error())
+			case errors.As(err, &tooLarge):
+				s.writeError(w, http.StatusRequestEntityTooLarge, "document too large")
+			case errors.Is(err, ipp.ErrInvalidPreview):
+				s.writeError(w, http.StatusBadRequest, err.Error())
+			default:
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("X-Page-Count", strconv.Itoa(preview.Pages))
+		if err := png.Encode(w, preview.Image); err != nil {
+			s.log.Debug().Err(err).Msg("failed to write preview")
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+type fakeRenderer struct {
+	got ipp.PreviewRequest
+}
+
+func (f *fakeRenderer) Preview(printer string, document io.Reader, req ipp.PreviewRequest) (ipp.Preview, error) {
+	if printer != "Zebra" {
+		return ipp.Preview{}, fmt.Errorf("%w: %s", ipp.ErrUnknownPrinter, printer)
+	}
+	data, _ := io.ReadAll(document)
+	if string(data) != "label" {
+		return ipp.Preview{}, fmt.Errorf("%w: not a document", ipp.ErrInvalidPreview)
+	}
+	f.got = req
+	return ipp.Preview{Image: image.NewGray(image.Rect(0, 0, 4, 6)), Pages: 3}, nil
+}
+
+func TestPreview(t *testing.T) {
+	renderer := &fakeRenderer{}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnablePreview(renderer)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("alice", "secret")
+		s.mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/api/v1/printers/Zebra/preview", "garbage", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/printers/Zebra/preview?page=0", "label", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/printers/Other/preview", "label", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/printers/Zebra/preview", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if rec := do(tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s %s status = %d, want %d", tt.method, tt.path, tt.body, rec.Code, tt.want)
+		}
+	}
+
+	rec := do(http.MethodPost, "/api/v1/printers/Zebra/preview?page=2&media=oe_4x6-label_4x6in&scaling=fit", "label")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Page-Count"); got != "3" {
+		t.Errorf("X-Page-Count = %q, want 3", got)
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 6 {
+		t.Errorf("preview is %v, want 4x6", img.Bounds())
+	}
+	want := ipp.PreviewRequest{Page: 2, Media: "oe_4x6-label_4x6in", Scaling: "fit", User: "alice", JobName: "Preview"}
+	if renderer.got != want {
+		t.Errorf("request = %+v, want %+v", renderer.got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+// Printer is a printer the bridge serves, as of the last poll of CUPS
+type Printer struct {
+	Name         string   `json:"name"`                   // CUPS queue name
+	DisplayName  string   `json:"display_name,omitempty"` // Name shown to clients, if renamed
+	MakeModel    string   `json:"make_model,omitempty"`
+	Location     string   `json:"location,omitempty"`
+	State        string   `json:"state"` // "idle", "processing", "stopped" or "unknown"
+	StateReasons []string `json:"state_reasons,omitempty"`
+	StateMessage string   `json:"state_message,omitempty"`
+	Accepting    bool     `json:"accepting"`
+	QueuedJobs   int      `json:"queued_jobs"`
+	Paused       bool     `json:"paused"` // In maintenance mode on the bridge
+	PauseMessage string   `json:"pause_message,omitempty"`
+}
+
+// PrinterSource lists the printers served
+type PrinterSource interface {
+	PrinterList() []Printer
+}
+
+// pauseRequest is the body of a request to pause a printer
+type pauseRequest struct {
+	Message string `json:"message"`
+}
+
+// EnablePrinters serves the printers and pausing them, a shorthand for
+// maintenance mode suited to switches in home automation:
+//
+//	GET  /api/v1/printers                  lists printers
+//	GET  /api/v1/printers/<name>           returns one printer
+//	POST /api/v1/printers/<name>/pause     pauses a printer
+//	POST /api/v1/printers/<name>/resume    returns it to service
+func (s *Server) EnablePrinters(source PrinterSource, ctrl MaintenanceController) {
+	find := func(name string) (Printer, bool) {
+		for _, p := range source.PrinterList() {
+			if p.Name == name {
+				return p, true
+			}
+		}
+		return Printer{}, false
+	}
+
+	s.mux.HandleFunc("/api/v1/printers", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string][]Printer{"printers": source.PrinterList()})
+	})
+
+	s.handlePrinterResource("", func(w http.ResponseWriter, r *http.Request, printer string) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		p, ok := find(printer)
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "unknown printer: "+printer)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, p)
+	})
+
+	s.handlePrinterResource("pause", func(w http.ResponseWriter, r *http.Request, printer string) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		var req pauseRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil && err != io.EOF {
+			s.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if err := ctrl.SetMaintenance(printer, req.Message); err != nil {
+			if errors.Is(err, ipp.ErrUnknownPrinter) {
+				s.writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		p, _ := find(printer)
+		s.writeJSON(w, http.StatusOK, p)
+	})
+
+	s.handlePrinterResource("resume", func(w http.ResponseWriter, r *http.Request, printer string) {
+		if r.Method != http.MethodPost && r.Method != http.MethodPut {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		p, ok := find(printer)
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "unknown printer: "+printer)
+			return
+		}
+		ctrl.ClearMaintenance(printer)
+		p.Paused, p.PauseMessage = false, ""
+		s.writeJSON(w, http.StatusOK, p)
+	})
+}
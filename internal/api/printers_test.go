@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// fakePrinters lists Zebra, paused when it is in maintenance
+type fakePrinters struct {
+	maintenance *fakeMaintenance
+}
+
+func (f fakePrinters) PrinterList() []Printer {
+	message, paused := f.maintenance.printers["Zebra"]
+	return []Printer{{Name: "Zebra", State: "idle", Accepting: true, Paused: paused, PauseMessage: message}}
+}
+
+func TestPrinters(t *testing.T) {
+	ctrl := &fakeMaintenance{printers: make(map[string]string)}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnablePrinters(fakePrinters{ctrl}, ctrl)
+	s.EnableMaintenance(ctrl)
+
+	do := func(method, path, body string) (int, string) {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec.Code, rec.Body.String()
+	}
+
+	code, body := do(http.MethodGet, "/api/v1/printers", "")
+	var list struct {
+		Printers []Printer `json:"printers"`
+	}
+	if err := json.Unmarshal([]byte(body), &list); err != nil || code != http.StatusOK {
+		t.Fatalf("GET printers = %d %s", code, body)
+	}
+	if len(list.Printers) != 1 || list.Printers[0].Name != "Zebra" {
+		t.Errorf("printers = %+v, want Zebra", list.Printers)
+	}
+
+	if code, _ := do(http.MethodGet, "/api/v1/printers/Other", ""); code != http.StatusNotFound {
+		t.Errorf("GET unknown printer status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	code, body = do(http.MethodPost, "/api/v1/printers/Zebra/pause", `{"message": "Out of labels"}`)
+	var p Printer
+	if err := json.Unmarshal([]byte(body), &p); err != nil || code != http.StatusOK {
+		t.Fatalf("POST pause = %d %s", code, body)
+	}
+	if !p.Paused || p.PauseMessage != "Out of labels" {
+		t.Errorf("paused printer = %+v, want paused with the message", p)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/printers/Other/pause", ""); code != http.StatusNotFound {
+		t.Errorf("POST pause unknown printer status = %d, want %d", code, http.StatusNotFound)
+	}
+	// Routes for per-printer resources are shared
+	if code, _ := do(http.MethodDelete, "/api/v1/printers/Zebra/maintenance", ""); code != http.StatusNoContent {
+		t.Errorf("DELETE maintenance status = %d, want %d", code, http.StatusNoContent)
+	}
+
+	do(http.MethodPost, "/api/v1/printers/Zebra/pause", "")
+	code, body = do(http.MethodPost, "/api/v1/printers/Zebra/resume", "")
+	if code != http.StatusOK || strings.Contains(body, `"paused":true`) {
+		t.Errorf("POST resume = %d %s, want the printer unpaused", code, body)
+	}
+	if _, ok := ctrl.printers["Zebra"]; ok {
+		t.Error("printer still paused after resume")
+	}
+	if code, _ := do(http.MethodGet, "/api/v1/printers/Zebra/pause", ""); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET pause status = %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
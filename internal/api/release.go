@@ -0,0 +1,266 @@
+package api
+
+import (
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// Kiosk PIN guessing is throttled per client address
+const (
+	kioskMaxFailures = 5
+	kioskLockout     = 5 * time.Minute
+)
+
+// ReleaseQueue holds jobs until their owner releases them
+type ReleaseQueue interface {
+	HeldJobs(user string) []jobs.Job
+	ReleaseJob(id int, user, printer string) error
+	CancelHeldJob(id int, user string) error
+}
+
+// EnableRelease serves the release queue for held jobs. Both pages do their
+// own authentication, so they stay reachable when the rest of the API needs
+// admin credentials:
+//
+//	GET/POST /ui/release                 held jobs of the user signed in with their print credentials
+//	GET/POST /ui/kiosk?printer=<name>    PIN pad releasing all of a user's jobs at printer
+//
+// authenticate checks print credentials; pins may be nil to disable the
+// kiosk.
+func (s *Server) EnableRelease(queue ReleaseQueue, authenticate func(user, password string) bool, pins *auth.PINs) {
+	h := &releaseHandler{
+		server:       s,
+		queue:        queue,
+		authenticate: authenticate,
+		pins:         pins,
+		failures:     make(map[string]*kioskFailures),
+	}
+	s.mux.HandleFunc("/ui/release", h.release)
+	s.public = append(s.public, "/ui/release")
+	if pins != nil {
+		s.mux.HandleFunc("/ui/kiosk", h.kiosk)
+		s.public = append(s.public, "/ui/kiosk")
+	}
+}
+
+type releaseHandler struct {
+	server       *Server
+	queue        ReleaseQueue
+	authenticate func(user, password string) bool
+	pins         *auth.PINs
+
+	mu       sync.Mutex
+	failures map[string]*kioskFailures // client IP -> recent wrong PINs
+}
+
+type kioskFailures struct {
+	count int
+	first time.Time
+}
+
+// releasePageData is rendered by releasePage
+type releasePageData struct {
+	User    string
+	Jobs    []jobs.Job
+	Message string
+	Error   string
+	Clock   clock
+}
+
+func (h *releaseHandler) release(w http.ResponseWriter, r *http.Request) {
+	user, password, ok := r.BasicAuth()
+	if !ok || !h.authenticate(user, password) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="AirPrint Bridge"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data := releasePageData{User: user, Clock: h.server.clock}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		id, err := strconv.Atoi(r.FormValue("job"))
+		if err != nil {
+			data.Error = "invalid job"
+			break
+		}
+		if r.FormValue("action") == "cancel" {
+			err = h.queue.CancelHeldJob(id, user)
+			data.Message = "Job cancelled."
+		} else {
+			err = h.queue.ReleaseJob(id, user, "")
+			data.Message = "Job released, it is printing now."
+		}
+		if err != nil {
+			data.Message, data.Error = "", releaseError(err)
+		}
+	default:
+		h.server.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	data.Jobs = h.queue.HeldJobs(user)
+	h.render(w, releasePage, data)
+}
+
+// kioskPageData is rendered by kioskPage
+type kioskPageData struct {
+	Printer  string
+	Released int
+	User     string
+	Error    string
+}
+
+func (h *releaseHandler) kiosk(w http.ResponseWriter, r *http.Request) {
+	data := kioskPageData{Printer: r.FormValue("printer")}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if h.lockedOut(ip) {
+			data.Error = "Too many wrong PINs, try again in a few minutes."
+			break
+		}
+		user, ok := h.pins.User(r.FormValue("pin"))
+		if !ok {
+			h.recordFailure(ip)
+			data.Error = "Unknown PIN."
+			break
+		}
+		data.User = user
+		for _, job := range h.queue.HeldJobs(user) {
+			if err := h.queue.ReleaseJob(job.ID, user, data.Printer); err != nil {
+				h.server.log.Warn().Err(err).Int("job_id", job.ID).Str("printer", data.Printer).Msg("failed to release job at kiosk")
+				data.Error = releaseError(err)
+				continue
+			}
+			data.Released++
+		}
+	default:
+		h.server.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	h.render(w, kioskPage, data)
+}
+
+// lockedOut reports whether ip has typed too many wrong PINs recently
+func (h *releaseHandler) lockedOut(ip string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.failures[ip]
+	if !ok {
+		return false
+	}
+	if time.Since(f.first) > kioskLockout {
+		delete(h.failures, ip)
+		return false
+	}
+	return f.count >= kioskMaxFailures
+}
+
+func (h *releaseHandler) recordFailure(ip string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.failures[ip]
+	if !ok {
+		f = &kioskFailures{first: time.Now()}
+		h.failures[ip] = f
+	}
+	f.count++
+	if f.count == kioskMaxFailures {
+		h.server.log.Warn().Str("remote", ip).Msg("locking out kiosk client after wrong PINs")
+	}
+}
+
+// releaseError describes a failed release for the page
+func releaseError(err error) string {
+	switch {
+	case errors.Is(err, ipp.ErrNotHeld):
+		return "That job is no longer waiting."
+	case errors.Is(err, ipp.ErrUnknownJob):
+		return "Unknown job."
+	case errors.Is(err, ipp.ErrUnknownPrinter):
+		return "Unknown printer."
+	}
+	return "The print server could not release the job."
+}
+
+func (h *releaseHandler) render(w http.ResponseWriter, page *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := page.Execute(w, data); err != nil {
+		h.server.log.Debug().Err(err).Msg("failed to write release page")
+	}
+}
+
+const releaseStyle = `<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>
+body { font-family: -apple-system, sans-serif; max-width: 32em; margin: 2em auto; padding: 0 1em; }
+table { width: 100%; border-collapse: collapse; }
+td { padding: 0.4em 0; border-bottom: 1px solid #ddd; }
+.pin { font: 2em monospace; width: 6em; text-align: center; }
+.error { color: #b00; }
+</style>`
+
+var releasePage = template.Must(template.New("release").Parse(`<!DOCTYPE html>
+<html>
+<head>
+` + releaseStyle + `
+<title>Release print jobs</title>
+</head>
+<body>
+<h1>Jobs waiting for {{.User}}</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .Jobs}}
+<table>
+{{range .Jobs}}
+<tr>
+<td>{{.Name}}<br><small>{{.Printer}}, {{$.Clock.Short .CreatedAt}}</small></td>
+<td><form method="post"><input type="hidden" name="job" value="{{.ID}}">
+<button name="action" value="release">Print</button>
+<button name="action" value="cancel">Delete</button></form></td>
+</tr>
+{{end}}
+</table>
+{{else}}
+<p>No jobs are waiting.</p>
+{{end}}
+</body>
+</html>
+`))
+
+var kioskPage = template.Must(template.New("kiosk").Parse(`<!DOCTYPE html>
+<html>
+<head>
+` + releaseStyle + `
+{{if or .User .Error}}<meta http-equiv="refresh" content="10;url=?printer={{.Printer}}">{{end}}
+<title>Release print jobs</title>
+</head>
+<body>
+<h1>Release print jobs{{if .Printer}} at {{.Printer}}{{end}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{if .User}}
+<p>{{if .Released}}Printing {{.Released}} job{{if ne .Released 1}}s{{end}} for {{.User}}.{{else}}No jobs are waiting for {{.User}}.{{end}}</p>
+{{else}}
+<form method="post">
+<input type="hidden" name="printer" value="{{.Printer}}">
+<p><input class="pin" name="pin" type="password" inputmode="numeric" autocomplete="off" autofocus placeholder="PIN"></p>
+<p><button type="submit">Release my jobs</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
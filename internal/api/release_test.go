@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// fakeQueue holds jobs in memory and records where they were released
+type fakeQueue struct {
+	held     []jobs.Job
+	released map[int]string // job ID -> printer
+}
+
+func (f *fakeQueue) HeldJobs(user string) []jobs.Job {
+	var held []jobs.Job
+	for _, j := range f.held {
+		if _, done := f.released[j.ID]; !done && j.User == user {
+			held = append(held, j)
+		}
+	}
+	return held
+}
+
+func (f *fakeQueue) ReleaseJob(id int, user, printer string) error {
+	for _, j := range f.HeldJobs(user) {
+		if j.ID == id {
+			f.released[id] = printer
+			return nil
+		}
+	}
+	return ipp.ErrUnknownJob
+}
+
+func (f *fakeQueue) CancelHeldJob(id int, user string) error {
+	return f.ReleaseJob(id, user, "cancelled")
+}
+
+func newReleaseServer(t *testing.T) (*Server, *fakeQueue) {
+	t.Helper()
+	sum := sha256.Sum256([]byte("4711"))
+	pins, err := auth.NewPINs(map[string]string{"alice": hex.EncodeToString(sum[:])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := &fakeQueue{
+		held: []jobs.Job{
+			{ID: 1, User: "alice", Name: "Report", Printer: "Office"},
+			{ID: 2, User: "alice", Name: "Slides", Printer: "Office"},
+			{ID: 3, User: "bob", Name: "Memo", Printer: "Office"},
+		},
+		released: make(map[int]string),
+	}
+	s := NewServer(":0", zerolog.Nop())
+	s.SetAuthenticator(func(user, password string) bool { return user == "admin" && password == "admin" })
+	s.EnableRelease(queue, func(user, password string) bool { return password == user+"-pw" }, pins)
+	return s, queue
+}
+
+func TestRelease_Page(t *testing.T) {
+	s, queue := newReleaseServer(t)
+
+	do := func(user, form string) *httptest.ResponseRecorder {
+		method := http.MethodGet
+		if form != "" {
+			method = http.MethodPost
+		}
+		req := httptest.NewRequest(method, "/ui/release", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if user != "" {
+			req.SetBasicAuth(user, user+"-pw")
+		}
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := do("alice", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Report") || strings.Contains(rec.Body.String(), "Memo") {
+		t.Errorf("page for alice = %d %q, want only her jobs", rec.Code, rec.Body.String())
+	}
+
+	do("alice", "job=1&action=release")
+	if _, ok := queue.released[1]; !ok {
+		t.Error("job 1 not released")
+	}
+	if rec := do("alice", "job=3&action=release"); !strings.Contains(rec.Body.String(), "Unknown job") {
+		t.Error("released another user's job")
+	}
+}
+
+func TestRelease_Kiosk(t *testing.T) {
+	s, queue := newReleaseServer(t)
+
+	post := func(pin string) string {
+		form := url.Values{"pin": {pin}, "printer": {"Lobby"}}
+		req := httptest.NewRequest(http.MethodPost, "/ui/kiosk", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+
+	if body := post("4711"); !strings.Contains(body, "Printing 2 jobs for alice") {
+		t.Errorf("kiosk response = %q", body)
+	}
+	if queue.released[1] != "Lobby" || queue.released[2] != "Lobby" {
+		t.Errorf("released = %v, want both jobs at Lobby", queue.released)
+	}
+	if _, ok := queue.released[3]; ok {
+		t.Error("released another user's job")
+	}
+
+	for i := 0; i < kioskMaxFailures; i++ {
+		post("0000")
+	}
+	if body := post("4711"); !strings.Contains(body, "Too many wrong PINs") {
+		t.Errorf("kiosk not locked after %d wrong PINs", kioskMaxFailures)
+	}
+}
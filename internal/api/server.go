@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/metrics"
+)
+
+// printerPrefix is the path under which per-printer resources are served
+const printerPrefix = "/api/v1/printers/"
+
+// printerHandler serves a resource of a single printer
+type printerHandler func(w http.ResponseWriter, r *http.Request, printer string)
+
+// Server is the bridge's HTTP admin API
+type Server struct {
+	listenAddr string
+	mux        *http.ServeMux
+	printers   map[string]printerHandler // resource name -> handler
+	authorize  func(user, password string) bool
+	token      func(token string) (name string, ok bool)
+	public     []string // Path prefixes that do their own authentication
+	clock      clock
+	log        zerolog.Logger
+
+	listenFunc func(addr string) (net.Listener, error) // Opens the listener, nil for net.Listen
+	mu         sync.Mutex
+	ln         net.Listener
+	srv        *http.Server
+}
+
+// NewServer creates an API server. Endpoints are added by the Enable methods.
+func NewServer(listenAddr string, log zerolog.Logger) *Server {
+	return &Server{
+		listenAddr: listenAddr,
+		mux:        http.NewServeMux(),
+		printers:   make(map[string]printerHandler),
+		log:        log.With().Str("component", "api").Logger(),
+	}
+}
+
+// SetListenFunc sets how the listener is opened, e.g. to take over the
+// socket of a process being replaced. It must be called before Listen.
+func (s *Server) SetListenFunc(fn func(addr string) (net.Listener, error)) {
+	s.listenFunc = fn
+}
+
+// Listen opens the API listener. ListenAndServe calls it if it hasn't been.
+func (s *Server) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln != nil {
+		return nil
+	}
+	listen := s.listenFunc
+	if listen == nil {
+		listen = func(addr string) (net.Listener, error) { return net.Listen("tcp", addr) }
+	}
+	ln, err := listen(s.listenAddr)
+	if err != nil {
+		return err
+	}
+	s.ln = ln
+	return nil
+}
+
+// ListenAndServe starts the API server. It returns nil after Shutdown.
+func (s *Server) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	s.log.Info().Str("addr", s.listenAddr).Msg("starting API server")
+
+	s.mu.Lock()
+	s.srv = &http.Server{Handler: s.handler()}
+	srv, ln := s.srv, s.ln
+	s.mu.Unlock()
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for requests in progress
+// until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.srv
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// SetAuthenticator requires Basic-auth credentials, checked with fn, for
+// every endpoint. It must be called before ListenAndServe.
+func (s *Server) SetAuthenticator(fn func(user, password string) bool) {
+	s.authorize = fn
+}
+
+// SetTokens also accepts bearer tokens, checked with fn, for every
+// endpoint, so scripts can use the API without a user account. It must be
+// called before ListenAndServe.
+func (s *Server) SetTokens(fn func(token string) (name string, ok bool)) {
+	s.token = fn
+}
+
+// handler returns the mux, behind Basic auth if an authenticator is set and
+// bearer tokens if tokens are
+func (s *Server) handler() http.Handler {
+	if s.authorize == nil && s.token == nil {
+		return s.mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range s.public {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				s.mux.ServeHTTP(w, r)
+				return
+			}
+		}
+		if token, ok := bearerToken(r); ok && s.token != nil {
+			if name, ok := s.token(token); ok {
+				s.log.Debug().Str("token", name).Str("path", r.URL.Path).Msg("API request with token")
+				s.mux.ServeHTTP(w, r)
+				return
+			}
+			s.log.Warn().Str("remote", r.RemoteAddr).Msg("rejected API token")
+		}
+		user, password, ok := r.BasicAuth()
+		if ok && s.authorize != nil && s.authorize(user, password) {
+			s.mux.ServeHTTP(w, r)
+			return
+		}
+		if ok {
+			s.log.Warn().Str("user", user).Str("remote", r.RemoteAddr).Msg("rejected API credentials")
+		}
+		if s.authorize != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="AirPrint Bridge Admin"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="AirPrint Bridge Admin"`)
+		}
+		s.writeError(w, http.StatusUnauthorized, "unauthorized")
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// EnableMetrics serves the registry's metrics at /metrics
+func (s *Server) EnableMetrics(registry *metrics.Registry) {
+	s.mux.Handle("/metrics", registry.Handler())
+}
+
+// handlePrinterResource serves h at /api/v1/printers/<name>/<resource>
+func (s *Server) handlePrinterResource(resource string, h printerHandler) {
+	if len(s.printers) == 0 {
+		s.mux.HandleFunc(printerPrefix, s.routePrinter)
+	}
+	s.printers[resource] = h
+}
+
+// routePrinter dispatches a per-printer request to its resource handler
+func (s *Server) routePrinter(w http.ResponseWriter, r *http.Request) {
+	name, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, printerPrefix), "/")
+	h, ok := s.printers[resource]
+	if name == "" || !ok {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	h(w, r, name)
+}
+
+// errorResponse is the body returned for failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON encodes v as the response body
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log.Debug().Err(err).Msg("failed to write response")
+	}
+}
+
+// writeError sends a JSON error body with the given status
+func (s *Server) writeError(w http.ResponseWriter, status int, msg string) {
+	s.writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+)
+
+func TestServer_Authenticator(t *testing.T) {
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableMaintenance(&fakeMaintenance{printers: make(map[string]string)})
+	s.SetAuthenticator(func(user, password string) bool {
+		return user == "admin" && password == "s3cret"
+	})
+
+	tests := []struct {
+		name       string
+		user       string
+		password   string
+		wantStatus int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"wrong password", "admin", "nope", http.StatusUnauthorized},
+		{"valid credentials", "admin", "s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/maintenance", nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			s.handler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestServer_Tokens(t *testing.T) {
+	tokens, err := auth.NewAPITokens(map[string]string{
+		// echo -n home-assistant-token | sha256sum
+		"home-assistant": fmt.Sprintf("%x", sha256.Sum256([]byte("home-assistant-token"))),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authenticator bool
+		header        string
+		basic         bool
+		wantStatus    int
+		wantChallenge string
+	}{
+		{"token", false, "Bearer home-assistant-token", false, http.StatusOK, ""},
+		{"token, any case", false, "bearer home-assistant-token", false, http.StatusOK, ""},
+		{"wrong token", false, "Bearer guess", false, http.StatusUnauthorized, "Bearer"},
+		{"no credentials", false, "", false, http.StatusUnauthorized, "Bearer"},
+		{"basic without providers", false, "", true, http.StatusUnauthorized, "Bearer"},
+		{"token with providers", true, "Bearer home-assistant-token", false, http.StatusOK, ""},
+		{"basic with providers", true, "", true, http.StatusOK, ""},
+		{"wrong token with providers", true, "Bearer guess", false, http.StatusUnauthorized, "Basic"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(":0", zerolog.Nop())
+			s.EnableMaintenance(&fakeMaintenance{printers: make(map[string]string)})
+			s.SetTokens(tokens.Name)
+			if tt.authenticator {
+				s.SetAuthenticator(func(user, password string) bool {
+					return user == "admin" && password == "s3cret"
+				})
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/maintenance", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.basic {
+				req.SetBasicAuth("admin", "s3cret")
+			}
+			rec := httptest.NewRecorder()
+			s.handler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); !strings.HasPrefix(got, tt.wantChallenge) {
+				t.Errorf("challenge = %q, want %s", got, tt.wantChallenge)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// PrinterStats is a quick health overview of one printer
+type PrinterStats struct {
+	JobsToday    int        `json:"jobs_today"`
+	LastJob      *time.Time `json:"last_job,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+	MediaProfile string     `json:"media_profile,omitempty"` // Empty when the media comes from CUPS
+}
+
+// Stats is the overview of every printer served, keyed by name
+type Stats struct {
+	Printers map[string]PrinterStats `json:"printers"`
+}
+
+// StatsSource reports printers' job counts and recent errors
+type StatsSource interface {
+	Stats() Stats
+}
+
+// EnableStats serves each printer's jobs today, last job and last error at
+// GET /api/v1/stats
+func (s *Server) EnableStats(source StatsSource) {
+	s.mux.HandleFunc("/api/v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		in := func(t *time.Time) *time.Time {
+			if t == nil {
+				return nil
+			}
+			local := s.clock.In(*t)
+			return &local
+		}
+		stats := source.Stats()
+		for name, p := range stats.Printers {
+			p.LastJob = in(p.LastJob)
+			p.LastErrorAt = in(p.LastErrorAt)
+			stats.Printers[name] = p
+		}
+		s.writeJSON(w, http.StatusOK, stats)
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type fakeStats struct{}
+
+func (fakeStats) Stats() Stats {
+	last := time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+	return Stats{Printers: map[string]PrinterStats{
+		"Zebra":  {JobsToday: 12, LastJob: &last, MediaProfile: "zebra-4x6"},
+		"Office": {},
+	}}
+}
+
+func TestStats(t *testing.T) {
+	s := NewServer(":0", zerolog.Nop())
+	s.SetTimeDisplay(time.FixedZone("EST", -5*3600), false)
+	s.EnableStats(fakeStats{})
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET stats = %d, want %d", rec.Code, http.StatusOK)
+	}
+	raw := rec.Body.String()
+	if !strings.Contains(raw, `"last_job":"2026-03-02T09:30:00-05:00"`) {
+		t.Errorf("last job not shown in the display zone: %s", raw)
+	}
+	if strings.Contains(raw, `"Office":{"jobs_today":0,"last`) {
+		t.Errorf("unset times shown for a printer without jobs: %s", raw)
+	}
+
+	var got Stats
+	if err := json.Unmarshal([]byte(raw), &got); err != nil {
+		t.Fatal(err)
+	}
+	if z := got.Printers["Zebra"]; z.JobsToday != 12 || z.MediaProfile != "zebra-4x6" {
+		t.Errorf("Zebra = %+v", z)
+	}
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/stats", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST stats = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
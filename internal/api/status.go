@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/metrics"
+)
+
+// Status describes how busy a running bridge is
+type Status struct {
+	StartedAt     time.Time         `json:"started_at"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Resources     metrics.Resources `json:"resources"`
+}
+
+// StatusSource reports the bridge's current resource usage
+type StatusSource interface {
+	Status() Status
+}
+
+// EnableStatus serves connection counts, spool and memory usage and their
+// high-water marks at GET /api/v1/status
+func (s *Server) EnableStatus(source StatusSource) {
+	s.mux.HandleFunc("/api/v1/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		status := source.Status()
+		status.StartedAt = s.clock.In(status.StartedAt)
+		s.writeJSON(w, http.StatusOK, status)
+	})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/metrics"
+)
+
+type fakeStatus struct{}
+
+func (fakeStatus) Status() Status {
+	return Status{
+		UptimeSeconds: 60,
+		Resources:     metrics.Resources{OpenConnections: 4, IdleConnections: 3, PeakHeapBytes: 1 << 20},
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableStatus(fakeStatus{})
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	resources, _ := body["resources"].(map[string]interface{})
+	if resources["open_connections"] != 4.0 || resources["peak_heap_bytes"] != float64(1<<20) {
+		t.Errorf("resources = %v", resources)
+	}
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/status", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
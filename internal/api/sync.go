@@ -0,0 +1,35 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// syncTimeout bounds how long a sync request waits for the printers to be
+// synced
+const syncTimeout = 60 * time.Second
+
+// Syncer re-reads printers from CUPS and updates what is advertised
+type Syncer interface {
+	Sync(ctx context.Context) error
+}
+
+// EnableSync serves POST /api/v1/sync, which syncs printers now instead of
+// at the next poll, e.g. after adding a queue in CUPS. It returns once the
+// sync is done.
+func (s *Server) EnableSync(syncer Syncer) {
+	s.mux.HandleFunc("/api/v1/sync", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), syncTimeout)
+		defer cancel()
+		if err := syncer.Sync(ctx); err != nil {
+			s.writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+type fakeSyncer struct {
+	err   error
+	calls int
+}
+
+func (f *fakeSyncer) Sync(ctx context.Context) error {
+	f.calls++
+	return f.err
+}
+
+func TestSync(t *testing.T) {
+	syncer := &fakeSyncer{}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableSync(syncer)
+
+	do := func(method string) int {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(method, "/api/v1/sync", nil))
+		return rec.Code
+	}
+
+	if code := do(http.MethodPost); code != http.StatusNoContent || syncer.calls != 1 {
+		t.Errorf("POST = %d after %d syncs, want %d after 1", code, syncer.calls, http.StatusNoContent)
+	}
+	syncer.err = errors.New("CUPS unreachable")
+	if code := do(http.MethodPost); code != http.StatusBadGateway {
+		t.Errorf("failed POST status = %d, want %d", code, http.StatusBadGateway)
+	}
+	if code := do(http.MethodGet); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", code, http.StatusMethodNotAllowed)
+	}
+}
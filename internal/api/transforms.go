@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+// TransformController changes printers' job transforms at runtime
+type TransformController interface {
+	SetTransforms(name string, t ipp.Transforms) error
+	ClearTransforms(name string)
+	Transforms(name string) (ipp.Transforms, bool, error)
+}
+
+// transformsResponse is a printer's current transforms
+type transformsResponse struct {
+	Transforms ipp.Transforms `json:"transforms"`
+	Override   bool           `json:"override"` // Set through the API rather than the config file
+}
+
+// EnableTransforms serves control of printers' job transforms, so a
+// printer's pipeline can change without a restart or a config edit:
+//
+//	GET    /api/v1/printers/<name>/transforms   shows the current transforms
+//	PUT    /api/v1/printers/<name>/transforms   replaces them until DELETE or restart
+//	DELETE /api/v1/printers/<name>/transforms   returns to the configured ones
+func (s *Server) EnableTransforms(ctrl TransformController) {
+	s.handlePrinterResource("transforms", func(w http.ResponseWriter, r *http.Request, printer string) {
+		switch r.Method {
+		case http.MethodGet:
+			t, override, err := ctrl.Transforms(printer)
+			if err != nil {
+				s.writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			s.writeJSON(w, http.StatusOK, transformsResponse{Transforms: t, Override: override})
+
+		case http.MethodPut:
+			var t ipp.Transforms
+			dec := json.NewDecoder(io.LimitReader(r.Body, 64<<10))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&t); err != nil {
+				s.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+				return
+			}
+			if err := ctrl.SetTransforms(printer, t); err != nil {
+				switch {
+				case errors.Is(err, ipp.ErrUnknownPrinter):
+					s.writeError(w, http.StatusNotFound, err.Error())
+				case errors.Is(err, ipp.ErrInvalidTransforms):
+					s.writeError(w, http.StatusBadRequest, err.Error())
+				default:
+					s.writeError(w, http.StatusInternalServerError, err.Error())
+				}
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case http.MethodDelete:
+			ctrl.ClearTransforms(printer)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
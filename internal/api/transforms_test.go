@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+type fakeTransforms struct {
+	current  ipp.Transforms
+	override bool
+}
+
+func (f *fakeTransforms) SetTransforms(name string, t ipp.Transforms) error {
+	if name != "Zebra" {
+		return fmt.Errorf("%w: %s", ipp.ErrUnknownPrinter, name)
+	}
+	if t.Scaling == "sideways" {
+		return fmt.Errorf("%w: scaling %q", ipp.ErrInvalidTransforms, t.Scaling)
+	}
+	f.current, f.override = t, true
+	return nil
+}
+
+func (f *fakeTransforms) ClearTransforms(name string) {
+	f.current, f.override = ipp.Transforms{}, false
+}
+
+func (f *fakeTransforms) Transforms(name string) (ipp.Transforms, bool, error) {
+	if name != "Zebra" {
+		return ipp.Transforms{}, false, fmt.Errorf("%w: %s", ipp.ErrUnknownPrinter, name)
+	}
+	return f.current, f.override, nil
+}
+
+func TestTransforms(t *testing.T) {
+	ctrl := &fakeTransforms{}
+	s := NewServer(":0", zerolog.Nop())
+	s.EnableTransforms(ctrl)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPut, "/api/v1/printers/Zebra/transforms", `{"scaling": "fit", "force_scaling": true}`, http.StatusNoContent},
+		{http.MethodPut, "/api/v1/printers/Zebra/transforms", `{"scaling": "sideways"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/printers/Zebra/transforms", `{"rotate": 90}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/printers/Other/transforms", `{}`, http.StatusNotFound},
+		{http.MethodGet, "/api/v1/printers/Other/transforms", "", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/printers/Zebra/transforms", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if rec := do(tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s %s status = %d, want %d", tt.method, tt.path, tt.body, rec.Code, tt.want)
+		}
+	}
+
+	rec := do(http.MethodGet, "/api/v1/printers/Zebra/transforms", "")
+	var got transformsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Override || got.Transforms.Scaling != "fit" || !got.Transforms.ForceScaling {
+		t.Errorf("GET = %+v, want overridden fit scaling", got)
+	}
+
+	if rec := do(http.MethodDelete, "/api/v1/printers/Zebra/transforms", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if ctrl.override {
+		t.Error("transforms still overridden after DELETE")
+	}
+}
@@ -0,0 +1,110 @@
+// Package audit records who printed what through the bridge, one record per
+// Print-Job or Cancel-Job, for admins of shared printers
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Results of an audited request
+const (
+	ResultOK      = "ok"
+	ResultRefused = "refused" // The bridge or CUPS turned it down
+	ResultFailed  = "failed"  // It was accepted but couldn't be carried out
+)
+
+// Record describes one audited request
+type Record struct {
+	Time           time.Time `json:"time"`
+	Operation      string    `json:"operation"` // "Print-Job" or "Cancel-Job"
+	ClientIP       string    `json:"client_ip"`
+	UserAgent      string    `json:"user_agent,omitempty"`
+	User           string    `json:"user,omitempty"`
+	Printer        string    `json:"printer"`
+	JobID          int       `json:"job_id,omitempty"`
+	TraceID        string    `json:"trace_id,omitempty"`
+	DocumentFormat string    `json:"document_format,omitempty"`
+	Bytes          int64     `json:"bytes"` // Document bytes received
+	Result         string    `json:"result"`
+	Status         string    `json:"status,omitempty"` // IPP or HTTP status the client was answered with
+}
+
+// Log writes audit records, as JSON lines to a file of their own or as
+// entries of the main log
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File // nil when records go to the main log
+	log  zerolog.Logger
+	now  func() time.Time
+}
+
+// Open creates a log appending records to the file at path, created
+// readable by its owner and group only
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{w: f, file: f, now: func() time.Time { return time.Now().UTC() }}, nil
+}
+
+// ToLogger creates a log writing records as info entries of log, marked
+// with audit=true
+func ToLogger(log zerolog.Logger) *Log {
+	return &Log{log: log.With().Str("component", "audit").Logger(), now: func() time.Time { return time.Now().UTC() }}
+}
+
+// Record writes r, stamped with the current time if it has none. A nil log
+// records nothing.
+func (l *Log) Record(r Record) {
+	if l == nil {
+		return
+	}
+	if r.Time.IsZero() {
+		r.Time = l.now()
+	}
+
+	if l.w == nil {
+		l.log.Info().
+			Bool("audit", true).
+			Str("operation", r.Operation).
+			Str("client_ip", r.ClientIP).
+			Str("user_agent", r.UserAgent).
+			Str("user", r.User).
+			Str("printer", r.Printer).
+			Int("job_id", r.JobID).
+			Str("trace_id", r.TraceID).
+			Str("document_format", r.DocumentFormat).
+			Int64("bytes", r.Bytes).
+			Str("result", r.Result).
+			Str("status", r.Status).
+			Msg("audit")
+		return
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(line, '\n'))
+}
+
+// Close closes the log's file, if it has one
+func (l *Log) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+	l.now = func() time.Time { return at }
+	l.Record(Record{Operation: "Print-Job", ClientIP: "192.168.1.20", User: "alice", Printer: "Office", JobID: 7, Bytes: 1024, Result: ResultOK})
+	l.Record(Record{Operation: "Cancel-Job", ClientIP: "192.168.1.20", Printer: "Office", JobID: 7, Result: ResultRefused, Status: "client-error-not-possible"})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), data)
+	}
+	var got Record
+	if err := json.Unmarshal([]byte(lines[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := Record{Time: at, Operation: "Print-Job", ClientIP: "192.168.1.20", User: "alice", Printer: "Office", JobID: 7, Bytes: 1024, Result: ResultOK}
+	if got != want {
+		t.Errorf("record = %+v, want %+v", got, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("audit log mode = %v, %v, want 0640", info.Mode().Perm(), err)
+	}
+
+	// Appends rather than truncating
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(Record{Operation: "Print-Job", Printer: "Office", Result: ResultFailed})
+	l.Close()
+	data, _ = os.ReadFile(path)
+	if n := strings.Count(string(data), "\n"); n != 3 {
+		t.Errorf("got %d lines after reopening, want 3", n)
+	}
+}
+
+func TestToLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := ToLogger(zerolog.New(&buf))
+	l.Record(Record{Operation: "Print-Job", ClientIP: "10.0.0.5", Printer: "Zebra", Result: ResultOK})
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry %q: %v", buf.String(), err)
+	}
+	if entry["audit"] != true || entry["printer"] != "Zebra" || entry["client_ip"] != "10.0.0.5" || entry["result"] != "ok" {
+		t.Errorf("log entry = %v", entry)
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	l.Record(Record{Operation: "Print-Job"})
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GroupResolver looks up the groups a user belongs to
+type GroupResolver interface {
+	Groups(user string) ([]string, error)
+}
+
+// AccessRule lists who may print to a printer. A user is allowed if named
+// in Users or a member of one of Groups.
+type AccessRule struct {
+	Users  []string
+	Groups []string
+	Guests bool // Also allow guest tokens
+}
+
+// Access decides who may print to which printer. Printers without a rule
+// are open to every authenticated user.
+type Access struct {
+	rules  map[string]AccessRule // printer name -> rule
+	groups GroupResolver         // nil when no rule names groups
+}
+
+// NewAccess creates an access policy. groups may be nil if no rule uses
+// groups.
+func NewAccess(rules map[string]AccessRule, groups GroupResolver) (*Access, error) {
+	for printer, rule := range rules {
+		if len(rule.Groups) > 0 && groups == nil {
+			return nil, fmt.Errorf("access rule for %s names groups but no group provider is configured", printer)
+		}
+	}
+	return &Access{rules: rules, groups: groups}, nil
+}
+
+// Allowed reports whether user may print to printer. guest is set when the
+// user signed in with a guest token, whose user name is unverified.
+func (a *Access) Allowed(printer, user string, guest bool) (bool, error) {
+	rule, ok := a.rules[printer]
+	if !ok {
+		return true, nil
+	}
+	if guest {
+		return rule.Guests, nil
+	}
+	for _, u := range rule.Users {
+		if u == user {
+			return true, nil
+		}
+	}
+	if len(rule.Groups) == 0 {
+		return false, nil
+	}
+
+	groups, err := a.groups.Groups(user)
+	if err != nil {
+		return false, err
+	}
+	for _, want := range rule.Groups {
+		for _, g := range groups {
+			// Directory group names are case-insensitive
+			if strings.EqualFold(g, want) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// GroupCache remembers group lookups so a directory isn't queried for every
+// job. When a refresh fails the expired entry is used until the directory
+// answers again.
+type GroupCache struct {
+	resolver GroupResolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]groupEntry // user name -> groups
+	now     func() time.Time
+}
+
+type groupEntry struct {
+	groups  []string
+	fetched time.Time
+}
+
+// NewGroupCache caches the lookups of resolver for ttl
+func NewGroupCache(resolver GroupResolver, ttl time.Duration) *GroupCache {
+	return &GroupCache{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]groupEntry),
+		now:      time.Now,
+	}
+}
+
+// Groups returns the user's groups, from the cache if fresh enough
+func (c *GroupCache) Groups(user string) ([]string, error) {
+	c.mu.Lock()
+	entry, cached := c.entries[user]
+	c.mu.Unlock()
+	if cached && c.now().Sub(entry.fetched) < c.ttl {
+		return entry.groups, nil
+	}
+
+	groups, err := c.resolver.Groups(user)
+	if err != nil {
+		if cached {
+			return entry.groups, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[user] = groupEntry{groups: groups, fetched: c.now()}
+	c.mu.Unlock()
+	return groups, nil
+}
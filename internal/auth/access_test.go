@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeGroups resolves groups from a map and counts lookups
+type fakeGroups struct {
+	groups  map[string][]string
+	err     error
+	lookups int
+}
+
+func (f *fakeGroups) Groups(user string) ([]string, error) {
+	f.lookups++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.groups[user], nil
+}
+
+func TestAccess(t *testing.T) {
+	groups := &fakeGroups{groups: map[string][]string{
+		"alice": {"Finance", "Staff"},
+		"bob":   {"Staff"},
+	}}
+	a, err := NewAccess(map[string]AccessRule{
+		"Finance-Laser": {Users: []string{"carol"}, Groups: []string{"finance"}},
+		"Lobby":         {Groups: []string{"Staff"}, Guests: true},
+	}, groups)
+	if err != nil {
+		t.Fatalf("NewAccess() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		printer string
+		user    string
+		guest   bool
+		want    bool
+	}{
+		{"printer without rule", "Office", "bob", false, true},
+		{"member of group", "Finance-Laser", "alice", false, true},
+		{"not a member", "Finance-Laser", "bob", false, false},
+		{"listed user", "Finance-Laser", "carol", false, true},
+		{"guest not allowed", "Finance-Laser", "alice", true, false},
+		{"guest allowed", "Lobby", "visitor", true, true},
+		{"unknown user", "Lobby", "mallory", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Allowed(tt.printer, tt.user, tt.guest)
+			if err != nil {
+				t.Fatalf("Allowed() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Allowed(%q, %q, %v) = %v, want %v", tt.printer, tt.user, tt.guest, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAccess_GroupsNeedResolver(t *testing.T) {
+	if _, err := NewAccess(map[string]AccessRule{"Office": {Groups: []string{"Staff"}}}, nil); err == nil {
+		t.Error("expected error for group rule without a resolver")
+	}
+	if _, err := NewAccess(map[string]AccessRule{"Office": {Users: []string{"alice"}}}, nil); err != nil {
+		t.Errorf("NewAccess() error = %v for user-only rule", err)
+	}
+}
+
+func TestGroupCache(t *testing.T) {
+	resolver := &fakeGroups{groups: map[string][]string{"alice": {"Finance"}}}
+	c := NewGroupCache(resolver, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if groups, err := c.Groups("alice"); err != nil || len(groups) != 1 {
+			t.Fatalf("Groups() = %v, %v", groups, err)
+		}
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("lookups = %d, want 1 while cached", resolver.lookups)
+	}
+
+	// An expired entry is still used while the directory is unreachable
+	now = now.Add(2 * time.Minute)
+	resolver.err = errors.New("connection refused")
+	if groups, err := c.Groups("alice"); err != nil || len(groups) != 1 {
+		t.Errorf("Groups() with directory down = %v, %v, want stale entry", groups, err)
+	}
+	if resolver.lookups != 2 {
+		t.Errorf("lookups = %d, want a refresh attempt after expiry", resolver.lookups)
+	}
+
+	if _, err := c.Groups("bob"); err == nil {
+		t.Error("expected error for uncached user with directory down")
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APITokens are long-lived bearer tokens for scripts and home automation
+// using the admin API, where a user account would be out of place
+type APITokens struct {
+	hashes map[string][]byte // token name -> SHA-256 of the token
+}
+
+// NewAPITokens creates a token store from a map of token name to
+// hex-encoded SHA-256 token hash
+func NewAPITokens(tokens map[string]string) (*APITokens, error) {
+	t := &APITokens{hashes: make(map[string][]byte, len(tokens))}
+	for name, hash := range tokens {
+		sum, err := hex.DecodeString(strings.ToLower(strings.TrimSpace(hash)))
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid hash for API token %q: expected 64 hex digits", name)
+		}
+		t.hashes[name] = sum
+	}
+	return t, nil
+}
+
+// Name returns the name of the token given, if it is one of them
+func (t *APITokens) Name(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(token))
+	for name, want := range t.hashes {
+		if subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
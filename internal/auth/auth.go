@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Authenticator checks Basic-auth credentials against a chain of providers
+// and, optionally, guest tokens
+type Authenticator struct {
+	providers []Provider
+	guests    *GuestTokens
+	log       zerolog.Logger
+}
+
+// NewAuthenticator creates an authenticator that asks providers in order.
+// guests may be nil to disable tokens.
+func NewAuthenticator(providers []Provider, guests *GuestTokens, log zerolog.Logger) *Authenticator {
+	return &Authenticator{
+		providers: providers,
+		guests:    guests,
+		log:       log.With().Str("component", "auth").Logger(),
+	}
+}
+
+// Authenticate reports whether a provider accepts the credentials or they
+// carry a valid guest token
+func (a *Authenticator) Authenticate(user, password string) bool {
+	ok, _ := a.Check(user, password)
+	return ok
+}
+
+// Check reports whether the credentials are accepted and, if so, whether
+// only as a guest token. Guests may use any user name. A provider that fails
+// is logged and skipped, so an unreachable directory doesn't lock out users
+// known to the others.
+func (a *Authenticator) Check(user, password string) (ok, guest bool) {
+	if user != "" && password != "" {
+		for _, p := range a.providers {
+			ok, err := p.Authenticate(user, password)
+			if err != nil {
+				a.log.Warn().Err(err).Str("provider", p.Name()).Str("user", user).Msg("auth provider failed")
+				continue
+			}
+			if ok {
+				return true, false
+			}
+		}
+	}
+	if a.guests != nil && a.guests.Valid(password) {
+		return true, true
+	}
+	return false, false
+}
+
+// Guests returns the guest token store, or nil if tokens are disabled
+func (a *Authenticator) Guests() *GuestTokens {
+	return a.guests
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuthenticator(t *testing.T) {
+	guests := NewGuestTokens(0)
+	token, err := guests.Mint(time.Hour, "")
+	if err != nil {
+		t.Fatalf("Mint() error = %v", err)
+	}
+
+	static, err := NewStatic("users", map[string]string{"alice": hashPassword("s3cret")})
+	if err != nil {
+		t.Fatalf("NewStatic() error = %v", err)
+	}
+	a := NewAuthenticator([]Provider{failingProvider{}, static}, guests, zerolog.Nop())
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     bool
+	}{
+		{"trusted user", "alice", "s3cret", true},
+		{"wrong password", "alice", "nope", false},
+		{"unknown user", "bob", "s3cret", false},
+		{"guest token", "visitor", token.Value, true},
+		{"guest token typed loosely", "visitor", strings.ToUpper(strings.ReplaceAll(token.Value, "-", " ")), true},
+		{"empty password", "visitor", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Authenticate(tt.user, tt.password); got != tt.want {
+				t.Errorf("Authenticate(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+// failingProvider stands in for an unreachable directory
+type failingProvider struct{}
+
+func (failingProvider) Name() string { return "down" }
+
+func (failingProvider) Authenticate(user, password string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestNewStatic_InvalidHash(t *testing.T) {
+	if _, err := NewStatic("users", map[string]string{"alice": "plaintext"}); err == nil {
+		t.Error("expected error for non-hex password hash")
+	}
+}
+
+func TestGuestTokens_Expiry(t *testing.T) {
+	g := NewGuestTokens(0)
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	short, _ := g.Mint(time.Minute, "short")
+	long, _ := g.Mint(time.Hour, "long")
+
+	if !regexp.MustCompile(`^[a-z2-9]{4}-[a-z2-9]{4}-[a-z2-9]{4}$`).MatchString(short.Value) {
+		t.Errorf("token %q has unexpected format", short.Value)
+	}
+
+	list := g.List()
+	if len(list) != 2 || list[0].Note != "short" {
+		t.Fatalf("List() = %+v, want short then long", list)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if g.Valid(short.Value) {
+		t.Error("expired token is still valid")
+	}
+	if !g.Valid(long.Value) {
+		t.Error("unexpired token is not valid")
+	}
+	if got := len(g.List()); got != 1 {
+		t.Errorf("List() has %d tokens, want 1", got)
+	}
+
+	if !g.Revoke(long.Value) || g.Valid(long.Value) {
+		t.Error("revoked token is still valid")
+	}
+}
+
+func TestGuestTokens_MaxTTL(t *testing.T) {
+	g := NewGuestTokens(24 * time.Hour)
+	if _, err := g.Mint(48*time.Hour, ""); err == nil {
+		t.Error("expected error for lifetime above maximum")
+	}
+	if _, err := g.Mint(0, ""); err == nil {
+		t.Error("expected error for zero lifetime")
+	}
+}
+
+func TestPINs(t *testing.T) {
+	p, err := NewPINs(map[string]string{"alice": hashPassword("4711"), "bob": hashPassword("0815")})
+	if err != nil {
+		t.Fatalf("NewPINs() error = %v", err)
+	}
+	if user, ok := p.User("4711"); !ok || user != "alice" {
+		t.Errorf("User(4711) = %q, %v, want alice", user, ok)
+	}
+	if user, ok := p.User(" 0815 "); !ok || user != "bob" {
+		t.Errorf("User(0815) = %q, %v, want bob", user, ok)
+	}
+	if _, ok := p.User("1234"); ok {
+		t.Error("unknown PIN accepted")
+	}
+
+	if _, err := NewPINs(map[string]string{"alice": hashPassword("1111"), "bob": hashPassword("1111")}); err == nil {
+		t.Error("expected error for shared PIN")
+	}
+}
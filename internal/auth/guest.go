@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenAlphabet leaves out characters that are easy to confuse when a token
+// is typed from a printout (0/o, 1/l/i)
+const tokenAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// tokenGroups and tokenGroupLen shape tokens like "k7dm-q3xa-9fpe"
+const (
+	tokenGroups   = 3
+	tokenGroupLen = 4
+)
+
+// Token is a time-limited guest credential
+type Token struct {
+	Value   string    `json:"token"`
+	Note    string    `json:"note,omitempty"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// GuestTokens stores guest print tokens. Tokens are used as the Basic-auth
+// password and expire after the lifetime they were minted with.
+type GuestTokens struct {
+	maxTTL time.Duration
+
+	mu     sync.Mutex
+	tokens map[string]Token // normalized value -> token
+	now    func() time.Time
+}
+
+// NewGuestTokens creates an empty token store. Tokens are never valid for
+// longer than maxTTL, or without limit when maxTTL is zero.
+func NewGuestTokens(maxTTL time.Duration) *GuestTokens {
+	return &GuestTokens{
+		maxTTL: maxTTL,
+		tokens: make(map[string]Token),
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Mint creates a token valid for ttl
+func (g *GuestTokens) Mint(ttl time.Duration, note string) (Token, error) {
+	if ttl <= 0 {
+		return Token{}, fmt.Errorf("token lifetime must be positive")
+	}
+	if g.maxTTL > 0 && ttl > g.maxTTL {
+		return Token{}, fmt.Errorf("token lifetime %s exceeds maximum of %s", ttl, g.maxTTL)
+	}
+
+	value, err := newTokenValue()
+	if err != nil {
+		return Token{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	token := Token{
+		Value:   value,
+		Note:    note,
+		Created: now,
+		Expires: now.Add(ttl),
+	}
+	g.tokens[normalizeToken(value)] = token
+	return token, nil
+}
+
+// Valid reports whether value is an unexpired token. Case, spaces and
+// dashes are ignored, since guests type tokens by hand.
+func (g *GuestTokens) Valid(value string) bool {
+	key := normalizeToken(value)
+	if key == "" {
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	token, ok := g.tokens[key]
+	if !ok {
+		return false
+	}
+	if !g.now().Before(token.Expires) {
+		delete(g.tokens, key)
+		return false
+	}
+	return true
+}
+
+// Revoke removes a token before it expires. It reports whether the token
+// existed.
+func (g *GuestTokens) Revoke(value string) bool {
+	key := normalizeToken(value)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	_, ok := g.tokens[key]
+	delete(g.tokens, key)
+	return ok
+}
+
+// List returns the unexpired tokens, soonest to expire first
+func (g *GuestTokens) List() []Token {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	result := make([]Token, 0, len(g.tokens))
+	for key, token := range g.tokens {
+		if !now.Before(token.Expires) {
+			delete(g.tokens, key)
+			continue
+		}
+		result = append(result, token)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Expires.Before(result[j].Expires)
+	})
+	return result
+}
+
+// newTokenValue returns a random token in dash-separated groups
+func newTokenValue() (string, error) {
+	raw := make([]byte, tokenGroups*tokenGroupLen)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	var b strings.Builder
+	for i, r := range raw {
+		if i > 0 && i%tokenGroupLen == 0 {
+			b.WriteByte('-')
+		}
+		// The modulo bias over a 31-character alphabet is negligible here
+		b.WriteByte(tokenAlphabet[int(r)%len(tokenAlphabet)])
+	}
+	return b.String(), nil
+}
+
+// normalizeToken strips the separators and case a guest may have typed
+func normalizeToken(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '-' || r == ' ':
+			return -1
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return r
+	}, value)
+}
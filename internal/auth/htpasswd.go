@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd authenticates against an Apache htpasswd file. bcrypt, MD5
+// ($apr1$) and SHA-1 ({SHA}) hashes are supported. The file is re-read when
+// it changes, so users can be managed with htpasswd(1) without a restart.
+type Htpasswd struct {
+	name string
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	hashes  map[string]string // user name -> hash
+}
+
+// NewHtpasswd loads the htpasswd file at path
+func NewHtpasswd(name, path string) (*Htpasswd, error) {
+	if path == "" {
+		return nil, fmt.Errorf("htpasswd provider %q needs a file", name)
+	}
+	h := &Htpasswd{name: name, path: path}
+	if err := h.reload(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Name returns the provider's name
+func (h *Htpasswd) Name() string {
+	return h.name
+}
+
+// Authenticate reports whether password matches the user's entry
+func (h *Htpasswd) Authenticate(user, password string) (bool, error) {
+	if err := h.reload(); err != nil {
+		return false, err
+	}
+	h.mu.Lock()
+	hash, ok := h.hashes[user]
+	h.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return checkHtpasswdHash(hash, password), nil
+}
+
+// reload re-reads the file if it changed since it was last read
+func (h *Htpasswd) reload() error {
+	info, err := os.Stat(h.path)
+	if err != nil {
+		return fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hashes != nil && info.ModTime().Equal(h.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(h.path)
+	if err != nil {
+		return fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+	hashes, err := parseHtpasswd(data)
+	if err != nil {
+		return fmt.Errorf("invalid htpasswd file %s: %w", h.path, err)
+	}
+	h.hashes = hashes
+	h.modTime = info.ModTime()
+	return nil
+}
+
+// parseHtpasswd parses "user:hash" lines, skipping blanks and comments
+func parseHtpasswd(data []byte) (map[string]string, error) {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", n)
+		}
+		if !supportedHtpasswdHash(hash) {
+			return nil, fmt.Errorf("line %d: unsupported hash for user %q, use bcrypt (htpasswd -B)", n, user)
+		}
+		hashes[user] = hash
+	}
+	return hashes, scanner.Err()
+}
+
+func supportedHtpasswdHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$apr1$", "{SHA}"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHtpasswdHash reports whether password matches an htpasswd hash
+func checkHtpasswdHash(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		return subtle.ConstantTimeCompare([]byte(apr1(password, salt)), []byte(hash)) == 1
+
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		want := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(want), []byte(hash)) == 1
+
+	default:
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+}
+
+// apr1Alphabet is the base64 variant used by MD5 crypt
+const apr1Alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1 computes Apache's MD5 crypt of password with salt
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	ctx := md5.New()
+	ctx.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			ctx.Write(alt[:])
+		} else {
+			ctx.Write(alt[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	sum := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		ctx := md5.New()
+		if i&1 == 1 {
+			ctx.Write(pw)
+		} else {
+			ctx.Write(sum)
+		}
+		if i%3 != 0 {
+			ctx.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			ctx.Write(pw)
+		}
+		if i&1 == 1 {
+			ctx.Write(sum)
+		} else {
+			ctx.Write(pw)
+		}
+		sum = ctx.Sum(nil)
+	}
+
+	var out []byte
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			out = append(out, apr1Alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(sum[0], sum[6], sum[12], 4)
+	encode(sum[1], sum[7], sum[13], 4)
+	encode(sum[2], sum[8], sum[14], 4)
+	encode(sum[3], sum[9], sum[15], 4)
+	encode(sum[4], sum[10], sum[5], 4)
+	encode(0, 0, sum[11], 2)
+	return magic + salt + "$" + string(out)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHtpasswd(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword() error = %v", err)
+	}
+	sha := sha1.Sum([]byte("hunter2"))
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# print users\n" +
+		"alice:" + string(bcryptHash) + "\n" +
+		"bob:{SHA}" + base64.StdEncoding.EncodeToString(sha[:]) + "\n" +
+		"\n" +
+		"myName:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHtpasswd("local", path)
+	if err != nil {
+		t.Fatalf("NewHtpasswd() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     bool
+	}{
+		{"bcrypt", "alice", "s3cret", true},
+		{"bcrypt wrong password", "alice", "s3cre", false},
+		{"sha1", "bob", "hunter2", true},
+		{"sha1 wrong password", "bob", "hunter3", false},
+		{"apr1", "myName", "myPassword", true},
+		{"apr1 wrong password", "myName", "mypassword", false},
+		{"unknown user", "carol", "s3cret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.Authenticate(tt.user, tt.password)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Authenticate(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+			}
+		})
+	}
+
+	// Users added to the file are picked up without recreating the provider
+	content += "carol:" + string(bcryptHash) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := h.Authenticate("carol", "s3cret"); err != nil || !ok {
+		t.Errorf("Authenticate() after edit = %v, %v, want true", ok, err)
+	}
+}
+
+func TestParseHtpasswd_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no colon", "alice\n"},
+		{"crypt hash", "alice:rl4xvZLUGg3Ls\n"},
+		{"plain text", "alice:secret\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseHtpasswd([]byte(tt.content)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
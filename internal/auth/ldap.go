@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// defaultLDAPTimeout bounds each connection to the directory
+const defaultLDAPTimeout = 10 * time.Second
+
+// LDAPConfig configures an LDAP or Active Directory provider
+type LDAPConfig struct {
+	URL          string // ldap:// or ldaps://
+	StartTLS     bool   // Upgrade ldap:// connections with StartTLS
+	CAFile       string // PEM CA certificates to trust instead of the system pool
+	BindDN       string // Service account used to look users up; empty binds anonymously
+	BindPassword string
+	BaseDN       string // Where users are searched for
+	UserFilter   string // Search filter, %s is the user name; default "(uid=%s)"
+	UserDN       string // Bind directly as this DN instead of searching, e.g. "%s@corp.example.com"
+	GroupFilter  string // Finds a user's groups, with {user} and {dn} replaced; default reads memberOf
+	Timeout      time.Duration
+}
+
+// LDAP authenticates users by binding to a directory as them. The user's DN
+// is found with a search, or built from UserDN.
+type LDAP struct {
+	name   string
+	config LDAPConfig
+	tls    *tls.Config
+}
+
+// NewLDAP creates an LDAP provider. The directory isn't contacted until the
+// first login.
+func NewLDAP(name string, config LDAPConfig) (*LDAP, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("ldap provider %q needs a url", name)
+	}
+	if config.UserDN == "" && config.BaseDN == "" {
+		return nil, fmt.Errorf("ldap provider %q needs a base_dn or user_dn", name)
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultLDAPTimeout
+	}
+
+	l := &LDAP{name: name, config: config}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ldap CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		l.tls = &tls.Config{RootCAs: pool}
+	}
+	return l, nil
+}
+
+// Name returns the provider's name
+func (l *LDAP) Name() string {
+	return l.name
+}
+
+// Authenticate binds as the user with password
+func (l *LDAP) Authenticate(user, password string) (bool, error) {
+	// An empty password is an unauthenticated bind, which many directories
+	// accept for any DN
+	if password == "" {
+		return false, nil
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	dn, err := l.userDN(conn, user)
+	if err != nil || dn == "" {
+		return false, err
+	}
+	if err := conn.Bind(dn, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to bind as %s: %w", dn, err)
+	}
+	return true, nil
+}
+
+// dial connects to the directory, upgrading to TLS if configured
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	opts := []ldap.DialOpt{ldap.DialWithDialer(&net.Dialer{Timeout: l.config.Timeout})}
+	if l.tls != nil {
+		opts = append(opts, ldap.DialWithTLSConfig(l.tlsConfig()))
+	}
+	conn, err := ldap.DialURL(l.config.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", l.config.URL, err)
+	}
+	conn.SetTimeout(l.config.Timeout)
+
+	if l.config.StartTLS {
+		if err := conn.StartTLS(l.tlsConfig()); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS with %s: %w", l.config.URL, err)
+		}
+	}
+	return conn, nil
+}
+
+// tlsConfig returns the TLS settings for the server in the URL
+func (l *LDAP) tlsConfig() *tls.Config {
+	cfg := &tls.Config{}
+	if l.tls != nil {
+		cfg = l.tls.Clone()
+	}
+	if host := urlHost(l.config.URL); host != "" {
+		cfg.ServerName = host
+	}
+	return cfg
+}
+
+// userDN finds the DN to bind as for user, or "" if there is no such user
+func (l *LDAP) userDN(conn *ldap.Conn, user string) (string, error) {
+	if l.config.UserDN != "" {
+		return fmt.Sprintf(l.config.UserDN, escapeDN(user)), nil
+	}
+	entry, err := l.findUser(conn, user)
+	if err != nil || entry == nil {
+		return "", err
+	}
+	return entry.DN, nil
+}
+
+// findUser binds as the service account, if any, and searches for user's
+// entry. It returns nil if there is no single match.
+func (l *LDAP) findUser(conn *ldap.Conn, user string, attributes ...string) (*ldap.Entry, error) {
+	if l.config.BindDN != "" {
+		if err := conn.Bind(l.config.BindDN, l.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind as %s: %w", l.config.BindDN, err)
+		}
+	}
+	result, err := l.search(conn, fmt.Sprintf(l.config.UserFilter, ldap.EscapeFilter(user)), append([]string{"dn"}, attributes...), 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up user %s: %w", user, err)
+	}
+	// Refuse ambiguous matches rather than pick one
+	if len(result.Entries) != 1 {
+		return nil, nil
+	}
+	return result.Entries[0], nil
+}
+
+// Groups returns the names of the groups user is a member of: the CN of
+// each memberOf value of the user's entry, or the cn of the entries matching
+// GroupFilter
+func (l *LDAP) Groups(user string) ([]string, error) {
+	if l.config.BaseDN == "" {
+		return nil, fmt.Errorf("ldap provider %q needs a base_dn to look up groups", l.name)
+	}
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := l.findUser(conn, user, "memberOf")
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	var groups []string
+	if l.config.GroupFilter == "" {
+		for _, dn := range entry.GetAttributeValues("memberOf") {
+			if name := groupName(dn); name != "" {
+				groups = append(groups, name)
+			}
+		}
+		return groups, nil
+	}
+
+	filter := strings.NewReplacer("{user}", ldap.EscapeFilter(user), "{dn}", ldap.EscapeFilter(entry.DN)).Replace(l.config.GroupFilter)
+	result, err := l.search(conn, filter, []string{"cn"}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up groups of %s: %w", user, err)
+	}
+	for _, e := range result.Entries {
+		if name := e.GetAttributeValue("cn"); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return groups, nil
+}
+
+// search runs a subtree search under the base DN
+func (l *LDAP) search(conn *ldap.Conn, filter string, attributes []string, limit int) (*ldap.SearchResult, error) {
+	return conn.Search(ldap.NewSearchRequest(
+		l.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, limit, int(l.config.Timeout.Seconds()), false,
+		filter, attributes, nil,
+	))
+}
+
+// groupName returns the CN of a group DN such as
+// "CN=Finance,OU=Groups,DC=corp,DC=example,DC=com"
+func groupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// urlHost returns the host name in an LDAP URL
+func urlHost(url string) string {
+	_, rest, ok := strings.Cut(url, "://")
+	if !ok {
+		return ""
+	}
+	rest, _, _ = strings.Cut(rest, "/")
+	if host, _, err := net.SplitHostPort(rest); err == nil {
+		return host
+	}
+	return rest
+}
+
+// escapeDN escapes the characters with special meaning in a DN value
+func escapeDN(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			r == '#' && i == 0,
+			r == ' ' && (i == 0 || i == len(s)-1):
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package auth
+
+import "testing"
+
+func TestEscapeDN(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice", "alice"},
+		{"smith, john", `smith\, john`},
+		{"a+b=c", `a\+b\=c`},
+		{"#admin", `\#admin`},
+		{" padded ", `\ padded\ `},
+	}
+	for _, tt := range tests {
+		if got := escapeDN(tt.in); got != tt.want {
+			t.Errorf("escapeDN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestURLHost(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ldaps://dc1.corp.example.com", "dc1.corp.example.com"},
+		{"ldap://ldap.example.com:389/", "ldap.example.com"},
+		{"dc1", ""},
+	}
+	for _, tt := range tests {
+		if got := urlHost(tt.in); got != tt.want {
+			t.Errorf("urlHost(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewLDAP_Validation(t *testing.T) {
+	if _, err := NewLDAP("dir", LDAPConfig{BaseDN: "dc=example,dc=com"}); err == nil {
+		t.Error("expected error without url")
+	}
+	if _, err := NewLDAP("dir", LDAPConfig{URL: "ldap://localhost"}); err == nil {
+		t.Error("expected error without base_dn or user_dn")
+	}
+	l, err := NewLDAP("dir", LDAPConfig{URL: "ldap://localhost", BaseDN: "dc=example,dc=com"})
+	if err != nil {
+		t.Fatalf("NewLDAP() error = %v", err)
+	}
+	if ok, err := l.Authenticate("alice", ""); ok || err != nil {
+		t.Errorf("Authenticate() with empty password = %v, %v, want false without contacting the server", ok, err)
+	}
+}
+
+func TestGroupName(t *testing.T) {
+	tests := []struct {
+		dn, want string
+	}{
+		{"CN=Finance,OU=Groups,DC=corp,DC=example,DC=com", "Finance"},
+		{"cn=print\\, color,ou=groups,dc=example,dc=com", "print, color"},
+		{"OU=Groups,DC=corp,DC=example,DC=com", ""},
+		{"not a dn", ""},
+	}
+	for _, tt := range tests {
+		if got := groupName(tt.dn); got != tt.want {
+			t.Errorf("groupName(%q) = %q, want %q", tt.dn, got, tt.want)
+		}
+	}
+}
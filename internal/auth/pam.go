@@ -0,0 +1,91 @@
+//go:build pam && cgo
+
+package auth
+
+/*
+#cgo LDFLAGS: -lpam
+#include <security/pam_appl.h>
+#include <stdlib.h>
+#include <string.h>
+
+// conv answers every prompt with the password passed as appdata
+static int conv(int n, const struct pam_message **msg, struct pam_response **resp, void *data) {
+	struct pam_response *r = calloc(n, sizeof(struct pam_response));
+	if (r == NULL) {
+		return PAM_BUF_ERR;
+	}
+	for (int i = 0; i < n; i++) {
+		if (msg[i]->msg_style == PAM_PROMPT_ECHO_OFF || msg[i]->msg_style == PAM_PROMPT_ECHO_ON) {
+			r[i].resp = strdup((const char *)data);
+		}
+	}
+	*resp = r;
+	return PAM_SUCCESS;
+}
+
+static int check(const char *service, const char *user, const char *password) {
+	struct pam_conv c = { conv, (void *)password };
+	pam_handle_t *h = NULL;
+	int rc = pam_start(service, user, &c, &h);
+	if (rc != PAM_SUCCESS) {
+		return rc;
+	}
+	rc = pam_authenticate(h, PAM_SILENT | PAM_DISALLOW_NULL_AUTHTOK);
+	if (rc == PAM_SUCCESS) {
+		rc = pam_acct_mgmt(h, PAM_SILENT);
+	}
+	pam_end(h, rc);
+	return rc;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// PAM authenticates against the host's PAM stack, so print users can be
+// the system's own accounts, or whatever PAM is configured to consult
+type PAM struct {
+	name    string
+	service string
+	mu      sync.Mutex // Not every PAM module is thread-safe
+}
+
+// NewPAM creates a provider using the PAM service, "login" if empty
+func NewPAM(name, service string) (Provider, error) {
+	if service == "" {
+		service = "login"
+	}
+	return &PAM{name: name, service: service}, nil
+}
+
+// Name returns the provider's name
+func (p *PAM) Name() string {
+	return p.name
+}
+
+// Authenticate runs the service's auth and account stacks for user
+func (p *PAM) Authenticate(user, password string) (bool, error) {
+	cService := C.CString(p.service)
+	cUser := C.CString(user)
+	cPassword := C.CString(password)
+	defer C.free(unsafe.Pointer(cService))
+	defer C.free(unsafe.Pointer(cUser))
+	defer C.free(unsafe.Pointer(cPassword))
+
+	p.mu.Lock()
+	rc := C.check(cService, cUser, cPassword)
+	p.mu.Unlock()
+
+	switch rc {
+	case C.PAM_SUCCESS:
+		return true, nil
+	case C.PAM_AUTH_ERR, C.PAM_USER_UNKNOWN, C.PAM_MAXTRIES, C.PAM_CRED_INSUFFICIENT,
+		C.PAM_ACCT_EXPIRED, C.PAM_PERM_DENIED, C.PAM_NEW_AUTHTOK_REQD:
+		return false, nil
+	}
+	return false, fmt.Errorf("pam service %s failed with code %d", p.service, int(rc))
+}
@@ -0,0 +1,11 @@
+//go:build !pam || !cgo
+
+package auth
+
+import "fmt"
+
+// NewPAM fails in builds without PAM support, which needs cgo and the PAM
+// headers: go build -tags pam
+func NewPAM(name, service string) (Provider, error) {
+	return nil, fmt.Errorf("pam provider %q: built without PAM support (rebuild with -tags pam)", name)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// PINs identifies users by short PINs typed at a release kiosk, where a
+// full password is impractical
+type PINs struct {
+	hashes map[string][]byte // user name -> SHA-256 of the PIN
+}
+
+// NewPINs creates a PIN store from a map of user name to hex-encoded
+// SHA-256 PIN hash. Every user needs a different PIN.
+func NewPINs(pins map[string]string) (*PINs, error) {
+	p := &PINs{hashes: make(map[string][]byte, len(pins))}
+	seen := make(map[string]string)
+	for user, hash := range pins {
+		hash = strings.ToLower(strings.TrimSpace(hash))
+		sum, err := hex.DecodeString(hash)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid PIN hash for user %q: expected 64 hex digits", user)
+		}
+		if other, ok := seen[hash]; ok {
+			return nil, fmt.Errorf("users %q and %q have the same PIN", other, user)
+		}
+		seen[hash] = user
+		p.hashes[user] = sum
+	}
+	return p, nil
+}
+
+// User returns the user whose PIN was typed
+func (p *PINs) User(pin string) (string, bool) {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(pin)))
+	for user, want := range p.hashes {
+		if subtle.ConstantTimeCompare(sum[:], want) == 1 {
+			return user, true
+		}
+	}
+	return "", false
+}
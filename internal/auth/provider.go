@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Provider checks a user name and password against one source of users.
+// An error means the source couldn't be asked, not that the password is
+// wrong.
+type Provider interface {
+	Name() string
+	Authenticate(user, password string) (bool, error)
+}
+
+// Provider types accepted by NewProvider
+const (
+	TypeStatic   = "static"
+	TypeHtpasswd = "htpasswd"
+	TypePAM      = "pam"
+	TypeLDAP     = "ldap"
+)
+
+// ProviderConfig configures a provider. Only the fields of its Type are used.
+type ProviderConfig struct {
+	Name    string
+	Type    string
+	Users   map[string]string // static: user name -> hex SHA-256 password hash
+	File    string            // htpasswd: path of the file
+	Service string            // pam: service name under /etc/pam.d
+	LDAP    LDAPConfig
+}
+
+// NewProvider creates the provider described by cfg
+func NewProvider(cfg ProviderConfig) (Provider, error) {
+	switch cfg.Type {
+	case TypeStatic:
+		return NewStatic(cfg.Name, cfg.Users)
+	case TypeHtpasswd:
+		return NewHtpasswd(cfg.Name, cfg.File)
+	case TypePAM:
+		return NewPAM(cfg.Name, cfg.Service)
+	case TypeLDAP:
+		return NewLDAP(cfg.Name, cfg.LDAP)
+	}
+	return nil, fmt.Errorf("unknown auth provider type %q", cfg.Type)
+}
+
+// Static authenticates against a fixed list of users with SHA-256 password
+// hashes, as written in the config file
+type Static struct {
+	name  string
+	users map[string][]byte // user name -> SHA-256 of the password
+}
+
+// NewStatic creates a provider for users, a map of user name to hex-encoded
+// SHA-256 password hash
+func NewStatic(name string, users map[string]string) (*Static, error) {
+	s := &Static{name: name, users: make(map[string][]byte, len(users))}
+	for user, hash := range users {
+		sum, err := hex.DecodeString(strings.TrimSpace(hash))
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid password hash for user %q: expected 64 hex digits", user)
+		}
+		s.users[user] = sum
+	}
+	return s, nil
+}
+
+// Name returns the provider's name
+func (s *Static) Name() string {
+	return s.name
+}
+
+// Authenticate reports whether password matches the user's hash
+func (s *Static) Authenticate(user, password string) (bool, error) {
+	want, ok := s.users[user]
+	if !ok {
+		return false, nil
+	}
+	sum := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(sum[:], want) == 1, nil
+}
@@ -0,0 +1,77 @@
+package avahi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ErrServiceDirUnwritable is wrapped by errors from changing the service
+// directory without permission to, or on a read-only file system. Unlike a
+// transient failure, it persists until the setup is fixed.
+var ErrServiceDirUnwritable = errors.New("service directory not writable")
+
+// unwritable wraps err with ErrServiceDirUnwritable if it is a permission
+// failure, and returns any other error as it is
+func unwritable(err error) error {
+	if err == nil || errors.Is(err, ErrServiceDirUnwritable) {
+		return err
+	}
+	if os.IsPermission(err) || errors.Is(err, syscall.EROFS) {
+		return fmt.Errorf("%w: %w", ErrServiceDirUnwritable, err)
+	}
+	return err
+}
+
+// Files makes the changes the manager needs in the service directory. Names
+// are of files in the directory. Running unprivileged, the bridge makes them
+// through a helper that can still write there.
+type Files interface {
+	// WriteFile replaces a file atomically, so Avahi never reads half of it
+	WriteFile(name string, content []byte) error
+	// Remove deletes a file, succeeding if it doesn't exist
+	Remove(name string) error
+	Rename(oldName, newName string) error
+}
+
+// DirFiles returns Files changing dir directly
+func DirFiles(dir string) Files {
+	return dirFiles(dir)
+}
+
+// dirFiles changes a directory directly
+type dirFiles string
+
+func (d dirFiles) WriteFile(name string, content []byte) error {
+	path := filepath.Join(string(d), name)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", unwritable(err))
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename temp file: %w", unwritable(err))
+	}
+	return nil
+}
+
+func (d dirFiles) Remove(name string) error {
+	if err := os.Remove(filepath.Join(string(d), name)); err != nil && !os.IsNotExist(err) {
+		return unwritable(err)
+	}
+	return nil
+}
+
+func (d dirFiles) Rename(oldName, newName string) error {
+	return unwritable(os.Rename(filepath.Join(string(d), oldName), filepath.Join(string(d), newName)))
+}
+
+// SetFiles changes how the service directory is written, e.g. through a
+// privileged helper. It must be called before printers are updated.
+func (m *Manager) SetFiles(files Files) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files = files
+}
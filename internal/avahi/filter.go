@@ -0,0 +1,89 @@
+package avahi
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// namePattern matches printer names. Patterns are case-insensitive shell
+// wildcards such as "Zebra-*", or regular expressions between slashes such
+// as "/^PDF/".
+type namePattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// parsePattern compiles a pattern. Malformed wildcards match literally.
+func parsePattern(pattern string) (namePattern, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile("(?i)" + pattern[1:len(pattern)-1])
+		if err != nil {
+			return namePattern{}, err
+		}
+		return namePattern{re: re}, nil
+	}
+	return namePattern{glob: strings.ToLower(pattern)}, nil
+}
+
+// match reports whether name matches the pattern
+func (p namePattern) match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	name = strings.ToLower(name)
+	if matched, err := path.Match(p.glob, name); err == nil {
+		return matched
+	}
+	return p.glob == name
+}
+
+// matcher matches names against a list of patterns
+type matcher []namePattern
+
+// newMatcher compiles patterns, skipping invalid regular expressions
+func newMatcher(patterns []string) matcher {
+	m := make(matcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		if p, err := parsePattern(pattern); err == nil {
+			m = append(m, p)
+		}
+	}
+	return m
+}
+
+// match reports whether name matches any of the patterns
+func (m matcher) match(name string) bool {
+	for _, p := range m {
+		if p.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// NameFilter returns a func reporting whether a name passes the patterns the
+// way printers are filtered: only names matching include if it is set, else
+// names not matching exclude
+func NameFilter(include, exclude []string) func(name string) bool {
+	in, out := newMatcher(include), newMatcher(exclude)
+	return func(name string) bool {
+		if len(in) > 0 {
+			return in.match(name)
+		}
+		return !out.match(name)
+	}
+}
+
+// ValidatePattern returns an error if pattern is a malformed wildcard or
+// regular expression
+func ValidatePattern(pattern string) error {
+	p, err := parsePattern(pattern)
+	if err != nil {
+		return err
+	}
+	if p.re == nil {
+		_, err = path.Match(p.glob, "")
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package avahi
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+func TestNamePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"Office_Laser", "Office_Laser", true},
+		{"office_laser", "Office_Laser", true},
+		{"Office_Laser", "Office_Laser2", false},
+		{"Zebra-*", "Zebra-Dock1", true},
+		{"zebra-*", "ZEBRA-DOCK1", true},
+		{"Zebra-*", "Brother-QL", false},
+		{"Dock?", "Dock7", true},
+		{"Dock[", "Dock[", true}, // malformed, literal
+		{"/^PDF/", "PDF_Printer", true},
+		{"/^PDF/", "pdf_writer", true},
+		{"/^PDF/", "Office_PDF", false},
+		{"/_(ACCT|HR)$/", "HP_LJ4050_ACCT", true},
+		{"/", "/", true}, // too short to be a regex
+	}
+
+	for _, tt := range tests {
+		p, err := parsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parsePattern(%q) error = %v", tt.pattern, err)
+		}
+		if got := p.match(tt.name); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNameFilter(t *testing.T) {
+	tests := []struct {
+		include, exclude []string
+		name             string
+		want             bool
+	}{
+		{nil, nil, "Lab Printer", true},
+		{[]string{"Lab*"}, nil, "Lab Printer", true},
+		{[]string{"Lab*"}, nil, "Office Printer", false},
+		{nil, []string{"/fax/"}, "Office Fax", false},
+		{nil, []string{"/fax/"}, "Office Printer", true},
+		{[]string{"Office*"}, []string{"/fax/"}, "Office Fax", true}, // include wins
+	}
+	for _, tt := range tests {
+		if got := NameFilter(tt.include, tt.exclude)(tt.name); got != tt.want {
+			t.Errorf("NameFilter(%q, %q)(%q) = %v, want %v", tt.include, tt.exclude, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for _, pattern := range []string{"Zebra-*", "/^PDF/", "Office_Laser"} {
+		if err := ValidatePattern(pattern); err != nil {
+			t.Errorf("ValidatePattern(%q) error = %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"/[/", "Dock["} {
+		if err := ValidatePattern(pattern); err == nil {
+			t.Errorf("ValidatePattern(%q) expected error", pattern)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	m := NewManager(t.TempDir(), "airprint-", 8631, zerolog.Nop())
+	m.SetPinned([]string{"Primary"})
+
+	printers := []cups.Printer{
+		{Name: "Office", IsShared: true, IsAccepting: true},
+		{Name: "PDF", IsShared: true, IsAccepting: true},
+		{Name: "Private", IsAccepting: true},
+		{Name: "Stopped", IsShared: true},
+		{Name: "Primary", IsShared: true},
+	}
+	want := map[string]string{
+		"Office":  "",
+		"PDF":     "excluded",
+		"Private": "not shared",
+		"Stopped": "", // Advertised as stopped instead
+		"Primary": "",
+	}
+
+	plan := m.Plan(printers, true, nil, []string{"PDF"})
+	if len(plan) != len(printers) {
+		t.Fatalf("Plan() returned %d printers, want %d", len(plan), len(printers))
+	}
+	for _, p := range plan {
+		if p.Skipped != want[p.Printer.Name] {
+			t.Errorf("%s skipped = %q, want %q", p.Printer.Name, p.Skipped, want[p.Printer.Name])
+		}
+	}
+
+	plan = m.Plan(printers, true, []string{"Off*"}, nil)
+	if plan[0].Skipped != "" || plan[1].Skipped != "not on include list" {
+		t.Errorf("Plan() with include list = %+v", plan[:2])
+	}
+}
@@ -0,0 +1,141 @@
+package avahi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Ways of handling AirPrint service files written by other tools, such as
+// the airprint-generate.py script
+const (
+	LegacyKeep    = "keep"    // Leave them, and don't advertise their queues again
+	LegacyReplace = "replace" // Move them aside and advertise their queues ourselves
+	LegacyAdopt   = "adopt"   // Rewrite them in place and manage them as our own
+)
+
+// LegacyModes lists the accepted ways of handling legacy service files
+var LegacyModes = []string{LegacyKeep, LegacyReplace, LegacyAdopt}
+
+// legacySuffix is added to service files moved aside, which Avahi then ignores
+const legacySuffix = ".legacy"
+
+// LegacyFile is an AirPrint service file another tool wrote
+type LegacyFile struct {
+	File  string // Name in the service directory
+	Queue string // CUPS queue, from its rp TXT record
+}
+
+// FindLegacyFiles returns the AirPrint service files in dir whose names
+// don't start with prefix. A file counts as AirPrint if it advertises
+// _ipp._tcp with the _universal subtype or a URF TXT record, and names a
+// CUPS queue in its rp TXT record.
+func FindLegacyFiles(dir, prefix string) ([]LegacyFile, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.service"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to glob service files: %w", err)
+	}
+	sort.Strings(matches)
+
+	var files []LegacyFile
+	for _, path := range matches {
+		name := filepath.Base(path)
+		if strings.HasPrefix(name, prefix) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if queue := airprintQueue(data); queue != "" {
+			files = append(files, LegacyFile{File: name, Queue: queue})
+		}
+	}
+	return files, nil
+}
+
+// airprintQueue returns the CUPS queue an AirPrint service file advertises,
+// or "" if it isn't one
+func airprintQueue(data []byte) string {
+	var sg ServiceGroup
+	if err := xml.Unmarshal(data, &sg); err != nil {
+		return ""
+	}
+	for _, svc := range sg.Service {
+		if svc.Type != "_ipp._tcp" {
+			continue
+		}
+		airprint := false
+		for _, sub := range svc.SubTypes {
+			airprint = airprint || sub == "_universal._sub._ipp._tcp"
+		}
+		queue := ""
+		for _, txt := range svc.TXTRecord {
+			key, value, _ := strings.Cut(strings.TrimSpace(txt.Value), "=")
+			switch key {
+			case "URF":
+				airprint = true
+			case "rp":
+				queue = strings.TrimPrefix(value, "printers/")
+			}
+		}
+		if airprint && queue != "" {
+			return queue
+		}
+	}
+	return ""
+}
+
+// HandleLegacyFiles finds AirPrint service files other tools left in the
+// service directory and deals with them as mode says, so no queue is
+// advertised twice
+func (m *Manager) HandleLegacyFiles(mode string) error {
+	files, err := FindLegacyFiles(m.serviceDir, m.filePrefix)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.legacy = make(map[string]string)
+	m.adopted = make(map[string]string)
+	for _, f := range files {
+		log := m.log.With().Str("file", f.File).Str("printer", f.Queue).Logger()
+		switch mode {
+		case LegacyReplace:
+			if err := m.files.Rename(f.File, f.File+legacySuffix); err != nil {
+				return fmt.Errorf("failed to move legacy service file aside: %w", err)
+			}
+			log.Info().Str("moved_to", f.File+legacySuffix).Msg("replacing legacy service file")
+		case LegacyAdopt:
+			// A second file for the same queue is removed as an orphan
+			if _, ok := m.adopted[f.Queue]; !ok {
+				m.adopted[f.Queue] = f.File
+			}
+			m.managedFiles[f.File] = true
+			log.Info().Msg("adopted legacy service file")
+		default:
+			m.legacy[f.Queue] = f.File
+			log.Warn().Msg("legacy service file already advertises printer, not advertising it again")
+		}
+	}
+	return nil
+}
+
+// FileName returns the name of a printer's service file
+func (m *Manager) FileName(printer string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fileName(printer)
+}
+
+func (m *Manager) fileName(printer string) string {
+	if file := m.adopted[printer]; file != "" {
+		return file
+	}
+	return ServiceFileName(m.filePrefix, printer)
+}
@@ -0,0 +1,113 @@
+package avahi
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// airprintGenerate is a service file as written by airprint-generate.py
+const airprintGenerate = `<?xml version="1.0" ?>
+<!DOCTYPE service-group  SYSTEM 'avahi-service.dtd'>
+<service-group>
+  <name replace-wildcards="yes">AirPrint Office @ %h</name>
+  <service>
+    <type>_ipp._tcp</type>
+    <subtype>_universal._sub._ipp._tcp</subtype>
+    <port>631</port>
+    <txt-record>txtvers=1</txt-record>
+    <txt-record>qtotal=1</txt-record>
+    <txt-record>Transparent=T</txt-record>
+    <txt-record>URF=none</txt-record>
+    <txt-record>rp=printers/Office</txt-record>
+    <txt-record>pdl=application/pdf,image/urf</txt-record>
+  </service>
+</service-group>
+`
+
+const sshService = `<?xml version="1.0" standalone='no'?>
+<service-group>
+  <name replace-wildcards="yes">%h</name>
+  <service>
+    <type>_ssh._tcp</type>
+    <port>22</port>
+  </service>
+</service-group>
+`
+
+func writeServiceFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"AirPrint-Office.service": airprintGenerate,
+		"ssh.service":             sshService,
+		"airprint-Zebra.service":  airprintGenerate, // Ours, by prefix
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFindLegacyFiles(t *testing.T) {
+	files, err := FindLegacyFiles(writeServiceFiles(t), "airprint-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != (LegacyFile{File: "AirPrint-Office.service", Queue: "Office"}) {
+		t.Errorf("FindLegacyFiles() = %+v, want AirPrint-Office.service for Office", files)
+	}
+}
+
+func TestHandleLegacyFiles(t *testing.T) {
+	office := []cups.Printer{{Name: "Office", IsShared: true, IsAccepting: true}}
+
+	tests := []struct {
+		mode      string
+		skipped   string
+		file      string // Service file written for Office
+		movedAway bool
+	}{
+		{LegacyKeep, "advertised by AirPrint-Office.service", "", false},
+		{LegacyReplace, "", "airprint-Office.service", true},
+		{LegacyAdopt, "", "AirPrint-Office.service", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			dir := writeServiceFiles(t)
+			m := NewManager(dir, "airprint-", 8631, zerolog.Nop())
+			if err := m.HandleLegacyFiles(tt.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			if plan := m.Plan(office, true, nil, nil); plan[0].Skipped != tt.skipped {
+				t.Errorf("skipped = %q, want %q", plan[0].Skipped, tt.skipped)
+			}
+			if err := m.UpdatePrinters(office, true, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := os.Stat(filepath.Join(dir, "AirPrint-Office.service.legacy"))
+			if moved := err == nil; moved != tt.movedAway {
+				t.Errorf("moved aside = %v, want %v", moved, tt.movedAway)
+			}
+			if tt.file == "" {
+				return
+			}
+			data, err := os.ReadFile(filepath.Join(dir, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) == airprintGenerate {
+				t.Errorf("%s wasn't rewritten", tt.file)
+			}
+		})
+	}
+}
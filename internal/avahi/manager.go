@@ -11,18 +11,58 @@ import (
 
 	"github.com/WaffleThief123/airprint-bridge/internal/airprint"
 	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/mdns"
 )
 
 // Manager handles the lifecycle of Avahi service files
 type Manager struct {
-	serviceDir string
-	filePrefix string
-	cupsPort   int
-	log        zerolog.Logger
-	mu         sync.Mutex
+	serviceDir   string
+	filePrefix   string
+	cupsPort     int
+	tlsPort      int // IPPS port, 0 when TLS is disabled
+	authRequired bool
+	authPrinters map[string]bool // Printers that need credentials even when authRequired is off
+	log          zerolog.Logger
+	mu           sync.Mutex
 
 	// Track which files we've created
 	managedFiles map[string]bool
+
+	// Printers that stay advertised even when not accepting jobs
+	pinned map[string]bool
+
+	// Preferred document formats per printer, listed first in pdl
+	formats map[string][]string
+
+	// Friendly names advertised instead of the CUPS queue name
+	displayNames map[string]string
+
+	// Adjustments to the generated URF string per printer
+	urf map[string]airprint.URFOverride
+
+	// Dedicated IPP ports, advertised instead of cupsPort
+	ports map[string]int
+
+	// Returns the UUID a queue is advertised with, nil for none
+	uuid func(queue string) string
+
+	// Returns the media sizes a printer is advertised with, nil for CUPS's
+	media func(printer *cups.Printer) []string
+
+	// Queues advertised by other tools' service files, which are left alone,
+	// and the files taken over from them, keyed by queue name
+	legacy  map[string]string
+	adopted map[string]string
+
+	// Built-in mDNS responder used instead of service files, if set
+	responder *mdns.Responder
+	hostname  string
+
+	// Writes the service directory
+	files Files
+
+	// Printers advertised as stopped because their CUPS can't be reached
+	upstreamDown map[string]bool
 }
 
 // NewManager creates a new Avahi service file manager
@@ -33,43 +73,142 @@ func NewManager(serviceDir, filePrefix string, cupsPort int, log zerolog.Logger)
 		cupsPort:     cupsPort,
 		log:          log.With().Str("component", "avahi-manager").Logger(),
 		managedFiles: make(map[string]bool),
+		pinned:       make(map[string]bool),
+		files:        DirFiles(serviceDir),
 	}
 }
 
-// UpdatePrinters updates service files based on current CUPS printers
-func (m *Manager) UpdatePrinters(printers []cups.Printer, sharedOnly bool, excludeList []string) error {
+// SetPinned marks printers that stay advertised as ready while stopped or
+// not accepting jobs, e.g. failover primaries whose jobs are redirected to a
+// backup queue
+func (m *Manager) SetPinned(names []string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Build exclude map for quick lookup
-	exclude := make(map[string]bool)
-	for _, name := range excludeList {
-		exclude[strings.ToLower(name)] = true
+	m.pinned = make(map[string]bool, len(names))
+	for _, name := range names {
+		m.pinned[name] = true
 	}
+}
+
+// SetTLSPort enables advertisement of an _ipps._tcp service on the given port
+func (m *Manager) SetTLSPort(port int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tlsPort = port
+}
+
+// SetFormatPreferences sets the document formats each printer lists first
+// in its pdl TXT record
+func (m *Manager) SetFormatPreferences(formats map[string][]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.formats = formats
+}
+
+// SetDisplayNames sets the service names advertised for renamed printers,
+// keyed by CUPS queue name. The rp TXT record keeps the queue name so the
+// resource path stays URL-safe.
+func (m *Manager) SetDisplayNames(names map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.displayNames = names
+}
+
+// SetURFOverrides sets per-printer adjustments to the URF TXT record
+func (m *Manager) SetURFOverrides(overrides map[string]airprint.URFOverride) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.urf = overrides
+}
+
+// SetPorts sets the IPP port advertised for printers served on their own
+// port, keyed by CUPS queue name. Other printers use the port given to
+// NewManager.
+func (m *Manager) SetPorts(ports map[string]int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ports = ports
+}
+
+// port returns the IPP port a printer is advertised on
+func (m *Manager) port(name string) int {
+	if port := m.ports[name]; port != 0 {
+		return port
+	}
+	return m.cupsPort
+}
+
+// SetUUIDFunc sets how the UUID TXT record of a printer is found, so it
+// matches the printer-uuid the IPP server reports
+func (m *Manager) SetUUIDFunc(fn func(queue string) string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uuid = fn
+}
+
+// SetMediaFunc sets how the media sizes behind the kind and PaperMax TXT
+// records are found, so they follow the printer's media profile rather than
+// what CUPS reports
+func (m *Manager) SetMediaFunc(fn func(printer *cups.Printer) []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.media = fn
+}
+
+// SetAuthRequired advertises that printing requires a user name and password
+func (m *Manager) SetAuthRequired(required bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.authRequired = required
+}
+
+// SetAuthPrinters advertises that printing to these printers requires a user
+// name and password, e.g. queues that relay credentials to CUPS
+func (m *Manager) SetAuthPrinters(names []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.authPrinters = make(map[string]bool, len(names))
+	for _, name := range names {
+		m.authPrinters[name] = true
+	}
+}
+
+// SetUpstreamDown advertises the named printers as stopped while CUPS can't
+// be reached, through the printer-state TXT record, rather than withdrawing
+// them. Services are updated by the next UpdatePrinters.
+func (m *Manager) SetUpstreamDown(names []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.upstreamDown = make(map[string]bool, len(names))
+	for _, name := range names {
+		m.upstreamDown[name] = true
+	}
+}
+
+// UpdatePrinters updates service files based on current CUPS printers. When
+// includeList is set only printers matching one of its patterns are
+// advertised, and it takes precedence over excludeList. Both lists accept
+// wildcards ("Zebra-*") and regular expressions ("/^PDF/").
+func (m *Manager) UpdatePrinters(printers []cups.Printer, sharedOnly bool, includeList, excludeList []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	include := newMatcher(includeList)
+	exclude := newMatcher(excludeList)
 
 	// Track which printers we see this round
 	currentPrinters := make(map[string]bool)
 
 	for _, printer := range printers {
-		// Skip excluded printers
-		if exclude[strings.ToLower(printer.Name)] {
-			m.log.Debug().Str("printer", printer.Name).Msg("skipping excluded printer")
-			continue
-		}
-
-		// Skip non-shared printers if configured
-		if sharedOnly && !printer.IsShared {
-			m.log.Debug().Str("printer", printer.Name).Msg("skipping non-shared printer")
-			continue
-		}
-
-		// Skip printers that aren't accepting jobs
-		if !printer.IsAccepting {
-			m.log.Debug().Str("printer", printer.Name).Msg("skipping printer not accepting jobs")
+		if reason := m.skipReason(printer, sharedOnly, include, exclude); reason != "" {
+			m.log.Debug().Str("printer", printer.Name).Msg("skipping printer " + reason)
 			continue
 		}
 
-		filename := ServiceFileName(m.filePrefix, printer.Name)
+		filename := m.fileName(printer.Name)
 		currentPrinters[filename] = true
 
 		if err := m.createOrUpdateService(&printer); err != nil {
@@ -92,18 +231,117 @@ func (m *Manager) UpdatePrinters(printers []cups.Printer, sharedOnly bool, exclu
 	return nil
 }
 
-// createOrUpdateService creates or updates a service file for a printer
-func (m *Manager) createOrUpdateService(printer *cups.Printer) error {
+// PlannedPrinter is a printer UpdatePrinters was given and whether it would
+// be advertised
+type PlannedPrinter struct {
+	Printer cups.Printer
+	Skipped string // Why the printer isn't advertised, or "" if it is
+}
+
+// Plan reports which printers UpdatePrinters would advertise, and why the
+// others would be skipped, without changing anything
+func (m *Manager) Plan(printers []cups.Printer, sharedOnly bool, includeList, excludeList []string) []PlannedPrinter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	include := newMatcher(includeList)
+	exclude := newMatcher(excludeList)
+	plan := make([]PlannedPrinter, 0, len(printers))
+	for _, printer := range printers {
+		plan = append(plan, PlannedPrinter{
+			Printer: printer,
+			Skipped: m.skipReason(printer, sharedOnly, include, exclude),
+		})
+	}
+	return plan
+}
+
+// skipReason returns why a printer isn't advertised, or "" if it is
+func (m *Manager) skipReason(printer cups.Printer, sharedOnly bool, include, exclude matcher) string {
+	// Skip printers not on the include list, then excluded ones
+	if len(include) > 0 {
+		if !include.match(printer.Name) {
+			return "not on include list"
+		}
+	} else if exclude.match(printer.Name) {
+		return "excluded"
+	}
+
+	// Skip non-shared printers if configured
+	if sharedOnly && !printer.IsShared {
+		return "not shared"
+	}
+
+	// Skip printers another tool's service file already advertises
+	if file := m.legacy[printer.Name]; file != "" {
+		return "advertised by " + file
+	}
+	return ""
+}
+
+// ServiceFile returns the service file that would be written for a printer
+func (m *Manager) ServiceFile(printer *cups.Printer) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	serviceName, txtRecords := m.service(printer)
+	return GenerateServiceFileTLS(serviceName, m.port(printer.Name), m.tlsPort, txtRecords.All())
+}
+
+// service returns the name and TXT records a printer is advertised with
+func (m *Manager) service(printer *cups.Printer) (string, *airprint.TXTRecords) {
 	// Generate TXT records
 	txtRecords := airprint.NewTXTRecords(printer)
+	if m.tlsPort != 0 {
+		txtRecords.Set("TLS", "1.2")
+	}
+	if m.uuid != nil {
+		txtRecords.Set("UUID", m.uuid(printer.Name))
+	}
+	if m.media != nil {
+		txtRecords.SetMedia(m.media(printer))
+	}
+	if m.authRequired || m.authPrinters[printer.Name] {
+		txtRecords.Set("air", "username,password")
+	}
+	// Printers refusing jobs stay advertised as stopped, so clients show
+	// why rather than the printer vanishing
+	stopped := (printer.State == cups.PrinterStateStopped || !printer.IsAccepting) && !m.pinned[printer.Name]
+	if stopped || m.upstreamDown[printer.Name] {
+		txtRecords.Set("printer-state", "5")
+	}
+	if preferred := m.formats[printer.Name]; len(preferred) > 0 {
+		txtRecords.Set("pdl", strings.Join(airprint.OrderFormats(preferred), ","))
+	}
+
+	if override, ok := m.urf[printer.Name]; ok && !override.IsZero() {
+		urf, _ := txtRecords.Get("URF")
+		txtRecords.Set("URF", strings.Join(override.Apply(strings.Split(urf, ",")), ","))
+	}
+
+	serviceName := printer.Name
+	if name := m.displayNames[printer.Name]; name != "" {
+		serviceName = name
+	}
+	return serviceName, txtRecords
+}
+
+// createOrUpdateService creates or updates a service file for a printer
+func (m *Manager) createOrUpdateService(printer *cups.Printer) error {
+	serviceName, txtRecords := m.service(printer)
+	filename := m.fileName(printer.Name)
+	if m.responder != nil {
+		m.responder.Publish(filename, m.nativeServices(serviceName, m.hostname, m.port(printer.Name), txtRecords.All()))
+		m.managedFiles[filename] = true
+		return nil
+	}
 
 	// Generate service file content
-	content, err := GenerateServiceFile(printer.Name, m.cupsPort, txtRecords.All())
+	content, err := GenerateServiceFileTLS(serviceName, m.port(printer.Name), m.tlsPort, txtRecords.All())
 	if err != nil {
 		return fmt.Errorf("failed to generate service file: %w", err)
 	}
 
-	filename := ServiceFileName(m.filePrefix, printer.Name)
 	filepath := filepath.Join(m.serviceDir, filename)
 
 	// Check if file exists and has same content
@@ -113,14 +351,14 @@ func (m *Manager) createOrUpdateService(printer *cups.Printer) error {
 		return nil
 	}
 
-	// Write atomically: write to temp file, then rename
-	if err := m.atomicWrite(filepath, content); err != nil {
+	if err := m.files.WriteFile(filename, content); err != nil {
 		return fmt.Errorf("failed to write service file: %w", err)
 	}
 
 	m.managedFiles[filename] = true
 	m.log.Info().
 		Str("printer", printer.Name).
+		Str("service", serviceName).
 		Str("file", filename).
 		Bool("color", printer.ColorSupported).
 		Bool("duplex", printer.DuplexSupported).
@@ -129,27 +367,14 @@ func (m *Manager) createOrUpdateService(printer *cups.Printer) error {
 	return nil
 }
 
-// atomicWrite writes content to a file atomically using a temp file and rename
-func (m *Manager) atomicWrite(filepath string, content []byte) error {
-	// Create temp file in the same directory
-	tmpPath := filepath + ".tmp"
-
-	if err := os.WriteFile(tmpPath, content, 0644); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
-	}
-
-	if err := os.Rename(tmpPath, filepath); err != nil {
-		os.Remove(tmpPath) // Clean up temp file
-		return fmt.Errorf("failed to rename temp file: %w", err)
-	}
-
-	return nil
-}
-
-// removeServiceFile removes a service file
+// removeServiceFile removes a service file, or withdraws the printer from
+// the responder
 func (m *Manager) removeServiceFile(filename string) error {
-	filepath := filepath.Join(m.serviceDir, filename)
-	if err := os.Remove(filepath); err != nil && !os.IsNotExist(err) {
+	if m.responder != nil {
+		m.responder.Unpublish(filename)
+		return nil
+	}
+	if err := m.files.Remove(filename); err != nil {
 		return fmt.Errorf("failed to remove service file: %w", err)
 	}
 	return nil
@@ -0,0 +1,117 @@
+package avahi
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+func TestDiscoverExisting_RemovesStale(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"airprint-Office.service", "airprint-Gone.service", "ssh.service"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sshService), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewManager(dir, "airprint-", 8631, zerolog.Nop())
+	if err := m.DiscoverExisting(); err != nil {
+		t.Fatal(err)
+	}
+	office := []cups.Printer{{Name: "Office", IsShared: true, IsAccepting: true}}
+	if err := m.UpdatePrinters(office, true, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{"airprint-Office.service", true},
+		{"airprint-Gone.service", false},
+		{"ssh.service", true},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(dir, tt.file))
+		if exists := err == nil; exists != tt.want {
+			t.Errorf("%s exists = %v, want %v", tt.file, exists, tt.want)
+		}
+	}
+}
+
+func TestServiceFile_PrinterPorts(t *testing.T) {
+	m := NewManager(t.TempDir(), "airprint-", 8631, zerolog.Nop())
+	m.SetPorts(map[string]int{"Zebra": 8640})
+
+	tests := []struct {
+		printer string
+		want    string
+	}{
+		{"Zebra", "<port>8640</port>"},
+		{"Office", "<port>8631</port>"},
+	}
+	for _, tt := range tests {
+		content, err := m.ServiceFile(&cups.Printer{Name: tt.printer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), tt.want) {
+			t.Errorf("%s service file lacks %s:\n%s", tt.printer, tt.want, content)
+		}
+	}
+}
+
+func TestServiceFile_UpstreamDown(t *testing.T) {
+	m := NewManager(t.TempDir(), "airprint-", 8631, zerolog.Nop())
+	printer := &cups.Printer{Name: "Office", IsAccepting: true}
+	const stopped = `<txt-record>printer-state=5</txt-record>`
+
+	m.SetUpstreamDown([]string{"Office"})
+	content, err := m.ServiceFile(printer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), stopped) {
+		t.Errorf("service file during an outage lacks %s:\n%s", stopped, content)
+	}
+
+	m.SetUpstreamDown(nil)
+	content, err = m.ServiceFile(printer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "printer-state") {
+		t.Errorf("service file after an outage still has printer-state:\n%s", content)
+	}
+}
+
+func TestServiceFile_PrinterState(t *testing.T) {
+	m := NewManager(t.TempDir(), "airprint-", 8631, zerolog.Nop())
+	m.SetPinned([]string{"Primary"})
+
+	tests := []struct {
+		printer cups.Printer
+		want    bool
+	}{
+		{cups.Printer{Name: "Office", State: cups.PrinterStateIdle, IsAccepting: true}, false},
+		{cups.Printer{Name: "Office", State: cups.PrinterStateProcessing, IsAccepting: true}, false},
+		{cups.Printer{Name: "Office", State: cups.PrinterStateStopped, IsAccepting: true}, true},
+		{cups.Printer{Name: "Office", State: cups.PrinterStateIdle, IsAccepting: false}, true},
+		{cups.Printer{Name: "Primary", State: cups.PrinterStateStopped, IsAccepting: true}, false},
+		{cups.Printer{Name: "Primary", State: cups.PrinterStateIdle, IsAccepting: false}, false},
+	}
+	for _, tt := range tests {
+		content, err := m.ServiceFile(&tt.printer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(string(content), "<txt-record>printer-state=5</txt-record>"); got != tt.want {
+			t.Errorf("%s %v accepting %v advertised as stopped = %v, want %v", tt.printer.Name, tt.printer.State, tt.printer.IsAccepting, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package avahi
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/mdns"
+)
+
+// SetResponder advertises printers through a built-in mDNS responder instead
+// of Avahi service files, e.g. to limit advertisement to some interfaces.
+// hostname replaces Avahi's %h in service names. It must be called before
+// printers are updated.
+func (m *Manager) SetResponder(responder *mdns.Responder, hostname string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responder = responder
+	m.hostname = hostname
+}
+
+// RemoveServiceFiles deletes service files left in the service directory by
+// earlier runs, so Avahi stops advertising them on every interface
+func (m *Manager) RemoveServiceFiles() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(m.serviceDir, m.filePrefix+"*.service"))
+	if err != nil {
+		return fmt.Errorf("failed to glob service files: %w", err)
+	}
+	for _, match := range matches {
+		if err := m.files.Remove(filepath.Base(match)); err != nil {
+			return fmt.Errorf("failed to remove service file: %w", err)
+		}
+		m.log.Info().Str("file", filepath.Base(match)).Msg("removed leftover service file")
+	}
+	return nil
+}
+
+// Services returns the services a printer is advertised as, with hostname
+// in place of Avahi's %h, e.g. to publish them in unicast DNS
+func (m *Manager) Services(printer *cups.Printer, hostname string) []mdns.Service {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	serviceName, txtRecords := m.service(printer)
+	return m.nativeServices(serviceName, hostname, m.port(printer.Name), txtRecords.All())
+}
+
+// nativeServices returns the services the responder advertises for a
+// printer on port, matching what GenerateServiceFileTLS writes for Avahi
+func (m *Manager) nativeServices(serviceName, hostname string, port int, txtRecords map[string]string) []mdns.Service {
+	keys := make([]string, 0, len(txtRecords))
+	for k := range txtRecords {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	txt := make([]string, 0, len(keys))
+	for _, k := range keys {
+		txt = append(txt, k+"="+txtRecords[k])
+	}
+
+	instance := fmt.Sprintf("%s @ %s", sanitizeName(serviceName), hostname)
+	services := []mdns.Service{{
+		Instance: instance,
+		Type:     "_ipp._tcp",
+		Subtypes: []string{"_universal._sub._ipp._tcp"},
+		Port:     port,
+		TXT:      txt,
+	}}
+	if m.tlsPort != 0 {
+		services = append(services, mdns.Service{
+			Instance: instance,
+			Type:     "_ipps._tcp",
+			Subtypes: []string{"_universal._sub._ipps._tcp"},
+			Port:     m.tlsPort,
+			TXT:      txt,
+		})
+	}
+	return services
+}
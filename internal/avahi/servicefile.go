@@ -29,6 +29,12 @@ type TXTRecord struct {
 
 // GenerateServiceFile creates an Avahi service file XML for a printer
 func GenerateServiceFile(printerName string, port int, txtRecords map[string]string) ([]byte, error) {
+	return GenerateServiceFileTLS(printerName, port, 0, txtRecords)
+}
+
+// GenerateServiceFileTLS creates an Avahi service file XML for a printer that
+// additionally advertises an _ipps._tcp service when tlsPort is non-zero
+func GenerateServiceFileTLS(printerName string, port, tlsPort int, txtRecords map[string]string) ([]byte, error) {
 	// Create sorted TXT records for consistent output
 	var records []TXTRecord
 	keys := make([]string, 0, len(txtRecords))
@@ -57,6 +63,17 @@ func GenerateServiceFile(printerName string, port int, txtRecords map[string]str
 		},
 	}
 
+	if tlsPort != 0 {
+		sg.Service = append(sg.Service, Service{
+			Type: "_ipps._tcp",
+			SubTypes: []string{
+				"_universal._sub._ipps._tcp",
+			},
+			Port:      tlsPort,
+			TXTRecord: records,
+		})
+	}
+
 	// Generate XML with proper header and DOCTYPE
 	output, err := xml.MarshalIndent(sg, "", "  ")
 	if err != nil {
@@ -106,3 +106,42 @@ func TestServiceFileName(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateServiceFileTLS(t *testing.T) {
+	txtRecords := map[string]string{
+		"txtvers": "1",
+		"TLS":     "1.2",
+	}
+
+	content, err := GenerateServiceFileTLS("TestPrinter", 8631, 8632, txtRecords)
+	if err != nil {
+		t.Fatalf("GenerateServiceFileTLS() error = %v", err)
+	}
+
+	xml := string(content)
+
+	if !strings.Contains(xml, "<type>_ipp._tcp</type>") {
+		t.Error("missing IPP service type")
+	}
+	if !strings.Contains(xml, "<type>_ipps._tcp</type>") {
+		t.Error("missing IPPS service type")
+	}
+	if !strings.Contains(xml, "_universal._sub._ipps._tcp") {
+		t.Error("missing universal IPPS subtype")
+	}
+	if !strings.Contains(xml, "<port>8632</port>") {
+		t.Error("missing IPPS port element")
+	}
+	if strings.Count(xml, "TLS=1.2") != 2 {
+		t.Error("TLS record should be present on both services")
+	}
+
+	// Without a TLS port only the plain service is generated
+	content, err = GenerateServiceFileTLS("TestPrinter", 8631, 0, txtRecords)
+	if err != nil {
+		t.Fatalf("GenerateServiceFileTLS() error = %v", err)
+	}
+	if strings.Contains(string(content), "_ipps._tcp") {
+		t.Error("unexpected IPPS service without TLS port")
+	}
+}
@@ -37,6 +37,20 @@ func ParseResolutions(values []string) []int {
 	return resolutions
 }
 
+// modelResolution matches a density in a make-and-model string
+var modelResolution = regexp.MustCompile(`(\d{3,4})\s*dpi`)
+
+// ResolutionFromModel returns the DPI named in a make-and-model string such
+// as "Zebra ZD420 203dpi", or 0 if there is none
+func ResolutionFromModel(makeModel string) int {
+	matches := modelResolution.FindStringSubmatch(strings.ToLower(makeModel))
+	if matches == nil {
+		return 0
+	}
+	dpi, _ := strconv.Atoi(matches[1])
+	return dpi
+}
+
 // ParseDuplexSupport checks if duplex is supported from sides-supported attribute
 func ParseDuplexSupport(values []string) bool {
 	for _, v := range values {
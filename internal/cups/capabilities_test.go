@@ -155,3 +155,23 @@ func TestGetDefaultResolution(t *testing.T) {
 		})
 	}
 }
+
+func TestResolutionFromModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"Zebra ZPL Label Printer (203 dpi)", 203},
+		{"ZDesigner ZD420-300dpi ZPL", 300},
+		{"HP LaserJet 4050 Series Postscript (recommended)", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := ResolutionFromModel(tt.model); got != tt.want {
+				t.Errorf("ResolutionFromModel(%q) = %d, want %d", tt.model, got, tt.want)
+			}
+		})
+	}
+}
@@ -17,18 +17,29 @@ type Client struct {
 var printerAttributes = []string{
 	"printer-name",
 	"printer-uri-supported",
+	"device-uri",
 	"printer-make-and-model",
 	"printer-location",
 	"printer-info",
 	"printer-state",
+	"printer-state-reasons",
+	"printer-state-message",
 	"printer-is-shared",
 	"printer-is-accepting-jobs",
+	"queued-job-count",
 	"color-supported",
 	"sides-supported",
 	"printer-resolution-supported",
+	"printer-resolution-default",
 	"media-supported",
 	"media-ready",
 	"media-default",
+	"media-source-supported",
+	"media-col-ready",
+	"media-top-margin-supported",
+	"media-bottom-margin-supported",
+	"media-left-margin-supported",
+	"media-right-margin-supported",
 }
 
 // NewClient creates a new CUPS client
@@ -52,12 +63,12 @@ func NewClient(host string, port int) *Client {
 func (c *Client) GetPrinters() ([]Printer, error) {
 	printerMap, err := c.cupsClient.GetPrinters(printerAttributes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get printers: %w", err)
+		return nil, fmt.Errorf("failed to get printers: %w", Unreachable(err))
 	}
 
 	var printers []Printer
 	for name, attrs := range printerMap {
-		printer := c.parsePrinterAttributes(name, attrs)
+		printer := parsePrinterAttributes(name, attrs)
 		printers = append(printers, printer)
 	}
 
@@ -77,11 +88,11 @@ func (c *Client) GetPrinter(name string) (*Printer, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("printer %s not found", name)
+	return nil, fmt.Errorf("%w: %s", ErrPrinterNotFound, name)
 }
 
 // parsePrinterAttributes converts IPP attributes to a Printer struct
-func (c *Client) parsePrinterAttributes(name string, attrs ipp.Attributes) Printer {
+func parsePrinterAttributes(name string, attrs ipp.Attributes) Printer {
 	printer := Printer{
 		Name: name,
 	}
@@ -90,6 +101,10 @@ func (c *Client) parsePrinterAttributes(name string, attrs ipp.Attributes) Print
 		printer.URI = v
 	}
 
+	if v := getAttributeString(attrs, "device-uri"); v != "" {
+		printer.DeviceURI = v
+	}
+
 	if v := getAttributeString(attrs, "printer-make-and-model"); v != "" {
 		printer.MakeModel = v
 	}
@@ -105,6 +120,8 @@ func (c *Client) parsePrinterAttributes(name string, attrs ipp.Attributes) Print
 	if v, ok := getAttributeInt(attrs, "printer-state"); ok {
 		printer.State = PrinterState(v)
 	}
+	printer.StateReasons = parseStateReasons(getAttributeStrings(attrs, "printer-state-reasons"))
+	printer.StateMessage = getAttributeString(attrs, "printer-state-message")
 
 	if v, ok := getAttributeBool(attrs, "printer-is-shared"); ok {
 		printer.IsShared = v
@@ -114,6 +131,10 @@ func (c *Client) parsePrinterAttributes(name string, attrs ipp.Attributes) Print
 		printer.IsAccepting = v
 	}
 
+	if v, ok := getAttributeInt(attrs, "queued-job-count"); ok {
+		printer.QueuedJobs = v
+	}
+
 	if v, ok := getAttributeBool(attrs, "color-supported"); ok {
 		printer.ColorSupported = v
 	}
@@ -125,6 +146,18 @@ func (c *Client) parsePrinterAttributes(name string, attrs ipp.Attributes) Print
 	if resolutions := getAttributeStrings(attrs, "printer-resolution-supported"); len(resolutions) > 0 {
 		printer.Resolutions = ParseResolutions(resolutions)
 	}
+	if resolutions := ParseResolutions(getAttributeStrings(attrs, "printer-resolution-default")); len(resolutions) > 0 {
+		printer.DefaultResolution = resolutions[0]
+	}
+	// Label printer drivers often report no resolutions, but name their
+	// density in the model, e.g. "Zebra ZPL Label Printer (203 dpi)"
+	if len(printer.Resolutions) == 0 {
+		if printer.DefaultResolution != 0 {
+			printer.Resolutions = []int{printer.DefaultResolution}
+		} else if dpi := ResolutionFromModel(printer.MakeModel); dpi != 0 {
+			printer.Resolutions = []int{dpi}
+		}
+	}
 
 	if media := getAttributeStrings(attrs, "media-supported"); len(media) > 0 {
 		printer.MediaSupported = media
@@ -138,6 +171,10 @@ func (c *Client) parsePrinterAttributes(name string, attrs ipp.Attributes) Print
 		printer.MediaDefault = v
 	}
 
+	printer.MediaSources = getAttributeStrings(attrs, "media-source-supported")
+	printer.MediaColReady = parseMediaCols(attrs, "media-col-ready", printer.MediaSupported)
+	printer.MediaMargins = parseMargins(attrs)
+
 	return printer
 }
 
@@ -145,7 +182,7 @@ func (c *Client) parsePrinterAttributes(name string, attrs ipp.Attributes) Print
 func (c *Client) TestConnection() error {
 	_, err := c.cupsClient.GetPrinters([]string{"printer-name"})
 	if err != nil {
-		return fmt.Errorf("CUPS connection test failed: %w", err)
+		return fmt.Errorf("CUPS connection test failed: %w", Unreachable(err))
 	}
 	return nil
 }
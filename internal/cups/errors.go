@@ -0,0 +1,47 @@
+package cups
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/phin1x/go-ipp"
+)
+
+// ErrCUPSUnreachable is wrapped by errors from failing to reach CUPS at all,
+// rather than CUPS answering with an error. It is transient: CUPS is
+// restarting or the network is down, and retrying later may succeed.
+var ErrCUPSUnreachable = errors.New("CUPS unreachable")
+
+// ErrPrinterNotFound is wrapped by errors for printers CUPS doesn't have
+var ErrPrinterNotFound = errors.New("printer not found")
+
+// Unreachable wraps err with ErrCUPSUnreachable if it is a failure to
+// connect to CUPS, and returns any other error as it is
+func Unreachable(err error) error {
+	if err == nil || errors.Is(err, ErrCUPSUnreachable) || !connectFailed(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrCUPSUnreachable, err)
+}
+
+// IsTransient reports whether an operation that failed with err is worth
+// retrying later
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrCUPSUnreachable)
+}
+
+// connectFailed reports whether err means no connection to CUPS could be
+// made, or CUPS couldn't serve it while starting or stopping
+func connectFailed(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var httpErr ipp.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code >= 500
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
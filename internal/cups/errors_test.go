@@ -0,0 +1,48 @@
+package cups
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/phin1x/go-ipp"
+)
+
+func TestUnreachable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"dial refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"wrapped refused", fmt.Errorf("post: %w", syscall.ECONNREFUSED), true},
+		{"read after connecting", &net.OpError{Op: "read", Net: "tcp", Err: errors.New("timeout")}, false},
+		{"http 503 while starting", ipp.HTTPError{Code: 503}, true},
+		{"http 403", ipp.HTTPError{Code: 403}, false},
+		{"ipp error", ipp.IPPError{Status: 0x0406, Message: "The printer or class does not exist."}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unreachable(tt.err)
+			if got := errors.Is(err, ErrCUPSUnreachable); got != tt.want {
+				t.Errorf("errors.Is(Unreachable(%v), ErrCUPSUnreachable) = %v, want %v", tt.err, got, tt.want)
+			}
+			if got := IsTransient(err); got != tt.want {
+				t.Errorf("IsTransient() = %v, want %v", got, tt.want)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Unreachable() lost the original error: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnreachable_WrapsOnce(t *testing.T) {
+	err := Unreachable(Unreachable(syscall.ECONNREFUSED))
+	if got := err.Error(); got != "CUPS unreachable: connection refused" {
+		t.Errorf("Unreachable() twice = %q", got)
+	}
+}
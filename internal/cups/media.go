@@ -0,0 +1,288 @@
+package cups
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/phin1x/go-ipp"
+)
+
+// MediaCol is media loaded in one of a printer's trays, from media-col-ready
+type MediaCol struct {
+	SizeName string // PWG media name matching the dimensions, if one is supported
+	Width    int    // Hundredths of a millimetre
+	Height   int
+	Source   string // Tray, e.g. "tray-1" or "manual"
+	Type     string // e.g. "stationery" or "stationery-letterhead"
+}
+
+// Margins are the unprintable edges of the media, in hundredths of a
+// millimetre
+type Margins struct {
+	Top, Bottom, Left, Right int
+}
+
+// parseMargins returns the largest margin CUPS lists for each edge, which is
+// what bordered printing uses, or nil if it lists none
+func parseMargins(attrs ipp.Attributes) *Margins {
+	found := false
+	largest := func(name string) int {
+		max := 0
+		for _, attr := range attrs[name] {
+			if v, ok := attr.Value.(int); ok {
+				found = true
+				if v > max {
+					max = v
+				}
+			}
+		}
+		return max
+	}
+	m := &Margins{
+		Top:    largest("media-top-margin-supported"),
+		Bottom: largest("media-bottom-margin-supported"),
+		Left:   largest("media-left-margin-supported"),
+		Right:  largest("media-right-margin-supported"),
+	}
+	if !found {
+		return nil
+	}
+	return m
+}
+
+// mediaDimensions matches the size part of a PWG self-describing media name
+var mediaDimensions = regexp.MustCompile(`^(\d+(?:\.\d+)?)x(\d+(?:\.\d+)?)(mm|in)$`)
+
+// ParseMediaSize returns the width and height, in hundredths of a
+// millimetre, encoded in a PWG media name such as "iso_a4_210x297mm" or
+// "na_letter_8.5x11in"
+func ParseMediaSize(name string) (width, height int, ok bool) {
+	parts := strings.Split(name, "_")
+	matches := mediaDimensions.FindStringSubmatch(parts[len(parts)-1])
+	if matches == nil {
+		return 0, 0, false
+	}
+	scale := 100.0
+	if matches[3] == "in" {
+		scale = 2540
+	}
+	w, _ := strconv.ParseFloat(matches[1], 64)
+	h, _ := strconv.ParseFloat(matches[2], 64)
+	width, height = int(w*scale+0.5), int(h*scale+0.5)
+	return width, height, width > 0 && height > 0
+}
+
+// MediaSizeName returns the name in names whose dimensions match, to within
+// a millimetre, or "" if none does
+func MediaSizeName(width, height int, names []string) string {
+	for _, name := range names {
+		w, h, ok := ParseMediaSize(name)
+		if ok && abs(w-width) <= 100 && abs(h-height) <= 100 {
+			return name
+		}
+	}
+	return ""
+}
+
+// legacyMediaNames maps the PPD-style names some queues report to PWG names
+var legacyMediaNames = map[string]string{
+	"letter":    "na_letter_8.5x11in",
+	"legal":     "na_legal_8.5x14in",
+	"executive": "na_executive_7.25x10.5in",
+	"tabloid":   "na_ledger_11x17in",
+	"a3":        "iso_a3_297x420mm",
+	"a4":        "iso_a4_210x297mm",
+	"a5":        "iso_a5_148x210mm",
+	"a6":        "iso_a6_105x148mm",
+	"env10":     "na_number-10_4.125x9.5in",
+	"envdl":     "iso_dl_110x220mm",
+}
+
+var (
+	// legacyInches matches names like "4x6" or "4x6in", in inches unless
+	// they say mm
+	legacyInches = regexp.MustCompile(`^(\d+(?:\.\d+)?)x(\d+(?:\.\d+)?)(mm|in)?$`)
+	// legacyPoints matches PPD custom sizes like "w288h432", in points
+	legacyPoints = regexp.MustCompile(`^w(\d+(?:\.\d+)?)h(\d+(?:\.\d+)?)$`)
+)
+
+// CanonicalMediaName returns the PWG name for a legacy media name, or the
+// name unchanged
+func CanonicalMediaName(name string) string {
+	if pwg, ok := legacyMediaNames[strings.ToLower(name)]; ok {
+		return pwg
+	}
+	return name
+}
+
+// mediaNameSize returns the dimensions of a PWG or legacy media name
+func mediaNameSize(name string) (width, height int, ok bool) {
+	if width, height, ok = ParseMediaSize(name); ok {
+		return width, height, true
+	}
+	scale := 2540.0
+	matches := legacyInches.FindStringSubmatch(strings.ToLower(name))
+	if matches == nil {
+		if matches = legacyPoints.FindStringSubmatch(strings.ToLower(name)); matches == nil {
+			return 0, 0, false
+		}
+		scale = 2540.0 / 72
+	} else if matches[3] == "mm" {
+		scale = 100
+	}
+	w, _ := strconv.ParseFloat(matches[1], 64)
+	h, _ := strconv.ParseFloat(matches[2], 64)
+	width, height = int(w*scale+0.5), int(h*scale+0.5)
+	return width, height, width > 0 && height > 0
+}
+
+// CanonicalMedia converts legacy media names to PWG names and lists each
+// size once, so the same paper doesn't appear several times in a client's
+// menu. Where a size is reported under several names the PWG one is kept, in
+// the position the size first appeared. The default is mapped to the name
+// kept for its size.
+func CanonicalMedia(names []string, defaultName string) ([]string, string) {
+	type size struct{ width, height int }
+	var (
+		result []string
+		sizes  []*size // nil for names without known dimensions
+	)
+	sameSize := func(width, height int) int {
+		for i, s := range sizes {
+			if s != nil && abs(s.width-width) <= 100 && abs(s.height-height) <= 100 {
+				return i
+			}
+		}
+		return -1
+	}
+	canonical := func(name string) (string, int) {
+		name = CanonicalMediaName(name)
+		if width, height, ok := mediaNameSize(name); ok {
+			return name, sameSize(width, height)
+		}
+		for i, v := range result {
+			if v == name {
+				return name, i
+			}
+		}
+		return name, -1
+	}
+
+	for _, name := range names {
+		name, i := canonical(name)
+		if i >= 0 {
+			if _, _, pwg := ParseMediaSize(name); pwg {
+				if _, _, keptPWG := ParseMediaSize(result[i]); !keptPWG {
+					result[i] = name
+				}
+			}
+			continue
+		}
+		result = append(result, name)
+		if width, height, ok := mediaNameSize(name); ok {
+			sizes = append(sizes, &size{width, height})
+		} else {
+			sizes = append(sizes, nil)
+		}
+	}
+
+	if name, i := canonical(defaultName); i >= 0 {
+		defaultName = result[i]
+	} else {
+		defaultName = name
+	}
+	return result, defaultName
+}
+
+// CheckMediaDefault returns def if it's a sensible default for a printer
+// supporting names. Otherwise it returns a replacement, preferring fallback,
+// and why def was replaced. A default is replaced if it isn't supported, or
+// if it's much wider than anything else the printer takes, as when a label
+// printer's queue defaults to letter paper.
+func CheckMediaDefault(names []string, def, fallback string) (string, string) {
+	if len(names) == 0 {
+		return def, ""
+	}
+	reason := ""
+	switch {
+	case !containsName(names, def):
+		reason = "not in media-supported"
+	case tooWide(names, def):
+		reason = "much wider than the other supported media"
+	default:
+		return def, ""
+	}
+
+	if containsName(names, fallback) && !tooWide(names, fallback) {
+		return fallback, reason
+	}
+	for _, name := range names {
+		if name != def && !tooWide(names, name) {
+			return name, reason
+		}
+	}
+	return names[0], reason
+}
+
+// tooWide reports whether a size is over half as wide again as every other
+// size in names with known dimensions
+func tooWide(names []string, name string) bool {
+	width, _, ok := mediaNameSize(name)
+	if !ok {
+		return false
+	}
+	widest := 0
+	for _, other := range names {
+		if w, _, ok := mediaNameSize(other); ok && other != name && w > widest {
+			widest = w
+		}
+	}
+	return widest > 0 && width*2 > widest*3
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// parseMediaCols converts media-col collections, naming each size after the
+// matching entry of supported
+func parseMediaCols(attrs ipp.Attributes, name string, supported []string) []MediaCol {
+	var cols []MediaCol
+	for _, attr := range attrs[name] {
+		col, ok := attr.Value.(ipp.Collection)
+		if !ok {
+			continue
+		}
+		m := MediaCol{
+			Source: collectionString(col, "media-source"),
+			Type:   collectionString(col, "media-type"),
+		}
+		if members := col["media-size"]; len(members) > 0 {
+			if size, ok := members[0].Value.(ipp.Collection); ok {
+				m.Width, _ = getAttributeInt(ipp.Attributes(size), "x-dimension")
+				m.Height, _ = getAttributeInt(ipp.Attributes(size), "y-dimension")
+			}
+		}
+		m.SizeName = MediaSizeName(m.Width, m.Height, supported)
+		cols = append(cols, m)
+	}
+	return cols
+}
+
+// collectionString returns a string member of a collection
+func collectionString(col ipp.Collection, member string) string {
+	return getAttributeString(ipp.Attributes(col), member)
+}
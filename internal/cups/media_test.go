@@ -0,0 +1,180 @@
+package cups
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/phin1x/go-ipp"
+)
+
+func TestParseMediaSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		ok            bool
+	}{
+		{"iso_a4_210x297mm", 21000, 29700, true},
+		{"na_letter_8.5x11in", 21590, 27940, true},
+		{"oe_4x6-label_4x6in", 10160, 15240, true},
+		{"oe_62x100mm_62x100mm", 6200, 10000, true},
+		{"oe_w167h288_30256", 0, 0, false},
+		{"letter", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, ok := ParseMediaSize(tt.name)
+			if width != tt.width || height != tt.height || ok != tt.ok {
+				t.Errorf("ParseMediaSize(%q) = %d, %d, %v; want %d, %d, %v", tt.name, width, height, ok, tt.width, tt.height, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMediaSizeName(t *testing.T) {
+	names := []string{"iso_a4_210x297mm", "na_letter_8.5x11in"}
+	if got := MediaSizeName(21590, 27940, names); got != "na_letter_8.5x11in" {
+		t.Errorf("MediaSizeName(letter) = %q", got)
+	}
+	// Drivers round differently; a millimetre either way still matches
+	if got := MediaSizeName(20990, 29700, names); got != "iso_a4_210x297mm" {
+		t.Errorf("MediaSizeName(A4 rounded) = %q", got)
+	}
+	if got := MediaSizeName(10160, 15240, names); got != "" {
+		t.Errorf("MediaSizeName(4x6) = %q, want none", got)
+	}
+}
+
+func TestCanonicalMedia(t *testing.T) {
+	tests := []struct {
+		name        string
+		media       []string
+		def         string
+		want        []string
+		wantDefault string
+	}{
+		{
+			name:        "legacy names",
+			media:       []string{"Letter", "A4", "Custom.4x6in"},
+			def:         "Letter",
+			want:        []string{"na_letter_8.5x11in", "iso_a4_210x297mm", "Custom.4x6in"},
+			wantDefault: "na_letter_8.5x11in",
+		},
+		{
+			name:        "same size under three names",
+			media:       []string{"4x6", "w288h432", "oe_4x6-label_4x6in", "oe_4x4-label_4x4in"},
+			def:         "4x6",
+			want:        []string{"oe_4x6-label_4x6in", "oe_4x4-label_4x4in"},
+			wantDefault: "oe_4x6-label_4x6in",
+		},
+		{
+			name:        "first PWG name wins",
+			media:       []string{"na_letter_8.5x11in", "Letter", "na_letter_8.5x11in"},
+			def:         "na_letter_8.5x11in",
+			want:        []string{"na_letter_8.5x11in"},
+			wantDefault: "na_letter_8.5x11in",
+		},
+		{
+			name:        "unknown default",
+			media:       []string{"iso_a4_210x297mm"},
+			def:         "Photo",
+			want:        []string{"iso_a4_210x297mm"},
+			wantDefault: "Photo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotDefault := CanonicalMedia(tt.media, tt.def)
+			if !reflect.DeepEqual(got, tt.want) || gotDefault != tt.wantDefault {
+				t.Errorf("CanonicalMedia() = %v, %q; want %v, %q", got, gotDefault, tt.want, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestCheckMediaDefault(t *testing.T) {
+	labels := []string{"oe_4x6-label_4x6in", "oe_4x4-label_4x4in", "na_letter_8.5x11in"}
+	office := []string{"na_letter_8.5x11in", "iso_a4_210x297mm", "na_legal_8.5x14in", "iso_a3_297x420mm"}
+
+	tests := []struct {
+		name       string
+		media      []string
+		def        string
+		fallback   string
+		want       string
+		wantReason bool
+	}{
+		{"supported default", office, "iso_a4_210x297mm", "", "iso_a4_210x297mm", false},
+		{"unsupported default", office, "Custom.4x6in", "", "na_letter_8.5x11in", true},
+		{"unsupported default with fallback", office, "Custom.4x6in", "iso_a4_210x297mm", "iso_a4_210x297mm", true},
+		{"letter on a label printer", labels, "na_letter_8.5x11in", "", "oe_4x6-label_4x6in", true},
+		{"wider but plausible", office, "iso_a3_297x420mm", "", "iso_a3_297x420mm", false},
+		{"no media", nil, "iso_a4_210x297mm", "", "iso_a4_210x297mm", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := CheckMediaDefault(tt.media, tt.def, tt.fallback)
+			if got != tt.want || (reason != "") != tt.wantReason {
+				t.Errorf("CheckMediaDefault() = %q, %q; want %q, replaced %v", got, reason, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestParseMediaCols(t *testing.T) {
+	size := func(x, y int) []ipp.Attribute {
+		return []ipp.Attribute{{Tag: ipp.TagBeginCollection, Name: "media-size", Value: ipp.Collection{
+			"x-dimension": {{Tag: ipp.TagInteger, Name: "x-dimension", Value: x}},
+			"y-dimension": {{Tag: ipp.TagInteger, Name: "y-dimension", Value: y}},
+		}}}
+	}
+	attrs := ipp.Attributes{
+		"media-col-ready": {
+			{Tag: ipp.TagBeginCollection, Value: ipp.Collection{
+				"media-size":   size(21000, 29700),
+				"media-source": {{Tag: ipp.TagKeyword, Name: "media-source", Value: "tray-1"}},
+			}},
+			{Tag: ipp.TagBeginCollection, Value: ipp.Collection{
+				"media-size":   size(21000, 29700),
+				"media-source": {{Tag: ipp.TagKeyword, Name: "media-source", Value: "tray-2"}},
+				"media-type":   {{Tag: ipp.TagKeyword, Name: "media-type", Value: "stationery-letterhead"}},
+			}},
+		},
+	}
+
+	got := parseMediaCols(attrs, "media-col-ready", []string{"iso_a4_210x297mm"})
+	want := []MediaCol{
+		{SizeName: "iso_a4_210x297mm", Width: 21000, Height: 29700, Source: "tray-1"},
+		{SizeName: "iso_a4_210x297mm", Width: 21000, Height: 29700, Source: "tray-2", Type: "stationery-letterhead"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMediaCols() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMargins(t *testing.T) {
+	margins := func(values ...int) []ipp.Attribute {
+		attrs := make([]ipp.Attribute, len(values))
+		for i, v := range values {
+			attrs[i] = ipp.Attribute{Tag: ipp.TagInteger, Value: v}
+		}
+		return attrs
+	}
+
+	got := parseMargins(ipp.Attributes{
+		"media-top-margin-supported":    margins(0, 423),
+		"media-bottom-margin-supported": margins(423, 0),
+		"media-left-margin-supported":   margins(318),
+		"media-right-margin-supported":  margins(318),
+	})
+	want := &Margins{Top: 423, Bottom: 423, Left: 318, Right: 318}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMargins() = %+v, want %+v", got, want)
+	}
+
+	if got := parseMargins(ipp.Attributes{}); got != nil {
+		t.Errorf("parseMargins(none) = %+v, want nil", got)
+	}
+}
@@ -2,22 +2,31 @@ package cups
 
 // Printer represents a CUPS printer with its capabilities
 type Printer struct {
-	Name        string
-	URI         string
-	MakeModel   string
-	Location    string
-	Info        string
-	State       PrinterState
-	IsShared    bool
-	IsAccepting bool
+	Name         string
+	URI          string
+	DeviceURI    string // Backend URI, e.g. usb://... or socket://host
+	MakeModel    string
+	Location     string
+	Info         string
+	State        PrinterState
+	StateReasons []string // e.g. "media-empty-error" or "offline-report", nil for none
+	StateMessage string   // Explanation of the state for people, if CUPS has one
+	IsShared     bool
+	IsAccepting  bool
+	QueuedJobs   int
 
 	// Capabilities
-	ColorSupported  bool
-	DuplexSupported bool
-	Resolutions     []int    // DPI values
-	MediaSupported  []string // Paper sizes (e.g., "iso_a4_210x297mm")
-	MediaReady      []string // Currently loaded paper
-	MediaDefault    string   // Default paper size
+	ColorSupported    bool
+	DuplexSupported   bool
+	Resolutions       []int    // DPI values
+	DefaultResolution int      // DPI the printer uses by default, 0 if unknown
+	MediaSupported    []string // Paper sizes (e.g., "iso_a4_210x297mm")
+	MediaReady        []string // Currently loaded paper
+	MediaDefault      string   // Default paper size
+	MediaSources      []string // Trays, e.g. "tray-1", "manual"
+	MediaColReady     []MediaCol
+	MediaMargins      *Margins // nil if CUPS doesn't report them
+	Formats           []string // document-format-supported, only for printers queried directly
 }
 
 // PrinterState represents the CUPS printer state
@@ -47,3 +56,15 @@ func (s PrinterState) String() string {
 func (p *Printer) IsAvailable() bool {
 	return p.IsAccepting && p.State != PrinterStateStopped
 }
+
+// parseStateReasons returns the printer-state-reasons CUPS reported, leaving
+// out "none"
+func parseStateReasons(values []string) []string {
+	var reasons []string
+	for _, v := range values {
+		if v != "" && v != "none" {
+			reasons = append(reasons, v)
+		}
+	}
+	return reasons
+}
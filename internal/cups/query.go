@@ -0,0 +1,60 @@
+package cups
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/phin1x/go-ipp"
+)
+
+// queryAttributes are asked of printers queried directly: what CUPS is
+// asked for, plus the formats the printer takes
+var queryAttributes = append(append([]string{}, printerAttributes...), "document-format-supported")
+
+// QueryPrinter asks an IPP printer for its attributes directly rather than
+// through CUPS, e.g. to re-export a driverless printer on another subnet.
+// Printers don't say whether they are shared, so the result always is.
+func QueryPrinter(ctx context.Context, uri string) (Printer, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "ipp" && u.Scheme != "ipps") {
+		return Printer{}, fmt.Errorf("printer URI %q is not ipp:// or ipps://", uri)
+	}
+	port := 631
+	if u.Port() != "" {
+		if port, err = strconv.Atoi(u.Port()); err != nil {
+			return Printer{}, fmt.Errorf("invalid port in printer URI %q", uri)
+		}
+	}
+	scheme := "http"
+	if u.Scheme == "ipps" {
+		scheme = "https"
+	}
+	endpoint := (&url.URL{Scheme: scheme, Host: net.JoinHostPort(u.Hostname(), strconv.Itoa(port)), Path: u.Path}).String()
+
+	adapter := ipp.NewHttpAdapter(u.Hostname(), port, "", "", u.Scheme == "ipps",
+		ipp.WithHttpClient(&http.Client{Timeout: 10 * time.Second}))
+	req := ipp.NewRequest(ipp.OperationGetPrinterAttributes, 1)
+	req.OperationAttributes["printer-uri"] = uri
+	req.OperationAttributes["requesting-user-name"] = "airprint"
+	req.OperationAttributes["requested-attributes"] = queryAttributes
+
+	resp, err := adapter.SendRequestContext(ctx, endpoint, req, nil)
+	if err != nil {
+		return Printer{}, fmt.Errorf("failed to query printer: %w", err)
+	}
+	if len(resp.PrinterAttributes) == 0 {
+		return Printer{}, fmt.Errorf("printer returned no attributes")
+	}
+
+	attrs := resp.PrinterAttributes[0]
+	printer := parsePrinterAttributes("", attrs)
+	printer.DeviceURI = uri
+	printer.IsShared = true
+	printer.Formats = getAttributeStrings(attrs, "document-format-supported")
+	return printer, nil
+}
@@ -0,0 +1,136 @@
+package cups
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phin1x/go-ipp"
+)
+
+// Delimiter tags of IPP attribute groups
+const (
+	tagOperation = 0x01
+	tagEnd       = 0x03
+	tagPrinter   = 0x04
+)
+
+// ippAttr is one value of an attribute in an IPP response
+type ippAttr struct {
+	tag   byte
+	name  string // Empty for further values of the attribute before
+	value []byte
+}
+
+// ippResponse encodes a successful IPP response with printer attributes
+func ippResponse(attrs []ippAttr) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{2, 0, 0, 0, 0, 0, 0, 1}) // IPP 2.0, successful-ok, request 1
+	b.WriteByte(tagOperation)
+	attrs = append([]ippAttr{
+		{byte(ipp.TagCharset), "attributes-charset", []byte("utf-8")},
+		{byte(ipp.TagLanguage), "attributes-natural-language", []byte("en")},
+		{tagPrinter, "", nil},
+	}, attrs...)
+	for _, a := range attrs {
+		if a.tag == tagPrinter {
+			b.WriteByte(tagPrinter)
+			continue
+		}
+		b.WriteByte(a.tag)
+		_ = binary.Write(&b, binary.BigEndian, uint16(len(a.name)))
+		b.WriteString(a.name)
+		_ = binary.Write(&b, binary.BigEndian, uint16(len(a.value)))
+		b.Write(a.value)
+	}
+	b.WriteByte(tagEnd)
+	return b.Bytes()
+}
+
+func TestQueryPrinter(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", ipp.ContentTypeIPP)
+		_, _ = w.Write(ippResponse([]ippAttr{
+			{byte(ipp.TagText), "printer-make-and-model", []byte("Acme Laser 9000")},
+			{byte(ipp.TagEnum), "printer-state", []byte{0, 0, 0, 3}},
+			{byte(ipp.TagKeyword), "printer-state-reasons", []byte("none")},
+			{byte(ipp.TagBoolean), "printer-is-accepting-jobs", []byte{1}},
+			{byte(ipp.TagBoolean), "color-supported", []byte{1}},
+			{byte(ipp.TagKeyword), "sides-supported", []byte("one-sided")},
+			{byte(ipp.TagKeyword), "", []byte("two-sided-long-edge")},
+			{byte(ipp.TagResolution), "printer-resolution-supported", []byte{0, 0, 2, 0x58, 0, 0, 2, 0x58, 3}},
+			{byte(ipp.TagKeyword), "media-supported", []byte("iso_a4_210x297mm")},
+			{byte(ipp.TagKeyword), "media-default", []byte("iso_a4_210x297mm")},
+			{byte(ipp.TagMimeType), "document-format-supported", []byte("image/pwg-raster")},
+			{byte(ipp.TagMimeType), "", []byte("image/jpeg")},
+		}))
+	}))
+	defer srv.Close()
+	uri := "ipp://" + strings.TrimPrefix(srv.URL, "http://") + "/ipp/print"
+	p, err := QueryPrinter(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/ipp/print" {
+		t.Errorf("request path = %q, want /ipp/print", gotPath)
+	}
+	want := Printer{
+		DeviceURI:       uri,
+		MakeModel:       "Acme Laser 9000",
+		State:           PrinterStateIdle,
+		IsShared:        true,
+		IsAccepting:     true,
+		ColorSupported:  true,
+		DuplexSupported: true,
+		Resolutions:     []int{600},
+		MediaSupported:  []string{"iso_a4_210x297mm"},
+		MediaDefault:    "iso_a4_210x297mm",
+		Formats:         []string{"image/pwg-raster", "image/jpeg"},
+	}
+	p.MediaSources, p.MediaColReady, p.MediaMargins = nil, nil, nil
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("QueryPrinter() = %+v\nwant %+v", p, want)
+	}
+
+	for _, bad := range []string{"socket://host", "ipp://", "ipp://host:port/"} {
+		if _, err := QueryPrinter(context.Background(), bad); err == nil {
+			t.Errorf("QueryPrinter(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestQueryPrinter_StateReasons(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", ipp.ContentTypeIPP)
+		_, _ = w.Write(ippResponse([]ippAttr{
+			{byte(ipp.TagEnum), "printer-state", []byte{0, 0, 0, 5}},
+			{byte(ipp.TagKeyword), "printer-state-reasons", []byte("media-empty-error")},
+			{byte(ipp.TagKeyword), "", []byte("offline-report")},
+			{byte(ipp.TagText), "printer-state-message", []byte("Out of paper")},
+		}))
+	}))
+	defer srv.Close()
+	p, err := QueryPrinter(context.Background(), "ipp://"+strings.TrimPrefix(srv.URL, "http://")+"/ipp/print")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.State != PrinterStateStopped {
+		t.Errorf("State = %v, want stopped", p.State)
+	}
+	if want := []string{"media-empty-error", "offline-report"}; !reflect.DeepEqual(p.StateReasons, want) {
+		t.Errorf("StateReasons = %q, want %q", p.StateReasons, want)
+	}
+	if p.StateMessage != "Out of paper" {
+		t.Errorf("StateMessage = %q, want %q", p.StateMessage, "Out of paper")
+	}
+}
@@ -0,0 +1,18 @@
+package daemon
+
+import "github.com/WaffleThief123/airprint-bridge/internal/audit"
+
+// openAudit opens the audit log: its own file when one is configured,
+// otherwise the main log
+func (d *Daemon) openAudit() (*audit.Log, error) {
+	if d.config.AuditFile == "" {
+		d.log.Info().Msg("auditing print events to the log")
+		return audit.ToLogger(d.log), nil
+	}
+	log, err := audit.Open(d.config.AuditFile)
+	if err != nil {
+		return nil, err
+	}
+	d.log.Info().Str("file", d.config.AuditFile).Msg("auditing print events")
+	return log, nil
+}
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
+)
+
+// staticProvider is the name of the provider built from Config.AuthUsers
+const staticProvider = "users"
+
+// ippAuthProviders returns the providers that check print credentials. The
+// static users are used when no listener configuration names any.
+func (c Config) ippAuthProviders() []string {
+	if len(c.IPPAuth) == 0 && len(c.AuthUsers) > 0 {
+		return []string{staticProvider}
+	}
+	return c.IPPAuth
+}
+
+// defaultGroupCacheTTL is how long group memberships are remembered
+const defaultGroupCacheTTL = 5 * time.Minute
+
+// newAuthenticators builds the authenticators of the IPP and API listeners
+// and the printer access policy. Each is nil when not configured.
+func (d *Daemon) newAuthenticators() (ippAuth, apiAuth *auth.Authenticator, access *auth.Access, err error) {
+	config := d.config
+	configs := make(map[string]auth.ProviderConfig, len(config.AuthProviders)+1)
+	if len(config.AuthUsers) > 0 {
+		configs[staticProvider] = auth.ProviderConfig{Name: staticProvider, Type: auth.TypeStatic, Users: config.AuthUsers}
+	}
+	for _, p := range config.AuthProviders {
+		configs[p.Name] = p
+	}
+
+	// Listeners naming the same provider share it, so an htpasswd file is
+	// read once
+	providers := make(map[string]auth.Provider)
+	chain := func(names []string) ([]auth.Provider, error) {
+		var chain []auth.Provider
+		for _, name := range names {
+			if p, ok := providers[name]; ok {
+				chain = append(chain, p)
+				continue
+			}
+			cfg, ok := configs[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown auth provider %q", name)
+			}
+			p, err := auth.NewProvider(cfg)
+			if err != nil {
+				return nil, err
+			}
+			providers[name] = p
+			chain = append(chain, p)
+		}
+		return chain, nil
+	}
+
+	if config.authEnabled() {
+		var guests *auth.GuestTokens
+		if config.GuestTokens {
+			guests = auth.NewGuestTokens(config.GuestTokenMaxTTL)
+		}
+		ipp, err := chain(config.ippAuthProviders())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		ippAuth = auth.NewAuthenticator(ipp, guests, d.log)
+	}
+	if len(config.APIAuth) > 0 {
+		api, err := chain(config.APIAuth)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		apiAuth = auth.NewAuthenticator(api, nil, d.log)
+	}
+
+	if len(config.PrinterAccess) > 0 {
+		var groups auth.GroupResolver
+		if config.GroupProvider != "" {
+			providers, err := chain([]string{config.GroupProvider})
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			resolver, ok := providers[0].(auth.GroupResolver)
+			if !ok {
+				return nil, nil, nil, fmt.Errorf("auth provider %q can't look up groups", config.GroupProvider)
+			}
+			ttl := config.GroupCacheTTL
+			if ttl <= 0 {
+				ttl = defaultGroupCacheTTL
+			}
+			groups = auth.NewGroupCache(resolver, ttl)
+		}
+		if access, err = auth.NewAccess(config.PrinterAccess, groups); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return ippAuth, apiAuth, access, nil
+}
@@ -2,60 +2,235 @@ package daemon
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 
+	"github.com/WaffleThief123/airprint-bridge/internal/airprint"
+	"github.com/WaffleThief123/airprint-bridge/internal/api"
+	"github.com/WaffleThief123/airprint-bridge/internal/auth"
 	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
 	"github.com/WaffleThief123/airprint-bridge/internal/cups"
 	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/labels"
+	"github.com/WaffleThief123/airprint-bridge/internal/location"
+	"github.com/WaffleThief123/airprint-bridge/internal/mdns"
 	"github.com/WaffleThief123/airprint-bridge/internal/media"
+	"github.com/WaffleThief123/airprint-bridge/internal/metrics"
+	"github.com/WaffleThief123/airprint-bridge/internal/privsep"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+	"github.com/WaffleThief123/airprint-bridge/internal/schedule"
+	"github.com/WaffleThief123/airprint-bridge/internal/state"
+	"github.com/WaffleThief123/airprint-bridge/internal/systemd"
+	"github.com/WaffleThief123/airprint-bridge/internal/upgrade"
+	"github.com/WaffleThief123/airprint-bridge/internal/webhook"
 )
 
+// jobPollInterval is how often active jobs are polled in CUPS
+const jobPollInterval = 2 * time.Second
+
 // Config holds the daemon configuration
 type Config struct {
-	CUPSHost       string
-	CUPSPort       int
-	IPPPort        int // Port for our IPP proxy server
-	PollInterval   time.Duration
-	ServiceDir     string
-	FilePrefix     string
-	SharedOnly     bool
-	ExcludeList    []string
-	MediaOverrides []media.ConfigOverride // Per-printer media overrides
+	CUPSHost          string
+	CUPSPort          int
+	CUPSUser          string              // User sent to CUPS with every job, empty for none
+	CUPSPassword      string              // Password for CUPSUser
+	CUPSPrinterAuth   map[string]CUPSAuth // Printer name -> how jobs for it authenticate with CUPS
+	IPPPort           int                 // Port for our IPP proxy server
+	TLSPort           int                 // Port for the IPPS listener (used when cert and key are set)
+	PrinterPortBase   int                 // First port of printers served on their own port, 0 to share IPPPort
+	PrinterPorts      map[string]int      // Printer name -> dedicated IPP port
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSMinVersion     uint16        // Oldest TLS version the IPPS listener accepts, 0 for TLS 1.2
+	TLSCipherSuites   []uint16      // TLS 1.2 cipher suites, nil for Go's defaults
+	TLSNoTickets      bool          // Disable TLS session resumption
+	SubmitTimeout     time.Duration // Limit on forwarding one job to CUPS, 0 for none
+	StatusTTL         time.Duration // How long printer status fetched live from CUPS is reused, 0 to report the last poll's
+	TraceJobNames     bool          // Append each job's trace ID to its CUPS job name
+	Quirks            []ipp.Quirk   // Client workarounds, checked in order
+	StallTimeout      time.Duration // Abort an upload after this long without data, 0 for none
+	MinUploadRate     int           // Bytes per second an upload must average, 0 for no minimum
+	MaxConnsPerIP     int           // Concurrent IPP connections per client address, 0 or less for no limit
+	ReadTimeout       time.Duration // Limit on reading a request's headers, 0 for none
+	WriteTimeout      time.Duration // Limit on answering after a request's last data arrives, 0 for none
+	MaxHeaderBytes    int           // Largest IPP request headers accepted
+	MaxDocumentSize   int64         // Largest IPP request, document included, in bytes, 0 for no limit
+	MaxQueuedJobs     int           // Jobs waiting or printing per printer before new ones are refused, 0 for no limit
+	MaxConcurrentJobs int           // Jobs being sent through the bridge at once before new ones are refused, 0 for no limit
+	MaxClientJobs     int           // The same for one client address, 0 for no limit
+	PollInterval      time.Duration
+	ServiceDir        string
+	MDNSInterfaces    []string // Advertise only on these interfaces with the built-in responder instead of Avahi
+	PreferInterfaces  []string // Interfaces whose address printer URIs name, in order of preference
+	ReflectFrom       []string // Interfaces printers are browsed for on, to re-announce on ReflectTo
+	ReflectTo         []string
+	ReflectInclude    []string // Instance name patterns of the only printers to reflect; overrides ReflectExclude
+	ReflectExclude    []string
+	ReflectInterval   time.Duration // How often to browse, 0 for every 30s
+	FilePrefix        string
+	LegacyFiles       string // How to handle other tools' AirPrint service files: keep, replace or adopt
+	SharedOnly        bool
+	IncludeList       []string // Name patterns of the only printers to advertise; overrides ExcludeList
+	ExcludeList       []string
+	MediaOverrides    []media.ConfigOverride // Per-printer media overrides
+	MediaProfiles     []media.Profile        // Profiles defined in the config file
+	Failover          map[string]string      // Primary queue -> backup queue
+	VirtualPrinters   []VirtualPrinter
+	StagedPrinters    []StagedPrinter  // Variants of printers advertised side by side for testing
+	NullPrinter       string           // Name of a test printer that discards jobs, empty to disable
+	StateDir          string           // Where state kept across restarts is written
+	ArchiveDir        string           // Where printed documents are kept for reprinting, empty to disable
+	ArchiveMaxAge     time.Duration    // How long archived documents are kept, 0 for no limit
+	ArchiveQuota      int64            // Bytes archived per printer before the oldest are evicted, 0 for no limit
+	ArchiveQuotas     map[string]int64 // printer -> bytes, overriding ArchiveQuota
+	WebhookURLs       []string
+	APIListen         string                          // Admin API listen address; empty disables the API
+	APIToken          string                          // Bearer token command line tools send to the API; unused by the daemon
+	TimeZone          string                          // Zone the API shows times in, empty for the host's
+	Hour12            bool                            // Show times on web pages with a 12-hour clock
+	LabelDir          string                          // Directory of label templates served by the API
+	Schedules         map[string]schedule.Schedule    // Printer name -> when it is served
+	URFConversion     map[string]string               // Printer name -> format image/urf jobs are converted to
+	FormatFallback    map[string][]string             // Printer name -> formats image/urf jobs are retried in when CUPS rejects the format
+	Watermarks        map[string]string               // Printer name -> text stamped on every page
+	PrinterFeatures   map[string][]string             // Printer name -> experimental behaviors enabled, see ipp.Features
+	Identify          map[string]IdentifyConfig       // Printer name -> how Identify-Printer reaches the device
+	PrintScaling      map[string]ipp.Scaling          // Printer name -> how pages are scaled onto the media
+	QueueLimits       map[string]int                  // Printer name -> MaxQueuedJobs for that printer
+	HoldJobs          map[string]bool                 // Printers whose jobs wait until released by their owner
+	HoldTimeout       time.Duration                   // Held jobs never released are cancelled after this long
+	ReleasePINs       map[string]string               // User name -> SHA-256 of the PIN typed at release kiosks
+	DisplayNames      map[string]string               // Printer name -> name advertised to clients
+	URFOverrides      map[string]airprint.URFOverride // Printer name -> adjustments to the URF string
+	DocumentFormats   map[string][]string             // Printer name -> preferred document formats, first is the default
+	LocationSources   []LocationSource                // Tried in order to fill in printer locations
+	LocationOverride  bool                            // Replace locations already set in CUPS
+	GeoLocations      map[string]string               // Printer name -> geo: URI of where it is
+	PrinterIcons      map[string]string               // Printer name -> PNG file served as its icon
+	RawPrinters       map[string]string               // Printer name -> raw port jobs are sent to as ZPL, "" for the device URI's host
+	Standalone        []StandalonePrinter             // Network printers served without a CUPS queue
+	LogLevel          string                          // zerolog level name, applied on reload
+	LogFormat         string                          // json or console, fixed at startup
+	LogOutput         string                          // stdout, syslog or journald, fixed at startup
+	SyslogFacility    string                          // Facility of syslog entries, e.g. daemon or local0
+	SyslogTag         string                          // Tag of syslog entries and identifier of journald ones
+	SyslogAddress     string                          // Remote syslog server as [udp://|tcp://]host:port, "" for the local one
+	LogFile           string                          // File logs are written to instead of stdout, "" for none
+	LogMaxSize        int64                           // Bytes LogFile is rotated at, 0 for no limit
+	LogMaxAge         time.Duration                   // Rotated log files older than this are removed, 0 to keep them
+	LogMaxBackups     int                             // Rotated log files kept, 0 for all
+	ConfigFile        string                          // Config file path, watched when WatchConfig is set
+	WatchConfig       bool                            // Reload when ConfigFile changes
+	AuthUsers         map[string]string               // User name -> SHA-256 password hash; enables print authentication
+	GuestTokens       bool                            // Allow guest tokens minted in the web UI as passwords
+	GuestTokenMaxTTL  time.Duration                   // Longest lifetime a guest token may be minted with
+	AuthProviders     []auth.ProviderConfig           // Named sources of users, picked per listener
+	IPPAuth           []string                        // Providers asked for print credentials, in order
+	APIAuth           []string                        // Providers asked for admin API credentials; empty leaves the API open
+	APITokens         map[string]string               // Token name -> SHA-256 of a bearer token accepted by the admin API
+	PrinterAccess     map[string]auth.AccessRule      // Printer name -> who may print to it
+	GroupProvider     string                          // Provider resolving the groups named in PrinterAccess
+	GroupCacheTTL     time.Duration                   // How long group memberships are cached
+	RunAsUser         string                          // User switched to once ports are bound, empty to keep running as started
+	RunAsGroup        string                          // Group switched to, empty for RunAsUser's primary group
+	AllowedNetworks   []*net.IPNet                    // IPP clients are served from these networks only, nil for any
+	AuditLog          bool                            // Record every Print-Job and Cancel-Job
+	AuditFile         string                          // Where audit records are written, empty for the main log
 }
 
 // DefaultConfig returns sensible defaults
 func DefaultConfig() Config {
 	return Config{
-		CUPSHost:     "localhost",
-		CUPSPort:     631,
-		IPPPort:      8631,
-		PollInterval: 30 * time.Second,
-		ServiceDir:   "/etc/avahi/services",
-		FilePrefix:   "airprint-",
-		SharedOnly:   true,
-		ExcludeList:  nil,
+		CUPSHost:       "localhost",
+		CUPSPort:       631,
+		IPPPort:        8631,
+		TLSPort:        8632,
+		StallTimeout:   60 * time.Second,
+		MaxConnsPerIP:  32,
+		ReadTimeout:    60 * time.Second,
+		WriteTimeout:   60 * time.Second,
+		MaxHeaderBytes: 64 << 10,
+		HoldTimeout:    24 * time.Hour,
+		PollInterval:   30 * time.Second,
+		StatusTTL:      5 * time.Second,
+		StateDir:       "/var/lib/airprint-bridge",
+		ServiceDir:     "/etc/avahi/services",
+		FilePrefix:     "airprint-",
+		LegacyFiles:    avahi.LegacyKeep,
+		SharedOnly:     true,
+		ExcludeList:    nil,
+		LogOutput:      "stdout",
+		LogMaxSize:     10 << 20,
+		LogMaxBackups:  5,
+		SyslogFacility: "daemon",
+		SyslogTag:      "airprint-bridge",
 	}
 }
 
 // Daemon is the main AirPrint bridge daemon
+//
+// Reloads and syncs run in the main loop, which alone writes config, served,
+// mediaRegistry, mediaProfiles, mediaDefaults and locations. Only config is
+// read elsewhere, by API handlers through currentConfig; the others must
+// stay out of reach of the API and IPP handlers, which see printers through
+// the IPP server instead.
 type Daemon struct {
-	config        Config
-	cupsClient    *cups.Client
-	avahiManager  *avahi.Manager
-	mediaRegistry *media.Registry
-	ippServers    map[string]*ipp.Server
-	log           zerolog.Logger
+	configMu       sync.RWMutex // Held by reloads while writing config, which only the main loop does
+	config         Config
+	cupsClient     *cups.Client
+	avahiManager   *avahi.Manager
+	mediaRegistry  *media.Registry // Main loop only, replaced on reload
+	ippServer      *ipp.Server
+	apiServer      *api.Server     // nil unless the admin API is enabled
+	responder      *mdns.Responder // nil when advertising through Avahi
+	upgrader       *upgrade.Upgrader
+	runAs          *privsep.Credentials // nil unless privileges are dropped after startup
+	helper         *privsep.Helper      // nil unless service files are written through a privileged helper
+	mediaProfiles  map[string]string    // printer name -> media profile last applied
+	mediaDefaults  map[string]string    // printer name -> bad default media last warned about
+	archive        *jobs.Archive        // nil unless printed documents are kept
+	state          *state.Store         // nil if the state directory is unusable
+	served         []cups.Printer       // Printers served as of the last sync, main loop only
+	outage         *outage              // nil while CUPS is reachable
+	tracker        *jobs.Tracker
+	scheduleStates map[string]bool // printer name -> schedule state last seen
+	upstreamMu     sync.Mutex
+	upstream       map[string]upstreamPrinter // re-exported printer name -> what it last said
+	notifier       *webhook.Notifier
+	locations      *location.Resolver // Main loop only, replaced on reload
+	reloadFunc     ReloadFunc
+	configFunc     api.ConfigFunc      // nil unless the configuration can be shown in the API
+	syncRequests   chan chan error     // Syncs asked for through the API, answered by the main loop
+	auth           *auth.Authenticator // nil when printing needs no credentials
+	apiAuth        *auth.Authenticator // nil when the admin API is open
+	access         *auth.Access        // nil when every user may print to every printer
+	metrics        *metrics.Registry
+	deniedJobs     *metrics.CounterVec
+	archiveEvicted *metrics.CounterVec
+	resources      *metrics.ResourceMonitor
+	logLevel       logLevel
+	startedAt      time.Time
+	hostname       string // Printer UUIDs are derived from it
+	version        string // Build version, reported over IPP and the API
+	commit         string
+	log            zerolog.Logger
 }
 
 // New creates a new daemon instance
 func New(config Config, log zerolog.Logger) *Daemon {
+	config = config.withStaged()
 	cupsClient := cups.NewClient(config.CUPSHost, config.CUPSPort)
 	avahiManager := avahi.NewManager(
 		config.ServiceDir,
@@ -65,23 +240,148 @@ func New(config Config, log zerolog.Logger) *Daemon {
 	)
 
 	// Initialize media registry with builtin profiles and apply config overrides
-	mediaRegistry := media.NewRegistry()
-	if len(config.MediaOverrides) > 0 {
-		mediaRegistry.ApplyConfigOverrides(config.MediaOverrides)
+	mediaRegistry := newMediaRegistry(config)
+
+	// Keep failover primaries advertised so their jobs can be redirected
+	if len(config.Failover) > 0 {
+		primaries := make([]string, 0, len(config.Failover))
+		for primary := range config.Failover {
+			primaries = append(primaries, primary)
+		}
+		avahiManager.SetPinned(primaries)
+	}
+	avahiManager.SetFormatPreferences(config.DocumentFormats)
+	avahiManager.SetDisplayNames(config.DisplayNames)
+	avahiManager.SetURFOverrides(config.URFOverrides)
+
+	registry := metrics.NewRegistry()
+
+	d := &Daemon{
+		config:         config,
+		cupsClient:     cupsClient,
+		avahiManager:   avahiManager,
+		mediaRegistry:  mediaRegistry,
+		mediaProfiles:  make(map[string]string),
+		mediaDefaults:  make(map[string]string),
+		scheduleStates: make(map[string]bool),
+		syncRequests:   make(chan chan error),
+		upstream:       make(map[string]upstreamPrinter),
+		notifier:       webhook.NewNotifier(config.WebhookURLs, log),
+		locations:      newLocationResolver(config, log),
+		metrics:        registry,
+		deniedJobs: registry.Counter(
+			"airprint_bridge_jobs_denied_total",
+			"Jobs refused by CUPS because of a quota or policy.",
+			"printer", "reason",
+		),
+		archiveEvicted: registry.Counter(
+			"airprint_bridge_archive_evicted_total",
+			"Archived documents removed to keep a printer within its quota.",
+			"printer",
+		),
+		logLevel: logLevel{configured: zerolog.GlobalLevel()}, // Set from log.level before startup
+		log:      log.With().Str("component", "daemon").Logger(),
+	}
+	d.resources = metrics.NewResourceMonitor(os.TempDir(), ipp.SpoolPrefix, d.connections)
+	d.resources.Register(registry, "airprint_bridge")
+	registry.GaugeVec("airprint_bridge_archive_bytes", "Bytes of documents archived per printer.", "printer", d.archiveUsage)
+	d.hostname, _ = os.Hostname()
+	avahiManager.SetUUIDFunc(d.printerUUID)
+	avahiManager.SetMediaFunc(d.advertisedMedia)
+	return d
+}
+
+// printerUUID returns the UUID a printer is advertised and reported with.
+// The UUID a printer was first given is kept in the state directory, so it
+// survives a change of hostname.
+func (d *Daemon) printerUUID(name string) string {
+	derive := func() string { return airprint.PrinterUUID(d.hostname, name) }
+	if d.state == nil {
+		return derive()
+	}
+	return d.state.UUID(name, derive)
+}
+
+// advertisedMedia returns the media sizes a printer is advertised with:
+// its media profile's, or CUPS's without one
+func (d *Daemon) advertisedMedia(p *cups.Printer) []string {
+	cupsMedia, cupsDefault := cups.CanonicalMedia(p.MediaSupported, p.MediaDefault)
+	media, _ := d.mediaRegistry.ApplyProfile(p.Name, p.MakeModel, cupsMedia, cupsDefault)
+	return media
+}
+
+// connections counts the IPP server's client connections, once it's started
+func (d *Daemon) connections() (open, idle int) {
+	if d.ippServer == nil {
+		return 0, 0
+	}
+	return d.ippServer.Connections()
+}
+
+// authEnabled reports whether print jobs require credentials
+func (c Config) authEnabled() bool {
+	return len(c.AuthUsers) > 0 || c.GuestTokens || len(c.IPPAuth) > 0
+}
+
+// CUPSAuth is how jobs for one printer authenticate with CUPS: with fixed
+// credentials, or by relaying the ones the client prints with
+type CUPSAuth struct {
+	User     string
+	Password string
+	Relay    bool
+}
+
+// cupsCredentials returns the fixed CUPS credentials of each printer
+func (c Config) cupsCredentials() map[string]ipp.Credentials {
+	creds := make(map[string]ipp.Credentials)
+	for name, a := range c.CUPSPrinterAuth {
+		if !a.Relay && a.User != "" {
+			creds[name] = ipp.Credentials{User: a.User, Password: a.Password}
+		}
 	}
+	return creds
+}
 
-	return &Daemon{
-		config:        config,
-		cupsClient:    cupsClient,
-		avahiManager:  avahiManager,
-		mediaRegistry: mediaRegistry,
-		ippServers:    make(map[string]*ipp.Server),
-		log:           log.With().Str("component", "daemon").Logger(),
+// relayAuthPrinters returns the printers that pass client credentials to CUPS
+func (c Config) relayAuthPrinters() []string {
+	var names []string
+	for name, a := range c.CUPSPrinterAuth {
+		if a.Relay {
+			names = append(names, name)
+		}
 	}
+	return names
+}
+
+// tlsEnabled reports whether an IPPS listener should be started
+func (c Config) tlsEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// ippTLSConfig returns the IPPS listener's settings, with the certificate
+// read from its files. Session ticket keys are kept in the state directory
+// so iOS clients resume their sessions across restarts.
+func (d *Daemon) ippTLSConfig() (ipp.TLSConfig, error) {
+	cert, err := tls.LoadX509KeyPair(d.config.TLSCertFile, d.config.TLSKeyFile)
+	if err != nil {
+		return ipp.TLSConfig{}, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cfg := ipp.TLSConfig{
+		ListenAddr:       fmt.Sprintf(":%d", d.config.TLSPort),
+		Certificate:      cert,
+		MinVersion:       d.config.TLSMinVersion,
+		CipherSuites:     d.config.TLSCipherSuites,
+		NoSessionTickets: d.config.TLSNoTickets,
+	}
+	if d.state != nil {
+		cfg.SessionKeyFile = filepath.Join(d.config.StateDir, "tls-session-keys")
+	}
+	return cfg, nil
 }
 
 // Run starts the daemon and blocks until shutdown
 func (d *Daemon) Run(ctx context.Context) error {
+	d.startedAt = time.Now().UTC()
 	d.log.Info().
 		Str("cups_host", d.config.CUPSHost).
 		Int("cups_port", d.config.CUPSPort).
@@ -92,82 +392,188 @@ func (d *Daemon) Run(ctx context.Context) error {
 		Msg("starting AirPrint bridge daemon")
 
 	// Verify CUPS connection
-	if err := d.cupsClient.TestConnection(); err != nil {
+	if err := d.waitForCUPS(ctx); err != nil {
 		return fmt.Errorf("cannot connect to CUPS: %w", err)
 	}
 	d.log.Info().Msg("connected to CUPS")
 
-	// Verify service directory exists and is writable
-	if err := d.verifyServiceDir(); err != nil {
+	if err := d.setupPrivsep(); err != nil {
+		return err
+	}
+
+	if d.config.reflectEnabled() {
+		if err := d.startReflector(ctx); err != nil {
+			return err
+		}
+	}
+	if len(d.config.MDNSInterfaces) > 0 {
+		if err := d.startResponder(ctx); err != nil {
+			return err
+		}
+	} else {
+		// Verify service directory exists and is writable
+		if err := d.verifyServiceDir(); err != nil {
+			return err
+		}
+		if err := d.avahiManager.HandleLegacyFiles(d.config.LegacyFiles); err != nil {
+			return err
+		}
+		// Files left by a run that didn't shut down cleanly are removed by
+		// the first update, unless their printer is still advertised
+		if err := d.avahiManager.DiscoverExisting(); err != nil {
+			return err
+		}
+	}
+
+	// Fail early on unusable certificates rather than when the first client
+	// connects, and read them while the files are sure to be readable, not
+	// after privileges are dropped
+	var tlsConfig *ipp.TLSConfig
+	if d.config.tlsEnabled() {
+		cfg, err := d.ippTLSConfig()
+		if err != nil {
+			return err
+		}
+		tlsConfig = &cfg
+	}
+
+	ippAuth, apiAuth, access, err := d.newAuthenticators()
+	if err != nil {
+		return fmt.Errorf("failed to configure authentication: %w", err)
+	}
+	d.auth, d.apiAuth, d.access = ippAuth, apiAuth, access
+
+	// Take over the sockets of the process this one replaces, if any
+	upgrader, err := upgrade.New(d.log)
+	if err != nil {
+		return err
+	}
+	d.upgrader = upgrader
+	// And those systemd opened, if it started the bridge for a connection
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return err
+	}
+	if err := d.upgrader.Activate(activated); err != nil {
 		return err
 	}
 
 	// Get initial printer list
-	printers, err := d.cupsClient.GetPrinters()
+	printers, err := d.cupsPrinters()
 	if err != nil {
 		return fmt.Errorf("failed to get printers: %w", err)
 	}
 	d.log.Info().Int("count", len(printers)).Msg("discovered printers")
+	d.openState(printers)
 
 	// Start the IPP proxy server
-	cupsProxy := ipp.NewCUPSProxy(d.config.CUPSHost, d.config.CUPSPort)
-
-	// Determine local IP for advertising
-	localIP := d.getLocalIP()
-	d.log.Info().Str("local_ip", localIP).Msg("detected local IP")
+	baseProxy := ipp.NewCUPSProxy(d.config.CUPSHost, d.config.CUPSPort)
+	baseProxy.SetCredentials(ipp.Credentials{User: d.config.CUPSUser, Password: d.config.CUPSPassword}, d.config.cupsCredentials())
+	d.avahiManager.SetAuthPrinters(d.config.relayAuthPrinters())
+	var cupsProxy ipp.CUPSClient = baseProxy
+	var statusSource jobs.StatusSource = baseProxy
+	if len(d.config.Standalone) > 0 {
+		backends, err := d.config.backends()
+		if err != nil {
+			return err
+		}
+		backendProxy := ipp.NewBackendProxy(baseProxy, backends, d.log)
+		cupsProxy, statusSource = backendProxy, backendProxy
+	}
+	if len(d.config.Failover) > 0 {
+		cupsProxy = ipp.NewFailoverProxy(cupsProxy, d.config.Failover, d.printerAvailable, d.onFailover)
+	}
+	if groups := d.config.broadcastGroups(); len(groups) > 0 {
+		cupsProxy = ipp.NewBroadcastProxy(cupsProxy, groups, d.log)
+	}
+	if pools := d.config.balancePools(); len(pools) > 0 {
+		cupsProxy = ipp.NewBalanceProxy(cupsProxy, pools, d.memberStates, d.log)
+	}
+	if len(d.config.StagedPrinters) > 0 {
+		cupsProxy = ipp.NewAliasProxy(cupsProxy, d.config.stagedQueues())
+	}
+	if d.config.NullPrinter != "" {
+		nullProxy := ipp.NewNullProxy(cupsProxy, d.config.NullPrinter, d.log)
+		cupsProxy, statusSource = nullProxy, nullProxy
+	}
 
 	// Start IPP server
 	listenAddr := fmt.Sprintf(":%d", d.config.IPPPort)
 
-	// For now, use first printer (we can expand to multiple later)
-	var printerConfig ipp.PrinterConfig
-	if len(printers) > 0 {
-		p := printers[0]
-
-		// Get media from CUPS, then apply profile overrides
-		cupsMedia := p.MediaReady
-		if len(cupsMedia) == 0 {
-			cupsMedia = p.MediaSupported
-		}
-		mediaList, mediaDefault := d.mediaRegistry.ApplyProfile(
-			p.Name,
-			p.MakeModel,
-			cupsMedia,
-			p.MediaDefault,
-		)
-
-		// Log whether we used a profile or CUPS defaults
-		if profile := d.mediaRegistry.GetProfile(p.Name, p.MakeModel); profile != nil {
-			d.log.Info().
-				Str("printer", p.Name).
-				Str("profile", profile.Name).
-				Strs("media", mediaList).
-				Str("default", mediaDefault).
-				Msg("using media profile override")
-		} else {
-			d.log.Debug().
-				Str("printer", p.Name).
-				Strs("cups_media", cupsMedia).
-				Str("cups_default", p.MediaDefault).
-				Msg("using CUPS media configuration")
-		}
+	// Track submitted jobs so clients see real progress from CUPS
+	tracker := jobs.NewTracker(statusSource, d.log)
+	if d.state != nil {
+		tracker.Restore(d.state.Jobs())
+	}
+	d.tracker = tracker
+	go tracker.Run(ctx, jobPollInterval)
 
-		printerConfig = ipp.PrinterConfig{
-			Name:           p.Name,
-			MakeModel:      p.MakeModel,
-			Location:       p.Location,
-			Color:          p.ColorSupported,
-			Duplex:         p.DuplexSupported,
-			Resolutions:    p.Resolutions,
-			MediaSupported: mediaList,
-			MediaReady:     mediaList, // Use the same filtered list
-			MediaDefault:   mediaDefault,
+	ippServer := ipp.NewServer(listenAddr, cupsProxy, tracker, d.log)
+	ippServer.SetListenFunc(d.upgrader.Listen)
+	served := d.servedPrinters(printers)
+	d.served = served
+	ippServer.SetPrinters(d.ippPrinters(served))
+	ippServer.SetDeniedHandler(d.onJobDenied)
+	if d.config.AuditLog {
+		log, err := d.openAudit()
+		if err != nil {
+			return err
 		}
+		ippServer.SetAuditLog(log)
 	}
+	ippServer.SetSubmitTimeout(d.config.SubmitTimeout)
+	if d.config.StatusTTL > 0 {
+		ippServer.SetLiveStatus(baseProxy.PrinterStatus, d.config.StatusTTL)
+	}
+	ippServer.SetTraceJobNames(d.config.TraceJobNames)
+	ippServer.SetQuirks(d.config.Quirks)
+	ippServer.SetBuildInfo(d.buildInfo())
+	ippServer.EnableRelease(baseProxy)
+	if d.config.ArchiveDir != "" {
+		archive, err := jobs.NewArchive(d.config.ArchiveDir, d.config.ArchiveMaxAge)
+		if err != nil {
+			return err
+		}
+		archive.SetQuotas(d.config.ArchiveQuota, d.config.ArchiveQuotas)
+		archive.SetEvictHandler(d.onArchiveEvicted)
+		ippServer.SetArchive(archive)
+		d.archive = archive
+	}
+	ippServer.SetClientLimits(ipp.ClientLimits{
+		StallTimeout:   d.config.StallTimeout,
+		MinUploadRate:  d.config.MinUploadRate,
+		MaxConnsPerIP:  d.config.MaxConnsPerIP,
+		ReadTimeout:    d.config.ReadTimeout,
+		WriteTimeout:   d.config.WriteTimeout,
+		MaxHeaderBytes: d.config.MaxHeaderBytes,
+		MaxRequestSize: d.config.MaxDocumentSize,
+	})
+	ippServer.SetAllowedNetworks(d.config.AllowedNetworks)
+	ippServer.SetJobLimits(d.config.jobLimits())
+	if d.auth != nil {
+		ippServer.SetAuthenticator(d.auth.Check)
+		d.avahiManager.SetAuthRequired(true)
+		if d.access != nil {
+			ippServer.SetAccessCheck(d.access.Allowed)
+		}
+	}
+	d.ippServer = ippServer
+
+	// Printer URIs name the preferred local address, following changes
+	prefer := d.config.addrPreference()
+	addrs := localAddrs(prefer)
+	d.log.Info().Strs("addresses", addrStrings(addrs)).Msg("detected local addresses")
+	d.advertiseAddrs(addrs)
+	go d.watchAddrs(ctx, prefer, addrs)
 
-	ippServer := ipp.NewServer(listenAddr, cupsProxy, printerConfig, d.log)
+	if tlsConfig != nil {
+		ippServer.EnableTLS(*tlsConfig)
+	}
 
 	// Start IPP server in background
+	if err := ippServer.Listen(); err != nil {
+		return fmt.Errorf("failed to start IPP server: %w", err)
+	}
 	go func() {
 		if err := ippServer.ListenAndServe(); err != nil {
 			d.log.Error().Err(err).Msg("IPP server failed")
@@ -175,19 +581,65 @@ func (d *Daemon) Run(ctx context.Context) error {
 	}()
 	d.log.Info().Int("port", d.config.IPPPort).Msg("started IPP proxy server")
 
+	if d.config.tlsEnabled() {
+		go func() {
+			if err := ippServer.ListenAndServeTLS(); err != nil {
+				d.log.Error().Err(err).Msg("IPPS server failed")
+			}
+		}()
+		d.avahiManager.SetTLSPort(d.config.TLSPort)
+		d.log.Info().Int("port", d.config.TLSPort).Msg("started IPPS proxy server")
+	}
+
+	if d.config.APIListen != "" {
+		if err := d.startAPI(ippServer); err != nil {
+			return err
+		}
+	}
+
+	// Everything privileged is done; service files go through the helper
+	if err := d.dropPrivileges(); err != nil {
+		return err
+	}
+
 	// Update Avahi service files
-	if err := d.avahiManager.UpdatePrinters(printers, d.config.SharedOnly, d.config.ExcludeList); err != nil {
+	d.avahiManager.SetPorts(d.config.printerPorts(served))
+	if err := d.avahiManager.UpdatePrinters(served, d.config.SharedOnly, d.config.IncludeList, d.config.ExcludeList); err != nil {
 		d.log.Error().Err(err).Msg("failed to update service files")
 	}
 
+	// Serving and advertising, so a process this one replaces can exit
+	if d.upgrader.Upgraded() {
+		d.log.Info().Msg("took over from previous process")
+	}
+	if err := d.upgrader.Ready(); err != nil {
+		d.log.Error().Err(err).Msg("failed to signal previous process")
+	}
+	d.notify(systemd.Ready)
+
 	// Set up signal handling
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	// Reload when the config file changes, if enabled
+	configChanged := make(chan struct{}, 1)
+	if d.config.WatchConfig && d.config.ConfigFile != "" {
+		go d.watchConfig(ctx, configChanged)
+	}
 
 	// Main loop
 	ticker := time.NewTicker(d.config.PollInterval)
 	defer ticker.Stop()
 
+	// The watchdog is fed from the main loop, so systemd restarts a bridge
+	// whose printer polling hangs
+	var watchdog <-chan time.Time
+	if interval := systemd.WatchdogInterval(); interval > 0 {
+		watchdogTicker := time.NewTicker(interval)
+		defer watchdogTicker.Stop()
+		watchdog = watchdogTicker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -198,36 +650,526 @@ func (d *Daemon) Run(ctx context.Context) error {
 			switch sig {
 			case syscall.SIGHUP:
 				d.log.Info().Msg("received SIGHUP, reloading")
-				if err := d.syncPrinters(); err != nil {
-					d.log.Error().Err(err).Msg("reload failed")
-				}
+				d.reload(ticker)
 			case syscall.SIGTERM, syscall.SIGINT:
 				d.log.Info().Str("signal", sig.String()).Msg("received shutdown signal")
 				return d.shutdown()
+			case syscall.SIGUSR1:
+				d.toggleDebug()
+			case syscall.SIGUSR2:
+				d.log.Info().Msg("received SIGUSR2, starting new process")
+				if d.upgrade() {
+					return d.handOver()
+				}
 			}
 
-		case <-ticker.C:
+		case <-configChanged:
+			d.log.Info().Str("path", d.config.ConfigFile).Msg("config file changed, reloading")
+			d.reload(ticker)
+
+		case <-watchdog:
+			d.notify(systemd.Watchdog)
+
+		case <-d.outageRetry():
 			if err := d.syncPrinters(); err != nil {
-				d.log.Error().Err(err).Msg("printer sync failed")
+				d.logSyncError(err, "printer sync failed")
 			}
+
+		case reply := <-d.syncRequests:
+			d.log.Info().Msg("syncing printers on request")
+			err := d.syncPrinters()
+			if err != nil {
+				d.logSyncError(err, "printer sync failed")
+			}
+			reply <- err
+
+		case <-ticker.C:
+			// During an outage CUPS is retried on its own schedule
+			if d.outage == nil {
+				if err := d.syncPrinters(); err != nil {
+					d.logSyncError(err, "printer sync failed")
+				}
+			}
+			if d.config.HoldTimeout > 0 {
+				d.ippServer.ExpireHeldJobs(d.config.HoldTimeout)
+			}
+			// Sample between scrapes too, so short peaks still count
+			d.resources.Sample()
+			d.pruneArchive()
+			d.saveState()
 		}
 	}
 }
 
+// startAPI starts the admin API server in the background
+func (d *Daemon) startAPI(ippServer *ipp.Server) error {
+	apiServer := api.NewServer(d.config.APIListen, d.log)
+	apiServer.SetListenFunc(d.upgrader.Listen)
+	apiServer.SetTimeDisplay(d.config.timeZone(), d.config.Hour12)
+	apiServer.EnableMaintenance(ippServer)
+	apiServer.EnableTransforms(ippServer)
+	apiServer.EnablePreview(ippServer)
+	apiServer.EnableMetrics(d.metrics)
+	apiServer.EnableInfo(d)
+	apiServer.EnableStatus(d)
+	apiServer.EnableStats(d)
+	apiServer.EnableConnections(d)
+	apiServer.EnableLogLevel(d)
+	apiServer.EnablePrinters(d, ippServer)
+	apiServer.EnableJobs(d)
+	apiServer.EnableSync(d)
+	if d.configFunc != nil {
+		apiServer.EnableConfig(d.configFunc)
+	}
+	if d.archive != nil {
+		apiServer.EnableArchive(ippServer)
+	}
+
+	if d.config.LabelDir != "" {
+		templates, err := labels.Load(d.config.LabelDir)
+		if err != nil {
+			return fmt.Errorf("failed to load label templates: %w", err)
+		}
+		apiServer.EnableLabels(ippServer, templates)
+		d.log.Info().Strs("templates", templates.Names()).Msg("loaded label templates")
+	}
+
+	if d.auth != nil && d.auth.Guests() != nil {
+		apiServer.EnableGuestTokens(d.auth.Guests())
+	}
+	if d.apiAuth != nil {
+		apiServer.SetAuthenticator(d.apiAuth.Authenticate)
+	}
+	if len(d.config.APITokens) > 0 {
+		tokens, err := auth.NewAPITokens(d.config.APITokens)
+		if err != nil {
+			return err
+		}
+		apiServer.SetTokens(tokens.Name)
+	}
+	if len(d.config.HoldJobs) > 0 && d.auth != nil {
+		if err := d.enableRelease(apiServer, ippServer); err != nil {
+			return err
+		}
+	}
+
+	if err := apiServer.Listen(); err != nil {
+		return fmt.Errorf("failed to start API server: %w", err)
+	}
+	d.apiServer = apiServer
+	go func() {
+		if err := apiServer.ListenAndServe(); err != nil {
+			d.log.Error().Err(err).Msg("API server failed")
+		}
+	}()
+	return nil
+}
+
+// pruneArchive removes archived documents past their maximum age
+func (d *Daemon) pruneArchive() {
+	if d.archive == nil {
+		return
+	}
+	removed, err := d.archive.Prune()
+	if err != nil {
+		d.log.Warn().Err(err).Msg("failed to prune job archive")
+	} else if removed > 0 {
+		d.log.Debug().Int("removed", removed).Msg("pruned job archive")
+	}
+}
+
+// onArchiveEvicted counts a document removed to keep its printer within
+// quota
+func (d *Daemon) onArchiveEvicted(entry jobs.Archived) {
+	d.archiveEvicted.Inc(entry.Printer)
+	d.log.Debug().Int("archive_id", entry.ID).Str("printer", entry.Printer).Int64("size", entry.Size).Msg("evicted archived job over quota")
+}
+
+// archiveUsage reports the bytes archived per printer, for metrics
+func (d *Daemon) archiveUsage() map[string]float64 {
+	usage := make(map[string]float64)
+	if d.archive == nil {
+		return usage
+	}
+	bytes, err := d.archive.Usage()
+	if err != nil {
+		d.log.Warn().Err(err).Msg("failed to read job archive usage")
+		return usage
+	}
+	for printer, n := range bytes {
+		usage[printer] = float64(n)
+	}
+	return usage
+}
+
+// Sync syncs printers now, for the API. The main loop does the sync, so it
+// never runs alongside a scheduled one.
+func (d *Daemon) Sync(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case d.syncRequests <- reply:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetConfigFunc sets how the configuration is shown at GET /api/v1/config.
+// Without one, the endpoint isn't served.
+func (d *Daemon) SetConfigFunc(fn api.ConfigFunc) {
+	d.configFunc = fn
+}
+
 // syncPrinters fetches printers from CUPS and updates Avahi service files
 func (d *Daemon) syncPrinters() error {
+	d.queryUpstream()
 	printers, err := d.cupsClient.GetPrinters()
 	if err != nil {
+		if cups.IsTransient(err) {
+			d.cupsDown(err)
+		}
 		return fmt.Errorf("failed to get printers: %w", err)
 	}
+	d.cupsUp()
 
 	d.log.Debug().Int("count", len(printers)).Msg("fetched printers from CUPS")
+	if d.state != nil {
+		d.state.SetPrinters(printerNames(printers))
+	}
+
+	printers = d.servedPrinters(printers)
+	d.served = printers
+	if d.ippServer != nil {
+		d.ippServer.SetPrinters(d.ippPrinters(printers))
+	}
+
+	d.avahiManager.SetPorts(d.config.printerPorts(printers))
+	return d.avahiManager.UpdatePrinters(printers, d.config.SharedOnly, d.config.IncludeList, d.config.ExcludeList)
+}
+
+// logSyncError logs a failed sync, telling CUPS outages, which pass on
+// their own, from broken setups that need fixing
+func (d *Daemon) logSyncError(err error, msg string) {
+	switch {
+	case cups.IsTransient(err):
+		// Logged when the outage began, and retried with backoff
+	case errors.Is(err, avahi.ErrServiceDirUnwritable):
+		d.log.Error().Err(err).Str("service_dir", d.config.ServiceDir).Msg(msg + ", check the service directory's permissions")
+	default:
+		d.log.Error().Err(err).Msg(msg)
+	}
+}
+
+// ippPrinters builds the IPP server's view of each printer from CUPS data
+func (d *Daemon) ippPrinters(printers []cups.Printer) []ipp.PrinterConfig {
+	ports := d.config.printerPorts(printers)
+	configs := make([]ipp.PrinterConfig, 0, len(printers))
+	for _, p := range printers {
+		config := d.printerConfig(p)
+		config.Port = ports[p.Name]
+		configs = append(configs, config)
+	}
+	return configs
+}
+
+// printerConfig converts a CUPS printer to IPP attributes, applying media profiles
+func (d *Daemon) printerConfig(p cups.Printer) ipp.PrinterConfig {
+	// Get media from CUPS, then apply profile overrides
+	cupsMedia := p.MediaReady
+	if len(cupsMedia) == 0 {
+		cupsMedia = p.MediaSupported
+	}
+	cupsMedia, cupsDefault := cups.CanonicalMedia(cupsMedia, p.MediaDefault)
+	mediaList, mediaDefault := d.mediaRegistry.ApplyProfile(
+		p.Name,
+		p.MakeModel,
+		cupsMedia,
+		cupsDefault,
+	)
+
+	// Log whether we used a profile or CUPS defaults, once per change
+	profileName := ""
+	fallback := ""
+	sources := p.MediaSources
+	database := mediaDatabase(mediaList, cupsMargins(p.MediaMargins))
+	readyMargins := cupsMargins(p.MediaMargins)
+	if profile := d.mediaRegistry.GetProfile(p.Name, p.MakeModel, cupsDefault); profile != nil {
+		profileName = profile.Name
+		sources = mergeSources(sources, profile.Sources())
+		// Most profiles describe label stock, which is printed edge to edge
+		if !profile.Bordered {
+			readyMargins = &ipp.Margins{}
+		}
+		database = profileDatabase(profile, readyMargins)
+		fallback = profile.DefaultMedia
+	}
+	if sane, reason := cups.CheckMediaDefault(mediaList, mediaDefault, fallback); reason != "" {
+		if d.mediaDefaults[p.Name] != mediaDefault {
+			d.mediaDefaults[p.Name] = mediaDefault
+			d.log.Warn().
+				Str("printer", p.Name).
+				Str("default", mediaDefault).
+				Str("replacement", sane).
+				Msgf("default media is %s, advertising a replacement", reason)
+		}
+		mediaDefault = sane
+	} else {
+		delete(d.mediaDefaults, p.Name)
+	}
+	if last, seen := d.mediaProfiles[p.Name]; !seen || last != profileName {
+		d.mediaProfiles[p.Name] = profileName
+		if profileName != "" {
+			d.log.Info().
+				Str("printer", p.Name).
+				Str("profile", profileName).
+				Strs("media", mediaList).
+				Str("default", mediaDefault).
+				Msg("using media profile override")
+		} else {
+			d.log.Debug().
+				Str("printer", p.Name).
+				Strs("cups_media", cupsMedia).
+				Str("cups_default", cupsDefault).
+				Msg("using CUPS media configuration")
+		}
+	}
+
+	config := ipp.PrinterConfig{
+		Name:              p.Name,
+		DisplayName:       d.config.DisplayNames[p.Name],
+		MakeModel:         p.MakeModel,
+		Location:          p.Location,
+		Info:              p.Info,
+		Color:             p.ColorSupported,
+		Duplex:            p.DuplexSupported,
+		Resolutions:       p.Resolutions,
+		DefaultResolution: p.DefaultResolution,
+		MediaSupported:    mediaList,
+		MediaReady:        mediaList, // Use the same filtered list
+		MediaDefault:      mediaDefault,
+		MediaSources:      sources,
+		MediaDatabase:     database,
+		MediaColReady:     mediaColReady(p.MediaColReady, readyMargins),
+		MediaProfile:      profileName,
+		URFConversion:     d.config.URFConversion[p.Name],
+		FormatFallback:    d.config.FormatFallback[p.Name],
+		Watermark:         d.config.Watermarks[p.Name],
+		Scaling:           d.config.PrintScaling[p.Name],
+		HoldJobs:          d.config.HoldJobs[p.Name],
+		MaxQueued:         d.config.queueLimit(p.Name),
+		Formats:           d.config.DocumentFormats[p.Name],
+		URF:               d.config.URFOverrides[p.Name],
+		RelayAuth:         d.config.CUPSPrinterAuth[p.Name].Relay,
+		Identify:          d.identifyDevice(p),
+		UUID:              d.printerUUID(p.Name),
+		IconFile:          d.config.PrinterIcons[p.Name],
+		GeoLocation:       d.config.GeoLocations[p.Name],
+		RawAddr:           d.rawAddr(p),
+		Features:          d.config.PrinterFeatures[p.Name],
+	}
+	config.QueuedJobs = p.QueuedJobs
+	// Failover primaries keep taking jobs whatever their state, since those
+	// jobs are redirected
+	if _, ok := d.config.Failover[p.Name]; !ok {
+		config.State = int(p.State)
+		config.StateReasons = p.StateReasons
+		config.StateMessage = p.StateMessage
+		config.NotAccepting = !p.IsAccepting
+		config.LiveQueue = d.config.liveQueue(p.Name)
+	}
+	if config.HasFeature(ipp.FeatureURFTranscode) && config.URFConversion == "" {
+		config.URFConversion = raster.FormatPWG
+	}
+	if standalone, ok := d.config.standalonePrinter(p.Name); ok {
+		config = standalone.configure(config, p)
+	}
+	return config
+}
+
+// liveQueue returns the CUPS queue whose current state a printer reports,
+// or "" for printers not backed by a single queue, such as virtual,
+// standalone and null printers
+func (c Config) liveQueue(name string) string {
+	if queue, ok := c.stagedQueues()[name]; ok {
+		return queue
+	}
+	if _, ok := c.standalonePrinter(name); ok || name == c.NullPrinter {
+		return ""
+	}
+	for _, vp := range c.VirtualPrinters {
+		if vp.Name == name {
+			return ""
+		}
+	}
+	return name
+}
+
+// timeZone returns the zone times are shown in
+func (c Config) timeZone() *time.Location {
+	if loc, err := time.LoadLocation(c.TimeZone); err == nil && c.TimeZone != "" {
+		return loc
+	}
+	return time.Local
+}
+
+// queueLimit returns how many jobs a printer may have waiting or printing
+func (c Config) queueLimit(printer string) int {
+	if limit, ok := c.QueueLimits[printer]; ok {
+		return limit
+	}
+	return c.MaxQueuedJobs
+}
+
+// jobLimits returns the caps on jobs being sent through the bridge at once
+func (c Config) jobLimits() ipp.JobLimits {
+	return ipp.JobLimits{MaxConcurrent: c.MaxConcurrentJobs, MaxPerClient: c.MaxClientJobs}
+}
+
+// mediaDatabase returns the dimensions of each media name that encodes them
+func mediaDatabase(names []string, margins *ipp.Margins) []ipp.MediaCol {
+	var cols []ipp.MediaCol
+	for _, name := range names {
+		if width, height, ok := cups.ParseMediaSize(name); ok {
+			cols = append(cols, ipp.MediaCol{Name: name, Width: width, Height: height, Margins: margins})
+		}
+	}
+	return cols
+}
+
+// profileDatabase returns the dimensions of each size in a media profile,
+// from the profile or else the size name. Sizes without margins of their own
+// get margins, which may be nil if unknown.
+func profileDatabase(profile *media.Profile, margins *ipp.Margins) []ipp.MediaCol {
+	var cols []ipp.MediaCol
+	for _, s := range profile.Sizes {
+		width, height, ok := s.Width, s.Height, s.Width > 0 && s.Height > 0
+		if !ok {
+			width, height, ok = cups.ParseMediaSize(s.Name)
+		}
+		if !ok {
+			continue
+		}
+		col := ipp.MediaCol{Name: s.Name, Width: width, Height: height, Source: s.Source, Margins: margins}
+		if s.Margins != nil {
+			col.Margins = &ipp.Margins{Top: s.Margins.Top, Bottom: s.Margins.Bottom, Left: s.Margins.Left, Right: s.Margins.Right}
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
 
-	return d.avahiManager.UpdatePrinters(printers, d.config.SharedOnly, d.config.ExcludeList)
+// mergeSources appends the trays in extra that sources doesn't list
+func mergeSources(sources, extra []string) []string {
+	result := sources
+	for _, s := range extra {
+		if !containsString(result, s) {
+			result = append(append([]string(nil), result...), s)
+		}
+	}
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaColReady converts the media CUPS reports loaded in each tray
+func mediaColReady(ready []cups.MediaCol, margins *ipp.Margins) []ipp.MediaCol {
+	cols := make([]ipp.MediaCol, 0, len(ready))
+	for _, m := range ready {
+		cols = append(cols, ipp.MediaCol{Name: m.SizeName, Width: m.Width, Height: m.Height, Source: m.Source, Type: m.Type, Margins: margins})
+	}
+	return cols
+}
+
+// cupsMargins converts the margins CUPS reports, if any
+func cupsMargins(m *cups.Margins) *ipp.Margins {
+	if m == nil {
+		return nil
+	}
+	return &ipp.Margins{Top: m.Top, Bottom: m.Bottom, Left: m.Left, Right: m.Right}
+}
+
+// enableRelease serves the release queue for held jobs. Guest tokens are
+// refused there, since they let anyone claim any user name.
+func (d *Daemon) enableRelease(apiServer *api.Server, ippServer *ipp.Server) error {
+	var pins *auth.PINs
+	if len(d.config.ReleasePINs) > 0 {
+		var err error
+		if pins, err = auth.NewPINs(d.config.ReleasePINs); err != nil {
+			return fmt.Errorf("failed to load release PINs: %w", err)
+		}
+	}
+	apiServer.EnableRelease(ippServer, func(user, password string) bool {
+		ok, guest := d.auth.Check(user, password)
+		return ok && !guest
+	}, pins)
+	return nil
+}
+
+// printerAvailable queries CUPS for the live state of a queue
+func (d *Daemon) printerAvailable(name string) (bool, error) {
+	p, err := d.cupsClient.GetPrinter(name)
+	if errors.Is(err, cups.ErrPrinterNotFound) {
+		return false, nil // Deleted queues can't take jobs either
+	}
+	if err != nil {
+		return false, err
+	}
+	return p.IsAvailable(), nil
+}
+
+// onFailover records a job redirected from an unavailable primary queue
+func (d *Daemon) onFailover(primary, backup, traceID string) {
+	d.log.Warn().
+		Bool("audit", true).
+		Str("printer", primary).
+		Str("backup", backup).
+		Str("trace_id", traceID).
+		Msg("primary printer unavailable, redirecting job to backup")
+
+	d.notifier.Notify(webhook.Event{
+		Type:    webhook.EventFailover,
+		Printer: primary,
+		TraceID: traceID,
+		Message: fmt.Sprintf("job redirected from %s to %s", primary, backup),
+		Data: map[string]string{
+			"backup": backup,
+		},
+	})
+}
+
+// onJobDenied records a job CUPS refused because of a quota or policy
+func (d *Daemon) onJobDenied(printer, user, traceID string, denial ipp.Denial) {
+	d.deniedJobs.Inc(printer, denial.Reason)
+
+	d.notifier.Notify(webhook.Event{
+		Type:    webhook.EventJobDenied,
+		Printer: printer,
+		TraceID: traceID,
+		Message: denial.Message,
+		Data: map[string]string{
+			"reason": denial.Reason,
+			"user":   user,
+		},
+	})
 }
 
 // shutdown performs cleanup and returns
 func (d *Daemon) shutdown() error {
+	d.notify(systemd.Stopping)
+	defer d.closeHelper()
+	d.saveState()
 	d.log.Info().Msg("cleaning up service files")
 	if err := d.avahiManager.Cleanup(); err != nil {
 		d.log.Error().Err(err).Msg("cleanup failed")
@@ -237,6 +1179,33 @@ func (d *Daemon) shutdown() error {
 	return nil
 }
 
+// startResponder advertises printers with the built-in mDNS responder on the
+// configured interfaces, replacing service files from earlier runs
+func (d *Daemon) startResponder(ctx context.Context) error {
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %w", err)
+	}
+	host, _, _ = strings.Cut(host, ".")
+
+	responder, err := mdns.NewResponder(d.config.MDNSInterfaces, host, d.log)
+	if err != nil {
+		return fmt.Errorf("failed to configure mDNS responder: %w", err)
+	}
+	d.avahiManager.SetResponder(responder, host)
+	d.responder = responder
+	if err := d.avahiManager.RemoveServiceFiles(); err != nil {
+		d.log.Warn().Err(err).Msg("failed to remove leftover service files")
+	}
+
+	go func() {
+		if err := responder.Run(ctx); err != nil {
+			d.log.Error().Err(err).Msg("mDNS responder failed")
+		}
+	}()
+	return nil
+}
+
 // verifyServiceDir checks that the Avahi service directory exists and is writable
 func (d *Daemon) verifyServiceDir() error {
 	info, err := os.Stat(d.config.ServiceDir)
@@ -254,27 +1223,9 @@ func (d *Daemon) verifyServiceDir() error {
 	// Try to create and remove a test file
 	testFile := d.config.ServiceDir + "/.airprint-bridge-test"
 	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
-		return fmt.Errorf("service directory is not writable: %w", err)
+		return fmt.Errorf("%w: %s: %w", avahi.ErrServiceDirUnwritable, d.config.ServiceDir, err)
 	}
 	os.Remove(testFile)
 
 	return nil
 }
-
-// getLocalIP returns the local IP address for advertising
-func (d *Daemon) getLocalIP() string {
-	addrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return "127.0.0.1"
-	}
-
-	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			if ipnet.IP.To4() != nil {
-				return ipnet.IP.String()
-			}
-		}
-	}
-
-	return "127.0.0.1"
-}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// DryRun queries CUPS and writes the service file and IPP attributes each
+// printer would be advertised with to w, without writing files or binding
+// any ports. Printers that wouldn't be advertised are listed with the reason.
+func (d *Daemon) DryRun(w io.Writer) error {
+	if err := d.cupsClient.TestConnection(); err != nil {
+		return fmt.Errorf("cannot connect to CUPS: %w", err)
+	}
+	ippAuth, _, _, err := d.newAuthenticators()
+	if err != nil {
+		return fmt.Errorf("failed to configure authentication: %w", err)
+	}
+	printers, err := d.cupsPrinters()
+	if err != nil {
+		return fmt.Errorf("failed to get printers: %w", err)
+	}
+
+	// Leaving legacy service files alone only needs them read
+	if len(d.config.MDNSInterfaces) == 0 && d.config.LegacyFiles == avahi.LegacyKeep {
+		if err := d.avahiManager.HandleLegacyFiles(avahi.LegacyKeep); err != nil {
+			return err
+		}
+	}
+
+	// Configure the server as Run would, but never start it
+	proxy := ipp.NewCUPSProxy(d.config.CUPSHost, d.config.CUPSPort)
+	server := ipp.NewServer(fmt.Sprintf(":%d", d.config.IPPPort), proxy, jobs.NewTracker(proxy, d.log), d.log)
+	served := d.servedPrinters(printers)
+	server.SetPrinters(d.ippPrinters(served))
+	server.SetBuildInfo(d.buildInfo())
+	if ippAuth != nil {
+		server.SetAuthenticator(ippAuth.Check)
+	}
+	if d.config.tlsEnabled() {
+		tlsConfig, err := d.ippTLSConfig()
+		if err != nil {
+			return err
+		}
+		server.EnableTLS(tlsConfig)
+	}
+	d.configureAdvertising(served, ippAuth != nil)
+
+	for _, planned := range d.avahiManager.Plan(served, d.config.SharedOnly, d.config.IncludeList, d.config.ExcludeList) {
+		printer := planned.Printer
+		if planned.Skipped != "" {
+			fmt.Fprintf(w, "# %s: skipped, %s\n\n", printer.Name, planned.Skipped)
+			continue
+		}
+
+		fmt.Fprintf(w, "# %s: %s\n", printer.Name, d.avahiManager.FileName(printer.Name))
+		content, err := d.avahiManager.ServiceFile(&printer)
+		if err != nil {
+			return fmt.Errorf("failed to generate service file for %s: %w", printer.Name, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n# %s: IPP attributes\n", printer.Name)
+		if err := server.WritePrinterAttributes(w, printer.Name); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// configureAdvertising sets up the service records of served printers as
+// Run would, for output that doesn't start the daemon
+func (d *Daemon) configureAdvertising(served []cups.Printer, authRequired bool) {
+	d.avahiManager.SetAuthPrinters(d.config.relayAuthPrinters())
+	d.avahiManager.SetAuthRequired(authRequired)
+	if d.config.tlsEnabled() {
+		d.avahiManager.SetTLSPort(d.config.TLSPort)
+	}
+	d.avahiManager.SetPorts(d.config.printerPorts(served))
+}
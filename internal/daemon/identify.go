@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"net/url"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/identify"
+)
+
+// IdentifyConfig is how a printer is made to show itself on Identify-Printer
+type IdentifyConfig struct {
+	Method   string            // identify.MethodZebra or identify.MethodIPP
+	Address  string            // Zebra raw port, default the device URI's host on 9100
+	URI      string            // Printer's IPP URI, default the device URI
+	Actions  []string          // Actions to advertise for IPP printers
+	Commands map[string]string // Zebra command per action, on top of the defaults
+}
+
+// identifyDevice returns the device that identifies a printer, or nil if it
+// has none configured or its address can't be worked out
+func (d *Daemon) identifyDevice(p cups.Printer) identify.Device {
+	cfg, ok := d.config.Identify[p.Name]
+	if !ok {
+		return nil
+	}
+	device, _ := url.Parse(p.DeviceURI)
+
+	switch cfg.Method {
+	case identify.MethodZebra:
+		addr := rawPortAddr(cfg.Address, p.DeviceURI)
+		if addr == "" {
+			d.log.Warn().Str("printer", p.Name).Str("device_uri", p.DeviceURI).Msg("can't identify printer: set identify address")
+			return nil
+		}
+		return &identify.Zebra{Addr: addr, Commands: cfg.Commands}
+	case identify.MethodIPP:
+		uri := cfg.URI
+		if uri == "" && device != nil && (device.Scheme == "ipp" || device.Scheme == "ipps") {
+			uri = p.DeviceURI
+		}
+		if uri == "" {
+			d.log.Warn().Str("printer", p.Name).Str("device_uri", p.DeviceURI).Msg("can't identify printer: set identify uri")
+			return nil
+		}
+		return identify.NewIPP(uri, cfg.Actions)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/api"
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// SetBuildInfo sets the version reported over IPP and the API
+func (d *Daemon) SetBuildInfo(version, commit string) {
+	d.version = version
+	d.commit = commit
+}
+
+// features lists the optional features the configuration enables
+func (c Config) features() []string {
+	var features []string
+	add := func(name string, enabled bool) {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	add("tls", c.tlsEnabled())
+	add("auth", c.authEnabled())
+	add("guest-tokens", c.GuestTokens)
+	add("api-auth", len(c.APIAuth) > 0 || len(c.APITokens) > 0)
+	add("printer-access", len(c.PrinterAccess) > 0)
+	add("job-release", len(c.HoldJobs) > 0)
+	add("queue-limits", c.MaxQueuedJobs > 0 || len(c.QueueLimits) > 0)
+	add("job-limits", c.MaxConcurrentJobs > 0 || c.MaxClientJobs > 0)
+	add("cups-auth", c.CUPSUser != "" || len(c.CUPSPrinterAuth) > 0)
+	add("failover", len(c.Failover) > 0)
+	add("virtual-printers", len(c.VirtualPrinters) > 0)
+	add("staged-printers", len(c.StagedPrinters) > 0)
+	add("null-printer", c.NullPrinter != "")
+	add("archive", c.ArchiveDir != "")
+	add("archive-quotas", c.ArchiveDir != "" && (c.ArchiveQuota > 0 || len(c.ArchiveQuotas) > 0))
+	add("trace-job-names", c.TraceJobNames)
+	add("urf-conversion", len(c.URFConversion) > 0)
+	add("format-fallback", len(c.FormatFallback) > 0)
+	add("identify", len(c.Identify) > 0)
+	add("printer-ports", c.PrinterPortBase != 0 || len(c.PrinterPorts) > 0)
+	add("watermarks", len(c.Watermarks) > 0)
+	add("experimental", len(c.PrinterFeatures) > 0)
+	add("client-quirks", len(c.Quirks) > 0)
+	add("document-size-limit", c.MaxDocumentSize > 0)
+	add("raw-zpl", len(c.RawPrinters) > 0)
+	add("mdns-reflector", c.reflectEnabled())
+	add("standalone-printers", len(c.Standalone) > 0)
+	add("reexport", c.reexports())
+	add("printer-icons", len(c.PrinterIcons) > 0)
+	add("geo-location", len(c.GeoLocations) > 0)
+	add("schedules", len(c.Schedules) > 0)
+	add("api", c.APIListen != "")
+	add("labels", c.LabelDir != "")
+	add("privsep", c.RunAsUser != "")
+	add("allowed-networks", len(c.AllowedNetworks) > 0)
+	add("audit-log", c.AuditLog)
+	add("syslog", c.LogOutput == "syslog")
+	add("journald", c.LogOutput == "journald")
+	add("log-file", c.LogFile != "")
+	return features
+}
+
+// buildInfo returns what the IPP server reports about the bridge
+func (d *Daemon) buildInfo() ipp.BuildInfo {
+	return ipp.BuildInfo{Version: d.version, Commit: d.commit, Features: d.config.features()}
+}
+
+// Info reports the bridge's build, features and per-printer pipelines for
+// the API
+func (d *Daemon) Info() api.Info {
+	config := d.currentConfig()
+	info := api.Info{
+		Version:  d.version,
+		Commit:   d.commit,
+		Features: config.features(),
+		Printers: []api.PrinterInfo{},
+	}
+	if d.ippServer == nil {
+		return info
+	}
+
+	virtual := make(map[string]VirtualPrinter, len(config.VirtualPrinters))
+	for _, v := range config.VirtualPrinters {
+		virtual[v.Name] = v
+	}
+
+	staged := config.stagedQueues()
+	for _, p := range d.ippServer.Printers() {
+		printer := api.PrinterInfo{
+			Name:        p.Name,
+			DisplayName: p.DisplayName,
+			Formats:     p.DocumentFormats(),
+			Pipeline:    p.Pipeline(),
+			Backend:     "cups",
+			Features:    p.Features,
+		}
+		if printer.Pipeline == nil {
+			printer.Pipeline = []string{}
+		}
+		if p.Name == config.NullPrinter {
+			printer.Backend = "null"
+		} else if standalone, ok := config.standalonePrinter(p.Name); ok {
+			printer.Backend = standalone.scheme()
+			printer.Targets = []string{standalone.URI}
+		} else if p.RawAddr != "" {
+			printer.Backend = "raw"
+			printer.Targets = []string{p.RawAddr}
+		} else if v, ok := virtual[p.Name]; ok {
+			printer.Backend = v.Mode
+			printer.Targets = v.Members
+		} else if queue, ok := staged[p.Name]; ok {
+			printer.Backend = "staged"
+			printer.Targets = []string{queue}
+		} else if backup, ok := config.Failover[p.Name]; ok {
+			printer.Backend = "failover"
+			printer.Targets = []string{p.Name, backup}
+		}
+		info.Printers = append(info.Printers, printer)
+	}
+	return info
+}
+
+// Stats reports each printer's jobs today, last job and last error for the
+// API
+func (d *Daemon) Stats() api.Stats {
+	stats := api.Stats{Printers: make(map[string]api.PrinterStats)}
+	profiles := make(map[string]string)
+	for _, p := range d.ippServer.Printers() {
+		profiles[p.Name] = p.MediaProfile
+	}
+	for name, js := range d.ippServer.JobStats() {
+		ps := api.PrinterStats{
+			JobsToday:    js.JobsToday,
+			LastError:    js.LastError,
+			MediaProfile: profiles[name],
+		}
+		if !js.LastJob.IsZero() {
+			t := js.LastJob.UTC()
+			ps.LastJob = &t
+		}
+		if !js.LastErrorAt.IsZero() {
+			t := js.LastErrorAt.UTC()
+			ps.LastErrorAt = &t
+		}
+		stats.Printers[name] = ps
+	}
+	return stats
+}
+
+// PrinterList reports the printers served and their state as of the last
+// poll for the API
+func (d *Daemon) PrinterList() []api.Printer {
+	printers := []api.Printer{}
+	if d.ippServer == nil {
+		return printers
+	}
+	paused := d.ippServer.Maintenance()
+	for _, p := range d.ippServer.Printers() {
+		message, ok := paused[p.Name]
+		printers = append(printers, api.Printer{
+			Name:         p.Name,
+			DisplayName:  p.DisplayName,
+			MakeModel:    p.MakeModel,
+			Location:     p.Location,
+			State:        cups.PrinterState(p.State).String(),
+			StateReasons: p.StateReasons,
+			StateMessage: p.StateMessage,
+			Accepting:    !p.NotAccepting,
+			QueuedJobs:   p.QueuedJobs,
+			Paused:       ok,
+			PauseMessage: message,
+		})
+	}
+	return printers
+}
+
+// Jobs lists the jobs submitted through the bridge for the API
+func (d *Daemon) Jobs(printer, which string) []api.Job {
+	if d.tracker == nil {
+		return nil
+	}
+	list := d.tracker.List(printer, which)
+	result := make([]api.Job, len(list))
+	for i, j := range list {
+		result[i] = api.Job{
+			ID:                   j.ID,
+			CUPSJobID:            j.CUPSJobID,
+			TraceID:              j.TraceID,
+			Printer:              j.Printer,
+			Name:                 j.Name,
+			User:                 j.User,
+			DocumentFormat:       j.DocumentFormat,
+			State:                jobs.StateName(j.State),
+			StateReasons:         j.StateReasons,
+			ImpressionsCompleted: j.ImpressionsCompleted,
+			CreatedAt:            j.CreatedAt.UTC(),
+		}
+		if !j.CompletedAt.IsZero() {
+			t := j.CompletedAt.UTC()
+			result[i].CompletedAt = &t
+		}
+	}
+	return result
+}
+
+// OpenConnections lists the IPP server's client connections for the API
+func (d *Daemon) OpenConnections() []api.Connection {
+	list := d.ippServer.ConnectionList()
+	conns := make([]api.Connection, len(list))
+	for i, c := range list {
+		conns[i] = api.Connection{
+			Remote:        c.Remote,
+			Opened:        c.Opened.UTC(),
+			State:         c.State,
+			Requests:      c.Requests,
+			LastOperation: c.LastOperation,
+			Operations:    c.Operations,
+		}
+		if !c.LastRequest.IsZero() {
+			t := c.LastRequest.UTC()
+			conns[i].LastRequest = &t
+		}
+	}
+	return conns
+}
+
+// Status reports the bridge's uptime and resource usage for the API
+func (d *Daemon) Status() api.Status {
+	return api.Status{
+		StartedAt:     d.startedAt,
+		UptimeSeconds: int64(time.Since(d.startedAt).Seconds()),
+		Resources:     d.resources.Sample(),
+	}
+}
@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/location"
+)
+
+// Location source types
+const (
+	LocationSourceCSV  = "csv"
+	LocationSourceDNS  = "dns"
+	LocationSourceLLDP = "lldp"
+)
+
+// LocationSource configures one place printer locations are looked up
+type LocationSource struct {
+	Type string // csv, dns or lldp
+	Path string // CSV inventory file (csv)
+	Name string // TXT record name template with {queue} or {host} (dns)
+}
+
+// newLocationResolver builds a resolver from the configured sources, or
+// returns nil if none are configured
+func newLocationResolver(config Config, log zerolog.Logger) *location.Resolver {
+	if len(config.LocationSources) == 0 {
+		return nil
+	}
+
+	sources := make([]location.Source, 0, len(config.LocationSources))
+	for _, s := range config.LocationSources {
+		switch s.Type {
+		case LocationSourceCSV:
+			sources = append(sources, location.NewCSVSource(s.Path))
+		case LocationSourceDNS:
+			sources = append(sources, location.NewDNSSource(s.Name))
+		case LocationSourceLLDP:
+			sources = append(sources, location.NewLLDPSource())
+		default:
+			log.Warn().Str("type", s.Type).Msg("ignoring unknown location source")
+		}
+	}
+
+	return location.NewResolver(sources, config.LocationOverride, log)
+}
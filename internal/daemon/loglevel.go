@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/api"
+)
+
+// logLevel is the configured log level and a runtime override of it
+type logLevel struct {
+	mu         sync.Mutex
+	configured zerolog.Level
+	reset      *time.Timer // Returns to the configured level, nil without a timed override
+	until      time.Time
+}
+
+// LogLevel reports the level logged at and the configured one
+func (d *Daemon) LogLevel() api.LogLevel {
+	d.logLevel.mu.Lock()
+	defer d.logLevel.mu.Unlock()
+	level := api.LogLevel{
+		Level:      zerolog.GlobalLevel().String(),
+		Configured: d.logLevel.configured.String(),
+	}
+	if d.logLevel.reset != nil {
+		until := d.logLevel.until
+		level.Until = &until
+	}
+	return level
+}
+
+// SetLogLevel overrides the configured level, for duration, or when it is 0
+// until restart or a reload that changes log.level
+func (d *Daemon) SetLogLevel(level zerolog.Level, duration time.Duration) {
+	d.logLevel.mu.Lock()
+	defer d.logLevel.mu.Unlock()
+	d.stopLevelReset()
+	zerolog.SetGlobalLevel(level)
+	event := d.log.Info().Str("log_level", level.String())
+	if duration > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(duration, func() {
+			d.logLevel.mu.Lock()
+			defer d.logLevel.mu.Unlock()
+			if d.logLevel.reset == timer { // Not replaced since
+				d.resetLevel()
+			}
+		})
+		d.logLevel.reset = timer
+		d.logLevel.until = time.Now().Add(duration)
+		event = event.Time("until", d.logLevel.until)
+	}
+	event.Msg("log level changed")
+}
+
+// ResetLogLevel returns to the configured level
+func (d *Daemon) ResetLogLevel() {
+	d.logLevel.mu.Lock()
+	defer d.logLevel.mu.Unlock()
+	d.resetLevel()
+}
+
+// setConfiguredLevel switches to a reloaded log.level, ending any override
+func (d *Daemon) setConfiguredLevel(level zerolog.Level) {
+	d.logLevel.mu.Lock()
+	defer d.logLevel.mu.Unlock()
+	d.logLevel.configured = level
+	d.stopLevelReset()
+	zerolog.SetGlobalLevel(level)
+}
+
+// toggleDebug switches to debug logging, or back to the configured level if
+// already there, on SIGUSR1
+func (d *Daemon) toggleDebug() {
+	d.logLevel.mu.Lock()
+	overridden := zerolog.GlobalLevel() == zerolog.DebugLevel && d.logLevel.configured != zerolog.DebugLevel
+	d.logLevel.mu.Unlock()
+	if overridden {
+		d.ResetLogLevel()
+		return
+	}
+	d.SetLogLevel(zerolog.DebugLevel, 0)
+}
+
+// resetLevel returns to the configured level. The caller holds
+// d.logLevel.mu.
+func (d *Daemon) resetLevel() {
+	d.stopLevelReset()
+	zerolog.SetGlobalLevel(d.logLevel.configured)
+	d.log.Info().Str("log_level", d.logLevel.configured.String()).Msg("log level back to configured level")
+}
+
+// stopLevelReset cancels a pending return to the configured level. The
+// caller holds d.logLevel.mu.
+func (d *Daemon) stopLevelReset() {
+	if d.logLevel.reset != nil {
+		d.logLevel.reset.Stop()
+		d.logLevel.reset = nil
+	}
+}
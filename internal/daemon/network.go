@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// addrPollInterval is how often local addresses are checked for changes,
+// e.g. from a DHCP renewal or an interface going up or down
+const addrPollInterval = 10 * time.Second
+
+// localAddrs returns the addresses the bridge can be reached at, in order of
+// preference: those of the preferred interfaces in the order given, then
+// those of the others. Each interface's IPv4 addresses come before its
+// global IPv6 ones; loopback, link-local and down interfaces are skipped.
+func localAddrs(prefer []string) []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	rank := func(iface net.Interface) int {
+		for i, name := range prefer {
+			if iface.Name == name {
+				return i
+			}
+		}
+		return len(prefer)
+	}
+	ordered := make([]net.Interface, 0, len(ifaces))
+	for r := 0; r <= len(prefer); r++ {
+		for _, iface := range ifaces {
+			if rank(iface) == r {
+				ordered = append(ordered, iface)
+			}
+		}
+	}
+
+	var v4, v6 []net.IP
+	var addrs []net.IP
+	for _, iface := range ordered {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		v4, v6 = v4[:0], v6[:0]
+		for _, a := range ifAddrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || !ipnet.IP.IsGlobalUnicast() {
+				continue
+			}
+			if ip := ipnet.IP.To4(); ip != nil {
+				v4 = append(v4, ip)
+			} else {
+				v6 = append(v6, ipnet.IP)
+			}
+		}
+		addrs = append(append(addrs, v4...), v6...)
+	}
+	return addrs
+}
+
+// sameAddrs reports whether two address lists are equal, in order
+func sameAddrs(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// addrStrings returns the addresses as strings, for logging
+func addrStrings(addrs []net.IP) []string {
+	s := make([]string, len(addrs))
+	for i, a := range addrs {
+		s[i] = a.String()
+	}
+	return s
+}
+
+// addrPreference returns the interfaces whose addresses are preferred: those
+// configured, or else the ones advertised on
+func (c Config) addrPreference() []string {
+	if len(c.PreferInterfaces) > 0 {
+		return c.PreferInterfaces
+	}
+	return c.MDNSInterfaces
+}
+
+// advertiseAddrs points printer URIs at the preferred address, or back at
+// cups.local when there is none
+func (d *Daemon) advertiseAddrs(addrs []net.IP) {
+	if d.ippServer == nil {
+		return
+	}
+	host := ""
+	if len(addrs) > 0 {
+		host = addrs[0].String()
+	}
+	d.ippServer.SetHost(host)
+}
+
+// watchAddrs checks the local addresses, preferring those of the prefer
+// interfaces, until ctx is cancelled. When they change, printer URIs are
+// updated and the services announced again with the new addresses, instead
+// of clients being sent to a stale one until restart. Avahi follows address
+// changes itself.
+func (d *Daemon) watchAddrs(ctx context.Context, prefer []string, addrs []net.IP) {
+	ticker := time.NewTicker(addrPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := localAddrs(prefer)
+		if sameAddrs(current, addrs) {
+			continue
+		}
+		d.log.Info().
+			Strs("old", addrStrings(addrs)).
+			Strs("new", addrStrings(current)).
+			Msg("local addresses changed")
+		addrs = current
+		d.advertiseAddrs(addrs)
+		if d.responder != nil {
+			d.responder.Reannounce()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package daemon
+
+import (
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// nullPrinter synthesizes the printer that discards jobs, with common office
+// and label sizes so most client flows can be exercised against it
+func nullPrinter(name string) cups.Printer {
+	return cups.Printer{
+		Name:              name,
+		MakeModel:         "AirPrint Bridge Null Printer",
+		Info:              "Test printer, jobs are discarded",
+		IsShared:          true,
+		IsAccepting:       true,
+		State:             cups.PrinterStateIdle,
+		ColorSupported:    true,
+		DuplexSupported:   true,
+		Resolutions:       []int{300, 600},
+		DefaultResolution: 300,
+		MediaSupported: []string{
+			"na_letter_8.5x11in",
+			"iso_a4_210x297mm",
+			"na_index-4x6_4x6in",
+			"oe_4x6-label_4x6in",
+		},
+		MediaDefault: "na_letter_8.5x11in",
+	}
+}
+
+// withNullPrinter appends the null printer to the CUPS list, if enabled
+func (d *Daemon) withNullPrinter(printers []cups.Printer) []cups.Printer {
+	if d.config.NullPrinter == "" {
+		return printers
+	}
+	return append(printers, nullPrinter(d.config.NullPrinter))
+}
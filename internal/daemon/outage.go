@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// Retries while CUPS is unreachable start quickly, to catch a restart, and
+// back off exponentially to this ceiling during longer outages
+const (
+	outageRetryMin = 2 * time.Second
+	outageRetryMax = 2 * time.Minute
+)
+
+// outage is a period CUPS can't be reached in
+type outage struct {
+	since time.Time
+	delay time.Duration // Before the next attempt, doubled after each
+	timer *time.Timer
+}
+
+// nextDelay returns the backoff after delay
+func nextDelay(delay time.Duration) time.Duration {
+	return min(delay*2, outageRetryMax)
+}
+
+// cupsDown records a failure to reach CUPS. The first marks the printers it
+// serves as stopped and not accepting jobs; each schedules a retry later
+// than the one before.
+func (d *Daemon) cupsDown(err error) {
+	if d.outage != nil {
+		d.outage.delay = nextDelay(d.outage.delay)
+		d.outage.timer.Reset(d.outage.delay)
+		d.log.Debug().Err(err).Dur("retry_in", d.outage.delay).Msg("CUPS still unreachable")
+		return
+	}
+
+	d.outage = &outage{since: time.Now(), delay: outageRetryMin, timer: time.NewTimer(outageRetryMin)}
+	down := d.cupsBacked(d.served)
+	d.log.Warn().Err(err).Strs("printers", down).Msg("CUPS unreachable, printers not accepting jobs until it returns")
+	if d.ippServer != nil {
+		d.ippServer.SetUpstreamDown(down)
+	}
+	d.avahiManager.SetUpstreamDown(down)
+	if err := d.avahiManager.UpdatePrinters(d.served, d.config.SharedOnly, d.config.IncludeList, d.config.ExcludeList); err != nil {
+		d.log.Error().Err(err).Msg("failed to update service files")
+	}
+}
+
+// cupsUp ends an outage once CUPS answers again, returning the printers to
+// service. Their advertisements are updated by the sync that found CUPS.
+func (d *Daemon) cupsUp() {
+	if d.outage == nil {
+		return
+	}
+	d.outage.timer.Stop()
+	d.log.Info().Dur("outage", time.Since(d.outage.since).Round(time.Second)).Msg("CUPS reachable again, printers back in service")
+	d.outage = nil
+	if d.ippServer != nil {
+		d.ippServer.SetUpstreamDown(nil)
+	}
+	d.avahiManager.SetUpstreamDown(nil)
+}
+
+// outageRetry returns a channel that fires when CUPS should be tried again,
+// or nil outside an outage
+func (d *Daemon) outageRetry() <-chan time.Time {
+	if d.outage == nil {
+		return nil
+	}
+	return d.outage.timer.C
+}
+
+// cupsBacked returns the names of the printers whose jobs go through CUPS,
+// leaving out standalone and null printers
+func (d *Daemon) cupsBacked(printers []cups.Printer) []string {
+	var names []string
+	for _, p := range printers {
+		if _, ok := d.config.standalonePrinter(p.Name); ok || p.Name == d.config.NullPrinter {
+			continue
+		}
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// waitForCUPS tests the connection to CUPS, retrying with backoff while it
+// is unreachable, e.g. when both start at boot, until ctx is cancelled
+func (d *Daemon) waitForCUPS(ctx context.Context) error {
+	delay := outageRetryMin
+	for {
+		err := d.cupsClient.TestConnection()
+		if err == nil || !cups.IsTransient(err) {
+			return err
+		}
+		d.log.Warn().Err(err).Dur("retry_in", delay).Msg("waiting for CUPS")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up waiting for CUPS: %w", err)
+		case <-time.After(delay):
+		}
+		delay = nextDelay(delay)
+	}
+}
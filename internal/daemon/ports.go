@@ -0,0 +1,47 @@
+package daemon
+
+import (
+	"sort"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// printerPorts returns the dedicated IPP port of each printer that has one.
+// Printers in PrinterPorts get their configured port; with PrinterPortBase
+// set the rest are numbered from it in name order, skipping ports already
+// taken. The IPP server and the advertisements both use this, so a printer's
+// URI and its mDNS service always agree.
+func (c Config) printerPorts(printers []cups.Printer) map[string]int {
+	if c.PrinterPortBase == 0 && len(c.PrinterPorts) == 0 {
+		return nil
+	}
+
+	ports := make(map[string]int)
+	taken := map[int]bool{c.IPPPort: true}
+	if c.tlsEnabled() {
+		taken[c.TLSPort] = true
+	}
+	var names []string
+	for _, p := range printers {
+		if port, ok := c.PrinterPorts[p.Name]; ok {
+			ports[p.Name] = port
+			taken[port] = true
+			continue
+		}
+		names = append(names, p.Name)
+	}
+	if c.PrinterPortBase == 0 {
+		return ports
+	}
+
+	sort.Strings(names)
+	next := c.PrinterPortBase
+	for _, name := range names {
+		for taken[next] {
+			next++
+		}
+		ports[name] = next
+		taken[next] = true
+	}
+	return ports
+}
@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/privsep"
+)
+
+// setupPrivsep prepares to run as RunAsUser: when service files are written,
+// it starts the helper that keeps writing them once privileges are dropped.
+// Started as that user already, there is nothing to do.
+func (d *Daemon) setupPrivsep() error {
+	if d.config.RunAsUser == "" {
+		return nil
+	}
+	creds, err := privsep.Lookup(d.config.RunAsUser, d.config.RunAsGroup)
+	if err != nil {
+		return err
+	}
+	if euid := os.Geteuid(); euid != 0 {
+		if euid == creds.UID {
+			d.log.Info().Str("user", d.config.RunAsUser).Msg("already running as the configured user")
+			return nil
+		}
+		return fmt.Errorf("security.user is %s but the bridge was started neither as root nor as that user", d.config.RunAsUser)
+	}
+	d.runAs = &creds
+
+	// The built-in responder needs no files, only its sockets
+	if len(d.config.MDNSInterfaces) > 0 {
+		return nil
+	}
+	helper, err := privsep.Start(d.config.ServiceDir)
+	if err != nil {
+		return err
+	}
+	d.helper = helper
+	d.avahiManager.SetFiles(helper)
+	return nil
+}
+
+// dropPrivileges switches to RunAsUser once every port is bound, first
+// handing it the state and archive directories and audit and log files
+// created as root
+func (d *Daemon) dropPrivileges() error {
+	if d.runAs == nil {
+		return nil
+	}
+	for _, path := range []string{d.config.StateDir, d.config.ArchiveDir, d.config.AuditFile, d.config.LogFile} {
+		if path == "" {
+			continue
+		}
+		if err := privsep.Chown(path, *d.runAs); err != nil {
+			d.log.Warn().Err(err).Str("path", path).Msg("failed to hand files to the unprivileged user")
+		}
+	}
+	if err := privsep.Drop(*d.runAs); err != nil {
+		return fmt.Errorf("failed to drop privileges: %w", err)
+	}
+	d.log.Info().
+		Str("user", d.config.RunAsUser).
+		Int("uid", d.runAs.UID).
+		Int("gid", d.runAs.GID).
+		Bool("helper", d.helper != nil).
+		Msg("dropped privileges")
+	return nil
+}
+
+// closeHelper stops the privileged helper, if there is one
+func (d *Daemon) closeHelper() {
+	if d.helper == nil {
+		return
+	}
+	if err := d.helper.Close(); err != nil {
+		d.log.Warn().Err(err).Msg("privileged helper exited with an error")
+	}
+}
@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// rawPort is the port printers take raw print data on
+const rawPort = "9100"
+
+// rawPortAddr returns addr with the raw port added if it has none, or, if
+// addr is empty, the raw port of a socket:// device URI's host. It returns ""
+// if neither gives an address.
+func rawPortAddr(addr, deviceURI string) string {
+	if addr == "" {
+		device, err := url.Parse(deviceURI)
+		if err != nil || device.Scheme != "socket" || device.Hostname() == "" {
+			return ""
+		}
+		return net.JoinHostPort(device.Hostname(), rawPort)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return net.JoinHostPort(addr, rawPort)
+	}
+	return addr
+}
+
+// rawAddr returns where a raw printer's jobs are sent, or "" for printers
+// printing through CUPS
+func (d *Daemon) rawAddr(p cups.Printer) string {
+	addr, ok := d.config.RawPrinters[p.Name]
+	if !ok {
+		return ""
+	}
+	if addr = rawPortAddr(addr, p.DeviceURI); addr == "" {
+		d.log.Warn().Str("printer", p.Name).Str("device_uri", p.DeviceURI).Msg("can't send jobs raw: set raw address, printing through CUPS")
+	}
+	return addr
+}
@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
+	"github.com/WaffleThief123/airprint-bridge/internal/mdns"
+)
+
+// defaultReflectInterval is how often printers to reflect are browsed for
+const defaultReflectInterval = 30 * time.Second
+
+// reflectEnabled reports whether printers are reflected between interfaces
+func (c Config) reflectEnabled() bool {
+	return len(c.ReflectFrom) > 0 && len(c.ReflectTo) > 0
+}
+
+// startReflector re-announces the printers found on the reflect.from
+// interfaces on the reflect.to ones, through a responder of its own
+func (d *Daemon) startReflector(ctx context.Context) error {
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %w", err)
+	}
+	host, _, _ = strings.Cut(host, ".")
+
+	responder, err := mdns.NewResponder(d.config.ReflectTo, "", d.log)
+	if err != nil {
+		return fmt.Errorf("failed to configure mDNS reflector: %w", err)
+	}
+	match := avahi.NameFilter(d.config.ReflectInclude, d.config.ReflectExclude)
+	filter := func(s mdns.Service) bool { return match(s.Instance) }
+	interval := d.config.ReflectInterval
+	if interval <= 0 {
+		interval = defaultReflectInterval
+	}
+	reflector, err := mdns.NewReflector(d.config.ReflectFrom, responder, filter, host, interval, d.log)
+	if err != nil {
+		return fmt.Errorf("failed to configure mDNS reflector: %w", err)
+	}
+
+	go func() {
+		if err := responder.Run(ctx); err != nil {
+			d.log.Error().Err(err).Msg("mDNS reflector failed")
+		}
+	}()
+	go reflector.Run(ctx)
+	d.log.Info().
+		Strs("from", d.config.ReflectFrom).
+		Strs("to", d.config.ReflectTo).
+		Msg("reflecting printers between interfaces")
+	return nil
+}
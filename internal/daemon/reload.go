@@ -0,0 +1,245 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/media"
+	"github.com/WaffleThief123/airprint-bridge/internal/systemd"
+)
+
+// configWatchInterval is how often the config file is checked for changes
+// when WatchConfig is set
+const configWatchInterval = 5 * time.Second
+
+// ReloadFunc re-reads the daemon configuration, e.g. from the config file
+type ReloadFunc func() (Config, error)
+
+// SetReloadFunc sets how the configuration is re-read on SIGHUP or when the
+// watched config file changes. Without one, a reload only re-syncs printers.
+func (d *Daemon) SetReloadFunc(fn ReloadFunc) {
+	d.reloadFunc = fn
+}
+
+// reload re-reads the configuration, applies what can change at runtime and
+// re-syncs printers. A config that fails to load leaves the current one in place.
+func (d *Daemon) reload(ticker *time.Ticker) {
+	d.notify(systemd.Reloading)
+	defer d.notify(systemd.Ready)
+
+	if d.reloadFunc != nil {
+		config, err := d.reloadFunc()
+		if err != nil {
+			d.log.Error().Err(err).Msg("failed to reload config, keeping current settings")
+		} else {
+			d.applyConfig(config, ticker)
+		}
+	}
+
+	if err := d.syncPrinters(); err != nil {
+		d.logSyncError(err, "reload failed")
+	}
+}
+
+// applyConfig switches to a reloaded configuration. Settings that are bound
+// to listeners or proxies at startup keep their old values until restart.
+// It runs in the main loop, so the media registry and location resolver it
+// replaces are only read there; see Daemon.
+func (d *Daemon) applyConfig(config Config, ticker *time.Ticker) {
+	config = config.withStaged()
+	if fields := restartRequired(d.config, config); len(fields) > 0 {
+		d.log.Warn().Strs("settings", fields).Msg("changed settings take effect after a restart")
+	}
+
+	// API handlers read the config from their own goroutines
+	d.configMu.Lock()
+	defer d.configMu.Unlock()
+
+	old := d.config
+	d.config.SharedOnly = config.SharedOnly
+	d.config.IncludeList = config.IncludeList
+	d.config.ExcludeList = config.ExcludeList
+	d.config.Schedules = config.Schedules
+	d.config.URFConversion = config.URFConversion
+	d.config.FormatFallback = config.FormatFallback
+	d.config.Watermarks = config.Watermarks
+	d.config.PrinterFeatures = config.PrinterFeatures
+	d.config.Identify = config.Identify
+	d.config.PrinterPortBase = config.PrinterPortBase
+	d.config.PrinterPorts = config.PrinterPorts
+	d.config.PrintScaling = config.PrintScaling
+	d.config.MaxQueuedJobs = config.MaxQueuedJobs
+	d.config.QueueLimits = config.QueueLimits
+	d.config.Quirks = config.Quirks
+	d.config.AllowedNetworks = config.AllowedNetworks
+	d.config.MaxConcurrentJobs = config.MaxConcurrentJobs
+	d.config.MaxClientJobs = config.MaxClientJobs
+	if d.ippServer != nil {
+		d.ippServer.SetQuirks(config.Quirks)
+		d.ippServer.SetAllowedNetworks(config.AllowedNetworks)
+		d.ippServer.SetJobLimits(config.jobLimits())
+	}
+	// Without the release pages served at startup, held jobs couldn't be
+	// released
+	if (len(old.HoldJobs) > 0) == (len(config.HoldJobs) > 0) {
+		d.config.HoldJobs = config.HoldJobs
+	}
+	d.config.HoldTimeout = config.HoldTimeout
+	d.config.ArchiveQuota = config.ArchiveQuota
+	d.config.ArchiveQuotas = config.ArchiveQuotas
+	if d.archive != nil {
+		d.archive.SetQuotas(config.ArchiveQuota, config.ArchiveQuotas)
+	}
+	d.config.DocumentFormats = config.DocumentFormats
+	d.avahiManager.SetFormatPreferences(config.DocumentFormats)
+	d.config.DisplayNames = config.DisplayNames
+	d.avahiManager.SetDisplayNames(config.DisplayNames)
+	d.config.URFOverrides = config.URFOverrides
+	d.config.GeoLocations = config.GeoLocations
+	d.config.PrinterIcons = config.PrinterIcons
+	d.config.RawPrinters = config.RawPrinters
+	d.avahiManager.SetURFOverrides(config.URFOverrides)
+
+	if !reflect.DeepEqual(old.MediaOverrides, config.MediaOverrides) || !reflect.DeepEqual(old.MediaProfiles, config.MediaProfiles) {
+		d.config.MediaOverrides = config.MediaOverrides
+		d.config.MediaProfiles = config.MediaProfiles
+		d.mediaRegistry = newMediaRegistry(config)
+		d.mediaProfiles = make(map[string]string)
+		d.mediaDefaults = make(map[string]string)
+	}
+
+	if !reflect.DeepEqual(old.LocationSources, config.LocationSources) || old.LocationOverride != config.LocationOverride {
+		d.config.LocationSources = config.LocationSources
+		d.config.LocationOverride = config.LocationOverride
+		d.locations = newLocationResolver(config, d.log)
+	}
+
+	if config.PollInterval != old.PollInterval && config.PollInterval > 0 {
+		d.config.PollInterval = config.PollInterval
+		ticker.Reset(config.PollInterval)
+	}
+
+	if config.LogLevel != old.LogLevel {
+		if level, err := zerolog.ParseLevel(config.LogLevel); err == nil {
+			d.config.LogLevel = config.LogLevel
+			d.setConfiguredLevel(level)
+		}
+	}
+
+	d.log.Info().
+		Dur("poll_interval", d.config.PollInterval).
+		Str("log_level", d.config.LogLevel).
+		Msg("config reloaded")
+}
+
+// currentConfig returns a copy of the configuration for goroutines other
+// than the main loop. Reloads replace maps and slices rather than modifying
+// them, so the copy can be read without the lock.
+func (d *Daemon) currentConfig() Config {
+	d.configMu.RLock()
+	defer d.configMu.RUnlock()
+	return d.config
+}
+
+// restartRequired lists settings that differ but can't be changed at runtime
+func restartRequired(old, config Config) []string {
+	var fields []string
+	check := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			fields = append(fields, name)
+		}
+	}
+
+	check("state_dir", old.StateDir, config.StateDir)
+	check("cups", []interface{}{old.CUPSHost, old.CUPSPort}, []interface{}{config.CUPSHost, config.CUPSPort})
+	check("cups.auth", []interface{}{old.CUPSUser, old.CUPSPassword, old.CUPSPrinterAuth}, []interface{}{config.CUPSUser, config.CUPSPassword, config.CUPSPrinterAuth})
+	check("ipp.port", old.IPPPort, config.IPPPort)
+	check("ipp.submit_timeout", old.SubmitTimeout, config.SubmitTimeout)
+	check("ipp.status_ttl", old.StatusTTL, config.StatusTTL)
+	check("ipp.trace_job_names", old.TraceJobNames, config.TraceJobNames)
+	check("ipp.stall_timeout", old.StallTimeout, config.StallTimeout)
+	check("ipp.min_upload_rate", old.MinUploadRate, config.MinUploadRate)
+	check("ipp.max_connections_per_ip", old.MaxConnsPerIP, config.MaxConnsPerIP)
+	check("ipp.read_timeout", old.ReadTimeout, config.ReadTimeout)
+	check("ipp.write_timeout", old.WriteTimeout, config.WriteTimeout)
+	check("ipp.max_header_bytes", old.MaxHeaderBytes, config.MaxHeaderBytes)
+	check("ipp.max_document_mb", old.MaxDocumentSize, config.MaxDocumentSize)
+	check("ipp.tls", []interface{}{old.TLSPort, old.TLSCertFile, old.TLSKeyFile, old.TLSMinVersion, old.TLSCipherSuites, old.TLSNoTickets},
+		[]interface{}{config.TLSPort, config.TLSCertFile, config.TLSKeyFile, config.TLSMinVersion, config.TLSCipherSuites, config.TLSNoTickets})
+	check("avahi", []interface{}{old.ServiceDir, old.FilePrefix, old.LegacyFiles}, []interface{}{config.ServiceDir, config.FilePrefix, config.LegacyFiles})
+	check("mdns.interfaces", old.MDNSInterfaces, config.MDNSInterfaces)
+	check("mdns.prefer_interfaces", old.PreferInterfaces, config.PreferInterfaces)
+	check("mdns.reflect", []interface{}{old.ReflectFrom, old.ReflectTo, old.ReflectInclude, old.ReflectExclude, old.ReflectInterval},
+		[]interface{}{config.ReflectFrom, config.ReflectTo, config.ReflectInclude, config.ReflectExclude, config.ReflectInterval})
+	check("failover", old.Failover, config.Failover)
+	check("virtual_printers", old.VirtualPrinters, config.VirtualPrinters)
+	check("staged", old.StagedPrinters, config.StagedPrinters)
+	check("null_printer", old.NullPrinter, config.NullPrinter)
+	check("standalone", old.Standalone, config.Standalone)
+	check("archive", []interface{}{old.ArchiveDir, old.ArchiveMaxAge}, []interface{}{config.ArchiveDir, config.ArchiveMaxAge})
+	check("webhooks", old.WebhookURLs, config.WebhookURLs)
+	check("api", old.APIListen, config.APIListen)
+	check("display", []interface{}{old.TimeZone, old.Hour12}, []interface{}{config.TimeZone, config.Hour12})
+	check("labels", old.LabelDir, config.LabelDir)
+	check("watch_config", old.WatchConfig, config.WatchConfig)
+	check("auth", []interface{}{old.AuthUsers, old.GuestTokens, old.GuestTokenMaxTTL, old.AuthProviders, old.IPPAuth, old.APIAuth, old.APITokens}, []interface{}{config.AuthUsers, config.GuestTokens, config.GuestTokenMaxTTL, config.AuthProviders, config.IPPAuth, config.APIAuth, config.APITokens})
+	// Printers can start or stop holding jobs live, but the release pages
+	// are only served if some printer held jobs at startup
+	check("release.printers", len(old.HoldJobs) > 0, len(config.HoldJobs) > 0)
+	check("release.pins", old.ReleasePINs, config.ReleasePINs)
+	check("auth.access", []interface{}{old.PrinterAccess, old.GroupProvider, old.GroupCacheTTL}, []interface{}{config.PrinterAccess, config.GroupProvider, config.GroupCacheTTL})
+	check("security", []interface{}{old.RunAsUser, old.RunAsGroup}, []interface{}{config.RunAsUser, config.RunAsGroup})
+	check("audit", []interface{}{old.AuditLog, old.AuditFile}, []interface{}{config.AuditLog, config.AuditFile})
+	check("log", []interface{}{old.LogFormat, old.LogOutput, old.SyslogFacility, old.SyslogTag, old.SyslogAddress, old.LogFile, old.LogMaxSize, old.LogMaxAge, old.LogMaxBackups},
+		[]interface{}{config.LogFormat, config.LogOutput, config.SyslogFacility, config.SyslogTag, config.SyslogAddress, config.LogFile, config.LogMaxSize, config.LogMaxAge, config.LogMaxBackups})
+
+	return fields
+}
+
+// newMediaRegistry creates the media registry with builtin and configured
+// profiles and the configured overrides
+func newMediaRegistry(config Config) *media.Registry {
+	registry := media.NewRegistry()
+	for _, p := range config.MediaProfiles {
+		registry.AddProfile(p)
+	}
+	if len(config.MediaOverrides) > 0 {
+		registry.ApplyConfigOverrides(config.MediaOverrides)
+	}
+	return registry
+}
+
+// watchConfig signals on changes when the config file's modification time
+// changes, until ctx is done
+func (d *Daemon) watchConfig(ctx context.Context, changed chan<- struct{}) {
+	modTime := func() time.Time {
+		info, err := os.Stat(d.config.ConfigFile)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+
+	last := modTime()
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if current := modTime(); !current.Equal(last) {
+				last = current
+				select {
+				case changed <- struct{}{}:
+				default: // A reload is already pending
+				}
+			}
+		}
+	}
+}
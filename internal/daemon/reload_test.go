@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/api"
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/media"
+)
+
+// TestReloadWhileServingAPI reloads and syncs as the main loop does while
+// API requests come in. Run with -race.
+func TestReloadWhileServingAPI(t *testing.T) {
+	dir := t.TempDir()
+	inventory := filepath.Join(dir, "inventory.csv")
+	if err := os.WriteFile(inventory, []byte("queue,location\nOffice,Second floor\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	base := DefaultConfig()
+	base.ServiceDir = dir
+	changed := base
+	changed.MediaOverrides = []media.ConfigOverride{{PrinterName: "Office", ProfileName: "zebra-4x6"}}
+	changed.LocationSources = []LocationSource{{Type: LocationSourceCSV, Path: inventory}}
+	changed.DisplayNames = map[string]string{"Office": "Office Printer"}
+	changed.MaxQueuedJobs = 5
+
+	printers := []cups.Printer{{
+		Name:           "Office",
+		MakeModel:      "Generic Laser",
+		IsShared:       true,
+		IsAccepting:    true,
+		State:          cups.PrinterStateIdle,
+		MediaSupported: []string{"na_letter_8.5x11in"},
+		MediaDefault:   "na_letter_8.5x11in",
+	}}
+
+	d := New(base, zerolog.Nop())
+	d.ippServer = ipp.NewServer(":0", nil, nil, zerolog.Nop())
+	// A sync, less the CUPS query
+	syncPrinters := func() {
+		d.served = d.servedPrinters(printers)
+		d.ippServer.SetPrinters(d.ippPrinters(d.served))
+		if err := d.avahiManager.UpdatePrinters(d.served, d.config.SharedOnly, d.config.IncludeList, d.config.ExcludeList); err != nil {
+			t.Error(err)
+		}
+	}
+	syncPrinters()
+
+	var ln net.Listener
+	apiServer := api.NewServer("127.0.0.1:0", zerolog.Nop())
+	apiServer.SetListenFunc(func(addr string) (net.Listener, error) {
+		var err error
+		ln, err = net.Listen("tcp", addr)
+		return ln, err
+	})
+	apiServer.EnableInfo(d)
+	apiServer.EnablePrinters(d, d.ippServer)
+	apiServer.EnableStats(d)
+	apiServer.EnableLogLevel(d)
+	if err := apiServer.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = apiServer.ListenAndServe() }()
+	defer func() { _ = apiServer.Shutdown(context.Background()) }()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, path := range []string{"/api/v1/info", "/api/v1/printers", "/api/v1/stats", "/api/v1/log-level"} {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				resp, err := http.Get(url)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("GET %s: HTTP status %d", url, resp.StatusCode)
+					return
+				}
+			}
+		}("http://" + ln.Addr().String() + path)
+	}
+
+	// The main loop
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for i := 0; i < 50; i++ {
+		config := base
+		if i%2 == 0 {
+			config = changed
+		}
+		d.applyConfig(config, ticker)
+		syncPrinters()
+		if i == 0 {
+			if p := d.ippServer.Printers(); len(p) != 1 || p[0].MediaProfile != "zebra-4x6" || p[0].Location != "Second floor" {
+				t.Errorf("printers after reload = %+v, want the zebra-4x6 profile and inventory location", p)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	// The last reload went back to the base config
+	if p := d.ippServer.Printers(); len(p) != 1 || p[0].DisplayName != "" || p[0].MediaProfile != "" || p[0].Location != "" {
+		t.Errorf("printers after reload = %+v", p)
+	}
+}
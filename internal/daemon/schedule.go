@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// servedPrinters returns the printers to serve and advertise: CUPS printers,
+// with locations filled in, plus virtual printers, minus any printer outside
+// its schedule
+func (d *Daemon) servedPrinters(printers []cups.Printer) []cups.Printer {
+	printers = d.withNullPrinter(d.withVirtualPrinters(d.withStagedPrinters(d.locations.Apply(d.withStandalonePrinters(printers)))))
+	if len(d.config.Schedules) == 0 {
+		return printers
+	}
+
+	now := time.Now()
+	served := make([]cups.Printer, 0, len(printers))
+	for _, p := range printers {
+		if d.scheduleActive(p.Name, now) {
+			served = append(served, p)
+		}
+	}
+	return served
+}
+
+// scheduleActive checks a printer's schedule, logging when it opens or closes
+func (d *Daemon) scheduleActive(name string, now time.Time) bool {
+	sched, ok := d.config.Schedules[name]
+	if !ok {
+		return true
+	}
+
+	active := sched.Active(now)
+	if last, seen := d.scheduleStates[name]; !seen || last != active {
+		d.scheduleStates[name] = active
+		if active {
+			d.log.Info().Str("printer", name).Msg("printer schedule open, advertising")
+		} else {
+			d.log.Info().Str("printer", name).Msg("printer outside schedule, hiding")
+		}
+	}
+	return active
+}
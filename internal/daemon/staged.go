@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/media"
+)
+
+// StagedPrinter advertises a CUPS queue a second time under another name, so
+// a new pipeline can be tried by some users while everyone else keeps the
+// stable one. Per-printer settings under Name apply to the variant only;
+// settings it doesn't override are inherited from Printer.
+type StagedPrinter struct {
+	Name    string // Name of the variant, used in its URI and settings
+	Printer string // CUPS queue the variant prints to
+}
+
+// stagedQueues returns the CUPS queue behind each staged variant
+func (c Config) stagedQueues() map[string]string {
+	queues := make(map[string]string, len(c.StagedPrinters))
+	for _, s := range c.StagedPrinters {
+		queues[s.Name] = s.Printer
+	}
+	return queues
+}
+
+// withStaged returns the config with each staged variant inheriting the
+// per-printer settings of its stable printer that it doesn't set itself.
+// The maps of c are not modified.
+func (c Config) withStaged() Config {
+	for _, s := range c.StagedPrinters {
+		c.CUPSPrinterAuth = inherit(c.CUPSPrinterAuth, s.Printer, s.Name)
+		c.Schedules = inherit(c.Schedules, s.Printer, s.Name)
+		c.URFConversion = inherit(c.URFConversion, s.Printer, s.Name)
+		c.FormatFallback = inherit(c.FormatFallback, s.Printer, s.Name)
+		c.Watermarks = inherit(c.Watermarks, s.Printer, s.Name)
+		c.PrinterFeatures = inherit(c.PrinterFeatures, s.Printer, s.Name)
+		c.Identify = inherit(c.Identify, s.Printer, s.Name)
+		c.PrintScaling = inherit(c.PrintScaling, s.Printer, s.Name)
+		c.QueueLimits = inherit(c.QueueLimits, s.Printer, s.Name)
+		c.HoldJobs = inherit(c.HoldJobs, s.Printer, s.Name)
+		c.URFOverrides = inherit(c.URFOverrides, s.Printer, s.Name)
+		c.DocumentFormats = inherit(c.DocumentFormats, s.Printer, s.Name)
+		c.PrinterAccess = inherit(c.PrinterAccess, s.Printer, s.Name)
+		c.MediaOverrides = inheritMedia(c.MediaOverrides, s.Printer, s.Name)
+	}
+	return c
+}
+
+// inherit returns m with from's entry copied to to, unless to has its own.
+// m is copied rather than modified.
+func inherit[V any](m map[string]V, from, to string) map[string]V {
+	v, ok := m[from]
+	if _, set := m[to]; !ok || set {
+		return m
+	}
+	result := make(map[string]V, len(m)+1)
+	for k, e := range m {
+		result[k] = e
+	}
+	result[to] = v
+	return result
+}
+
+// inheritMedia copies from's media override to to, unless to has its own
+func inheritMedia(overrides []media.ConfigOverride, from, to string) []media.ConfigOverride {
+	var found *media.ConfigOverride
+	for i := range overrides {
+		switch overrides[i].PrinterName {
+		case to:
+			return overrides
+		case from:
+			found = &overrides[i]
+		}
+	}
+	if found == nil {
+		return overrides
+	}
+	o := *found
+	o.PrinterName = to
+	return append(append([]media.ConfigOverride(nil), overrides...), o)
+}
+
+// withStagedPrinters appends a copy of the stable printer for each staged
+// variant to the CUPS list
+func (d *Daemon) withStagedPrinters(printers []cups.Printer) []cups.Printer {
+	result := printers
+	for _, s := range d.config.StagedPrinters {
+		found := false
+		for _, p := range printers {
+			if p.Name == s.Printer {
+				p.Name = s.Name
+				result = append(result, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			d.log.Warn().Str("printer", s.Name).Str("stable", s.Printer).Msg("staged printer's queue not found in CUPS")
+		}
+	}
+	return result
+}
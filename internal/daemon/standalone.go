@@ -0,0 +1,250 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// upstreamTimeout bounds each query of a re-exported printer
+const upstreamTimeout = 5 * time.Second
+
+// Languages standalone printers are fed
+const (
+	LanguagePDF = "pdf" // PDF, rendered from Apple Raster
+	LanguagePWG = "pwg" // PWG Raster, converted from Apple Raster
+	LanguageZPL = "zpl" // Zebra ZPL labels, rendered from Apple Raster
+)
+
+// StandalonePrinter is a network printer defined entirely in the config and
+// printed to without a CUPS queue, so the bridge can serve printers that
+// lack AirPrint on its own
+type StandalonePrinter struct {
+	Name         string
+	URI          string // socket://host[:port], ipp://host/path or ipps://host/path
+	Language     string // What socket printers are sent and IPP printers get image/urf jobs converted to, "" to forward IPP jobs as sent
+	MakeModel    string
+	Location     string
+	Info         string
+	Color        bool
+	Duplex       bool
+	Resolutions  []int
+	Media        []string
+	MediaDefault string
+	Reexport     bool // Capabilities are queried from the IPP printer itself instead of set here
+}
+
+// scheme returns the backend the printer is reached through: socket, ipp or
+// ipps
+func (s StandalonePrinter) scheme() string {
+	u, err := url.Parse(s.URI)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme
+}
+
+// printer synthesizes the CUPS view of the printer, with letter and A4 paper
+// at 300 dpi unless the config says otherwise
+func (s StandalonePrinter) printer() cups.Printer {
+	p := cups.Printer{
+		Name:            s.Name,
+		DeviceURI:       s.URI,
+		MakeModel:       s.MakeModel,
+		Location:        s.Location,
+		Info:            s.Info,
+		IsShared:        true,
+		IsAccepting:     true,
+		State:           cups.PrinterStateIdle,
+		ColorSupported:  s.Color,
+		DuplexSupported: s.Duplex,
+		Resolutions:     s.Resolutions,
+		MediaSupported:  s.Media,
+		MediaDefault:    s.MediaDefault,
+	}
+	if p.MakeModel == "" {
+		p.MakeModel = "Generic Network Printer"
+	}
+	if len(p.Resolutions) == 0 {
+		p.Resolutions = []int{300}
+	}
+	p.DefaultResolution = p.Resolutions[0]
+	if len(p.MediaSupported) == 0 {
+		p.MediaSupported = []string{"na_letter_8.5x11in", "iso_a4_210x297mm"}
+	}
+	if p.MediaDefault == "" {
+		p.MediaDefault = p.MediaSupported[0]
+	}
+	return p
+}
+
+// configure sets how the bridge feeds the printer. Socket printers have no
+// CUPS filters in front of them, so they only take Apple Raster, which is
+// converted to their language. Re-exported printers get Apple Raster as is
+// if they take it, else converted to what they do take, and only raster if
+// they can't print PDF.
+func (s StandalonePrinter) configure(config ipp.PrinterConfig, p cups.Printer) ipp.PrinterConfig {
+	if s.Reexport {
+		switch {
+		case containsString(p.Formats, raster.FormatURF):
+		case containsString(p.Formats, raster.FormatPWG):
+			config.URFConversion = raster.FormatPWG
+		case containsString(p.Formats, raster.FormatPDF):
+			config.URFConversion = raster.FormatPDF
+		}
+		config.RasterOnly = !containsString(p.Formats, raster.FormatPDF)
+		return config
+	}
+	switch s.Language {
+	case LanguageZPL:
+		config.RawAddr = socketAddr(s.URI)
+		return config
+	case LanguagePDF:
+		config.URFConversion = raster.FormatPDF
+	case LanguagePWG:
+		config.URFConversion = raster.FormatPWG
+	}
+	config.RasterOnly = s.scheme() == "socket"
+	return config
+}
+
+// socketAddr returns the host:port of a socket:// URI, on the raw port if it
+// names none
+func socketAddr(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), rawPort)
+	}
+	return u.Host
+}
+
+// standalonePrinter returns the standalone printer named name, if any
+func (c Config) standalonePrinter(name string) (StandalonePrinter, bool) {
+	for _, s := range c.Standalone {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return StandalonePrinter{}, false
+}
+
+// reexports reports whether any printer is re-exported
+func (c Config) reexports() bool {
+	for _, s := range c.Standalone {
+		if s.Reexport {
+			return true
+		}
+	}
+	return false
+}
+
+// backends returns the backend of each standalone printer, except ZPL
+// printers, whose jobs are rendered and sent by the IPP server itself
+func (c Config) backends() (map[string]ipp.Backend, error) {
+	backends := make(map[string]ipp.Backend, len(c.Standalone))
+	for _, s := range c.Standalone {
+		if s.Language == LanguageZPL {
+			continue
+		}
+		backend, err := ipp.NewBackend(s.URI)
+		if err != nil {
+			return nil, err
+		}
+		backends[s.Name] = backend
+	}
+	return backends, nil
+}
+
+// withStandalonePrinters appends the standalone printers to the CUPS list.
+// Re-exported printers are left out until their capabilities are known.
+func (d *Daemon) withStandalonePrinters(printers []cups.Printer) []cups.Printer {
+	for _, s := range d.config.Standalone {
+		if !s.Reexport {
+			printers = append(printers, s.printer())
+			continue
+		}
+		d.upstreamMu.Lock()
+		upstream, ok := d.upstream[s.Name]
+		d.upstreamMu.Unlock()
+		if ok {
+			printers = append(printers, s.reexported(upstream.printer))
+		}
+	}
+	return printers
+}
+
+// upstreamPrinter is what a re-exported printer last said about itself
+type upstreamPrinter struct {
+	printer cups.Printer
+	down    bool // The last query failed
+}
+
+// reexported returns the printer as queried, under its configured name and
+// with the configured make and model, location and info if set
+func (s StandalonePrinter) reexported(p cups.Printer) cups.Printer {
+	p.Name = s.Name
+	if s.MakeModel != "" {
+		p.MakeModel = s.MakeModel
+	}
+	if s.Location != "" {
+		p.Location = s.Location
+	}
+	if s.Info != "" {
+		p.Info = s.Info
+	}
+	return p
+}
+
+// queryUpstream asks each re-exported printer for its capabilities and
+// state. A printer that stops answering keeps its last capabilities but is
+// shown stopped, so clients see it as offline rather than gone.
+func (d *Daemon) queryUpstream() {
+	for _, s := range d.config.Standalone {
+		if !s.Reexport {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), upstreamTimeout)
+		p, err := cups.QueryPrinter(ctx, s.URI)
+		cancel()
+
+		d.upstreamMu.Lock()
+		last, known := d.upstream[s.Name]
+		switch {
+		case err == nil:
+			if last.down {
+				d.log.Info().Str("printer", s.Name).Str("uri", s.URI).Msg("re-exported printer is reachable again")
+			}
+			d.upstream[s.Name] = upstreamPrinter{printer: p}
+		case !known:
+			d.log.Warn().Err(err).Str("printer", s.Name).Str("uri", s.URI).Msg("failed to query re-exported printer, not serving it yet")
+		case !last.down:
+			d.log.Warn().Err(err).Str("printer", s.Name).Str("uri", s.URI).Msg("failed to query re-exported printer, showing it stopped")
+			last.printer.State = cups.PrinterStateStopped
+			last.printer.IsAccepting = false
+			last.down = true
+			d.upstream[s.Name] = last
+		}
+		d.upstreamMu.Unlock()
+	}
+}
+
+// cupsPrinters fetches the printer list from CUPS at startup. A bridge with
+// standalone printers doesn't need CUPS, so it starts with those alone when
+// CUPS can't be reached.
+func (d *Daemon) cupsPrinters() ([]cups.Printer, error) {
+	d.queryUpstream()
+	printers, err := d.cupsClient.GetPrinters()
+	if err != nil && len(d.config.Standalone) > 0 {
+		d.log.Warn().Err(err).Msg("failed to get printers from CUPS, serving standalone printers only")
+		return nil, nil
+	}
+	return printers, err
+}
@@ -0,0 +1,62 @@
+package daemon
+
+import (
+	"sort"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/state"
+)
+
+// openState loads what earlier runs left in the state directory and notes
+// printers that were in CUPS last time but have gone. Without a usable
+// state directory the bridge still runs, but forgets jobs on restart.
+func (d *Daemon) openState(printers []cups.Printer) {
+	if d.config.StateDir == "" {
+		return
+	}
+	store, err := state.Open(d.config.StateDir)
+	if err != nil {
+		d.log.Warn().Err(err).Str("dir", d.config.StateDir).Msg("failed to open state directory, jobs won't be tracked across restarts")
+		return
+	}
+	d.state = store
+
+	current := make(map[string]bool, len(printers))
+	for _, p := range printers {
+		current[p.Name] = true
+	}
+	var missing []string
+	for _, name := range store.Printers() {
+		if !current[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		d.log.Warn().Strs("printers", missing).Msg("printers seen last run are no longer in CUPS")
+	}
+	store.SetPrinters(printerNames(printers))
+}
+
+// saveState writes the jobs being tracked and anything else that changed to
+// the state directory
+func (d *Daemon) saveState() {
+	if d.state == nil {
+		return
+	}
+	if d.tracker != nil {
+		d.state.SetJobs(d.tracker.Snapshot())
+	}
+	if err := d.state.Save(); err != nil {
+		d.log.Warn().Err(err).Msg("failed to save state")
+	}
+}
+
+// printerNames returns the names of printers, sorted
+func printerNames(printers []cups.Printer) []string {
+	names := make([]string, len(printers))
+	for i, p := range printers {
+		names[i] = p.Name
+	}
+	sort.Strings(names)
+	return names
+}
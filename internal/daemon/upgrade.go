@@ -0,0 +1,56 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/systemd"
+)
+
+// handOverTimeout bounds how long requests in progress, such as job
+// uploads, may take to finish once a new process has taken over
+const handOverTimeout = 30 * time.Second
+
+// upgrade starts the bridge's executable, which may have been replaced by a
+// package upgrade, with the listening sockets, and reports whether it took
+// over. If it didn't this process carries on as before.
+func (d *Daemon) upgrade() bool {
+	// Unprivileged, the new process couldn't start a helper of its own
+	if d.runAs != nil {
+		d.log.Error().Msg("can't upgrade in place after dropping privileges, restart the service instead")
+		return false
+	}
+	// The new process picks up job IDs and UUIDs from the state directory.
+	// Jobs accepted while it starts are still printed but not tracked there.
+	d.saveState()
+	if err := d.upgrader.Upgrade(); err != nil {
+		d.log.Error().Err(err).Msg("new process failed to take over, carrying on")
+		return false
+	}
+	return true
+}
+
+// handOver stops serving once a new process has taken over. Unlike
+// shutdown, advertisements are left in place for the new process.
+func (d *Daemon) handOver() error {
+	ctx, cancel := context.WithTimeout(context.Background(), handOverTimeout)
+	defer cancel()
+
+	if d.apiServer != nil {
+		if err := d.apiServer.Shutdown(ctx); err != nil {
+			d.log.Warn().Err(err).Msg("API requests cut off")
+		}
+	}
+	if err := d.ippServer.Shutdown(ctx); err != nil {
+		d.log.Warn().Err(err).Msg("IPP requests cut off")
+	}
+	d.log.Info().Msg("handed over to new process")
+	return nil
+}
+
+// notify tells systemd about a change of state, if it supervises the bridge
+func (d *Daemon) notify(state string) {
+	if err := systemd.Notify(state); err != nil {
+		d.log.Warn().Err(err).Str("state", state).Msg("failed to notify systemd")
+	}
+}
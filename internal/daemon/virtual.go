@@ -0,0 +1,173 @@
+package daemon
+
+import (
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+// Virtual printer modes
+const (
+	VirtualModeBroadcast  = "broadcast"           // Send every job to all members
+	VirtualModeRoundRobin = ipp.BalanceRoundRobin // Rotate jobs across healthy members
+	VirtualModeLeastBusy  = ipp.BalanceLeastBusy  // Send to the healthy member with the fewest queued jobs
+)
+
+// VirtualPrinter is an AirPrint destination backed by several CUPS queues
+type VirtualPrinter struct {
+	Name    string
+	Mode    string
+	Members []string
+}
+
+// broadcastGroups returns the member lists of all broadcast virtual printers
+func (c Config) broadcastGroups() map[string][]string {
+	groups := make(map[string][]string)
+	for _, v := range c.VirtualPrinters {
+		if v.Mode == VirtualModeBroadcast {
+			groups[v.Name] = v.Members
+		}
+	}
+	return groups
+}
+
+// balancePools returns the pools of all load-balancing virtual printers
+func (c Config) balancePools() map[string]ipp.BalancePool {
+	pools := make(map[string]ipp.BalancePool)
+	for _, v := range c.VirtualPrinters {
+		if v.Mode == VirtualModeRoundRobin || v.Mode == VirtualModeLeastBusy {
+			pools[v.Name] = ipp.BalancePool{
+				Members:  v.Members,
+				Strategy: v.Mode,
+			}
+		}
+	}
+	return pools
+}
+
+// memberStates queries CUPS once for the health of the named queues
+func (d *Daemon) memberStates(names []string) (map[string]ipp.MemberState, error) {
+	printers, err := d.cupsClient.GetPrinters()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	states := make(map[string]ipp.MemberState, len(names))
+	for _, p := range printers {
+		if wanted[p.Name] {
+			states[p.Name] = ipp.MemberState{
+				Available:  p.IsAvailable(),
+				QueuedJobs: p.QueuedJobs,
+			}
+		}
+	}
+	return states, nil
+}
+
+// virtualPrinter synthesizes a printer for advertisement from the members it
+// groups. Capabilities are limited to what every available member supports,
+// or every member while none is available, so a job never relies on a
+// feature, paper size or resolution one of the stations lacks.
+func virtualPrinter(v VirtualPrinter, printers []cups.Printer) (cups.Printer, bool) {
+	byName := make(map[string]cups.Printer, len(printers))
+	for _, p := range printers {
+		byName[p.Name] = p
+	}
+
+	var found, available []cups.Printer
+	for _, name := range v.Members {
+		if m, ok := byName[name]; ok {
+			found = append(found, m)
+			if m.IsAvailable() {
+				available = append(available, m)
+			}
+		}
+	}
+	if len(found) == 0 {
+		return cups.Printer{}, false
+	}
+	members := available
+	if len(members) == 0 {
+		members = found
+	}
+
+	first := members[0]
+	vp := cups.Printer{
+		Name:            v.Name,
+		MakeModel:       "AirPrint Bridge Virtual Printer",
+		Location:        first.Location,
+		IsShared:        true,
+		IsAccepting:     len(available) > 0,
+		State:           cups.PrinterStateIdle,
+		ColorSupported:  true,
+		DuplexSupported: true,
+		Resolutions:     first.Resolutions,
+		MediaSupported:  first.MediaSupported,
+		MediaReady:      first.MediaReady,
+	}
+	for _, m := range members[1:] {
+		vp.Resolutions = intersect(vp.Resolutions, m.Resolutions)
+		vp.MediaSupported = intersect(vp.MediaSupported, m.MediaSupported)
+		vp.MediaReady = intersect(vp.MediaReady, m.MediaReady)
+	}
+	for _, m := range members {
+		vp.ColorSupported = vp.ColorSupported && m.ColorSupported
+		vp.DuplexSupported = vp.DuplexSupported && m.DuplexSupported
+		if vp.Location == "" {
+			vp.Location = m.Location
+		}
+	}
+
+	// Keep the first member's defaults where every member offers them
+	if containsString(vp.MediaSupported, first.MediaDefault) {
+		vp.MediaDefault = first.MediaDefault
+	} else if len(vp.MediaSupported) > 0 {
+		vp.MediaDefault = vp.MediaSupported[0]
+	}
+	for _, dpi := range vp.Resolutions {
+		if dpi == first.DefaultResolution {
+			vp.DefaultResolution = dpi
+		}
+	}
+	return vp, true
+}
+
+// intersect returns the values of a that are also in b, in the order of a
+func intersect[T comparable](a, b []T) []T {
+	in := make(map[T]bool, len(b))
+	for _, v := range b {
+		in[v] = true
+	}
+	var result []T
+	for _, v := range a {
+		if in[v] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// withVirtualPrinters appends the configured virtual printers to the CUPS list
+func (d *Daemon) withVirtualPrinters(printers []cups.Printer) []cups.Printer {
+	result := append([]cups.Printer(nil), printers...)
+	for _, v := range d.config.VirtualPrinters {
+		switch v.Mode {
+		case VirtualModeBroadcast, VirtualModeRoundRobin, VirtualModeLeastBusy:
+		default:
+			d.log.Warn().Str("printer", v.Name).Str("mode", v.Mode).Msg("unknown virtual printer mode, not advertising")
+			continue
+		}
+
+		vp, ok := virtualPrinter(v, printers)
+		if !ok {
+			d.log.Warn().Str("printer", v.Name).Strs("members", v.Members).Msg("virtual printer has no members in CUPS")
+			continue
+		}
+		result = append(result, vp)
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+func TestVirtualPrinter(t *testing.T) {
+	a4 := "iso_a4_210x297mm"
+	letter := "na_letter_8.5x11in"
+	legal := "na_legal_8.5x14in"
+	member := func(name string, available, color bool, dpi []int, media []string) cups.Printer {
+		p := cups.Printer{
+			Name:              name,
+			IsAccepting:       true,
+			State:             cups.PrinterStateIdle,
+			ColorSupported:    color,
+			DuplexSupported:   true,
+			Resolutions:       dpi,
+			DefaultResolution: dpi[0],
+			MediaSupported:    media,
+			MediaReady:        media[:1],
+			MediaDefault:      media[0],
+		}
+		if !available {
+			p.State = cups.PrinterStateStopped
+		}
+		return p
+	}
+
+	tests := []struct {
+		name           string
+		members        []cups.Printer
+		wantOK         bool
+		wantAccepting  bool
+		wantColor      bool
+		wantDPI        []int
+		wantMedia      []string
+		wantReady      []string
+		wantDefault    string
+		wantDefaultDPI int
+	}{
+		{
+			name:    "no members in CUPS",
+			members: nil,
+			wantOK:  false,
+		},
+		{
+			name: "common subset",
+			members: []cups.Printer{
+				member("A", true, true, []int{300, 600}, []string{a4, letter, legal}),
+				member("B", true, false, []int{600, 1200}, []string{letter, a4}),
+			},
+			wantOK: true, wantAccepting: true, wantColor: false,
+			wantDPI: []int{600}, wantMedia: []string{a4, letter}, wantReady: nil, wantDefault: a4, wantDefaultDPI: 0,
+		},
+		{
+			name: "default not shared",
+			members: []cups.Printer{
+				member("A", true, true, []int{600}, []string{legal, letter}),
+				member("B", true, true, []int{600}, []string{letter}),
+			},
+			wantOK: true, wantAccepting: true, wantColor: true,
+			wantDPI: []int{600}, wantMedia: []string{letter}, wantReady: nil, wantDefault: letter, wantDefaultDPI: 600,
+		},
+		{
+			name: "offline member ignored",
+			members: []cups.Printer{
+				member("A", false, false, []int{300}, []string{legal}),
+				member("B", true, true, []int{600}, []string{a4, letter}),
+			},
+			wantOK: true, wantAccepting: true, wantColor: true,
+			wantDPI: []int{600}, wantMedia: []string{a4, letter}, wantReady: []string{a4}, wantDefault: a4, wantDefaultDPI: 600,
+		},
+		{
+			name: "all offline",
+			members: []cups.Printer{
+				member("A", false, true, []int{300, 600}, []string{a4, letter}),
+				member("B", false, true, []int{600}, []string{a4}),
+			},
+			wantOK: true, wantAccepting: false, wantColor: true,
+			wantDPI: []int{600}, wantMedia: []string{a4}, wantReady: []string{a4}, wantDefault: a4, wantDefaultDPI: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := VirtualPrinter{Name: "Group", Mode: VirtualModeBroadcast, Members: []string{"A", "B", "Missing"}}
+			vp, ok := virtualPrinter(v, tt.members)
+			if ok != tt.wantOK {
+				t.Fatalf("virtualPrinter() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if vp.Name != "Group" || vp.IsAccepting != tt.wantAccepting || vp.ColorSupported != tt.wantColor {
+				t.Errorf("printer = %q accepting %v color %v, want Group accepting %v color %v", vp.Name, vp.IsAccepting, vp.ColorSupported, tt.wantAccepting, tt.wantColor)
+			}
+			if !reflect.DeepEqual(vp.Resolutions, tt.wantDPI) || vp.DefaultResolution != tt.wantDefaultDPI {
+				t.Errorf("resolutions = %v default %d, want %v default %d", vp.Resolutions, vp.DefaultResolution, tt.wantDPI, tt.wantDefaultDPI)
+			}
+			if !reflect.DeepEqual(vp.MediaSupported, tt.wantMedia) || !reflect.DeepEqual(vp.MediaReady, tt.wantReady) || vp.MediaDefault != tt.wantDefault {
+				t.Errorf("media = %v ready %v default %q, want %v ready %v default %q", vp.MediaSupported, vp.MediaReady, vp.MediaDefault, tt.wantMedia, tt.wantReady, tt.wantDefault)
+			}
+		})
+	}
+}
+
+func TestWithVirtualPrinters(t *testing.T) {
+	printers := make([]cups.Printer, 1, 4)
+	printers[0] = cups.Printer{Name: "A", IsAccepting: true}
+	d := &Daemon{config: Config{VirtualPrinters: []VirtualPrinter{
+		{Name: "Group", Mode: VirtualModeRoundRobin, Members: []string{"A"}},
+	}}}
+
+	got := d.withVirtualPrinters(printers)
+	if len(got) != 2 || got[1].Name != "Group" {
+		t.Fatalf("withVirtualPrinters() = %+v, want A and Group", got)
+	}
+	// The caller's slice has spare capacity, which must not be written to
+	if extra := printers[:2]; extra[1].Name != "" {
+		t.Errorf("caller's slice was written to: %+v", extra)
+	}
+}
@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/dnssd"
+	"github.com/WaffleThief123/airprint-bridge/internal/mdns"
+)
+
+// WriteZone queries CUPS and writes the wide-area DNS-SD records for the
+// printers that would be advertised to w in format, so a unicast DNS server
+// can offer them to clients multicast doesn't reach
+func (d *Daemon) WriteZone(w io.Writer, format string, zone dnssd.Zone) error {
+	if err := d.cupsClient.TestConnection(); err != nil {
+		return fmt.Errorf("cannot connect to CUPS: %w", err)
+	}
+	ippAuth, _, _, err := d.newAuthenticators()
+	if err != nil {
+		return fmt.Errorf("failed to configure authentication: %w", err)
+	}
+	printers, err := d.cupsPrinters()
+	if err != nil {
+		return fmt.Errorf("failed to get printers: %w", err)
+	}
+
+	// Instance names match those advertised over mDNS
+	host, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %w", err)
+	}
+	host, _, _ = strings.Cut(host, ".")
+
+	served := d.servedPrinters(printers)
+	d.configureAdvertising(served, ippAuth != nil)
+	var services []mdns.Service
+	for _, planned := range d.avahiManager.Plan(served, d.config.SharedOnly, d.config.IncludeList, d.config.ExcludeList) {
+		if planned.Skipped != "" {
+			continue
+		}
+		services = append(services, d.avahiManager.Services(&planned.Printer, host)...)
+	}
+	return zone.Write(w, format, services)
+}
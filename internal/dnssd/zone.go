@@ -0,0 +1,212 @@
+// Package dnssd writes DNS-SD records for unicast DNS servers, so clients
+// can discover printers through wide-area DNS-SD (RFC 6763 section 11)
+// where multicast doesn't reach.
+package dnssd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/mdns"
+)
+
+// Zone formats
+const (
+	FormatBIND    = "bind"    // Zone file lines, also read by NSD, Knot and PowerDNS
+	FormatUnbound = "unbound" // local-data statements
+	FormatDnsmasq = "dnsmasq" // ptr-record, srv-host and txt-record options
+)
+
+// Formats lists the zone formats
+var Formats = []string{FormatBIND, FormatUnbound, FormatDnsmasq}
+
+// DefaultTTL is the TTL of records unless the zone sets one
+const DefaultTTL = 3600
+
+// Zone says where services are published
+type Zone struct {
+	Domain string   // Domain clients browse, e.g. "example.com"
+	Host   string   // Host name SRV records point at, e.g. "print.example.com"
+	Addrs  []net.IP // Addresses of Host to publish, none if it is already in DNS
+	TTL    int      // 0 for DefaultTTL
+}
+
+// record is one resource record, with names fully qualified and escaped
+type record struct {
+	name  string
+	rtype string
+	data  []string // RDATA fields
+}
+
+// records returns the records publishing services in z: the browsing
+// domain pointers, then per service type, instance, and host
+func (z Zone) records(services []mdns.Service) []record {
+	domain := fqdn(z.Domain)
+	host := fqdn(z.Host)
+	records := []record{
+		{"b._dns-sd._udp." + domain, "PTR", []string{domain}},
+		{"lb._dns-sd._udp." + domain, "PTR", []string{domain}},
+	}
+
+	types := make(map[string][]string) // Type or subtype -> instances
+	for _, s := range services {
+		instance := escapeLabel(s.Instance) + "." + s.Type + "." + domain
+		for _, t := range append([]string{s.Type}, s.Subtypes...) {
+			types[t] = append(types[t], instance)
+		}
+	}
+	names := make([]string, 0, len(types))
+	for t := range types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	// Type enumeration lists the types, not their subtypes
+	for _, t := range names {
+		if !strings.Contains(t, "._sub.") {
+			records = append(records, record{"_services._dns-sd._udp." + domain, "PTR", []string{t + "." + domain}})
+		}
+	}
+	for _, t := range names {
+		for _, instance := range types[t] {
+			records = append(records, record{t + "." + domain, "PTR", []string{instance}})
+		}
+	}
+
+	for _, s := range services {
+		instance := escapeLabel(s.Instance) + "." + s.Type + "." + domain
+		txt := make([]string, 0, len(s.TXT))
+		for _, kv := range s.TXT {
+			txt = append(txt, quote(kv))
+		}
+		if len(txt) == 0 {
+			txt = []string{`""`}
+		}
+		records = append(records,
+			record{instance, "SRV", []string{"0", "0", fmt.Sprint(s.Port), host}},
+			record{instance, "TXT", txt},
+		)
+	}
+
+	for _, ip := range z.Addrs {
+		if ip.To4() != nil {
+			records = append(records, record{host, "A", []string{ip.String()}})
+		} else {
+			records = append(records, record{host, "AAAA", []string{ip.String()}})
+		}
+	}
+	return records
+}
+
+// Write writes the records publishing services in the zone's domain to w in
+// format
+func (z Zone) Write(w io.Writer, format string, services []mdns.Service) error {
+	ttl := z.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if z.Domain == "" || z.Host == "" {
+		return fmt.Errorf("a domain and a host are needed")
+	}
+
+	records := z.records(services)
+	var err error
+	for _, r := range records {
+		switch format {
+		case FormatBIND:
+			_, err = fmt.Fprintf(w, "%s %d IN %s %s\n", r.name, ttl, r.rtype, strings.Join(r.data, " "))
+		case FormatUnbound:
+			_, err = fmt.Fprintf(w, "local-data: '%s %d IN %s %s'\n", r.name, ttl, r.rtype, strings.Join(r.data, " "))
+		case FormatDnsmasq:
+			err = writeDnsmasq(w, r)
+		default:
+			return fmt.Errorf("unknown zone format %q (use %s)", format, strings.Join(Formats, ", "))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDnsmasq writes a record as a dnsmasq option. dnsmasq takes names
+// unescaped and can't have more than one address per host-record line.
+func writeDnsmasq(w io.Writer, r record) error {
+	name := unescape(strings.TrimSuffix(r.name, "."))
+	var err error
+	switch r.rtype {
+	case "PTR":
+		_, err = fmt.Fprintf(w, "ptr-record=%s,%s\n", name, quoteDnsmasq(unescape(strings.TrimSuffix(r.data[0], "."))))
+	case "SRV":
+		_, err = fmt.Fprintf(w, "srv-host=%s,%s,%s,%s,%s\n", quoteDnsmasq(name), strings.TrimSuffix(r.data[3], "."), r.data[2], r.data[0], r.data[1])
+	case "TXT":
+		_, err = fmt.Fprintf(w, "txt-record=%s,%s\n", quoteDnsmasq(name), strings.Join(r.data, ","))
+	case "A", "AAAA":
+		_, err = fmt.Fprintf(w, "host-record=%s,%s\n", name, r.data[0])
+	}
+	return err
+}
+
+// fqdn returns name with a trailing dot
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+// escapeLabel escapes an instance name for use as one label of a master
+// file name: dots, backslashes and quotes are backslash-escaped, spaces
+// and other characters outside printable ASCII are \DDD escaped
+func escapeLabel(label string) string {
+	var b strings.Builder
+	for _, c := range []byte(label) {
+		switch {
+		case c == '.' || c == '\\' || c == '"' || c == '(' || c == ')' || c == ';' || c == '@' || c == '$':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c <= ' ' || c >= 0x7f || c == '\'':
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// unescape reverses escapeLabel for formats that take names as they are
+func unescape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '\\' || i+1 >= len(name) {
+			b.WriteByte(c)
+			continue
+		}
+		if i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]) {
+			b.WriteByte((name[i+1]-'0')*100 + (name[i+2]-'0')*10 + (name[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(name[i+1])
+		i++
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// quote returns s as a quoted character-string
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// quoteDnsmasq quotes names with spaces or commas for dnsmasq
+func quoteDnsmasq(name string) string {
+	if strings.ContainsAny(name, " ,") {
+		return `"` + name + `"`
+	}
+	return name
+}
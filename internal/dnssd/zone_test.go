@@ -0,0 +1,99 @@
+package dnssd
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/mdns"
+)
+
+var testServices = []mdns.Service{{
+	Instance: "Office Laser @ bridge",
+	Type:     "_ipp._tcp",
+	Subtypes: []string{"_universal._sub._ipp._tcp"},
+	Port:     8631,
+	TXT:      []string{"rp=printers/Office", `ty=HP "LaserJet"`},
+}}
+
+func TestZoneWrite(t *testing.T) {
+	zone := Zone{Domain: "example.com", Host: "print.example.com.", Addrs: []net.IP{net.ParseIP("10.0.0.5")}, TTL: 600}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatBIND, []string{
+			"b._dns-sd._udp.example.com. 600 IN PTR example.com.",
+			"lb._dns-sd._udp.example.com. 600 IN PTR example.com.",
+			"_services._dns-sd._udp.example.com. 600 IN PTR _ipp._tcp.example.com.",
+			`_ipp._tcp.example.com. 600 IN PTR Office\032Laser\032\@\032bridge._ipp._tcp.example.com.`,
+			`_universal._sub._ipp._tcp.example.com. 600 IN PTR Office\032Laser\032\@\032bridge._ipp._tcp.example.com.`,
+			`Office\032Laser\032\@\032bridge._ipp._tcp.example.com. 600 IN SRV 0 0 8631 print.example.com.`,
+			`Office\032Laser\032\@\032bridge._ipp._tcp.example.com. 600 IN TXT "rp=printers/Office" "ty=HP \"LaserJet\""`,
+			"print.example.com. 600 IN A 10.0.0.5",
+		}},
+		{FormatUnbound, []string{
+			"local-data: 'b._dns-sd._udp.example.com. 600 IN PTR example.com.'",
+			`local-data: 'Office\032Laser\032\@\032bridge._ipp._tcp.example.com. 600 IN SRV 0 0 8631 print.example.com.'`,
+		}},
+		{FormatDnsmasq, []string{
+			"ptr-record=b._dns-sd._udp.example.com,example.com",
+			`ptr-record=_ipp._tcp.example.com,"Office Laser @ bridge._ipp._tcp.example.com"`,
+			`srv-host="Office Laser @ bridge._ipp._tcp.example.com",print.example.com,8631,0,0`,
+			`txt-record="Office Laser @ bridge._ipp._tcp.example.com","rp=printers/Office","ty=HP \"LaserJet\""`,
+			"host-record=print.example.com,10.0.0.5",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := zone.Write(&buf, tt.format, testServices); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			lines := strings.Split(buf.String(), "\n")
+			for _, want := range tt.want {
+				found := false
+				for _, line := range lines {
+					found = found || line == want
+				}
+				if !found {
+					t.Errorf("missing line %q in:\n%s", want, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestZoneWriteErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (Zone{Domain: "example.com", Host: "print.example.com"}).Write(&buf, "tinydns", nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if err := (Zone{Domain: "example.com"}).Write(&buf, FormatBIND, nil); err == nil {
+		t.Error("expected error without a host")
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"Laser", "Laser"},
+		{"Office Laser", `Office\032Laser`},
+		{"Floor 2.1", `Floor\0322\.1`},
+		{`a\b`, `a\\b`},
+		{"Büro", `B\195\188ro`},
+	}
+	for _, tt := range tests {
+		if got := escapeLabel(tt.label); got != tt.want {
+			t.Errorf("escapeLabel(%q) = %q, want %q", tt.label, got, tt.want)
+		}
+		if got := unescape(escapeLabel(tt.label)); got != tt.label {
+			t.Errorf("unescape(escapeLabel(%q)) = %q", tt.label, got)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+// Package e2e runs the bridge end to end against a mock CUPS server, the
+// way an iOS device uses it: discover the printer, read its attributes,
+// print, and follow the job until it completes. It needs no CUPS, Avahi or
+// root, so packagers can check a build on their distribution.
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	goipp "github.com/phin1x/go-ipp"
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/audit"
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
+	"github.com/WaffleThief123/airprint-bridge/internal/daemon"
+)
+
+// printerName is the queue the mock CUPS has
+const printerName = "E2E_Printer"
+
+// pollInterval is how often the harness checks on something it waits for
+const pollInterval = 100 * time.Millisecond
+
+// testDocument is what the client prints
+var testDocument = []byte("%PDF-1.4\n% airprint-bridge end-to-end test\n%%EOF\n")
+
+// Options configure a run
+type Options struct {
+	Timeout time.Duration  // Longest each step may wait, 0 for 30s
+	Log     zerolog.Logger // Where the bridge logs
+}
+
+// Step is the outcome of one step of the scenario
+type Step struct {
+	Name     string
+	Detail   string // What was found, or why the step failed
+	Err      error
+	Skipped  bool // An earlier step failed
+	Duration time.Duration
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Steps []Step
+}
+
+// Passed reports whether every step passed
+func (r Report) Passed() bool {
+	for _, s := range r.Steps {
+		if s.Err != nil || s.Skipped {
+			return false
+		}
+	}
+	return len(r.Steps) > 0
+}
+
+// Write writes the report as one line per step and a summary
+func (r Report) Write(w io.Writer) {
+	passed := 0
+	for _, s := range r.Steps {
+		result, detail := "PASS", s.Detail
+		switch {
+		case s.Skipped:
+			result, detail = "SKIP", ""
+		case s.Err != nil:
+			result, detail = "FAIL", s.Err.Error()
+		default:
+			passed++
+		}
+		line := fmt.Sprintf("%s  %-12s %8s  %s", result, s.Name, s.Duration.Round(time.Millisecond), detail)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+	fmt.Fprintf(w, "%d of %d steps passed\n", passed, len(r.Steps))
+}
+
+// run holds what steps pass on to later ones
+type run struct {
+	opts       Options
+	dir        string
+	cups       *MockCUPS
+	ippPort    int
+	client     *goipp.HttpAdapter // Reused, so polling doesn't open a connection per request
+	serviceDir string
+	cancel     context.CancelFunc
+	done       chan error // Result of the bridge's Run
+	printerURI string
+	format     string
+	jobID      int
+}
+
+// Run runs the scenario and reports each step. A failed step skips the
+// ones after it, except shutting down.
+func Run(ctx context.Context, opts Options) Report {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	r := &run{opts: opts}
+	defer r.cleanup()
+
+	steps := []struct {
+		name string
+		fn   func(ctx context.Context) (string, error)
+	}{
+		{"mock-cups", r.startCUPS},
+		{"bridge", r.startBridge},
+		{"discovery", r.discover},
+		{"attributes", r.attributes},
+		{"print", r.print},
+		{"job-status", r.jobStatus},
+		{"delivery", r.delivery},
+		{"streaming", r.streaming},
+		{"shutdown", r.shutdown},
+	}
+
+	var report Report
+	failed := false
+	for _, step := range steps {
+		if failed && step.name != "shutdown" {
+			report.Steps = append(report.Steps, Step{Name: step.name, Skipped: true})
+			continue
+		}
+		start := time.Now()
+		detail, err := step.fn(ctx)
+		report.Steps = append(report.Steps, Step{Name: step.name, Detail: detail, Err: err, Duration: time.Since(start)})
+		failed = failed || err != nil
+	}
+	return report
+}
+
+// startCUPS starts the mock CUPS server
+func (r *run) startCUPS(context.Context) (string, error) {
+	cups, err := StartMockCUPS(printerName)
+	if err != nil {
+		return "", err
+	}
+	r.cups = cups
+	return fmt.Sprintf("listening on port %d", cups.Port()), nil
+}
+
+// startBridge starts the bridge against the mock, writing its service
+// files and state to a temporary directory, and waits until it serves IPP
+func (r *run) startBridge(ctx context.Context) (string, error) {
+	dir, err := os.MkdirTemp("", "airprint-bridge-e2e-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	r.dir = dir
+	r.serviceDir = filepath.Join(dir, "services")
+	if err := os.Mkdir(r.serviceDir, 0o755); err != nil {
+		return "", err
+	}
+	if r.ippPort, err = freePort(); err != nil {
+		return "", err
+	}
+
+	config := daemon.DefaultConfig()
+	config.CUPSHost = "127.0.0.1"
+	config.CUPSPort = r.cups.Port()
+	config.IPPPort = r.ippPort
+	config.ServiceDir = r.serviceDir
+	config.StateDir = filepath.Join(dir, "state")
+	config.AuditLog = true
+	config.AuditFile = filepath.Join(dir, "audit.log")
+
+	bridgeCtx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	r.done = make(chan error, 1)
+	bridge := daemon.New(config, r.opts.Log)
+	go func() { r.done <- bridge.Run(bridgeCtx) }()
+
+	addr := fmt.Sprintf("127.0.0.1:%d", r.ippPort)
+	err = r.wait(ctx, func() (bool, error) {
+		select {
+		case err := <-r.done:
+			r.done = nil
+			return false, fmt.Errorf("bridge exited: %v", err)
+		default:
+		}
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false, nil
+		}
+		conn.Close()
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("serving IPP on port %d", r.ippPort), nil
+}
+
+// discover reads the printer's service file, as Avahi would, and finds the
+// printer URI in it
+func (r *run) discover(ctx context.Context) (string, error) {
+	var group avahi.ServiceGroup
+	err := r.wait(ctx, func() (bool, error) {
+		files, _ := filepath.Glob(filepath.Join(r.serviceDir, "*.service"))
+		if len(files) == 0 {
+			return false, nil
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			return false, err
+		}
+		return true, xml.Unmarshal(data, &group)
+	})
+	if err != nil {
+		return "", fmt.Errorf("no service file written: %w", err)
+	}
+
+	for _, s := range group.Service {
+		if s.Type != "_ipp._tcp" {
+			continue
+		}
+		txt := make(map[string]string)
+		for _, record := range s.TXTRecord {
+			k, v, _ := strings.Cut(record.Value, "=")
+			txt[k] = v
+		}
+		if txt["rp"] == "" || txt["URF"] == "" {
+			return "", fmt.Errorf("service is missing AirPrint TXT records: %v", txt)
+		}
+		if !contains(s.SubTypes, "_universal._sub._ipp._tcp") {
+			return "", errors.New("service lacks the _universal subtype iOS browses for")
+		}
+		r.printerURI = fmt.Sprintf("ipp://127.0.0.1:%d/%s", s.Port, txt["rp"])
+		return fmt.Sprintf("%q at %s", group.Name, r.printerURI), nil
+	}
+	return "", errors.New("service file has no _ipp._tcp service")
+}
+
+// attributes gets the printer's attributes and checks what AirPrint
+// clients need
+func (r *run) attributes(ctx context.Context) (string, error) {
+	req := goipp.NewRequest(goipp.OperationGetPrinterAttributes, 1)
+	req.OperationAttributes["printer-uri"] = r.printerURI
+	req.OperationAttributes["requesting-user-name"] = "e2e"
+	req.OperationAttributes["requested-attributes"] = []string{"all"}
+	resp, err := r.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.PrinterAttributes) == 0 {
+		return "", errors.New("no printer attributes returned")
+	}
+	attrs := resp.PrinterAttributes[0]
+	for _, name := range []string{"printer-name", "printer-state", "printer-uri-supported", "media-supported", "urf-supported"} {
+		if len(attrs[name]) == 0 {
+			return "", fmt.Errorf("missing %s", name)
+		}
+	}
+
+	formats := attributeStrings(attrs, "document-format-supported")
+	if !contains(formats, "image/urf") {
+		return "", fmt.Errorf("image/urf not among document formats %v", formats)
+	}
+	r.format = "image/urf"
+	if contains(formats, "application/pdf") {
+		r.format = "application/pdf"
+	}
+
+	// Clients asking for some attributes get only those
+	req = goipp.NewRequest(goipp.OperationGetPrinterAttributes, 1)
+	req.OperationAttributes["printer-uri"] = r.printerURI
+	req.OperationAttributes["requesting-user-name"] = "e2e"
+	req.OperationAttributes["requested-attributes"] = []string{"printer-state", "job-template"}
+	resp, err = r.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.PrinterAttributes) == 0 {
+		return "", errors.New("no printer attributes returned for requested subset")
+	}
+	subset := resp.PrinterAttributes[0]
+	if len(subset["printer-state"]) == 0 || len(subset["sides-supported"]) == 0 {
+		return "", errors.New("requested attributes missing from subset")
+	}
+	if len(subset["printer-name"]) > 0 {
+		return "", errors.New("unrequested printer-name returned in subset")
+	}
+	return fmt.Sprintf("%d attributes (%d requested), formats %s", len(attrs), len(subset), strings.Join(formats, ",")), nil
+}
+
+// print submits a job
+func (r *run) print(ctx context.Context) (string, error) {
+	req := goipp.NewRequest(goipp.OperationPrintJob, 2)
+	req.OperationAttributes["printer-uri"] = r.printerURI
+	req.OperationAttributes["requesting-user-name"] = "e2e"
+	req.OperationAttributes["job-name"] = "airprint-bridge e2e"
+	req.OperationAttributes["document-format"] = r.format
+	req.File = bytes.NewReader(testDocument)
+	req.FileSize = len(testDocument)
+	resp, err := r.send(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.JobAttributes) == 0 || len(resp.JobAttributes[0]["job-id"]) == 0 {
+		return "", errors.New("no job-id returned")
+	}
+	id, ok := resp.JobAttributes[0]["job-id"][0].Value.(int)
+	if !ok {
+		return "", errors.New("job-id is not an integer")
+	}
+	r.jobID = id
+	return fmt.Sprintf("job %d, %s", id, r.format), nil
+}
+
+// jobStatus follows the job until the bridge reports it completed
+func (r *run) jobStatus(ctx context.Context) (string, error) {
+	var states []string
+	err := r.wait(ctx, func() (bool, error) {
+		req := goipp.NewRequest(goipp.OperationGetJobAttributes, 3)
+		req.OperationAttributes["printer-uri"] = r.printerURI
+		req.OperationAttributes["job-id"] = r.jobID
+		req.OperationAttributes["requesting-user-name"] = "e2e"
+		resp, err := r.send(ctx, req)
+		if err != nil {
+			return false, err
+		}
+		if len(resp.JobAttributes) == 0 || len(resp.JobAttributes[0]["job-state"]) == 0 {
+			return false, errors.New("no job-state returned")
+		}
+		state, _ := resp.JobAttributes[0]["job-state"][0].Value.(int)
+		if name := jobStateName(state); len(states) == 0 || states[len(states)-1] != name {
+			states = append(states, name)
+		}
+		switch state {
+		case jobCompleted:
+			return true, nil
+		case 7, 8: // Canceled, aborted
+			return false, fmt.Errorf("job %s", jobStateName(state))
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w (states seen: %s)", err, strings.Join(states, ", "))
+	}
+	return strings.Join(states, " -> "), nil
+}
+
+// delivery checks CUPS got the document as it was printed
+func (r *run) delivery(context.Context) (string, error) {
+	// The bridge's job IDs are its own; the mock's first job is this one
+	document, printer, ok := r.cups.Document(1)
+	if !ok {
+		return "", errors.New("CUPS received no job")
+	}
+	if printer != printerName {
+		return "", fmt.Errorf("job sent to %q, want %q", printer, printerName)
+	}
+	if !bytes.Equal(document, testDocument) {
+		return "", fmt.Errorf("CUPS received %d bytes that differ from the %d printed", len(document), len(testDocument))
+	}
+
+	// The job is in the audit log
+	data, err := os.ReadFile(filepath.Join(r.dir, "audit.log"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read audit log: %w", err)
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	var rec audit.Record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return "", fmt.Errorf("failed to decode audit record: %w", err)
+	}
+	if rec.Operation != "Print-Job" || rec.Result != audit.ResultOK || rec.JobID != r.jobID || rec.Bytes != int64(len(testDocument)) {
+		return "", fmt.Errorf("audit record %+v doesn't match job %d", rec, r.jobID)
+	}
+	return fmt.Sprintf("%d bytes to %s, audited", len(document), printer), nil
+}
+
+// streaming prints again the way iOS sends large jobs: the body chunked,
+// without a Content-Length, after waiting for 100 Continue
+func (r *run) streaming(ctx context.Context) (string, error) {
+	req := goipp.NewRequest(goipp.OperationPrintJob, 4)
+	req.OperationAttributes["printer-uri"] = r.printerURI
+	req.OperationAttributes["requesting-user-name"] = "e2e"
+	req.OperationAttributes["job-name"] = "airprint-bridge e2e streaming"
+	req.OperationAttributes["document-format"] = r.format
+	payload, err := req.Encode()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("127.0.0.1:%d", r.ippPort))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(r.opts.Timeout))
+
+	path := r.printerURI[strings.Index(r.printerURI[len("ipp://"):], "/")+len("ipp://"):]
+	fmt.Fprintf(conn, "POST %s HTTP/1.1\r\nHost: 127.0.0.1\r\nContent-Type: application/ipp\r\n"+
+		"Transfer-Encoding: chunked\r\nExpect: 100-continue\r\n\r\n", path)
+
+	// The operation is in the body, so the bridge must ask for it
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read interim response: %w", err)
+	}
+	if resp.StatusCode != http.StatusContinue {
+		return "", fmt.Errorf("got %s instead of 100 Continue", resp.Status)
+	}
+
+	cw := httputil.NewChunkedWriter(conn)
+	for _, part := range [][]byte{payload, testDocument[:len(testDocument)/2], testDocument[len(testDocument)/2:]} {
+		if _, err := cw.Write(part); err != nil {
+			return "", fmt.Errorf("failed to send body: %w", err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		return "", fmt.Errorf("failed to send body: %w", err)
+	}
+	_, _ = io.WriteString(conn, "\r\n")
+
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("got %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	ippResp, err := goipp.NewResponseDecoder(bytes.NewReader(body)).Decode(nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := ippResp.CheckForErrors(); err != nil {
+		return "", err
+	}
+
+	document, _, ok := r.cups.Document(2)
+	if !ok {
+		return "", errors.New("CUPS received no streamed job")
+	}
+	if !bytes.Equal(document, testDocument) {
+		return "", fmt.Errorf("CUPS received %d bytes that differ from the %d streamed", len(document), len(testDocument))
+	}
+	return fmt.Sprintf("%d bytes chunked after 100 Continue", len(document)), nil
+}
+
+// shutdown stops the bridge and checks it withdrew its printers
+func (r *run) shutdown(ctx context.Context) (string, error) {
+	if r.cancel == nil || r.done == nil {
+		return "bridge not running", nil
+	}
+	r.cancel()
+	select {
+	case err := <-r.done:
+		r.done = nil
+		if err != nil {
+			return "", fmt.Errorf("bridge exited with error: %w", err)
+		}
+	case <-time.After(r.opts.Timeout):
+		return "", errors.New("bridge didn't stop")
+	}
+	if files, _ := filepath.Glob(filepath.Join(r.serviceDir, "*.service")); len(files) > 0 {
+		return "", fmt.Errorf("service files left behind: %d", len(files))
+	}
+	return "service files removed", nil
+}
+
+// cleanup stops whatever is still running and removes temporary files
+func (r *run) cleanup() {
+	if r.cancel != nil {
+		r.cancel()
+		if r.done != nil {
+			select {
+			case <-r.done:
+			case <-time.After(r.opts.Timeout):
+			}
+		}
+	}
+	if r.cups != nil {
+		r.cups.Close()
+	}
+	if r.dir != "" {
+		os.RemoveAll(r.dir)
+	}
+}
+
+// send sends a request to the bridge and checks the response's status
+func (r *run) send(ctx context.Context, req *goipp.Request) (*goipp.Response, error) {
+	if r.client == nil {
+		r.client = goipp.NewHttpAdapter("127.0.0.1", r.ippPort, "", "", false)
+	}
+	url := "http" + strings.TrimPrefix(r.printerURI, "ipp")
+	resp, err := r.client.SendRequestContext(ctx, url, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := resp.CheckForErrors(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// wait calls check until it reports done, fails or the step times out
+func (r *run) wait(ctx context.Context, check func() (bool, error)) error {
+	deadline := time.Now().Add(r.opts.Timeout)
+	for {
+		done, err := check()
+		if err != nil || done {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s", r.opts.Timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// freePort returns a loopback TCP port nothing listens on
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// attributeStrings returns the string values of an attribute
+func attributeStrings(attrs goipp.Attributes, name string) []string {
+	var values []string
+	for _, a := range attrs[name] {
+		if s, ok := a.Value.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jobStateName returns the keyword of a job state
+func jobStateName(state int) string {
+	names := map[int]string{3: "pending", 4: "pending-held", 5: "processing", 6: "processing-stopped", 7: "canceled", 8: "aborted", 9: "completed"}
+	if name, ok := names[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("state %d", state)
+}
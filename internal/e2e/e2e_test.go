@@ -0,0 +1,43 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRun(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts the bridge")
+	}
+	report := Run(context.Background(), Options{Timeout: 20 * time.Second, Log: zerolog.Nop()})
+	var out bytes.Buffer
+	report.Write(&out)
+	if !report.Passed() {
+		t.Errorf("end-to-end run failed:\n%s", out.String())
+	}
+}
+
+func TestReport(t *testing.T) {
+	report := Report{Steps: []Step{
+		{Name: "mock-cups", Detail: "listening"},
+		{Name: "bridge", Err: context.DeadlineExceeded},
+		{Name: "discovery", Skipped: true},
+	}}
+	if report.Passed() {
+		t.Error("Passed() = true with a failed step")
+	}
+	var out bytes.Buffer
+	report.Write(&out)
+	for _, want := range []string{"PASS  mock-cups", "FAIL  bridge", "SKIP  discovery", "1 of 3 steps passed"} {
+		if !bytes.Contains(out.Bytes(), []byte(want)) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+	if (Report{}).Passed() {
+		t.Error("empty report passed")
+	}
+}
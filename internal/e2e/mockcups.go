@@ -0,0 +1,239 @@
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/ipp"
+)
+
+// CUPS operations the mock answers besides the standard ones
+const opCupsGetPrinters = 0x4002
+
+// IPP status codes the mock sends
+const statusOperationNotSupported = 0x0501
+
+// Job states, as in RFC 8011 section 5.3.7
+const (
+	jobProcessing = 5
+	jobCompleted  = 9
+)
+
+// MockCUPS is a CUPS server with one shared printer. It accepts every job
+// and keeps the documents, reporting each job processing the first time it
+// is asked and completed after.
+type MockCUPS struct {
+	Printer string // Queue name
+
+	ln     net.Listener
+	server *http.Server
+
+	mu   sync.Mutex
+	jobs []mockJob
+}
+
+// mockJob is a job the mock received
+type mockJob struct {
+	printer  string
+	document []byte
+	polled   int // Get-Job-Attributes requests for it so far
+}
+
+// StartMockCUPS starts a mock CUPS server on a free loopback port
+func StartMockCUPS(printer string) (*MockCUPS, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	m := &MockCUPS{Printer: printer, ln: ln}
+	m.server = &http.Server{Handler: http.HandlerFunc(m.handle)}
+	go func() { _ = m.server.Serve(ln) }()
+	return m, nil
+}
+
+// Port returns the port the mock listens on
+func (m *MockCUPS) Port() int {
+	return m.ln.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops the mock
+func (m *MockCUPS) Close() error {
+	return m.server.Close()
+}
+
+// Document returns the document of a job the mock received and the queue
+// it was sent to
+func (m *MockCUPS) Document(jobID int) ([]byte, string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if jobID < 1 || jobID > len(m.jobs) {
+		return nil, "", false
+	}
+	job := m.jobs[jobID-1]
+	return job.document, job.printer, true
+}
+
+func (m *MockCUPS) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body := bufio.NewReader(r.Body)
+	req, err := ipp.ReadRequest(body)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var resp []byte
+	switch req.Operation {
+	case opCupsGetPrinters:
+		resp = m.printers(req)
+	case ipp.OpPrintJob:
+		resp = m.printJob(req, body)
+	case ipp.OpGetJobAttributes:
+		resp = m.jobAttributes(req)
+	case ipp.OpCancelJob:
+		resp = newEncoder(ipp.StatusOK, req.RequestID).end()
+	default:
+		resp = newEncoder(statusOperationNotSupported, req.RequestID).end()
+	}
+	w.Header().Set("Content-Type", "application/ipp")
+	_, _ = w.Write(resp)
+}
+
+// printers answers CUPS-Get-Printers with the mock's printer
+func (m *MockCUPS) printers(req *ipp.Request) []byte {
+	e := newEncoder(ipp.StatusOK, req.RequestID)
+	e.group(ipp.TagPrinterAttrs)
+	e.strings(ipp.TagNameWithoutLang, "printer-name", m.Printer)
+	e.strings(ipp.TagURI, "printer-uri-supported", fmt.Sprintf("ipp://127.0.0.1:%d/printers/%s", m.Port(), m.Printer))
+	e.strings(ipp.TagURI, "device-uri", "file:///dev/null")
+	e.strings(ipp.TagTextWithoutLang, "printer-make-and-model", "Mock Printer")
+	e.strings(ipp.TagTextWithoutLang, "printer-location", "End-to-end test")
+	e.strings(ipp.TagTextWithoutLang, "printer-info", "Mock Printer")
+	e.integer(ipp.TagEnum, "printer-state", 3) // Idle
+	e.boolean("printer-is-shared", true)
+	e.boolean("printer-is-accepting-jobs", true)
+	e.integer(ipp.TagInteger, "queued-job-count", 0)
+	e.boolean("color-supported", true)
+	e.strings(ipp.TagKeyword, "sides-supported", "one-sided", "two-sided-long-edge", "two-sided-short-edge")
+	e.strings(ipp.TagKeyword, "media-supported", "iso_a4_210x297mm", "na_letter_8.5x11in")
+	e.strings(ipp.TagKeyword, "media-ready", "iso_a4_210x297mm")
+	e.strings(ipp.TagKeyword, "media-default", "iso_a4_210x297mm")
+	return e.end()
+}
+
+// printJob keeps the document of a Print-Job request
+func (m *MockCUPS) printJob(req *ipp.Request, document io.Reader) []byte {
+	data, err := io.ReadAll(document)
+	if err != nil {
+		return newEncoder(ipp.StatusServerErrorInternalError, req.RequestID).end()
+	}
+	printer := req.OpAttr("printer-uri").String()
+	printer = printer[strings.LastIndex(printer, "/")+1:]
+
+	m.mu.Lock()
+	m.jobs = append(m.jobs, mockJob{printer: printer, document: data})
+	id := len(m.jobs)
+	m.mu.Unlock()
+
+	e := newEncoder(ipp.StatusOK, req.RequestID)
+	e.group(ipp.TagJobAttrs)
+	e.integer(ipp.TagInteger, "job-id", id)
+	e.strings(ipp.TagURI, "job-uri", fmt.Sprintf("ipp://127.0.0.1:%d/jobs/%d", m.Port(), id))
+	e.integer(ipp.TagEnum, "job-state", jobProcessing)
+	return e.end()
+}
+
+// jobAttributes reports a job processing, then completed
+func (m *MockCUPS) jobAttributes(req *ipp.Request) []byte {
+	id, ok := req.JobID()
+	m.mu.Lock()
+	if !ok || id < 1 || id > len(m.jobs) {
+		m.mu.Unlock()
+		return newEncoder(ipp.StatusClientErrorNotFound, req.RequestID).end()
+	}
+	job := &m.jobs[id-1]
+	job.polled++
+	state, reason, impressions := jobProcessing, "job-printing", 0
+	if job.polled > 1 {
+		state, reason, impressions = jobCompleted, "job-completed-successfully", 1
+	}
+	m.mu.Unlock()
+
+	e := newEncoder(ipp.StatusOK, req.RequestID)
+	e.group(ipp.TagJobAttrs)
+	e.integer(ipp.TagInteger, "job-id", id)
+	e.integer(ipp.TagEnum, "job-state", state)
+	e.strings(ipp.TagKeyword, "job-state-reasons", reason)
+	e.integer(ipp.TagInteger, "job-impressions-completed", impressions)
+	return e.end()
+}
+
+// encoder builds an IPP response
+type encoder struct {
+	buf bytes.Buffer
+}
+
+// newEncoder starts a response with the operation attributes every
+// response has
+func newEncoder(status uint16, requestID uint32) *encoder {
+	e := &encoder{}
+	_ = binary.Write(&e.buf, binary.BigEndian, uint16(0x0200))
+	_ = binary.Write(&e.buf, binary.BigEndian, status)
+	_ = binary.Write(&e.buf, binary.BigEndian, requestID)
+	e.group(ipp.TagOperationAttrs)
+	e.strings(ipp.TagCharset, "attributes-charset", "utf-8")
+	e.strings(ipp.TagNaturalLang, "attributes-natural-language", "en")
+	return e
+}
+
+func (e *encoder) group(tag byte) {
+	e.buf.WriteByte(tag)
+}
+
+// value writes one value, named unless it is an additional one
+func (e *encoder) value(tag byte, name string, data []byte) {
+	e.buf.WriteByte(tag)
+	_ = binary.Write(&e.buf, binary.BigEndian, uint16(len(name)))
+	e.buf.WriteString(name)
+	_ = binary.Write(&e.buf, binary.BigEndian, uint16(len(data)))
+	e.buf.Write(data)
+}
+
+func (e *encoder) strings(tag byte, name string, values ...string) {
+	for i, v := range values {
+		if i > 0 {
+			name = ""
+		}
+		e.value(tag, name, []byte(v))
+	}
+}
+
+func (e *encoder) integer(tag byte, name string, v int) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(int32(v)))
+	e.value(tag, name, data)
+}
+
+func (e *encoder) boolean(name string, v bool) {
+	data := []byte{0}
+	if v {
+		data[0] = 1
+	}
+	e.value(ipp.TagBoolean, name, data)
+}
+
+// end finishes the response and returns it
+func (e *encoder) end() []byte {
+	e.buf.WriteByte(ipp.TagEnd)
+	return e.buf.Bytes()
+}
@@ -0,0 +1,197 @@
+// Package identify makes physical printers show themselves when a client
+// sends Identify-Printer, e.g. so a user can find the right one on a shelf
+package identify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/phin1x/go-ipp"
+)
+
+// IPP identify-actions keywords
+const (
+	ActionFlash   = "flash"
+	ActionSound   = "sound"
+	ActionDisplay = "display"
+)
+
+// Actions lists the identify actions in the order they are advertised
+var Actions = []string{ActionFlash, ActionSound, ActionDisplay}
+
+// Ways of reaching a printer to identify it
+const (
+	MethodZebra = "zebra" // ZPL/SGD commands on the raw port
+	MethodIPP   = "ipp"   // Identify-Printer passed on to the printer
+)
+
+func init() {
+	// go-ipp doesn't know the Identify-Printer operation attributes
+	ipp.AttributeTagMapping["identify-actions"] = ipp.TagKeyword
+	ipp.AttributeTagMapping["message"] = ipp.TagText
+}
+
+// Device performs identify actions on a printer
+type Device interface {
+	// Actions returns the identify actions the device supports, the default
+	// first
+	Actions() []string
+	// Identify performs the given actions, showing message where the
+	// device has a display
+	Identify(ctx context.Context, actions []string, message string) error
+}
+
+// ZebraCommands are the commands a Zebra printer is sent for each action.
+// Zebras have no lamp to flash, so flash feeds one blank label.
+var ZebraCommands = map[string]string{
+	ActionFlash: "~PH",
+}
+
+// Zebra identifies a Zebra label printer by sending ZPL or SGD commands to
+// its raw port
+type Zebra struct {
+	Addr     string            // host:port of the raw port, usually 9100
+	Commands map[string]string // Action -> command, on top of ZebraCommands
+}
+
+// Actions returns the actions there are commands for
+func (z *Zebra) Actions() []string {
+	var actions []string
+	for _, action := range Actions {
+		if z.command(action) != "" {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+func (z *Zebra) command(action string) string {
+	if cmd, ok := z.Commands[action]; ok {
+		return cmd
+	}
+	return ZebraCommands[action]
+}
+
+// Identify sends the command for each action. Zebras have no display for a
+// message, so it is ignored.
+func (z *Zebra) Identify(ctx context.Context, actions []string, message string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", z.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to printer: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	for _, action := range actions {
+		cmd := z.command(action)
+		if cmd == "" {
+			continue
+		}
+		if _, err := io.WriteString(conn, cmd+"\r\n"); err != nil {
+			return fmt.Errorf("failed to send %s command: %w", action, err)
+		}
+	}
+	return nil
+}
+
+// IPP passes Identify-Printer on to a printer's own IPP service
+type IPP struct {
+	URI       string   // ipp:// or ipps:// URI of the printer
+	Supported []string // Actions to advertise, empty for flash only
+
+	httpClient *http.Client
+}
+
+// NewIPP creates a device forwarding Identify-Printer to uri
+func NewIPP(uri string, supported []string) *IPP {
+	return &IPP{
+		URI:        uri,
+		Supported:  supported,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Actions returns the configured actions
+func (p *IPP) Actions() []string {
+	if len(p.Supported) == 0 {
+		return []string{ActionFlash}
+	}
+	return p.Supported
+}
+
+// Identify sends Identify-Printer to the printer
+func (p *IPP) Identify(ctx context.Context, actions []string, message string) error {
+	endpoint, err := httpURL(p.URI)
+	if err != nil {
+		return err
+	}
+
+	req := ipp.NewRequest(ipp.OperationIdentifyPrinter, 1)
+	req.OperationAttributes["printer-uri"] = p.URI
+	req.OperationAttributes["requesting-user-name"] = "airprint"
+	req.OperationAttributes["identify-actions"] = actions
+	if message != "" {
+		req.OperationAttributes["message"] = message
+	}
+	payload, err := req.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode IPP request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/ipp")
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request to printer: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("printer answered HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read printer response: %w", err)
+	}
+	ippResp, err := ipp.NewResponseDecoder(bytes.NewReader(body)).Decode(nil)
+	if err != nil {
+		return fmt.Errorf("failed to decode IPP response: %w", err)
+	}
+	if ippResp.StatusCode != ipp.StatusOk {
+		return fmt.Errorf("printer returned error status: 0x%04x", ippResp.StatusCode)
+	}
+	return nil
+}
+
+// httpURL returns the HTTP URL an ipp:// or ipps:// URI is served at
+func httpURL(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid printer URI: %w", err)
+	}
+	switch u.Scheme {
+	case "ipp", "http":
+		u.Scheme = "http"
+	case "ipps", "https":
+		u.Scheme = "https"
+	default:
+		return "", fmt.Errorf("printer URI %q is not ipp:// or ipps://", uri)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "631")
+	}
+	return u.String(), nil
+}
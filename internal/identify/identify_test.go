@@ -0,0 +1,106 @@
+package identify
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/phin1x/go-ipp"
+)
+
+func TestZebra_Actions(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands map[string]string
+		want     []string
+	}{
+		{"defaults", nil, []string{ActionFlash}},
+		{"extra sound", map[string]string{ActionSound: `! U1 do "device.beep" ""`}, []string{ActionFlash, ActionSound}},
+		{"flash disabled", map[string]string{ActionFlash: "", ActionSound: "beep"}, []string{ActionSound}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := &Zebra{Commands: tt.commands}
+			if got := z.Actions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Actions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZebra_Identify(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		conn.Close()
+		received <- string(data)
+	}()
+
+	z := &Zebra{Addr: ln.Addr().String(), Commands: map[string]string{ActionSound: "BEEP"}}
+	if err := z.Identify(context.Background(), []string{ActionFlash, ActionSound, ActionDisplay}, "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "~PH\r\nBEEP\r\n" {
+		t.Errorf("sent %q, want feed and beep commands", got)
+	}
+}
+
+func TestIPP_Identify(t *testing.T) {
+	var got *ipp.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got, _ = ipp.NewRequestDecoder(bytes.NewReader(body)).Decode(nil)
+		resp := ipp.NewResponse(ipp.StatusOk, 1)
+		data, _ := resp.Encode()
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	uri := strings.Replace(srv.URL, "http://", "ipp://", 1) + "/ipp/print"
+	device := NewIPP(uri, []string{ActionDisplay, ActionSound})
+	if err := device.Identify(context.Background(), []string{ActionDisplay}, "Over here"); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Operation != ipp.OperationIdentifyPrinter {
+		t.Fatalf("printer got %+v, want Identify-Printer", got)
+	}
+	if msg := got.OperationAttributes["message"]; msg != "Over here" {
+		t.Errorf("message = %v, want Over here", msg)
+	}
+}
+
+func TestHTTPURL(t *testing.T) {
+	tests := []struct {
+		uri     string
+		want    string
+		wantErr bool
+	}{
+		{"ipp://10.0.0.5/ipp/print", "http://10.0.0.5:631/ipp/print", false},
+		{"ipps://printer.local:443/ipp/print", "https://printer.local:443/ipp/print", false},
+		{"socket://10.0.0.5:9100", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := httpURL(tt.uri)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("httpURL(%q) = %q, %v; want %q", tt.uri, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package ipp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseNetworks parses CIDR networks, e.g. "192.168.1.0/24". A bare address
+// stands for itself alone.
+func ParseNetworks(list []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", s)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", s, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// SetAllowedNetworks limits the IPP listeners to clients in the networks,
+// nil for any client. Requests from elsewhere get 403 Forbidden. Loopback
+// clients are always allowed.
+func (s *Server) SetAllowedNetworks(networks []*net.IPNet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.allowedNetworks = networks
+}
+
+// clientAllowed reports whether a client at the remote address of a request
+// may use the IPP listeners
+func (s *Server) clientAllowed(remoteAddr string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.allowedNetworks) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, network := range s.allowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrict refuses requests from clients outside the allowed networks
+// before they reach h. Requests are counted against their connection.
+func (s *Server) restrict(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.countRequest(r.Context())
+		if !s.clientAllowed(r.RemoteAddr) {
+			s.log.Warn().Str("remote", r.RemoteAddr).Str("path", r.URL.Path).Msg("refused request from outside the allowed networks")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,115 @@
+package ipp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    []string
+		want    []string
+		wantErr bool
+	}{
+		{"cidr", []string{"192.168.1.0/24"}, []string{"192.168.1.0/24"}, false},
+		{"host part cleared", []string{"192.168.1.7/24"}, []string{"192.168.1.0/24"}, false},
+		{"bare IPv4 address", []string{" 10.0.0.5 "}, []string{"10.0.0.5/32"}, false},
+		{"bare IPv6 address", []string{"fd00::1"}, []string{"fd00::1/128"}, false},
+		{"IPv6 cidr", []string{"fd00::/8"}, []string{"fd00::/8"}, false},
+		{"invalid address", []string{"printer.local"}, nil, true},
+		{"invalid prefix", []string{"10.0.0.0/33"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := ParseNetworks(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetworks() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(networks) != len(tt.want) {
+				t.Fatalf("ParseNetworks() = %v, want %v", networks, tt.want)
+			}
+			for i, network := range networks {
+				if network.String() != tt.want[i] {
+					t.Errorf("network %d = %s, want %s", i, network, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestServer_ClientAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string // nil for any client
+		remote  string
+		want    bool
+	}{
+		{"no list", nil, "203.0.113.9:631", true},
+		{"inside", []string{"192.168.1.0/24"}, "192.168.1.20:5000", true},
+		{"outside", []string{"192.168.1.0/24"}, "192.168.2.20:5000", false},
+		{"second network", []string{"192.168.1.0/24", "10.0.0.0/8"}, "10.1.2.3:5000", true},
+		{"single address", []string{"10.0.0.5"}, "10.0.0.5:5000", true},
+		{"next to single address", []string{"10.0.0.5"}, "10.0.0.6:5000", false},
+		{"IPv6 inside", []string{"fd00::/8"}, "[fd12::7]:5000", true},
+		{"IPv6 outside", []string{"fd00::/8"}, "[2001:db8::7]:5000", false},
+		{"IPv4-mapped IPv6", []string{"192.168.1.0/24"}, "[::ffff:192.168.1.20]:5000", true},
+		{"loopback", []string{"192.168.1.0/24"}, "127.0.0.1:5000", true},
+		{"IPv6 loopback", []string{"192.168.1.0/24"}, "[::1]:5000", true},
+		{"address without port", []string{"192.168.1.0/24"}, "192.168.1.20", true},
+		{"unparseable", []string{"192.168.1.0/24"}, "@", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := ParseNetworks(tt.allowed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+			if tt.allowed != nil {
+				s.SetAllowedNetworks(networks)
+			}
+			if got := s.clientAllowed(tt.remote); got != tt.want {
+				t.Errorf("clientAllowed(%q) = %v, want %v", tt.remote, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_Restrict(t *testing.T) {
+	networks, err := ParseNetworks([]string{"192.168.1.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+	s.SetAllowedNetworks(networks)
+	h := s.restrict(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		remote string
+		want   int
+	}{
+		{"allowed", "192.168.1.20:5000", http.StatusNoContent},
+		{"refused", "192.0.2.1:1234", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/printers/Office", nil)
+			r.RemoteAddr = tt.remote
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("HTTP status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
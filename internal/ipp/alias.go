@@ -0,0 +1,27 @@
+package ipp
+
+import (
+	"context"
+	"io"
+)
+
+// AliasProxy wraps a CUPSClient and sends jobs for printers that are
+// advertised under another name to the CUPS queue behind them
+type AliasProxy struct {
+	CUPSClient
+
+	queues map[string]string // advertised name -> CUPS queue
+}
+
+// NewAliasProxy creates an alias wrapper around client
+func NewAliasProxy(client CUPSClient, queues map[string]string) *AliasProxy {
+	return &AliasProxy{CUPSClient: client, queues: queues}
+}
+
+// PrintJob forwards the job to the queue behind printerName
+func (a *AliasProxy) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	if queue, ok := a.queues[printerName]; ok {
+		printerName = queue
+	}
+	return a.CUPSClient.PrintJob(ctx, printerName, document, jobName, options)
+}
@@ -0,0 +1,99 @@
+package ipp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// SetArchive keeps a copy of every printed document in archive, so jobs can
+// be printed again with Reprint. It must be called before serving requests.
+func (s *Server) SetArchive(archive *jobs.Archive) {
+	s.archive = archive
+}
+
+// archiveSpool starts archiving a document for printer, or returns nil if
+// archiving is off or failing. A broken archive never stops a job from printing.
+func (s *Server) archiveSpool(printer string) *jobs.Spool {
+	if s.archive == nil {
+		return nil
+	}
+	spool, err := s.archive.Spool(printer)
+	if err != nil {
+		s.log.Warn().Err(err).Msg("failed to archive job")
+		return nil
+	}
+	return spool
+}
+
+// keep stores an accepted job's document in the archive
+func (s *Server) keep(spool *jobs.Spool, job jobs.Job, options map[string]string) {
+	entry, err := spool.Keep(jobs.Archived{
+		JobID:          job.ID,
+		TraceID:        job.TraceID,
+		Printer:        job.Printer,
+		Name:           job.Name,
+		User:           job.User,
+		DocumentFormat: job.DocumentFormat,
+		Options:        options,
+	})
+	if errors.Is(err, jobs.ErrOverQuota) {
+		s.log.Info().Err(err).Int("job_id", job.ID).Str("trace_id", job.TraceID).Msg("job too large to archive")
+		return
+	}
+	if err != nil {
+		s.log.Warn().Err(err).Int("job_id", job.ID).Str("trace_id", job.TraceID).Msg("failed to archive job")
+		return
+	}
+	s.log.Debug().Int("job_id", job.ID).Str("trace_id", job.TraceID).Int("archive_id", entry.ID).Msg("job archived")
+}
+
+// ArchivedJobs lists the jobs that can be printed again, newest first
+func (s *Server) ArchivedJobs() ([]jobs.Archived, error) {
+	if s.archive == nil {
+		return nil, nil
+	}
+	return s.archive.List()
+}
+
+// Reprint prints an archived document again with its original options, on
+// printerName or, if empty, the printer it was first printed on. Reprints
+// aren't archived again.
+func (s *Server) Reprint(ctx context.Context, id int, printerName string) (jobs.Job, error) {
+	if s.archive == nil {
+		return jobs.Job{}, fmt.Errorf("%w: %d", jobs.ErrNotArchived, id)
+	}
+	entry, document, err := s.archive.Open(id)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	defer document.Close()
+
+	if printerName == "" {
+		printerName = entry.Printer
+	}
+	printer, ok := s.lookupPrinter(printerName)
+	if !ok {
+		return jobs.Job{}, fmt.Errorf("%w: %s", ErrUnknownPrinter, printerName)
+	}
+	if message, ok := s.maintenanceMessage(printer.Name); ok {
+		return jobs.Job{}, fmt.Errorf("%w: %s", ErrMaintenance, message)
+	}
+
+	options := make(map[string]string, len(entry.Options))
+	for k, v := range entry.Options {
+		options[k] = v
+	}
+	job, err := s.forward(ctx, printer, document, jobs.Job{
+		Name:           entry.Name,
+		User:           entry.User,
+		DocumentFormat: entry.DocumentFormat,
+	}, options)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	s.log.Info().Int("archive_id", id).Int("job_id", job.ID).Str("trace_id", job.TraceID).Str("printer", job.Printer).Msg("archived job reprinted")
+	return job, nil
+}
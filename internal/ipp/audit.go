@@ -0,0 +1,134 @@
+package ipp
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/audit"
+)
+
+// SetAuditLog records every Print-Job and Cancel-Job in log, whether it
+// succeeded or not. It must be called before serving requests.
+func (s *Server) SetAuditLog(log *audit.Log) {
+	s.audit = log
+}
+
+// audited reports whether an operation is recorded in the audit log
+func (s *Server) audited(operation uint16) bool {
+	return s.audit != nil && (operation == OpPrintJob || operation == OpCancelJob)
+}
+
+// auditKey is the request context key of the request's audit record
+type auditKey struct{}
+
+// auditRecord returns the audit record of the request ctx belongs to, or
+// nil if it isn't audited
+func auditRecord(ctx context.Context) *audit.Record {
+	rec, _ := ctx.Value(auditKey{}).(*audit.Record)
+	return rec
+}
+
+// startAudit begins the audit record of a request, returning the writer to
+// answer it through and the request carrying the record
+func (s *Server) startAudit(w http.ResponseWriter, r *http.Request, req *Request, printer string) (*auditWriter, *http.Request, *audit.Record) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	rec := &audit.Record{
+		Operation: operationName(req.Operation),
+		ClientIP:  ip,
+		UserAgent: r.UserAgent(),
+		Printer:   printer,
+	}
+	return &auditWriter{ResponseWriter: w}, r.WithContext(context.WithValue(r.Context(), auditKey{}, rec)), rec
+}
+
+// finishAudit completes the record with the user, the job and how the client
+// was answered, and writes it
+func (s *Server) finishAudit(w *auditWriter, req *Request, rec *audit.Record) {
+	rec.User = req.OpAttr("requesting-user-name").String()
+	if req.Operation == OpCancelJob {
+		if id, ok := req.JobID(); ok {
+			rec.JobID = id
+			if job, ok := s.jobs.Get(id); ok {
+				rec.Printer = job.Printer
+				rec.TraceID = job.TraceID
+			}
+		}
+	}
+
+	switch {
+	case w.status != 0 && w.status != http.StatusOK:
+		rec.Result = audit.ResultRefused
+		rec.Status = fmt.Sprintf("HTTP %d", w.status)
+	case len(w.head) < 4:
+		rec.Result = audit.ResultFailed
+		rec.Status = "no response"
+	default:
+		status := binary.BigEndian.Uint16(w.head[2:4])
+		rec.Status = fmt.Sprintf("0x%04x", status)
+		switch {
+		case status < 0x0100:
+			rec.Result = audit.ResultOK
+		case status < 0x0500:
+			rec.Result = audit.ResultRefused
+		default:
+			rec.Result = audit.ResultFailed
+		}
+	}
+	s.audit.Record(*rec)
+}
+
+// auditWriter remembers the HTTP status and IPP status a client was answered
+// with
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	head   []byte // Start of the body, holding the IPP status
+}
+
+func (w *auditWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if n := 4 - len(w.head); n > 0 {
+		w.head = append(w.head, p[:min(n, len(p))]...)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush lets quirks send chunked responses through the writer
+func (w *auditWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController the underlying writer
+func (w *auditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
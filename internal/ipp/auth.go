@@ -0,0 +1,95 @@
+package ipp
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// authRealm is the realm sent with Basic-auth challenges
+const authRealm = "AirPrint Bridge"
+
+// SetAuthenticator requires Basic-auth credentials for operations that
+// submit or cancel jobs, checked with fn, which also reports whether they
+// are a guest token. Printer and job queries stay open so clients can
+// discover the printer before prompting for credentials.
+// It must be called before serving requests.
+func (s *Server) SetAuthenticator(fn func(user, password string) (ok, guest bool)) {
+	s.authenticate = fn
+}
+
+// SetAccessCheck limits who may submit jobs to each printer. fn is called
+// with the authenticated user of every Print-Job and Validate-Job; jobs it
+// refuses are answered with client-error-forbidden. It must be called
+// before serving requests.
+func (s *Server) SetAccessCheck(fn func(printer, user string, guest bool) (bool, error)) {
+	s.access = fn
+}
+
+// authRequired reports whether an operation needs credentials
+func (s *Server) authRequired(operation uint16) bool {
+	if s.authenticate == nil {
+		return false
+	}
+	switch operation {
+	case OpPrintJob, OpValidateJob, OpCancelJob:
+		return true
+	}
+	return false
+}
+
+// authorize checks the request's Basic-auth credentials. On success the
+// authenticated user replaces the client's requesting-user-name; otherwise
+// an HTTP 401 challenge is sent, which makes AirPrint clients prompt for a
+// user name and password.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, req *Request) (user string, guest, ok bool) {
+	user, password, hasAuth := r.BasicAuth()
+	if hasAuth {
+		if ok, guest = s.authenticate(user, password); ok {
+			req.OperationAttrs["requesting-user-name"] = &Attribute{
+				Name:   "requesting-user-name",
+				Values: []Value{{Tag: TagNameWithoutLang, Data: []byte(user)}},
+			}
+			return user, guest, true
+		}
+		s.log.Warn().Str("user", user).Str("remote", r.RemoteAddr).Msg("rejected print credentials")
+	}
+	s.challenge(w)
+	return "", false, false
+}
+
+// allowed reports whether the access check lets user submit jobs to
+// printer. A failed check refuses the job, so a directory outage can't
+// open restricted printers.
+func (s *Server) allowed(printer PrinterConfig, user string, guest bool) bool {
+	if s.access == nil {
+		return true
+	}
+	ok, err := s.access(printer.Name, user, guest)
+	if err != nil {
+		s.log.Error().Err(err).Str("printer", printer.Name).Str("user", user).Msg("failed to check printer access")
+		return false
+	}
+	return ok
+}
+
+// forbidden answers a job the access check refused
+func (s *Server) forbidden(w http.ResponseWriter, req *Request, printer PrinterConfig, user string) {
+	denial := Denial{
+		Reason:  DenialPolicy,
+		Status:  StatusClientErrorForbidden,
+		Message: "You are not allowed to print to this printer",
+	}
+	s.log.Warn().Str("printer", printer.Name).Str("user", user).Msg("refused job from user without access")
+	if s.onDenied != nil && req.Operation == OpPrintJob {
+		s.onDenied(printer.Name, user, "", denial)
+	}
+	w.Header().Set("Content-Type", "application/ipp")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(s.buildErrorResponseMessage(req.RequestID, denial.Status, denial.Message))
+}
+
+// challenge asks the client for Basic-auth credentials
+func (s *Server) challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", authRealm))
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
@@ -0,0 +1,313 @@
+package ipp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/phin1x/go-ipp"
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// ErrInvalidBackend is returned for printer URIs no backend can print to
+var ErrInvalidBackend = errors.New("invalid backend")
+
+// backendJobBase is the first job ID BackendProxy hands out, far above the
+// IDs CUPS uses
+const backendJobBase = 1 << 30
+
+// Backend prints straight to a network printer, for printers defined in the
+// config instead of as CUPS queues. Job IDs are the backend's own.
+type Backend interface {
+	PrintJob(ctx context.Context, document io.Reader, jobName string, options map[string]string) (int, error)
+	JobStatus(jobID int) (jobs.Status, error)
+	CancelJob(jobID int) error
+}
+
+// NewBackend returns the backend for a printer URI: socket://host[:port] for
+// printers taking raw print data, 9100 if no port is given, or ipp:// and
+// ipps:// for IPP printers
+func NewBackend(uri string) (Backend, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: printer URI %q", ErrInvalidBackend, uri)
+	}
+	switch u.Scheme {
+	case "socket":
+		port := u.Port()
+		if port == "" {
+			port = "9100"
+		}
+		return &socketBackend{addr: net.JoinHostPort(u.Hostname(), port)}, nil
+	case "ipp", "ipps":
+		endpoint := *u
+		endpoint.Scheme = "http"
+		if u.Scheme == "ipps" {
+			endpoint.Scheme = "https"
+		}
+		if endpoint.Port() == "" {
+			endpoint.Host = net.JoinHostPort(u.Hostname(), "631")
+		}
+		return &ippBackend{
+			uri:      uri,
+			endpoint: endpoint.String(),
+			// As for CUPS, the response timer only starts once the
+			// document is fully sent
+			httpClient: &http.Client{
+				Transport: &http.Transport{
+					Proxy:                 http.ProxyFromEnvironment,
+					DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+					ResponseHeaderTimeout: 60 * time.Second,
+				},
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: printer URI %q is not socket://, ipp:// or ipps://", ErrInvalidBackend, uri)
+}
+
+// socketBackend sends documents as they are to a printer's raw port. The
+// printer says nothing back, so jobs are complete once their data is sent.
+type socketBackend struct {
+	addr string
+}
+
+// PrintJob sends the document to the printer
+func (b *socketBackend) PrintJob(ctx context.Context, document io.Reader, jobName string, options map[string]string) (int, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", b.addr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to printer: %w", err)
+	}
+	defer conn.Close()
+	// Closing the connection stops the upload if the job is abandoned
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := io.Copy(conn, document); err != nil {
+		return 0, fmt.Errorf("failed to send job to printer: %w", err)
+	}
+	return 0, nil
+}
+
+// JobStatus reports jobs as completed, they were fully sent
+func (b *socketBackend) JobStatus(int) (jobs.Status, error) {
+	return jobs.Status{State: jobs.StateCompleted, StateReasons: []string{"job-completed-successfully"}}, nil
+}
+
+// CancelJob does nothing, jobs are already done
+func (b *socketBackend) CancelJob(int) error {
+	return nil
+}
+
+// ippBackend submits jobs to an IPP printer, which does its own queueing
+type ippBackend struct {
+	uri        string // Printer URI sent in requests
+	endpoint   string // HTTP URL requests are posted to
+	httpClient *http.Client
+}
+
+// PrintJob sends Print-Job to the printer, naming the document's format
+func (b *ippBackend) PrintJob(ctx context.Context, document io.Reader, jobName string, options map[string]string) (int, error) {
+	br := bufio.NewReader(document)
+	req := ipp.NewRequest(ipp.OperationPrintJob, 1)
+	req.OperationAttributes["printer-uri"] = b.uri
+	req.OperationAttributes["requesting-user-name"] = "airprint"
+	req.OperationAttributes["job-name"] = jobName
+	req.OperationAttributes["document-format"] = sniffFormat(br)
+	addJobOptions(req, options)
+
+	resp, err := postIPP(ctx, b.httpClient, b.endpoint, "printer", req, br, Credentials{})
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.JobAttributes) > 0 {
+		if v, ok := resp.JobAttributes[0]["job-id"]; ok && len(v) > 0 {
+			if jobID, ok := v[0].Value.(int); ok {
+				return jobID, nil
+			}
+		}
+	}
+	return 0, errors.New("printer returned no job-id")
+}
+
+// JobStatus asks the printer for the job's state
+func (b *ippBackend) JobStatus(jobID int) (jobs.Status, error) {
+	req := ipp.NewRequest(ipp.OperationGetJobAttributes, 1)
+	req.OperationAttributes["printer-uri"] = b.uri
+	req.OperationAttributes["job-id"] = jobID
+	req.OperationAttributes["requesting-user-name"] = "airprint"
+	req.OperationAttributes["requested-attributes"] = []string{
+		"job-state",
+		"job-state-reasons",
+		"job-impressions-completed",
+	}
+
+	resp, err := postIPP(context.Background(), b.httpClient, b.endpoint, "printer", req, nil, Credentials{})
+	if err != nil {
+		return jobs.Status{}, jobGone(err)
+	}
+	if len(resp.JobAttributes) == 0 {
+		return jobs.Status{}, fmt.Errorf("%w: printer returned no attributes for job %d", jobs.ErrJobNotFound, jobID)
+	}
+	attrs := resp.JobAttributes[0]
+
+	var status jobs.Status
+	if v, ok := attrs["job-state"]; ok && len(v) > 0 {
+		status.State, _ = v[0].Value.(int)
+	}
+	for _, v := range attrs["job-state-reasons"] {
+		if reason, ok := v.Value.(string); ok {
+			status.StateReasons = append(status.StateReasons, reason)
+		}
+	}
+	if v, ok := attrs["job-impressions-completed"]; ok && len(v) > 0 {
+		status.ImpressionsCompleted, _ = v[0].Value.(int)
+	}
+	return status, nil
+}
+
+// CancelJob sends Cancel-Job to the printer
+func (b *ippBackend) CancelJob(jobID int) error {
+	req := ipp.NewRequest(ipp.OperationCancelJob, 1)
+	req.OperationAttributes["printer-uri"] = b.uri
+	req.OperationAttributes["job-id"] = jobID
+	req.OperationAttributes["requesting-user-name"] = "airprint"
+
+	_, err := postIPP(context.Background(), b.httpClient, b.endpoint, "printer", req, nil, Credentials{})
+	return err
+}
+
+// documentMagic maps the first bytes of a document to its format
+var documentMagic = []struct {
+	prefix []byte
+	format string
+}{
+	{[]byte("%PDF"), raster.FormatPDF},
+	{[]byte("UNIRAST"), raster.FormatURF},
+	{[]byte("RaS2"), raster.FormatPWG},
+	{[]byte("\xff\xd8\xff"), "image/jpeg"},
+	{[]byte("\x89PNG"), "image/png"},
+}
+
+// sniffFormat returns the format of the document in br, or
+// application/octet-stream for the printer to work out
+func sniffFormat(br *bufio.Reader) string {
+	head, _ := br.Peek(8)
+	for _, m := range documentMagic {
+		if bytes.HasPrefix(head, m.prefix) {
+			return m.format
+		}
+	}
+	return "application/octet-stream"
+}
+
+// BackendProxy wraps a CUPSClient and sends the jobs of printers defined in
+// the config to their backends instead of CUPS. Its jobs get IDs from
+// backendJobBase up, which CUPS never reaches.
+type BackendProxy struct {
+	CUPSClient
+
+	backends map[string]Backend // Printer name -> backend
+	log      zerolog.Logger
+
+	mu     sync.Mutex
+	lastID int
+	jobs   map[int]backendJob
+}
+
+// backendJob is where a job sent to a backend went
+type backendJob struct {
+	backend Backend
+	id      int // The backend's job ID
+}
+
+// NewBackendProxy creates a wrapper around client printing to backends by
+// printer name
+func NewBackendProxy(client CUPSClient, backends map[string]Backend, log zerolog.Logger) *BackendProxy {
+	return &BackendProxy{
+		CUPSClient: client,
+		backends:   backends,
+		log:        log.With().Str("component", "backend").Logger(),
+		lastID:     backendJobBase,
+		jobs:       make(map[int]backendJob),
+	}
+}
+
+// PrintJob sends jobs for backend printers to their backend
+func (b *BackendProxy) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	backend, ok := b.backends[printerName]
+	if !ok {
+		return b.CUPSClient.PrintJob(ctx, printerName, document, jobName, options)
+	}
+
+	id, err := backend.PrintJob(ctx, document, jobName, options)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	b.lastID++
+	jobID := b.lastID
+	b.jobs[jobID] = backendJob{backend: backend, id: id}
+	b.mu.Unlock()
+
+	jobs.TraceLog(ctx, b.log).Info().
+		Str("printer", printerName).
+		Int("job_id", jobID).
+		Int("printer_job_id", id).
+		Msg("job sent to printer")
+	return jobID, nil
+}
+
+// JobStatus asks the backend for the state of its jobs. Jobs sent before a
+// restart can't be followed anymore and are reported as handed to the
+// printer.
+func (b *BackendProxy) JobStatus(jobID int) (jobs.Status, error) {
+	if jobID <= backendJobBase {
+		return b.CUPSClient.JobStatus(jobID)
+	}
+
+	b.mu.Lock()
+	job, ok := b.jobs[jobID]
+	b.mu.Unlock()
+	if !ok {
+		return jobs.Status{State: jobs.StateCompleted, StateReasons: []string{"queued-in-device"}}, nil
+	}
+
+	status, err := job.backend.JobStatus(job.id)
+	if err != nil {
+		return jobs.Status{}, err
+	}
+	if status.State >= jobs.StateCanceled {
+		b.mu.Lock()
+		delete(b.jobs, jobID)
+		b.mu.Unlock()
+	}
+	return status, nil
+}
+
+// CancelJob cancels backend jobs at the printer
+func (b *BackendProxy) CancelJob(jobID int) error {
+	if jobID <= backendJobBase {
+		return b.CUPSClient.CancelJob(jobID)
+	}
+
+	b.mu.Lock()
+	job, ok := b.jobs[jobID]
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return job.backend.CancelJob(job.id)
+}
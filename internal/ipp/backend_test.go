@@ -0,0 +1,290 @@
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	goipp "github.com/phin1x/go-ipp"
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+func TestNewBackend(t *testing.T) {
+	tests := []struct {
+		uri          string
+		wantAddr     string // socket backends
+		wantEndpoint string // IPP backends
+		wantErr      bool
+	}{
+		{"socket://10.0.0.5", "10.0.0.5:9100", "", false},
+		{"socket://10.0.0.5:9101", "10.0.0.5:9101", "", false},
+		{"ipp://10.0.0.5/ipp/print", "", "http://10.0.0.5:631/ipp/print", false},
+		{"ipps://printer.local:443/ipp/print", "", "https://printer.local:443/ipp/print", false},
+		{"lpd://10.0.0.5/queue", "", "", true},
+		{"socket://", "", "", true},
+		{"10.0.0.5", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			backend, err := NewBackend(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewBackend() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidBackend) {
+					t.Errorf("error %v is not ErrInvalidBackend", err)
+				}
+				return
+			}
+			switch b := backend.(type) {
+			case *socketBackend:
+				if b.addr != tt.wantAddr {
+					t.Errorf("socket address = %q, want %q", b.addr, tt.wantAddr)
+				}
+			case *ippBackend:
+				if b.endpoint != tt.wantEndpoint || b.uri != tt.uri {
+					t.Errorf("endpoint = %q uri %q, want %q uri %q", b.endpoint, b.uri, tt.wantEndpoint, tt.uri)
+				}
+			}
+		})
+	}
+}
+
+func TestSocketBackend_PrintJob(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	backend, err := NewBackend("socket://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.PrintJob(context.Background(), strings.NewReader("^XA^FDlabel^FS^XZ"), "job", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != "^XA^FDlabel^FS^XZ" {
+		t.Errorf("printer got %q", got)
+	}
+	if status, err := backend.JobStatus(0); err != nil || status.State != jobs.StateCompleted {
+		t.Errorf("JobStatus() = %+v, %v, want completed", status, err)
+	}
+
+	// Nothing listening
+	ln.Close()
+	if _, err := backend.PrintJob(context.Background(), strings.NewReader("data"), "job", nil); err == nil {
+		t.Error("PrintJob() to a closed port succeeded")
+	}
+}
+
+// fakePrinter is an IPP printer answering each request with respond
+func fakePrinter(t *testing.T, respond func(req *goipp.Request, document []byte) *goipp.Response) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var document bytes.Buffer
+		req, err := goipp.NewRequestDecoder(bytes.NewReader(body)).Decode(&document)
+		if err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		data, _ := respond(req, document.Bytes()).Encode()
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.Replace(srv.URL, "http://", "ipp://", 1) + "/ipp/print"
+}
+
+func TestIPPBackend_PrintJob(t *testing.T) {
+	tests := []struct {
+		name       string
+		document   string
+		wantFormat string
+	}{
+		{"pdf", "%PDF-1.7 ...", "application/pdf"},
+		{"urf", "UNIRAST\x00...", "image/urf"},
+		{"unknown", "^XA^XZ", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *goipp.Request
+			var document []byte
+			uri := fakePrinter(t, func(req *goipp.Request, doc []byte) *goipp.Response {
+				got, document = req, doc
+				resp := goipp.NewResponse(goipp.StatusOk, req.RequestId)
+				resp.JobAttributes = []goipp.Attributes{{"job-id": {{Tag: goipp.TagInteger, Name: "job-id", Value: 42}}}}
+				return resp
+			})
+			backend, err := NewBackend(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id, err := backend.PrintJob(context.Background(), strings.NewReader(tt.document), "report", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != 42 {
+				t.Errorf("job ID = %d, want the printer's 42", id)
+			}
+			if got.Operation != goipp.OperationPrintJob || got.OperationAttributes["printer-uri"] != uri || got.OperationAttributes["job-name"] != "report" {
+				t.Errorf("printer got %+v", got.OperationAttributes)
+			}
+			if format := got.OperationAttributes["document-format"]; format != tt.wantFormat {
+				t.Errorf("document-format = %v, want %s", format, tt.wantFormat)
+			}
+			if string(document) != tt.document {
+				t.Errorf("document = %q, want %q", document, tt.document)
+			}
+		})
+	}
+}
+
+func TestIPPBackend_JobStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int16
+		attributes   goipp.Attributes // Job attributes answered, nil for none
+		wantErr      error            // Error matched, nil for none
+		wantState    int
+		wantReasons  []string
+		wantPrinting int
+	}{
+		{
+			name:   "printing",
+			status: goipp.StatusOk,
+			attributes: goipp.Attributes{
+				"job-state":                 {{Tag: goipp.TagEnum, Name: "job-state", Value: jobs.StateProcessing}},
+				"job-state-reasons":         {{Tag: goipp.TagKeyword, Name: "job-state-reasons", Value: "job-printing"}},
+				"job-impressions-completed": {{Tag: goipp.TagInteger, Name: "job-impressions-completed", Value: 3}},
+			},
+			wantState: jobs.StateProcessing, wantReasons: []string{"job-printing"}, wantPrinting: 3,
+		},
+		{name: "no attributes", status: goipp.StatusOk, wantErr: jobs.ErrJobNotFound},
+		{name: "purged", status: goipp.StatusErrorNotFound, wantErr: jobs.ErrJobNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uri := fakePrinter(t, func(req *goipp.Request, _ []byte) *goipp.Response {
+				if req.Operation != goipp.OperationGetJobAttributes || req.OperationAttributes["job-id"] != 42 {
+					t.Errorf("printer got %#04x %+v", req.Operation, req.OperationAttributes)
+				}
+				resp := goipp.NewResponse(tt.status, req.RequestId)
+				if tt.attributes != nil {
+					resp.JobAttributes = []goipp.Attributes{tt.attributes}
+				}
+				return resp
+			})
+			backend, err := NewBackend(uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := backend.JobStatus(42)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("JobStatus() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.State != tt.wantState || !reflect.DeepEqual(status.StateReasons, tt.wantReasons) || status.ImpressionsCompleted != tt.wantPrinting {
+				t.Errorf("JobStatus() = %+v", status)
+			}
+		})
+	}
+}
+
+// fakeBackend numbers jobs from 1 and answers for them from status
+type fakeBackend struct {
+	status    map[int]jobs.Status
+	printed   int
+	cancelled []int
+}
+
+func (f *fakeBackend) PrintJob(ctx context.Context, document io.Reader, jobName string, options map[string]string) (int, error) {
+	f.printed++
+	return f.printed, nil
+}
+
+func (f *fakeBackend) JobStatus(jobID int) (jobs.Status, error) {
+	return f.status[jobID], nil
+}
+
+func (f *fakeBackend) CancelJob(jobID int) error {
+	f.cancelled = append(f.cancelled, jobID)
+	return nil
+}
+
+func TestBackendProxy(t *testing.T) {
+	cups := &memberCUPS{status: map[int]jobs.Status{1: {State: jobs.StatePending}}}
+	label := &fakeBackend{status: map[int]jobs.Status{
+		1: {State: jobs.StateProcessing},
+		2: {State: jobs.StateCompleted},
+	}}
+	b := NewBackendProxy(cups, map[string]Backend{"Label": label}, zerolog.Nop())
+
+	tests := []struct {
+		name      string
+		printer   string
+		wantState int
+		wantCUPS  bool // The job went to CUPS, with a CUPS job ID
+	}{
+		{"CUPS queue", "Office", jobs.StatePending, true},
+		{"backend printing", "Label", jobs.StateProcessing, false},
+		{"backend done", "Label", jobs.StateCompleted, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := b.PrintJob(context.Background(), tt.printer, strings.NewReader("document"), "job", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if viaCUPS := id <= backendJobBase; viaCUPS != tt.wantCUPS {
+				t.Errorf("job ID %d, want CUPS job %v", id, tt.wantCUPS)
+			}
+			status, err := b.JobStatus(id)
+			if err != nil || status.State != tt.wantState {
+				t.Errorf("JobStatus() = %+v, %v, want state %d", status, err, tt.wantState)
+			}
+			if err := b.CancelJob(id); err != nil {
+				t.Errorf("CancelJob() = %v", err)
+			}
+		})
+	}
+
+	if !reflect.DeepEqual(cups.printed, []string{"Office"}) || !reflect.DeepEqual(cups.cancelled, []int{1}) {
+		t.Errorf("CUPS printed %v cancelled %v, want Office and job 1", cups.printed, cups.cancelled)
+	}
+	// The finished job is forgotten, so only the one still printing is
+	// cancelled at the printer
+	if !reflect.DeepEqual(label.cancelled, []int{1}) {
+		t.Errorf("backend cancelled %v, want [1]", label.cancelled)
+	}
+	// Jobs from before a restart are reported as handed to the printer
+	if status, err := b.JobStatus(backendJobBase + 100); err != nil || status.State != jobs.StateCompleted {
+		t.Errorf("JobStatus() of unknown job = %+v, %v, want completed", status, err)
+	}
+}
@@ -0,0 +1,94 @@
+package ipp
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// StatusServerErrorBusy tells a client to retry later
+const StatusServerErrorBusy = 0x0507
+
+// busyRetryAfter is the Retry-After, in seconds, sent with busy responses
+const busyRetryAfter = 30
+
+// slotRetryAfter is the Retry-After, in seconds, sent when too many jobs
+// are being sent at once. Uploads finish quickly, so clients come back
+// sooner than for a full queue.
+const slotRetryAfter = 5
+
+// JobLimits cap how many Print-Job operations run at once, from the upload
+// until CUPS has the job
+type JobLimits struct {
+	MaxConcurrent int // Across all clients, 0 for no limit
+	MaxPerClient  int // From one client address, 0 for no limit
+}
+
+// jobSlots counts the Print-Job operations in progress
+type jobSlots struct {
+	mu       sync.Mutex
+	total    int
+	byClient map[string]int // Client IP -> jobs it is sending
+}
+
+// SetJobLimits caps concurrent Print-Job operations. Jobs over a cap are
+// refused with server-error-busy.
+func (s *Server) SetJobLimits(limits JobLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobLimits = limits
+}
+
+// acquireJobSlot takes a slot for a job from the client at remoteAddr,
+// returning the function giving it back, or false when a cap is reached
+func (s *Server) acquireJobSlot(remoteAddr string) (func(), bool) {
+	s.mu.RLock()
+	limits := s.jobLimits
+	s.mu.RUnlock()
+
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip = remoteAddr
+	}
+	slots := &s.slots
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+	if limits.MaxConcurrent > 0 && slots.total >= limits.MaxConcurrent {
+		return nil, false
+	}
+	if limits.MaxPerClient > 0 && slots.byClient[ip] >= limits.MaxPerClient {
+		return nil, false
+	}
+	if slots.byClient == nil {
+		slots.byClient = make(map[string]int)
+	}
+	slots.total++
+	slots.byClient[ip]++
+
+	return func() {
+		slots.mu.Lock()
+		defer slots.mu.Unlock()
+		slots.total--
+		if slots.byClient[ip]--; slots.byClient[ip] <= 0 {
+			delete(slots.byClient, ip)
+		}
+	}, true
+}
+
+// queueFull reports whether a printer already has as many jobs waiting or
+// printing as it may
+func (s *Server) queueFull(printer PrinterConfig) bool {
+	return printer.MaxQueued > 0 && s.jobs != nil && s.jobs.Queued(printer.Name) >= printer.MaxQueued
+}
+
+// busy refuses a job with server-error-busy. The HTTP Retry-After header
+// tells clients that honour it when to try again. The document isn't read,
+// so the client doesn't upload a job only to have it refused or sit in the
+// queue for minutes.
+func (s *Server) busy(w http.ResponseWriter, req *Request, retryAfter int, message string) {
+	w.Header().Set("Content-Type", "application/ipp")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(s.buildErrorResponseMessage(req.RequestID, StatusServerErrorBusy, message))
+}
@@ -0,0 +1,115 @@
+package ipp
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	goipp "github.com/phin1x/go-ipp"
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+func TestServer_AcquireJobSlot(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  JobLimits
+		clients []string // Client of each job, all sent at once
+		want    []bool
+	}{
+		{"no limits", JobLimits{}, []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.1:3"}, []bool{true, true, true}},
+		{"global", JobLimits{MaxConcurrent: 2}, []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1"}, []bool{true, true, false}},
+		{"per client", JobLimits{MaxPerClient: 1}, []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.2:1"}, []bool{true, false, true}},
+		{"both", JobLimits{MaxConcurrent: 3, MaxPerClient: 2}, []string{"10.0.0.1:1", "10.0.0.1:2", "10.0.0.1:3", "10.0.0.2:1", "10.0.0.3:1"}, []bool{true, true, false, true, false}},
+		{"address without port", JobLimits{MaxPerClient: 1}, []string{"10.0.0.1", "10.0.0.1"}, []bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+			s.SetJobLimits(tt.limits)
+
+			var releases []func()
+			for i, client := range tt.clients {
+				release, ok := s.acquireJobSlot(client)
+				if ok != tt.want[i] {
+					t.Errorf("job %d from %s: acquired = %v, want %v", i+1, client, ok, tt.want[i])
+				}
+				if ok {
+					releases = append(releases, release)
+				}
+			}
+
+			// Every slot given back frees it for the next job
+			for _, release := range releases {
+				release()
+			}
+			if s.slots.total != 0 || len(s.slots.byClient) != 0 {
+				t.Errorf("after release: %d slots taken, by client %v", s.slots.total, s.slots.byClient)
+			}
+			for _, client := range tt.clients[:1] {
+				if _, ok := s.acquireJobSlot(client); !ok {
+					t.Errorf("slot for %s not given back", client)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_JobSlotReleased(t *testing.T) {
+	tests := []struct {
+		name       string
+		printErr   error
+		wantStatus uint16
+	}{
+		{"accepted", nil, StatusOK},
+		{"refused by CUPS", &StatusError{Status: StatusClientErrorForbidden}, StatusClientErrorForbidden},
+		{"CUPS failing", errors.New("broken pipe"), StatusServerErrorInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &fakeCUPS{printErr: tt.printErr}
+			s := NewServer(":0", cups, jobs.NewTracker(cups, zerolog.Nop()), zerolog.Nop())
+			s.SetPrinters([]PrinterConfig{{Name: "Office"}})
+			s.SetJobLimits(JobLimits{MaxConcurrent: 1, MaxPerClient: 1})
+
+			// A slot held after a job ends would refuse the next one as busy
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				s.handler().ServeHTTP(w, newRequest(t, goipp.OperationPrintJob, "Office", "alice", []byte("%PDF-1.4")))
+				if status, _ := decodeStatus(t, w.Body.Bytes()); status != tt.wantStatus {
+					t.Fatalf("job %d: status = %#04x, want %#04x", i+1, status, tt.wantStatus)
+				}
+			}
+			if s.slots.total != 0 {
+				t.Errorf("%d slots still taken", s.slots.total)
+			}
+		})
+	}
+}
+
+func TestServer_JobSlotBusy(t *testing.T) {
+	cups := &fakeCUPS{}
+	s := NewServer(":0", cups, jobs.NewTracker(cups, zerolog.Nop()), zerolog.Nop())
+	s.SetPrinters([]PrinterConfig{{Name: "Office"}})
+	s.SetJobLimits(JobLimits{MaxPerClient: 1})
+
+	// httptest requests come from 192.0.2.1, which is already sending a job
+	release, ok := s.acquireJobSlot("192.0.2.1:1234")
+	if !ok {
+		t.Fatal("no slot for the first job")
+	}
+	defer release()
+
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, newRequest(t, goipp.OperationPrintJob, "Office", "alice", []byte("%PDF-1.4")))
+	if status, _ := decodeStatus(t, w.Body.Bytes()); status != StatusServerErrorBusy {
+		t.Errorf("status = %#04x, want %#04x", status, StatusServerErrorBusy)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want 5", got)
+	}
+	if len(cups.formats) != 0 {
+		t.Error("refused job was sent to CUPS")
+	}
+}
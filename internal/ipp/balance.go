@@ -0,0 +1,109 @@
+package ipp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// Balancing strategies
+const (
+	BalanceRoundRobin = "round-robin"
+	BalanceLeastBusy  = "least-busy"
+)
+
+// MemberState is the live state of a queue backing a virtual printer
+type MemberState struct {
+	Available  bool
+	QueuedJobs int
+}
+
+// BalancePool is a set of identical queues sharing the load of a virtual printer
+type BalancePool struct {
+	Members  []string
+	Strategy string // BalanceRoundRobin or BalanceLeastBusy
+}
+
+// BalanceProxy wraps a CUPSClient and routes each job for a virtual printer
+// to one healthy member of its pool
+type BalanceProxy struct {
+	CUPSClient
+
+	pools  map[string]BalancePool
+	states func(names []string) (map[string]MemberState, error)
+	log    zerolog.Logger
+
+	mu   sync.Mutex
+	next map[string]int // round-robin position per virtual printer
+}
+
+// NewBalanceProxy creates a load-balancing wrapper around client. states
+// reports the live state of the named queues for health checks.
+func NewBalanceProxy(client CUPSClient, pools map[string]BalancePool, states func([]string) (map[string]MemberState, error), log zerolog.Logger) *BalanceProxy {
+	return &BalanceProxy{
+		CUPSClient: client,
+		pools:      pools,
+		states:     states,
+		log:        log.With().Str("component", "balance").Logger(),
+		next:       make(map[string]int),
+	}
+}
+
+// PrintJob sends a job for a virtual printer to the selected pool member
+func (b *BalanceProxy) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	pool, ok := b.pools[printerName]
+	if !ok {
+		return b.CUPSClient.PrintJob(ctx, printerName, document, jobName, options)
+	}
+	if len(pool.Members) == 0 {
+		return 0, fmt.Errorf("virtual printer %s has no members", printerName)
+	}
+
+	member := b.pick(printerName, pool)
+	jobs.TraceLog(ctx, b.log).Info().Str("printer", printerName).Str("member", member).Str("strategy", pool.Strategy).Msg("routing job to pool member")
+	return b.CUPSClient.PrintJob(ctx, member, document, jobName, options)
+}
+
+// pick selects the member for the next job. Offline members are skipped; if
+// every member is offline the job is queued on the next one in turn so CUPS
+// prints it once the queue recovers.
+func (b *BalanceProxy) pick(printerName string, pool BalancePool) string {
+	b.mu.Lock()
+	start := b.next[printerName] % len(pool.Members)
+	b.next[printerName] = start + 1
+	b.mu.Unlock()
+
+	states, err := b.states(pool.Members)
+	if err != nil {
+		b.log.Warn().Err(err).Str("printer", printerName).Msg("health check failed, using round-robin order")
+		return pool.Members[start]
+	}
+
+	best := ""
+	bestQueued := 0
+	for i := range pool.Members {
+		member := pool.Members[(start+i)%len(pool.Members)]
+		state, ok := states[member]
+		if !ok || !state.Available {
+			continue
+		}
+		if pool.Strategy != BalanceLeastBusy {
+			return member
+		}
+		if best == "" || state.QueuedJobs < bestQueued {
+			best = member
+			bestQueued = state.QueuedJobs
+		}
+	}
+
+	if best == "" {
+		b.log.Warn().Str("printer", printerName).Msg("no pool member available, queueing on next member")
+		return pool.Members[start]
+	}
+	return best
+}
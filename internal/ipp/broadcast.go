@@ -0,0 +1,203 @@
+package ipp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// broadcastJobBase is the first job ID BroadcastProxy hands out, between
+// the IDs CUPS uses and those of BackendProxy
+const broadcastJobBase = 1 << 29
+
+// BroadcastProxy wraps a CUPSClient and fans jobs submitted to a virtual
+// printer out to every member queue of its group. Each group job gets an ID
+// from broadcastJobBase up, standing for the copies on all members.
+type BroadcastProxy struct {
+	CUPSClient
+
+	groups map[string][]string // virtual printer name -> member queues
+	log    zerolog.Logger
+
+	mu     sync.Mutex
+	lastID int
+	jobs   map[int][]memberJob // Group job ID -> its copies
+}
+
+// memberJob is the copy of a group job sent to one member
+type memberJob struct {
+	member string
+	id     int
+}
+
+// NewBroadcastProxy creates a fan-out wrapper around client
+func NewBroadcastProxy(client CUPSClient, groups map[string][]string, log zerolog.Logger) *BroadcastProxy {
+	return &BroadcastProxy{
+		CUPSClient: client,
+		groups:     groups,
+		log:        log.With().Str("component", "broadcast").Logger(),
+		lastID:     broadcastJobBase,
+		jobs:       make(map[int][]memberJob),
+	}
+}
+
+// PrintJob sends the job to every member of a broadcast group. It succeeds if
+// at least one member accepted the job and returns the group job's ID.
+func (b *BroadcastProxy) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	members, ok := b.groups[printerName]
+	if !ok {
+		return b.CUPSClient.PrintJob(ctx, printerName, document, jobName, options)
+	}
+
+	// Every member needs its own copy of the document, so spool it to disk
+	// rather than holding it in memory
+	spool, err := createSpool("broadcast")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	if _, err := io.Copy(spool, document); err != nil {
+		return 0, fmt.Errorf("failed to spool document: %w", err)
+	}
+
+	log := jobs.TraceLog(ctx, b.log)
+	var copies []memberJob
+	var lastErr error
+	for _, member := range members {
+		// Don't start more copies once the submission has been abandoned
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return 0, fmt.Errorf("failed to rewind spool file: %w", err)
+		}
+
+		jobID, err := b.CUPSClient.PrintJob(ctx, member, spool, jobName, options)
+		if err != nil {
+			log.Error().Err(err).Str("group", printerName).Str("member", member).Msg("failed to forward job to group member")
+			lastErr = err
+			continue
+		}
+
+		log.Info().Str("group", printerName).Str("member", member).Int("job_id", jobID).Msg("job forwarded to group member")
+		copies = append(copies, memberJob{member: member, id: jobID})
+	}
+
+	if len(copies) == 0 {
+		return 0, fmt.Errorf("no member of group %s accepted the job: %w", printerName, lastErr)
+	}
+
+	b.mu.Lock()
+	b.lastID++
+	groupJobID := b.lastID
+	b.jobs[groupJobID] = copies
+	b.mu.Unlock()
+	return groupJobID, nil
+}
+
+// copies returns the member jobs of a group job. ok is false for jobs that
+// aren't group jobs, which are passed on unchanged.
+func (b *BroadcastProxy) copies(jobID int) (copies []memberJob, ok bool, err error) {
+	if jobID <= broadcastJobBase || jobID > backendJobBase {
+		return nil, false, nil
+	}
+	b.mu.Lock()
+	copies, ok = b.jobs[jobID]
+	b.mu.Unlock()
+	if !ok {
+		// Sent before a restart, so its copies can't be followed anymore
+		return nil, true, fmt.Errorf("%w: group job %d", jobs.ErrJobNotFound, jobID)
+	}
+	return copies, true, nil
+}
+
+// JobStatus combines the states of a group job's copies. The job is active
+// while any copy is, in the furthest state an active copy reached; once all
+// are done it takes the least successful outcome, so a copy that was
+// cancelled or aborted shows.
+func (b *BroadcastProxy) JobStatus(jobID int) (jobs.Status, error) {
+	copies, ok, err := b.copies(jobID)
+	if !ok {
+		return b.CUPSClient.JobStatus(jobID)
+	}
+	if err != nil {
+		return jobs.Status{}, err
+	}
+
+	statuses := make([]jobs.Status, 0, len(copies))
+	for _, c := range copies {
+		status, err := b.CUPSClient.JobStatus(c.id)
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			status = jobs.Status{State: jobs.StateCompleted}
+		} else if err != nil {
+			return jobs.Status{}, fmt.Errorf("member %s: %w", c.member, err)
+		}
+		statuses = append(statuses, status)
+	}
+
+	var combined jobs.Status
+	done := true
+	for _, s := range statuses {
+		done = done && s.State >= jobs.StateCanceled
+		combined.ImpressionsCompleted += s.ImpressionsCompleted
+	}
+	for _, s := range statuses {
+		active := s.State < jobs.StateCanceled
+		switch {
+		case done && (combined.State == 0 || s.State < combined.State):
+			combined.State = s.State
+		case !done && active && s.State > combined.State:
+			combined.State = s.State
+		}
+	}
+	for _, s := range statuses {
+		if s.State != combined.State {
+			continue
+		}
+		for _, reason := range s.StateReasons {
+			if !contains(combined.StateReasons, reason) {
+				combined.StateReasons = append(combined.StateReasons, reason)
+			}
+		}
+	}
+
+	if done {
+		b.mu.Lock()
+		delete(b.jobs, jobID)
+		b.mu.Unlock()
+	}
+	return combined, nil
+}
+
+// CancelJob cancels every copy of a group job. It succeeds if any copy was
+// cancelled; copies that had already finished can't be.
+func (b *BroadcastProxy) CancelJob(jobID int) error {
+	copies, ok, err := b.copies(jobID)
+	if !ok {
+		return b.CUPSClient.CancelJob(jobID)
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, c := range copies {
+		if err := b.CUPSClient.CancelJob(c.id); err != nil {
+			b.log.Warn().Err(err).Str("member", c.member).Int("job_id", c.id).Msg("failed to cancel copy of group job")
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(copies) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package ipp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// memberCUPS numbers jobs from 1 in the order they arrive and answers for
+// them from its maps
+type memberCUPS struct {
+	refuse    map[string]bool // Queues refusing jobs
+	status    map[int]jobs.Status
+	statusErr map[int]error
+	cancelErr map[int]error
+
+	printed   []string // Queue of each job, in order
+	documents []string
+	cancelled []int
+}
+
+func (m *memberCUPS) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	if m.refuse[printerName] {
+		return 0, &StatusError{Status: StatusClientErrorNotPossible}
+	}
+	data, err := io.ReadAll(document)
+	if err != nil {
+		return 0, err
+	}
+	m.printed = append(m.printed, printerName)
+	m.documents = append(m.documents, string(data))
+	return len(m.printed), nil
+}
+
+func (m *memberCUPS) JobStatus(jobID int) (jobs.Status, error) {
+	if err := m.statusErr[jobID]; err != nil {
+		return jobs.Status{}, err
+	}
+	return m.status[jobID], nil
+}
+
+func (m *memberCUPS) CancelJob(jobID int) error {
+	if err := m.cancelErr[jobID]; err != nil {
+		return err
+	}
+	m.cancelled = append(m.cancelled, jobID)
+	return nil
+}
+
+// newGroup returns a proxy broadcasting Group to A, B and C
+func newGroup(cups *memberCUPS) *BroadcastProxy {
+	return NewBroadcastProxy(cups, map[string][]string{"Group": {"A", "B", "C"}}, zerolog.Nop())
+}
+
+func TestBroadcastProxy_PrintJob(t *testing.T) {
+	tests := []struct {
+		name        string
+		printer     string
+		refuse      []string
+		wantErr     bool
+		wantGroup   bool // A group job ID is returned
+		wantPrinted []string
+	}{
+		{"all members", "Group", nil, false, true, []string{"A", "B", "C"}},
+		{"one refuses", "Group", []string{"B"}, false, true, []string{"A", "C"}},
+		{"all refuse", "Group", []string{"A", "B", "C"}, true, false, nil},
+		{"not a group", "A", nil, false, false, []string{"A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &memberCUPS{refuse: make(map[string]bool)}
+			for _, q := range tt.refuse {
+				cups.refuse[q] = true
+			}
+			b := newGroup(cups)
+
+			id, err := b.PrintJob(context.Background(), tt.printer, strings.NewReader("document"), "job", nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PrintJob() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(cups.printed, tt.wantPrinted) {
+				t.Errorf("printed on %v, want %v", cups.printed, tt.wantPrinted)
+			}
+			for _, doc := range cups.documents {
+				if doc != "document" {
+					t.Errorf("member got document %q", doc)
+				}
+			}
+			if err != nil {
+				return
+			}
+			if isGroup := id > broadcastJobBase; isGroup != tt.wantGroup {
+				t.Errorf("job ID %d, want group ID %v", id, tt.wantGroup)
+			}
+		})
+	}
+}
+
+func TestBroadcastProxy_JobStatus(t *testing.T) {
+	processing := jobs.Status{State: jobs.StateProcessing, StateReasons: []string{"job-printing"}, ImpressionsCompleted: 1}
+	pending := jobs.Status{State: jobs.StatePending}
+	completed := jobs.Status{State: jobs.StateCompleted, StateReasons: []string{"job-completed-successfully"}, ImpressionsCompleted: 2}
+	canceled := jobs.Status{State: jobs.StateCanceled, StateReasons: []string{"job-canceled-by-user"}}
+
+	tests := []struct {
+		name        string
+		status      map[int]jobs.Status // By member job ID: A is 1, B 2 and C 3
+		statusErr   map[int]error
+		wantErr     bool
+		wantState   int
+		wantReasons []string
+		wantImps    int
+	}{
+		{"all printing", map[int]jobs.Status{1: processing, 2: processing, 3: processing}, nil, false, jobs.StateProcessing, []string{"job-printing"}, 3},
+		{"some waiting", map[int]jobs.Status{1: pending, 2: processing, 3: completed}, nil, false, jobs.StateProcessing, []string{"job-printing"}, 3},
+		{"all completed", map[int]jobs.Status{1: completed, 2: completed, 3: completed}, nil, false, jobs.StateCompleted, []string{"job-completed-successfully"}, 6},
+		{"one canceled", map[int]jobs.Status{1: completed, 2: canceled, 3: completed}, nil, false, jobs.StateCanceled, []string{"job-canceled-by-user"}, 4},
+		{"one purged", map[int]jobs.Status{1: completed, 3: completed}, map[int]error{2: jobs.ErrJobNotFound}, false, jobs.StateCompleted, []string{"job-completed-successfully"}, 4},
+		{"member unreachable", map[int]jobs.Status{1: completed, 3: completed}, map[int]error{2: errors.New("connection refused")}, true, 0, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &memberCUPS{status: tt.status, statusErr: tt.statusErr}
+			b := newGroup(cups)
+			id, err := b.PrintJob(context.Background(), "Group", strings.NewReader("document"), "job", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status, err := b.JobStatus(id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("JobStatus() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if status.State != tt.wantState || !reflect.DeepEqual(status.StateReasons, tt.wantReasons) || status.ImpressionsCompleted != tt.wantImps {
+				t.Errorf("JobStatus() = %+v, want state %d reasons %v impressions %d", status, tt.wantState, tt.wantReasons, tt.wantImps)
+			}
+
+			// Finished group jobs are forgotten
+			_, err = b.JobStatus(id)
+			if gone := errors.Is(err, jobs.ErrJobNotFound); gone != (status.State >= jobs.StateCanceled) {
+				t.Errorf("second JobStatus() error = %v, after state %d", err, status.State)
+			}
+		})
+	}
+}
+
+func TestBroadcastProxy_CancelJob(t *testing.T) {
+	finished := &StatusError{Status: StatusClientErrorNotPossible}
+	tests := []struct {
+		name          string
+		cancelErr     map[int]error
+		wantCancelled []int
+		wantStatus    uint16 // Status of the error returned, 0 for none
+	}{
+		{"all copies", nil, []int{1, 2, 3}, 0},
+		{"one finished", map[int]error{2: finished}, []int{1, 3}, 0},
+		{"all finished", map[int]error{1: finished, 2: finished, 3: finished}, nil, StatusClientErrorNotPossible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &memberCUPS{cancelErr: tt.cancelErr}
+			b := newGroup(cups)
+			id, err := b.PrintJob(context.Background(), "Group", strings.NewReader("document"), "job", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.CancelJob(id)
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) {
+				if statusErr.Status != tt.wantStatus {
+					t.Errorf("CancelJob() status = %#04x, want %#04x", statusErr.Status, tt.wantStatus)
+				}
+			} else if err != nil || tt.wantStatus != 0 {
+				t.Errorf("CancelJob() error = %v, want status %#04x", err, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(cups.cancelled, tt.wantCancelled) {
+				t.Errorf("cancelled %v, want %v", cups.cancelled, tt.wantCancelled)
+			}
+		})
+	}
+
+	// Jobs outside the group ID range go to the wrapped client
+	cups := &memberCUPS{}
+	if err := newGroup(cups).CancelJob(7); err != nil || !reflect.DeepEqual(cups.cancelled, []int{7}) {
+		t.Errorf("CancelJob(7) = %v, cancelled %v, want passed through", err, cups.cancelled)
+	}
+	// Group jobs from before a restart are unknown
+	if err := newGroup(cups).CancelJob(broadcastJobBase + 1); !errors.Is(err, jobs.ErrJobNotFound) {
+		t.Errorf("CancelJob() of unknown group job = %v, want ErrJobNotFound", err)
+	}
+}
@@ -0,0 +1,376 @@
+package ipp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StatusClientErrorTimeout tells a client it took too long to send a request
+const StatusClientErrorTimeout = 0x0405
+
+// StatusClientErrorRequestEntityTooLarge tells a client its request, usually
+// the document, is larger than the server accepts
+const StatusClientErrorRequestEntityTooLarge = 0x0408
+
+// ClientLimits protect the server from misbehaving clients
+type ClientLimits struct {
+	StallTimeout  time.Duration // Abort an upload after this long without data, 0 for no limit
+	MinUploadRate int           // Bytes per second an upload must average after the first StallTimeout, 0 for no limit
+	MaxConnsPerIP int           // Concurrent connections allowed from one address, 0 for no limit
+
+	ReadTimeout    time.Duration // Limit on reading a request's headers and the start of its body, 0 for none
+	WriteTimeout   time.Duration // Limit on answering after a request's last data arrives, 0 for none
+	MaxHeaderBytes int           // Largest request headers accepted, 0 for net/http's default
+	MaxRequestSize int64         // Largest request body, attributes and document together, 0 for no limit
+}
+
+// errUploadStalled, errUploadTooSlow and errRequestTooLarge are recorded
+// when a client is cut off
+var (
+	errUploadStalled   = errors.New("upload stalled")
+	errUploadTooSlow   = errors.New("upload too slow")
+	errRequestTooLarge = errors.New("request too large")
+)
+
+// SetClientLimits configures stall detection and connection caps. It must be
+// called before the listeners are started.
+func (s *Server) SetClientLimits(limits ClientLimits) {
+	s.limits = limits
+}
+
+// httpServer returns a server for handler with the client limits applied.
+// The write timeout is pushed back as a document arrives, see upload, so
+// long uploads aren't cut off.
+func (s *Server) httpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:        s.restrict(handler),
+		ConnState:      s.trackConn,
+		ConnContext:    withConn,
+		ReadTimeout:    s.limits.ReadTimeout,
+		WriteTimeout:   s.limits.WriteTimeout,
+		MaxHeaderBytes: s.limits.MaxHeaderBytes,
+	}
+}
+
+// upload wraps a request body, enforcing the stall timeout, minimum rate
+// and size limit and measuring how fast the client sends
+type upload struct {
+	body   io.Reader
+	rc     *http.ResponseController
+	limits ClientLimits
+
+	start time.Time
+	bytes int64
+	err   error // Why the upload was cut off, if it was
+}
+
+// newUpload starts measuring the body of r
+func (s *Server) newUpload(w http.ResponseWriter, r *http.Request) *upload {
+	body := r.Body
+	if s.limits.MaxRequestSize > 0 {
+		body = http.MaxBytesReader(w, body, s.limits.MaxRequestSize)
+	}
+	return &upload{
+		body:   body,
+		rc:     http.NewResponseController(w),
+		limits: s.limits,
+		start:  time.Now(),
+	}
+}
+
+func (u *upload) Read(p []byte) (int, error) {
+	if u.err != nil {
+		return 0, u.err
+	}
+	if u.limits.StallTimeout > 0 {
+		// Not every ResponseWriter supports deadlines; those uploads just
+		// aren't limited
+		_ = u.rc.SetReadDeadline(time.Now().Add(u.limits.StallTimeout))
+	} else if u.limits.ReadTimeout > 0 {
+		// The read timeout covers the headers; documents take as long as
+		// they take
+		_ = u.rc.SetReadDeadline(time.Time{})
+	}
+	if u.limits.WriteTimeout > 0 {
+		_ = u.rc.SetWriteDeadline(time.Now().Add(u.limits.WriteTimeout))
+	}
+
+	n, err := u.body.Read(p)
+	u.bytes += int64(n)
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		u.err = fmt.Errorf("%w: over %d bytes", errRequestTooLarge, tooLarge.Limit)
+		return n, u.err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		u.err = fmt.Errorf("%w: no data for %s", errUploadStalled, u.limits.StallTimeout)
+		return n, u.err
+	}
+	if elapsed := time.Since(u.start); u.limits.MinUploadRate > 0 && elapsed > u.limits.StallTimeout && elapsed > time.Second {
+		if rate := u.rate(); rate < float64(u.limits.MinUploadRate) {
+			u.err = fmt.Errorf("%w: %.0f bytes/s", errUploadTooSlow, rate)
+			return n, u.err
+		}
+	}
+	return n, err
+}
+
+// rate returns the average upload rate in bytes per second
+func (u *upload) rate() float64 {
+	elapsed := time.Since(u.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(u.bytes) / elapsed
+}
+
+// done clears the read deadline once the body has been consumed, and gives
+// the response the full write timeout
+func (u *upload) done() {
+	if u.limits.StallTimeout > 0 {
+		_ = u.rc.SetReadDeadline(time.Time{})
+	}
+	if u.limits.WriteTimeout > 0 {
+		_ = u.rc.SetWriteDeadline(time.Now().Add(u.limits.WriteTimeout))
+	}
+}
+
+// tooLarge reports whether the request was cut off for its size
+func (u *upload) tooLarge() bool {
+	return errors.Is(u.err, errRequestTooLarge)
+}
+
+// listen opens a TCP listener that enforces the per-address connection cap
+func (s *Server) listen(addr string) (net.Listener, error) {
+	listen := s.listenFunc
+	if listen == nil {
+		listen = func(addr string) (net.Listener, error) { return net.Listen("tcp", addr) }
+	}
+	ln, err := listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.limits.MaxConnsPerIP <= 0 {
+		return ln, nil
+	}
+	return &limitListener{Listener: ln, server: s, max: s.limits.MaxConnsPerIP, conns: make(map[string]int)}, nil
+}
+
+// limitListener refuses connections from addresses that already have the
+// maximum number open
+type limitListener struct {
+	net.Listener
+	server *Server
+	max    int
+
+	mu    sync.Mutex
+	conns map[string]int // remote IP -> open connections
+}
+
+// busyResponse is written to refused connections so clients back off
+// instead of seeing a reset
+const busyResponse = "HTTP/1.1 503 Service Unavailable\r\nRetry-After: 5\r\nConnection: close\r\nContent-Length: 0\r\n\r\n"
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		ip := remoteIP(conn.RemoteAddr())
+		l.mu.Lock()
+		open := l.conns[ip]
+		if open < l.max {
+			l.conns[ip] = open + 1
+		}
+		l.mu.Unlock()
+
+		if open < l.max {
+			return &limitConn{Conn: conn, release: func() { l.release(ip) }}, nil
+		}
+
+		l.server.log.Warn().Str("remote", ip).Int("limit", l.max).Msg("refusing connection, too many from this address")
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_, _ = conn.Write([]byte(busyResponse))
+		conn.Close()
+	}
+}
+
+func (l *limitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// limitConn gives its slot back when closed
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// connTracker follows client connections, for capacity planning and for
+// finding clients that hammer the server or hold connections open
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]*connInfo
+}
+
+// connInfo is what is known about one open connection
+type connInfo struct {
+	remote        string
+	opened        time.Time
+	state         http.ConnState
+	requests      int
+	lastRequest   time.Time
+	lastOperation string
+	operations    map[string]int // IPP operation name -> requests
+}
+
+// connKey is the request context key of the connection a request came in on
+type connKey struct{}
+
+// withConn is an http.Server ConnContext hook, so requests can be counted
+// against their connection
+func withConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// trackConn is an http.Server ConnState hook. Closed connections are logged
+// at debug level with how long they were open and what they were used for.
+func (s *Server) trackConn(conn net.Conn, state http.ConnState) {
+	t := &s.conns
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		if info, ok := t.conns[conn]; ok {
+			s.log.Debug().
+				Str("remote", info.remote).
+				Dur("open_for", time.Since(info.opened)).
+				Int("requests", info.requests).
+				Interface("operations", info.operations).
+				Msg("connection closed")
+		}
+		delete(t.conns, conn)
+	default:
+		if t.conns == nil {
+			t.conns = make(map[net.Conn]*connInfo)
+		}
+		info, ok := t.conns[conn]
+		if !ok {
+			info = &connInfo{remote: conn.RemoteAddr().String(), opened: time.Now()}
+			t.conns[conn] = info
+		}
+		info.state = state
+	}
+}
+
+// countRequest records a request against the connection it came in on
+func (s *Server) countRequest(ctx context.Context) {
+	s.conns.update(ctx, func(info *connInfo) {
+		info.requests++
+		info.lastRequest = time.Now()
+		info.lastOperation = ""
+	})
+}
+
+// countOperation records the IPP operation of a request counted with
+// countRequest
+func (s *Server) countOperation(ctx context.Context, operation string) {
+	s.conns.update(ctx, func(info *connInfo) {
+		info.lastOperation = operation
+		if info.operations == nil {
+			info.operations = make(map[string]int)
+		}
+		info.operations[operation]++
+	})
+}
+
+// update calls fn with the connection a request came in on, if known
+func (t *connTracker) update(ctx context.Context, fn func(info *connInfo)) {
+	conn, ok := ctx.Value(connKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if info, ok := t.conns[conn]; ok {
+		fn(info)
+	}
+}
+
+// Connections returns the number of open client connections on the IPP and
+// IPPS listeners, and how many of them are idle keep-alive connections
+func (s *Server) Connections() (open, idle int) {
+	s.conns.mu.Lock()
+	defer s.conns.mu.Unlock()
+	for _, info := range s.conns.conns {
+		if info.state == http.StateIdle {
+			idle++
+		}
+	}
+	return len(s.conns.conns), idle
+}
+
+// ConnectionInfo describes an open client connection
+type ConnectionInfo struct {
+	Remote        string         // Client address and port
+	Opened        time.Time      // When the client connected
+	State         string         // "new", "active" or "idle"
+	Requests      int            // HTTP requests made on it
+	LastRequest   time.Time      // Zero before the first request
+	LastOperation string         // IPP operation of the last request, empty for other requests
+	Operations    map[string]int // IPP operation name -> requests
+}
+
+// ConnectionList returns the open client connections, oldest first
+func (s *Server) ConnectionList() []ConnectionInfo {
+	s.conns.mu.Lock()
+	list := make([]ConnectionInfo, 0, len(s.conns.conns))
+	for _, info := range s.conns.conns {
+		ops := make(map[string]int, len(info.operations))
+		for op, n := range info.operations {
+			ops[op] = n
+		}
+		list = append(list, ConnectionInfo{
+			Remote:        info.remote,
+			Opened:        info.opened,
+			State:         info.state.String(),
+			Requests:      info.requests,
+			LastRequest:   info.lastRequest,
+			LastOperation: info.lastOperation,
+			Operations:    ops,
+		})
+	}
+	s.conns.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Opened.Before(list[j].Opened) })
+	return list
+}
+
+// remoteIP returns the IP of an address without its port
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,96 @@
+package ipp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Credentials authenticate requests the bridge sends to CUPS
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// credentialsKey is the context key for credentials relayed from a client
+type credentialsKey struct{}
+
+// withCredentials returns a context carrying client credentials to pass on
+// to CUPS
+func withCredentials(ctx context.Context, creds Credentials) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, creds)
+}
+
+// SetCredentials configures the credentials sent to CUPS: creds for a
+// printer if it has any, otherwise global. An empty user sends none. It
+// must be called before jobs are submitted.
+//
+// Jobs are followed and cancelled with the global credentials, since the
+// tracker polls them long after the client that sent them, and its
+// password, are gone. With relayed or per-printer credentials, the global
+// account must be one CUPS lets read and cancel other users' jobs, such as
+// a member of its SystemGroup.
+func (c *CUPSProxy) SetCredentials(global Credentials, printers map[string]Credentials) {
+	c.global = global
+	c.printers = printers
+}
+
+// credentials returns what to authenticate a request for printer with:
+// credentials relayed from the client, then the printer's, then the global
+// ones
+func (c *CUPSProxy) credentials(ctx context.Context, printer string) Credentials {
+	if creds, ok := ctx.Value(credentialsKey{}).(Credentials); ok {
+		return creds
+	}
+	if creds, ok := c.printers[printer]; ok {
+		return creds
+	}
+	return c.global
+}
+
+// jobUser returns the requesting-user-name of job operations: the global
+// user, which CUPS checks it against, or the bridge's own name without one
+func (c *CUPSProxy) jobUser() string {
+	if c.global.User != "" {
+		return c.global.User
+	}
+	return "airprint"
+}
+
+// relayCredentials requires Basic-auth credentials for a printer whose CUPS
+// queue authenticates users itself. The credentials aren't checked here;
+// they are passed on to CUPS with the job. Without any, the client is
+// challenged so it prompts the user.
+func (s *Server) relayCredentials(w http.ResponseWriter, r *http.Request, req *Request) (context.Context, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok || user == "" {
+		s.challenge(w)
+		return nil, false
+	}
+
+	req.OperationAttrs["requesting-user-name"] = &Attribute{
+		Name:   "requesting-user-name",
+		Values: []Value{{Tag: TagNameWithoutLang, Data: []byte(user)}},
+	}
+	return withCredentials(r.Context(), Credentials{User: user, Password: password}), true
+}
+
+// notAuthenticated reports whether CUPS rejected the credentials of a request
+func notAuthenticated(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Status == StatusClientErrorNotAuthenticated
+}
+
+// cancelRefused reports whether CUPS refused a job operation to the account
+// the bridge uses, rather than the request itself
+func cancelRefused(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.Status {
+	case StatusClientErrorForbidden, StatusClientErrorNotAuthorized, StatusClientErrorNotAuthenticated:
+		return true
+	}
+	return false
+}
@@ -2,19 +2,50 @@ package ipp
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/phin1x/go-ipp"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
 )
 
+// StatusError is returned when CUPS answers a request with an error status
+type StatusError struct {
+	Status  uint16
+	Message string // status-message from CUPS, if any
+}
+
+// ErrUnsupportedOperation matches errors for operations the server asked
+// doesn't support
+var ErrUnsupportedOperation = errors.New("operation not supported")
+
+// Is lets errors.Is match a status with a sentinel error for it
+func (e *StatusError) Is(target error) bool {
+	return target == ErrUnsupportedOperation && e.Status == StatusServerErrorOperationNotSupported
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("CUPS returned error status: 0x%04x (%s)", e.Status, e.Message)
+	}
+	return fmt.Sprintf("CUPS returned error status: 0x%04x", e.Status)
+}
+
 // CUPSProxy forwards print jobs to a CUPS server
 type CUPSProxy struct {
 	host       string
 	port       int
 	httpClient *http.Client
+	global     Credentials            // Sent when a printer has none of its own
+	printers   map[string]Credentials // Printer name -> credentials
 }
 
 // NewCUPSProxy creates a new CUPS proxy client
@@ -22,99 +53,241 @@ func NewCUPSProxy(host string, port int) *CUPSProxy {
 	return &CUPSProxy{
 		host: host,
 		port: port,
+		// No overall timeout: a streamed document arrives as fast as the
+		// client sends it. The response timer starts once it is fully sent.
 		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+				ResponseHeaderTimeout: 60 * time.Second,
+			},
 		},
 	}
 }
 
-// PrintJob sends a print job to CUPS
-func (c *CUPSProxy) PrintJob(printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
-	// Read document into buffer
-	docData, err := io.ReadAll(document)
-	if err != nil {
-		return 0, fmt.Errorf("failed to read document: %w", err)
+// jobTemplateOptions are the job options sent as job template attributes
+var jobTemplateOptions = map[string]bool{
+	"media":                 true,
+	"print-scaling":         true,
+	"orientation-requested": true,
+	"print-quality":         true,
+	"job-hold-until":        true,
+}
+
+func init() {
+	// go-ipp only knows the attribute by the misspelt name "hold-job-until"
+	ipp.AttributeTagMapping["job-hold-until"] = ipp.TagKeyword
+}
+
+// typedOption converts an option to the Go type go-ipp encodes with the
+// attribute's tag, e.g. an int for enums
+func typedOption(name, value string) interface{} {
+	switch ipp.AttributeTagMapping[name] {
+	case ipp.TagEnum, ipp.TagInteger:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// addJobOptions adds a job's options to a Print-Job request. Job template
+// options go in the job group with the value type the printer expects.
+func addJobOptions(req *ipp.Request, options map[string]string) {
+	for k, v := range options {
+		if k == "media-source" {
+			// The tray is picked from media-col
+			req.JobAttributes["media-col"] = ipp.Collection{
+				"media-source": {{Tag: ipp.TagKeyword, Name: "media-source", Value: v}},
+			}
+			continue
+		}
+		if jobTemplateOptions[k] {
+			req.JobAttributes[k] = typedOption(k, v)
+		} else {
+			req.OperationAttributes[k] = v
+		}
 	}
+}
 
+// PrintJob sends a print job to CUPS. Cancelling ctx aborts the upload and
+// the pending response.
+func (c *CUPSProxy) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
 	// Build IPP Print-Job request
 	req := ipp.NewRequest(ipp.OperationPrintJob, 1)
 
 	printerURI := fmt.Sprintf("ipp://%s:%d/printers/%s", c.host, c.port, printerName)
 	req.OperationAttributes["printer-uri"] = printerURI
+	creds := c.credentials(ctx, printerName)
 	req.OperationAttributes["requesting-user-name"] = "airprint"
+	if creds.User != "" {
+		// CUPS checks the requesting user against the authenticated one
+		req.OperationAttributes["requesting-user-name"] = creds.User
+	}
 	req.OperationAttributes["job-name"] = jobName
 	req.OperationAttributes["document-format"] = "application/octet-stream"
 
-	// Add any additional options
-	for k, v := range options {
-		req.OperationAttributes[k] = v
+	addJobOptions(req, options)
+
+	ippResp, err := c.send(ctx, "/printers/"+printerName, req, document, creds)
+	if err != nil {
+		return 0, err
+	}
+
+	// Extract job ID from response
+	if jobAttrs := ippResp.JobAttributes; len(jobAttrs) > 0 {
+		if jobIDAttr, ok := jobAttrs[0]["job-id"]; ok && len(jobIDAttr) > 0 {
+			if jobID, ok := jobIDAttr[0].Value.(int); ok {
+				return jobID, nil
+			}
+		}
+	}
+
+	// If we can't get the job ID, return a placeholder
+	return 1, nil
+}
+
+// JobStatus retrieves job status from CUPS, as the global user; see
+// SetCredentials
+func (c *CUPSProxy) JobStatus(jobID int) (jobs.Status, error) {
+	req := ipp.NewRequest(ipp.OperationGetJobAttributes, 1)
+	req.OperationAttributes["job-uri"] = fmt.Sprintf("ipp://%s:%d/jobs/%d", c.host, c.port, jobID)
+	req.OperationAttributes["requesting-user-name"] = c.jobUser()
+	req.OperationAttributes["requested-attributes"] = []string{
+		"job-state",
+		"job-state-reasons",
+		"job-impressions-completed",
 	}
 
+	ippResp, err := c.send(context.Background(), "/jobs/", req, nil, c.global)
+	if err != nil {
+		return jobs.Status{}, jobGone(err)
+	}
+
+	var status jobs.Status
+	if len(ippResp.JobAttributes) == 0 {
+		return status, fmt.Errorf("%w: CUPS returned no attributes for job %d", jobs.ErrJobNotFound, jobID)
+	}
+	attrs := ippResp.JobAttributes[0]
+
+	if v, ok := attrs["job-state"]; ok && len(v) > 0 {
+		status.State, _ = v[0].Value.(int)
+	}
+	for _, v := range attrs["job-state-reasons"] {
+		if reason, ok := v.Value.(string); ok {
+			status.StateReasons = append(status.StateReasons, reason)
+		}
+	}
+	if v, ok := attrs["job-impressions-completed"]; ok && len(v) > 0 {
+		status.ImpressionsCompleted, _ = v[0].Value.(int)
+	}
+
+	return status, nil
+}
+
+// CancelJob cancels a job in CUPS, as the global user; see SetCredentials
+func (c *CUPSProxy) CancelJob(jobID int) error {
+	req := ipp.NewRequest(ipp.OperationCancelJob, 1)
+	req.OperationAttributes["job-uri"] = fmt.Sprintf("ipp://%s:%d/jobs/%d", c.host, c.port, jobID)
+	req.OperationAttributes["requesting-user-name"] = c.jobUser()
+
+	_, err := c.send(context.Background(), "/jobs/", req, nil, c.global)
+	return err
+}
+
+// ReleaseJob releases a held job in CUPS so it prints
+func (c *CUPSProxy) ReleaseJob(jobID int) error {
+	req := ipp.NewRequest(ipp.OperationReleaseJob, 1)
+	req.OperationAttributes["job-uri"] = fmt.Sprintf("ipp://%s:%d/jobs/%d", c.host, c.port, jobID)
+	req.OperationAttributes["requesting-user-name"] = c.jobUser()
+
+	_, err := c.send(context.Background(), "/jobs/", req, nil, c.global)
+	return err
+}
+
+// MoveJob moves a pending job in CUPS to another printer
+func (c *CUPSProxy) MoveJob(jobID int, printerName string) error {
+	req := ipp.NewRequest(ipp.OperationCupsMoveJob, 1)
+	req.OperationAttributes["job-uri"] = fmt.Sprintf("ipp://%s:%d/jobs/%d", c.host, c.port, jobID)
+	req.OperationAttributes["requesting-user-name"] = c.jobUser()
+	req.JobAttributes["job-printer-uri"] = fmt.Sprintf("ipp://%s:%d/printers/%s", c.host, c.port, printerName)
+
+	_, err := c.send(context.Background(), "/jobs/", req, nil, c.global)
+	return err
+}
+
+// send posts an IPP request, followed by an optional document, to CUPS,
+// authenticating with creds when they are set
+func (c *CUPSProxy) send(ctx context.Context, path string, req *ipp.Request, document io.Reader, creds Credentials) (*ipp.Response, error) {
+	resp, err := postIPP(ctx, c.httpClient, fmt.Sprintf("http://%s:%d%s", c.host, c.port, path), "CUPS", req, document, creds)
+	return resp, cups.Unreachable(err)
+}
+
+// postIPP posts an IPP request, followed by an optional document, to url.
+// peer names the server in errors.
+func postIPP(ctx context.Context, client *http.Client, url, peer string, req *ipp.Request, document io.Reader, creds Credentials) (*ipp.Response, error) {
 	// Encode the request
 	payload, err := req.Encode()
 	if err != nil {
-		return 0, fmt.Errorf("failed to encode IPP request: %w", err)
+		return nil, fmt.Errorf("failed to encode IPP request: %w", err)
 	}
 
-	// Combine IPP request with document
-	fullPayload := append(payload, docData...)
+	// Stream the document after the attributes instead of buffering it, so
+	// large jobs never have to fit in memory (sent chunked)
+	var body io.Reader = bytes.NewReader(payload)
+	if document != nil {
+		body = io.MultiReader(body, document)
+	}
 
-	// Send to CUPS
-	cupsURL := fmt.Sprintf("http://%s:%d/printers/%s", c.host, c.port, printerName)
-	httpReq, err := http.NewRequest("POST", cupsURL, bytes.NewReader(fullPayload))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/ipp")
+	if creds.User != "" {
+		httpReq.SetBasicAuth(creds.User, creds.Password)
+	}
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := client.Do(httpReq)
 	if err != nil {
-		return 0, fmt.Errorf("failed to send request to CUPS: %w", err)
+		return nil, fmt.Errorf("failed to send request to %s: %w", peer, err)
 	}
 	defer resp.Body.Close()
 
+	// CUPS answers requests it wants credentials for at the HTTP level
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, &StatusError{Status: StatusClientErrorNotAuthenticated, Message: peer + " requires authentication"}
+	}
+
 	// Parse response
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read CUPS response: %w", err)
+		return nil, fmt.Errorf("failed to read %s response: %w", peer, err)
 	}
 
 	ippResp, err := ipp.NewResponseDecoder(bytes.NewReader(respBody)).Decode(nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to decode IPP response: %w", err)
+		return nil, fmt.Errorf("failed to decode IPP response: %w", err)
 	}
 
 	if ippResp.StatusCode != ipp.StatusOk {
-		return 0, fmt.Errorf("CUPS returned error status: %d", ippResp.StatusCode)
-	}
-
-	// Extract job ID from response
-	if jobAttrs := ippResp.JobAttributes; len(jobAttrs) > 0 {
-		if jobIDAttr, ok := jobAttrs[0]["job-id"]; ok && len(jobIDAttr) > 0 {
-			if jobID, ok := jobIDAttr[0].Value.(int); ok {
-				return jobID, nil
-			}
+		statusErr := &StatusError{Status: uint16(ippResp.StatusCode)}
+		if v, ok := ippResp.OperationAttributes["status-message"]; ok && len(v) > 0 {
+			statusErr.Message, _ = v[0].Value.(string)
 		}
+		return nil, statusErr
 	}
 
-	// If we can't get the job ID, return a placeholder
-	return 1, nil
-}
-
-// GetJobAttributes retrieves job status from CUPS
-func (c *CUPSProxy) GetJobAttributes(jobID int) (map[string]interface{}, error) {
-	// For now, return a simple "completed" status
-	// A full implementation would query CUPS
-	return map[string]interface{}{
-		"job-state":         9, // completed
-		"job-state-reasons": "job-completed-successfully",
-	}, nil
+	return ippResp, nil
 }
 
-// CancelJob cancels a job in CUPS
-func (c *CUPSProxy) CancelJob(jobID int) error {
-	// For now, just return success
-	// A full implementation would send Cancel-Job to CUPS
-	return nil
+// jobGone marks a client-error-not-found answer to a job query as
+// jobs.ErrJobNotFound, so the tracker stops following the job
+func jobGone(err error) error {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Status == StatusClientErrorNotFound {
+		return fmt.Errorf("%w: %w", jobs.ErrJobNotFound, err)
+	}
+	return err
 }
@@ -0,0 +1,85 @@
+package ipp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	goipp "github.com/phin1x/go-ipp"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+func TestJobGone(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"not found", &StatusError{Status: StatusClientErrorNotFound}, true},
+		{"wrapped not found", fmt.Errorf("get job: %w", &StatusError{Status: StatusClientErrorNotFound}), true},
+		{"forbidden", &StatusError{Status: StatusClientErrorForbidden}, false},
+		{"unreachable", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(jobGone(tt.err), jobs.ErrJobNotFound); got != tt.want {
+				t.Errorf("jobGone() is ErrJobNotFound = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCUPSProxy_JobUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		global   Credentials
+		wantUser string // requesting-user-name and Basic-auth user, if any
+	}{
+		{"no credentials", Credentials{}, "airprint"},
+		{"global account", Credentials{User: "lpadmin", Password: "secret"}, "lpadmin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				req, err := goipp.NewRequestDecoder(bytes.NewReader(body)).Decode(nil)
+				if err != nil {
+					t.Errorf("failed to decode request: %v", err)
+					return
+				}
+				if got := req.OperationAttributes["requesting-user-name"]; got != tt.wantUser {
+					t.Errorf("operation %#04x: requesting-user-name = %v, want %s", req.Operation, got, tt.wantUser)
+				}
+				user, password, _ := r.BasicAuth()
+				if user != tt.global.User || password != tt.global.Password {
+					t.Errorf("operation %#04x: authenticated as %q, want %q", req.Operation, user, tt.global.User)
+				}
+				resp := goipp.NewResponse(goipp.StatusOk, req.RequestId)
+				resp.JobAttributes = []goipp.Attributes{{"job-state": {{Tag: goipp.TagEnum, Name: "job-state", Value: int(jobs.StateProcessing)}}}}
+				data, _ := resp.Encode()
+				_, _ = w.Write(data)
+			}))
+			defer srv.Close()
+
+			host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+			portNum, _ := strconv.Atoi(port)
+			c := NewCUPSProxy(host, portNum)
+			// Per-printer credentials are for submitting jobs only
+			c.SetCredentials(tt.global, map[string]Credentials{"Office": {User: "alice", Password: "other"}})
+
+			if _, err := c.JobStatus(100); err != nil {
+				t.Errorf("JobStatus() error = %v", err)
+			}
+			if err := c.CancelJob(100); err != nil {
+				t.Errorf("CancelJob() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package ipp
+
+import (
+	"errors"
+	"strings"
+)
+
+// Reasons a job can be refused by CUPS
+const (
+	DenialQuota  = "quota"
+	DenialPolicy = "policy"
+)
+
+// IPP status codes CUPS uses when refusing jobs
+const (
+	StatusClientErrorForbidden           = 0x0401
+	StatusClientErrorNotAuthenticated    = 0x0402
+	StatusClientErrorNotAuthorized       = 0x0403
+	StatusClientErrorAccountInfoNeeded   = 0x041C
+	StatusClientErrorAccountClosed       = 0x041D
+	StatusClientErrorAccountLimitReached = 0x041E
+	StatusClientErrorAccountAuthFailed   = 0x041F
+)
+
+// Denial describes a job CUPS refused because of a quota or policy
+type Denial struct {
+	Reason  string // DenialQuota or DenialPolicy
+	Status  uint16 // Status to relay to the client
+	Message string // Human-readable explanation for the user
+}
+
+// AsDenial reports whether err is CUPS refusing a job for quota or policy
+// reasons, as opposed to a failure of the bridge or CUPS itself
+func AsDenial(err error) (Denial, bool) {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return Denial{}, false
+	}
+
+	d := Denial{Status: statusErr.Status, Message: statusErr.Message}
+	switch {
+	case statusErr.Status >= StatusClientErrorAccountInfoNeeded && statusErr.Status <= StatusClientErrorAccountAuthFailed:
+		d.Reason = DenialQuota
+	case statusErr.Status == StatusClientErrorNotPossible && strings.Contains(strings.ToLower(statusErr.Message), "quota"):
+		// CUPS reports exceeded page/size quotas as "Quota limit reached."
+		d.Reason = DenialQuota
+	case statusErr.Status == StatusClientErrorNotAuthenticated:
+		// Prompting the client only helps for printers that relay its
+		// credentials, which handle this status themselves
+		d.Reason = DenialPolicy
+		d.Status = StatusClientErrorForbidden
+	case statusErr.Status == StatusClientErrorForbidden || statusErr.Status == StatusClientErrorNotAuthorized:
+		d.Reason = DenialPolicy
+	default:
+		return Denial{}, false
+	}
+
+	if d.Message == "" {
+		if d.Reason == DenialQuota {
+			d.Message = "Print quota exceeded"
+		} else {
+			d.Message = "Printing is not allowed by the print server policy"
+		}
+	}
+	return d, true
+}
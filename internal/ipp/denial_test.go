@@ -0,0 +1,51 @@
+package ipp
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAsDenial(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantOK     bool
+		wantReason string
+		wantStatus uint16
+	}{
+		{"account info needed", &StatusError{Status: 0x041C}, true, DenialQuota, 0x041C},
+		{"account closed", &StatusError{Status: 0x041D}, true, DenialQuota, 0x041D},
+		{"account limit reached", &StatusError{Status: 0x041E}, true, DenialQuota, 0x041E},
+		{"account authorization failed", &StatusError{Status: 0x041F}, true, DenialQuota, 0x041F},
+		{"quota message", &StatusError{Status: StatusClientErrorNotPossible, Message: "Quota limit reached."}, true, DenialQuota, StatusClientErrorNotPossible},
+		{"forbidden", &StatusError{Status: StatusClientErrorForbidden}, true, DenialPolicy, StatusClientErrorForbidden},
+		{"not authorized", &StatusError{Status: StatusClientErrorNotAuthorized}, true, DenialPolicy, StatusClientErrorNotAuthorized},
+		{"not authenticated", &StatusError{Status: StatusClientErrorNotAuthenticated}, true, DenialPolicy, StatusClientErrorForbidden},
+		{"wrapped", fmt.Errorf("print job: %w", &StatusError{Status: 0x041E}), true, DenialQuota, 0x041E},
+		{"document format error", &StatusError{Status: 0x0411}, false, "", 0},
+		{"document access error", &StatusError{Status: 0x0412}, false, "", 0},
+		{"attributes not settable", &StatusError{Status: 0x0413}, false, "", 0},
+		{"format not supported", &StatusError{Status: StatusClientErrorDocumentFormatNotSupported}, false, "", 0},
+		{"not possible", &StatusError{Status: StatusClientErrorNotPossible, Message: "Printer stopped"}, false, "", 0},
+		{"server error", &StatusError{Status: StatusServerErrorInternalError}, false, "", 0},
+		{"not a status", errors.New("connection refused"), false, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := AsDenial(tt.err)
+			if ok != tt.wantOK {
+				t.Fatalf("AsDenial() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if d.Reason != tt.wantReason || d.Status != tt.wantStatus {
+				t.Errorf("AsDenial() = %+v, want reason %q status %#x", d, tt.wantReason, tt.wantStatus)
+			}
+			if d.Message == "" {
+				t.Error("AsDenial() message is empty")
+			}
+		})
+	}
+}
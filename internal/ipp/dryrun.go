@@ -0,0 +1,62 @@
+package ipp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/phin1x/go-ipp"
+)
+
+// WritePrinterAttributes writes the attributes a Get-Printer-Attributes
+// request for a printer would return, one per line and sorted by name, so
+// they can be checked without a client
+func (s *Server) WritePrinterAttributes(w io.Writer, name string) error {
+	printer, ok := s.lookupPrinter(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPrinter, name)
+	}
+
+	resp, err := ipp.NewResponseDecoder(bytes.NewReader(s.handleGetPrinterAttributes(1, printer))).Decode(nil)
+	if err != nil {
+		return fmt.Errorf("failed to decode printer attributes: %w", err)
+	}
+	if len(resp.PrinterAttributes) == 0 {
+		return nil
+	}
+
+	attrs := resp.PrinterAttributes[0]
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%s = %s\n", name, formatValues(attrs[name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatValues formats an attribute's values, writing collections as
+// {member=value ...} with their members sorted
+func formatValues(attrs []ipp.Attribute) string {
+	values := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		col, ok := attr.Value.(ipp.Collection)
+		if !ok {
+			values = append(values, fmt.Sprint(attr.Value))
+			continue
+		}
+		members := make([]string, 0, len(col))
+		for member, v := range col {
+			members = append(members, member+"="+formatValues(v))
+		}
+		sort.Strings(members)
+		values = append(values, "{"+strings.Join(members, " ")+"}")
+	}
+	return strings.Join(values, ", ")
+}
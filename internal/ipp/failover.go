@@ -0,0 +1,54 @@
+package ipp
+
+import (
+	"context"
+	"io"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// FailoverProxy wraps a CUPSClient and redirects jobs for a primary queue to
+// its designated backup while the primary is stopped or offline
+type FailoverProxy struct {
+	CUPSClient
+
+	backups    map[string]string // primary queue -> backup queue
+	available  func(printerName string) (bool, error)
+	onFailover func(primary, backup, traceID string)
+}
+
+// NewFailoverProxy creates a failover wrapper around client. available reports
+// whether a queue can currently print; onFailover is called for every
+// redirected job and may be nil.
+func NewFailoverProxy(client CUPSClient, backups map[string]string, available func(string) (bool, error), onFailover func(primary, backup, traceID string)) *FailoverProxy {
+	return &FailoverProxy{
+		CUPSClient: client,
+		backups:    backups,
+		available:  available,
+		onFailover: onFailover,
+	}
+}
+
+// PrintJob forwards the job to the backup queue when the primary is unavailable
+func (f *FailoverProxy) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	return f.CUPSClient.PrintJob(ctx, f.resolve(ctx, printerName), document, jobName, options)
+}
+
+// resolve returns the queue a job for printerName should be sent to
+func (f *FailoverProxy) resolve(ctx context.Context, printerName string) string {
+	backup, ok := f.backups[printerName]
+	if !ok {
+		return printerName
+	}
+
+	// If the state can't be determined, stay on the primary and let CUPS decide
+	ok, err := f.available(printerName)
+	if err != nil || ok {
+		return printerName
+	}
+
+	if f.onFailover != nil {
+		f.onFailover(printerName, backup, jobs.TraceID(ctx))
+	}
+	return backup
+}
@@ -0,0 +1,61 @@
+package ipp
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+func TestFailoverProxy_PrintJob(t *testing.T) {
+	up := func(string) (bool, error) { return true, nil }
+	down := func(string) (bool, error) { return false, nil }
+	unknown := func(string) (bool, error) { return false, errors.New("CUPS unreachable") }
+
+	tests := []struct {
+		name          string
+		printer       string
+		states        []func(string) (bool, error) // Primary availability for each job in turn
+		wantQueues    []string
+		wantFailovers int
+	}{
+		{"primary up", "Office", []func(string) (bool, error){up, up}, []string{"Office", "Office"}, 0},
+		{"primary down", "Office", []func(string) (bool, error){down}, []string{"Spare"}, 1},
+		{"recovery", "Office", []func(string) (bool, error){up, down, down, up}, []string{"Office", "Spare", "Spare", "Office"}, 2},
+		{"state unknown", "Office", []func(string) (bool, error){unknown}, []string{"Office"}, 0},
+		{"no backup", "Lab", []func(string) (bool, error){down}, []string{"Lab"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &memberCUPS{}
+			var state func(string) (bool, error)
+			var failovers []string
+			f := NewFailoverProxy(cups, map[string]string{"Office": "Spare"},
+				func(name string) (bool, error) { return state(name) },
+				func(primary, backup, traceID string) {
+					failovers = append(failovers, primary+">"+backup+" "+traceID)
+				})
+
+			ctx := jobs.WithTraceID(context.Background(), "trace")
+			for _, state = range tt.states {
+				if _, err := f.PrintJob(ctx, tt.printer, strings.NewReader("document"), "job", nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(cups.printed, tt.wantQueues) {
+				t.Errorf("jobs sent to %v, want %v", cups.printed, tt.wantQueues)
+			}
+			if len(failovers) != tt.wantFailovers {
+				t.Fatalf("failovers = %v, want %d", failovers, tt.wantFailovers)
+			}
+			for _, f := range failovers {
+				if f != "Office>Spare trace" {
+					t.Errorf("failover reported as %q, want Office>Spare trace", f)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package ipp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// IPP status codes CUPS answers with when it can't print a document format
+const (
+	StatusClientErrorDocumentFormatNotSupported = 0x040A
+	StatusClientErrorDocumentFormatError        = 0x0411
+)
+
+// formatRejected reports whether CUPS refused a job because of its document
+// format
+func formatRejected(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.Status == StatusClientErrorDocumentFormatNotSupported ||
+		statusErr.Status == StatusClientErrorDocumentFormatError
+}
+
+// formatChain returns the formats an Apple Raster job is sent to the printer
+// in, in order: the configured conversion, then each fallback
+func (p PrinterConfig) formatChain() []string {
+	first := p.URFConversion
+	if first == "" {
+		first = raster.FormatURF
+	}
+	chain := []string{first}
+	for _, format := range p.FormatFallback {
+		seen := false
+		for _, f := range chain {
+			seen = seen || f == format
+		}
+		if !seen {
+			chain = append(chain, format)
+		}
+	}
+	return chain
+}
+
+// forwardWithFallback sends an Apple Raster document in each format of the
+// printer's chain in turn, until CUPS accepts one. The document is spooled
+// first so each attempt can read it from the start.
+func (s *Server) forwardWithFallback(ctx context.Context, printer PrinterConfig, document io.Reader, spec jobs.Job, options map[string]string) (jobs.Job, error) {
+	log := jobs.TraceLog(ctx, s.log)
+
+	spool, err := createSpool("fallback")
+	if err != nil {
+		return jobs.Job{}, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, document)
+	if err != nil {
+		return jobs.Job{}, fmt.Errorf("failed to spool document: %w", err)
+	}
+
+	chain := printer.formatChain()
+	for i, format := range chain {
+		attempt := printer
+		attempt.URFConversion = format
+		if format == raster.FormatURF {
+			attempt.URFConversion = ""
+		}
+
+		// Each attempt gets its own reader, so a converter still winding
+		// down from the last one can't disturb it
+		job, err := s.send(ctx, attempt, io.NewSectionReader(spool, 0, size), spec, options)
+		if err == nil || !formatRejected(err) || i == len(chain)-1 {
+			return job, err
+		}
+		log.Warn().
+			Err(err).
+			Str("printer", printer.Name).
+			Str("format", format).
+			Str("next_format", chain[i+1]).
+			Msg("CUPS rejected document format, retrying")
+	}
+	return jobs.Job{}, nil // Unreachable, the chain is never empty
+}
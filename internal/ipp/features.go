@@ -0,0 +1,107 @@
+package ipp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Experimental behaviors, enabled per printer so they can be tried on one
+// printer at a time before becoming the default
+const (
+	// FeatureStrictValidate rejects requests that break RFC 8011 instead of
+	// doing what the client probably meant
+	FeatureStrictValidate = "strict-validate"
+	// FeatureLegacyIPP11 answers as an IPP/1.1 printer, for old clients
+	// that give up on IPP/2.0 responses
+	FeatureLegacyIPP11 = "legacy-ipp11"
+	// FeatureURFTranscode converts Apple Raster to PWG Raster in the bridge
+	// unless the printer has another URF conversion set, for CUPS queues
+	// without a URF filter
+	FeatureURFTranscode = "urf-transcode"
+)
+
+// Features lists the experimental behaviors printers can enable
+var Features = []string{FeatureStrictValidate, FeatureLegacyIPP11, FeatureURFTranscode}
+
+// StatusServerErrorVersionNotSupported is returned for requests in an IPP
+// version the printer doesn't speak
+const StatusServerErrorVersionNotSupported = 0x0503
+
+// HasFeature reports whether the printer has an experimental behavior
+// enabled
+func (p PrinterConfig) HasFeature(feature string) bool {
+	return contains(p.Features, feature)
+}
+
+// ippVersion returns the IPP version the printer answers in
+func (p PrinterConfig) ippVersion() uint16 {
+	if p.HasFeature(FeatureLegacyIPP11) {
+		return 0x0101
+	}
+	return 0x0200
+}
+
+// ippVersionsSupported returns the versions the printer advertises
+func (p PrinterConfig) ippVersionsSupported() []string {
+	if p.HasFeature(FeatureLegacyIPP11) {
+		return []string{"1.1"}
+	}
+	return []string{"2.0"}
+}
+
+// setVersion rewrites the version of an encoded response to the one the
+// printer answers in
+func (p PrinterConfig) setVersion(response []byte) {
+	if len(response) >= 2 {
+		binary.BigEndian.PutUint16(response, p.ippVersion())
+	}
+}
+
+// strictValidate validates requests to printers with strict-validate
+// enabled, returning StatusOK for other printers
+func (s *Server) strictValidate(req *Request, printer PrinterConfig) (uint16, string) {
+	if !printer.HasFeature(FeatureStrictValidate) {
+		return StatusOK, ""
+	}
+	status, message := validateRequest(req, printer)
+	if status != StatusOK {
+		s.log.Info().
+			Str("printer", printer.Name).
+			Uint16("operation", req.Operation).
+			Str("reason", message).
+			Msg("refusing request, strict validation failed")
+	}
+	return status, message
+}
+
+// validateRequest checks a request against the rules of RFC 8011 section
+// 4.1 that clients are usually forgiven for breaking, returning the status
+// to refuse it with and why, or StatusOK
+func validateRequest(req *Request, printer PrinterConfig) (uint16, string) {
+	switch major := req.Version >> 8; {
+	case major < 1 || major > 2:
+		return StatusServerErrorVersionNotSupported, fmt.Sprintf("IPP version %d.%d is not supported", major, req.Version&0xff)
+	case major == 2 && printer.HasFeature(FeatureLegacyIPP11):
+		return StatusServerErrorVersionNotSupported, "Only IPP/1.1 is supported"
+	}
+	if req.RequestID == 0 {
+		return StatusClientErrorBadRequest, "request-id must not be 0"
+	}
+	for _, name := range []string{"attributes-charset", "attributes-natural-language"} {
+		if req.OpAttr(name) == nil {
+			return StatusClientErrorBadRequest, "Missing " + name
+		}
+	}
+	if charset := req.OpAttr("attributes-charset").String(); charset != "utf-8" && charset != "us-ascii" {
+		return StatusClientErrorBadRequest, fmt.Sprintf("Charset %q is not supported", charset)
+	}
+	if req.OpAttr("printer-uri") == nil && req.OpAttr("job-uri") == nil {
+		return StatusClientErrorBadRequest, "Missing printer-uri"
+	}
+	if req.Operation == OpPrintJob || req.Operation == OpValidateJob {
+		if format := req.OpAttr("document-format").String(); format != "" && format != "application/octet-stream" && !contains(printer.DocumentFormats(), format) {
+			return StatusClientErrorDocumentFormatNotSupported, fmt.Sprintf("Document format %s is not supported", format)
+		}
+	}
+	return StatusOK, ""
+}
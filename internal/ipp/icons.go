@@ -0,0 +1,62 @@
+package ipp
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// iconPrefix is the path printer icons are served under
+const iconPrefix = "/icons/"
+
+// iconURI returns the URI a printer's icon is served at, on the same port as
+// its printer URI
+func (s *Server) iconURI(name string) string {
+	return fmt.Sprintf("http://%s%s%s.png", net.JoinHostPort(s.uriHost(), s.printerPort(name)), iconPrefix, url.PathEscape(name))
+}
+
+// handleIcon serves a printer's icon at /icons/<printer>.png
+func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, iconPrefix), ".png")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.RLock()
+	printer, ok := s.printers[name]
+	s.mu.RUnlock()
+	if !ok || printer.IconFile == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, err := os.ReadFile(printer.IconFile)
+	if err != nil {
+		s.log.Warn().Err(err).Str("printer", name).Msg("failed to read printer icon")
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// writeGeoIconAttributes writes printer-geo-location and printer-icons for
+// printers that have them configured
+func (s *Server) writeGeoIconAttributes(buf *bytes.Buffer, printer PrinterConfig) {
+	if printer.GeoLocation != "" {
+		s.writeAttribute(buf, TagURI, "printer-geo-location", printer.GeoLocation)
+	}
+	if printer.IconFile != "" {
+		s.writeAttribute(buf, TagURI, "printer-icons", s.iconURI(printer.Name))
+	}
+}
@@ -0,0 +1,74 @@
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+// StatusServerErrorDeviceError tells a client the printer couldn't be reached
+const StatusServerErrorDeviceError = 0x0504
+
+// identifyTimeout bounds how long Identify-Printer waits for the device
+const identifyTimeout = 10 * time.Second
+
+// writeIdentifyAttributes advertises the identify actions of printers that
+// can be identified
+func (s *Server) writeIdentifyAttributes(buf *bytes.Buffer, printer PrinterConfig) {
+	if printer.Identify == nil {
+		return
+	}
+	actions := printer.Identify.Actions()
+	if len(actions) == 0 {
+		return
+	}
+	s.writeAttribute(buf, TagKeyword, "identify-actions-default", actions[0])
+	s.writeKeywords(buf, "identify-actions-supported", actions)
+}
+
+// handleIdentifyPrinter performs the requested identify actions on the
+// physical printer. Actions it can't perform are ignored, and the default
+// is used if none are left.
+func (s *Server) handleIdentifyPrinter(ctx context.Context, req *Request, printer PrinterConfig) []byte {
+	s.log.Debug().Str("printer", printer.Name).Msg("handling Identify-Printer")
+
+	if printer.Identify == nil || len(printer.Identify.Actions()) == 0 {
+		return s.unsupportedOperation(req, printer)
+	}
+
+	supported := printer.Identify.Actions()
+	var actions []string
+	for _, action := range req.OpAttr("identify-actions").Strings() {
+		for _, a := range supported {
+			if a == action {
+				actions = append(actions, action)
+				break
+			}
+		}
+	}
+	if len(actions) == 0 {
+		actions = supported[:1]
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, identifyTimeout)
+	defer cancel()
+	if err := printer.Identify.Identify(ctx, actions, req.OpAttr("message").String()); err != nil {
+		s.log.Error().Err(err).Str("printer", printer.Name).Msg("failed to identify printer")
+		return s.buildErrorResponse(req.RequestID, StatusServerErrorDeviceError)
+	}
+	s.log.Info().Str("printer", printer.Name).Strs("actions", actions).Msg("identified printer")
+
+	buf := &bytes.Buffer{}
+	_ = binary.Write(buf, binary.BigEndian, uint16(0x0200))
+	_ = binary.Write(buf, binary.BigEndian, uint16(StatusOK))
+	_ = binary.Write(buf, binary.BigEndian, req.RequestID)
+
+	buf.WriteByte(TagOperationAttrs)
+	s.writeAttribute(buf, TagCharset, "attributes-charset", "utf-8")
+	s.writeAttribute(buf, TagNaturalLang, "attributes-natural-language", "en-us")
+
+	buf.WriteByte(TagEnd)
+
+	return buf.Bytes()
+}
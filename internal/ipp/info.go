@@ -0,0 +1,92 @@
+package ipp
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// BuildInfo identifies the running bridge for fleet inventory
+type BuildInfo struct {
+	Version  string
+	Commit   string
+	Features []string // Enabled features, e.g. "tls" or "failover"
+}
+
+// SetBuildInfo sets the version and features reported in printer attributes.
+// It must be called before serving requests.
+func (s *Server) SetBuildInfo(info BuildInfo) {
+	s.build = info
+}
+
+// Printers returns the printers currently served, sorted by name
+func (s *Server) Printers() []PrinterConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	printers := make([]PrinterConfig, 0, len(s.printers))
+	for _, p := range s.printers {
+		printers = append(printers, p)
+	}
+	sort.Slice(printers, func(i, j int) bool { return printers[i].Name < printers[j].Name })
+	return printers
+}
+
+// Pipeline returns the processing stages jobs for the printer go through on
+// the way to CUPS, e.g. "convert-pdf" and "watermark"
+func (p PrinterConfig) Pipeline() []string {
+	var stages []string
+	if p.RelayAuth {
+		stages = append(stages, "relay-auth")
+	}
+	if p.HoldJobs {
+		stages = append(stages, "hold")
+	}
+	if p.RawAddr != "" {
+		// Conversion and fallback don't apply, jobs never reach CUPS
+		stages = append(stages, "convert-zpl")
+		if p.Watermark != "" {
+			stages = append(stages, "watermark")
+		}
+		return stages
+	}
+	if p.URFConversion != "" {
+		// "application/pdf" -> "convert-pdf"
+		format := p.URFConversion[strings.LastIndex(p.URFConversion, "/")+1:]
+		stages = append(stages, "convert-"+format)
+	}
+	if len(p.FormatFallback) > 0 {
+		stages = append(stages, "format-fallback")
+	}
+	if p.Watermark != "" {
+		stages = append(stages, "watermark")
+	}
+	return stages
+}
+
+// writeBuildInfo writes the bridge's version as the printer firmware, plus
+// vendor extensions listing enabled features and the printer's pipeline
+func (s *Server) writeBuildInfo(buf *bytes.Buffer, printer PrinterConfig) {
+	version := s.build.Version
+	if version == "" {
+		version = "dev"
+	}
+	if s.build.Commit != "" {
+		version += " (" + s.build.Commit + ")"
+	}
+	s.writeAttribute(buf, TagNameWithoutLang, "printer-firmware-name", "airprint-bridge")
+	s.writeAttribute(buf, TagTextWithoutLang, "printer-firmware-string-version", version)
+
+	s.writeKeywords(buf, "airprint-bridge-features", s.build.Features)
+	s.writeKeywords(buf, "airprint-bridge-pipeline", printer.Pipeline())
+}
+
+// writeKeywords writes a multi-valued keyword attribute, or "none" when
+// there are no values
+func (s *Server) writeKeywords(buf *bytes.Buffer, name string, values []string) {
+	if len(values) == 0 {
+		values = []string{"none"}
+	}
+	s.writeAttribute(buf, TagKeyword, name, values[0])
+	s.writeAttributeMulti(buf, TagKeyword, name, values[1:])
+}
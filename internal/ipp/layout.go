@@ -0,0 +1,121 @@
+package ipp
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// PrintScalingModes are the print-scaling values clients may request
+var PrintScalingModes = []string{"auto", "auto-fit", "fill", "fit", "none"}
+
+// orientation-requested values
+const (
+	orientationPortrait         = 3
+	orientationLandscape        = 4
+	orientationReverseLandscape = 5
+	orientationReversePortrait  = 6
+	orientationNone             = 7 // Let the printer decide from the content
+)
+
+// print-quality values
+const (
+	qualityDraft  = 3
+	qualityNormal = 4
+	qualityHigh   = 5
+)
+
+var (
+	orientationsSupported = []int32{orientationPortrait, orientationLandscape, orientationReverseLandscape, orientationReversePortrait, orientationNone}
+	qualitiesSupported    = []int32{qualityDraft, qualityNormal, qualityHigh}
+)
+
+// Scaling controls how pages are scaled onto the media. Label printers
+// usually want "fill", so artwork covers the whole label instead of being
+// shrunk to fit inside it.
+type Scaling struct {
+	Default string // print-scaling used when the client asks for none, empty for "auto"
+	Force   bool   // Ignore the client's choice and always use Default
+}
+
+// scalingDefault returns the advertised print-scaling-default
+func (p PrinterConfig) scalingDefault() string {
+	if p.Scaling.Default != "" {
+		return p.Scaling.Default
+	}
+	return "auto"
+}
+
+// writeLayoutAttributes writes the scaling, orientation and quality
+// capabilities of a printer
+func (s *Server) writeLayoutAttributes(buf *bytes.Buffer, printer PrinterConfig) {
+	s.writeAttribute(buf, TagKeyword, "print-scaling-default", printer.scalingDefault())
+	scaling := PrintScalingModes
+	if printer.Scaling.Force {
+		scaling = []string{printer.Scaling.Default}
+	}
+	s.writeAttribute(buf, TagKeyword, "print-scaling-supported", scaling[0])
+	s.writeAttributeMulti(buf, TagKeyword, "print-scaling-supported", scaling[1:])
+
+	s.writeAttribute(buf, TagEnum, "orientation-requested-default", int32(orientationNone))
+	s.writeAttribute(buf, TagEnum, "orientation-requested-supported", orientationsSupported[0])
+	for _, o := range orientationsSupported[1:] {
+		s.writeAttribute(buf, TagEnum, "", o)
+	}
+
+	s.writeAttribute(buf, TagEnum, "print-quality-default", int32(qualityNormal))
+	s.writeAttribute(buf, TagEnum, "print-quality-supported", qualitiesSupported[0])
+	for _, q := range qualitiesSupported[1:] {
+		s.writeAttribute(buf, TagEnum, "", q)
+	}
+}
+
+// layoutOptions returns the scaling, orientation and quality the client
+// asked for, as CUPS job options. Unsupported values are dropped, which
+// IPP allows unless the client demands fidelity. Printers with a scaling
+// default get it even if the client didn't ask.
+func (s *Server) layoutOptions(req *Request, printer PrinterConfig) map[string]string {
+	options := make(map[string]string)
+
+	scaling := jobTemplateAttr(req, "print-scaling").String()
+	if printer.Scaling.Force || scaling == "" {
+		scaling = printer.Scaling.Default
+	}
+	if scaling != "" && contains(PrintScalingModes, scaling) {
+		options["print-scaling"] = scaling
+	}
+
+	if o, ok := jobTemplateAttr(req, "orientation-requested").Int(); ok && containsEnum(orientationsSupported, o) && o != orientationNone {
+		options["orientation-requested"] = strconv.Itoa(o)
+	}
+	if q, ok := jobTemplateAttr(req, "print-quality").Int(); ok && containsEnum(qualitiesSupported, q) {
+		options["print-quality"] = strconv.Itoa(q)
+	}
+	return options
+}
+
+// jobTemplateAttr returns a job template attribute. Some clients send them
+// in the operation group, so that is checked too.
+func jobTemplateAttr(req *Request, name string) *Attribute {
+	if a := req.JobAttr(name); a != nil {
+		return a
+	}
+	return req.OpAttr(name)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsEnum(list []int32, v int) bool {
+	for _, e := range list {
+		if int(e) == v {
+			return true
+		}
+	}
+	return false
+}
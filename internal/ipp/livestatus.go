@@ -0,0 +1,131 @@
+package ipp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/phin1x/go-ipp"
+)
+
+// liveStatusTimeout bounds how long Get-Printer-Attributes waits for CUPS
+// before answering with the state from the last poll
+const liveStatusTimeout = 2 * time.Second
+
+// PrinterStatus is a queue's state in CUPS at one moment
+type PrinterStatus struct {
+	State        int
+	StateReasons []string // nil for none
+	StateMessage string
+	Accepting    bool
+	QueuedJobs   int
+}
+
+// PrinterStatus asks CUPS for a queue's current state and the number of jobs
+// waiting or printing on it
+func (c *CUPSProxy) PrinterStatus(ctx context.Context, queue string) (PrinterStatus, error) {
+	req := ipp.NewRequest(ipp.OperationGetPrinterAttributes, 1)
+	req.OperationAttributes["printer-uri"] = fmt.Sprintf("ipp://%s:%d/printers/%s", c.host, c.port, queue)
+	req.OperationAttributes["requesting-user-name"] = "airprint"
+	req.OperationAttributes["requested-attributes"] = []string{
+		"printer-state",
+		"printer-state-reasons",
+		"printer-state-message",
+		"printer-is-accepting-jobs",
+		"queued-job-count",
+	}
+
+	ippResp, err := c.send(ctx, "/printers/"+queue, req, nil, c.global)
+	if err != nil {
+		return PrinterStatus{}, err
+	}
+	if len(ippResp.PrinterAttributes) == 0 {
+		return PrinterStatus{}, fmt.Errorf("CUPS returned no attributes for printer %s", queue)
+	}
+	attrs := ippResp.PrinterAttributes[0]
+
+	var status PrinterStatus
+	if v, ok := attrs["printer-state"]; ok && len(v) > 0 {
+		status.State, _ = v[0].Value.(int)
+	}
+	for _, v := range attrs["printer-state-reasons"] {
+		if reason, ok := v.Value.(string); ok && reason != "none" {
+			status.StateReasons = append(status.StateReasons, reason)
+		}
+	}
+	if v, ok := attrs["printer-state-message"]; ok && len(v) > 0 {
+		status.StateMessage, _ = v[0].Value.(string)
+	}
+	if v, ok := attrs["printer-is-accepting-jobs"]; ok && len(v) > 0 {
+		status.Accepting, _ = v[0].Value.(bool)
+	}
+	if v, ok := attrs["queued-job-count"]; ok && len(v) > 0 {
+		status.QueuedJobs, _ = v[0].Value.(int)
+	}
+	return status, nil
+}
+
+// liveStatus fetches queues' status from CUPS, reusing each answer for a
+// while so clients polling Get-Printer-Attributes don't each reach CUPS
+type liveStatus struct {
+	fetch func(ctx context.Context, queue string) (PrinterStatus, error)
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedStatus // Queue -> last answer
+}
+
+// cachedStatus is an answer from CUPS, or its failure, which is reused too
+// so an unreachable CUPS isn't asked on every request
+type cachedStatus struct {
+	status PrinterStatus
+	err    error
+	at     time.Time
+}
+
+// get returns a queue's status, from the cache while it is fresh
+func (l *liveStatus) get(ctx context.Context, queue string) (PrinterStatus, error) {
+	l.mu.Lock()
+	cached, ok := l.cache[queue]
+	l.mu.Unlock()
+	if ok && time.Since(cached.at) < l.ttl {
+		return cached.status, cached.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, liveStatusTimeout)
+	defer cancel()
+	status, err := l.fetch(ctx, queue)
+
+	l.mu.Lock()
+	l.cache[queue] = cachedStatus{status: status, err: err, at: time.Now()}
+	l.mu.Unlock()
+	return status, err
+}
+
+// SetLiveStatus makes Get-Printer-Attributes report the state and queued
+// jobs of printers with a LiveQueue as fetch finds them in CUPS, rather than
+// as of the last poll, reusing each answer for ttl. It must be called
+// before serving requests.
+func (s *Server) SetLiveStatus(fetch func(ctx context.Context, queue string) (PrinterStatus, error), ttl time.Duration) {
+	s.live = &liveStatus{fetch: fetch, ttl: ttl, cache: make(map[string]cachedStatus)}
+}
+
+// withLiveStatus returns the printer with its state as CUPS has it now. If
+// CUPS doesn't answer in time the state from the last poll is kept.
+func (s *Server) withLiveStatus(ctx context.Context, printer PrinterConfig) PrinterConfig {
+	if s.live == nil || printer.LiveQueue == "" {
+		return printer
+	}
+	status, err := s.live.get(ctx, printer.LiveQueue)
+	if err != nil {
+		s.log.Debug().Err(err).Str("printer", printer.Name).Msg("failed to get live printer status, using the last poll's")
+		return printer
+	}
+	printer.State = status.State
+	printer.StateReasons = status.StateReasons
+	printer.StateMessage = status.StateMessage
+	printer.NotAccepting = !status.Accepting
+	printer.QueuedJobs = status.QueuedJobs
+	return printer
+}
@@ -0,0 +1,57 @@
+package ipp
+
+import "fmt"
+
+// defaultMaintenanceMessage is shown when maintenance is set without a reason
+const defaultMaintenanceMessage = "Printer is under maintenance"
+
+// SetMaintenance puts a printer in maintenance mode. It stays advertised but
+// reports itself paused with the given message and rejects new jobs.
+func (s *Server) SetMaintenance(name, message string) error {
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.printers[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPrinter, name)
+	}
+	s.maintenance[name] = message
+
+	s.log.Info().Str("printer", name).Str("message", message).Msg("printer entered maintenance mode")
+	return nil
+}
+
+// ClearMaintenance returns a printer to service
+func (s *Server) ClearMaintenance(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.maintenance[name]; ok {
+		delete(s.maintenance, name)
+		s.log.Info().Str("printer", name).Msg("printer left maintenance mode")
+	}
+}
+
+// Maintenance returns the printers in maintenance mode and their messages
+func (s *Server) Maintenance() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]string, len(s.maintenance))
+	for name, message := range s.maintenance {
+		result[name] = message
+	}
+	return result
+}
+
+// maintenanceMessage returns the message for a printer in maintenance mode
+func (s *Server) maintenanceMessage(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	message, ok := s.maintenance[name]
+	return message, ok
+}
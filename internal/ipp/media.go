@@ -0,0 +1,216 @@
+package ipp
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// MediaCol describes one media size, and for loaded media the tray it's in,
+// as a media-col collection
+type MediaCol struct {
+	Name    string // PWG media name, if known
+	Width   int    // Hundredths of a millimetre
+	Height  int
+	Source  string   // media-source, empty if not tied to a tray
+	Type    string   // media-type, empty if unknown
+	Margins *Margins // nil if unknown
+}
+
+// Margins are the unprintable edges of the media, in hundredths of a
+// millimetre. Zero margins mean borderless printing.
+type Margins struct {
+	Top, Bottom, Left, Right int
+}
+
+// writeMediaColAttributes writes the trays and the media-col forms of the
+// media lists, which newer clients use to offer a paper and tray picker
+func (s *Server) writeMediaColAttributes(buf *bytes.Buffer, printer PrinterConfig) {
+	members := []string{"media-size", "media-size-name"}
+	if len(printer.MediaSources) > 0 {
+		members = append(members, "media-source")
+		s.writeKeywords(buf, "media-source-supported", printer.MediaSources)
+	}
+	members = append(members, "media-type")
+	if margins := printer.marginsSupported(); len(margins) > 0 {
+		members = append(members, "media-top-margin", "media-bottom-margin", "media-left-margin", "media-right-margin")
+		s.writeMarginSupported(buf, "media-top-margin-supported", margins, func(m Margins) int { return m.Top })
+		s.writeMarginSupported(buf, "media-bottom-margin-supported", margins, func(m Margins) int { return m.Bottom })
+		s.writeMarginSupported(buf, "media-left-margin-supported", margins, func(m Margins) int { return m.Left })
+		s.writeMarginSupported(buf, "media-right-margin-supported", margins, func(m Margins) int { return m.Right })
+	}
+	s.writeKeywords(buf, "media-col-supported", members)
+
+	database := append([]MediaCol(nil), printer.MediaDatabase...)
+	for _, col := range printer.MediaColReady {
+		if col.Source != "" {
+			database = append(database, col)
+		}
+	}
+	s.writeMediaCols(buf, "media-col-database", database)
+	s.writeMediaCols(buf, "media-col-ready", printer.MediaColReady)
+	if col, ok := printer.mediaColDefault(); ok {
+		s.writeMediaCol(buf, "media-col-default", col)
+	}
+}
+
+// mediaColDefault returns the media-col of the default media
+func (p PrinterConfig) mediaColDefault() (MediaCol, bool) {
+	for _, col := range p.MediaDatabase {
+		if col.Name == p.MediaDefault {
+			return col, true
+		}
+	}
+	return MediaCol{}, false
+}
+
+// marginsSupported returns the distinct margins of the media database
+func (p PrinterConfig) marginsSupported() []Margins {
+	var margins []Margins
+	for _, col := range p.MediaDatabase {
+		if col.Margins == nil || containsMargins(margins, *col.Margins) {
+			continue
+		}
+		margins = append(margins, *col.Margins)
+	}
+	return margins
+}
+
+func containsMargins(list []Margins, m Margins) bool {
+	for _, v := range list {
+		if v == m {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMarginSupported writes one edge of each margin as a multi-valued integer
+// attribute, without repeating values
+func (s *Server) writeMarginSupported(buf *bytes.Buffer, name string, margins []Margins, edge func(Margins) int) {
+	var seen []int
+	for _, m := range margins {
+		v := edge(m)
+		if containsInt(seen, v) {
+			continue
+		}
+		if len(seen) > 0 {
+			name = ""
+		}
+		seen = append(seen, v)
+		s.writeAttribute(buf, TagInteger, name, int32(v))
+	}
+}
+
+func containsInt(list []int, v int) bool {
+	for _, e := range list {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMediaCols writes a multi-valued media-col attribute, or nothing if
+// there are no values
+func (s *Server) writeMediaCols(buf *bytes.Buffer, name string, cols []MediaCol) {
+	for i, col := range cols {
+		if i > 0 {
+			name = ""
+		}
+		s.writeMediaCol(buf, name, col)
+	}
+}
+
+// writeMediaCol writes one media-col collection value
+func (s *Server) writeMediaCol(buf *bytes.Buffer, name string, col MediaCol) {
+	s.beginCollection(buf, name)
+	if col.Width > 0 && col.Height > 0 {
+		s.writeMemberName(buf, "media-size")
+		s.beginCollection(buf, "")
+		s.writeMember(buf, TagInteger, "x-dimension", int32(col.Width))
+		s.writeMember(buf, TagInteger, "y-dimension", int32(col.Height))
+		s.endCollection(buf)
+	}
+	if col.Margins != nil {
+		s.writeMember(buf, TagInteger, "media-top-margin", int32(col.Margins.Top))
+		s.writeMember(buf, TagInteger, "media-bottom-margin", int32(col.Margins.Bottom))
+		s.writeMember(buf, TagInteger, "media-left-margin", int32(col.Margins.Left))
+		s.writeMember(buf, TagInteger, "media-right-margin", int32(col.Margins.Right))
+	}
+	if col.Name != "" {
+		s.writeMember(buf, TagKeyword, "media-size-name", col.Name)
+	}
+	if col.Source != "" {
+		s.writeMember(buf, TagKeyword, "media-source", col.Source)
+	}
+	if col.Type != "" {
+		s.writeMember(buf, TagKeyword, "media-type", col.Type)
+	}
+	s.endCollection(buf)
+}
+
+// beginCollection starts a collection value. An empty name adds another
+// value to the previous attribute, or gives the value of a member.
+func (s *Server) beginCollection(buf *bytes.Buffer, name string) {
+	_ = buf.WriteByte(TagBegCollection)
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(name)))
+	_, _ = buf.WriteString(name)
+	_ = binary.Write(buf, binary.BigEndian, uint16(0))
+}
+
+// endCollection ends the innermost open collection
+func (s *Server) endCollection(buf *bytes.Buffer) {
+	_ = buf.WriteByte(TagEndCollection)
+	_ = binary.Write(buf, binary.BigEndian, uint16(0))
+	_ = binary.Write(buf, binary.BigEndian, uint16(0))
+}
+
+// writeMemberName starts a collection member; its value follows
+func (s *Server) writeMemberName(buf *bytes.Buffer, member string) {
+	s.writeAttribute(buf, TagMemberAttrName, "", member)
+}
+
+// writeMember writes a collection member with a single value
+func (s *Server) writeMember(buf *bytes.Buffer, tag byte, member string, value interface{}) {
+	s.writeMemberName(buf, member)
+	s.writeAttribute(buf, tag, "", value)
+}
+
+// mediaOptions returns the paper size and tray the client chose, from media
+// or media-col, as CUPS job options. Sizes and trays the printer doesn't
+// have are dropped.
+func (s *Server) mediaOptions(req *Request, printer PrinterConfig) map[string]string {
+	options := make(map[string]string)
+	if media := jobTemplateAttr(req, "media").String(); contains(printer.MediaSupported, media) {
+		options["media"] = media
+	}
+
+	col := jobTemplateAttr(req, "media-col")
+	if col == nil || len(col.Values) == 0 || col.Values[0].Collection == nil {
+		return options
+	}
+	members := col.Values[0].Collection
+	if source := members["media-source"].String(); contains(printer.MediaSources, source) {
+		options["media-source"] = source
+	}
+	if size := members["media-size"]; size != nil && len(size.Values) > 0 && size.Values[0].Collection != nil {
+		width, _ := size.Values[0].Collection["x-dimension"].Int()
+		height, _ := size.Values[0].Collection["y-dimension"].Int()
+		if name := printer.mediaSizeName(width, height); name != "" {
+			options["media"] = name
+		}
+	}
+	return options
+}
+
+// mediaSizeName returns the supported media name with the given dimensions,
+// to within a millimetre, or ""
+func (p PrinterConfig) mediaSizeName(width, height int) string {
+	within := func(a, b int) bool { return a-b <= 100 && b-a <= 100 }
+	for _, col := range p.MediaDatabase {
+		if col.Name != "" && within(col.Width, width) && within(col.Height, height) {
+			return col.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package ipp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// NullProxy wraps a CUPSClient and accepts jobs for one printer without
+// printing them, so client apps can be tested without wasting media. Its
+// jobs get negative IDs, which never clash with CUPS job IDs, and complete
+// as soon as the document has been read.
+type NullProxy struct {
+	CUPSClient
+
+	printer string
+	lastID  atomic.Int32
+	log     zerolog.Logger
+}
+
+// NewNullProxy creates a wrapper around client that discards jobs for printer
+func NewNullProxy(client CUPSClient, printer string, log zerolog.Logger) *NullProxy {
+	return &NullProxy{
+		CUPSClient: client,
+		printer:    printer,
+		log:        log.With().Str("component", "null-printer").Logger(),
+	}
+}
+
+// PrintJob reads and discards documents for the null printer
+func (n *NullProxy) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	if printerName != n.printer {
+		return n.CUPSClient.PrintJob(ctx, printerName, document, jobName, options)
+	}
+
+	size, err := io.Copy(io.Discard, document)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read document: %w", err)
+	}
+	jobID := -int(n.lastID.Add(1))
+	jobs.TraceLog(ctx, n.log).Info().
+		Str("printer", printerName).
+		Str("job_name", jobName).
+		Int64("bytes", size).
+		Interface("options", options).
+		Msg("discarded job")
+	return jobID, nil
+}
+
+// JobStatus reports the null printer's jobs as completed
+func (n *NullProxy) JobStatus(jobID int) (jobs.Status, error) {
+	if jobID < 0 {
+		return jobs.Status{State: jobs.StateCompleted, StateReasons: []string{"job-completed-successfully"}}, nil
+	}
+	return n.CUPSClient.JobStatus(jobID)
+}
+
+// CancelJob does nothing for the null printer's jobs, which are already done
+func (n *NullProxy) CancelJob(jobID int) error {
+	if jobID < 0 {
+		return nil
+	}
+	return n.CUPSClient.CancelJob(jobID)
+}
@@ -0,0 +1,47 @@
+package ipp
+
+import "fmt"
+
+// operationNames names the operations clients send, for logs, connection
+// stats and the status message refusing those the bridge doesn't perform
+var operationNames = map[uint16]string{
+	OpPrintJob:             "Print-Job",
+	OpValidateJob:          "Validate-Job",
+	OpCancelJob:            "Cancel-Job",
+	OpGetJobAttributes:     "Get-Job-Attributes",
+	OpGetJobs:              "Get-Jobs",
+	OpGetPrinterAttributes: "Get-Printer-Attributes",
+	0x0003:                 "Print-URI",
+	0x0005:                 "Create-Job",
+	0x0006:                 "Send-Document",
+	0x0007:                 "Send-URI",
+	0x000c:                 "Hold-Job",
+	0x000d:                 "Release-Job",
+	0x000e:                 "Restart-Job",
+	0x0010:                 "Pause-Printer",
+	0x0011:                 "Resume-Printer",
+	0x0012:                 "Purge-Jobs",
+	0x0013:                 "Set-Printer-Attributes",
+	0x0014:                 "Set-Job-Attributes",
+	0x0015:                 "Get-Printer-Supported-Values",
+	0x003b:                 "Close-Job",
+	OpIdentifyPrinter:      "Identify-Printer",
+}
+
+// operationName returns the name of an operation, or its code
+func operationName(op uint16) string {
+	if name, ok := operationNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04x", op)
+}
+
+// unsupportedOperation refuses an operation the printer doesn't perform
+// with server-error-operation-not-supported, as RFC 8011 asks. Clients
+// told client-error-bad-request take their request for malformed and some
+// retry it in a loop.
+func (s *Server) unsupportedOperation(req *Request, printer PrinterConfig) []byte {
+	name := operationName(req.Operation)
+	s.log.Warn().Str("printer", printer.Name).Str("operation", name).Msg("unsupported operation")
+	return s.buildErrorResponseMessage(req.RequestID, StatusServerErrorOperationNotSupported, name+" is not supported")
+}
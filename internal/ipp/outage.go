@@ -0,0 +1,47 @@
+package ipp
+
+// upstreamDownMessage is shown for printers whose CUPS can't be reached
+const upstreamDownMessage = "Print server unavailable, jobs are refused until it returns"
+
+// notAcceptingMessage is shown for queues refusing jobs in CUPS that don't
+// say why
+const notAcceptingMessage = "Printer is not accepting jobs"
+
+// SetUpstreamDown marks the named printers stopped and not accepting jobs
+// while CUPS can't be reached, so clients hold jobs back instead of sending
+// ones that would fail. Printers not named are in service.
+func (s *Server) SetUpstreamDown(names []string) {
+	down := make(map[string]bool, len(names))
+	for _, name := range names {
+		down[name] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upstreamDown = down
+}
+
+// isUpstreamDown reports whether a printer's CUPS can't be reached
+func (s *Server) isUpstreamDown(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.upstreamDown[name]
+}
+
+// unavailableMessage returns why a printer isn't taking jobs, if it isn't:
+// it is in maintenance mode, its CUPS is down or the queue refuses them
+func (s *Server) unavailableMessage(printer PrinterConfig) (string, bool) {
+	if message, ok := s.maintenanceMessage(printer.Name); ok {
+		return message, true
+	}
+	if s.isUpstreamDown(printer.Name) {
+		return upstreamDownMessage, true
+	}
+	if printer.NotAccepting {
+		if printer.StateMessage != "" {
+			return printer.StateMessage, true
+		}
+		return notAcceptingMessage, true
+	}
+	return "", false
+}
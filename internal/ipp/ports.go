@@ -0,0 +1,101 @@
+package ipp
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/airprint"
+)
+
+// portServer serves one printer on its own port
+type portServer struct {
+	printer string
+	srv     *http.Server
+}
+
+// listenPort returns the port of the main IPP listener
+func (s *Server) listenPort() string {
+	_, port, err := net.SplitHostPort(s.listenAddr)
+	if err != nil {
+		return "631"
+	}
+	return port
+}
+
+// printerPort returns the port a printer is served and advertised on: its
+// own port if it has one, otherwise the main listener's
+func (s *Server) printerPort(name string) string {
+	s.mu.RLock()
+	p := s.printers[name]
+	s.mu.RUnlock()
+	if p.Port != 0 {
+		return strconv.Itoa(p.Port)
+	}
+	return s.listenPort()
+}
+
+// syncPorts starts listeners for printers that have been given their own
+// port and stops those no longer needed. Printers stay reachable on the main
+// listener too.
+func (s *Server) syncPorts() {
+	s.mu.RLock()
+	wanted := make(map[int]string)
+	for name, p := range s.printers {
+		if p.Port != 0 {
+			wanted[p.Port] = name
+		}
+	}
+	s.mu.RUnlock()
+
+	s.portsMu.Lock()
+	defer s.portsMu.Unlock()
+	if !s.serving {
+		return
+	}
+
+	for port, ps := range s.portServers {
+		if wanted[port] != ps.printer {
+			_ = ps.srv.Close()
+			delete(s.portServers, port)
+			s.log.Info().Int("port", port).Str("printer", ps.printer).Msg("stopped printer listener")
+		}
+	}
+
+	host, _, _ := net.SplitHostPort(s.listenAddr)
+	for port, name := range wanted {
+		if _, ok := s.portServers[port]; ok {
+			continue
+		}
+		ln, err := s.listen(net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			s.log.Error().Err(err).Int("port", port).Str("printer", name).Msg("failed to listen on printer port")
+			continue
+		}
+		srv := s.httpServer(s.printerHandler(name))
+		s.portServers[port] = portServer{printer: name, srv: srv}
+		go func() {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				s.log.Error().Err(err).Str("printer", name).Msg("printer listener failed")
+			}
+		}()
+		s.log.Info().Int("port", port).Str("printer", name).Msg("started printer listener")
+	}
+}
+
+// printerHandler serves a printer's own port, where requests to "/" are for
+// that printer rather than the default one
+func (s *Server) printerHandler(name string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+airprint.ResourcePrefix, s.handlePrinter)
+	mux.HandleFunc(iconPrefix, s.handleIcon)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("AirPrint Bridge IPP Server"))
+			return
+		}
+		s.handleIPP(w, r, name)
+	})
+	return mux
+}
@@ -0,0 +1,137 @@
+package ipp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Decoders for previewed images
+	_ "image/png"
+	"io"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/airprint"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// ErrInvalidPreview is returned for previews of documents, pages or media
+// that can't be rendered
+var ErrInvalidPreview = errors.New("invalid preview")
+
+// maxPreviewImagePixels bounds the images decoded for previews
+const maxPreviewImagePixels = 1 << 26
+
+// PreviewRequest says what to render a preview of
+type PreviewRequest struct {
+	Page    int    // From 1, 0 for the first
+	Media   string // PWG media name images are laid out on, empty for the printer's default
+	Scaling string // print-scaling for images, empty for the printer's default
+	User    string // Filled into the watermark as {user}
+	JobName string // Filled into the watermark as {job}
+}
+
+// Preview is one page rendered as the printer would print it
+type Preview struct {
+	Image image.Image
+	Pages int // Pages in the document
+}
+
+// Preview renders a page of document the way printer would print it. Apple
+// Raster pages are shown as they are, PNG and JPEG images are laid out on
+// the media at the printer's resolution. The printer's watermark is drawn
+// and, for raw ZPL printers, pages are thresholded to black and white.
+func (s *Server) Preview(name string, document io.Reader, req PreviewRequest) (Preview, error) {
+	printer, ok := s.lookupPrinter(name)
+	if !ok || name == "" {
+		return Preview{}, fmt.Errorf("%w: %s", ErrUnknownPrinter, name)
+	}
+	if req.Page == 0 {
+		req.Page = 1
+	}
+	if req.Page < 0 {
+		return Preview{}, fmt.Errorf("%w: page %d", ErrInvalidPreview, req.Page)
+	}
+
+	opts := raster.Preview{Page: req.Page, Mono: printer.RawAddr != ""}
+	if printer.Watermark != "" {
+		spec := jobs.Job{User: req.User, Name: req.JobName}
+		opts.Stamp = raster.NewStamp(watermarkText(printer.Watermark, printer.Name, spec))
+	}
+
+	br := bufio.NewReader(document)
+	if raster.IsURF(br) {
+		img, pages, err := raster.RenderURFPage(br, opts)
+		if err != nil {
+			return Preview{}, fmt.Errorf("%w: %w", ErrInvalidPreview, err)
+		}
+		return Preview{Image: img, Pages: pages}, nil
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return Preview{}, fmt.Errorf("failed to read document: %w", err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Preview{}, fmt.Errorf("%w: document is not Apple Raster, PNG or JPEG", ErrInvalidPreview)
+	}
+	if cfg.Width*cfg.Height > maxPreviewImagePixels {
+		return Preview{}, fmt.Errorf("%w: image is too large: %dx%d", ErrInvalidPreview, cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Preview{}, fmt.Errorf("%w: %w", ErrInvalidPreview, err)
+	}
+	if req.Page != 1 {
+		return Preview{}, fmt.Errorf("%w: images have 1 page, page %d requested", ErrInvalidPreview, req.Page)
+	}
+	h, err := printer.previewPage(req.Media)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	scaling := req.Scaling
+	if printer.Scaling.Force || scaling == "" {
+		scaling = printer.scalingDefault()
+	}
+	if !contains(PrintScalingModes, scaling) {
+		return Preview{}, fmt.Errorf("%w: print-scaling %q", ErrInvalidPreview, scaling)
+	}
+
+	img, err := raster.RenderImage(src, h, scaling, opts)
+	if err != nil {
+		return Preview{}, fmt.Errorf("%w: %w", ErrInvalidPreview, err)
+	}
+	return Preview{Image: img, Pages: 1}, nil
+}
+
+// previewPage returns the page an image is printed on: the named media, or
+// the default, at the printer's default resolution
+func (p PrinterConfig) previewPage(media string) (raster.PageHeader, error) {
+	if media == "" {
+		media = p.MediaDefault
+	}
+	var col MediaCol
+	for _, c := range p.MediaDatabase {
+		if c.Name == media {
+			col = c
+			break
+		}
+	}
+	if col.Width <= 0 || col.Height <= 0 {
+		return raster.PageHeader{}, fmt.Errorf("%w: media %q is not supported by %s", ErrInvalidPreview, media, p.Name)
+	}
+
+	dpi := defaultResolution(airprint.NormalizeResolutions(p.Resolutions), p.DefaultResolution)
+	h := raster.PageHeader{
+		Width:      col.Width * dpi / 2540,
+		Height:     col.Height * dpi / 2540,
+		DPI:        dpi,
+		ColorSpace: raster.Gray,
+	}
+	if p.Color && p.RawAddr == "" {
+		h.ColorSpace = raster.RGB
+	}
+	return h, nil
+}
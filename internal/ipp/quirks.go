@@ -0,0 +1,159 @@
+package ipp
+
+import (
+	"encoding/binary"
+	"net/http"
+	"regexp"
+)
+
+// Quirk works around a client's bugs in the responses it is sent, the way
+// CUPS keeps workarounds for clients it knows misbehave
+type Quirk struct {
+	Name      string         // Shown in logs
+	UserAgent *regexp.Regexp // Matches the User-Agent header of clients that need it
+	Omit      []string       // Printer attributes left out of Get-Printer-Attributes responses
+	Version   uint16         // IPP version to answer in, e.g. 0x0101, 0 for the printer's
+	Chunked   bool           // Send responses with chunked transfer encoding instead of a length
+	Close     bool           // Close the connection after each response
+}
+
+// BuiltinQuirks are the workarounds applied unless turned off in the config
+var BuiltinQuirks = []Quirk{
+	{
+		// CUPS 1.x clients only speak IPP/1.1
+		Name:      "cups-1",
+		UserAgent: regexp.MustCompile(`^CUPS/1\.`),
+		Version:   0x0101,
+	},
+	{
+		// iOS 12 and older stall on attributes added after they shipped
+		Name:      "ios-12",
+		UserAgent: regexp.MustCompile(`(iOS|iPhone OS)[ /](9|1[0-2])[._]|Darwin/1[5-8]\.`),
+		Omit:      []string{"printer-geo-location", "printer-icons", "identify-actions-supported"},
+	},
+	{
+		// Some Android print services wait for the connection to close
+		// unless the response is chunked
+		Name:      "android-chunked",
+		UserAgent: regexp.MustCompile(`Android`),
+		Chunked:   true,
+	},
+}
+
+// SetQuirks replaces the client workarounds, checked in order
+func (s *Server) SetQuirks(quirks []Quirk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quirks = quirks
+}
+
+// quirksFor returns the workarounds for a client, all those matching its
+// User-Agent merged into one, and their names
+func (s *Server) quirksFor(userAgent string) (Quirk, []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var merged Quirk
+	var names []string
+	if userAgent == "" {
+		return merged, nil
+	}
+	for _, q := range s.quirks {
+		if q.UserAgent == nil || !q.UserAgent.MatchString(userAgent) {
+			continue
+		}
+		names = append(names, q.Name)
+		merged.Omit = append(merged.Omit, q.Omit...)
+		if merged.Version == 0 {
+			merged.Version = q.Version
+		}
+		merged.Chunked = merged.Chunked || q.Chunked
+		merged.Close = merged.Close || q.Close
+	}
+	return merged, names
+}
+
+// apply rewrites an encoded response for the client, before it is written
+func (q Quirk) apply(operation uint16, response []byte) []byte {
+	if len(q.Omit) > 0 && operation == OpGetPrinterAttributes {
+		response = omitAttributes(response, q.Omit)
+	}
+	if q.Version != 0 && len(response) >= 2 {
+		binary.BigEndian.PutUint16(response, q.Version)
+	}
+	return response
+}
+
+// writeHeader sends the response headers for the client with the HTTP
+// status. Flushing them before the body makes net/http chunk it rather than
+// send a length.
+func (q Quirk) writeHeader(w http.ResponseWriter, status int) {
+	if q.Close {
+		w.Header().Set("Connection", "close")
+	}
+	w.WriteHeader(status)
+	if f, ok := w.(http.Flusher); ok && q.Chunked {
+		f.Flush()
+	}
+}
+
+// omitAttributes returns an encoded response without the named attributes.
+// A response that can't be walked is returned as it is.
+func omitAttributes(response []byte, names []string) []byte {
+	return filterAttributes(response, func(_ byte, name string) bool {
+		return !contains(names, name)
+	})
+}
+
+// filterAttributes returns an encoded response with only the attributes keep
+// accepts, given the group each is in, including their additional values and
+// collection members. A response that can't be walked is returned as it is.
+func filterAttributes(response []byte, keep func(group byte, name string) bool) []byte {
+	if len(response) < 8 {
+		return response
+	}
+	out := append(make([]byte, 0, len(response)), response[:8]...)
+	var group byte
+	skipping := false
+	depth := 0 // Collection nesting of the attribute being walked
+	for i := 8; i < len(response); {
+		tag := response[i]
+		if tag < 0x10 { // Delimiter
+			out = append(out, tag)
+			i++
+			group = tag
+			skipping = false
+			if tag == TagEnd {
+				return append(out, response[i:]...)
+			}
+			continue
+		}
+		if i+3 > len(response) {
+			return response
+		}
+		nameLen := int(binary.BigEndian.Uint16(response[i+1:]))
+		if i+3+nameLen+2 > len(response) {
+			return response
+		}
+		name := string(response[i+3 : i+3+nameLen])
+		valueLen := int(binary.BigEndian.Uint16(response[i+3+nameLen:]))
+		end := i + 3 + nameLen + 2 + valueLen
+		if end > len(response) {
+			return response
+		}
+		if depth == 0 && nameLen > 0 {
+			skipping = !keep(group, name)
+		}
+		switch tag {
+		case TagBegCollection:
+			depth++
+		case TagEndCollection:
+			depth--
+		}
+		if !skipping {
+			out = append(out, response[i:end]...)
+		}
+		i = end
+	}
+	return out
+}
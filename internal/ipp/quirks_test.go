@@ -0,0 +1,120 @@
+package ipp
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServer_QuirksFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      []string
+	}{
+		{"no User-Agent", "", nil},
+		{"current iOS", "iOS/17.2 (21C62) IPPClient/1", nil},
+		{"CUPS 1.x", "CUPS/1.7.2 (Linux 3.13; x86_64) IPP/2.0", []string{"cups-1"}},
+		{"CUPS 2.x", "CUPS/2.4.7 (Linux 6.1; x86_64) IPP/2.0", nil},
+		{"iOS 12", "iOS/12.5.7 (16H81) IPPClient/1", []string{"ios-12"}},
+		{"old Darwin", "Darwin/17.7.0 IPPClient/1", []string{"ios-12"}},
+		{"Android", "Dalvik/2.1.0 (Linux; U; Android 13)", []string{"android-chunked"}},
+		{"several", "CUPS/1.4.0 Darwin/16.1.0", []string{"cups-1", "ios-12"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+			s.SetQuirks(BuiltinQuirks)
+			_, names := s.quirksFor(tt.userAgent)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("quirksFor(%q) = %v, want %v", tt.userAgent, names, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_QuirksMerged(t *testing.T) {
+	s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+	s.SetQuirks([]Quirk{
+		{Name: "first", UserAgent: regexp.MustCompile(`Client`), Omit: []string{"printer-icons"}, Version: 0x0101},
+		{Name: "second", UserAgent: regexp.MustCompile(`Client`), Omit: []string{"printer-geo-location"}, Version: 0x0200, Close: true},
+		{Name: "other", UserAgent: regexp.MustCompile(`Other`), Chunked: true},
+		{Name: "no pattern"},
+	})
+
+	q, names := s.quirksFor("Client/1.0")
+	want := Quirk{Omit: []string{"printer-icons", "printer-geo-location"}, Version: 0x0101, Close: true}
+	if !reflect.DeepEqual(names, []string{"first", "second"}) || !reflect.DeepEqual(q, want) {
+		t.Errorf("quirksFor() = %+v %v, want %+v [first second]", q, names, want)
+	}
+}
+
+func TestQuirk_Apply(t *testing.T) {
+	s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+	printer := PrinterConfig{Name: "Office", GeoLocation: "geo:48.8,2.3"}
+
+	tests := []struct {
+		name        string
+		quirk       Quirk
+		operation   uint16
+		wantVersion uint16
+		wantOmitted []string
+	}{
+		{"none", Quirk{}, OpGetPrinterAttributes, 0x0200, nil},
+		{"version", Quirk{Version: 0x0101}, OpGetPrinterAttributes, 0x0101, nil},
+		{"omit", Quirk{Omit: []string{"printer-geo-location", "printer-name"}}, OpGetPrinterAttributes, 0x0200, []string{"printer-geo-location", "printer-name"}},
+		{"omit only from printer attributes", Quirk{Omit: []string{"printer-name"}}, OpGetJobs, 0x0200, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := s.handleGetPrinterAttributes(1, printer)
+			before := printerAttributeNames(response)
+			for _, name := range tt.wantOmitted {
+				if !contains(before, name) {
+					t.Fatalf("response has no %s to omit", name)
+				}
+			}
+
+			response = tt.quirk.apply(tt.operation, response)
+			if v := binary.BigEndian.Uint16(response); v != tt.wantVersion {
+				t.Errorf("version = %#04x, want %#04x", v, tt.wantVersion)
+			}
+			after := printerAttributeNames(response)
+			for _, name := range before {
+				if omitted := !contains(after, name); omitted != contains(tt.wantOmitted, name) {
+					t.Errorf("%s omitted = %v", name, omitted)
+				}
+			}
+		})
+	}
+}
+
+func TestQuirk_WriteHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		quirk       Quirk
+		wantFlushed bool
+		wantClose   bool
+	}{
+		{"none", Quirk{}, false, false},
+		{"chunked", Quirk{Chunked: true}, true, false},
+		{"close", Quirk{Close: true}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.quirk.writeHeader(w, http.StatusOK)
+			if w.Code != http.StatusOK || w.Flushed != tt.wantFlushed {
+				t.Errorf("status %d flushed %v, want 200 flushed %v", w.Code, w.Flushed, tt.wantFlushed)
+			}
+			if closing := w.Header().Get("Connection") == "close"; closing != tt.wantClose {
+				t.Errorf("Connection: close sent = %v, want %v", closing, tt.wantClose)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package ipp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// sendRaw renders an Apple Raster document to ZPL and sends it straight to
+// the printer's raw port, bypassing CUPS and its filters. The printer says
+// nothing back, so the job is complete once the label data is sent.
+func (s *Server) sendRaw(ctx context.Context, printer PrinterConfig, document io.Reader, spec jobs.Job, options map[string]string) (jobs.Job, error) {
+	log := jobs.TraceLog(ctx, s.log)
+
+	br, ok := document.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(document)
+	}
+	if !raster.IsURF(br) {
+		return jobs.Job{}, fmt.Errorf("raw printer %s only accepts Apple Raster, got %s", printer.Name, spec.DocumentFormat)
+	}
+
+	copies, _ := strconv.Atoi(options["copies"])
+	var stamp *raster.Stamp
+	if printer.Watermark != "" {
+		stamp = raster.NewStamp(watermarkText(printer.Watermark, printer.Name, spec))
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", printer.RawAddr)
+	if err != nil {
+		return jobs.Job{}, fmt.Errorf("failed to connect to printer: %w", err)
+	}
+	defer conn.Close()
+	// Closing the connection stops the conversion if the job is abandoned
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := raster.ConvertURFToZPL(conn, br, copies, stamp); err != nil {
+		return jobs.Job{}, fmt.Errorf("failed to send job to printer: %w", err)
+	}
+
+	spec.Printer = printer.Name
+	spec.State = jobs.StateCompleted
+	spec.StateReasons = []string{"job-completed-successfully"}
+	spec.CreatedAt = time.Now().UTC()
+	spec.CompletedAt = spec.CreatedAt
+	job := s.jobs.Add(spec)
+
+	log.Info().Int("job_id", job.ID).Str("addr", printer.RawAddr).Msg("job sent to raw printer")
+	return job, nil
+}
@@ -0,0 +1,126 @@
+package ipp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// ErrNotHeld is returned when releasing a job that isn't waiting for release
+var ErrNotHeld = errors.New("job is not held")
+
+// ErrUnknownJob is returned for a job that doesn't exist or belongs to
+// another user
+var ErrUnknownJob = errors.New("unknown job")
+
+// JobReleaser releases and moves jobs held in CUPS
+type JobReleaser interface {
+	ReleaseJob(cupsJobID int) error
+	MoveJob(cupsJobID int, printer string) error
+}
+
+// EnableRelease lets held jobs be released with ReleaseJob. Jobs are held
+// for printers with HoldJobs set. It must be called before serving
+// requests.
+func (s *Server) EnableRelease(releaser JobReleaser) {
+	s.releaser = releaser
+}
+
+// holdOptions adds the option that holds a job for release when the
+// printer requires it
+func (s *Server) holdOptions(printer PrinterConfig, options map[string]string) map[string]string {
+	if s.releaser == nil || !printer.HoldJobs {
+		return options
+	}
+	if options == nil {
+		options = make(map[string]string)
+	}
+	options["job-hold-until"] = "indefinite"
+	return options
+}
+
+// HeldJobs returns the jobs of user waiting to be released, or every held
+// job if user is empty
+func (s *Server) HeldJobs(user string) []jobs.Job {
+	var held []jobs.Job
+	for _, j := range s.jobs.List("", "not-completed") {
+		if j.State == jobs.StatePendingHeld && (user == "" || j.User == user) {
+			held = append(held, j)
+		}
+	}
+	return held
+}
+
+// ReleaseJob releases a held job of user. If printer is set and differs
+// from the printer the job was sent to, the job is moved there first, so a
+// job can be picked up at whichever printer the user is standing at.
+func (s *Server) ReleaseJob(id int, user, printer string) error {
+	job, err := s.heldJob(id, user)
+	if err != nil {
+		return err
+	}
+	if printer != "" && printer != job.Printer {
+		if _, ok := s.lookupPrinter(printer); !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownPrinter, printer)
+		}
+		if err := s.releaser.MoveJob(job.CUPSJobID, printer); err != nil {
+			return fmt.Errorf("failed to move job to %s: %w", printer, err)
+		}
+		s.jobs.Move(job.ID, printer)
+	}
+	if err := s.releaser.ReleaseJob(job.CUPSJobID); err != nil {
+		return fmt.Errorf("failed to release job: %w", err)
+	}
+
+	s.jobs.Update(job.ID, jobs.Status{State: jobs.StatePending, StateReasons: []string{"none"}})
+	s.log.Info().Int("job_id", job.ID).Str("trace_id", job.TraceID).Str("user", job.User).Str("printer", printer).Msg("job released")
+	return nil
+}
+
+// CancelHeldJob cancels a held job of user
+func (s *Server) CancelHeldJob(id int, user string) error {
+	job, err := s.heldJob(id, user)
+	if err != nil {
+		return err
+	}
+	return s.cancelHeld(job, "job-canceled-by-user")
+}
+
+// ExpireHeldJobs cancels jobs that have been held longer than maxAge
+func (s *Server) ExpireHeldJobs(maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+	for _, job := range s.HeldJobs("") {
+		if job.CreatedAt.Before(cutoff) {
+			if err := s.cancelHeld(job, "job-canceled-at-device"); err != nil {
+				s.log.Warn().Err(err).Int("job_id", job.ID).Str("trace_id", job.TraceID).Msg("failed to cancel expired held job")
+				continue
+			}
+			s.log.Info().Int("job_id", job.ID).Str("trace_id", job.TraceID).Str("user", job.User).Msg("cancelled held job that was never released")
+		}
+	}
+}
+
+// heldJob returns a held job, checking it belongs to user
+func (s *Server) heldJob(id int, user string) (jobs.Job, error) {
+	if s.releaser == nil {
+		return jobs.Job{}, ErrNotHeld
+	}
+	job, ok := s.jobs.Get(id)
+	if !ok || job.User != user {
+		return jobs.Job{}, fmt.Errorf("%w: %d", ErrUnknownJob, id)
+	}
+	if job.State != jobs.StatePendingHeld {
+		return jobs.Job{}, ErrNotHeld
+	}
+	return job, nil
+}
+
+func (s *Server) cancelHeld(job jobs.Job, reason string) error {
+	if err := s.cupsClient.CancelJob(job.CUPSJobID); err != nil {
+		return fmt.Errorf("failed to cancel job: %w", err)
+	}
+	s.jobs.Update(job.ID, jobs.Status{State: jobs.StateCanceled, StateReasons: []string{reason}})
+	return nil
+}
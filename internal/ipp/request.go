@@ -0,0 +1,239 @@
+package ipp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Collection syntax tags
+const (
+	TagBegCollection  = 0x34
+	TagEndCollection  = 0x37
+	TagMemberAttrName = 0x4a
+)
+
+// Request is a parsed IPP request. The document data, if any, follows the
+// attributes in the stream the request was read from.
+type Request struct {
+	Version   uint16
+	Operation uint16
+	RequestID uint32
+
+	OperationAttrs map[string]*Attribute
+	JobAttrs       map[string]*Attribute
+}
+
+// Attribute is a decoded IPP attribute with all of its values
+type Attribute struct {
+	Name   string
+	Values []Value
+}
+
+// Value is a single attribute value. Collection values carry their members.
+type Value struct {
+	Tag        byte
+	Data       []byte
+	Collection map[string]*Attribute
+}
+
+// ReadRequest parses the IPP header and attribute groups from r, leaving r
+// positioned at the start of the document data
+func ReadRequest(r io.Reader) (*Request, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read IPP header: %w", err)
+	}
+
+	req := &Request{
+		Version:        binary.BigEndian.Uint16(header[0:2]),
+		Operation:      binary.BigEndian.Uint16(header[2:4]),
+		RequestID:      binary.BigEndian.Uint32(header[4:8]),
+		OperationAttrs: make(map[string]*Attribute),
+		JobAttrs:       make(map[string]*Attribute),
+	}
+
+	var group map[string]*Attribute
+	var last *Attribute
+	for {
+		tag, err := readByte(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attribute tag: %w", err)
+		}
+
+		// Delimiter tags start a new group or end the attributes
+		if tag < 0x10 {
+			switch tag {
+			case TagEnd:
+				return req, nil
+			case TagOperationAttrs:
+				group = req.OperationAttrs
+			case TagJobAttrs:
+				group = req.JobAttrs
+			default:
+				// Other groups (printer, unsupported) are parsed and discarded
+				group = make(map[string]*Attribute)
+			}
+			last = nil
+			continue
+		}
+
+		if group == nil {
+			return nil, fmt.Errorf("attribute outside of a group")
+		}
+
+		name, value, err := readValue(r, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "" {
+			// Additional value of the previous attribute
+			if last == nil {
+				return nil, fmt.Errorf("additional value without attribute")
+			}
+			last.Values = append(last.Values, value)
+			continue
+		}
+
+		last = &Attribute{Name: name, Values: []Value{value}}
+		group[name] = last
+	}
+}
+
+// readValue reads one name/value pair for the given value tag, including the
+// members of a collection
+func readValue(r io.Reader, tag byte) (string, Value, error) {
+	name, err := readString(r)
+	if err != nil {
+		return "", Value{}, fmt.Errorf("failed to read attribute name: %w", err)
+	}
+	data, err := readString(r)
+	if err != nil {
+		return "", Value{}, fmt.Errorf("failed to read value of %q: %w", name, err)
+	}
+
+	value := Value{Tag: tag, Data: []byte(data)}
+	if tag == TagBegCollection {
+		members, err := readCollection(r)
+		if err != nil {
+			return "", Value{}, fmt.Errorf("failed to read collection %q: %w", name, err)
+		}
+		value.Collection = members
+	}
+
+	return name, value, nil
+}
+
+// readCollection reads member attributes up to the matching endCollection
+func readCollection(r io.Reader) (map[string]*Attribute, error) {
+	members := make(map[string]*Attribute)
+	var last *Attribute
+	for {
+		tag, err := readByte(r)
+		if err != nil {
+			return nil, err
+		}
+
+		_, value, err := readValue(r, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case TagEndCollection:
+			return members, nil
+		case TagMemberAttrName:
+			last = &Attribute{Name: string(value.Data)}
+			members[last.Name] = last
+		default:
+			if last == nil {
+				return nil, fmt.Errorf("collection value without member name")
+			}
+			last.Values = append(last.Values, value)
+		}
+	}
+}
+
+func readByte(r io.Reader) (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func readString(r io.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// String returns the first value of an attribute as a string
+func (a *Attribute) String() string {
+	if a == nil || len(a.Values) == 0 {
+		return ""
+	}
+	return string(a.Values[0].Data)
+}
+
+// Strings returns all values of an attribute as strings
+func (a *Attribute) Strings() []string {
+	if a == nil {
+		return nil
+	}
+	values := make([]string, len(a.Values))
+	for i, v := range a.Values {
+		values[i] = string(v.Data)
+	}
+	return values
+}
+
+// Int returns the first value of an integer or enum attribute
+func (a *Attribute) Int() (int, bool) {
+	if a == nil || len(a.Values) == 0 || len(a.Values[0].Data) != 4 {
+		return 0, false
+	}
+	return int(int32(binary.BigEndian.Uint32(a.Values[0].Data))), true
+}
+
+// Bool returns the first value of a boolean attribute
+func (a *Attribute) Bool() (bool, bool) {
+	if a == nil || len(a.Values) == 0 || len(a.Values[0].Data) != 1 {
+		return false, false
+	}
+	return a.Values[0].Data[0] != 0, true
+}
+
+// OpAttr returns a named operation attribute, or nil
+func (r *Request) OpAttr(name string) *Attribute {
+	return r.OperationAttrs[name]
+}
+
+// JobAttr returns a named job template attribute, or nil
+func (r *Request) JobAttr(name string) *Attribute {
+	return r.JobAttrs[name]
+}
+
+// JobID returns the job targeted by the request, from job-id or job-uri
+func (r *Request) JobID() (int, bool) {
+	if id, ok := r.OpAttr("job-id").Int(); ok {
+		return id, true
+	}
+
+	// job-uri ends in /jobs/<id>
+	uri := r.OpAttr("job-uri").String()
+	id, err := strconv.Atoi(uri[strings.LastIndex(uri, "/")+1:])
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,91 @@
+package ipp
+
+import "strings"
+
+// jobTemplateAttributes are the printer attributes describing job template
+// values, returned for the "job-template" group. Everything else a printer
+// answers with belongs to "printer-description".
+var jobTemplateAttributes = []string{
+	"copies",
+	"finishings",
+	"job-hold-until",
+	"job-priority",
+	"job-sheets",
+	"media",
+	"media-col",
+	"multiple-document-handling",
+	"number-up",
+	"orientation-requested",
+	"output-bin",
+	"page-ranges",
+	"print-color-mode",
+	"print-quality",
+	"print-scaling",
+	"printer-resolution",
+	"sides",
+}
+
+// jobTemplateExtras are job template printer attributes not named after a
+// job template attribute with -default or -supported
+var jobTemplateExtras = []string{
+	"media-ready",
+	"media-col-ready",
+	"media-col-database",
+	"media-bottom-margin-supported",
+	"media-left-margin-supported",
+	"media-right-margin-supported",
+	"media-top-margin-supported",
+	"media-source-supported",
+}
+
+// isJobTemplate reports whether a printer attribute is in the "job-template"
+// group
+func isJobTemplate(name string) bool {
+	if contains(jobTemplateExtras, name) {
+		return true
+	}
+	for _, suffix := range []string{"-default", "-supported"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok && contains(jobTemplateAttributes, base) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedFilter returns whether a printer attribute was asked for by a
+// requested-attributes operation attribute, or nil when everything was:
+// the attribute is missing or names "all". Names may be attribute names or
+// the groups "printer-description" and "job-template"; unknown ones are
+// ignored, as RFC 8011 allows.
+func requestedFilter(requested []string) func(name string) bool {
+	if len(requested) == 0 || contains(requested, "all") {
+		return nil
+	}
+	description := contains(requested, "printer-description")
+	template := contains(requested, "job-template")
+	if description && template {
+		return nil
+	}
+	return func(name string) bool {
+		if contains(requested, name) {
+			return true
+		}
+		if isJobTemplate(name) {
+			return template
+		}
+		return description
+	}
+}
+
+// filterRequested returns an encoded Get-Printer-Attributes response with
+// only the printer attributes the request asked for. Clients that ask for a
+// few attributes get a few, instead of the whole printer.
+func filterRequested(response []byte, req *Request) []byte {
+	keep := requestedFilter(req.OpAttr("requested-attributes").Strings())
+	if keep == nil {
+		return response
+	}
+	return filterAttributes(response, func(group byte, name string) bool {
+		return group != TagPrinterAttrs || keep(name)
+	})
+}
@@ -0,0 +1,104 @@
+package ipp
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// printerAttributeNames returns the names of the printer attributes in an
+// encoded response
+func printerAttributeNames(response []byte) []string {
+	var names []string
+	filterAttributes(response, func(group byte, name string) bool {
+		if group == TagPrinterAttrs {
+			names = append(names, name)
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
+func TestFilterRequested(t *testing.T) {
+	s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+	response := s.handleGetPrinterAttributes(1, PrinterConfig{Name: "Office", Color: true, Duplex: true})
+	all := printerAttributeNames(response)
+	if !contains(all, "printer-name") || !contains(all, "sides-supported") {
+		t.Fatalf("response has neither group's attributes: %v", all)
+	}
+
+	tests := []struct {
+		name      string
+		requested []string // nil when the request doesn't have the attribute
+		want      func(name string) bool
+	}{
+		{"not requested", nil, func(string) bool { return true }},
+		{"all", []string{"all"}, func(string) bool { return true }},
+		{"all among others", []string{"printer-name", "all"}, func(string) bool { return true }},
+		{"names", []string{"printer-name", "sides-supported"}, func(name string) bool {
+			return name == "printer-name" || name == "sides-supported"
+		}},
+		{"unknown name", []string{"no-such-attribute"}, func(string) bool { return false }},
+		{"job-template", []string{"job-template"}, isJobTemplate},
+		{"printer-description", []string{"printer-description"}, func(name string) bool { return !isJobTemplate(name) }},
+		{"both groups", []string{"printer-description", "job-template"}, func(string) bool { return true }},
+		{"group and name", []string{"job-template", "printer-name"}, func(name string) bool {
+			return name == "printer-name" || isJobTemplate(name)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &Request{Operation: OpGetPrinterAttributes, OperationAttrs: make(map[string]*Attribute)}
+			if tt.requested != nil {
+				attr := &Attribute{Name: "requested-attributes"}
+				for _, name := range tt.requested {
+					attr.Values = append(attr.Values, Value{Tag: TagKeyword, Data: []byte(name)})
+				}
+				req.OperationAttrs[attr.Name] = attr
+			}
+
+			filtered := filterRequested(response, req)
+			got := printerAttributeNames(filtered)
+			var want []string
+			for _, name := range all {
+				if tt.want(name) {
+					want = append(want, name)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("printer attributes = %v, want %v", got, want)
+			}
+			if _, err := ReadRequest(bytes.NewReader(filtered)); err != nil {
+				t.Errorf("filtered response can't be read: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsJobTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"sides-supported", true},
+		{"sides-default", true},
+		{"media-col-database", true},
+		{"media-ready", true},
+		{"printer-resolution-supported", true},
+		{"sides", false},
+		{"printer-name", false},
+		{"document-format-supported", false},
+		{"printer-state", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isJobTemplate(tt.name); got != tt.want {
+				t.Errorf("isJobTemplate(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
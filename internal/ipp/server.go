@@ -1,33 +1,59 @@
 package ipp
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"strings"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/airprint"
+	"github.com/WaffleThief123/airprint-bridge/internal/audit"
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/identify"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
 )
 
 // IPP operation codes
 const (
-	OpPrintJob            = 0x0002
-	OpValidateJob         = 0x0004
-	OpGetJobAttributes    = 0x0009
-	OpGetJobs             = 0x000a
+	OpPrintJob             = 0x0002
+	OpValidateJob          = 0x0004
+	OpGetJobAttributes     = 0x0009
+	OpGetJobs              = 0x000a
 	OpGetPrinterAttributes = 0x000b
-	OpCancelJob           = 0x0008
+	OpCancelJob            = 0x0008
+	OpIdentifyPrinter      = 0x003c
 )
 
 // IPP status codes
 const (
-	StatusOK                    = 0x0000
-	StatusOKIgnoredOrSubstituted = 0x0001
-	StatusClientErrorBadRequest = 0x0400
-	StatusClientErrorNotFound   = 0x0406
-	StatusServerErrorInternalError = 0x0500
+	StatusOK                               = 0x0000
+	StatusOKIgnoredOrSubstituted           = 0x0001
+	StatusClientErrorBadRequest            = 0x0400
+	StatusClientErrorNotPossible           = 0x0404
+	StatusClientErrorNotFound              = 0x0406
+	StatusServerErrorInternalError         = 0x0500
+	StatusServerErrorOperationNotSupported = 0x0501
+	StatusServerErrorServiceUnavailable    = 0x0502
+	StatusServerErrorNotAccepting          = 0x0506
+)
+
+// printer-state values
+const (
+	stateProcessing = 4
+	stateStopped    = 5
 )
 
 // IPP attribute tags
@@ -40,6 +66,7 @@ const (
 	TagInteger          = 0x21
 	TagBoolean          = 0x22
 	TagEnum             = 0x23
+	TagResolution       = 0x32
 	TagTextWithoutLang  = 0x41
 	TagNameWithoutLang  = 0x42
 	TagKeyword          = 0x44
@@ -52,54 +79,337 @@ const (
 
 // Server is an IPP proxy server
 type Server struct {
-	listenAddr  string
-	cupsClient  CUPSClient
-	printerName string
-	printerURI  string
-	printer     PrinterConfig
-	log         zerolog.Logger
+	listenAddr string
+	cupsClient CUPSClient
+	jobs       *jobs.Tracker
+	tls        *TLSConfig
+	host       atomic.Pointer[string] // Host printer URIs name, nil for cups.local
+	log        zerolog.Logger
+
+	mu             sync.RWMutex
+	printers       map[string]PrinterConfig // keyed by printer name
+	defaultPrinter string                   // served for requests to "/"
+	maintenance    map[string]string        // printer name -> status message
+	upstreamDown   map[string]bool          // Printers whose CUPS can't be reached
+	live           *liveStatus              // nil to report printer state as of the last poll
+	transforms     map[string]Transforms    // printer name -> transforms set at runtime
+	configured     map[string]Transforms    // printer name -> transforms from the config
+	onDenied       func(printer, user, traceID string, d Denial)
+	authenticate   func(user, password string) (ok, guest bool)
+	access         func(printer, user string, guest bool) (bool, error)
+	releaser       JobReleaser   // nil unless held jobs can be released
+	archive        *jobs.Archive // nil unless printed documents are kept
+	submitTimeout  time.Duration // Limit on forwarding one job to CUPS, 0 for none
+	traceJobNames  bool          // Append the trace ID to job names sent to CUPS
+	limits         ClientLimits
+	build          BuildInfo
+	conns          connTracker
+	quirks         []Quirk    // Client workarounds, see SetQuirks
+	audit          *audit.Log // nil unless print events are audited
+
+	allowedNetworks []*net.IPNet // Clients the listeners serve, nil for any
+	jobLimits       JobLimits    // Caps on Print-Job operations in progress
+	slots           jobSlots
+
+	statsMu sync.Mutex
+	stats   map[string]*printerStats // printer name -> its jobs' stats
+
+	listenFunc  func(addr string) (net.Listener, error) // Opens listeners, nil for net.Listen
+	portsMu     sync.Mutex
+	serving     bool               // Listen has been called
+	ln, tlsLn   net.Listener       // Opened by Listen
+	servers     []*http.Server     // Serving ln and tlsLn
+	portServers map[int]portServer // Listeners of printers with their own port
 }
 
+// TLSConfig holds settings for the IPPS (IPP over TLS) listener
+type TLSConfig struct {
+	ListenAddr       string
+	Certificate      tls.Certificate // Served to every client
+	MinVersion       uint16          // Oldest TLS version accepted, 0 for TLS 1.2
+	CipherSuites     []uint16        // TLS 1.2 suites in order of preference, nil for Go's defaults
+	NoSessionTickets bool            // Make every connection do a full handshake
+	SessionKeyFile   string          // Where session ticket keys are kept across restarts, empty to keep them in memory
+}
+
+// ErrUnknownPrinter is returned when a job targets a printer that isn't served
+var ErrUnknownPrinter = errors.New("unknown printer")
+
+// ErrMaintenance is returned when a job targets a printer in maintenance mode
+var ErrMaintenance = errors.New("printer in maintenance mode")
+
 // CUPSClient interface for forwarding jobs
 type CUPSClient interface {
-	PrintJob(printerName string, document io.Reader, jobName string, options map[string]string) (int, error)
-	GetJobAttributes(jobID int) (map[string]interface{}, error)
+	PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error)
+	JobStatus(jobID int) (jobs.Status, error)
 	CancelJob(jobID int) error
 }
 
 // PrinterConfig holds printer information for advertising
 type PrinterConfig struct {
-	Name           string
-	MakeModel      string
-	Location       string
-	Color          bool
-	Duplex         bool
-	Resolutions    []int
-	MediaSupported []string
-	MediaReady     []string
-	MediaDefault   string
+	Name              string // CUPS queue name, also used in printer URIs
+	DisplayName       string // Name shown to clients, empty to use Name
+	MakeModel         string
+	Location          string
+	Info              string
+	Color             bool
+	Duplex            bool
+	Resolutions       []int
+	DefaultResolution int // 0 picks one of Resolutions
+	MediaSupported    []string
+	MediaReady        []string
+	MediaDefault      string
+	MediaSources      []string   // Trays clients may choose, empty if CUPS reports none
+	MediaDatabase     []MediaCol // Dimensions of MediaSupported
+	MediaColReady     []MediaCol // Media loaded in each tray
+	MediaProfile      string     // Profile MediaSupported comes from, empty for CUPS's own media
+	URFConversion     string     // Format to convert image/urf jobs to, empty to forward as-is
+	FormatFallback    []string   // Formats to retry image/urf jobs in when CUPS rejects the format
+	Watermark         string     // Text stamped on every page, empty to disable
+	Formats           []string   // Document formats in order of preference, first is the default
+	URF               airprint.URFOverride
+	RelayAuth         bool // Pass the client's Basic-auth credentials on to CUPS
+	Scaling           Scaling
+	HoldJobs          bool            // Hold jobs until released from the web UI or a kiosk
+	MaxQueued         int             // Refuse jobs while this many are waiting or printing, 0 for no limit
+	Identify          identify.Device // Performs Identify-Printer, nil if the printer can't be identified
+	Port              int             // Dedicated port the printer is also served on, 0 for the main one only
+	UUID              string          // Stable UUID, also in the printer's UUID TXT record
+	IconFile          string          // PNG served as the printer's icon, empty for the client's generic one
+	GeoLocation       string          // geo: URI of where the printer is, empty if unknown
+	RawAddr           string          // host:port jobs are sent to as ZPL instead of CUPS, empty to use CUPS
+	RasterOnly        bool            // Only take Apple Raster, for printers fed by the bridge's converter without CUPS's filters
+	Features          []string        // Experimental behaviors enabled, see Features
+	State             int             // printer-state in CUPS: 3 idle, 4 processing, 5 stopped; 0 if unknown
+	StateReasons      []string        // printer-state-reasons in CUPS, nil for none
+	StateMessage      string          // printer-state-message in CUPS
+	NotAccepting      bool            // CUPS refuses jobs for the queue
+	QueuedJobs        int             // Jobs waiting or printing in CUPS
+	LiveQueue         string          // CUPS queue whose current state is reported, empty to report the last poll's
+}
+
+// displayName returns the name clients see for the printer
+func (p PrinterConfig) displayName() string {
+	if p.DisplayName != "" {
+		return p.DisplayName
+	}
+	return p.Name
+}
+
+// DocumentFormats returns the formats the printer accepts, most preferred
+// first. Watermarks and raw ZPL are drawn by the rasterizer, so those
+// printers only take Apple Raster and clients render everything else to it.
+func (p PrinterConfig) DocumentFormats() []string {
+	if p.Watermark != "" || p.RawAddr != "" || p.RasterOnly {
+		return []string{raster.FormatURF}
+	}
+	return airprint.OrderFormats(p.Formats)
 }
 
 // NewServer creates a new IPP server
-func NewServer(listenAddr string, cupsClient CUPSClient, printer PrinterConfig, log zerolog.Logger) *Server {
+func NewServer(listenAddr string, cupsClient CUPSClient, tracker *jobs.Tracker, log zerolog.Logger) *Server {
 	return &Server{
 		listenAddr:  listenAddr,
 		cupsClient:  cupsClient,
-		printerName: printer.Name,
-		printerURI:  fmt.Sprintf("ipp://cups.local:%s/printers/%s", strings.Split(listenAddr, ":")[1], printer.Name),
-		printer:     printer,
+		jobs:        tracker,
+		printers:    make(map[string]PrinterConfig),
+		maintenance: make(map[string]string),
+		transforms:  make(map[string]Transforms),
+		configured:  make(map[string]Transforms),
+		portServers: make(map[int]portServer),
 		log:         log.With().Str("component", "ipp-server").Logger(),
 	}
 }
 
-// ListenAndServe starts the IPP server
+// SetPrinters replaces the set of printers served, e.g. after a CUPS sync.
+// The first printer is used for requests that don't name a printer.
+func (s *Server) SetPrinters(printers []PrinterConfig) {
+	byName := make(map[string]PrinterConfig, len(printers))
+	configured := make(map[string]Transforms, len(printers))
+	s.mu.Lock()
+	for _, p := range printers {
+		configured[p.Name] = p.transforms()
+		if t, ok := s.transforms[p.Name]; ok {
+			p = p.withTransforms(t)
+		}
+		byName[p.Name] = p
+	}
+	s.printers = byName
+	s.configured = configured
+	s.defaultPrinter = ""
+	if len(printers) > 0 {
+		s.defaultPrinter = printers[0].Name
+	}
+	s.mu.Unlock()
+
+	s.syncPorts()
+}
+
+// lookupPrinter returns the config for a printer, or the default printer when
+// name is empty. Renamed printers are also found by their display name.
+func (s *Server) lookupPrinter(name string) (PrinterConfig, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name == "" {
+		name = s.defaultPrinter
+	}
+	if p, ok := s.printers[name]; ok {
+		return p, true
+	}
+	for _, p := range s.printers {
+		if p.DisplayName != "" && p.DisplayName == name {
+			return p, true
+		}
+	}
+	return PrinterConfig{}, false
+}
+
+// printerURI returns the ipp:// URI advertised for a printer, on the same
+// port as its mDNS service
+func (s *Server) printerURI(name string) string {
+	return fmt.Sprintf("ipp://%s/%s", net.JoinHostPort(s.uriHost(), s.printerPort(name)), airprint.ResourcePath(name))
+}
+
+// SetHost sets the host printer URIs name, e.g. the address clients reach
+// the bridge at. It may be called while serving, when the address changes.
+func (s *Server) SetHost(host string) {
+	s.host.Store(&host)
+}
+
+// uriHost returns the host printer URIs name
+func (s *Server) uriHost() string {
+	if host := s.host.Load(); host != nil && *host != "" {
+		return *host
+	}
+	return "cups.local"
+}
+
+// EnableTLS configures an IPPS listener alongside the plain IPP one.
+// It must be called before Listen and before serving requests,
+// since the advertised printer URIs depend on it.
+func (s *Server) EnableTLS(cfg TLSConfig) {
+	s.tls = &cfg
+}
+
+// SetListenFunc sets how TCP listeners are opened, e.g. to take over the
+// sockets of a process being replaced. It must be called before Listen.
+func (s *Server) SetListenFunc(fn func(addr string) (net.Listener, error)) {
+	s.listenFunc = fn
+}
+
+// Listen opens the IPP listener, the IPPS one if TLS is enabled and those of
+// printers with their own port, so a port that can't be bound fails startup
+// rather than a background goroutine. ListenAndServe and ListenAndServeTLS
+// call it if it hasn't been.
+func (s *Server) Listen() error {
+	s.portsMu.Lock()
+	if s.ln == nil {
+		ln, err := s.listen(s.listenAddr)
+		if err != nil {
+			s.portsMu.Unlock()
+			return err
+		}
+		s.ln = ln
+	}
+	if s.tls != nil && s.tlsLn == nil {
+		ln, err := s.listen(s.tls.ListenAddr)
+		if err != nil {
+			s.portsMu.Unlock()
+			return err
+		}
+		s.tlsLn = ln
+	}
+	s.serving = true
+	s.portsMu.Unlock()
+
+	s.syncPorts()
+	return nil
+}
+
+// ListenAndServe starts the IPP server. It returns nil after Shutdown.
 func (s *Server) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	s.log.Info().Str("addr", s.listenAddr).Msg("starting IPP server")
+
+	srv := s.httpServer(s.handler())
+	s.portsMu.Lock()
+	ln := s.ln
+	s.servers = append(s.servers, srv)
+	s.portsMu.Unlock()
+	if err := srv.Serve(ln); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// ListenAndServeTLS starts the IPPS server configured with EnableTLS
+func (s *Server) ListenAndServeTLS() error {
+	if s.tls == nil {
+		return fmt.Errorf("TLS is not configured")
+	}
+	if err := s.Listen(); err != nil {
+		return err
+	}
+
+	srv := s.httpServer(s.handler())
+	srv.Addr = s.tls.ListenAddr
+	srv.TLSConfig = s.serverTLSConfig()
+	srv.TLSConfig.Certificates = []tls.Certificate{s.tls.Certificate}
+	s.portsMu.Lock()
+	ln := s.tlsLn
+	s.servers = append(s.servers, srv)
+	s.portsMu.Unlock()
+
+	s.log.Info().Str("addr", s.tls.ListenAddr).Msg("starting IPPS server")
+	if err := srv.ServeTLS(ln, "", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections on every listener and waits for
+// requests in progress, such as job uploads, until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.portsMu.Lock()
+	s.serving = false
+	servers := append([]*http.Server{}, s.servers...)
+	for port, ps := range s.portServers {
+		servers = append(servers, ps.srv)
+		delete(s.portServers, port)
+	}
+	s.portsMu.Unlock()
+
+	var firstErr error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// handler serves every printer on one port, each at its own resource path
+func (s *Server) handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleRoot)
-	mux.HandleFunc("/printers/", s.handlePrinter)
+	mux.HandleFunc("/"+airprint.ResourcePrefix, s.handlePrinter)
+	mux.HandleFunc(iconPrefix, s.handleIcon)
+	return mux
+}
 
-	s.log.Info().Str("addr", s.listenAddr).Msg("starting IPP server")
-	return http.ListenAndServe(s.listenAddr, mux)
+// securePrinterURI returns the ipps:// URI for a printer, or "" when TLS is disabled
+func (s *Server) securePrinterURI(name string) string {
+	if s.tls == nil {
+		return ""
+	}
+	_, port, err := net.SplitHostPort(s.tls.ListenAddr)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("ipps://%s/%s", net.JoinHostPort(s.uriHost(), port), airprint.ResourcePath(name))
 }
 
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -112,10 +422,7 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handlePrinter(w http.ResponseWriter, r *http.Request) {
-	// Extract printer name from path /printers/<name>
-	path := strings.TrimPrefix(r.URL.Path, "/printers/")
-	printerName := strings.Split(path, "/")[0]
-	s.handleIPP(w, r, printerName)
+	s.handleIPP(w, r, airprint.PrinterFromPath(r.URL.Path))
 }
 
 func (s *Server) handleIPP(w http.ResponseWriter, r *http.Request, printerName string) {
@@ -124,58 +431,146 @@ func (s *Server) handleIPP(w http.ResponseWriter, r *http.Request, printerName s
 		return
 	}
 
-	// Read the IPP request
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		s.log.Error().Err(err).Msg("failed to read request body")
-		http.Error(w, "Bad request", http.StatusBadRequest)
+	if max := s.limits.MaxRequestSize; max > 0 && r.ContentLength > max {
+		s.log.Warn().Int64("size", r.ContentLength).Int64("limit", max).Str("remote", r.RemoteAddr).Msg("refused IPP request, too large")
+		http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
 		return
 	}
 
-	if len(body) < 8 {
-		s.log.Error().Msg("request too short")
+	// Parse IPP header and attributes. The document is left in the body and
+	// streamed to CUPS as it arrives rather than held in memory. The first
+	// read sends 100 Continue to clients that asked for it, so requests
+	// refused above never upload their document; chunked bodies are decoded
+	// as they are read, with no need for a Content-Length.
+	upload := s.newUpload(w, r)
+	bodyReader := bufio.NewReader(upload)
+	req, err := ReadRequest(bodyReader)
+	if upload.tooLarge() {
+		s.log.Warn().Err(upload.err).Str("remote", r.RemoteAddr).Msg("aborted IPP request")
+		http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if upload.err != nil {
+		s.log.Warn().Err(upload.err).Str("remote", r.RemoteAddr).Msg("aborted IPP request")
+		http.Error(w, "Request timeout", http.StatusRequestTimeout)
+		return
+	}
+	if err != nil {
+		s.log.Error().Err(err).Msg("malformed IPP request")
 		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	// Parse IPP header
-	version := binary.BigEndian.Uint16(body[0:2])
-	operation := binary.BigEndian.Uint16(body[2:4])
-	requestID := binary.BigEndian.Uint32(body[4:8])
+	// Clients posting to "/" may still name the printer in printer-uri
+	if printerName == "" {
+		if u, err := url.Parse(req.OpAttr("printer-uri").String()); err == nil {
+			printerName = airprint.PrinterFromPath(u.Path)
+		}
+	}
 
+	s.countOperation(r.Context(), operationName(req.Operation))
+	if s.audited(req.Operation) {
+		aw, ar, rec := s.startAudit(w, r, req, printerName)
+		w, r = aw, ar
+		defer s.finishAudit(aw, req, rec)
+	}
 	s.log.Debug().
-		Uint16("version", version).
-		Uint16("operation", operation).
-		Uint32("request_id", requestID).
+		Uint16("version", req.Version).
+		Uint16("operation", req.Operation).
+		Uint32("request_id", req.RequestID).
 		Str("printer", printerName).
 		Msg("received IPP request")
 
+	printer, ok := s.lookupPrinter(printerName)
+	if !ok {
+		s.log.Warn().Str("printer", printerName).Msg("request for unknown printer")
+		w.Header().Set("Content-Type", "application/ipp")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(s.buildErrorResponse(req.RequestID, StatusClientErrorNotFound))
+		return
+	}
+
+	if s.authRequired(req.Operation) {
+		user, guest, ok := s.authorize(w, r, req)
+		if !ok {
+			return
+		}
+		if (req.Operation == OpPrintJob || req.Operation == OpValidateJob) && !s.allowed(printer, user, guest) {
+			s.forbidden(w, req, printer, user)
+			return
+		}
+	}
+	ctx := r.Context()
+	if printer.RelayAuth && (req.Operation == OpPrintJob || req.Operation == OpValidateJob) {
+		if ctx, ok = s.relayCredentials(w, r, req); !ok {
+			return
+		}
+	}
+
+	if (req.Operation == OpPrintJob || req.Operation == OpValidateJob) && s.queueFull(printer) {
+		s.log.Warn().Str("printer", printer.Name).Int("max_queued", printer.MaxQueued).Msg("refusing job, queue full")
+		s.busy(w, req, busyRetryAfter, "Printer queue is full, try again later")
+		return
+	}
+	if req.Operation == OpPrintJob {
+		release, ok := s.acquireJobSlot(r.RemoteAddr)
+		if !ok {
+			s.log.Warn().Str("printer", printer.Name).Str("remote", r.RemoteAddr).Msg("refusing job, too many being sent at once")
+			s.busy(w, req, slotRetryAfter, "Too many jobs are being sent, try again shortly")
+			return
+		}
+		defer release()
+	}
+
+	var response []byte
+	if status, message := s.strictValidate(req, printer); status != StatusOK {
+		response = s.buildErrorResponseMessage(req.RequestID, status, message)
+	} else {
+		response = s.handleOperation(ctx, req, printer, bodyReader, upload)
+	}
+	printer.setVersion(response)
+
+	quirk, names := s.quirksFor(r.UserAgent())
+	if len(names) > 0 {
+		s.log.Debug().Strs("quirks", names).Str("user_agent", r.UserAgent()).Msg("applying client quirks")
+		response = quirk.apply(req.Operation, response)
+	}
+	status := http.StatusOK
+	if upload.tooLarge() {
+		status = http.StatusRequestEntityTooLarge
+	}
+	w.Header().Set("Content-Type", "application/ipp")
+	quirk.writeHeader(w, status)
+	_, _ = w.Write(response)
+}
+
+// handleOperation runs a request's operation and returns the response
+func (s *Server) handleOperation(ctx context.Context, req *Request, printer PrinterConfig, bodyReader io.Reader, upload *upload) []byte {
 	var response []byte
-	switch operation {
+	switch req.Operation {
 	case OpGetPrinterAttributes:
-		response = s.handleGetPrinterAttributes(requestID, printerName)
+		response = s.handleGetPrinterAttributes(req.RequestID, s.withLiveStatus(ctx, printer))
+		response = filterRequested(response, req)
 	case OpPrintJob:
-		response = s.handlePrintJob(requestID, printerName, body)
+		response = s.handlePrintJob(ctx, req, printer, bodyReader, upload)
 	case OpValidateJob:
-		response = s.handleValidateJob(requestID)
+		response = s.handleValidateJob(req.RequestID, printer)
 	case OpGetJobs:
-		response = s.handleGetJobs(requestID)
+		response = s.handleGetJobs(req, printer)
 	case OpGetJobAttributes:
-		response = s.handleGetJobAttributes(requestID, body)
+		response = s.handleGetJobAttributes(req, printer)
 	case OpCancelJob:
-		response = s.handleCancelJob(requestID, body)
+		response = s.handleCancelJob(req, printer)
+	case OpIdentifyPrinter:
+		response = s.handleIdentifyPrinter(ctx, req, printer)
 	default:
-		s.log.Warn().Uint16("operation", operation).Msg("unsupported operation")
-		response = s.buildErrorResponse(requestID, StatusClientErrorBadRequest)
+		response = s.unsupportedOperation(req, printer)
 	}
-
-	w.Header().Set("Content-Type", "application/ipp")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(response)
+	return response
 }
 
-func (s *Server) handleGetPrinterAttributes(requestID uint32, printerName string) []byte {
-	s.log.Debug().Str("printer", printerName).Msg("handling Get-Printer-Attributes")
+func (s *Server) handleGetPrinterAttributes(requestID uint32, printer PrinterConfig) []byte {
+	s.log.Debug().Str("printer", printer.Name).Msg("handling Get-Printer-Attributes")
 
 	buf := &bytes.Buffer{}
 
@@ -193,51 +588,126 @@ func (s *Server) handleGetPrinterAttributes(requestID uint32, printerName string
 	_ = buf.WriteByte(TagPrinterAttrs)
 
 	// Required AirPrint attributes
-	s.writeAttribute(buf, TagURI, "printer-uri-supported", s.printerURI)
+	s.writeAttribute(buf, TagURI, "printer-uri-supported", s.printerURI(printer.Name))
+	if secureURI := s.securePrinterURI(printer.Name); secureURI != "" {
+		s.writeAttributeMulti(buf, TagURI, "printer-uri-supported", []string{secureURI})
+	}
 	s.writeAttribute(buf, TagKeyword, "uri-security-supported", "none")
-	s.writeAttribute(buf, TagKeyword, "uri-authentication-supported", "none")
-	s.writeAttribute(buf, TagNameWithoutLang, "printer-name", s.printerName)
-	s.writeAttribute(buf, TagEnum, "printer-state", int32(3)) // idle
-	s.writeAttribute(buf, TagKeyword, "printer-state-reasons", "none")
-	s.writeAttribute(buf, TagKeyword, "ipp-versions-supported", "2.0")
-	s.writeAttribute(buf, TagKeyword, "operations-supported", "") // We'll add these specially
-	s.writeOperationsSupported(buf)
-
-	s.writeAttribute(buf, TagMimeMediaType, "document-format-supported", "image/urf")
-	s.writeAttributeMulti(buf, TagMimeMediaType, "document-format-supported", []string{
-		"application/pdf",
-		"image/jpeg",
-		"image/png",
-	})
-	s.writeAttribute(buf, TagMimeMediaType, "document-format-default", "image/urf")
+	if s.tls != nil {
+		s.writeAttributeMulti(buf, TagKeyword, "uri-security-supported", []string{"tls"})
+	}
+	authMethod := "none"
+	if s.authenticate != nil {
+		authMethod = "basic"
+	}
+	s.writeAttribute(buf, TagKeyword, "uri-authentication-supported", authMethod)
+	if s.tls != nil {
+		s.writeAttributeMulti(buf, TagKeyword, "uri-authentication-supported", []string{authMethod})
+	}
+	s.writeAttribute(buf, TagNameWithoutLang, "printer-name", printer.displayName())
+	if printer.UUID != "" {
+		s.writeAttribute(buf, TagURI, "printer-uuid", "urn:uuid:"+printer.UUID)
+	}
+	maintenanceMsg, inMaintenance := s.maintenanceMessage(printer.Name)
+	upstreamDown := s.isUpstreamDown(printer.Name)
+	if inMaintenance {
+		s.writeAttribute(buf, TagEnum, "printer-state", int32(5)) // stopped
+		s.writeAttribute(buf, TagKeyword, "printer-state-reasons", "paused")
+		s.writeAttribute(buf, TagTextWithoutLang, "printer-state-message", maintenanceMsg)
+	} else if upstreamDown {
+		s.writeAttribute(buf, TagEnum, "printer-state", int32(5)) // stopped
+		s.writeAttribute(buf, TagKeyword, "printer-state-reasons", "connecting-to-device")
+		s.writeAttribute(buf, TagTextWithoutLang, "printer-state-message", upstreamDownMessage)
+	} else if printer.State == stateStopped || printer.NotAccepting {
+		// A queue refusing jobs is as good as stopped to clients
+		s.writeAttribute(buf, TagEnum, "printer-state", int32(stateStopped))
+		reasons := printer.StateReasons
+		if len(reasons) == 0 {
+			reasons = []string{"paused"}
+		}
+		s.writeKeywords(buf, "printer-state-reasons", reasons)
+		message := printer.StateMessage
+		if message == "" && printer.NotAccepting {
+			message = notAcceptingMessage
+		}
+		if message != "" {
+			s.writeAttribute(buf, TagTextWithoutLang, "printer-state-message", message)
+		}
+	} else if s.queueFull(printer) {
+		s.writeAttribute(buf, TagEnum, "printer-state", int32(4)) // processing
+		s.writeAttribute(buf, TagKeyword, "printer-state-reasons", "queue-full")
+		s.writeAttribute(buf, TagTextWithoutLang, "printer-state-message", "Queue full, new jobs are refused until it drains")
+	} else {
+		state := int32(3) // idle
+		if printer.State == stateProcessing {
+			state = stateProcessing
+		}
+		s.writeAttribute(buf, TagEnum, "printer-state", state)
+		s.writeKeywords(buf, "printer-state-reasons", printer.StateReasons)
+		if printer.StateMessage != "" {
+			s.writeAttribute(buf, TagTextWithoutLang, "printer-state-message", printer.StateMessage)
+		}
+	}
+	versions := printer.ippVersionsSupported()
+	s.writeAttribute(buf, TagKeyword, "ipp-versions-supported", versions[0])
+	s.writeAttributeMulti(buf, TagKeyword, "ipp-versions-supported", versions[1:])
+	s.writeOperationsSupported(buf, printer)
+	s.writeIdentifyAttributes(buf, printer)
+
+	formats := printer.DocumentFormats()
+	s.writeAttribute(buf, TagMimeMediaType, "document-format-supported", formats[0])
+	if len(formats) > 1 {
+		s.writeAttributeMulti(buf, TagMimeMediaType, "document-format-supported", formats[1:])
+	}
+	s.writeAttribute(buf, TagMimeMediaType, "document-format-default", formats[0])
 
-	s.writeAttribute(buf, TagBoolean, "printer-is-accepting-jobs", true)
-	s.writeAttribute(buf, TagInteger, "queued-job-count", int32(0))
+	s.writeAttribute(buf, TagBoolean, "printer-is-accepting-jobs", !inMaintenance && !upstreamDown && !printer.NotAccepting)
+	s.writeAttribute(buf, TagInteger, "queued-job-count", int32(printer.QueuedJobs))
 	s.writeAttribute(buf, TagKeyword, "pdl-override-supported", "attempted")
 
 	// Use actual printer info
-	makeModel := s.printer.MakeModel
+	makeModel := printer.MakeModel
 	if makeModel == "" {
-		makeModel = s.printerName
+		makeModel = printer.Name
 	}
 	s.writeAttribute(buf, TagNameWithoutLang, "printer-make-and-model", makeModel)
+	s.writeBuildInfo(buf, printer)
 
-	location := s.printer.Location
+	location := printer.Location
 	if location == "" {
 		location = "Local"
 	}
 	s.writeAttribute(buf, TagTextWithoutLang, "printer-location", location)
+	s.writeGeoIconAttributes(buf, printer)
 
-	s.writeAttribute(buf, TagBoolean, "color-supported", s.printer.Color)
+	info := printer.Info
+	if info == "" {
+		info = printer.Name
+	}
+	s.writeAttribute(buf, TagTextWithoutLang, "printer-info", info)
+
+	s.writeAttribute(buf, TagBoolean, "color-supported", printer.Color)
+
+	// Resolutions from actual printer, the same list advertised in the URF
+	// string so clients render at a density the printer supports
+	resolutions := airprint.NormalizeResolutions(printer.Resolutions)
+	s.writeResolution(buf, "printer-resolution-default", defaultResolution(resolutions, printer.DefaultResolution))
+	for i, dpi := range resolutions {
+		name := "printer-resolution-supported"
+		if i > 0 {
+			name = ""
+		}
+		s.writeResolution(buf, name, dpi)
+	}
 
 	// Media sizes from actual printer
 	// Prefer media-ready (what's loaded) over media-supported (all possible)
-	mediaList := s.printer.MediaReady
+	mediaList := printer.MediaReady
 	if len(mediaList) == 0 {
-		mediaList = s.printer.MediaSupported
+		mediaList = printer.MediaSupported
 	}
 
-	mediaDefault := s.printer.MediaDefault
+	mediaDefault := printer.MediaDefault
 	if mediaDefault == "" && len(mediaList) > 0 {
 		mediaDefault = mediaList[0]
 	}
@@ -251,9 +721,10 @@ func (s *Server) handleGetPrinterAttributes(requestID uint32, printerName string
 			s.writeAttributeMulti(buf, TagKeyword, "media-supported", mediaList[1:])
 		}
 	}
+	s.writeMediaColAttributes(buf, printer)
 
 	// Sides
-	if s.printer.Duplex {
+	if printer.Duplex {
 		s.writeAttribute(buf, TagKeyword, "sides-supported", "one-sided")
 		s.writeAttributeMulti(buf, TagKeyword, "sides-supported", []string{
 			"two-sided-long-edge",
@@ -265,20 +736,15 @@ func (s *Server) handleGetPrinterAttributes(requestID uint32, printerName string
 		s.writeAttribute(buf, TagKeyword, "sides-default", "one-sided")
 	}
 
-	// URF capabilities - build from printer info
-	urfCaps := []string{"V1.4", "DM1"}
-	if s.printer.Color {
-		urfCaps = append(urfCaps, "SRGB24")
-	} else {
-		urfCaps = append(urfCaps, "W8")
-	}
-	if len(s.printer.Resolutions) > 0 {
-		urfCaps = append(urfCaps, fmt.Sprintf("RS%d", s.printer.Resolutions[0]))
-	} else {
-		urfCaps = append(urfCaps, "RS300")
-	}
+	s.writeLayoutAttributes(buf, printer)
+
+	// URF capabilities, matching the URF TXT record
+	urfCaps := append([]string{"V1.4"}, airprint.NewURFCapabilities(printer.Color, printer.Duplex, printer.Resolutions).Tokens()...)
+	urfCaps = printer.URF.Apply(urfCaps)
 
-	s.writeAttribute(buf, TagKeyword, "urf-supported", urfCaps[0])
+	if len(urfCaps) > 0 {
+		s.writeAttribute(buf, TagKeyword, "urf-supported", urfCaps[0])
+	}
 	if len(urfCaps) > 1 {
 		s.writeAttributeMulti(buf, TagKeyword, "urf-supported", urfCaps[1:])
 	}
@@ -289,50 +755,228 @@ func (s *Server) handleGetPrinterAttributes(requestID uint32, printerName string
 	return buf.Bytes()
 }
 
-func (s *Server) handlePrintJob(requestID uint32, printerName string, body []byte) []byte {
-	s.log.Info().Str("printer", printerName).Msg("handling Print-Job")
+func (s *Server) handlePrintJob(ctx context.Context, req *Request, printer PrinterConfig, document io.Reader, upload *upload) []byte {
+	ctx = jobs.WithTraceID(ctx, jobs.NewTraceID())
+	log := jobs.TraceLog(ctx, s.log)
+	log.Info().Str("printer", printer.Name).Msg("handling Print-Job")
+	if rec := auditRecord(ctx); rec != nil {
+		rec.TraceID = jobs.TraceID(ctx)
+		rec.DocumentFormat = req.OpAttr("document-format").String()
+		document = countingReader{r: document, n: &rec.Bytes}
+	}
 
-	// Find where attributes end and document begins
-	docStart := s.findDocumentStart(body)
-	if docStart < 0 {
-		s.log.Error().Msg("could not find document in print job")
-		return s.buildErrorResponse(requestID, StatusClientErrorBadRequest)
+	if message, ok := s.unavailableMessage(printer); ok {
+		log.Info().Str("printer", printer.Name).Str("reason", message).Msg("rejecting job, printer not accepting jobs")
+		return s.buildErrorResponseMessage(req.RequestID, StatusServerErrorNotAccepting, message)
 	}
 
-	document := bytes.NewReader(body[docStart:])
+	jobName := req.OpAttr("job-name").String()
+	if jobName == "" {
+		jobName = "AirPrint Job"
+	}
 
-	// Forward to CUPS
-	jobID, err := s.cupsClient.PrintJob(s.printerName, document, "AirPrint Job", nil)
-	if err != nil {
-		s.log.Error().Err(err).Msg("failed to forward job to CUPS")
-		return s.buildErrorResponse(requestID, StatusServerErrorInternalError)
+	if s.submitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.submitTimeout)
+		defer cancel()
 	}
 
-	s.log.Info().Int("job_id", jobID).Msg("job forwarded to CUPS")
+	job, err := s.submit(ctx, printer, document, jobs.Job{
+		Name:           jobName,
+		User:           req.OpAttr("requesting-user-name").String(),
+		DocumentFormat: req.OpAttr("document-format").String(),
+	}, s.jobOptions(req, printer))
+	upload.done()
+	if printer.RelayAuth && notAuthenticated(err) {
+		log.Warn().Str("printer", printer.Name).Str("user", req.OpAttr("requesting-user-name").String()).Msg("CUPS rejected relayed credentials")
+		return s.buildErrorResponseMessage(req.RequestID, StatusClientErrorNotAuthenticated, "User name or password not accepted by the print server")
+	}
+	if denial, ok := AsDenial(err); ok {
+		return s.buildErrorResponseMessage(req.RequestID, denial.Status, denial.Message)
+	}
+	if upload.tooLarge() {
+		log.Warn().Err(upload.err).Str("printer", printer.Name).Msg("job refused, document too large")
+		return s.buildErrorResponseMessage(req.RequestID, StatusClientErrorRequestEntityTooLarge, "Document is larger than the print server accepts")
+	}
+	if upload.err != nil {
+		log.Warn().Err(upload.err).Str("printer", printer.Name).Msg("job abandoned, client stopped sending")
+		return s.buildErrorResponseMessage(req.RequestID, StatusClientErrorTimeout, "Document upload stalled or was too slow")
+	}
+	log.Debug().Str("printer", printer.Name).Float64("bytes_per_second", upload.rate()).Msg("document received")
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			log.Warn().Err(ctxErr).Str("printer", printer.Name).Msg("job submission abandoned")
+		} else if cups.IsTransient(err) {
+			// Clients retry jobs refused as unavailable on their own
+			log.Warn().Err(err).Str("printer", printer.Name).Msg("CUPS unreachable, job refused")
+			return s.buildErrorResponseMessage(req.RequestID, StatusServerErrorServiceUnavailable, "Print server unavailable, try again later")
+		} else {
+			log.Error().Err(err).Strs("features", printer.Features).Msg("failed to forward job to CUPS")
+		}
+		return s.buildErrorResponse(req.RequestID, StatusServerErrorInternalError)
+	}
+	if rec := auditRecord(ctx); rec != nil {
+		rec.JobID = job.ID
+	}
 
 	// Build success response
 	buf := &bytes.Buffer{}
 	_ = binary.Write(buf, binary.BigEndian, uint16(0x0200))
 	_ = binary.Write(buf, binary.BigEndian, uint16(StatusOK))
-	_ = binary.Write(buf, binary.BigEndian, requestID)
+	_ = binary.Write(buf, binary.BigEndian, req.RequestID)
 
 	buf.WriteByte(TagOperationAttrs)
 	s.writeAttribute(buf, TagCharset, "attributes-charset", "utf-8")
 	s.writeAttribute(buf, TagNaturalLang, "attributes-natural-language", "en-us")
 
 	buf.WriteByte(TagJobAttrs)
-	s.writeAttribute(buf, TagInteger, "job-id", int32(jobID))
-	s.writeAttribute(buf, TagURI, "job-uri", fmt.Sprintf("%s/jobs/%d", s.printerURI, jobID))
-	s.writeAttribute(buf, TagEnum, "job-state", int32(3)) // pending
+	s.writeAttribute(buf, TagInteger, "job-id", int32(job.ID))
+	s.writeAttribute(buf, TagURI, "job-uri", s.jobURI(printer.Name, job.ID))
+	s.writeAttribute(buf, TagEnum, "job-state", int32(job.State))
+	s.writeAttribute(buf, TagKeyword, "job-state-reasons", "none")
 
 	buf.WriteByte(TagEnd)
 
 	return buf.Bytes()
 }
 
-func (s *Server) handleValidateJob(requestID uint32) []byte {
+// SetSubmitTimeout limits how long forwarding a single job to CUPS may take,
+// including receiving the document from the client. Zero disables the limit.
+func (s *Server) SetSubmitTimeout(d time.Duration) {
+	s.submitTimeout = d
+}
+
+// SetDeniedHandler registers a function called when CUPS refuses a job
+// because of a quota or policy
+func (s *Server) SetDeniedHandler(fn func(printer, user, traceID string, d Denial)) {
+	s.onDenied = fn
+}
+
+// SetTraceJobNames appends each job's trace ID to the job name sent to CUPS,
+// e.g. "Boarding pass [3f2a9c0b1d4e5f60]", so it shows up in CUPS's logs
+// and job history
+func (s *Server) SetTraceJobNames(enabled bool) {
+	s.traceJobNames = enabled
+}
+
+// SubmitJob prints a document on a served printer through the same path as
+// an IPP Print-Job, for jobs that originate inside the bridge
+func (s *Server) SubmitJob(ctx context.Context, printerName string, document io.Reader, spec jobs.Job, options map[string]string) (jobs.Job, error) {
+	printer, ok := s.lookupPrinter(printerName)
+	if !ok {
+		return jobs.Job{}, fmt.Errorf("%w: %s", ErrUnknownPrinter, printerName)
+	}
+	if message, ok := s.maintenanceMessage(printer.Name); ok {
+		return jobs.Job{}, fmt.Errorf("%w: %s", ErrMaintenance, message)
+	}
+	return s.submit(ctx, printer, document, spec, options)
+}
+
+// submit forwards a document to CUPS and starts tracking the job, archiving
+// the document if enabled. Cancelling ctx, e.g. when the client disconnects,
+// abandons the upload to CUPS.
+func (s *Server) submit(ctx context.Context, printer PrinterConfig, document io.Reader, spec jobs.Job, options map[string]string) (job jobs.Job, err error) {
+	defer func() { s.recordJob(printer.Name, err) }()
+
+	spool := s.archiveSpool(printer.Name)
+	if spool == nil {
+		return s.forward(ctx, printer, document, spec, options)
+	}
+
+	// The pipeline may add options, such as a hold, that a reprint shouldn't
+	// inherit
+	archived := make(map[string]string, len(options))
+	for k, v := range options {
+		archived[k] = v
+	}
+	job, err = s.forward(ctx, printer, io.TeeReader(document, spool), spec, options)
+	if err != nil {
+		spool.Discard()
+		return job, err
+	}
+	s.keep(spool, job, archived)
+	return job, nil
+}
+
+// forward sends a document to CUPS, or straight to a raw printer, and starts
+// tracking the job
+func (s *Server) forward(ctx context.Context, printer PrinterConfig, document io.Reader, spec jobs.Job, options map[string]string) (jobs.Job, error) {
+	if jobs.TraceID(ctx) == "" {
+		ctx = jobs.WithTraceID(ctx, jobs.NewTraceID())
+	}
+	spec.TraceID = jobs.TraceID(ctx)
+
+	if printer.RawAddr != "" {
+		return s.sendRaw(ctx, printer, document, spec, options)
+	}
+	if len(printer.FormatFallback) > 0 {
+		br := bufio.NewReader(document)
+		if raster.IsURF(br) {
+			return s.forwardWithFallback(ctx, printer, br, spec, options)
+		}
+		document = br
+	}
+	return s.send(ctx, printer, document, spec, options)
+}
+
+// send converts a document as the printer is configured to, submits it to
+// CUPS and starts tracking the job
+func (s *Server) send(ctx context.Context, printer PrinterConfig, document io.Reader, spec jobs.Job, options map[string]string) (jobs.Job, error) {
+	log := jobs.TraceLog(ctx, s.log)
+
+	document, options, release := s.transcode(ctx, printer, document, spec, options)
+	defer release()
+	options = s.holdOptions(printer, options)
+	if options["job-hold-until"] != "" {
+		spec.State = jobs.StatePendingHeld
+		spec.StateReasons = []string{"job-hold-until-specified"}
+	}
+
+	jobName := spec.Name
+	if s.traceJobNames {
+		jobName = fmt.Sprintf("%s [%s]", jobName, spec.TraceID)
+	}
+	cupsJobID, err := s.cupsClient.PrintJob(ctx, printer.Name, document, jobName, options)
+	if err != nil {
+		if denial, ok := AsDenial(err); ok && !(printer.RelayAuth && notAuthenticated(err)) {
+			log.Warn().
+				Str("printer", printer.Name).
+				Str("user", spec.User).
+				Str("reason", denial.Reason).
+				Str("message", denial.Message).
+				Msg("CUPS refused job")
+			if s.onDenied != nil {
+				s.onDenied(printer.Name, spec.User, spec.TraceID, denial)
+			}
+		}
+		return jobs.Job{}, err
+	}
+
+	spec.CUPSJobID = cupsJobID
+	spec.Printer = printer.Name
+	job := s.jobs.Add(spec)
+
+	log.Info().Int("job_id", job.ID).Int("cups_job_id", cupsJobID).Msg("job forwarded to CUPS")
+	return job, nil
+}
+
+// jobOptions returns the job template attributes of a Print-Job request that
+// are passed on to CUPS
+func (s *Server) jobOptions(req *Request, printer PrinterConfig) map[string]string {
+	options := s.layoutOptions(req, printer)
+	for k, v := range s.mediaOptions(req, printer) {
+		options[k] = v
+	}
+	return options
+}
+
+func (s *Server) handleValidateJob(requestID uint32, printer PrinterConfig) []byte {
 	s.log.Debug().Msg("handling Validate-Job")
 
+	if message, ok := s.unavailableMessage(printer); ok {
+		return s.buildErrorResponseMessage(requestID, StatusServerErrorNotAccepting, message)
+	}
+
 	buf := &bytes.Buffer{}
 	_ = binary.Write(buf, binary.BigEndian, uint16(0x0200))
 	_ = binary.Write(buf, binary.BigEndian, uint16(StatusOK))
@@ -347,52 +991,151 @@ func (s *Server) handleValidateJob(requestID uint32) []byte {
 	return buf.Bytes()
 }
 
-func (s *Server) handleGetJobs(requestID uint32) []byte {
+func (s *Server) handleGetJobs(req *Request, printer PrinterConfig) []byte {
 	s.log.Debug().Msg("handling Get-Jobs")
 
+	which := req.OpAttr("which-jobs").String()
+	limit, hasLimit := req.OpAttr("limit").Int()
+
 	buf := &bytes.Buffer{}
 	_ = binary.Write(buf, binary.BigEndian, uint16(0x0200))
 	_ = binary.Write(buf, binary.BigEndian, uint16(StatusOK))
-	_ = binary.Write(buf, binary.BigEndian, requestID)
+	_ = binary.Write(buf, binary.BigEndian, req.RequestID)
 
 	buf.WriteByte(TagOperationAttrs)
 	s.writeAttribute(buf, TagCharset, "attributes-charset", "utf-8")
 	s.writeAttribute(buf, TagNaturalLang, "attributes-natural-language", "en-us")
 
-	// No jobs to report for now
+	for i, job := range s.jobs.List(printer.Name, which) {
+		if hasLimit && i >= limit {
+			break
+		}
+		buf.WriteByte(TagJobAttrs)
+		s.writeJobAttributes(buf, job)
+	}
+
 	buf.WriteByte(TagEnd)
 
 	return buf.Bytes()
 }
 
-func (s *Server) handleGetJobAttributes(requestID uint32, _ []byte) []byte {
+func (s *Server) handleGetJobAttributes(req *Request, printer PrinterConfig) []byte {
 	s.log.Debug().Msg("handling Get-Job-Attributes")
 
+	jobID, ok := req.JobID()
+	if !ok {
+		return s.buildErrorResponse(req.RequestID, StatusClientErrorBadRequest)
+	}
+	job, ok := s.jobs.Get(jobID)
+	if !ok {
+		return s.buildErrorResponse(req.RequestID, StatusClientErrorNotFound)
+	}
+
 	buf := &bytes.Buffer{}
 	_ = binary.Write(buf, binary.BigEndian, uint16(0x0200))
 	_ = binary.Write(buf, binary.BigEndian, uint16(StatusOK))
-	_ = binary.Write(buf, binary.BigEndian, requestID)
+	_ = binary.Write(buf, binary.BigEndian, req.RequestID)
 
 	buf.WriteByte(TagOperationAttrs)
 	s.writeAttribute(buf, TagCharset, "attributes-charset", "utf-8")
 	s.writeAttribute(buf, TagNaturalLang, "attributes-natural-language", "en-us")
 
 	buf.WriteByte(TagJobAttrs)
-	s.writeAttribute(buf, TagEnum, "job-state", int32(9)) // completed
-	s.writeAttribute(buf, TagKeyword, "job-state-reasons", "job-completed-successfully")
+	s.writeJobAttributes(buf, job)
 
 	buf.WriteByte(TagEnd)
 
 	return buf.Bytes()
 }
 
-func (s *Server) handleCancelJob(requestID uint32, _ []byte) []byte {
+// writeJobAttributes writes the job description attributes reported to clients
+func (s *Server) writeJobAttributes(buf *bytes.Buffer, job jobs.Job) {
+	s.writeAttribute(buf, TagInteger, "job-id", int32(job.ID))
+	s.writeAttribute(buf, TagURI, "job-uri", s.jobURI(job.Printer, job.ID))
+	s.writeAttribute(buf, TagURI, "job-printer-uri", s.printerURI(job.Printer))
+	s.writeAttribute(buf, TagNameWithoutLang, "job-name", job.Name)
+	if job.User != "" {
+		s.writeAttribute(buf, TagNameWithoutLang, "job-originating-user-name", job.User)
+	}
+	s.writeAttribute(buf, TagEnum, "job-state", int32(job.State))
+
+	reasons := job.StateReasons
+	if len(reasons) == 0 {
+		reasons = []string{"none"}
+	}
+	s.writeAttribute(buf, TagKeyword, "job-state-reasons", reasons[0])
+	if len(reasons) > 1 {
+		s.writeAttributeMulti(buf, TagKeyword, "job-state-reasons", reasons[1:])
+	}
+
+	s.writeAttribute(buf, TagInteger, "job-impressions-completed", int32(job.ImpressionsCompleted))
+	s.writeAttribute(buf, TagInteger, "time-at-creation", int32(job.CreatedAt.Unix()))
+	if !job.CompletedAt.IsZero() {
+		s.writeAttribute(buf, TagInteger, "time-at-completed", int32(job.CompletedAt.Unix()))
+	}
+}
+
+// jobURI returns the ipp:// URI of a job on a printer
+func (s *Server) jobURI(printerName string, jobID int) string {
+	return fmt.Sprintf("%s/jobs/%d", s.printerURI(printerName), jobID)
+}
+
+func (s *Server) handleCancelJob(req *Request, printer PrinterConfig) []byte {
 	s.log.Debug().Msg("handling Cancel-Job")
 
+	jobID, ok := req.JobID()
+	if !ok {
+		return s.buildErrorResponse(req.RequestID, StatusClientErrorBadRequest)
+	}
+	// Job IDs are shared by all printers, so one on another printer is not
+	// found on this one
+	job, ok := s.jobs.Get(jobID)
+	if !ok || job.Printer != printer.Name {
+		return s.buildErrorResponse(req.RequestID, StatusClientErrorNotFound)
+	}
+
+	// Only the job's owner may cancel it. With authentication on, the
+	// requesting-user-name has already been replaced by the signed-in user.
+	if user := req.OpAttr("requesting-user-name").String(); user != job.User {
+		s.log.Warn().Int("job_id", job.ID).Str("user", user).Str("owner", job.User).Msg("refused to cancel another user's job")
+		return s.buildErrorResponse(req.RequestID, StatusClientErrorNotAuthorized)
+	}
+
+	// A finished job can no longer be cancelled
+	if job.Done() {
+		return s.buildErrorResponse(req.RequestID, StatusClientErrorNotPossible)
+	}
+
+	if err := s.cupsClient.CancelJob(job.CUPSJobID); err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Status == StatusClientErrorNotPossible {
+			// CUPS finished the job before our tracker noticed
+			return s.buildErrorResponse(req.RequestID, StatusClientErrorNotPossible)
+		}
+		if cups.IsTransient(err) {
+			s.log.Warn().Err(err).Int("job_id", job.ID).Msg("CUPS unreachable, job not cancelled")
+			return s.buildErrorResponse(req.RequestID, StatusServerErrorServiceUnavailable)
+		}
+		if cancelRefused(err) {
+			// The owner asked, but the bridge's CUPS account may not cancel
+			// the job
+			s.log.Warn().Err(err).Int("job_id", job.ID).Int("cups_job_id", job.CUPSJobID).Msg("CUPS refused to cancel job, cups.auth needs an account allowed to cancel other users' jobs")
+			return s.buildErrorResponse(req.RequestID, StatusClientErrorForbidden)
+		}
+		s.log.Error().Err(err).Int("job_id", job.ID).Int("cups_job_id", job.CUPSJobID).Str("trace_id", job.TraceID).Msg("failed to cancel job in CUPS")
+		return s.buildErrorResponse(req.RequestID, StatusServerErrorInternalError)
+	}
+
+	s.jobs.Update(job.ID, jobs.Status{
+		State:        jobs.StateCanceled,
+		StateReasons: []string{"job-canceled-by-user"},
+	})
+	s.log.Info().Int("job_id", job.ID).Int("cups_job_id", job.CUPSJobID).Str("trace_id", job.TraceID).Msg("job cancelled")
+
 	buf := &bytes.Buffer{}
 	_ = binary.Write(buf, binary.BigEndian, uint16(0x0200))
 	_ = binary.Write(buf, binary.BigEndian, uint16(StatusOK))
-	_ = binary.Write(buf, binary.BigEndian, requestID)
+	_ = binary.Write(buf, binary.BigEndian, req.RequestID)
 
 	buf.WriteByte(TagOperationAttrs)
 	s.writeAttribute(buf, TagCharset, "attributes-charset", "utf-8")
@@ -404,6 +1147,12 @@ func (s *Server) handleCancelJob(requestID uint32, _ []byte) []byte {
 }
 
 func (s *Server) buildErrorResponse(requestID uint32, status uint16) []byte {
+	return s.buildErrorResponseMessage(requestID, status, "")
+}
+
+// buildErrorResponseMessage builds an error response with a status-message
+// shown to the user, if message is not empty
+func (s *Server) buildErrorResponseMessage(requestID uint32, status uint16, message string) []byte {
 	buf := &bytes.Buffer{}
 	_ = binary.Write(buf, binary.BigEndian, uint16(0x0200))
 	_ = binary.Write(buf, binary.BigEndian, status)
@@ -413,6 +1162,10 @@ func (s *Server) buildErrorResponse(requestID uint32, status uint16) []byte {
 	s.writeAttribute(buf, TagCharset, "attributes-charset", "utf-8")
 	s.writeAttribute(buf, TagNaturalLang, "attributes-natural-language", "en-us")
 
+	if message != "" {
+		s.writeAttribute(buf, TagTextWithoutLang, "status-message", message)
+	}
+
 	buf.WriteByte(TagEnd)
 
 	return buf.Bytes()
@@ -440,6 +1193,18 @@ func (s *Server) writeAttribute(buf *bytes.Buffer, tag byte, name string, value
 	}
 }
 
+// writeResolution writes a resolution value in dots per inch. An empty name
+// adds another value to the previous attribute.
+func (s *Server) writeResolution(buf *bytes.Buffer, name string, dpi int) {
+	_ = buf.WriteByte(TagResolution)
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(name)))
+	_, _ = buf.WriteString(name)
+	_ = binary.Write(buf, binary.BigEndian, uint16(9))
+	_ = binary.Write(buf, binary.BigEndian, int32(dpi)) // cross-feed
+	_ = binary.Write(buf, binary.BigEndian, int32(dpi)) // feed
+	_ = buf.WriteByte(3)                                // units: dots per inch
+}
+
 func (s *Server) writeAttributeMulti(buf *bytes.Buffer, tag byte, _ string, values []string) {
 	for _, v := range values {
 		_ = buf.WriteByte(tag)
@@ -449,7 +1214,7 @@ func (s *Server) writeAttributeMulti(buf *bytes.Buffer, tag byte, _ string, valu
 	}
 }
 
-func (s *Server) writeOperationsSupported(buf *bytes.Buffer) {
+func (s *Server) writeOperationsSupported(buf *bytes.Buffer, printer PrinterConfig) {
 	ops := []int32{
 		OpPrintJob,
 		OpValidateJob,
@@ -458,6 +1223,9 @@ func (s *Server) writeOperationsSupported(buf *bytes.Buffer) {
 		OpGetPrinterAttributes,
 		OpCancelJob,
 	}
+	if printer.Identify != nil {
+		ops = append(ops, OpIdentifyPrinter)
+	}
 
 	// First value with name
 	_ = buf.WriteByte(TagEnum)
@@ -476,13 +1244,18 @@ func (s *Server) writeOperationsSupported(buf *bytes.Buffer) {
 	}
 }
 
-func (s *Server) findDocumentStart(body []byte) int {
-	// IPP attributes end with TagEnd (0x03)
-	// Document data follows immediately after
-	for i := 8; i < len(body); i++ {
-		if body[i] == TagEnd {
-			return i + 1
+// defaultResolution returns preferred if the printer supports it, otherwise
+// 300 or 600 dpi if supported, otherwise the highest resolution
+func defaultResolution(resolutions []int, preferred int) int {
+	for _, dpi := range resolutions {
+		if dpi == preferred {
+			return dpi
+		}
+	}
+	for _, dpi := range resolutions {
+		if dpi == 300 || dpi == 600 {
+			return dpi
 		}
 	}
-	return -1
+	return resolutions[len(resolutions)-1]
 }
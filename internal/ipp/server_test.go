@@ -0,0 +1,473 @@
+package ipp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	goipp "github.com/phin1x/go-ipp"
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// fakeCUPS accepts every job it can read, unless told to refuse it
+type fakeCUPS struct {
+	printErr  error           // Returned for every job, if set
+	reject    map[string]bool // Document formats refused as not supported
+	gone      bool            // Answer status queries as if CUPS purged every job
+	formats   []string        // document-format option of each job received
+	cancelErr error           // Returned for every cancel, if set
+	cancelled []int
+}
+
+func (f *fakeCUPS) PrintJob(ctx context.Context, printerName string, document io.Reader, jobName string, options map[string]string) (int, error) {
+	if _, err := io.Copy(io.Discard, document); err != nil {
+		return 0, err
+	}
+	format := options["document-format"]
+	f.formats = append(f.formats, format)
+	if f.reject[format] {
+		return 0, &StatusError{Status: StatusClientErrorDocumentFormatNotSupported}
+	}
+	if f.printErr != nil {
+		return 0, f.printErr
+	}
+	return 100, nil
+}
+
+func (f *fakeCUPS) JobStatus(jobID int) (jobs.Status, error) {
+	if f.gone {
+		return jobs.Status{}, jobGone(&StatusError{Status: StatusClientErrorNotFound})
+	}
+	return jobs.Status{State: jobs.StateProcessing}, nil
+}
+
+func (f *fakeCUPS) CancelJob(jobID int) error {
+	if f.cancelErr != nil {
+		return f.cancelErr
+	}
+	f.cancelled = append(f.cancelled, jobID)
+	return nil
+}
+
+// newRequest returns an IPP request of operation addressed to printer
+func newRequest(t *testing.T, operation int16, printer, user string, document []byte) *http.Request {
+	t.Helper()
+	req := goipp.NewRequest(operation, 1)
+	req.OperationAttributes["printer-uri"] = "ipp://localhost/printers/" + printer
+	if user != "" {
+		req.OperationAttributes["requesting-user-name"] = user
+	}
+	body, err := req.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/printers/"+printer, bytes.NewReader(append(body, document...)))
+	r.Header.Set("Content-Type", "application/ipp")
+	return r
+}
+
+// serve answers r and returns the response status and status-message
+func serve(t *testing.T, s *Server, r *http.Request) (uint16, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("HTTP status %d", w.Code)
+	}
+	return decodeStatus(t, w.Body.Bytes())
+}
+
+// decodeStatus returns the status and status-message of an IPP response
+func decodeStatus(t *testing.T, body []byte) (uint16, string) {
+	t.Helper()
+	resp, err := goipp.NewResponseDecoder(bytes.NewReader(body)).Decode(nil)
+	if err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	var message string
+	if attrs := resp.OperationAttributes["status-message"]; len(attrs) > 0 {
+		message, _ = attrs[0].Value.(string)
+	}
+	return uint16(resp.StatusCode), message
+}
+
+// urfDocument returns a one page Apple Raster document
+func urfDocument(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := raster.WriteTestPage(&buf, raster.FormatURF, raster.TestPage{Width: 85, Height: 110, DPI: 10}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServer_PrintJobRefused(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		relayAuth   bool
+		wantStatus  uint16
+		wantMessage string
+		wantDenial  string // Reason passed to the denied handler, empty if not called
+	}{
+		{"accepted", nil, false, StatusOK, "", ""},
+		{"account limit", &StatusError{Status: StatusClientErrorAccountLimitReached, Message: "Page limit reached"}, false, StatusClientErrorAccountLimitReached, "Page limit reached", DenialQuota},
+		{"account closed", &StatusError{Status: StatusClientErrorAccountClosed}, false, StatusClientErrorAccountClosed, "Print quota exceeded", DenialQuota},
+		{"quota message", &StatusError{Status: StatusClientErrorNotPossible, Message: "Quota limit reached."}, false, StatusClientErrorNotPossible, "Quota limit reached.", DenialQuota},
+		{"forbidden", &StatusError{Status: StatusClientErrorForbidden}, false, StatusClientErrorForbidden, "Printing is not allowed by the print server policy", DenialPolicy},
+		{"not authorized", &StatusError{Status: StatusClientErrorNotAuthorized, Message: "Not allowed"}, false, StatusClientErrorNotAuthorized, "Not allowed", DenialPolicy},
+		{"not authenticated", &StatusError{Status: StatusClientErrorNotAuthenticated}, false, StatusClientErrorForbidden, "Printing is not allowed by the print server policy", DenialPolicy},
+		{"relayed credentials refused", &StatusError{Status: StatusClientErrorNotAuthenticated}, true, StatusClientErrorNotAuthenticated, "User name or password not accepted by the print server", ""},
+		{"relayed credentials quota", &StatusError{Status: StatusClientErrorAccountLimitReached}, true, StatusClientErrorAccountLimitReached, "Print quota exceeded", DenialQuota},
+		{"CUPS unreachable", fmt.Errorf("print job: %w", cups.ErrCUPSUnreachable), false, StatusServerErrorServiceUnavailable, "Print server unavailable, try again later", ""},
+		{"not possible", &StatusError{Status: StatusClientErrorNotPossible, Message: "Printer stopped"}, false, StatusServerErrorInternalError, "", ""},
+		{"other error", errors.New("broken pipe"), false, StatusServerErrorInternalError, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &fakeCUPS{printErr: tt.err}
+			s := NewServer(":0", cups, jobs.NewTracker(cups, zerolog.Nop()), zerolog.Nop())
+			s.SetPrinters([]PrinterConfig{{Name: "Office", RelayAuth: tt.relayAuth}})
+			var denials []string
+			s.SetDeniedHandler(func(printer, user, traceID string, d Denial) {
+				denials = append(denials, d.Reason)
+			})
+
+			r := newRequest(t, goipp.OperationPrintJob, "Office", "alice", []byte("%PDF-1.4"))
+			if tt.relayAuth {
+				r.SetBasicAuth("alice", "secret")
+			}
+			status, message := serve(t, s, r)
+			if status != tt.wantStatus {
+				t.Errorf("status = %#04x, want %#04x", status, tt.wantStatus)
+			}
+			if message != tt.wantMessage {
+				t.Errorf("status-message = %q, want %q", message, tt.wantMessage)
+			}
+			var want []string
+			if tt.wantDenial != "" {
+				want = []string{tt.wantDenial}
+			}
+			if !reflect.DeepEqual(denials, want) {
+				t.Errorf("denials = %v, want %v", denials, want)
+			}
+		})
+	}
+}
+
+func TestServer_FormatFallback(t *testing.T) {
+	urf := urfDocument(t)
+	tests := []struct {
+		name        string
+		document    []byte
+		reject      []string
+		printErr    error
+		wantStatus  uint16
+		wantFormats []string // Formats CUPS was sent, in order
+	}{
+		{"first accepted", urf, nil, nil, StatusOK, []string{raster.FormatPWG}},
+		{"second accepted", urf, []string{raster.FormatPWG}, nil, StatusOK, []string{raster.FormatPWG, raster.FormatPDF}},
+		{"all rejected", urf, []string{raster.FormatPWG, raster.FormatPDF}, nil, StatusServerErrorInternalError, []string{raster.FormatPWG, raster.FormatPDF}},
+		{"other error", urf, nil, &StatusError{Status: StatusClientErrorNotPossible}, StatusServerErrorInternalError, []string{raster.FormatPWG}},
+		{"not Apple Raster", []byte("%PDF-1.4"), []string{""}, nil, StatusServerErrorInternalError, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &fakeCUPS{printErr: tt.printErr, reject: make(map[string]bool)}
+			for _, format := range tt.reject {
+				cups.reject[format] = true
+			}
+			s := NewServer(":0", cups, jobs.NewTracker(cups, zerolog.Nop()), zerolog.Nop())
+			s.SetPrinters([]PrinterConfig{{
+				Name:           "Office",
+				URFConversion:  raster.FormatPWG,
+				FormatFallback: []string{raster.FormatPDF},
+			}})
+
+			status, _ := serve(t, s, newRequest(t, goipp.OperationPrintJob, "Office", "alice", tt.document))
+			if status != tt.wantStatus {
+				t.Errorf("status = %#04x, want %#04x", status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(cups.formats, tt.wantFormats) {
+				t.Errorf("formats sent = %q, want %q", cups.formats, tt.wantFormats)
+			}
+		})
+	}
+}
+
+func TestServer_QueueFull(t *testing.T) {
+	tests := []struct {
+		name           string
+		operation      int16
+		queued         []int // States of the jobs already on the printer
+		gone           bool  // CUPS has purged the queued jobs
+		wantStatus     uint16
+		wantRetryAfter string
+	}{
+		{"room", goipp.OperationPrintJob, []int{jobs.StateProcessing}, false, StatusOK, ""},
+		{"full", goipp.OperationPrintJob, []int{jobs.StatePending, jobs.StateProcessing}, false, StatusServerErrorBusy, "30"},
+		{"full validate", goipp.OperationValidateJob, []int{jobs.StatePending, jobs.StateProcessing}, false, StatusServerErrorBusy, "30"},
+		{"finished jobs", goipp.OperationPrintJob, []int{jobs.StateCompleted, jobs.StateCanceled, jobs.StateAborted}, false, StatusOK, ""},
+		{"held jobs", goipp.OperationPrintJob, []int{jobs.StatePendingHeld, jobs.StatePendingHeld, jobs.StateProcessing}, false, StatusOK, ""},
+		{"jobs purged by CUPS", goipp.OperationPrintJob, []int{jobs.StatePending, jobs.StateProcessing}, true, StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &fakeCUPS{gone: tt.gone}
+			tracker := jobs.NewTracker(cups, zerolog.Nop())
+			s := NewServer(":0", cups, tracker, zerolog.Nop())
+			s.SetPrinters([]PrinterConfig{{Name: "Office", MaxQueued: 2}, {Name: "Lab"}})
+			for i, state := range tt.queued {
+				tracker.Add(jobs.Job{Printer: "Office", CUPSJobID: i + 1, State: state})
+			}
+			tracker.Add(jobs.Job{Printer: "Lab", CUPSJobID: 99})
+			if tt.gone {
+				tracker.Refresh()
+			}
+
+			w := httptest.NewRecorder()
+			s.handler().ServeHTTP(w, newRequest(t, tt.operation, "Office", "alice", []byte("%PDF-1.4")))
+			if status, _ := decodeStatus(t, w.Body.Bytes()); status != tt.wantStatus {
+				t.Errorf("status = %#04x, want %#04x", status, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+// stallingReader returns data, then blocks until released as a client that
+// stopped sending would
+type stallingReader struct {
+	data    []byte
+	release chan struct{}
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		<-r.release
+		return 0, io.EOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestServer_StallTimeout(t *testing.T) {
+	cups := &fakeCUPS{}
+	s := NewServer(":0", cups, jobs.NewTracker(cups, zerolog.Nop()), zerolog.Nop())
+	s.SetPrinters([]PrinterConfig{{Name: "Office"}})
+	s.SetClientLimits(ClientLimits{StallTimeout: 100 * time.Millisecond})
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		document   []byte
+		stall      bool
+		wantStatus uint16
+	}{
+		{"complete", []byte("%PDF-1.4"), false, StatusOK},
+		{"stalled before document", nil, true, 0x0405},
+		{"stalled during document", []byte("%PDF-1.4"), true, 0x0405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRequest(t, goipp.OperationPrintJob, "Office", "alice", tt.document)
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			release := make(chan struct{})
+			defer close(release)
+			var reader io.Reader = bytes.NewReader(body)
+			if tt.stall {
+				reader = &stallingReader{data: body, release: release}
+			}
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL+r.URL.Path, reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/ipp")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status, _ := decodeStatus(t, data); status != tt.wantStatus {
+				t.Errorf("status = %#04x, want %#04x", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestServer_CancelJob(t *testing.T) {
+	cups := &fakeCUPS{}
+	tracker := jobs.NewTracker(cups, zerolog.Nop())
+	s := NewServer(":0", cups, tracker, zerolog.Nop())
+	s.SetPrinters([]PrinterConfig{{Name: "Office"}, {Name: "Lab"}})
+
+	tests := []struct {
+		name       string
+		printer    string // printer-uri of the request
+		user       string // requesting-user-name
+		authUser   string // Basic-auth user, if authentication is on
+		wantStatus uint16
+	}{
+		{"owner", "Office", "alice", "", StatusOK},
+		{"other printer", "Lab", "alice", "", StatusClientErrorNotFound},
+		{"other user", "Office", "bob", "", StatusClientErrorNotAuthorized},
+		{"no user", "Office", "", "", StatusClientErrorNotAuthorized},
+		{"authenticated owner", "Office", "bob", "alice", StatusOK},
+		{"authenticated other user", "Office", "alice", "bob", StatusClientErrorNotAuthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.authenticate = nil
+			if tt.authUser != "" {
+				s.authenticate = func(user, password string) (bool, bool) { return password == "secret", false }
+			}
+			job := tracker.Add(jobs.Job{Printer: "Office", User: "alice", CUPSJobID: 100})
+			cups.cancelled = nil
+
+			req := goipp.NewRequest(goipp.OperationCancelJob, 1)
+			req.OperationAttributes["printer-uri"] = "ipp://localhost/printers/" + tt.printer
+			req.OperationAttributes["job-id"] = job.ID
+			if tt.user != "" {
+				req.OperationAttributes["requesting-user-name"] = tt.user
+			}
+			body, err := req.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/printers/"+tt.printer, bytes.NewReader(body))
+			if tt.authUser != "" {
+				r.SetBasicAuth(tt.authUser, "secret")
+			}
+			if status, _ := serve(t, s, r); status != tt.wantStatus {
+				t.Errorf("status = %#04x, want %#04x", status, tt.wantStatus)
+			}
+
+			cancelled := len(cups.cancelled) > 0
+			if want := tt.wantStatus == StatusOK; cancelled != want {
+				t.Errorf("cancelled in CUPS = %v, want %v", cancelled, want)
+			}
+			if got, _ := tracker.Get(job.ID); (got.State == jobs.StateCanceled) != cancelled {
+				t.Errorf("job state = %v after cancelled = %v", got.State, cancelled)
+			}
+		})
+	}
+}
+
+func TestServer_CancelJobRefused(t *testing.T) {
+	tests := []struct {
+		name       string
+		cancelErr  error
+		wantStatus uint16
+	}{
+		{"forbidden", &StatusError{Status: StatusClientErrorForbidden}, StatusClientErrorForbidden},
+		{"not authorized", &StatusError{Status: StatusClientErrorNotAuthorized}, StatusClientErrorForbidden},
+		{"not authenticated", &StatusError{Status: StatusClientErrorNotAuthenticated}, StatusClientErrorForbidden},
+		{"not possible", &StatusError{Status: StatusClientErrorNotPossible}, StatusClientErrorNotPossible},
+		{"CUPS failing", errors.New("broken pipe"), StatusServerErrorInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cups := &fakeCUPS{cancelErr: tt.cancelErr}
+			tracker := jobs.NewTracker(cups, zerolog.Nop())
+			s := NewServer(":0", cups, tracker, zerolog.Nop())
+			s.SetPrinters([]PrinterConfig{{Name: "Office"}})
+			job := tracker.Add(jobs.Job{Printer: "Office", User: "alice", CUPSJobID: 100})
+
+			req := goipp.NewRequest(goipp.OperationCancelJob, 1)
+			req.OperationAttributes["printer-uri"] = "ipp://localhost/printers/Office"
+			req.OperationAttributes["job-id"] = job.ID
+			req.OperationAttributes["requesting-user-name"] = "alice"
+			body, err := req.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/printers/Office", bytes.NewReader(body))
+			if status, _ := serve(t, s, r); status != tt.wantStatus {
+				t.Errorf("status = %#04x, want %#04x", status, tt.wantStatus)
+			}
+			if got, _ := tracker.Get(job.ID); got.State == jobs.StateCanceled {
+				t.Error("job marked canceled although CUPS refused")
+			}
+		})
+	}
+}
+
+func TestServer_PrinterState(t *testing.T) {
+	tests := []struct {
+		name        string
+		printer     PrinterConfig
+		wantState   int
+		wantReasons []string
+		wantMessage string
+		wantAccept  bool
+	}{
+		{"idle", PrinterConfig{State: 3}, 3, []string{"none"}, "", true},
+		{"processing", PrinterConfig{State: 4, StateReasons: []string{"toner-low-report"}}, 4, []string{"toner-low-report"}, "", true},
+		{"stopped", PrinterConfig{State: 5, StateReasons: []string{"media-empty-error"}, StateMessage: "Load paper"}, 5, []string{"media-empty-error"}, "Load paper", true},
+		{"stopped without reasons", PrinterConfig{State: 5}, 5, []string{"paused"}, "", true},
+		{"not accepting", PrinterConfig{State: 3, NotAccepting: true}, 5, []string{"paused"}, notAcceptingMessage, false},
+		{"not accepting with message", PrinterConfig{State: 3, NotAccepting: true, StateMessage: "Rejecting Jobs"}, 5, []string{"paused"}, "Rejecting Jobs", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(":0", &fakeCUPS{}, nil, zerolog.Nop())
+			tt.printer.Name = "Office"
+			response := s.handleGetPrinterAttributes(1, tt.printer)
+
+			// Only the state attributes, which go-ipp can decode
+			response = filterAttributes(response, func(group byte, name string) bool {
+				return group != TagPrinterAttrs || name == "printer-state" || name == "printer-state-reasons" ||
+					name == "printer-state-message" || name == "printer-is-accepting-jobs"
+			})
+			resp, err := goipp.NewResponseDecoder(bytes.NewReader(response)).Decode(nil)
+			if err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			attrs := resp.PrinterAttributes[0]
+
+			if state := attrs["printer-state"][0].Value; state != tt.wantState {
+				t.Errorf("printer-state = %v, want %d", state, tt.wantState)
+			}
+			var reasons []string
+			for _, a := range attrs["printer-state-reasons"] {
+				reasons = append(reasons, a.Value.(string))
+			}
+			if !reflect.DeepEqual(reasons, tt.wantReasons) {
+				t.Errorf("printer-state-reasons = %v, want %v", reasons, tt.wantReasons)
+			}
+			var message interface{} = ""
+			if a := attrs["printer-state-message"]; len(a) > 0 {
+				message = a[0].Value
+			}
+			if message != tt.wantMessage {
+				t.Errorf("printer-state-message = %q, want %q", message, tt.wantMessage)
+			}
+			if accepting := attrs["printer-is-accepting-jobs"][0].Value; accepting != tt.wantAccept {
+				t.Errorf("printer-is-accepting-jobs = %v, want %v", accepting, tt.wantAccept)
+			}
+		})
+	}
+}
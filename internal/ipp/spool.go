@@ -0,0 +1,13 @@
+package ipp
+
+import "os"
+
+// SpoolPrefix starts the names of the temporary files documents are spooled
+// to, so their disk usage can be measured
+const SpoolPrefix = "airprint-"
+
+// createSpool creates a temporary file to spool a document to, named after
+// the kind of job that needs it. The caller removes it.
+func createSpool(kind string) (*os.File, error) {
+	return os.CreateTemp("", SpoolPrefix+kind+"-*")
+}
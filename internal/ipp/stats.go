@@ -0,0 +1,70 @@
+package ipp
+
+import (
+	"time"
+)
+
+// JobStats is what a printer's jobs have done since the bridge started
+type JobStats struct {
+	JobsToday   int       // Jobs accepted since local midnight
+	LastJob     time.Time // When the last job was accepted, zero if none
+	LastError   string    // Why the last failed job failed, empty if none has
+	LastErrorAt time.Time
+}
+
+// printerStats is a printer's JobStats along with the day JobsToday counts
+type printerStats struct {
+	JobStats
+	day string
+}
+
+// recordJob counts a job submitted to a printer, or its error if it failed
+func (s *Server) recordJob(printer string, err error) {
+	now := time.Now()
+	day := now.Format("2006-01-02")
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	if s.stats == nil {
+		s.stats = make(map[string]*printerStats)
+	}
+	st, ok := s.stats[printer]
+	if !ok {
+		st = &printerStats{}
+		s.stats[printer] = st
+	}
+	if err != nil {
+		st.LastError = err.Error()
+		st.LastErrorAt = now
+		return
+	}
+	if st.day != day {
+		st.day, st.JobsToday = day, 0
+	}
+	st.JobsToday++
+	st.LastJob = now
+}
+
+// JobStats returns the stats of every printer served, including those
+// without jobs yet
+func (s *Server) JobStats() map[string]JobStats {
+	day := time.Now().Format("2006-01-02")
+	result := make(map[string]JobStats)
+	for _, p := range s.Printers() {
+		result[p.Name] = JobStats{}
+	}
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	for name, st := range s.stats {
+		if _, ok := result[name]; !ok {
+			continue
+		}
+		stats := st.JobStats
+		if st.day != day {
+			stats.JobsToday = 0
+		}
+		result[name] = stats
+	}
+	return result
+}
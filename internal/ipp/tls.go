@@ -0,0 +1,184 @@
+package ipp
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ErrInvalidTLS is returned for unknown TLS versions and cipher suites
+var ErrInvalidTLS = errors.New("invalid TLS setting")
+
+// Session ticket keys are rotated daily and accepted for a week, as Go does
+// with the keys it keeps in memory
+const (
+	sessionKeyLifetime = 24 * time.Hour
+	maxSessionKeys     = 7
+)
+
+// tlsVersions are the TLS versions the IPPS listener may be limited to
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseTLSVersion returns the version for "1.2" or "1.3"
+func ParseTLSVersion(name string) (uint16, error) {
+	v, ok := tlsVersions[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: TLS version %q (use 1.2 or 1.3)", ErrInvalidTLS, name)
+	}
+	return v, nil
+}
+
+// ParseCipherSuites returns the IDs of TLS 1.2 cipher suites named as in
+// Go's crypto/tls, e.g. TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256.
+// Suites with known weaknesses are refused.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: cipher suite %q", ErrInvalidTLS, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// serverTLSConfig builds the IPPS listener's TLS settings. Sessions are
+// resumed with tickets, so the short connections iOS makes skip the full
+// handshake after the first.
+func (s *Server) serverTLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:             s.tls.MinVersion,
+		CipherSuites:           s.tls.CipherSuites,
+		SessionTicketsDisabled: s.tls.NoSessionTickets,
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+	if s.tls.NoSessionTickets || s.tls.SessionKeyFile == "" {
+		return cfg
+	}
+
+	keys := &sessionKeys{path: s.tls.SessionKeyFile, log: s.log}
+	if err := keys.rotate(cfg, time.Now()); err != nil {
+		// Go's own keys still resume sessions, just not across restarts
+		s.log.Warn().Err(err).Msg("failed to load TLS session keys, sessions won't resume across restarts")
+		return cfg
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		if err := keys.rotate(cfg, time.Now()); err != nil {
+			keys.log.Warn().Err(err).Msg("failed to rotate TLS session keys")
+		}
+		return nil, nil
+	}
+	return cfg
+}
+
+// sessionKeys are the session ticket keys of the IPPS listener, kept in a
+// file so clients can resume sessions after a restart or upgrade
+type sessionKeys struct {
+	path string
+	log  zerolog.Logger
+
+	mu      sync.Mutex
+	keys    [][32]byte // Newest first; the first encrypts new tickets
+	rotated time.Time
+}
+
+// rotate loads the keys if they haven't been, adds a new one when the newest
+// is a day old and hands them to cfg
+func (k *sessionKeys) rotate(cfg *tls.Config, now time.Time) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.keys == nil {
+		if err := k.load(); err != nil {
+			return err
+		}
+		if len(k.keys) > 0 {
+			cfg.SetSessionTicketKeys(k.keys)
+		}
+	}
+	if len(k.keys) > 0 && now.Sub(k.rotated) < sessionKeyLifetime {
+		return nil
+	}
+
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return fmt.Errorf("failed to generate session key: %w", err)
+	}
+	keys := append([][32]byte{key}, k.keys...)
+	if len(keys) > maxSessionKeys {
+		keys = keys[:maxSessionKeys]
+	}
+	if err := k.save(keys); err != nil {
+		return err
+	}
+	k.keys = keys
+	k.rotated = now
+	cfg.SetSessionTicketKeys(keys)
+	return nil
+}
+
+// load reads the key file, whose modification time is when the newest key
+// was added. A missing file has no keys yet.
+func (k *sessionKeys) load() error {
+	k.keys = [][32]byte{}
+	data, err := os.ReadFile(k.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read session keys: %w", err)
+	}
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read session keys: %w", err)
+	}
+	for len(data) >= 32 && len(k.keys) < maxSessionKeys {
+		var key [32]byte
+		copy(key[:], data)
+		k.keys = append(k.keys, key)
+		data = data[32:]
+	}
+	k.rotated = info.ModTime()
+	return nil
+}
+
+// save replaces the key file with keys
+func (k *sessionKeys) save(keys [][32]byte) error {
+	data := make([]byte, 0, len(keys)*32)
+	for _, key := range keys {
+		data = append(data, key[:]...)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), filepath.Base(k.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write session keys: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), k.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write session keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package ipp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// transcode converts Apple Raster documents to the printer's configured
+// format and stamps them with its watermark. It returns the document to
+// forward, the options to send with it, and a function to release the
+// converter once forwarding is done.
+func (s *Server) transcode(ctx context.Context, printer PrinterConfig, document io.Reader, spec jobs.Job, options map[string]string) (io.Reader, map[string]string, func()) {
+	if printer.URFConversion == "" && printer.Watermark == "" {
+		return document, options, func() {}
+	}
+	log := jobs.TraceLog(ctx, s.log)
+
+	br, ok := document.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(document)
+	}
+	if !raster.IsURF(br) {
+		if printer.Watermark != "" {
+			log.Debug().Str("printer", printer.Name).Str("format", spec.DocumentFormat).Msg("not stamping job, document is not Apple Raster")
+		}
+		return br, options, func() {}
+	}
+
+	format := printer.URFConversion
+	if format == "" {
+		format = raster.FormatURF
+	}
+	var stamp *raster.Stamp
+	if printer.Watermark != "" {
+		stamp = raster.NewStamp(watermarkText(printer.Watermark, printer.Name, spec))
+	}
+
+	log.Debug().Str("printer", printer.Name).Str("format", format).Bool("stamped", stamp != nil).Msg("converting Apple Raster job")
+
+	// Convert while streaming; closing the reader stops the converter if
+	// CUPS gives up before reading everything
+	pr, pw := io.Pipe()
+	go func() {
+		err := raster.ConvertURFStamped(pw, br, format, stamp)
+		if err != nil && err != io.ErrClosedPipe {
+			log.Error().Err(err).Str("printer", printer.Name).Msg("failed to convert Apple Raster job")
+		}
+		pw.CloseWithError(err)
+	}()
+
+	converted := make(map[string]string, len(options)+1)
+	for k, v := range options {
+		converted[k] = v
+	}
+	converted["document-format"] = format
+
+	return pr, converted, func() { pr.Close() }
+}
+
+// watermarkText fills in the placeholders of a watermark: {user}, {job},
+// {printer}, {date} and {time}
+func watermarkText(text, printer string, spec jobs.Job) string {
+	now := time.Now()
+	return strings.NewReplacer(
+		"{user}", spec.User,
+		"{job}", spec.Name,
+		"{printer}", printer,
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("2006-01-02 15:04"),
+	).Replace(text)
+}
@@ -0,0 +1,114 @@
+package ipp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/raster"
+)
+
+// ErrInvalidTransforms is returned for transforms naming an unknown format
+// or scaling mode
+var ErrInvalidTransforms = errors.New("invalid transforms")
+
+// Transforms are the changes made to a printer's jobs on their way to CUPS.
+// They can be replaced at runtime, without touching listeners or other
+// printers; jobs already being forwarded keep the ones they started with.
+type Transforms struct {
+	URFConversion  string   `json:"urf_conversion,omitempty"`  // Format image/urf jobs are converted to
+	FormatFallback []string `json:"format_fallback,omitempty"` // Formats image/urf jobs are retried in
+	Watermark      string   `json:"watermark,omitempty"`
+	Scaling        string   `json:"scaling,omitempty"`       // print-scaling used when the client asks for none
+	ForceScaling   bool     `json:"force_scaling,omitempty"` // Ignore the client's print-scaling
+}
+
+// transforms returns the printer's transforms
+func (p PrinterConfig) transforms() Transforms {
+	return Transforms{
+		URFConversion:  p.URFConversion,
+		FormatFallback: p.FormatFallback,
+		Watermark:      p.Watermark,
+		Scaling:        p.Scaling.Default,
+		ForceScaling:   p.Scaling.Force,
+	}
+}
+
+// withTransforms returns the printer with its transforms replaced by t
+func (p PrinterConfig) withTransforms(t Transforms) PrinterConfig {
+	p.URFConversion = t.URFConversion
+	p.FormatFallback = t.FormatFallback
+	p.Watermark = t.Watermark
+	p.Scaling = Scaling{Default: t.Scaling, Force: t.ForceScaling}
+	return p
+}
+
+// validate checks the transforms only name formats and modes the bridge
+// supports
+func (t Transforms) validate() error {
+	switch t.URFConversion {
+	case "", raster.FormatPDF, raster.FormatPWG:
+	default:
+		return fmt.Errorf("%w: urf_conversion %q (use %s or %s)", ErrInvalidTransforms, t.URFConversion, raster.FormatPDF, raster.FormatPWG)
+	}
+	for _, f := range t.FormatFallback {
+		switch f {
+		case raster.FormatURF, raster.FormatPWG, raster.FormatPDF:
+		default:
+			return fmt.Errorf("%w: format_fallback %q", ErrInvalidTransforms, f)
+		}
+	}
+	if t.Scaling != "" && !contains(PrintScalingModes, t.Scaling) {
+		return fmt.Errorf("%w: scaling %q", ErrInvalidTransforms, t.Scaling)
+	}
+	return nil
+}
+
+// SetTransforms replaces a printer's transforms until ClearTransforms,
+// overriding the configured ones across reloads but not restarts
+func (s *Server) SetTransforms(name string, t Transforms) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.printers[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPrinter, name)
+	}
+	s.transforms[name] = t
+	s.printers[name] = p.withTransforms(t)
+
+	s.log.Info().Str("printer", name).Strs("pipeline", s.printers[name].Pipeline()).Msg("printer transforms changed")
+	return nil
+}
+
+// ClearTransforms returns a printer to its configured transforms
+func (s *Server) ClearTransforms(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.transforms[name]; !ok {
+		return
+	}
+	delete(s.transforms, name)
+	if p, ok := s.printers[name]; ok {
+		s.printers[name] = p.withTransforms(s.configured[name])
+	}
+	s.log.Info().Str("printer", name).Msg("printer transforms reset to configured")
+}
+
+// Transforms returns a printer's current transforms and whether they were
+// set at runtime rather than configured
+func (s *Server) Transforms(name string) (Transforms, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.printers[name]
+	if !ok {
+		return Transforms{}, false, fmt.Errorf("%w: %s", ErrUnknownPrinter, name)
+	}
+	_, overridden := s.transforms[name]
+	return p.transforms(), overridden, nil
+}
@@ -0,0 +1,301 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotArchived is returned for jobs that aren't, or are no longer, in the
+// archive
+var ErrNotArchived = errors.New("job not in archive")
+
+// ErrOverQuota is returned when a document alone is larger than its
+// printer's archive quota
+var ErrOverQuota = errors.New("document exceeds archive quota")
+
+// Archived describes a printed document kept so it can be printed again
+type Archived struct {
+	ID             int               `json:"id"`
+	JobID          int               `json:"job_id"` // Job ID it was first printed as
+	TraceID        string            `json:"trace_id,omitempty"`
+	Printer        string            `json:"printer"`
+	Name           string            `json:"name"`
+	User           string            `json:"user,omitempty"`
+	DocumentFormat string            `json:"document_format,omitempty"`
+	Options        map[string]string `json:"options,omitempty"`
+	Size           int64             `json:"size"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// Archive keeps printed documents on disk, each as <id>.doc with its
+// description in <id>.json, until they are older than maxAge or pushed out
+// by newer documents for the same printer
+type Archive struct {
+	dir    string
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	nextID  int
+	quota   int64            // Bytes kept per printer, 0 for no limit
+	quotas  map[string]int64 // printer -> bytes, overriding quota
+	onEvict func(Archived)
+	now     func() time.Time
+}
+
+// NewArchive opens or creates an archive in dir. A maxAge of 0 keeps
+// documents until they are removed by hand.
+func NewArchive(dir string, maxAge time.Duration) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	a := &Archive{dir: dir, maxAge: maxAge, nextID: 1, now: func() time.Time { return time.Now().UTC() }}
+
+	// Carry on numbering after the newest archived job
+	entries, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.ID >= a.nextID {
+			a.nextID = e.ID + 1
+		}
+	}
+	return a, nil
+}
+
+// SetQuotas limits the bytes of documents kept for each printer to quota,
+// or to perPrinter[name] where set. A limit of 0 means none. Keeping a
+// document evicts the printer's oldest ones until it fits.
+func (a *Archive) SetQuotas(quota int64, perPrinter map[string]int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.quota = quota
+	a.quotas = perPrinter
+}
+
+// SetEvictHandler sets a function called for each document evicted to make
+// room for a newer one
+func (a *Archive) SetEvictHandler(fn func(Archived)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onEvict = fn
+}
+
+// quotaFor returns the printer's quota in bytes, 0 for no limit
+func (a *Archive) quotaFor(printer string) int64 {
+	if q, ok := a.quotas[printer]; ok {
+		return q
+	}
+	return a.quota
+}
+
+// Spool is a document being archived while it prints. Write the document to
+// it, then call Keep once the job is accepted or Discard if it isn't.
+type Spool struct {
+	archive *Archive
+	file    *os.File
+	size    int64
+	limit   int64 // The printer's quota, 0 for no limit
+	over    bool  // The document outgrew the quota and is no longer written
+}
+
+// Spool starts archiving a document for printer
+func (a *Archive) Spool(printer string) (*Spool, error) {
+	f, err := os.CreateTemp(a.dir, "spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive spool: %w", err)
+	}
+	a.mu.Lock()
+	limit := a.quotaFor(printer)
+	a.mu.Unlock()
+	return &Spool{archive: a, file: f, limit: limit}, nil
+}
+
+// Write adds to the document. Once the document is larger than the quota
+// the rest is dropped, without failing, so the job still prints.
+func (s *Spool) Write(p []byte) (int, error) {
+	if s.over {
+		return len(p), nil
+	}
+	if s.limit > 0 && s.size+int64(len(p)) > s.limit {
+		s.over = true
+		s.file.Truncate(0)
+		return len(p), nil
+	}
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// Keep stores the document with the given description, filling in its ID,
+// size and time
+func (s *Spool) Keep(entry Archived) (Archived, error) {
+	a := s.archive
+	if err := s.file.Close(); err != nil {
+		os.Remove(s.file.Name())
+		return Archived{}, fmt.Errorf("failed to write archived document: %w", err)
+	}
+	if s.over {
+		os.Remove(s.file.Name())
+		return Archived{}, fmt.Errorf("%w of %d bytes for %s", ErrOverQuota, s.limit, entry.Printer)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.ID = a.nextID
+	entry.Size = s.size
+	entry.CreatedAt = a.now()
+
+	if err := os.Rename(s.file.Name(), a.path(entry.ID, ".doc")); err != nil {
+		os.Remove(s.file.Name())
+		return Archived{}, fmt.Errorf("failed to store archived document: %w", err)
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = os.WriteFile(a.path(entry.ID, ".json"), data, 0o600)
+	}
+	if err != nil {
+		os.Remove(a.path(entry.ID, ".doc"))
+		return Archived{}, fmt.Errorf("failed to store archived job: %w", err)
+	}
+	a.nextID++
+	a.evict(entry.Printer)
+	return entry, nil
+}
+
+// evict removes the printer's oldest documents until they fit its quota.
+// a.mu must be held.
+func (a *Archive) evict(printer string) {
+	limit := a.quotaFor(printer)
+	if limit <= 0 {
+		return
+	}
+	entries, err := a.List()
+	if err != nil {
+		return
+	}
+	var used int64
+	for _, e := range entries {
+		if e.Printer != printer {
+			continue
+		}
+		// Newest first, so everything past the quota is older
+		used += e.Size
+		if used <= limit {
+			continue
+		}
+		os.Remove(a.path(e.ID, ".doc"))
+		if err := os.Remove(a.path(e.ID, ".json")); err == nil && a.onEvict != nil {
+			a.onEvict(e)
+		}
+	}
+}
+
+// Usage returns the bytes of documents kept for each printer
+func (a *Archive) Usage() (map[string]int64, error) {
+	entries, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[string]int64)
+	for _, e := range entries {
+		usage[e.Printer] += e.Size
+	}
+	return usage, nil
+}
+
+// Discard throws the document away
+func (s *Spool) Discard() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// List returns the archived jobs, newest first
+func (a *Archive) List() ([]Archived, error) {
+	files, err := filepath.Glob(filepath.Join(a.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Archived, 0, len(files))
+	for _, file := range files {
+		id, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			continue
+		}
+		entry, err := a.read(id)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	return entries, nil
+}
+
+// Open returns an archived job and its document, which the caller must close
+func (a *Archive) Open(id int) (Archived, io.ReadCloser, error) {
+	entry, err := a.read(id)
+	if err != nil {
+		return Archived{}, nil, err
+	}
+	f, err := os.Open(a.path(id, ".doc"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Archived{}, nil, fmt.Errorf("%w: %d", ErrNotArchived, id)
+		}
+		return Archived{}, nil, fmt.Errorf("failed to open archived document: %w", err)
+	}
+	return entry, f, nil
+}
+
+// Prune removes jobs older than the archive's maximum age and returns how
+// many were removed
+func (a *Archive) Prune() (int, error) {
+	if a.maxAge <= 0 {
+		return 0, nil
+	}
+	entries, err := a.List()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := a.now().Add(-a.maxAge)
+	removed := 0
+	for _, e := range entries {
+		if e.CreatedAt.After(cutoff) {
+			continue
+		}
+		os.Remove(a.path(e.ID, ".doc"))
+		if err := os.Remove(a.path(e.ID, ".json")); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (a *Archive) read(id int) (Archived, error) {
+	data, err := os.ReadFile(a.path(id, ".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Archived{}, fmt.Errorf("%w: %d", ErrNotArchived, id)
+		}
+		return Archived{}, fmt.Errorf("failed to read archived job: %w", err)
+	}
+	var entry Archived
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Archived{}, fmt.Errorf("failed to parse archived job %d: %w", id, err)
+	}
+	return entry, nil
+}
+
+func (a *Archive) path(id int, ext string) string {
+	return filepath.Join(a.dir, strconv.Itoa(id)+ext)
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewArchive(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000, 0)
+	a.now = func() time.Time { return now }
+
+	keep := func(doc string, entry Archived) Archived {
+		t.Helper()
+		spool, err := a.Spool("Zebra")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(spool, doc); err != nil {
+			t.Fatal(err)
+		}
+		kept, err := spool.Keep(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return kept
+	}
+
+	first := keep("label one", Archived{JobID: 7, Printer: "Zebra", Name: "Label"})
+	if first.ID != 1 || first.Size != 9 || !first.CreatedAt.Equal(now) {
+		t.Errorf("Keep() = %+v, want ID 1, size 9", first)
+	}
+
+	spool, err := a.Spool("Zebra")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool.Discard()
+
+	now = now.Add(30 * time.Minute)
+	second := keep("label two", Archived{JobID: 8, Printer: "Zebra", Options: map[string]string{"copies": "2"}})
+
+	list, err := a.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != second.ID || list[1].ID != first.ID {
+		t.Fatalf("List() = %+v, want jobs 2 and 1", list)
+	}
+
+	entry, doc, err := a.Open(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(doc)
+	doc.Close()
+	if string(data) != "label two" || entry.Options["copies"] != "2" {
+		t.Errorf("Open() = %+v, %q", entry, data)
+	}
+
+	// IDs carry on after a restart
+	reopened, err := NewArchive(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.nextID != 3 {
+		t.Errorf("nextID after reopening = %d, want 3", reopened.nextID)
+	}
+
+	now = now.Add(45 * time.Minute)
+	if removed, err := a.Prune(); err != nil || removed != 1 {
+		t.Errorf("Prune() = %d, %v; want 1", removed, err)
+	}
+	if _, _, err := a.Open(first.ID); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("Open(pruned) error = %v, want ErrNotArchived", err)
+	}
+}
+
+func TestArchive_Quota(t *testing.T) {
+	a, err := NewArchive(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetQuotas(20, map[string]int64{"Plotter": 0})
+	var evicted []int
+	a.SetEvictHandler(func(e Archived) { evicted = append(evicted, e.ID) })
+
+	keep := func(printer, doc string) (Archived, error) {
+		t.Helper()
+		spool, err := a.Spool(printer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := io.WriteString(spool, doc); err != nil || n != len(doc) {
+			t.Fatalf("Write() = %d, %v", n, err)
+		}
+		return spool.Keep(Archived{Printer: printer})
+	}
+
+	for _, doc := range []string{"0123456789", "0123456789", "01234"} {
+		if _, err := keep("Zebra", doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := keep("Plotter", strings.Repeat("x", 100)); err != nil {
+		t.Errorf("Keep() with no quota error = %v", err)
+	}
+	// The oldest Zebra document made room for the third
+	if len(evicted) != 1 || evicted[0] != 1 {
+		t.Errorf("evicted %v, want [1]", evicted)
+	}
+
+	// Too large to keep at all, but still written without error
+	if _, err := keep("Zebra", strings.Repeat("x", 21)); !errors.Is(err, ErrOverQuota) {
+		t.Errorf("Keep() error = %v, want ErrOverQuota", err)
+	}
+
+	usage, err := a.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage["Zebra"] != 15 || usage["Plotter"] != 100 {
+		t.Errorf("Usage() = %v, want Zebra 15, Plotter 100", usage)
+	}
+}
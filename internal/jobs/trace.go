@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/rs/zerolog"
+)
+
+// traceKey is the context key of a job's trace ID
+type traceKey struct{}
+
+// NewTraceID returns a random ID that follows one job through the bridge's
+// logs and webhooks, and optionally its CUPS job name
+func NewTraceID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// WithTraceID returns a context carrying a job's trace ID
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceKey{}, id)
+}
+
+// TraceID returns the trace ID ctx carries, or ""
+func TraceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+// TraceLog returns log with the trace ID ctx carries, if any
+func TraceLog(ctx context.Context, log zerolog.Logger) *zerolog.Logger {
+	if id := TraceID(ctx); id != "" {
+		log = log.With().Str("trace_id", id).Logger()
+	}
+	return &log
+}
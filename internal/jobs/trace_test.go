@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTraceID(t *testing.T) {
+	if got := TraceID(context.Background()); got != "" {
+		t.Errorf("TraceID(no trace) = %q, want empty", got)
+	}
+
+	id := NewTraceID()
+	if len(id) != 16 {
+		t.Errorf("NewTraceID() = %q, want 16 hex digits", id)
+	}
+	if other := NewTraceID(); other == id {
+		t.Errorf("NewTraceID() returned %q twice", id)
+	}
+	if got := TraceID(WithTraceID(context.Background(), id)); got != id {
+		t.Errorf("TraceID() = %q, want %q", got, id)
+	}
+}
@@ -0,0 +1,331 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// IPP job states (RFC 8011 section 5.3.7)
+const (
+	StatePending           = 3
+	StatePendingHeld       = 4
+	StateProcessing        = 5
+	StateProcessingStopped = 6
+	StateCanceled          = 7
+	StateAborted           = 8
+	StateCompleted         = 9
+)
+
+// stateNames are the job-state keywords of the IPP job states
+var stateNames = map[int]string{
+	StatePending:           "pending",
+	StatePendingHeld:       "pending-held",
+	StateProcessing:        "processing",
+	StateProcessingStopped: "processing-stopped",
+	StateCanceled:          "canceled",
+	StateAborted:           "aborted",
+	StateCompleted:         "completed",
+}
+
+// StateName returns the job-state keyword of an IPP job state, e.g.
+// "processing", or "unknown"
+func StateName(state int) string {
+	if name, ok := stateNames[state]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Job is a print job submitted through the bridge
+type Job struct {
+	ID                   int    // Job ID exposed to AirPrint clients
+	CUPSJobID            int    // Job ID assigned by CUPS
+	TraceID              string // Follows the job through logs and webhooks
+	Printer              string
+	Name                 string
+	User                 string
+	DocumentFormat       string
+	State                int
+	StateReasons         []string
+	ImpressionsCompleted int
+	CreatedAt            time.Time
+	CompletedAt          time.Time
+}
+
+// Done returns true once the job has reached a terminal state
+func (j *Job) Done() bool {
+	return j.State >= StateCanceled
+}
+
+// Status is the job status reported by CUPS
+type Status struct {
+	State                int
+	StateReasons         []string
+	ImpressionsCompleted int
+}
+
+// ErrJobNotFound is returned by status sources for jobs CUPS no longer
+// knows, e.g. because it purged them from its job history
+var ErrJobNotFound = errors.New("job not found")
+
+// StatusSource queries CUPS for the status of a job
+type StatusSource interface {
+	JobStatus(cupsJobID int) (Status, error)
+}
+
+// Tracker maps AirPrint job IDs to CUPS jobs and keeps their state current
+type Tracker struct {
+	source     StatusSource
+	retention  time.Duration // How long finished jobs are kept for Get-Jobs
+	staleAfter time.Duration // How long an active job's status may be unknown before it's given up on
+	log        zerolog.Logger
+
+	mu      sync.RWMutex
+	jobs    map[int]*Job
+	checked map[int]time.Time // Job ID -> when its status was last known
+	nextID  int
+}
+
+// NewTracker creates a job tracker polling the given status source
+func NewTracker(source StatusSource, log zerolog.Logger) *Tracker {
+	return &Tracker{
+		source:     source,
+		retention:  time.Hour,
+		staleAfter: 24 * time.Hour,
+		log:        log.With().Str("component", "job-tracker").Logger(),
+		jobs:       make(map[int]*Job),
+		checked:    make(map[int]time.Time),
+		nextID:     1,
+	}
+}
+
+// Add registers a job accepted by CUPS and returns it with its AirPrint job ID
+func (t *Tracker) Add(job Job) Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job.ID = t.nextID
+	t.nextID++
+	if job.State == 0 {
+		job.State = StatePending
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+
+	t.jobs[job.ID] = &job
+	t.checked[job.ID] = time.Now()
+	return job
+}
+
+// Snapshot returns every tracked job, ordered by ID, and the next job ID,
+// so they can be restored after a restart
+func (t *Tracker) Snapshot() ([]Job, int) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]Job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		result = append(result, *j)
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].ID < result[b].ID })
+	return result, t.nextID
+}
+
+// Restore tracks jobs from a Snapshot taken before a restart and carries on
+// numbering after them, so clients never see a job ID reused
+func (t *Tracker) Restore(jobs []Job, nextID int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, j := range jobs {
+		j := j
+		t.jobs[j.ID] = &j
+		t.checked[j.ID] = now
+		if j.ID >= nextID {
+			nextID = j.ID + 1
+		}
+	}
+	if nextID > t.nextID {
+		t.nextID = nextID
+	}
+}
+
+// Get returns a job by its AirPrint job ID
+func (t *Tracker) Get(id int) (Job, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	j, ok := t.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// List returns the jobs for a printer ordered by ID. which follows the IPP
+// which-jobs keyword: "completed", "not-completed" (default) or "all".
+func (t *Tracker) List(printer, which string) []Job {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var result []Job
+	for _, j := range t.jobs {
+		if printer != "" && j.Printer != printer {
+			continue
+		}
+		switch which {
+		case "all":
+		case "completed":
+			if !j.Done() {
+				continue
+			}
+		default:
+			if j.Done() {
+				continue
+			}
+		}
+		result = append(result, *j)
+	}
+
+	sort.Slice(result, func(a, b int) bool { return result[a].ID < result[b].ID })
+	return result
+}
+
+// Queued returns the number of jobs for a printer that are waiting or
+// printing. Held jobs don't count, since they wait for their owner rather
+// than for the printer.
+func (t *Tracker) Queued(printer string) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	n := 0
+	for _, j := range t.jobs {
+		if j.Printer == printer && !j.Done() && j.State != StatePendingHeld {
+			n++
+		}
+	}
+	return n
+}
+
+// Move records that a job was moved to another printer
+func (t *Tracker) Move(id int, printer string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if j, ok := t.jobs[id]; ok {
+		j.Printer = printer
+	}
+}
+
+// Update applies a status change to a job
+func (t *Tracker) Update(id int, status Status) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	j, ok := t.jobs[id]
+	if !ok {
+		return
+	}
+	t.checked[id] = time.Now()
+	t.apply(j, status)
+}
+
+func (t *Tracker) apply(j *Job, status Status) {
+	if status.State != 0 && status.State != j.State {
+		t.log.Debug().
+			Int("job_id", j.ID).
+			Int("cups_job_id", j.CUPSJobID).
+			Str("trace_id", j.TraceID).
+			Int("state", status.State).
+			Strs("reasons", status.StateReasons).
+			Msg("job state changed")
+	}
+
+	if status.State != 0 {
+		j.State = status.State
+	}
+	if len(status.StateReasons) > 0 {
+		j.StateReasons = status.StateReasons
+	}
+	j.ImpressionsCompleted = status.ImpressionsCompleted
+
+	if j.Done() && j.CompletedAt.IsZero() {
+		j.CompletedAt = time.Now().UTC()
+	}
+}
+
+// Refresh polls CUPS for every job that hasn't finished yet
+func (t *Tracker) Refresh() {
+	t.mu.RLock()
+	active := make(map[int]int)
+	for id, j := range t.jobs {
+		if !j.Done() {
+			active[id] = j.CUPSJobID
+		}
+	}
+	t.mu.RUnlock()
+
+	for id, cupsJobID := range active {
+		status, err := t.source.JobStatus(cupsJobID)
+		if errors.Is(err, ErrJobNotFound) {
+			// CUPS only forgets finished jobs, and this one would otherwise
+			// stay active, and count towards its printer's queue, forever
+			t.log.Debug().Err(err).Int("job_id", id).Int("cups_job_id", cupsJobID).Msg("job gone from CUPS, marking it completed")
+			status = Status{State: StateCompleted}
+		} else if err != nil && t.stale(id) {
+			// Left active, it would hold a place in its printer's queue
+			// for good, even across restarts
+			t.log.Warn().Err(err).Int("job_id", id).Int("cups_job_id", cupsJobID).Dur("unknown_for", t.staleAfter).Msg("job status unknown for too long, marking it aborted")
+			status = Status{State: StateAborted, StateReasons: []string{"aborted-by-system"}}
+		} else if err != nil {
+			t.log.Debug().Err(err).Int("job_id", id).Int("cups_job_id", cupsJobID).Msg("failed to query job status")
+			continue
+		}
+		t.Update(id, status)
+	}
+}
+
+// stale reports whether a job's status has been unknown for too long
+func (t *Tracker) stale(id int) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	checked, ok := t.checked[id]
+	return ok && time.Since(checked) > t.staleAfter
+}
+
+// prune drops finished jobs older than the retention period
+func (t *Tracker) prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cutoff := time.Now().Add(-t.retention)
+	for id, j := range t.jobs {
+		if j.Done() && j.CompletedAt.Before(cutoff) {
+			delete(t.jobs, id)
+			delete(t.checked, id)
+		}
+	}
+}
+
+// Run polls CUPS at the given interval until the context is cancelled
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.Refresh()
+			t.prune()
+		}
+	}
+}
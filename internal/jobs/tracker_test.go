@@ -0,0 +1,212 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type fakeSource map[int]Status
+
+func (f fakeSource) JobStatus(cupsJobID int) (Status, error) {
+	return f[cupsJobID], nil
+}
+
+func TestTracker_AddAssignsIDs(t *testing.T) {
+	tr := NewTracker(fakeSource{}, zerolog.Nop())
+
+	first := tr.Add(Job{CUPSJobID: 100, Printer: "A"})
+	second := tr.Add(Job{CUPSJobID: 200, Printer: "A"})
+
+	if first.ID != 1 || second.ID != 2 {
+		t.Errorf("IDs = %d, %d, want 1, 2", first.ID, second.ID)
+	}
+	if first.State != StatePending {
+		t.Errorf("initial state = %d, want %d", first.State, StatePending)
+	}
+
+	got, ok := tr.Get(second.ID)
+	if !ok || got.CUPSJobID != 200 {
+		t.Errorf("Get(%d) = %+v, %v", second.ID, got, ok)
+	}
+}
+
+func TestTracker_Refresh(t *testing.T) {
+	source := fakeSource{
+		100: {State: StateProcessing, StateReasons: []string{"job-printing"}, ImpressionsCompleted: 1},
+		200: {State: StateCompleted, StateReasons: []string{"job-completed-successfully"}, ImpressionsCompleted: 2},
+	}
+	tr := NewTracker(source, zerolog.Nop())
+	a := tr.Add(Job{CUPSJobID: 100, Printer: "A"})
+	b := tr.Add(Job{CUPSJobID: 200, Printer: "A"})
+
+	tr.Refresh()
+
+	got, _ := tr.Get(a.ID)
+	if got.State != StateProcessing || got.ImpressionsCompleted != 1 {
+		t.Errorf("job %d = %+v, want processing with 1 impression", a.ID, got)
+	}
+
+	got, _ = tr.Get(b.ID)
+	if !got.Done() || got.CompletedAt.IsZero() {
+		t.Errorf("job %d = %+v, want completed with completion time", b.ID, got)
+	}
+}
+
+// errSource fails every status query with its error
+type errSource struct{ err error }
+
+func (e errSource) JobStatus(int) (Status, error) {
+	return Status{}, e.err
+}
+
+func TestTracker_RefreshError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		unknown   time.Duration // How long the job's status has been unknown
+		wantState int
+	}{
+		{"job not found", ErrJobNotFound, 0, StateCompleted},
+		{"wrapped job not found", fmt.Errorf("%w: client-error-not-found", ErrJobNotFound), 0, StateCompleted},
+		{"CUPS unreachable", errors.New("connection refused"), time.Hour, StateProcessing},
+		{"unknown for a day", errors.New("connection refused"), 25 * time.Hour, StateAborted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker(errSource{tt.err}, zerolog.Nop())
+			j := tr.Add(Job{CUPSJobID: 100, Printer: "A", State: StateProcessing})
+			tr.checked[j.ID] = time.Now().Add(-tt.unknown)
+
+			tr.Refresh()
+
+			got, _ := tr.Get(j.ID)
+			if got.State != tt.wantState {
+				t.Fatalf("job state = %d, want %d", got.State, tt.wantState)
+			}
+			if got.Done() && got.CompletedAt.IsZero() {
+				t.Error("finished job has no completion time")
+			}
+			wantQueued := 1
+			if got.Done() {
+				wantQueued = 0
+			}
+			if queued := tr.Queued("A"); queued != wantQueued {
+				t.Errorf("Queued(A) = %d, want %d", queued, wantQueued)
+			}
+			if active := tr.List("A", "not-completed"); len(active) != wantQueued {
+				t.Errorf("List(A, not-completed) returned %d jobs, want %d", len(active), wantQueued)
+			}
+		})
+	}
+}
+
+func TestTracker_List(t *testing.T) {
+	source := fakeSource{
+		2: {State: StateCompleted},
+	}
+	tr := NewTracker(source, zerolog.Nop())
+	tr.Add(Job{CUPSJobID: 1, Printer: "A"})
+	tr.Add(Job{CUPSJobID: 2, Printer: "A"})
+	tr.Add(Job{CUPSJobID: 3, Printer: "B"})
+	tr.Refresh()
+
+	tests := []struct {
+		printer string
+		which   string
+		want    int
+	}{
+		{"A", "", 1},
+		{"A", "not-completed", 1},
+		{"A", "completed", 1},
+		{"A", "all", 2},
+		{"B", "all", 1},
+		{"", "all", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.printer+"/"+tt.which, func(t *testing.T) {
+			got := tr.List(tt.printer, tt.which)
+			if len(got) != tt.want {
+				t.Errorf("List(%q, %q) returned %d jobs, want %d", tt.printer, tt.which, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker_Move(t *testing.T) {
+	tr := NewTracker(fakeSource{}, zerolog.Nop())
+	j := tr.Add(Job{CUPSJobID: 1, Printer: "A", State: StatePendingHeld})
+
+	tr.Move(j.ID, "B")
+
+	if got := tr.List("B", ""); len(got) != 1 || got[0].State != StatePendingHeld {
+		t.Errorf("List(B) = %+v, want the moved held job", got)
+	}
+	if got := tr.List("A", "all"); len(got) != 0 {
+		t.Errorf("List(A) = %+v, want none", got)
+	}
+}
+
+func TestTracker_Queued(t *testing.T) {
+	tr := NewTracker(fakeSource{}, zerolog.Nop())
+	tr.Add(Job{CUPSJobID: 1, Printer: "A"})
+	tr.Add(Job{CUPSJobID: 2, Printer: "A", State: StateProcessing})
+	tr.Add(Job{CUPSJobID: 3, Printer: "A", State: StatePendingHeld})
+	tr.Add(Job{CUPSJobID: 4, Printer: "A", State: StateCompleted})
+	tr.Add(Job{CUPSJobID: 5, Printer: "B"})
+
+	if got := tr.Queued("A"); got != 2 {
+		t.Errorf("Queued(A) = %d, want 2", got)
+	}
+	if got := tr.Queued("C"); got != 0 {
+		t.Errorf("Queued(C) = %d, want 0", got)
+	}
+}
+
+func TestTracker_SnapshotRestore(t *testing.T) {
+	tr := NewTracker(fakeSource{}, zerolog.Nop())
+	tr.Add(Job{CUPSJobID: 100, Printer: "A"})
+	tr.Add(Job{CUPSJobID: 200, Printer: "B", State: StatePendingHeld})
+
+	saved, next := tr.Snapshot()
+	if len(saved) != 2 || saved[0].ID != 1 || saved[1].ID != 2 || next != 3 {
+		t.Fatalf("Snapshot() = %+v, %d", saved, next)
+	}
+
+	restored := NewTracker(fakeSource{}, zerolog.Nop())
+	restored.Restore(saved, next)
+	if got, ok := restored.Get(2); !ok || got.CUPSJobID != 200 || got.State != StatePendingHeld {
+		t.Errorf("Get(2) after Restore = %+v, %v", got, ok)
+	}
+	if job := restored.Add(Job{CUPSJobID: 300}); job.ID != 3 {
+		t.Errorf("next ID after Restore = %d, want 3", job.ID)
+	}
+
+	// A next ID behind the restored jobs doesn't reuse their IDs
+	behind := NewTracker(fakeSource{}, zerolog.Nop())
+	behind.Restore(saved, 0)
+	if job := behind.Add(Job{CUPSJobID: 300}); job.ID != 3 {
+		t.Errorf("next ID after Restore with stale next = %d, want 3", job.ID)
+	}
+}
+
+func TestStateName(t *testing.T) {
+	tests := []struct {
+		state int
+		want  string
+	}{
+		{StatePending, "pending"},
+		{StateProcessingStopped, "processing-stopped"},
+		{StateCompleted, "completed"},
+		{0, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := StateName(tt.state); got != tt.want {
+			t.Errorf("StateName(%d) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
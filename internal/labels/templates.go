@@ -0,0 +1,134 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Document formats sent to CUPS for rendered labels
+const (
+	FormatRaw  = "application/vnd.cups-raw" // Passed to the printer unfiltered (ZPL)
+	FormatText = "text/plain"
+)
+
+// templateFormats maps template file extensions to document formats
+var templateFormats = map[string]string{
+	".zpl": FormatRaw,
+	".txt": FormatText,
+}
+
+// Template is a named label template rendered from structured fields
+type Template struct {
+	Name   string
+	Format string // Document format of the rendered output
+	tmpl   *template.Template
+}
+
+// Registry holds the label templates loaded from a directory
+type Registry struct {
+	templates map[string]*Template
+}
+
+// NewRegistry creates a registry holding the given templates
+func NewRegistry(templates ...*Template) *Registry {
+	r := &Registry{templates: make(map[string]*Template)}
+	for _, t := range templates {
+		r.templates[t.Name] = t
+	}
+	return r
+}
+
+// Load reads every supported template in dir. The template name is the file
+// name without its extension, e.g. "shipping.zpl" is "shipping".
+func Load(dir string) (*Registry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template directory: %w", err)
+	}
+
+	r := NewRegistry()
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		format, ok := templateFormats[ext]
+		if !ok {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %w", e.Name(), err)
+		}
+
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		t, err := Parse(name, format, string(data))
+		if err != nil {
+			return nil, err
+		}
+		r.templates[name] = t
+	}
+
+	return r, nil
+}
+
+// Parse compiles a single template. Fields referenced by the template must be
+// supplied when rendering.
+func Parse(name, format, text string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+	}
+	return &Template{Name: name, Format: format, tmpl: tmpl}, nil
+}
+
+// Get returns a template by name
+func (r *Registry) Get(name string) (*Template, bool) {
+	t, ok := r.templates[name]
+	return t, ok
+}
+
+// Names returns all template names in sorted order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.templates))
+	for name := range r.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render fills the template with the given fields. For raw ZPL templates the
+// ZPL command prefixes are stripped from field values so data can't inject
+// printer commands.
+func (t *Template) Render(fields map[string]string) ([]byte, error) {
+	data := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if t.Format == FormatRaw {
+			v = sanitizeZPL(v)
+		}
+		data[k] = v
+	}
+
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", t.Name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sanitizeZPL removes the ZPL format (^) and control (~) command prefixes
+func sanitizeZPL(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '^' || r == '~' {
+			return ' '
+		}
+		return r
+	}, s)
+}
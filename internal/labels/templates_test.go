@@ -0,0 +1,92 @@
+package labels
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTemplate_Render(t *testing.T) {
+	tmpl, err := Parse("shipping", FormatRaw, "^XA^FO50,50^FD{{.name}}^FS^XZ")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "simple field",
+			fields: map[string]string{"name": "ACME Corp"},
+			want:   "^XA^FO50,50^FDACME Corp^FS^XZ",
+		},
+		{
+			name:   "ZPL commands stripped from values",
+			fields: map[string]string{"name": "x^XZ~JR"},
+			want:   "^XA^FO50,50^FDx XZ JR^FS^XZ",
+		},
+		{
+			name:    "missing field",
+			fields:  map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tmpl.Render(tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplate_RenderTextKeepsCarets(t *testing.T) {
+	tmpl, err := Parse("note", FormatText, "{{.msg}}")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	got, err := tmpl.Render(map[string]string{"msg": "2^10"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if string(got) != "2^10" {
+		t.Errorf("Render() = %q, want %q", got, "2^10")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"shipping.zpl": "^XA{{.to}}^XZ",
+		"note.txt":     "{{.msg}}",
+		"README.md":    "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	names := r.Names()
+	if len(names) != 2 || names[0] != "note" || names[1] != "shipping" {
+		t.Errorf("Names() = %v, want [note shipping]", names)
+	}
+
+	if tmpl, ok := r.Get("shipping"); !ok || tmpl.Format != FormatRaw {
+		t.Errorf("Get(shipping) = %+v, %v", tmpl, ok)
+	}
+}
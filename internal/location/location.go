@@ -0,0 +1,99 @@
+package location
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// cacheTTL is how long a looked-up location is reused before asking the
+// sources again
+const cacheTTL = 10 * time.Minute
+
+// Source derives a printer's location from some external metadata
+type Source interface {
+	// Name identifies the source in logs
+	Name() string
+	// Lookup returns the location of a queue, or "" if the source has none
+	Lookup(p cups.Printer) (string, error)
+}
+
+// Resolver fills in printer locations from a list of sources, trying them in
+// order until one returns a location
+type Resolver struct {
+	sources  []Source
+	override bool // Replace locations already set in CUPS
+	log      zerolog.Logger
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry // queue name -> last lookup
+	now   func() time.Time
+}
+
+type cacheEntry struct {
+	location string
+	expires  time.Time
+}
+
+// NewResolver creates a resolver. With override set, sources replace the
+// CUPS location; otherwise they only fill in empty ones.
+func NewResolver(sources []Source, override bool, log zerolog.Logger) *Resolver {
+	return &Resolver{
+		sources:  sources,
+		override: override,
+		log:      log.With().Str("component", "location").Logger(),
+		cache:    make(map[string]cacheEntry),
+		now:      time.Now,
+	}
+}
+
+// Apply returns the printers with locations filled in from the sources
+func (r *Resolver) Apply(printers []cups.Printer) []cups.Printer {
+	if r == nil || len(r.sources) == 0 {
+		return printers
+	}
+
+	result := make([]cups.Printer, len(printers))
+	for i, p := range printers {
+		if p.Location == "" || r.override {
+			if loc := r.lookup(p); loc != "" {
+				p.Location = loc
+			}
+		}
+		result[i] = p
+	}
+	return result
+}
+
+// lookup returns the cached location of a printer, refreshing it if expired
+func (r *Resolver) lookup(p cups.Printer) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	if entry, ok := r.cache[p.Name]; ok && now.Before(entry.expires) {
+		return entry.location
+	}
+
+	location := ""
+	for _, src := range r.sources {
+		loc, err := src.Lookup(p)
+		if err != nil {
+			r.log.Debug().Err(err).Str("printer", p.Name).Str("source", src.Name()).Msg("location lookup failed")
+			continue
+		}
+		if loc != "" {
+			location = loc
+			if last := r.cache[p.Name].location; last != loc {
+				r.log.Info().Str("printer", p.Name).Str("source", src.Name()).Str("location", loc).Msg("resolved printer location")
+			}
+			break
+		}
+	}
+
+	r.cache[p.Name] = cacheEntry{location: location, expires: now.Add(cacheTTL)}
+	return location
+}
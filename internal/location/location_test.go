@@ -0,0 +1,185 @@
+package location
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+type fakeSource struct {
+	locations map[string]string
+	calls     int
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func (f *fakeSource) Lookup(p cups.Printer) (string, error) {
+	f.calls++
+	return f.locations[p.Name], nil
+}
+
+func TestResolver_Apply(t *testing.T) {
+	first := &fakeSource{locations: map[string]string{"A": "Floor 1"}}
+	second := &fakeSource{locations: map[string]string{"A": "ignored", "B": "Floor 2"}}
+
+	printers := []cups.Printer{
+		{Name: "A"},
+		{Name: "B"},
+		{Name: "C", Location: "Set in CUPS"},
+		{Name: "D"},
+	}
+
+	tests := []struct {
+		name     string
+		override bool
+		want     []string
+	}{
+		{"fill empty only", false, []string{"Floor 1", "Floor 2", "Set in CUPS", ""}},
+		{"override", true, []string{"Floor 1", "Floor 2", "Set in CUPS", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewResolver([]Source{first, second}, tt.override, zerolog.Nop())
+			got := r.Apply(printers)
+			for i, p := range got {
+				if p.Location != tt.want[i] {
+					t.Errorf("%s location = %q, want %q", p.Name, p.Location, tt.want[i])
+				}
+			}
+		})
+	}
+
+	override := NewResolver([]Source{&fakeSource{locations: map[string]string{"C": "From source"}}}, true, zerolog.Nop())
+	if got := override.Apply(printers)[2].Location; got != "From source" {
+		t.Errorf("override location = %q, want %q", got, "From source")
+	}
+}
+
+func TestResolver_Cache(t *testing.T) {
+	src := &fakeSource{locations: map[string]string{"A": "Floor 1"}}
+	r := NewResolver([]Source{src}, false, zerolog.Nop())
+
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	printers := []cups.Printer{{Name: "A"}}
+	r.Apply(printers)
+	r.Apply(printers)
+	if src.calls != 1 {
+		t.Errorf("calls = %d, want 1 while cached", src.calls)
+	}
+
+	now = now.Add(cacheTTL + time.Second)
+	r.Apply(printers)
+	if src.calls != 2 {
+		t.Errorf("calls = %d, want 2 after expiry", src.calls)
+	}
+}
+
+func TestCSVSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "locations.csv")
+	content := "queue,location\n# comment\nOffice_Laser,\"Building A, Floor 2\"\nZebra_Dock1, Dock 1\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewCSVSource(path)
+	tests := map[string]string{
+		"Office_Laser": "Building A, Floor 2",
+		"Zebra_Dock1":  "Dock 1",
+		"queue":        "",
+		"Unknown":      "",
+	}
+	for queue, want := range tests {
+		got, err := src.Lookup(cups.Printer{Name: queue})
+		if err != nil {
+			t.Fatalf("Lookup(%s) error = %v", queue, err)
+		}
+		if got != want {
+			t.Errorf("Lookup(%s) = %q, want %q", queue, got, want)
+		}
+	}
+}
+
+func TestDNSSource(t *testing.T) {
+	records := map[string][]string{
+		"office_laser.printers.example.com": {"v=1", "location=Room 101"},
+		"zebra.printers.example.com":        {"Dock 3"},
+		"10.0.0.5.hosts.example.com":        {"location=Rack 4"},
+	}
+	lookup := func(name string) ([]string, error) {
+		if r, ok := records[name]; ok {
+			return r, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		printer  cups.Printer
+		want     string
+		wantErr  bool
+	}{
+		{"location key", "{queue}.printers.example.com", cups.Printer{Name: "Office_Laser"}, "Room 101", false},
+		{"plain record", "{queue}.printers.example.com", cups.Printer{Name: "Zebra"}, "Dock 3", false},
+		{"device host", "{host}.hosts.example.com", cups.Printer{Name: "X", DeviceURI: "socket://10.0.0.5:9100"}, "Rack 4", false},
+		{"no device host", "{host}.hosts.example.com", cups.Printer{Name: "X", DeviceURI: "usb://Zebra/ZT410"}, "", false},
+		{"lookup failure", "{queue}.printers.example.com", cups.Printer{Name: "Missing"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewDNSSource(tt.template)
+			src.lookupTXT = lookup
+
+			got, err := src.Lookup(tt.printer)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLLDPSource(t *testing.T) {
+	output := strings.Join([]string{
+		"lldp.eth0.via=LLDP",
+		"lldp.eth0.chassis.name=sw-3f-east",
+		"lldp.eth0.port.ifname=Gi1/0/14",
+		"lldp.eth0.port.descr=Room 312 jack B",
+	}, "\n")
+
+	src := NewLLDPSource()
+	src.run = func() ([]byte, error) { return []byte(output), nil }
+
+	got, err := src.Lookup(cups.Printer{Name: "Zebra", DeviceURI: "usb://Zebra/ZT410?serial=1"})
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if got != "Room 312 jack B" {
+		t.Errorf("Lookup() = %q, want %q", got, "Room 312 jack B")
+	}
+
+	// Network printers aren't at the host's switch port
+	if got, _ := src.Lookup(cups.Printer{Name: "Net", DeviceURI: "socket://10.0.0.5"}); got != "" {
+		t.Errorf("Lookup(network printer) = %q, want empty", got)
+	}
+}
+
+func TestParseLLDP_NoDescription(t *testing.T) {
+	output := []byte("lldp.eth0.chassis.name=sw1\nlldp.eth0.port.ifname=ge-0/0/7\n")
+	if got := parseLLDP(output); got != "sw1 ge-0/0/7" {
+		t.Errorf("parseLLDP() = %q, want %q", got, "sw1 ge-0/0/7")
+	}
+}
@@ -0,0 +1,249 @@
+package location
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/cups"
+)
+
+// CSVSource reads locations from an inventory file with "queue,location"
+// rows. The file is re-read whenever it changes.
+type CSVSource struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	entries map[string]string
+}
+
+// NewCSVSource creates a source backed by the CSV file at path
+func NewCSVSource(path string) *CSVSource {
+	return &CSVSource{path: path}
+}
+
+// Name identifies the source in logs
+func (s *CSVSource) Name() string {
+	return "csv"
+}
+
+// Lookup returns the inventory location of the queue
+func (s *CSVSource) Lookup(p cups.Printer) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat inventory: %w", err)
+	}
+	if s.entries == nil || !info.ModTime().Equal(s.modTime) {
+		f, err := os.Open(s.path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open inventory: %w", err)
+		}
+		entries, err := parseCSV(f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		s.entries = entries
+		s.modTime = info.ModTime()
+	}
+
+	return s.entries[p.Name], nil
+}
+
+// parseCSV reads queue,location rows, skipping an optional header row
+func parseCSV(r io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory: %w", err)
+	}
+
+	entries := make(map[string]string, len(records))
+	for i, rec := range records {
+		if len(rec) < 2 {
+			continue
+		}
+		if i == 0 && strings.EqualFold(rec[0], "queue") {
+			continue
+		}
+		entries[strings.TrimSpace(rec[0])] = strings.TrimSpace(rec[1])
+	}
+	return entries, nil
+}
+
+// DNSSource reads locations from DNS TXT records. The record name is a
+// template where {queue} is replaced by the queue name and {host} by the
+// host of the printer's device URI.
+type DNSSource struct {
+	template  string
+	lookupTXT func(name string) ([]string, error)
+}
+
+// NewDNSSource creates a source querying TXT records named by template
+func NewDNSSource(template string) *DNSSource {
+	return &DNSSource{template: template, lookupTXT: net.LookupTXT}
+}
+
+// Name identifies the source in logs
+func (s *DNSSource) Name() string {
+	return "dns"
+}
+
+// Lookup returns the location from the queue's TXT record. A "location="
+// string is preferred; otherwise the first string is used as-is.
+func (s *DNSSource) Lookup(p cups.Printer) (string, error) {
+	name := strings.ReplaceAll(s.template, "{queue}", strings.ToLower(p.Name))
+	if strings.Contains(name, "{host}") {
+		host := deviceHost(p.DeviceURI)
+		if host == "" {
+			return "", nil
+		}
+		name = strings.ReplaceAll(name, "{host}", host)
+	}
+
+	records, err := s.lookupTXT(name)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+
+	for _, rec := range records {
+		if v, ok := strings.CutPrefix(rec, "location="); ok {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	if len(records) > 0 {
+		return strings.TrimSpace(records[0]), nil
+	}
+	return "", nil
+}
+
+// deviceHost returns the network host of a device URI, if it has one
+func deviceHost(deviceURI string) string {
+	if isLocalDevice(deviceURI) {
+		// usb://Make/Model has a "host" that isn't one
+		return ""
+	}
+	u, err := url.Parse(deviceURI)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// LLDPSource uses the switch port the bridge host is plugged into, as
+// reported by lldpd, for printers attached directly to the host (USB,
+// parallel, serial). Network printers are skipped.
+type LLDPSource struct {
+	run func() ([]byte, error)
+
+	mu       sync.Mutex
+	location string
+	expires  time.Time
+}
+
+// NewLLDPSource creates a source reading neighbor data from lldpctl
+func NewLLDPSource() *LLDPSource {
+	return &LLDPSource{
+		run: func() ([]byte, error) {
+			return exec.Command("lldpctl", "-f", "keyvalue").Output()
+		},
+	}
+}
+
+// Name identifies the source in logs
+func (s *LLDPSource) Name() string {
+	return "lldp"
+}
+
+// Lookup returns the host's switch port description for local printers
+func (s *LLDPSource) Lookup(p cups.Printer) (string, error) {
+	if !isLocalDevice(p.DeviceURI) {
+		return "", nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Now().Before(s.expires) {
+		return s.location, nil
+	}
+
+	out, err := s.run()
+	if err != nil {
+		return "", fmt.Errorf("failed to run lldpctl: %w", err)
+	}
+	s.location = parseLLDP(out)
+	s.expires = time.Now().Add(cacheTTL)
+	return s.location, nil
+}
+
+// isLocalDevice reports whether a device URI refers to a directly attached printer
+func isLocalDevice(deviceURI string) bool {
+	for _, prefix := range []string{"usb:", "parallel:", "serial:"} {
+		if strings.HasPrefix(deviceURI, prefix) {
+			return true
+		}
+	}
+	// HPLIP encodes the connection in the path, e.g. hp:/usb/...
+	return strings.HasPrefix(deviceURI, "hp:/usb/")
+}
+
+// parseLLDP extracts a location from "lldpctl -f keyvalue" output. The port
+// description is used when set, otherwise the switch name and port.
+func parseLLDP(out []byte) string {
+	values := make(map[string]map[string]string) // interface -> key -> value
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || !strings.HasPrefix(key, "lldp.") {
+			continue
+		}
+		iface, field, ok := strings.Cut(strings.TrimPrefix(key, "lldp."), ".")
+		if !ok {
+			continue
+		}
+		if values[iface] == nil {
+			values[iface] = make(map[string]string)
+		}
+		values[iface][field] = value
+	}
+
+	// Use interfaces in a stable order
+	ifaces := make([]string, 0, len(values))
+	for iface := range values {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+
+	for _, iface := range ifaces {
+		v := values[iface]
+		if descr := v["port.descr"]; descr != "" {
+			return descr
+		}
+		if name, port := v["chassis.name"], v["port.ifname"]; name != "" && port != "" {
+			return name + " " + port
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+// Package logfile writes the daemon's log to a file that is rotated when it
+// grows too big, keeping a bounded number of old files, so long-running
+// installs on small disks don't fill them with logs
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat names rotated files after when they were rotated, in a
+// form that sorts in time order and is safe in file names
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Rotation says when a log file is rotated and which old files are kept
+type Rotation struct {
+	MaxSize    int64         // Bytes a file may grow to before it is rotated, 0 for no limit
+	MaxAge     time.Duration // Old files older than this are removed, 0 to keep them regardless of age
+	MaxBackups int           // Old files kept, 0 for all
+}
+
+// Writer appends to a log file, rotating it as the rotation says. Rotated
+// files are named after the file and when they were rotated, e.g.
+// bridge-2026-03-02T14-30-00.000.log for bridge.log.
+type Writer struct {
+	path     string
+	rotation Rotation
+	now      func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the log file at path for appending, creating it readable by
+// its owner and group only, and removes old files the rotation doesn't keep
+func Open(path string, rotation Rotation) (*Writer, error) {
+	w := &Writer{path: path, rotation: rotation, now: time.Now}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.prune()
+	return w, nil
+}
+
+// open opens the current file, picking up its size
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating the file first if p would take it past
+// MaxSize. An entry bigger than MaxSize still goes into a file of its own.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.rotation.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.rotation.MaxSize {
+		if err := w.rotate(); err != nil {
+			// Keep logging to the current file, trying again once it has
+			// grown by another MaxSize
+			fmt.Fprintf(os.Stderr, "airprint-bridge: failed to rotate log file: %v\n", err)
+			w.size = 0
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file after the time and starts a new one
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.path, w.backupName(w.now())); err != nil {
+		// Carry on with the old file
+		if openErr := w.open(); openErr != nil {
+			return openErr
+		}
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+// backupName returns the name the file is rotated to at t
+func (w *Writer) backupName(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	return strings.TrimSuffix(w.path, ext) + "-" + t.UTC().Format(backupTimeFormat) + ext
+}
+
+// backups returns the rotated files, newest first, with when they were
+// rotated
+func (w *Writer) backups() ([]string, []time.Time) {
+	dir := filepath.Dir(w.path)
+	ext := filepath.Ext(w.path)
+	prefix := strings.TrimSuffix(filepath.Base(w.path), ext) + "-"
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil
+	}
+
+	type backup struct {
+		path string
+		time time.Time
+	}
+	var found []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		t, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		found = append(found, backup{filepath.Join(dir, name), t})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].time.After(found[j].time) })
+
+	paths := make([]string, len(found))
+	times := make([]time.Time, len(found))
+	for i, b := range found {
+		paths[i], times[i] = b.path, b.time
+	}
+	return paths, times
+}
+
+// prune removes the rotated files beyond MaxBackups or older than MaxAge
+func (w *Writer) prune() {
+	paths, times := w.backups()
+	for i, path := range paths {
+		tooMany := w.rotation.MaxBackups > 0 && i >= w.rotation.MaxBackups
+		tooOld := w.rotation.MaxAge > 0 && w.now().Sub(times[i]) > w.rotation.MaxAge
+		if tooMany || tooOld {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// Close closes the current file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
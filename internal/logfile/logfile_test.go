@@ -0,0 +1,119 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// files returns the names of the files in dir, sorted
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestWriter_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bridge.log")
+	w, err := Open(path, Rotation{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	at := time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+	w.now = func() time.Time { return at }
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		at = at.Add(time.Second)
+	}
+
+	want := []string{"bridge-2026-03-02T14-30-02.000.log", "bridge-2026-03-02T14-30-03.000.log", "bridge.log"}
+	if got := files(t, dir); !equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "fourth\n" {
+		t.Errorf("current file = %q, want %q", data, "fourth\n")
+	}
+	data, err = os.ReadFile(filepath.Join(dir, want[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "third\n" {
+		t.Errorf("newest backup = %q, want %q", data, "third\n")
+	}
+}
+
+func TestWriter_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bridge.log")
+	if err := os.WriteFile(path, []byte("12345678\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Open(path, Rotation{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err := w.Write([]byte("next\n")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "next\n" {
+		t.Errorf("current file = %q, want the existing size counted and the file rotated", data)
+	}
+}
+
+func TestOpen_PrunesOld(t *testing.T) {
+	dir := t.TempDir()
+	day := 24 * time.Hour
+	old := "bridge-" + time.Now().Add(-40*day).UTC().Format(backupTimeFormat) + ".log"
+	recent := "bridge-" + time.Now().Add(-10*day).UTC().Format(backupTimeFormat) + ".log"
+	for _, name := range []string{old, recent, "bridge-notatime.log", "other-2026-02-01T00-00-00.000.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, err := Open(filepath.Join(dir, "bridge.log"), Rotation{MaxAge: 30 * day})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	want := []string{recent, "bridge-notatime.log", "bridge.log", "other-2026-02-01T00-00-00.000.log"}
+	sort.Strings(want)
+	if got := files(t, dir); !equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
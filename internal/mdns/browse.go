@@ -0,0 +1,197 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// browseRounds bounds the queries of one browse: the first for the service
+// types, later ones for records responders left out of their answers
+const browseRounds = 3
+
+// Browse queries the network on iface for instances of the service types,
+// e.g. "_ipp._tcp" or "_universal._sub._ipp._tcp", collecting answers for
+// wait after each query. Instances found through a subtype carry it. Only
+// instances whose host and an IPv4 address of it are known are returned.
+func Browse(ctx context.Context, iface *net.Interface, types []string, wait time.Duration) ([]Service, error) {
+	conn, err := net.ListenMulticastUDP("udp4", iface, mdnsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to join mDNS group on %s: %w", iface.Name, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
+
+	c := newCollector(types)
+	questions := make([]question, 0, len(types))
+	for _, t := range types {
+		questions = append(questions, question{name: append(parseName(t), "local"), qtype: typePTR})
+	}
+
+	buf := make([]byte, 9000)
+	for round := 0; round < browseRounds && len(questions) > 0; round++ {
+		if _, err := conn.WriteToUDP(packQuestions(questions), mdnsAddr); err != nil {
+			return nil, fmt.Errorf("failed to send query on %s: %w", iface.Name, err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wait))
+		for {
+			n, src, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				break // Deadline reached
+			}
+			if !onLink(iface, src.IP) {
+				continue
+			}
+			if answers, err := parseResponse(buf[:n]); err == nil {
+				c.add(answers)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		questions = c.missing()
+	}
+	return c.services(), nil
+}
+
+// collector assembles services from the records of responses
+type collector struct {
+	types     []name
+	instances map[string]*Service // Lowercased instance name -> service
+	names     map[string]name     // Lowercased instance name -> its name
+	resolved  map[string]bool     // Instances whose SRV record was seen
+	addrs     map[string][]net.IP // Lowercased host name -> addresses
+}
+
+func newCollector(types []string) *collector {
+	c := &collector{
+		instances: make(map[string]*Service),
+		names:     make(map[string]name),
+		resolved:  make(map[string]bool),
+		addrs:     make(map[string][]net.IP),
+	}
+	for _, t := range types {
+		c.types = append(c.types, append(parseName(t), "local"))
+	}
+	return c
+}
+
+// add takes in the records of one response. Records with a TTL of 0 are
+// goodbyes and drop what they name.
+func (c *collector) add(answers []answer) {
+	// Instances first, so their SRV and TXT records in the same response
+	// have somewhere to go
+	for _, a := range answers {
+		if a.rtype == typePTR {
+			c.addInstance(a)
+		}
+	}
+	for _, a := range answers {
+		key := strings.ToLower(a.name.String())
+		switch a.rtype {
+		case typeSRV:
+			if s, ok := c.instances[key]; ok && len(a.target) > 0 {
+				s.Host = strings.Join(a.target[:len(a.target)-1], ".")
+				s.Port = a.port
+				c.resolved[key] = a.ttl > 0
+			}
+		case typeTXT:
+			if s, ok := c.instances[key]; ok {
+				s.TXT = a.txt
+			}
+		case typeA:
+			if a.ttl == 0 {
+				delete(c.addrs, key)
+			} else if !containsIP(c.addrs[key], a.ip) {
+				c.addrs[key] = append(c.addrs[key], a.ip)
+			}
+		}
+	}
+}
+
+// addInstance records the instance a PTR record for a browsed type names
+func (c *collector) addInstance(a answer) {
+	for _, t := range c.types {
+		if !a.name.equal(t) {
+			continue
+		}
+		instance := a.target
+		if len(instance) < 4 { // Instance, service, protocol, "local"
+			return
+		}
+		key := strings.ToLower(instance.String())
+		if a.ttl == 0 {
+			delete(c.instances, key)
+			return
+		}
+		s, ok := c.instances[key]
+		if !ok {
+			s = &Service{Instance: instance[0], Type: strings.Join(instance[1:len(instance)-1], ".")}
+			c.instances[key] = s
+			c.names[key] = instance
+		}
+		if sub := t.String(); strings.Contains(sub, "._sub.") {
+			sub = strings.TrimSuffix(sub, ".local")
+			if !containsFold(s.Subtypes, sub) {
+				s.Subtypes = append(s.Subtypes, sub)
+			}
+		}
+		return
+	}
+}
+
+// missing returns questions for the records of instances not yet known
+func (c *collector) missing() []question {
+	var questions []question
+	asked := make(map[string]bool)
+	for key, s := range c.instances {
+		if !c.resolved[key] {
+			questions = append(questions, question{name: c.names[key], qtype: typeANY})
+			continue
+		}
+		host := strings.ToLower(s.Host) + ".local"
+		if len(c.addrs[host]) == 0 && !asked[host] {
+			asked[host] = true
+			questions = append(questions, question{name: name{s.Host, "local"}, qtype: typeA})
+		}
+	}
+	return questions
+}
+
+// services returns the complete instances, sorted by name and type
+func (c *collector) services() []Service {
+	var services []Service
+	for key, s := range c.instances {
+		addrs := c.addrs[strings.ToLower(s.Host)+".local"]
+		if !c.resolved[key] || s.Host == "" || len(addrs) == 0 {
+			continue
+		}
+		service := *s
+		service.Addrs = addrs
+		services = append(services, service)
+	}
+	return sortServices(services)
+}
+
+// containsIP reports whether ips holds ip
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, other := range ips {
+		if other.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether list holds s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,341 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// DNS record types and classes used by DNS-SD
+const (
+	typeA   = 1
+	typePTR = 12
+	typeTXT = 16
+	typeSRV = 33
+	typeANY = 255
+
+	classIN         = 1
+	classCacheFlush = 0x8000 // Set on records only this host answers for
+	classUnicast    = 0x8000 // Set on questions that want a unicast reply
+)
+
+// Record TTLs recommended by RFC 6762
+const (
+	hostTTL    = 120  // A and SRV records
+	serviceTTL = 4500 // PTR and TXT records
+)
+
+var errMalformed = errors.New("malformed DNS message")
+
+// name is a domain name as its labels. Service instance labels may contain
+// dots and spaces, so names aren't kept as dotted strings.
+type name []string
+
+// parseName splits a dotted name such as "_ipp._tcp.local" into labels
+func parseName(s string) name {
+	return strings.Split(strings.TrimSuffix(s, "."), ".")
+}
+
+// prepend returns label followed by n
+func (n name) prepend(label string) name {
+	return append(name{label}, n...)
+}
+
+// equal compares names case-insensitively
+func (n name) equal(o name) bool {
+	if len(n) != len(o) {
+		return false
+	}
+	for i := range n {
+		if !strings.EqualFold(n[i], o[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n name) String() string {
+	return strings.Join(n, ".")
+}
+
+// question is one entry of a query's question section
+type question struct {
+	name    name
+	qtype   uint16
+	unicast bool
+}
+
+// query is a parsed mDNS query
+type query struct {
+	id        uint16
+	questions []question
+}
+
+// parseQuery decodes the header and questions of a DNS message. Responses
+// are rejected; the answer sections of queries are ignored.
+func parseQuery(msg []byte) (query, error) {
+	if len(msg) < 12 {
+		return query{}, errMalformed
+	}
+	var q query
+	q.id = binary.BigEndian.Uint16(msg[0:])
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 != 0 {
+		return query{}, errors.New("not a query")
+	}
+	count := int(binary.BigEndian.Uint16(msg[4:]))
+
+	off := 12
+	for i := 0; i < count; i++ {
+		n, next, err := readName(msg, off)
+		if err != nil {
+			return query{}, err
+		}
+		if next+4 > len(msg) {
+			return query{}, errMalformed
+		}
+		class := binary.BigEndian.Uint16(msg[next+2:])
+		q.questions = append(q.questions, question{
+			name:    n,
+			qtype:   binary.BigEndian.Uint16(msg[next:]),
+			unicast: class&classUnicast != 0,
+		})
+		off = next + 4
+	}
+	return q, nil
+}
+
+// readName decodes a possibly compressed name at off, returning it and the
+// offset just past it
+func readName(msg []byte, off int) (name, int, error) {
+	var n name
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return nil, 0, errMalformed
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return n, end, nil
+
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return nil, 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+
+		default:
+			if off+1+length > len(msg) {
+				return nil, 0, errMalformed
+			}
+			n = append(n, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// answer is a resource record received in a response, with the data of the
+// types browsing looks at decoded
+type answer struct {
+	name   name
+	rtype  uint16
+	ttl    uint32
+	target name     // PTR and SRV
+	port   int      // SRV
+	txt    []string // TXT
+	ip     net.IP   // A
+}
+
+// parseResponse decodes the records of all sections of a DNS response.
+// Queries are rejected; records of other types are returned undecoded.
+func parseResponse(msg []byte) ([]answer, error) {
+	if len(msg) < 12 {
+		return nil, errMalformed
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		return nil, errors.New("not a response")
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	records := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next + 4
+	}
+
+	var answers []answer
+	for i := 0; i < records; i++ {
+		n, next, err := readName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errMalformed
+		}
+		a := answer{
+			name:  n,
+			rtype: binary.BigEndian.Uint16(msg[next:]),
+			ttl:   binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		if start+length > len(msg) {
+			return nil, errMalformed
+		}
+		data := msg[start : start+length]
+
+		switch a.rtype {
+		case typePTR:
+			if a.target, _, err = readName(msg, start); err != nil {
+				return nil, err
+			}
+		case typeSRV:
+			if length < 7 {
+				return nil, errMalformed
+			}
+			a.port = int(binary.BigEndian.Uint16(data[4:]))
+			if a.target, _, err = readName(msg, start+6); err != nil {
+				return nil, err
+			}
+		case typeTXT:
+			for j := 0; j < len(data); {
+				l := int(data[j])
+				if j+1+l > len(data) {
+					return nil, errMalformed
+				}
+				if l > 0 {
+					a.txt = append(a.txt, string(data[j+1:j+1+l]))
+				}
+				j += 1 + l
+			}
+		case typeA:
+			if length != 4 {
+				return nil, errMalformed
+			}
+			a.ip = net.IP(append([]byte(nil), data...))
+		}
+		answers = append(answers, a)
+		off = start + length
+	}
+	return answers, nil
+}
+
+// packQuestions encodes a query asking each question, to be answered by
+// multicast
+func packQuestions(questions []question) []byte {
+	buf := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(questions)))
+	for _, q := range questions {
+		buf = appendName(buf, q.name)
+		buf = binary.BigEndian.AppendUint16(buf, q.qtype)
+		buf = binary.BigEndian.AppendUint16(buf, classIN)
+	}
+	return buf
+}
+
+// record is a resource record to send
+type record struct {
+	name  name
+	rtype uint16
+	flush bool // Set the cache-flush bit
+	ttl   uint32
+	data  []byte
+}
+
+// message builds a DNS response
+type message struct {
+	id         uint16
+	questions  []question // Echoed in replies to legacy unicast queries
+	answers    []record
+	additional []record
+}
+
+// pack encodes the message. Names aren't compressed.
+func (m *message) pack() []byte {
+	buf := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(buf[0:], m.id)
+	binary.BigEndian.PutUint16(buf[2:], 0x8400) // Response, authoritative
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(buf[6:], uint16(len(m.answers)))
+	binary.BigEndian.PutUint16(buf[10:], uint16(len(m.additional)))
+
+	for _, q := range m.questions {
+		buf = appendName(buf, q.name)
+		buf = binary.BigEndian.AppendUint16(buf, q.qtype)
+		buf = binary.BigEndian.AppendUint16(buf, classIN)
+	}
+	for _, rr := range append(m.answers, m.additional...) {
+		buf = appendName(buf, rr.name)
+		buf = binary.BigEndian.AppendUint16(buf, rr.rtype)
+		class := uint16(classIN)
+		if rr.flush {
+			class |= classCacheFlush
+		}
+		buf = binary.BigEndian.AppendUint16(buf, class)
+		buf = binary.BigEndian.AppendUint32(buf, rr.ttl)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(rr.data)))
+		buf = append(buf, rr.data...)
+	}
+	return buf
+}
+
+// appendName appends n in uncompressed wire format. Labels are truncated to
+// the 63 byte limit.
+func appendName(buf []byte, n name) []byte {
+	for _, label := range n {
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+// ptrData encodes the target of a PTR record
+func ptrData(target name) []byte {
+	return appendName(nil, target)
+}
+
+// srvData encodes an SRV record pointing at host:port
+func srvData(host name, port int) []byte {
+	buf := make([]byte, 6)
+	binary.BigEndian.PutUint16(buf[4:], uint16(port)) // Priority and weight 0
+	return appendName(buf, host)
+}
+
+// txtData encodes key=value strings. An empty TXT record is a single empty
+// string.
+func txtData(txt []string) []byte {
+	var buf []byte
+	for _, s := range txt {
+		if len(s) > 255 {
+			s = s[:255]
+		}
+		buf = append(buf, byte(len(s)))
+		buf = append(buf, s...)
+	}
+	if len(buf) == 0 {
+		buf = []byte{0}
+	}
+	return buf
+}
+
+// aData encodes an IPv4 address
+func aData(ip net.IP) []byte {
+	return append([]byte(nil), ip.To4()...)
+}
@@ -0,0 +1,150 @@
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// reflectKey is the key reflected services are published under
+const reflectKey = "reflect"
+
+// reflectWait is how long answers are collected after each browse query
+const reflectWait = 2 * time.Second
+
+// reflectMisses is how many browses in a row a service may be missing from
+// before it is withdrawn, so one lost answer doesn't make printers flicker
+const reflectMisses = 3
+
+// ReflectTypes are the service types printers are reflected for, including
+// the AirPrint subtypes iOS browses for
+var ReflectTypes = []string{
+	"_ipp._tcp",
+	"_ipps._tcp",
+	"_universal._sub._ipp._tcp",
+	"_universal._sub._ipps._tcp",
+}
+
+// Reflector browses for printers on some interfaces and re-announces them
+// through a responder on others, so clients on one subnet see printers on
+// another that they can route to. Services keep their own host and
+// addresses: clients print straight to the printer.
+type Reflector struct {
+	from      []*net.Interface
+	responder *Responder
+	filter    func(Service) bool
+	self      string // Host name of this machine, whose services aren't reflected
+	interval  time.Duration
+	log       zerolog.Logger
+
+	seen map[string]reflected // Instance and type -> service last found
+}
+
+// reflected is a service found by browsing
+type reflected struct {
+	service Service
+	misses  int // Browses in a row it was missing from
+}
+
+// NewReflector creates a reflector browsing the named interfaces every
+// interval and publishing what filter accepts, nil for everything, on
+// responder. self is this machine's host name, without ".local".
+func NewReflector(from []string, responder *Responder, filter func(Service) bool, self string, interval time.Duration, log zerolog.Logger) (*Reflector, error) {
+	r := &Reflector{
+		responder: responder,
+		filter:    filter,
+		self:      self,
+		interval:  interval,
+		log:       log.With().Str("component", "reflector").Logger(),
+		seen:      make(map[string]reflected),
+	}
+	for _, n := range from {
+		iface, err := net.InterfaceByName(n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find interface %s: %w", n, err)
+		}
+		if iface.Flags&net.FlagMulticast == 0 {
+			return nil, fmt.Errorf("interface %s does not support multicast", n)
+		}
+		r.from = append(r.from, iface)
+	}
+	return r, nil
+}
+
+// Run browses and publishes until ctx is cancelled
+func (r *Reflector) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.reflect(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reflect browses every interface once and publishes the services found
+func (r *Reflector) reflect(ctx context.Context) {
+	found := make(map[string]Service)
+	for _, iface := range r.from {
+		services, err := Browse(ctx, iface, ReflectTypes, reflectWait)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.log.Warn().Err(err).Str("interface", iface.Name).Msg("failed to browse for printers")
+			}
+			continue
+		}
+		for _, s := range services {
+			if strings.EqualFold(s.Host, r.self) || (r.filter != nil && !r.filter(s)) {
+				continue
+			}
+			found[s.Instance+"."+s.Type] = s
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	for key, s := range found {
+		if _, ok := r.seen[key]; !ok {
+			r.log.Info().Str("instance", s.Instance).Str("type", s.Type).Str("host", s.Host).Msg("reflecting printer")
+		}
+		r.seen[key] = reflected{service: s}
+	}
+	services := make([]Service, 0, len(r.seen))
+	for key, s := range r.seen {
+		if _, ok := found[key]; !ok {
+			s.misses++
+			if s.misses >= reflectMisses {
+				r.log.Info().Str("instance", s.service.Instance).Str("type", s.service.Type).Msg("printer gone, no longer reflecting it")
+				delete(r.seen, key)
+				continue
+			}
+			r.seen[key] = s
+		}
+		services = append(services, s.service)
+	}
+	r.responder.Publish(reflectKey, sortServices(services))
+}
+
+// sortServices orders services by instance and type, so publishing the same
+// ones again isn't taken as a change
+func sortServices(services []Service) []Service {
+	sort.Slice(services, func(i, j int) bool { return serviceLess(services[i], services[j]) })
+	return services
+}
+
+// serviceLess orders services by instance, then type
+func serviceLess(a, b Service) bool {
+	if a.Instance != b.Instance {
+		return a.Instance < b.Instance
+	}
+	return a.Type < b.Type
+}
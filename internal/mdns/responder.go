@@ -0,0 +1,452 @@
+// Package mdns is a minimal multicast DNS responder for advertising DNS-SD
+// services on selected network interfaces only, which Avahi service files
+// can't express.
+package mdns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// mdnsAddr is the IPv4 mDNS group and port
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// servicesName is queried by browsers to enumerate service types
+var servicesName = parseName("_services._dns-sd._udp.local")
+
+// Service is one DNS-SD service instance
+type Service struct {
+	Instance string   // Instance name, e.g. "Office Laser @ bridge"
+	Type     string   // Service type, e.g. "_ipp._tcp"
+	Subtypes []string // Full subtype names, e.g. "_universal._sub._ipp._tcp"
+	Port     int
+	TXT      []string // key=value pairs
+	Host     string   // Host the service is on, without ".local"; empty for this one
+	Addrs    []net.IP // IPv4 addresses of Host
+}
+
+// instanceName returns the fully qualified instance name
+func (s Service) instanceName() name {
+	return append(parseName(s.Type), "local").prepend(s.Instance)
+}
+
+// hostName returns the fully qualified name of the service's own host, nil
+// for services on this one
+func (s Service) hostName() name {
+	if s.Host == "" {
+		return nil
+	}
+	return name{s.Host, "local"}
+}
+
+// Responder answers mDNS queries for its services on a fixed set of
+// interfaces and announces changes to them
+type Responder struct {
+	host   name
+	ifaces []*net.Interface
+	log    zerolog.Logger
+
+	mu       sync.Mutex
+	services map[string][]Service // Publish key -> services
+	conns    []*ifaceConn
+}
+
+// ifaceConn is the multicast socket of one interface
+type ifaceConn struct {
+	iface *net.Interface
+	conn  *net.UDPConn
+}
+
+// NewResponder creates a responder for the named interfaces. host is the
+// name advertised for this machine, without ".local", or empty if it only
+// advertises services of other hosts.
+func NewResponder(interfaces []string, host string, log zerolog.Logger) (*Responder, error) {
+	r := &Responder{
+		services: make(map[string][]Service),
+		log:      log.With().Str("component", "mdns").Logger(),
+	}
+	if host != "" {
+		r.host = name{host, "local"}
+	}
+	for _, n := range interfaces {
+		iface, err := net.InterfaceByName(n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find interface %s: %w", n, err)
+		}
+		if iface.Flags&net.FlagMulticast == 0 {
+			return nil, fmt.Errorf("interface %s does not support multicast", n)
+		}
+		r.ifaces = append(r.ifaces, iface)
+	}
+	return r, nil
+}
+
+// Run answers queries until ctx is cancelled, then withdraws all services
+func (r *Responder) Run(ctx context.Context) error {
+	r.mu.Lock()
+	for _, iface := range r.ifaces {
+		conn, err := net.ListenMulticastUDP("udp4", iface, mdnsAddr)
+		if err != nil {
+			r.mu.Unlock()
+			r.close()
+			return fmt.Errorf("failed to join mDNS group on %s: %w", iface.Name, err)
+		}
+		r.conns = append(r.conns, &ifaceConn{iface: iface, conn: conn})
+		r.log.Info().Str("interface", iface.Name).Msg("advertising on interface")
+	}
+	conns := r.conns
+	r.mu.Unlock()
+
+	r.announce(r.allServices(), serviceTTL)
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *ifaceConn) {
+			defer wg.Done()
+			r.serve(c)
+		}(c)
+	}
+
+	<-ctx.Done()
+	r.announce(r.allServices(), 0)
+	r.close()
+	wg.Wait()
+	return nil
+}
+
+// close closes all sockets
+func (r *Responder) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.conns {
+		c.conn.Close()
+	}
+	r.conns = nil
+}
+
+// Publish advertises services under key, replacing any published before
+// with the same key
+func (r *Responder) Publish(key string, services []Service) {
+	r.mu.Lock()
+	old, published := r.services[key]
+	r.services[key] = services
+	r.mu.Unlock()
+
+	if published && reflect.DeepEqual(old, services) {
+		return
+	}
+	r.announce(withdrawn(old, services), 0)
+	r.announce(services, serviceTTL)
+	// Announce twice, a second apart, in case the first is lost (RFC 6762 8.3)
+	time.AfterFunc(time.Second, func() { r.announce(services, serviceTTL) })
+}
+
+// Reannounce announces every service again with the interfaces' current
+// addresses, e.g. after an address changed
+func (r *Responder) Reannounce() {
+	r.announce(r.allServices(), serviceTTL)
+}
+
+// Unpublish withdraws the services published under key
+func (r *Responder) Unpublish(key string) {
+	r.mu.Lock()
+	old := r.services[key]
+	delete(r.services, key)
+	r.mu.Unlock()
+
+	r.announce(old, 0)
+}
+
+// withdrawn returns the services of old that aren't in current
+func withdrawn(old, current []Service) []Service {
+	var gone []Service
+	for _, o := range old {
+		found := false
+		for _, c := range current {
+			if o.instanceName().equal(c.instanceName()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			gone = append(gone, o)
+		}
+	}
+	return gone
+}
+
+// allServices returns every published service, in a stable order
+func (r *Responder) allServices() []Service {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]string, 0, len(r.services))
+	for k := range r.services {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var services []Service
+	for _, k := range keys {
+		services = append(services, r.services[k]...)
+	}
+	return services
+}
+
+// announce multicasts unsolicited responses for services on every
+// interface. A ttl of 0 withdraws them.
+func (r *Responder) announce(services []Service, ttl uint32) {
+	if len(services) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	conns := append([]*ifaceConn(nil), r.conns...)
+	r.mu.Unlock()
+
+	for _, c := range conns {
+		msg := &message{}
+		for _, s := range services {
+			msg.answers = append(msg.answers, r.serviceRecords(s, ttl)...)
+		}
+		if ttl > 0 {
+			msg.answers = append(msg.answers, r.addressRecords(services, interfaceIPv4s(c.iface))...)
+		}
+		if _, err := c.conn.WriteToUDP(msg.pack(), mdnsAddr); err != nil {
+			r.log.Debug().Err(err).Str("interface", c.iface.Name).Msg("failed to send announcement")
+		}
+	}
+}
+
+// serve answers queries arriving on one interface until its socket closes
+func (r *Responder) serve(c *ifaceConn) {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		// The socket also sees queries from interfaces other sockets on this
+		// host joined the group on; only answer the local network
+		if !onLink(c.iface, src.IP) {
+			continue
+		}
+
+		q, err := parseQuery(buf[:n])
+		if err != nil {
+			continue
+		}
+		resp := r.answer(q, interfaceIPv4s(c.iface))
+		if resp == nil {
+			continue
+		}
+
+		dst := mdnsAddr
+		if src.Port != mdnsAddr.Port {
+			// Legacy unicast query (RFC 6762 6.7): reply directly, echoing
+			// the query ID and questions
+			resp.id = q.id
+			resp.questions = q.questions
+			dst = src
+		} else if allUnicast(q.questions) {
+			dst = src
+		}
+		if _, err := c.conn.WriteToUDP(resp.pack(), dst); err != nil {
+			r.log.Debug().Err(err).Str("interface", c.iface.Name).Msg("failed to send response")
+		}
+	}
+}
+
+// answer builds the response to q, or nil if none of its questions are
+// about our records. ips are the addresses of the interface it came in on.
+func (r *Responder) answer(q query, ips []net.IP) *message {
+	services := r.allServices()
+	msg := &message{}
+	var needHost []Service // Services whose host's addresses are added
+
+	for _, question := range q.questions {
+		want := func(t uint16) bool { return question.qtype == t || question.qtype == typeANY }
+
+		if question.name.equal(servicesName) && want(typePTR) {
+			seen := make(map[string]bool)
+			for _, s := range services {
+				for _, t := range append([]string{s.Type}, s.Subtypes...) {
+					if !seen[t] {
+						seen[t] = true
+						msg.answers = append(msg.answers, record{name: servicesName, rtype: typePTR, ttl: serviceTTL, data: ptrData(append(parseName(t), "local"))})
+					}
+				}
+			}
+			continue
+		}
+
+		if question.name.equal(r.host) && want(typeA) && len(ips) > 0 {
+			msg.answers = append(msg.answers, r.hostRecords(ips)...)
+			continue
+		}
+		if want(typeA) {
+			if s, ok := serviceOnHost(services, question.name); ok {
+				msg.answers = append(msg.answers, r.addressRecords([]Service{s}, nil)...)
+				continue
+			}
+		}
+
+		for _, s := range services {
+			instance := s.instanceName()
+			switch {
+			case question.name.equal(instance):
+				if want(typeSRV) {
+					msg.answers = append(msg.answers, r.srvRecord(s, hostTTL))
+					needHost = append(needHost, s)
+				}
+				if want(typeTXT) {
+					msg.answers = append(msg.answers, r.txtRecord(s, serviceTTL))
+				}
+
+			case want(typePTR) && matchesType(question.name, s):
+				msg.answers = append(msg.answers, record{name: question.name, rtype: typePTR, ttl: serviceTTL, data: ptrData(instance)})
+				msg.additional = append(msg.additional, r.srvRecord(s, hostTTL), r.txtRecord(s, serviceTTL))
+				needHost = append(needHost, s)
+			}
+		}
+	}
+
+	if len(msg.answers) == 0 {
+		return nil
+	}
+	msg.additional = append(msg.additional, r.addressRecords(needHost, ips)...)
+	return msg
+}
+
+// matchesType reports whether n is the service type of s or one of its
+// subtypes
+func matchesType(n name, s Service) bool {
+	for _, t := range append([]string{s.Type}, s.Subtypes...) {
+		if n.equal(append(parseName(t), "local")) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceRecords returns the PTR, SRV and TXT records of a service
+func (r *Responder) serviceRecords(s Service, ttl uint32) []record {
+	instance := s.instanceName()
+	records := []record{{name: append(parseName(s.Type), "local"), rtype: typePTR, ttl: ttl, data: ptrData(instance)}}
+	for _, sub := range s.Subtypes {
+		records = append(records, record{name: append(parseName(sub), "local"), rtype: typePTR, ttl: ttl, data: ptrData(instance)})
+	}
+	srvTTL := uint32(hostTTL)
+	if ttl == 0 {
+		srvTTL = 0
+	}
+	return append(records, r.srvRecord(s, srvTTL), r.txtRecord(s, ttl))
+}
+
+func (r *Responder) srvRecord(s Service, ttl uint32) record {
+	host := r.host
+	if s.Host != "" {
+		host = s.hostName()
+	}
+	return record{name: s.instanceName(), rtype: typeSRV, flush: true, ttl: ttl, data: srvData(host, s.Port)}
+}
+
+func (r *Responder) txtRecord(s Service, ttl uint32) record {
+	return record{name: s.instanceName(), rtype: typeTXT, flush: true, ttl: ttl, data: txtData(s.TXT)}
+}
+
+// hostRecords returns an A record for each address. They are sent together,
+// so the cache-flush bit replaces addresses the host no longer has.
+func (r *Responder) hostRecords(ips []net.IP) []record {
+	if r.host == nil {
+		return nil
+	}
+	return addrRecords(r.host, ips)
+}
+
+// addressRecords returns the A records of the hosts services are on, once
+// per host: ips for this one, their own addresses for others
+func (r *Responder) addressRecords(services []Service, ips []net.IP) []record {
+	var records []record
+	seen := make(map[string]bool)
+	for _, s := range services {
+		key := strings.ToLower(s.Host)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if s.Host == "" {
+			records = append(records, r.hostRecords(ips)...)
+		} else {
+			records = append(records, addrRecords(s.hostName(), s.Addrs)...)
+		}
+	}
+	return records
+}
+
+// addrRecords returns an A record for each address of host
+func addrRecords(host name, ips []net.IP) []record {
+	records := make([]record, 0, len(ips))
+	for _, ip := range ips {
+		records = append(records, record{name: host, rtype: typeA, flush: true, ttl: hostTTL, data: aData(ip)})
+	}
+	return records
+}
+
+// serviceOnHost returns a service on the host named n, other than this one
+func serviceOnHost(services []Service, n name) (Service, bool) {
+	for _, s := range services {
+		if s.Host != "" && s.hostName().equal(n) {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+// allUnicast reports whether every question asked for a unicast reply
+func allUnicast(questions []question) bool {
+	for _, q := range questions {
+		if !q.unicast {
+			return false
+		}
+	}
+	return len(questions) > 0
+}
+
+// interfaceIPv4s returns the current IPv4 addresses of iface
+func interfaceIPv4s(iface *net.Interface) []net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			ips = append(ips, ipnet.IP.To4())
+		}
+	}
+	return ips
+}
+
+// onLink reports whether ip is in one of iface's subnets
+func onLink(iface *net.Interface, ip net.IP) bool {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
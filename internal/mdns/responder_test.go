@@ -0,0 +1,176 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+// packQuery encodes a query for one name and type
+func packQuery(n string, qtype uint16) []byte {
+	buf := make([]byte, 12)
+	binary.BigEndian.PutUint16(buf[4:], 1)
+	buf = appendName(buf, parseName(n))
+	buf = binary.BigEndian.AppendUint16(buf, qtype)
+	return binary.BigEndian.AppendUint16(buf, classIN)
+}
+
+func TestParseQuery(t *testing.T) {
+	msg := packQuery("_ipp._tcp.local", typePTR)
+	q, err := parseQuery(msg)
+	if err != nil {
+		t.Fatalf("parseQuery() error = %v", err)
+	}
+	if len(q.questions) != 1 || q.questions[0].name.String() != "_ipp._tcp.local" || q.questions[0].qtype != typePTR {
+		t.Errorf("parseQuery() = %+v", q)
+	}
+
+	// A second question compressed with a pointer to the first name
+	msg = packQuery("_ipp._tcp.local", typePTR)
+	binary.BigEndian.PutUint16(msg[4:], 2)
+	msg = append(msg, 0xc0, 12)
+	msg = binary.BigEndian.AppendUint16(msg, typeSRV)
+	msg = binary.BigEndian.AppendUint16(msg, classIN|classUnicast)
+	q, err = parseQuery(msg)
+	if err != nil {
+		t.Fatalf("parseQuery() compressed error = %v", err)
+	}
+	if len(q.questions) != 2 || !q.questions[1].name.equal(parseName("_IPP._tcp.local")) || !q.questions[1].unicast {
+		t.Errorf("parseQuery() compressed = %+v", q)
+	}
+
+	if _, err := parseQuery(msg[:20]); err == nil {
+		t.Error("parseQuery() of truncated message succeeded")
+	}
+
+	// A pointer loop must not hang
+	loop := make([]byte, 12)
+	binary.BigEndian.PutUint16(loop[4:], 1)
+	loop = append(loop, 0xc0, 12)
+	if _, err := parseQuery(loop); err == nil {
+		t.Error("parseQuery() of pointer loop succeeded")
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	r, err := NewResponder(nil, "bridge", zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.services["office"] = []Service{{
+		Instance: "Office Laser @ bridge",
+		Type:     "_ipp._tcp",
+		Subtypes: []string{"_universal._sub._ipp._tcp"},
+		Port:     8631,
+		TXT:      []string{"rp=printers/Office_Laser"},
+	}}
+	ips := []net.IP{net.IPv4(192, 168, 1, 10), net.IPv4(10, 0, 0, 10)}
+
+	tests := []struct {
+		name       string
+		qname      string
+		qtype      uint16
+		answers    int
+		additional int
+	}{
+		{"browse type", "_ipp._tcp.local", typePTR, 1, 4},
+		{"browse subtype", "_universal._sub._ipp._tcp.local", typePTR, 1, 4},
+		{"enumerate types", "_services._dns-sd._udp.local", typePTR, 2, 0},
+		{"resolve instance", "Office Laser @ bridge._ipp._tcp.local", typeANY, 2, 2},
+		{"instance TXT", "Office Laser @ bridge._ipp._tcp.local", typeTXT, 1, 0},
+		{"host address", "bridge.local", typeA, 2, 0},
+		{"other service", "_printer._tcp.local", typePTR, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := parseQuery(packQuery(tt.qname, tt.qtype))
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := r.answer(q, ips)
+			if tt.answers == 0 {
+				if msg != nil {
+					t.Errorf("answer() = %d records, want none", len(msg.answers))
+				}
+				return
+			}
+			if msg == nil {
+				t.Fatal("answer() = nil")
+			}
+			if len(msg.answers) != tt.answers || len(msg.additional) != tt.additional {
+				t.Errorf("answer() = %d answers, %d additional; want %d, %d",
+					len(msg.answers), len(msg.additional), tt.answers, tt.additional)
+			}
+		})
+	}
+}
+
+func TestPackName(t *testing.T) {
+	// Instance labels keep their dots and spaces
+	n := append(parseName("_ipp._tcp.local"), "x").prepend("Lab v2.1")
+	got, _, err := readName(appendName(nil, n), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.equal(n) || got[0] != "Lab v2.1" {
+		t.Errorf("round trip = %q, want %q", got, n)
+	}
+}
+
+func TestBrowseCollect(t *testing.T) {
+	ttl := uint32(120)
+	msg := &message{
+		answers: []record{
+			{name: parseName("_ipp._tcp.local"), rtype: typePTR, ttl: ttl, data: ptrData(parseName("_ipp._tcp.local").prepend("Lab Printer"))},
+			{name: parseName("_universal._sub._ipp._tcp.local"), rtype: typePTR, ttl: ttl, data: ptrData(parseName("_ipp._tcp.local").prepend("Lab Printer"))},
+			// Not resolvable, no SRV record follows
+			{name: parseName("_ipp._tcp.local"), rtype: typePTR, ttl: ttl, data: ptrData(parseName("_ipp._tcp.local").prepend("Hall Printer"))},
+		},
+		additional: []record{
+			{name: parseName("_ipp._tcp.local").prepend("Lab Printer"), rtype: typeSRV, ttl: ttl, data: srvData(parseName("brw1234.local"), 631)},
+			{name: parseName("_ipp._tcp.local").prepend("Lab Printer"), rtype: typeTXT, ttl: ttl, data: txtData([]string{"rp=ipp/print", "pdl=image/urf"})},
+			{name: parseName("brw1234.local"), rtype: typeA, ttl: ttl, data: aData(net.IPv4(10, 20, 0, 15))},
+		},
+	}
+	answers, err := parseResponse(msg.pack())
+	if err != nil {
+		t.Fatalf("parseResponse() error = %v", err)
+	}
+	if _, err := parseResponse(packQuery("_ipp._tcp.local", typePTR)); err == nil {
+		t.Error("parseResponse() of a query succeeded")
+	}
+
+	c := newCollector(ReflectTypes)
+	c.add(answers)
+	got := c.services()
+	if len(got) != 1 {
+		t.Fatalf("services() = %+v, want 1 service", got)
+	}
+	s := got[0]
+	if s.Instance != "Lab Printer" || s.Type != "_ipp._tcp" || s.Host != "brw1234" || s.Port != 631 ||
+		len(s.Addrs) != 1 || !s.Addrs[0].Equal(net.IPv4(10, 20, 0, 15)) ||
+		len(s.TXT) != 2 || len(s.Subtypes) != 1 || s.Subtypes[0] != "_universal._sub._ipp._tcp" {
+		t.Errorf("services() = %+v", s)
+	}
+	if q := c.missing(); len(q) != 1 || q[0].name.String() != "Hall Printer._ipp._tcp.local" {
+		t.Errorf("missing() = %+v, want a question for Hall Printer", q)
+	}
+
+	// Reflected services answer for their own host
+	r, err := NewResponder(nil, "", zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.services[reflectKey] = got
+	q, _ := parseQuery(packQuery("brw1234.local", typeA))
+	if resp := r.answer(q, nil); resp == nil || len(resp.answers) != 1 {
+		t.Errorf("answer() for reflected host = %+v, want its address", resp)
+	}
+	q, _ = parseQuery(packQuery("_ipp._tcp.local", typePTR))
+	if resp := r.answer(q, nil); resp == nil || len(resp.additional) != 3 {
+		t.Errorf("answer() for browse = %+v, want SRV, TXT and A", resp)
+	}
+}
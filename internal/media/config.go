@@ -6,11 +6,15 @@ type ConfigOverride struct {
 	ProfileName  string   // Use a named profile (e.g., "zebra-4x6")
 	MediaSizes   []string // Or specify sizes directly
 	DefaultMedia string   // Default size
+	NoAutoDetect bool     // Don't pick a profile by make/model for this printer
 }
 
 // ApplyConfigOverrides loads config overrides into the registry
 func (r *Registry) ApplyConfigOverrides(overrides []ConfigOverride) {
 	for _, o := range overrides {
+		if o.NoAutoDetect {
+			r.DisableAutoDetect(o.PrinterName)
+		}
 		if o.ProfileName != "" {
 			// Reference an existing profile
 			if p := r.GetProfileByName(o.ProfileName); p != nil {
@@ -0,0 +1,111 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileConfig is a media profile as written in YAML, in the config file or
+// a profiles directory
+type ProfileConfig struct {
+	Name         string       `yaml:"name"`
+	ModelMatch   []string     `yaml:"model_match"`   // Substrings of the printer make/model
+	ModelExclude []string     `yaml:"model_exclude"` // Substrings that rule the profile out
+	DefaultMatch []string     `yaml:"default_match"` // CUPS default media the printer must have
+	Priority     int          `yaml:"priority"`      // Wins over lower priorities when several match
+	Sizes        []SizeConfig `yaml:"sizes"`
+	Default      string       `yaml:"default"`
+	Bordered     bool         `yaml:"bordered"` // Use CUPS's margins for sizes without margins_mm
+}
+
+// SizeConfig is one media size of a ProfileConfig, in millimetres
+type SizeConfig struct {
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description"`
+	WidthMM     float64 `yaml:"width_mm"` // Needed when the name doesn't encode the size
+	HeightMM    float64 `yaml:"height_mm"`
+	MarginsMM   *struct {
+		Top    float64 `yaml:"top"`
+		Bottom float64 `yaml:"bottom"`
+		Left   float64 `yaml:"left"`
+		Right  float64 `yaml:"right"`
+	} `yaml:"margins_mm"` // Omit for edge-to-edge label stock
+	Source string `yaml:"source"` // Tray or roll, if the size is tied to one
+}
+
+// Profile validates the config and converts it to a Profile
+func (c ProfileConfig) Profile() (Profile, error) {
+	if c.Name == "" {
+		return Profile{}, fmt.Errorf("media profiles need a name")
+	}
+	if len(c.Sizes) == 0 {
+		return Profile{}, fmt.Errorf("media profile %q has no sizes", c.Name)
+	}
+
+	hundredths := func(mm float64) int { return int(mm*100 + 0.5) }
+	p := Profile{Name: c.Name, ModelMatch: c.ModelMatch, ModelExclude: c.ModelExclude, DefaultMatch: c.DefaultMatch, Priority: c.Priority, DefaultMedia: c.Default, Bordered: c.Bordered}
+	for _, size := range c.Sizes {
+		if size.Name == "" {
+			return Profile{}, fmt.Errorf("media profile %q: sizes need a name", c.Name)
+		}
+		if (size.WidthMM > 0) != (size.HeightMM > 0) || size.WidthMM < 0 || size.HeightMM < 0 {
+			return Profile{}, fmt.Errorf("media profile %q: size %q needs both width_mm and height_mm", c.Name, size.Name)
+		}
+		s := MediaSize{
+			Name:        size.Name,
+			Description: size.Description,
+			Width:       hundredths(size.WidthMM),
+			Height:      hundredths(size.HeightMM),
+			Source:      size.Source,
+		}
+		if m := size.MarginsMM; m != nil {
+			s.Margins = &Margins{Top: hundredths(m.Top), Bottom: hundredths(m.Bottom), Left: hundredths(m.Left), Right: hundredths(m.Right)}
+		}
+		p.Sizes = append(p.Sizes, s)
+	}
+
+	if p.DefaultMedia == "" {
+		p.DefaultMedia = p.Sizes[0].Name
+	}
+	if !contains(p.MediaNames(), p.DefaultMedia) {
+		return Profile{}, fmt.Errorf("media profile %q: default %q is not one of its sizes", c.Name, p.DefaultMedia)
+	}
+	return p, nil
+}
+
+// LoadProfileDir reads the profiles from each *.yaml file in dir, in file
+// name order. Each file holds a list of profiles.
+func LoadProfileDir(dir string) ([]Profile, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read profiles directory: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	sort.Strings(files)
+
+	var profiles []Profile
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var configs []ProfileConfig
+		if err := yaml.Unmarshal(data, &configs); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		for _, c := range configs {
+			p, err := c.Profile()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
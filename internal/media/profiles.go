@@ -4,18 +4,33 @@ import (
 	"strings"
 )
 
-// MediaSize pairs an IPP media name with a human-readable description
+// MediaSize pairs an IPP media name with a human-readable description and,
+// for names that don't encode it, the size of the media
 type MediaSize struct {
-	Name        string // IPP media size name
-	Description string // Human-readable description
+	Name        string   // IPP media size name
+	Description string   // Human-readable description
+	Width       int      // Hundredths of a millimetre; zero to take it from Name
+	Height      int      // Hundredths of a millimetre; zero to take it from Name
+	Margins     *Margins // Unprintable edges; nil for edge-to-edge label stock
+	Source      string   // Tray or roll the size is fed from, if it's tied to one
+}
+
+// Margins are the unprintable edges of the media, in hundredths of a
+// millimetre
+type Margins struct {
+	Top, Bottom, Left, Right int
 }
 
 // Profile defines media sizes for a specific printer model
 type Profile struct {
 	Name         string      // Profile name for config reference
 	ModelMatch   []string    // Substrings to match in printer make/model
+	ModelExclude []string    // Substrings that rule the profile out
+	DefaultMatch []string    // If set, CUPS's default media must also be one of these
+	Priority     int         // Preferred over lower priorities when several profiles match
 	Sizes        []MediaSize // Media sizes with descriptions
 	DefaultMedia string      // Default media size
+	Bordered     bool        // Sizes without margins use the ones CUPS reports instead of printing edge to edge
 }
 
 // builtinProfiles contains known printer media configurations
@@ -24,11 +39,11 @@ var builtinProfiles = []Profile{
 		Name:       "zebra-4x6",
 		ModelMatch: []string{"Zebra", "ZPL"},
 		Sizes: []MediaSize{
-			{"oe_4x6-label_4x6in", "4x6 inch shipping label"},
-			{"oe_4x4-label_4x4in", "4x4 inch square label"},
-			{"oe_4x3-label_4x3in", "4x3 inch label"},
-			{"oe_4x2-label_4x2in", "4x2 inch label"},
-			{"oe_2.25x1.25-label_2.25x1.25in", "2.25x1.25 inch barcode label"},
+			{Name: "oe_4x6-label_4x6in", Description: "4x6 inch shipping label"},
+			{Name: "oe_4x4-label_4x4in", Description: "4x4 inch square label"},
+			{Name: "oe_4x3-label_4x3in", Description: "4x3 inch label"},
+			{Name: "oe_4x2-label_4x2in", Description: "4x2 inch label"},
+			{Name: "oe_2.25x1.25-label_2.25x1.25in", Description: "2.25x1.25 inch barcode label"},
 		},
 		DefaultMedia: "oe_4x6-label_4x6in",
 	},
@@ -36,23 +51,26 @@ var builtinProfiles = []Profile{
 		Name:       "dymo-labelwriter",
 		ModelMatch: []string{"DYMO", "LabelWriter"},
 		Sizes: []MediaSize{
-			{"oe_w167h288_30256", "Shipping label 2.31\" x 4\" (#30256)"},
-			{"oe_w79h252_30252", "Address label 1.12\" x 3.5\" (#30252)"},
-			{"oe_w101h252_30320", "Address label 1.4\" x 3.5\" (#30320)"},
-			{"oe_w54h144_30330", "Return address 0.75\" x 2\" (#30330)"},
-			{"oe_w162h90_30323", "Shipping label 2.12\" x 1.25\" (#30323)"},
+			// DYMO names give the size in points, which PWG parsing doesn't understand
+			{Name: "oe_w167h288_30256", Description: "Shipping label 2.31\" x 4\" (#30256)", Width: 5891, Height: 10160},
+			{Name: "oe_w79h252_30252", Description: "Address label 1.12\" x 3.5\" (#30252)", Width: 2787, Height: 8890},
+			{Name: "oe_w101h252_30320", Description: "Address label 1.4\" x 3.5\" (#30320)", Width: 3563, Height: 8890},
+			{Name: "oe_w54h144_30330", Description: "Return address 0.75\" x 2\" (#30330)", Width: 1905, Height: 5080},
+			{Name: "oe_w162h90_30323", Description: "Shipping label 2.12\" x 1.25\" (#30323)", Width: 5715, Height: 3175},
 		},
 		DefaultMedia: "oe_w167h288_30256",
 	},
 	{
 		Name:       "brother-ql",
 		ModelMatch: []string{"Brother", "QL-"},
+		// Brother's lasers and tape printers aren't QL label printers
+		ModelExclude: []string{"HL-", "MFC-", "DCP-", "PT-"},
 		Sizes: []MediaSize{
-			{"oe_62x100mm_62x100mm", "62x100mm shipping label"},
-			{"oe_62x29mm_62x29mm", "62x29mm address label"},
-			{"oe_29x90mm_29x90mm", "29x90mm narrow label"},
-			{"oe_17x54mm_17x54mm", "17x54mm small label"},
-			{"oe_12mm_12mm", "12mm continuous tape"},
+			{Name: "oe_62x100mm_62x100mm", Description: "62x100mm shipping label"},
+			{Name: "oe_62x29mm_62x29mm", Description: "62x29mm address label"},
+			{Name: "oe_29x90mm_29x90mm", Description: "29x90mm narrow label"},
+			{Name: "oe_17x54mm_17x54mm", Description: "17x54mm small label"},
+			{Name: "oe_12mm_12mm", Description: "12mm continuous tape"},
 		},
 		DefaultMedia: "oe_62x100mm_62x100mm",
 	},
@@ -60,31 +78,128 @@ var builtinProfiles = []Profile{
 		Name:       "rollo",
 		ModelMatch: []string{"Rollo"},
 		Sizes: []MediaSize{
-			{"oe_4x6-label_4x6in", "4x6 inch shipping label"},
-			{"oe_4x4-label_4x4in", "4x4 inch square label"},
-			{"oe_4x2-label_4x2in", "4x2 inch label"},
+			{Name: "oe_4x6-label_4x6in", Description: "4x6 inch shipping label"},
+			{Name: "oe_4x4-label_4x4in", Description: "4x4 inch square label"},
+			{Name: "oe_4x2-label_4x2in", Description: "4x2 inch label"},
 		},
 		DefaultMedia: "oe_4x6-label_4x6in",
 	},
+	{
+		Name:       "photo",
+		ModelMatch: []string{"SELPHY", "PictureMate", "DS-RX1", "DS620", "DS820", "CP-D70", "CP-D80", "Kodak 605", "Kodak 6800"},
+		Sizes: []MediaSize{
+			{Name: "na_index-4x6_4x6in", Description: "4x6 inch photo"},
+			{Name: "na_5x7_5x7in", Description: "5x7 inch photo"},
+			{Name: "iso_a6_105x148mm", Description: "A6 photo"},
+			{Name: "oe_photo-l_3.5x5in", Description: "3.5x5 inch (L) photo"},
+		},
+		DefaultMedia: "na_index-4x6_4x6in",
+	},
+	{
+		Name:       "receipt-80mm",
+		ModelMatch: []string{"TM-T88", "TM-T20", "TM-T82", "TM-m30", "TSP100", "TSP143", "TSP650", "TSP700", "mC-Print3", "SRP-350"},
+		// Receipt printers print about 72mm of an 80mm roll
+		Sizes: []MediaSize{
+			{Name: "om_receipt-short_80x100mm", Description: "80mm receipt, short", Margins: &Margins{Left: 400, Right: 400}},
+			{Name: "om_receipt_80x200mm", Description: "80mm receipt", Margins: &Margins{Left: 400, Right: 400}},
+			{Name: "om_receipt-long_80x297mm", Description: "80mm receipt, long", Margins: &Margins{Left: 400, Right: 400}},
+		},
+		DefaultMedia: "om_receipt_80x200mm",
+	},
+	{
+		Name:       "receipt-58mm",
+		ModelMatch: []string{"TM-P20", "TM-P60", "TM-T70", "SM-L200", "SM-S230", "mPOP", "mC-Print2"},
+		// A 58mm roll has about 48mm of printable width
+		Sizes: []MediaSize{
+			{Name: "om_receipt-short_58x100mm", Description: "58mm receipt, short", Margins: &Margins{Left: 500, Right: 500}},
+			{Name: "om_receipt_58x200mm", Description: "58mm receipt", Margins: &Margins{Left: 500, Right: 500}},
+		},
+		DefaultMedia: "om_receipt_58x200mm",
+	},
+	// Office printers list dozens of sizes through CUPS; these cover the ones
+	// people pick. The paper region is taken from the queue's default.
+	{
+		Name:         "office-letter",
+		ModelMatch:   officeModels,
+		DefaultMatch: []string{"na_letter_8.5x11in", "na_legal_8.5x14in"},
+		Sizes: []MediaSize{
+			{Name: "na_letter_8.5x11in", Description: "Letter"},
+			{Name: "na_legal_8.5x14in", Description: "Legal"},
+			{Name: "na_executive_7.25x10.5in", Description: "Executive"},
+			{Name: "na_invoice_5.5x8.5in", Description: "Statement"},
+			{Name: "iso_a4_210x297mm", Description: "A4"},
+			{Name: "na_number-10_4.125x9.5in", Description: "#10 envelope"},
+		},
+		DefaultMedia: "na_letter_8.5x11in",
+		Bordered:     true,
+	},
+	{
+		Name:         "office-a4",
+		ModelMatch:   officeModels,
+		DefaultMatch: []string{"iso_a4_210x297mm"},
+		Sizes: []MediaSize{
+			{Name: "iso_a4_210x297mm", Description: "A4"},
+			{Name: "iso_a5_148x210mm", Description: "A5"},
+			{Name: "iso_b5_176x250mm", Description: "B5"},
+			{Name: "na_letter_8.5x11in", Description: "Letter"},
+			{Name: "iso_dl_110x220mm", Description: "DL envelope"},
+			{Name: "iso_c5_162x229mm", Description: "C5 envelope"},
+		},
+		DefaultMedia: "iso_a4_210x297mm",
+		Bordered:     true,
+	},
+}
+
+// officeModels matches common laser and inkjet office printer lines
+var officeModels = []string{
+	"LaserJet", "OfficeJet", "DeskJet", "ENVY", "PageWide",
+	"PIXMA", "MAXIFY", "imageCLASS", "i-SENSYS", "imageRUNNER",
+	"WorkForce", "EcoTank", "Expression",
+	"ECOSYS", "TASKalfa", "VersaLink", "WorkCentre", "Phaser",
+	"bizhub", "Lexmark", "Aficio", "Ricoh",
+	"HL-", "MFC-", "DCP-",
 }
 
 // Registry manages media profiles
 type Registry struct {
 	profiles []Profile
+	added    int                // Number of profiles at the front from AddProfile
 	custom   map[string]Profile // keyed by printer name
+
+	noAutoDetect map[string]bool // printers that only get explicitly assigned profiles
 }
 
 // NewRegistry creates a registry with builtin profiles
 func NewRegistry() *Registry {
 	return &Registry{
-		profiles: builtinProfiles,
-		custom:   make(map[string]Profile),
+		profiles:     builtinProfiles,
+		custom:       make(map[string]Profile),
+		noAutoDetect: make(map[string]bool),
 	}
 }
 
-// AddProfile adds a custom profile
+// AddProfile adds a custom profile, replacing any profile with the same name.
+// Added profiles are matched against printer models before the builtin ones.
 func (r *Registry) AddProfile(p Profile) {
-	r.profiles = append(r.profiles, p)
+	var added, others []Profile
+	for i, existing := range r.profiles {
+		switch {
+		case existing.Name == p.Name:
+		case i < r.added:
+			added = append(added, existing)
+		default:
+			others = append(others, existing)
+		}
+	}
+	added = append(added, p)
+	r.profiles = append(added, others...)
+	r.added = len(added)
+}
+
+// DisableAutoDetect stops a printer from getting a profile by model match;
+// a profile set with SetCustom still applies
+func (r *Registry) DisableAutoDetect(printerName string) {
+	r.noAutoDetect[printerName] = true
 }
 
 // SetCustom sets a custom profile for a specific printer name
@@ -94,29 +209,74 @@ func (r *Registry) SetCustom(printerName string, p Profile) {
 
 // GetProfile finds the best matching profile for a printer
 // Priority: 1. Custom profile for printer name, 2. Model match, 3. nil (use CUPS)
-func (r *Registry) GetProfile(printerName, makeModel string) *Profile {
+func (r *Registry) GetProfile(printerName, makeModel, cupsDefault string) *Profile {
 	// Check custom profiles first
 	if p, ok := r.custom[printerName]; ok {
 		return &p
 	}
+	if r.noAutoDetect[printerName] {
+		return nil
+	}
 
-	// Check model matching
-	makeModelLower := strings.ToLower(makeModel)
+	// Check model matching. The highest priority wins, then the profile
+	// matching the most substrings, then the longest one; ties go to the
+	// profile found first.
+	var best *Profile
+	var bestScore matchScore
 	for i := range r.profiles {
-		for _, match := range r.profiles[i].ModelMatch {
-			if strings.Contains(makeModelLower, strings.ToLower(match)) {
-				return &r.profiles[i]
-			}
+		score, ok := r.profiles[i].match(makeModel, cupsDefault)
+		if ok && (best == nil || score.beats(bestScore)) {
+			best, bestScore = &r.profiles[i], score
 		}
 	}
+	return best
+}
 
-	return nil
+// matchScore ranks a profile's match against a printer
+type matchScore struct {
+	priority int
+	matches  int
+	longest  int
+}
+
+func (s matchScore) beats(other matchScore) bool {
+	if s.priority != other.priority {
+		return s.priority > other.priority
+	}
+	if s.matches != other.matches {
+		return s.matches > other.matches
+	}
+	return s.longest > other.longest
+}
+
+// match scores the profile against a printer's make/model and CUPS default
+// media
+func (p *Profile) match(makeModel, cupsDefault string) (matchScore, bool) {
+	if len(p.DefaultMatch) > 0 && !contains(p.DefaultMatch, cupsDefault) {
+		return matchScore{}, false
+	}
+	makeModel = strings.ToLower(makeModel)
+	for _, exclude := range p.ModelExclude {
+		if strings.Contains(makeModel, strings.ToLower(exclude)) {
+			return matchScore{}, false
+		}
+	}
+	score := matchScore{priority: p.Priority}
+	for _, match := range p.ModelMatch {
+		if strings.Contains(makeModel, strings.ToLower(match)) {
+			score.matches++
+			if len(match) > score.longest {
+				score.longest = len(match)
+			}
+		}
+	}
+	return score, score.matches > 0
 }
 
 // ApplyProfile applies a profile to override media settings
 // Returns the media list and default to use
 func (r *Registry) ApplyProfile(printerName, makeModel string, cupsMedia []string, cupsDefault string) (media []string, defaultMedia string) {
-	profile := r.GetProfile(printerName, makeModel)
+	profile := r.GetProfile(printerName, makeModel, cupsDefault)
 
 	if profile != nil {
 		return profile.MediaNames(), profile.DefaultMedia
@@ -126,6 +286,26 @@ func (r *Registry) ApplyProfile(printerName, makeModel string, cupsMedia []strin
 	return cupsMedia, cupsDefault
 }
 
+// Sources returns the distinct trays the profile's sizes are fed from
+func (p *Profile) Sources() []string {
+	var sources []string
+	for _, s := range p.Sizes {
+		if s.Source != "" && !contains(sources, s.Source) {
+			sources = append(sources, s.Source)
+		}
+	}
+	return sources
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 // MediaNames returns just the IPP media names from the profile
 func (p *Profile) MediaNames() []string {
 	names := make([]string, len(p.Sizes))
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metrics and renders them in the Prometheus text format
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric // In registration order
+}
+
+// metric is anything the registry can render
+type metric interface {
+	write(b *strings.Builder)
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]uint64 // joined label values -> count
+}
+
+// Counter registers a new counter with the given label names
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]uint64),
+	}
+
+	r.register(c)
+	return c
+}
+
+// Gauge is a gauge whose value is read from a function at scrape time
+type Gauge struct {
+	name  string
+	help  string
+	value func() float64
+}
+
+// Gauge registers an unlabeled gauge that reports value() when scraped
+func (r *Registry) Gauge(name, help string, value func() float64) *Gauge {
+	g := &Gauge{name: name, help: help, value: value}
+	r.register(g)
+	return g
+}
+
+// GaugeVec is a gauge with one label, whose values are read from a function
+// at scrape time
+type GaugeVec struct {
+	name   string
+	help   string
+	label  string
+	values func() map[string]float64
+}
+
+// GaugeVec registers a gauge labeled label that reports values() when
+// scraped, one sample per key
+func (r *Registry) GaugeVec(name, help, label string, values func() map[string]float64) *GaugeVec {
+	g := &GaugeVec{name: name, help: help, label: label, values: values}
+	r.register(g)
+	return g
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// Inc increments the counter for the given label values, which must match
+// the label names in number and order
+func (c *CounterVec) Inc(labelValues ...string) {
+	if c == nil {
+		return
+	}
+	key := strings.Join(labelValues, "\x00")
+
+	c.mu.Lock()
+	c.values[key]++
+	c.mu.Unlock()
+}
+
+// Value returns the current count for the given label values
+func (c *CounterVec) Value(labelValues ...string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\x00")]
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		m.write(&b)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (c *CounterVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n", c.name, c.help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", c.name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s%s %d\n", c.name, formatLabels(c.labels, strings.Split(k, "\x00")), c.values[k])
+	}
+}
+
+func (g *Gauge) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n", g.name, g.help)
+	fmt.Fprintf(b, "# TYPE %s gauge\n", g.name)
+	fmt.Fprintf(b, "%s %s\n", g.name, strconv.FormatFloat(g.value(), 'g', -1, 64))
+}
+
+func (g *GaugeVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n", g.name, g.help)
+	fmt.Fprintf(b, "# TYPE %s gauge\n", g.name)
+
+	values := g.values()
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s%s %s\n", g.name, formatLabels([]string{g.label}, []string{k}), strconv.FormatFloat(values[k], 'g', -1, 64))
+	}
+}
+
+// formatLabels renders {name="value",...}, or nothing for unlabeled metrics
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=%q", name, value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Handler serves the registry's metrics over HTTP
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = r.WriteTo(w)
+	})
+}
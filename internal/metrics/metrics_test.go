@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	denied := r.Counter("jobs_denied_total", "Jobs refused by CUPS.", "printer", "reason")
+	plain := r.Counter("requests_total", "Requests handled.")
+
+	denied.Inc("Office", "quota")
+	denied.Inc("Office", "quota")
+	denied.Inc("Lab \"2\"", "policy")
+	plain.Inc()
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP jobs_denied_total Jobs refused by CUPS.
+# TYPE jobs_denied_total counter
+jobs_denied_total{printer="Lab \"2\"",reason="policy"} 1
+jobs_denied_total{printer="Office",reason="quota"} 2
+# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total 1
+`
+	if b.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	if got := denied.Value("Office", "quota"); got != 2 {
+		t.Errorf("Value() = %d, want 2", got)
+	}
+}
+
+func TestGaugeVec(t *testing.T) {
+	r := NewRegistry()
+	r.GaugeVec("archive_bytes", "Bytes archived.", "printer", func() map[string]float64 {
+		return map[string]float64{"Office": 2048, "Lab": 1.5e9}
+	})
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP archive_bytes Bytes archived.
+# TYPE archive_bytes gauge
+archive_bytes{printer="Lab"} 1.5e+09
+archive_bytes{printer="Office"} 2048
+`
+	if b.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sampleMaxAge is how long a resource sample is reused, so one scrape
+// doesn't stop the world once per gauge
+const sampleMaxAge = time.Second
+
+// Resources is a snapshot of what the bridge is using, for sizing hardware
+type Resources struct {
+	OpenConnections int    `json:"open_connections"` // Client connections, idle or not
+	IdleConnections int    `json:"idle_connections"` // Keep-alive connections waiting for a request
+	Goroutines      int    `json:"goroutines"`
+	SpoolFiles      int    `json:"spool_files"` // Documents buffered on disk
+	SpoolBytes      int64  `json:"spool_bytes"`
+	PeakSpoolBytes  int64  `json:"peak_spool_bytes"`
+	HeapBytes       uint64 `json:"heap_bytes"` // Live heap, where documents are buffered in memory
+	PeakHeapBytes   uint64 `json:"peak_heap_bytes"`
+	SysBytes        uint64 `json:"sys_bytes"` // Memory obtained from the OS
+	PeakSysBytes    uint64 `json:"peak_sys_bytes"`
+}
+
+// ResourceMonitor samples resource usage and remembers the high-water marks
+// seen since the bridge started. Peaks are only as good as the sampling, so
+// Sample should also be called periodically, not just when scraped.
+type ResourceMonitor struct {
+	spoolDir    string
+	spoolPrefix string
+	connections func() (open, idle int)
+
+	mu      sync.Mutex
+	last    Resources
+	sampled time.Time
+	now     func() time.Time
+}
+
+// NewResourceMonitor creates a monitor that counts files starting with
+// spoolPrefix in spoolDir as spool, and asks connections, which may be nil,
+// for the number of client connections
+func NewResourceMonitor(spoolDir, spoolPrefix string, connections func() (open, idle int)) *ResourceMonitor {
+	return &ResourceMonitor{
+		spoolDir:    spoolDir,
+		spoolPrefix: spoolPrefix,
+		connections: connections,
+		now:         time.Now,
+	}
+}
+
+// Sample returns current usage and the peaks so far
+func (m *ResourceMonitor) Sample() Resources {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now := m.now(); now.Sub(m.sampled) >= sampleMaxAge || m.sampled.IsZero() {
+		m.last = m.sample(m.last)
+		m.sampled = now
+	}
+	return m.last
+}
+
+// sample takes a new snapshot, carrying the peaks over from prev
+func (m *ResourceMonitor) sample(prev Resources) Resources {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	r := Resources{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapBytes:      mem.HeapAlloc,
+		SysBytes:       mem.Sys,
+		PeakSpoolBytes: prev.PeakSpoolBytes,
+		PeakHeapBytes:  prev.PeakHeapBytes,
+		PeakSysBytes:   prev.PeakSysBytes,
+	}
+	if m.connections != nil {
+		r.OpenConnections, r.IdleConnections = m.connections()
+	}
+	r.SpoolFiles, r.SpoolBytes = spoolUsage(m.spoolDir, m.spoolPrefix)
+
+	if r.SpoolBytes > r.PeakSpoolBytes {
+		r.PeakSpoolBytes = r.SpoolBytes
+	}
+	if r.HeapBytes > r.PeakHeapBytes {
+		r.PeakHeapBytes = r.HeapBytes
+	}
+	if r.SysBytes > r.PeakSysBytes {
+		r.PeakSysBytes = r.SysBytes
+	}
+	return r
+}
+
+// Register exposes the monitor's samples as gauges named prefix_*
+func (m *ResourceMonitor) Register(r *Registry, prefix string) {
+	gauge := func(name, help string, value func(Resources) float64) {
+		r.Gauge(prefix+"_"+name, help, func() float64 { return value(m.Sample()) })
+	}
+	gauge("open_connections", "Open client connections, including idle keep-alive ones.",
+		func(s Resources) float64 { return float64(s.OpenConnections) })
+	gauge("idle_connections", "Client keep-alive connections waiting for a request.",
+		func(s Resources) float64 { return float64(s.IdleConnections) })
+	gauge("goroutines", "Goroutines currently running.",
+		func(s Resources) float64 { return float64(s.Goroutines) })
+	gauge("spool_files", "Documents spooled to disk.",
+		func(s Resources) float64 { return float64(s.SpoolFiles) })
+	gauge("spool_bytes", "Bytes of documents spooled to disk.",
+		func(s Resources) float64 { return float64(s.SpoolBytes) })
+	gauge("spool_peak_bytes", "Most bytes spooled to disk at once since start.",
+		func(s Resources) float64 { return float64(s.PeakSpoolBytes) })
+	gauge("heap_bytes", "Bytes of live heap memory.",
+		func(s Resources) float64 { return float64(s.HeapBytes) })
+	gauge("heap_peak_bytes", "Most bytes of live heap memory seen since start.",
+		func(s Resources) float64 { return float64(s.PeakHeapBytes) })
+	gauge("sys_bytes", "Bytes of memory obtained from the OS.",
+		func(s Resources) float64 { return float64(s.SysBytes) })
+	gauge("sys_peak_bytes", "Most bytes of memory obtained from the OS seen since start.",
+		func(s Resources) float64 { return float64(s.PeakSysBytes) })
+}
+
+// spoolUsage counts the regular files in dir whose names start with prefix.
+// Files that vanish while being counted are skipped.
+func spoolUsage(dir, prefix string) (files int, bytes int64) {
+	if dir == "" {
+		return 0, 0
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		files++
+		bytes += info.Size()
+	}
+	return files, bytes
+}
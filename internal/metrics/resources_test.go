@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceMonitor_Sample(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int) {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("airprint-broadcast-1", 100)
+	write("airprint-broadcast-2", 50)
+	write("other-file", 1000)
+	if err := os.Mkdir(filepath.Join(dir, "airprint-dir"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(0, 0)
+	m := NewResourceMonitor(dir, "airprint-", func() (int, int) { return 3, 1 })
+	m.now = func() time.Time { return now }
+
+	got := m.Sample()
+	if got.SpoolFiles != 2 || got.SpoolBytes != 150 || got.PeakSpoolBytes != 150 {
+		t.Errorf("spool = %d files, %d bytes, peak %d; want 2, 150, 150", got.SpoolFiles, got.SpoolBytes, got.PeakSpoolBytes)
+	}
+	if got.OpenConnections != 3 || got.IdleConnections != 1 {
+		t.Errorf("connections = %d open, %d idle; want 3, 1", got.OpenConnections, got.IdleConnections)
+	}
+	if got.Goroutines == 0 || got.HeapBytes == 0 || got.PeakHeapBytes < got.HeapBytes {
+		t.Errorf("runtime stats not sampled: %+v", got)
+	}
+
+	// Within sampleMaxAge the previous sample is reused
+	if err := os.Remove(filepath.Join(dir, "airprint-broadcast-1")); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Sample(); got.SpoolBytes != 150 {
+		t.Errorf("cached SpoolBytes = %d, want 150", got.SpoolBytes)
+	}
+
+	// The peak outlives the spool file
+	now = now.Add(sampleMaxAge)
+	got = m.Sample()
+	if got.SpoolBytes != 50 || got.PeakSpoolBytes != 150 {
+		t.Errorf("after removal spool = %d bytes, peak %d; want 50, 150", got.SpoolBytes, got.PeakSpoolBytes)
+	}
+}
+
+func TestResourceMonitor_Register(t *testing.T) {
+	r := NewRegistry()
+	NewResourceMonitor("", "", func() (int, int) { return 7, 2 }).Register(r, "bridge")
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	for _, want := range []string{
+		"# TYPE bridge_open_connections gauge\nbridge_open_connections 7\n",
+		"bridge_idle_connections 2\n",
+		"bridge_spool_bytes 0\n",
+		"# TYPE bridge_heap_peak_bytes gauge\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("WriteTo() missing %q in\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package privsep lets the bridge run as an unprivileged user. Writing
+// Avahi's service directory needs root, so before dropping privileges the
+// bridge starts a copy of itself as a helper that keeps them and makes only
+// those changes, asked for over a pipe.
+package privsep
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
+)
+
+// HelperCommand is the command the bridge runs its helper with
+const HelperCommand = "privsep-helper"
+
+// Operations a helper performs
+const (
+	opWrite  = "write"
+	opRemove = "remove"
+	opRename = "rename"
+)
+
+// request asks the helper for one change, as a line of JSON
+type request struct {
+	Op      string `json:"op"`
+	Name    string `json:"name"`
+	NewName string `json:"new_name,omitempty"`
+	Content []byte `json:"content,omitempty"`
+}
+
+// response answers a request, with an empty error on success
+type response struct {
+	Error      string `json:"error,omitempty"`
+	Unwritable bool   `json:"unwritable,omitempty"` // Error is avahi.ErrServiceDirUnwritable
+}
+
+// helperError is an error the helper reported
+type helperError struct {
+	msg        string
+	unwritable bool
+}
+
+func (e *helperError) Error() string {
+	return e.msg
+}
+
+// Is keeps avahi.ErrServiceDirUnwritable matching across the pipe
+func (e *helperError) Is(target error) bool {
+	return e.unwritable && target == avahi.ErrServiceDirUnwritable
+}
+
+// Helper makes changes in the service directory through a helper process.
+// It implements avahi.Files.
+type Helper struct {
+	mu  sync.Mutex
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+// Start runs this executable's helper command for the service directory dir
+func Start(dir string) (*Helper, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find executable: %w", err)
+	}
+	cmd := exec.Command(exe, HelperCommand, "--dir", dir)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create helper pipe: %w", err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create helper pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start helper: %w", err)
+	}
+	h := newHelper(in, out)
+	h.cmd = cmd
+	return h, nil
+}
+
+// newHelper creates a helper talking over in and out
+func newHelper(in io.WriteCloser, out io.Reader) *Helper {
+	return &Helper{in: in, out: bufio.NewReader(out)}
+}
+
+// WriteFile implements avahi.Files
+func (h *Helper) WriteFile(name string, content []byte) error {
+	return h.do(request{Op: opWrite, Name: name, Content: content})
+}
+
+// Remove implements avahi.Files
+func (h *Helper) Remove(name string) error {
+	return h.do(request{Op: opRemove, Name: name})
+}
+
+// Rename implements avahi.Files
+func (h *Helper) Rename(oldName, newName string) error {
+	return h.do(request{Op: opRename, Name: oldName, NewName: newName})
+}
+
+// do sends a request and waits for its response
+func (h *Helper) do(req request) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err := h.in.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to send request to helper: %w", err)
+	}
+	line, err := h.out.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read helper response: %w", err)
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("invalid helper response: %w", err)
+	}
+	if resp.Error != "" {
+		return &helperError{msg: resp.Error, unwritable: resp.Unwritable}
+	}
+	return nil
+}
+
+// Close stops the helper, which exits once its input is closed
+func (h *Helper) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	err := h.in.Close()
+	if h.cmd != nil {
+		if waitErr := h.cmd.Wait(); err == nil {
+			err = waitErr
+		}
+	}
+	return err
+}
+
+// RunHelper is the helper process: it serves requests on stdin for the
+// service directory dir until stdin is closed. Stop signals are ignored, so
+// that when the whole service is stopped the bridge can still have its
+// service files removed.
+func RunHelper(dir string) error {
+	signal.Ignore(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	return Serve(os.Stdin, os.Stdout, avahi.DirFiles(dir))
+}
+
+// Serve answers requests read from r on w, making the changes through files,
+// until r ends
+func Serve(r io.Reader, w io.Writer, files avahi.Files) error {
+	in := bufio.NewReader(r)
+	enc := json.NewEncoder(w)
+	for {
+		line, err := in.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var resp response
+		if err := serveOne(line, files); err != nil {
+			resp.Error = err.Error()
+			resp.Unwritable = errors.Is(err, avahi.ErrServiceDirUnwritable)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// serveOne performs one request
+func serveOne(line []byte, files avahi.Files) error {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+	if err := validName(req.Name); err != nil {
+		return err
+	}
+	switch req.Op {
+	case opWrite:
+		return files.WriteFile(req.Name, req.Content)
+	case opRemove:
+		return files.Remove(req.Name)
+	case opRename:
+		if err := validName(req.NewName); err != nil {
+			return err
+		}
+		return files.Rename(req.Name, req.NewName)
+	default:
+		return fmt.Errorf("unknown operation %q", req.Op)
+	}
+}
+
+// validName checks that a request names a service file, or a set aside
+// legacy one, directly in the service directory and nothing else
+func validName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	if !strings.HasSuffix(name, ".service") && !strings.HasSuffix(name, ".service.legacy") {
+		return fmt.Errorf("%q is not a service file", name)
+	}
+	return nil
+}
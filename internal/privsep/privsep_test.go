@@ -0,0 +1,120 @@
+package privsep
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/avahi"
+)
+
+// startServe runs Serve for dir in the background and returns a helper
+// talking to it
+func startServe(t *testing.T, dir string) *Helper {
+	t.Helper()
+	return startServeFiles(t, avahi.DirFiles(dir))
+}
+
+// startServeFiles runs Serve for files in the background and returns a
+// helper talking to it
+func startServeFiles(t *testing.T, files avahi.Files) *Helper {
+	t.Helper()
+	reqR, reqW := io.Pipe()
+	respR, respW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(reqR, respW, files)
+		respW.Close()
+	}()
+	h := newHelper(reqW, respR)
+	t.Cleanup(func() {
+		h.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+	return h
+}
+
+func TestHelper(t *testing.T) {
+	dir := t.TempDir()
+	h := startServe(t, dir)
+
+	if err := h.WriteFile("airprint-office.service", []byte("<service-group/>")); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "airprint-office.service"))
+	if err != nil || string(data) != "<service-group/>" {
+		t.Fatalf("service file = %q, %v", data, err)
+	}
+
+	if err := h.Rename("airprint-office.service", "airprint-office.service.legacy"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "airprint-office.service.legacy")); err != nil {
+		t.Errorf("renamed file missing: %v", err)
+	}
+
+	if err := h.Remove("airprint-office.service.legacy"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := h.Remove("airprint-office.service.legacy"); err != nil {
+		t.Errorf("Remove() of a missing file error = %v, want nil", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("directory has %d entries, want 0", len(entries))
+	}
+}
+
+func TestHelper_RejectsNames(t *testing.T) {
+	dir := t.TempDir()
+	h := startServe(t, dir)
+
+	tests := []struct {
+		name    string
+		do      func() error
+		wantErr string
+	}{
+		{"traversal", func() error { return h.WriteFile("../passwd.service", nil) }, "invalid file name"},
+		{"absolute", func() error { return h.Remove("/etc/passwd") }, "invalid file name"},
+		{"hidden", func() error { return h.WriteFile(".x.service", nil) }, "invalid file name"},
+		{"not a service file", func() error { return h.WriteFile("avahi-daemon.conf", nil) }, "not a service file"},
+		{"rename target", func() error { return h.Rename("a.service", "a.conf") }, "not a service file"},
+		{"empty", func() error { return h.Remove("") }, "invalid file name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.do()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// readOnlyFiles fails every change as a read-only directory would
+type readOnlyFiles struct{}
+
+func (readOnlyFiles) WriteFile(string, []byte) error {
+	return fmt.Errorf("%w: read-only file system", avahi.ErrServiceDirUnwritable)
+}
+func (readOnlyFiles) Remove(string) error         { return errors.New("busy") }
+func (readOnlyFiles) Rename(string, string) error { return nil }
+
+func TestHelper_KeepsErrServiceDirUnwritable(t *testing.T) {
+	h := startServeFiles(t, readOnlyFiles{})
+
+	err := h.WriteFile("a.service", nil)
+	if !errors.Is(err, avahi.ErrServiceDirUnwritable) {
+		t.Errorf("WriteFile() error = %v, want ErrServiceDirUnwritable", err)
+	}
+	err = h.Remove("a.service")
+	if err == nil || errors.Is(err, avahi.ErrServiceDirUnwritable) {
+		t.Errorf("Remove() error = %v, want another error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package privsep
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// Credentials identify the user and group to run as
+type Credentials struct {
+	UID int
+	GID int
+}
+
+// Lookup finds the credentials for a user name or ID, and a group name or ID.
+// Without a group, the user's primary group is used.
+func Lookup(userName, groupName string) (Credentials, error) {
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			return Credentials{}, fmt.Errorf("failed to find user %s: %w", userName, err)
+		}
+	}
+	gid := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				return Credentials{}, fmt.Errorf("failed to find group %s: %w", groupName, err)
+			}
+		}
+		gid = g.Gid
+	}
+
+	var creds Credentials
+	if creds.UID, err = strconv.Atoi(u.Uid); err != nil {
+		return Credentials{}, fmt.Errorf("invalid user ID %s: %w", u.Uid, err)
+	}
+	if creds.GID, err = strconv.Atoi(gid); err != nil {
+		return Credentials{}, fmt.Errorf("invalid group ID %s: %w", gid, err)
+	}
+	return creds, nil
+}
+
+// Chown gives the files under root to the credentials, so the bridge can
+// still write the state it created as root. A missing root is skipped.
+func Chown(root string, creds Credentials) error {
+	err := filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, creds.UID, creds.GID)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to change owner of %s: %w", root, err)
+	}
+	return nil
+}
+
+// Drop switches the process to the credentials for good, giving up
+// supplementary groups. Sockets and files already open stay usable.
+func Drop(creds Credentials) error {
+	if err := syscall.Setgroups([]int{creds.GID}); err != nil {
+		return fmt.Errorf("failed to set groups: %w", err)
+	}
+	if err := syscall.Setgid(creds.GID); err != nil {
+		return fmt.Errorf("failed to set group ID: %w", err)
+	}
+	if err := syscall.Setuid(creds.UID); err != nil {
+		return fmt.Errorf("failed to set user ID: %w", err)
+	}
+	// Make sure root can't be regained
+	if creds.UID != 0 && syscall.Setuid(0) == nil {
+		return fmt.Errorf("privileges could be regained after dropping them")
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package raster
+
+import (
+	"bufio"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// PDF object numbers reserved for the document catalog and page tree
+const (
+	pdfCatalogObj = 1
+	pdfPagesObj   = 2
+)
+
+// PDFWriter encodes raster pages as a PDF with one full-page image per page.
+// Image data is compressed as it is written, so pages are never held in
+// memory.
+type PDFWriter struct {
+	w       *countingWriter
+	offsets []int64 // offsets[n-1] is the file offset of object n
+	pages   []int   // page object numbers
+	err     error
+
+	// Current page
+	header    PageHeader
+	imageObj  int
+	lengthObj int
+	start     int64
+	zw        *zlib.Writer
+}
+
+// countingWriter tracks the current file offset for the xref table
+type countingWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewPDFWriter creates a PDF writer
+func NewPDFWriter(w io.Writer) *PDFWriter {
+	p := &PDFWriter{
+		w:       &countingWriter{w: bufio.NewWriter(w)},
+		offsets: make([]int64, 2), // catalog and page tree are written last
+	}
+	p.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return p
+}
+
+// printf writes to the output, remembering the first error
+func (p *PDFWriter) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+// newObject allocates an object number
+func (p *PDFWriter) newObject() int {
+	p.offsets = append(p.offsets, 0)
+	return len(p.offsets)
+}
+
+// beginObject records the object's offset and writes its header
+func (p *PDFWriter) beginObject(n int) {
+	p.offsets[n-1] = p.w.n
+	p.printf("%d 0 obj\n", n)
+}
+
+// BeginPage finishes the current page and starts the image of the next
+func (p *PDFWriter) BeginPage(h PageHeader) error {
+	if err := p.endPage(); err != nil {
+		return err
+	}
+
+	colorSpace := "/DeviceRGB"
+	switch h.ColorSpace {
+	case Gray:
+		colorSpace = "/DeviceGray"
+	case CMYK:
+		colorSpace = "/DeviceCMYK"
+	}
+
+	p.header = h
+	p.imageObj = p.newObject()
+	p.lengthObj = p.newObject()
+
+	p.beginObject(p.imageObj)
+	p.printf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent %d /Filter /FlateDecode /Length %d 0 R >>\nstream\n",
+		h.Width, h.Height, colorSpace, h.BitsPerColor, p.lengthObj)
+	if p.err != nil {
+		return p.err
+	}
+
+	p.start = p.w.n
+	p.zw = zlib.NewWriter(p.w)
+	return nil
+}
+
+// WriteLine adds one uncompressed line to the current page image
+func (p *PDFWriter) WriteLine(line []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	_, p.err = p.zw.Write(line)
+	return p.err
+}
+
+// endPage closes the current image and writes its page objects
+func (p *PDFWriter) endPage() error {
+	if p.zw == nil {
+		return p.err
+	}
+	if p.err == nil {
+		p.err = p.zw.Close()
+	}
+	p.zw = nil
+	length := p.w.n - p.start
+	p.printf("\nendstream\nendobj\n")
+
+	p.beginObject(p.lengthObj)
+	p.printf("%d\nendobj\n", length)
+
+	// Scale the image to the page size in points
+	width := formatPoints(p.header.Width, p.header.DPI)
+	height := formatPoints(p.header.Height, p.header.DPI)
+	content := fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q", width, height)
+
+	contentObj := p.newObject()
+	p.beginObject(contentObj)
+	p.printf("<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+
+	pageObj := p.newObject()
+	p.beginObject(pageObj)
+	p.printf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+		pdfPagesObj, width, height, p.imageObj, contentObj)
+	p.pages = append(p.pages, pageObj)
+
+	return p.err
+}
+
+// Close finishes the last page and writes the page tree, catalog and xref
+func (p *PDFWriter) Close() error {
+	if err := p.endPage(); err != nil {
+		return err
+	}
+
+	p.beginObject(pdfPagesObj)
+	p.printf("<< /Type /Pages /Count %d /Kids [", len(p.pages))
+	for _, n := range p.pages {
+		p.printf(" %d 0 R", n)
+	}
+	p.printf(" ] >>\nendobj\n")
+
+	p.beginObject(pdfCatalogObj)
+	p.printf("<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", pdfPagesObj)
+
+	xref := p.w.n
+	p.printf("xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		p.printf("%010d 00000 n \n", offset)
+	}
+	p.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, pdfCatalogObj, xref)
+
+	if p.err != nil {
+		return p.err
+	}
+	return p.w.w.Flush()
+}
+
+// formatPoints converts a pixel length at dpi to PDF points
+func formatPoints(pixels, dpi int) string {
+	return strconv.FormatFloat(float64(pixels)*72/float64(dpi), 'f', 2, 64)
+}
@@ -0,0 +1,208 @@
+package raster
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Scaling modes for RenderImage, as in IPP print-scaling
+const (
+	ScaleAuto    = "auto"
+	ScaleAutoFit = "auto-fit"
+	ScaleFill    = "fill"
+	ScaleFit     = "fit"
+	ScaleNone    = "none"
+)
+
+// maxPreviewPixels bounds the pages rendered to images, which are kept
+// whole in memory
+const maxPreviewPixels = 1 << 26
+
+// Preview says how pages are rendered as they would print
+type Preview struct {
+	Page  int    // Page to render, from 1
+	Stamp *Stamp // Drawn on the page if not nil
+	Mono  bool   // Threshold to black and white, as label printers print
+}
+
+// RenderURFPage decodes the requested page of an Apple Raster document as an
+// image and returns it with the document's page count
+func RenderURFPage(src io.Reader, p Preview) (image.Image, int, error) {
+	urf, err := NewURFReader(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	out := &imageWriter{want: p.Page, mono: p.Mono}
+	if err := convert(urf, out, p.Stamp); err != nil {
+		return nil, 0, err
+	}
+	if out.img == nil {
+		return nil, out.pages, fmt.Errorf("document has %d pages, page %d requested", out.pages, p.Page)
+	}
+	return out.img, out.pages, nil
+}
+
+// RenderImage lays img out on a page of h's size as scaling says, centered,
+// and returns the page as it would print. Image pixels are printer dots
+// when not scaled. "auto" fills the page with images within a tenth of its
+// size, fits larger ones and leaves smaller ones alone; "auto-fit" only
+// shrinks images larger than the page.
+func RenderImage(img image.Image, h PageHeader, scaling string, p Preview) (image.Image, error) {
+	if h.Width <= 0 || h.Height <= 0 {
+		return nil, fmt.Errorf("invalid page size %dx%d", h.Width, h.Height)
+	}
+	h.BitsPerColor = 8
+	if h.ColorSpace != Gray {
+		h.ColorSpace = RGB
+	}
+
+	b := img.Bounds()
+	if b.Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+	scale := imageScale(b.Dx(), b.Dy(), h.Width, h.Height, scaling)
+	drawnW, drawnH := int(float64(b.Dx())*scale), int(float64(b.Dy())*scale)
+	left, top := (h.Width-drawnW)/2, (h.Height-drawnH)/2
+
+	out := &imageWriter{want: 1, mono: p.Mono}
+	if err := out.BeginPage(h); err != nil {
+		return nil, err
+	}
+	if p.Stamp != nil {
+		p.Stamp.beginPage(h)
+	}
+	line := make([]byte, h.BytesPerLine())
+	for y := 0; y < h.Height; y++ {
+		for i := range line {
+			line[i] = 0xff
+		}
+		if sy := int(float64(y-top) / scale); y >= top && sy < b.Dy() {
+			for x := max(left, 0); x < min(left+drawnW, h.Width); x++ {
+				sx := int(float64(x-left) / scale)
+				if sx >= b.Dx() {
+					break
+				}
+				setPixel(line, x, h, img.At(b.Min.X+sx, b.Min.Y+sy))
+			}
+		}
+		row := line
+		if p.Stamp != nil {
+			row = p.Stamp.apply(y, row)
+		}
+		if err := out.WriteLine(row); err != nil {
+			return nil, err
+		}
+	}
+	return out.img, nil
+}
+
+// imageScale returns the factor an image is scaled by to go on the page
+func imageScale(w, h, pageW, pageH int, scaling string) float64 {
+	fit := min(float64(pageW)/float64(w), float64(pageH)/float64(h))
+	fill := max(float64(pageW)/float64(w), float64(pageH)/float64(h))
+	switch scaling {
+	case ScaleFit:
+		return fit
+	case ScaleFill:
+		return fill
+	case ScaleNone:
+		return 1
+	case ScaleAutoFit:
+		return min(fit, 1)
+	}
+	// auto
+	if fit >= 0.9 && fit <= 1.1 {
+		return fill
+	}
+	return min(fit, 1)
+}
+
+// setPixel writes c as pixel x of an 8-bit gray or RGB line, composited on
+// white paper
+func setPixel(line []byte, x int, h PageHeader, c color.Color) {
+	r, g, b, a := c.RGBA()
+	white := 0xffff - a
+	r, g, b = (r+white)>>8, (g+white)>>8, (b+white)>>8
+	if h.ColorSpace == Gray {
+		line[x] = byte((r*299 + g*587 + b*114) / 1000)
+		return
+	}
+	line[3*x], line[3*x+1], line[3*x+2] = byte(r), byte(g), byte(b)
+}
+
+// imageWriter keeps one page of a document as an image
+type imageWriter struct {
+	want  int // Page kept, from 1
+	mono  bool
+	pages int
+
+	header PageHeader
+	y      int
+	img    image.Image
+	gray   *image.Gray
+	rgba   *image.RGBA
+}
+
+// BeginPage starts the next page, allocating the image if it is the one
+// kept
+func (w *imageWriter) BeginPage(h PageHeader) error {
+	w.pages++
+	if w.pages != w.want {
+		return nil
+	}
+	if h.Width*h.Height > maxPreviewPixels {
+		return fmt.Errorf("page %d is too large to preview: %dx%d", w.pages, h.Width, h.Height)
+	}
+	w.header, w.y = h, 0
+	rect := image.Rect(0, 0, h.Width, h.Height)
+	if w.mono || h.ColorSpace == Gray {
+		w.gray = image.NewGray(rect)
+		w.img = w.gray
+	} else {
+		w.rgba = image.NewRGBA(rect)
+		w.img = w.rgba
+	}
+	return nil
+}
+
+// WriteLine adds a line to the kept page
+func (w *imageWriter) WriteLine(line []byte) error {
+	if w.pages != w.want {
+		return nil
+	}
+	h := w.header
+	bpp := h.BytesPerPixel()
+	step := h.BitsPerColor / 8 // Only the high byte of 16-bit values is looked at
+	for x := 0; x < h.Width && (x+1)*bpp <= len(line); x++ {
+		pixel := line[x*bpp : (x+1)*bpp]
+		switch {
+		case w.mono:
+			v := uint8(0xff)
+			if dark(h.ColorSpace, pixel, step) {
+				v = 0
+			}
+			w.gray.SetGray(x, w.y, color.Gray{Y: v})
+		case h.ColorSpace == Gray:
+			w.gray.SetGray(x, w.y, color.Gray{Y: pixel[0]})
+		case h.ColorSpace == CMYK:
+			c, m, y, k := pixel[0], pixel[step], pixel[2*step], pixel[3*step]
+			w.rgba.SetRGBA(x, w.y, color.RGBA{
+				R: 0xff - uint8(min(int(c)+int(k), 0xff)),
+				G: 0xff - uint8(min(int(m)+int(k), 0xff)),
+				B: 0xff - uint8(min(int(y)+int(k), 0xff)),
+				A: 0xff,
+			})
+		default:
+			w.rgba.SetRGBA(x, w.y, color.RGBA{R: pixel[0], G: pixel[step], B: pixel[2*step], A: 0xff})
+		}
+	}
+	w.y++
+	return nil
+}
+
+// Close does nothing, the image is complete
+func (w *imageWriter) Close() error {
+	return nil
+}
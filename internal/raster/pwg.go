@@ -0,0 +1,155 @@
+package raster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// PWG raster constants (PWG 5102.4)
+const (
+	pwgSyncWord   = "RaS2"
+	pwgHeaderSize = 1796
+
+	pwgColorSpaceSGray    = 18
+	pwgColorSpaceSRGB     = 19
+	pwgColorSpaceAdobeRGB = 20
+	pwgColorSpaceCMYK     = 6
+)
+
+// PWGWriter encodes pages as PWG raster (image/pwg-raster)
+type PWGWriter struct {
+	w     *bufio.Writer
+	pages int // TotalPageCount, 0 if unknown
+
+	header PageHeader
+	prev   []byte // Line waiting to be written
+	repeat int    // Additional copies of prev
+	buf    []byte
+}
+
+// NewPWGWriter writes the PWG sync word. pages is recorded in each page
+// header as the total page count; pass 0 if it isn't known.
+func NewPWGWriter(w io.Writer, pages int) (*PWGWriter, error) {
+	p := &PWGWriter{w: bufio.NewWriter(w), pages: pages}
+	if _, err := p.w.WriteString(pwgSyncWord); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// BeginPage finishes the current page and writes the header of the next
+func (p *PWGWriter) BeginPage(h PageHeader) error {
+	if err := p.flushLine(); err != nil {
+		return err
+	}
+	p.header = h
+	_, err := p.w.Write(p.pageHeader(h))
+	return err
+}
+
+// WriteLine adds one uncompressed line to the current page. Identical
+// consecutive lines are stored once with a repeat count.
+func (p *PWGWriter) WriteLine(line []byte) error {
+	if p.prev != nil && p.repeat < 255 && bytes.Equal(line, p.prev) {
+		p.repeat++
+		return nil
+	}
+	if err := p.flushLine(); err != nil {
+		return err
+	}
+	p.prev = append(p.prev[:0], line...)
+	return nil
+}
+
+// Close writes any pending data
+func (p *PWGWriter) Close() error {
+	if err := p.flushLine(); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+func (p *PWGWriter) flushLine() error {
+	if p.prev == nil {
+		return nil
+	}
+
+	p.buf = append(p.buf[:0], byte(p.repeat))
+	p.buf = encodeLine(p.buf, p.prev, p.header.BytesPerPixel())
+	p.prev = nil
+	p.repeat = 0
+
+	_, err := p.w.Write(p.buf)
+	return err
+}
+
+// pageHeader builds the 1796-byte PWG page header
+func (p *PWGWriter) pageHeader(h PageHeader) []byte {
+	buf := make([]byte, pwgHeaderSize)
+	put := func(offset int, v uint32) {
+		binary.BigEndian.PutUint32(buf[offset:], v)
+	}
+	boolean := func(b bool) uint32 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	// The four 64-byte media strings (MediaClass..OutputType) are left empty
+	const (
+		offDuplex       = 272
+		offHWResolution = 276
+		offNumCopies    = 340
+		offPageSize     = 352
+		offTumble       = 368
+		offWidth        = 372
+		offHeight       = 376
+		offBitsPerColor = 384
+		offBitsPerPixel = 388
+		offBytesPerLine = 392
+		offColorSpace   = 400
+		offNumColors    = 420
+		offInteger      = 452
+	)
+
+	put(offDuplex, boolean(h.Duplex))
+	put(offHWResolution, uint32(h.DPI))
+	put(offHWResolution+4, uint32(h.DPI))
+	put(offNumCopies, 1)
+	put(offPageSize, uint32(h.Width*72/h.DPI))
+	put(offPageSize+4, uint32(h.Height*72/h.DPI))
+	put(offTumble, boolean(h.Tumble))
+	put(offWidth, uint32(h.Width))
+	put(offHeight, uint32(h.Height))
+	put(offBitsPerColor, uint32(h.BitsPerColor))
+	put(offBitsPerPixel, uint32(h.BitsPerColor*h.Colors()))
+	put(offBytesPerLine, uint32(h.BytesPerLine()))
+	put(offColorSpace, pwgColorSpace(h.ColorSpace))
+	put(offNumColors, uint32(h.Colors()))
+
+	// cupsInteger: TotalPageCount, CrossFeedTransform, FeedTransform,
+	// ImageBox (4), AlternatePrimary, PrintQuality
+	put(offInteger, uint32(p.pages))
+	put(offInteger+4, 1)
+	put(offInteger+8, 1)
+	put(offInteger+28, 0x00ffffff)
+	put(offInteger+32, uint32(h.Quality))
+
+	return buf
+}
+
+func pwgColorSpace(cs ColorSpace) uint32 {
+	switch cs {
+	case Gray:
+		return pwgColorSpaceSGray
+	case AdobeRGB:
+		return pwgColorSpaceAdobeRGB
+	case CMYK:
+		return pwgColorSpaceCMYK
+	default:
+		return pwgColorSpaceSRGB
+	}
+}
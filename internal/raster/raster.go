@@ -0,0 +1,245 @@
+package raster
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Document formats handled by the converter
+const (
+	FormatURF = "image/urf"
+	FormatPWG = "image/pwg-raster"
+	FormatPDF = "application/pdf"
+)
+
+// ColorSpace of decoded raster pixels
+type ColorSpace int
+
+// Supported color spaces. Gray and RGB components are additive (0 is black),
+// CMYK components are ink amounts (0 is no ink).
+const (
+	Gray ColorSpace = iota
+	RGB
+	AdobeRGB
+	CMYK
+)
+
+// PageHeader describes one raster page
+type PageHeader struct {
+	Width        int // Pixels per line
+	Height       int // Lines
+	DPI          int
+	BitsPerColor int
+	ColorSpace   ColorSpace
+	Duplex       bool
+	Tumble       bool // Short-edge duplex
+	Quality      int  // IPP print-quality: 3 draft, 4 normal, 5 high; 0 if unknown
+}
+
+// Colors returns the number of color components per pixel
+func (h PageHeader) Colors() int {
+	switch h.ColorSpace {
+	case Gray:
+		return 1
+	case CMYK:
+		return 4
+	default:
+		return 3
+	}
+}
+
+// BytesPerPixel returns the size of one pixel
+func (h PageHeader) BytesPerPixel() int {
+	return h.Colors() * h.BitsPerColor / 8
+}
+
+// BytesPerLine returns the size of one uncompressed line
+func (h PageHeader) BytesPerLine() int {
+	return h.Width * h.BytesPerPixel()
+}
+
+// whiteByte returns the byte value of a blank pixel component
+func (h PageHeader) whiteByte() byte {
+	if h.ColorSpace == CMYK {
+		return 0x00
+	}
+	return 0xff
+}
+
+// pageWriter is implemented by the output formats
+type pageWriter interface {
+	BeginPage(h PageHeader) error
+	WriteLine(line []byte) error
+	Close() error
+}
+
+// IsURF reports whether r starts with an Apple Raster file header, without
+// consuming any input
+func IsURF(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(urfMagic))
+	return err == nil && bytes.Equal(magic, []byte(urfMagic))
+}
+
+// ConvertURF decodes an Apple Raster document from src and writes it to dst
+// as format (FormatPDF or FormatPWG). Pages are converted line by line, so
+// memory use doesn't grow with the size of the document.
+func ConvertURF(dst io.Writer, src io.Reader, format string) error {
+	return ConvertURFStamped(dst, src, format, nil)
+}
+
+// ConvertURFStamped is ConvertURF with stamp drawn on every page. format may
+// also be FormatURF to stamp a document without converting it.
+func ConvertURFStamped(dst io.Writer, src io.Reader, format string, stamp *Stamp) error {
+	urf, err := NewURFReader(src)
+	if err != nil {
+		return err
+	}
+
+	var out pageWriter
+	switch format {
+	case FormatURF:
+		if out, err = NewURFWriter(dst, urf.Pages); err != nil {
+			return err
+		}
+	case FormatPDF:
+		out = NewPDFWriter(dst)
+	case FormatPWG:
+		if out, err = NewPWGWriter(dst, urf.Pages); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+
+	return convert(urf, out, stamp)
+}
+
+// ConvertURFToZPL decodes an Apple Raster document from src and writes each
+// page to dst as a ZPL label, printed copies times, with stamp drawn on it
+// if not nil
+func ConvertURFToZPL(dst io.Writer, src io.Reader, copies int, stamp *Stamp) error {
+	urf, err := NewURFReader(src)
+	if err != nil {
+		return err
+	}
+	return convert(urf, NewZPLWriter(dst, copies), stamp)
+}
+
+// convert copies every page of urf to out line by line
+func convert(urf *URFReader, out pageWriter, stamp *Stamp) error {
+	pages := 0
+	for {
+		h, err := urf.NextPage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := out.BeginPage(h); err != nil {
+			return err
+		}
+		if stamp != nil {
+			stamp.beginPage(h)
+		}
+		for y := 0; y < h.Height; y++ {
+			line, err := urf.ReadLine()
+			if err != nil {
+				return fmt.Errorf("page %d line %d: %w", pages+1, y, err)
+			}
+			if stamp != nil {
+				line = stamp.apply(y, line)
+			}
+			if err := out.WriteLine(line); err != nil {
+				return err
+			}
+		}
+		pages++
+	}
+
+	if pages == 0 {
+		return fmt.Errorf("document has no pages")
+	}
+	return out.Close()
+}
+
+// decodeLine reads one compressed line into line. Each run starts with a
+// count byte: 0-127 repeats the next pixel count+1 times, 129-255 is followed
+// by 257-count literal pixels, and 128 blanks the rest of the line.
+func decodeLine(r *bufio.Reader, line []byte, bpp int, white byte) error {
+	for pos := 0; pos < len(line); {
+		n, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case n == 128:
+			for i := pos; i < len(line); i++ {
+				line[i] = white
+			}
+			pos = len(line)
+
+		case n > 128:
+			count := (257 - int(n)) * bpp
+			if count > len(line)-pos {
+				count = len(line) - pos
+			}
+			if _, err := io.ReadFull(r, line[pos:pos+count]); err != nil {
+				return err
+			}
+			pos += count
+
+		default:
+			if _, err := io.ReadFull(r, line[pos:pos+bpp]); err != nil {
+				return err
+			}
+			end := pos + (int(n)+1)*bpp
+			if end > len(line) {
+				end = len(line)
+			}
+			for i := pos + bpp; i < end; i += bpp {
+				copy(line[i:i+bpp], line[pos:pos+bpp])
+			}
+			pos = end
+		}
+	}
+	return nil
+}
+
+// encodeLine appends the compressed form of line to buf, using the same
+// scheme decodeLine reads. The blank-line code (128) is never produced.
+func encodeLine(buf, line []byte, bpp int) []byte {
+	pixels := len(line) / bpp
+	pixel := func(i int) []byte { return line[i*bpp : (i+1)*bpp] }
+
+	for i := 0; i < pixels; {
+		run := 1
+		for i+run < pixels && run < 128 && bytes.Equal(pixel(i), pixel(i+run)) {
+			run++
+		}
+		if run > 1 {
+			buf = append(buf, byte(run-1))
+			buf = append(buf, pixel(i)...)
+			i += run
+			continue
+		}
+
+		// Literal pixels up to the start of the next run
+		start := i
+		i++
+		for i < pixels && i-start < 128 && !(i+1 < pixels && bytes.Equal(pixel(i), pixel(i+1))) {
+			i++
+		}
+		if count := i - start; count == 1 {
+			buf = append(buf, 0)
+		} else {
+			buf = append(buf, byte(257-count))
+		}
+		buf = append(buf, line[start*bpp:i*bpp]...)
+	}
+	return buf
+}
@@ -0,0 +1,501 @@
+package raster
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testPage is a small RGB page with runs, literals and repeated lines
+func testPage(width, height int) [][]byte {
+	lines := make([][]byte, height)
+	for y := range lines {
+		line := make([]byte, width*3)
+		for x := 0; x < width; x++ {
+			v := byte(255)
+			if y >= height/2 && x%3 == 0 {
+				v = byte(x + y)
+			}
+			line[x*3], line[x*3+1], line[x*3+2] = v, v/2, 255-v
+		}
+		lines[y] = line
+	}
+	return lines
+}
+
+// buildURF encodes pages of 8-bit sRGB lines as an Apple Raster document
+func buildURF(pages [][][]byte, width, dpi int) []byte {
+	var b bytes.Buffer
+	b.WriteString(urfMagic)
+	_ = binary.Write(&b, binary.BigEndian, uint32(len(pages)))
+
+	for _, lines := range pages {
+		var h [urfHeaderSize]byte
+		h[0] = 24
+		h[1] = urfSRGB
+		h[2] = 1
+		h[3] = 4
+		binary.BigEndian.PutUint32(h[12:], uint32(width))
+		binary.BigEndian.PutUint32(h[16:], uint32(len(lines)))
+		binary.BigEndian.PutUint32(h[20:], uint32(dpi))
+		b.Write(h[:])
+
+		for y := 0; y < len(lines); {
+			repeat := 0
+			for y+repeat+1 < len(lines) && repeat < 255 && bytes.Equal(lines[y], lines[y+repeat+1]) {
+				repeat++
+			}
+			b.WriteByte(byte(repeat))
+			b.Write(encodeLine(nil, lines[y], 3))
+			y += repeat + 1
+		}
+	}
+	return b.Bytes()
+}
+
+func TestEncodeDecodeLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line []byte
+	}{
+		{"single pixel", []byte{1}},
+		{"all same", bytes.Repeat([]byte{7}, 300)},
+		{"all different", []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"mixed", []byte{1, 1, 1, 2, 3, 4, 4, 5, 6, 6, 6, 6}},
+		{"long literal", func() []byte {
+			b := make([]byte, 400)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			return b
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeLine(nil, tt.line, 1)
+			decoded := make([]byte, len(tt.line))
+			if err := decodeLine(bufio.NewReader(bytes.NewReader(encoded)), decoded, 1, 0xff); err != nil {
+				t.Fatalf("decodeLine() error = %v", err)
+			}
+			if !bytes.Equal(decoded, tt.line) {
+				t.Errorf("round trip = %v, want %v", decoded, tt.line)
+			}
+		})
+	}
+}
+
+func TestDecodeLine_BlankRest(t *testing.T) {
+	// One literal pixel, then fill the rest with white
+	data := []byte{0x00, 0x10, 0x80}
+	line := make([]byte, 4)
+	if err := decodeLine(bufio.NewReader(bytes.NewReader(data)), line, 1, 0xff); err != nil {
+		t.Fatalf("decodeLine() error = %v", err)
+	}
+	if want := []byte{0x10, 0xff, 0xff, 0xff}; !bytes.Equal(line, want) {
+		t.Errorf("line = %v, want %v", line, want)
+	}
+}
+
+func TestURFReader(t *testing.T) {
+	page := testPage(10, 6)
+	urf, err := NewURFReader(bytes.NewReader(buildURF([][][]byte{page, page}, 10, 300)))
+	if err != nil {
+		t.Fatalf("NewURFReader() error = %v", err)
+	}
+	if urf.Pages != 2 {
+		t.Errorf("Pages = %d, want 2", urf.Pages)
+	}
+
+	for p := 0; p < 2; p++ {
+		h, err := urf.NextPage()
+		if err != nil {
+			t.Fatalf("NextPage() error = %v", err)
+		}
+		if h.Width != 10 || h.Height != 6 || h.DPI != 300 || h.ColorSpace != RGB || h.BitsPerColor != 8 {
+			t.Fatalf("header = %+v", h)
+		}
+		for y := 0; y < h.Height; y++ {
+			line, err := urf.ReadLine()
+			if err != nil {
+				t.Fatalf("ReadLine() error = %v", err)
+			}
+			if !bytes.Equal(line, page[y]) {
+				t.Errorf("page %d line %d = %v, want %v", p, y, line, page[y])
+			}
+		}
+	}
+
+	if _, err := urf.NextPage(); err != io.EOF {
+		t.Errorf("NextPage() after last page error = %v, want io.EOF", err)
+	}
+}
+
+func TestConvertURF_PWG(t *testing.T) {
+	page := testPage(10, 6)
+	var out bytes.Buffer
+	if err := ConvertURF(&out, bytes.NewReader(buildURF([][][]byte{page}, 10, 300)), FormatPWG); err != nil {
+		t.Fatalf("ConvertURF() error = %v", err)
+	}
+
+	data := out.Bytes()
+	if string(data[:4]) != pwgSyncWord {
+		t.Fatalf("sync word = %q", data[:4])
+	}
+	header := data[4 : 4+pwgHeaderSize]
+	field := func(offset int) uint32 { return binary.BigEndian.Uint32(header[offset:]) }
+
+	checks := []struct {
+		name   string
+		offset int
+		want   uint32
+	}{
+		{"HWResolution", 276, 300},
+		{"cupsWidth", 372, 10},
+		{"cupsHeight", 376, 6},
+		{"cupsBitsPerColor", 384, 8},
+		{"cupsBitsPerPixel", 388, 24},
+		{"cupsBytesPerLine", 392, 30},
+		{"cupsColorSpace", 400, pwgColorSpaceSRGB},
+		{"cupsNumColors", 420, 3},
+		{"TotalPageCount", 452, 1},
+	}
+	for _, c := range checks {
+		if got := field(c.offset); got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, got, c.want)
+		}
+	}
+
+	// PWG uses the same line compression as URF
+	r := bufio.NewReader(bytes.NewReader(data[4+pwgHeaderSize:]))
+	for y := 0; y < len(page); {
+		repeat, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("line %d: %v", y, err)
+		}
+		line := make([]byte, 30)
+		if err := decodeLine(r, line, 3, 0xff); err != nil {
+			t.Fatalf("line %d: %v", y, err)
+		}
+		for i := 0; i <= int(repeat); i++ {
+			if !bytes.Equal(line, page[y]) {
+				t.Errorf("line %d = %v, want %v", y, line, page[y])
+			}
+			y++
+		}
+	}
+}
+
+func TestConvertURF_PDF(t *testing.T) {
+	page := testPage(10, 6)
+	var out bytes.Buffer
+	if err := ConvertURF(&out, bytes.NewReader(buildURF([][][]byte{page, page}, 10, 72)), FormatPDF); err != nil {
+		t.Fatalf("ConvertURF() error = %v", err)
+	}
+	pdf := out.String()
+
+	if !strings.HasPrefix(pdf, "%PDF-1.4") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatalf("not a PDF: %q...", pdf[:20])
+	}
+	if !strings.Contains(pdf, "/Type /Pages /Count 2") {
+		t.Error("page tree does not list 2 pages")
+	}
+	if !strings.Contains(pdf, "/MediaBox [0 0 10.00 6.00]") {
+		t.Error("missing expected MediaBox")
+	}
+
+	// Every xref entry must point at its object
+	xrefAt := strings.LastIndex(pdf, "xref\n")
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(pdf[xrefAt:], -1)
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(e[1])
+		if want := fmt.Sprintf("%d 0 obj", i+1); !strings.HasPrefix(pdf[offset:], want) {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[offset:offset+10])
+		}
+	}
+
+	// The first image stream decompresses to the page pixels
+	start := strings.Index(pdf, "stream\n") + len("stream\n")
+	zr, err := zlib.NewReader(strings.NewReader(pdf[start:]))
+	if err != nil {
+		t.Fatalf("zlib.NewReader() error = %v", err)
+	}
+	pixels, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress image: %v", err)
+	}
+	if want := bytes.Join(page, nil); !bytes.Equal(pixels, want) {
+		t.Error("image data does not match page")
+	}
+}
+
+func TestConvertURF_Invalid(t *testing.T) {
+	if err := ConvertURF(io.Discard, strings.NewReader("%PDF-1.4"), FormatPDF); err == nil {
+		t.Error("expected error for non-URF input")
+	}
+	if err := ConvertURF(io.Discard, bytes.NewReader(buildURF(nil, 10, 300)), FormatPDF); err == nil {
+		t.Error("expected error for document without pages")
+	}
+}
+
+func TestConvertURF_URFRoundTrip(t *testing.T) {
+	page := testPage(10, 6)
+	var out bytes.Buffer
+	if err := ConvertURF(&out, bytes.NewReader(buildURF([][][]byte{page}, 10, 300)), FormatURF); err != nil {
+		t.Fatalf("ConvertURF() error = %v", err)
+	}
+
+	urf, err := NewURFReader(&out)
+	if err != nil {
+		t.Fatalf("NewURFReader() error = %v", err)
+	}
+	h, err := urf.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage() error = %v", err)
+	}
+	if h.Width != 10 || h.Height != 6 || h.DPI != 300 || h.ColorSpace != RGB {
+		t.Fatalf("header = %+v", h)
+	}
+	for y := range page {
+		line, err := urf.ReadLine()
+		if err != nil {
+			t.Fatalf("ReadLine() error = %v", err)
+		}
+		if !bytes.Equal(line, page[y]) {
+			t.Errorf("line %d = %v, want %v", y, line, page[y])
+		}
+	}
+}
+
+func TestStamp(t *testing.T) {
+	// A blank 1x1 inch page at 72 dpi
+	const size = 72
+	blank := bytes.Repeat([]byte{0xff}, size*3)
+	page := make([][]byte, size)
+	for y := range page {
+		page[y] = blank
+	}
+
+	var out bytes.Buffer
+	src := bytes.NewReader(buildURF([][][]byte{page}, size, size))
+	if err := ConvertURFStamped(&out, src, FormatURF, NewStamp("I")); err != nil {
+		t.Fatalf("ConvertURFStamped() error = %v", err)
+	}
+
+	urf, err := NewURFReader(&out)
+	if err != nil {
+		t.Fatalf("NewURFReader() error = %v", err)
+	}
+	if _, err := urf.NextPage(); err != nil {
+		t.Fatalf("NextPage() error = %v", err)
+	}
+
+	// "I" is a vertical bar in glyph column 2 between rows 0 and 6, drawn
+	// centered and a third of an inch above the bottom edge
+	top := size - size/3 - glyphHeight
+	x := (size-cellWidth)/2 + 2
+	for y := 0; y < size; y++ {
+		line, err := urf.ReadLine()
+		if err != nil {
+			t.Fatalf("ReadLine() error = %v", err)
+		}
+		inked := 0
+		for i := 0; i < len(line); i += 3 {
+			if line[i] == 0 {
+				inked++
+			}
+		}
+		wantInk := y >= top && y <= top+6
+		if wantInk && (inked == 0 || line[x*3] != 0) {
+			t.Errorf("line %d: expected ink at x=%d", y, x)
+		}
+		if !wantInk && inked != 0 {
+			t.Errorf("line %d: unexpected ink on %d pixels", y, inked)
+		}
+	}
+}
+
+func TestWriteTestPage(t *testing.T) {
+	// 2 inches square at 72 dpi: a 2 pixel border 18 pixels in, text at
+	// scale 3 from pixel 29, and the gray strip from line 74
+	page := TestPage{Width: 144, Height: 144, DPI: 72, Lines: []string{"I"}}
+	var out bytes.Buffer
+	if err := WriteTestPage(&out, FormatURF, page); err != nil {
+		t.Fatalf("WriteTestPage() error = %v", err)
+	}
+
+	urf, err := NewURFReader(&out)
+	if err != nil {
+		t.Fatalf("NewURFReader() error = %v", err)
+	}
+	h, err := urf.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage() error = %v", err)
+	}
+	if h.Width != 144 || h.Height != 144 || h.DPI != 72 || h.ColorSpace != Gray {
+		t.Fatalf("page header = %+v, want 144x144 gray at 72 dpi", h)
+	}
+	lines := make([][]byte, h.Height)
+	for y := range lines {
+		line, err := urf.ReadLine()
+		if err != nil {
+			t.Fatalf("ReadLine() error = %v", err)
+		}
+		lines[y] = append([]byte(nil), line...)
+	}
+
+	tests := []struct {
+		name string
+		x, y int
+		want byte
+	}{
+		{"outside border", 5, 5, 0xff},
+		{"border corner", 18, 18, 0},
+		{"border right", 144 - 19, 40, 0},
+		{"border bottom", 40, 144 - 19, 0},
+		{"inside border", 20, 40, 0xff},
+		{"text", 29 + 2*3, 29, 0},
+		{"beside text", 29, 29, 0xff},
+		{"darkest gray", 29, 80, 0},
+		{"lightest gray", 144 - 30, 80, 224},
+		{"below gray", 29, 100, 0xff},
+	}
+	for _, tt := range tests {
+		if got := lines[tt.y][tt.x]; got != tt.want {
+			t.Errorf("%s: pixel (%d, %d) = %#x, want %#x", tt.name, tt.x, tt.y, got, tt.want)
+		}
+	}
+
+	out.Reset()
+	if err := WriteTestPage(&out, FormatPDF, page); err != nil {
+		t.Fatalf("WriteTestPage(PDF) error = %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "%PDF-") {
+		t.Error("PDF test page is not a PDF")
+	}
+
+	if err := WriteTestPage(io.Discard, FormatPWG, page); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+	if err := WriteTestPage(io.Discard, FormatURF, TestPage{DPI: 300}); err == nil {
+		t.Error("expected error for empty page")
+	}
+}
+
+func TestConvertURFToZPL(t *testing.T) {
+	// 10 pixels wide: a black left half, then two identical white lines,
+	// then a line black only at the last pixel
+	black, white := []byte{0, 0, 0}, []byte{255, 255, 255}
+	line := func(dark func(x int) bool) []byte {
+		var l []byte
+		for x := 0; x < 10; x++ {
+			if dark(x) {
+				l = append(l, black...)
+			} else {
+				l = append(l, white...)
+			}
+		}
+		return l
+	}
+	page := [][]byte{
+		line(func(x int) bool { return x < 5 }),
+		line(func(int) bool { return false }),
+		line(func(int) bool { return false }),
+		line(func(x int) bool { return x == 9 }),
+	}
+	doc := buildURF([][][]byte{page}, 10, 203)
+
+	var out bytes.Buffer
+	if err := ConvertURFToZPL(&out, bytes.NewReader(doc), 2, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := "^XA\n^PW10\n^LL4\n^FO0,0^GFA,8,8,2,\n" +
+		"F8,\n" + // Black left half, white rest cut short
+		",\n" + // All white
+		":\n" + // Same as the line before
+		"0040\n" +
+		"^FS\n^PQ2\n^XZ\n"
+	if out.String() != want {
+		t.Errorf("ConvertURFToZPL() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestRenderURFPage(t *testing.T) {
+	doc := buildURF([][][]byte{testPage(8, 4), testPage(8, 6)}, 8, 300)
+
+	img, pages, err := RenderURFPage(bytes.NewReader(doc), Preview{Page: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 || img.Bounds().Dx() != 8 || img.Bounds().Dy() != 6 {
+		t.Errorf("RenderURFPage() = %v, %d pages; want 8x6 of 2 pages", img.Bounds(), pages)
+	}
+	// Pixel (3, 3) of the test page is (6, 3, 249)
+	if r, g, b, _ := img.At(3, 3).RGBA(); r>>8 != 6 || g>>8 != 3 || b>>8 != 249 {
+		t.Errorf("pixel (3, 3) = %d %d %d, want 6 3 249", r>>8, g>>8, b>>8)
+	}
+
+	mono, _, err := RenderURFPage(bytes.NewReader(doc), Preview{Page: 2, Mono: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if y, _, _, _ := mono.At(3, 3).RGBA(); y != 0 {
+		t.Errorf("mono pixel (3, 3) = %d, want black", y)
+	}
+	if y, _, _, _ := mono.At(1, 0).RGBA(); y != 0xffff {
+		t.Errorf("mono pixel (1, 0) = %d, want white", y)
+	}
+
+	if _, _, err := RenderURFPage(bytes.NewReader(doc), Preview{Page: 3}); err == nil {
+		t.Error("RenderURFPage() of page 3 of 2 succeeded")
+	}
+}
+
+func TestImageScale(t *testing.T) {
+	tests := []struct {
+		w, h    int
+		scaling string
+		want    float64
+	}{
+		{100, 50, ScaleFit, 2},
+		{100, 50, ScaleFill, 4},
+		{100, 50, ScaleNone, 1},
+		{400, 400, ScaleAutoFit, 0.5},
+		{50, 50, ScaleAutoFit, 1},
+		{190, 210, ScaleAuto, 200.0 / 190}, // Near the page size: fill
+		{400, 400, ScaleAuto, 0.5},
+		{50, 50, ScaleAuto, 1},
+	}
+	for _, tt := range tests {
+		if got := imageScale(tt.w, tt.h, 200, 200, tt.scaling); got != tt.want {
+			t.Errorf("imageScale(%d, %d, %s) = %v, want %v", tt.w, tt.h, tt.scaling, got, tt.want)
+		}
+	}
+}
+
+func TestRenderImage(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 10, 10)) // Black square
+	h := PageHeader{Width: 40, Height: 20, DPI: 72, ColorSpace: Gray}
+
+	img, err := RenderImage(src, h, ScaleFit, Preview{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Scaled to 20x20 in the middle of the page
+	for _, p := range []struct {
+		x, y  int
+		black bool
+	}{{9, 10, false}, {10, 10, true}, {29, 19, true}, {30, 10, false}} {
+		if y, _, _, _ := img.At(p.x, p.y).RGBA(); (y == 0) != p.black {
+			t.Errorf("pixel (%d, %d) = %d, want black %v", p.x, p.y, y, p.black)
+		}
+	}
+}
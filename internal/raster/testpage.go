@@ -0,0 +1,151 @@
+package raster
+
+import (
+	"fmt"
+	"io"
+)
+
+// TestPage is a page for checking a printer end to end: a border a quarter
+// inch in from the edges, lines of text, and a strip of gray steps that shows
+// whether the printer renders shades or dithers them
+type TestPage struct {
+	Width  int // Pixels
+	Height int
+	DPI    int
+	Lines  []string
+}
+
+// grayLevels is the number of steps in the gray strip, black to near white
+const grayLevels = 8
+
+// WriteTestPage renders page in 8-bit gray and writes it to dst as
+// FormatURF or FormatPDF
+func WriteTestPage(dst io.Writer, format string, page TestPage) error {
+	if page.DPI <= 0 || page.Width <= 0 || page.Height <= 0 ||
+		page.Width > maxPageDimension || page.Height > maxPageDimension {
+		return fmt.Errorf("invalid test page size %dx%d at %d dpi", page.Width, page.Height, page.DPI)
+	}
+
+	var out pageWriter
+	switch format {
+	case FormatURF:
+		urf, err := NewURFWriter(dst, 1)
+		if err != nil {
+			return err
+		}
+		out = urf
+	case FormatPDF:
+		out = NewPDFWriter(dst)
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+
+	h := PageHeader{
+		Width:        page.Width,
+		Height:       page.Height,
+		DPI:          page.DPI,
+		BitsPerColor: 8,
+		ColorSpace:   Gray,
+	}
+	if err := out.BeginPage(h); err != nil {
+		return err
+	}
+	l := page.layout()
+	line := make([]byte, page.Width)
+	for y := 0; y < page.Height; y++ {
+		l.draw(y, line)
+		if err := out.WriteLine(line); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// testPageLayout is where a test page's parts go, in pixels
+type testPageLayout struct {
+	width, height int
+	margin        int // Page edge to border
+	border        int // Border thickness
+	left          int // Text and gray strip
+	text          [][]byte
+	scale         int // Pixels per font pixel
+	textTop       int
+	lineHeight    int
+	grayTop       int
+	grayHeight    int
+}
+
+// layout fits the parts to the page: text as large as a third of an inch
+// tall, scaled down until the longest line fits inside the border
+func (p TestPage) layout() testPageLayout {
+	l := testPageLayout{
+		width:  p.Width,
+		height: p.Height,
+		margin: p.DPI / 4,
+		border: max(p.DPI/36, 1),
+	}
+	l.left = l.margin + l.border + p.DPI/8
+
+	longest := 0
+	for _, text := range p.Lines {
+		b := printable(text)
+		l.text = append(l.text, b)
+		longest = max(longest, len(b))
+	}
+	l.scale = max(p.DPI/24, 1)
+	inner := p.Width - 2*l.left
+	for l.scale > 1 && longest*cellWidth*l.scale > inner {
+		l.scale--
+	}
+
+	l.textTop = l.left
+	l.lineHeight = (glyphHeight + 4) * l.scale
+	l.grayTop = l.textTop + len(l.text)*l.lineHeight + p.DPI/8
+	l.grayHeight = p.DPI / 3
+	return l
+}
+
+// draw renders line y of the page into line
+func (l testPageLayout) draw(y int, line []byte) {
+	for i := range line {
+		line[i] = 0xff
+	}
+	black := []byte{0}
+
+	// Border
+	top, bottom := l.margin, l.height-l.margin
+	if y >= top && y < bottom && l.margin < l.width-l.margin {
+		right := l.width - l.margin
+		if y < top+l.border || y >= bottom-l.border {
+			fill(line[l.margin:right], 0)
+		} else {
+			fill(line[l.margin:min(l.margin+l.border, right)], 0)
+			fill(line[max(right-l.border, l.margin):right], 0)
+		}
+	}
+
+	// Text
+	if y >= l.textTop {
+		i, offset := (y-l.textTop)/l.lineHeight, (y-l.textTop)%l.lineHeight
+		if row := offset / l.scale; i < len(l.text) && row < glyphHeight {
+			drawText(line, l.text[i], row, l.left, l.scale, black)
+		}
+	}
+
+	// Gray steps
+	width := l.width - 2*l.left
+	if y >= l.grayTop && y < l.grayTop+l.grayHeight && width >= grayLevels {
+		for step := 0; step < grayLevels; step++ {
+			from := l.left + step*width/grayLevels
+			to := l.left + (step+1)*width/grayLevels
+			fill(line[from:to], byte(step*256/grayLevels))
+		}
+	}
+}
+
+// fill sets every byte of b to v
+func fill(b []byte, v byte) {
+	for i := range b {
+		b[i] = v
+	}
+}
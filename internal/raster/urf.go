@@ -0,0 +1,258 @@
+package raster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// urfMagic starts every Apple Raster file
+const urfMagic = "UNIRAST\x00"
+
+// Apple Raster page header values
+const (
+	urfHeaderSize = 32
+
+	urfSGray    = 0
+	urfSRGB     = 1
+	urfCIELab   = 2
+	urfAdobeRGB = 3
+	urfW        = 4
+	urfRGB      = 5
+	urfCMYK     = 6
+
+	urfDuplexShortEdge = 2
+)
+
+// maxPageDimension bounds page sizes read from untrusted headers
+const maxPageDimension = 1 << 17
+
+// URFReader decodes Apple Raster (image/urf) documents
+type URFReader struct {
+	r *bufio.Reader
+
+	Pages int // Page count from the file header
+
+	pagesRead int
+	header    PageHeader
+	linesLeft int
+	repeat    int // Times the current line is still to be returned
+	line      []byte
+}
+
+// NewURFReader reads the Apple Raster file header from r
+func NewURFReader(r io.Reader) (*URFReader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	var fileHeader [12]byte
+	if _, err := io.ReadFull(br, fileHeader[:]); err != nil {
+		return nil, fmt.Errorf("failed to read URF header: %w", err)
+	}
+	if string(fileHeader[:8]) != urfMagic {
+		return nil, fmt.Errorf("not an Apple Raster document")
+	}
+
+	return &URFReader{
+		r:     br,
+		Pages: int(binary.BigEndian.Uint32(fileHeader[8:12])),
+	}, nil
+}
+
+// NextPage reads the next page header, skipping any unread lines of the
+// current page. It returns io.EOF after the last page.
+func (u *URFReader) NextPage() (PageHeader, error) {
+	for u.linesLeft > 0 {
+		if _, err := u.ReadLine(); err != nil {
+			return PageHeader{}, err
+		}
+	}
+	if u.Pages > 0 && u.pagesRead == u.Pages {
+		return PageHeader{}, io.EOF
+	}
+
+	var raw [urfHeaderSize]byte
+	if _, err := io.ReadFull(u.r, raw[:]); err != nil {
+		if err == io.EOF {
+			return PageHeader{}, io.EOF
+		}
+		return PageHeader{}, fmt.Errorf("failed to read page header: %w", err)
+	}
+
+	h, err := parseURFHeader(raw)
+	if err != nil {
+		return PageHeader{}, fmt.Errorf("page %d: %w", u.pagesRead+1, err)
+	}
+
+	u.pagesRead++
+	u.header = h
+	u.linesLeft = h.Height
+	u.repeat = 0
+	u.line = make([]byte, h.BytesPerLine())
+	return h, nil
+}
+
+// ReadLine returns the next uncompressed line of the current page. The slice
+// is reused by the following call.
+func (u *URFReader) ReadLine() ([]byte, error) {
+	if u.linesLeft == 0 {
+		return nil, io.EOF
+	}
+
+	if u.repeat == 0 {
+		count, err := u.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read line: %w", err)
+		}
+		if err := decodeLine(u.r, u.line, u.header.BytesPerPixel(), u.header.whiteByte()); err != nil {
+			return nil, fmt.Errorf("failed to decode line: %w", err)
+		}
+		u.repeat = int(count) + 1
+	}
+
+	u.repeat--
+	u.linesLeft--
+	return u.line, nil
+}
+
+func parseURFHeader(raw [urfHeaderSize]byte) (PageHeader, error) {
+	bpp := int(raw[0])
+	h := PageHeader{
+		Width:  int(binary.BigEndian.Uint32(raw[12:16])),
+		Height: int(binary.BigEndian.Uint32(raw[16:20])),
+		DPI:    int(binary.BigEndian.Uint32(raw[20:24])),
+		Duplex: raw[2] >= urfDuplexShortEdge,
+		Tumble: raw[2] == urfDuplexShortEdge,
+	}
+	if q := int(raw[3]); q >= 3 && q <= 5 {
+		h.Quality = q
+	}
+
+	switch raw[1] {
+	case urfSGray, urfW:
+		h.ColorSpace = Gray
+	case urfSRGB, urfRGB:
+		h.ColorSpace = RGB
+	case urfAdobeRGB:
+		h.ColorSpace = AdobeRGB
+	case urfCMYK:
+		h.ColorSpace = CMYK
+	case urfCIELab:
+		return PageHeader{}, fmt.Errorf("CIELab color is not supported")
+	default:
+		return PageHeader{}, fmt.Errorf("unknown color space %d", raw[1])
+	}
+
+	if bpp == 0 || bpp%(8*h.Colors()) != 0 {
+		return PageHeader{}, fmt.Errorf("unsupported %d bits per pixel", bpp)
+	}
+	h.BitsPerColor = bpp / h.Colors()
+	if h.BitsPerColor != 8 && h.BitsPerColor != 16 {
+		return PageHeader{}, fmt.Errorf("unsupported %d bits per color", h.BitsPerColor)
+	}
+
+	if h.Width <= 0 || h.Height <= 0 || h.Width > maxPageDimension || h.Height > maxPageDimension {
+		return PageHeader{}, fmt.Errorf("invalid page size %dx%d", h.Width, h.Height)
+	}
+	if h.DPI <= 0 {
+		return PageHeader{}, fmt.Errorf("invalid resolution %d", h.DPI)
+	}
+
+	return h, nil
+}
+
+// URFWriter encodes pages as Apple Raster (image/urf)
+type URFWriter struct {
+	w *bufio.Writer
+
+	header PageHeader
+	prev   []byte // Line waiting to be written
+	repeat int    // Additional copies of prev
+	buf    []byte
+}
+
+// NewURFWriter writes the Apple Raster file header with the page count
+func NewURFWriter(w io.Writer, pages int) (*URFWriter, error) {
+	u := &URFWriter{w: bufio.NewWriter(w)}
+	var header [12]byte
+	copy(header[:], urfMagic)
+	binary.BigEndian.PutUint32(header[8:], uint32(pages))
+	if _, err := u.w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// BeginPage finishes the current page and writes the header of the next
+func (u *URFWriter) BeginPage(h PageHeader) error {
+	if err := u.flushLine(); err != nil {
+		return err
+	}
+	u.header = h
+
+	var raw [urfHeaderSize]byte
+	raw[0] = byte(h.BitsPerColor * h.Colors())
+	switch h.ColorSpace {
+	case Gray:
+		raw[1] = urfSGray
+	case AdobeRGB:
+		raw[1] = urfAdobeRGB
+	case CMYK:
+		raw[1] = urfCMYK
+	default:
+		raw[1] = urfSRGB
+	}
+	raw[2] = 1 // simplex
+	if h.Tumble {
+		raw[2] = urfDuplexShortEdge
+	} else if h.Duplex {
+		raw[2] = urfDuplexShortEdge + 1
+	}
+	raw[3] = byte(h.Quality)
+	binary.BigEndian.PutUint32(raw[12:], uint32(h.Width))
+	binary.BigEndian.PutUint32(raw[16:], uint32(h.Height))
+	binary.BigEndian.PutUint32(raw[20:], uint32(h.DPI))
+
+	_, err := u.w.Write(raw[:])
+	return err
+}
+
+// WriteLine adds one uncompressed line to the current page. Identical
+// consecutive lines are stored once with a repeat count.
+func (u *URFWriter) WriteLine(line []byte) error {
+	if u.prev != nil && u.repeat < 255 && bytes.Equal(line, u.prev) {
+		u.repeat++
+		return nil
+	}
+	if err := u.flushLine(); err != nil {
+		return err
+	}
+	u.prev = append(u.prev[:0], line...)
+	return nil
+}
+
+// Close writes any pending data
+func (u *URFWriter) Close() error {
+	if err := u.flushLine(); err != nil {
+		return err
+	}
+	return u.w.Flush()
+}
+
+func (u *URFWriter) flushLine() error {
+	if u.prev == nil {
+		return nil
+	}
+
+	u.buf = append(u.buf[:0], byte(u.repeat))
+	u.buf = encodeLine(u.buf, u.prev, u.header.BytesPerPixel())
+	u.prev = nil
+	u.repeat = 0
+
+	_, err := u.w.Write(u.buf)
+	return err
+}
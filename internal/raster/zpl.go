@@ -0,0 +1,133 @@
+package raster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// ZPLWriter encodes pages as Zebra ZPL II labels, one label format per page
+// with the page drawn as a ^GF graphic. Label printers have no gray, so
+// pixels are thresholded to black and white.
+type ZPLWriter struct {
+	w      *bufio.Writer
+	copies int
+
+	header PageHeader
+	inPage bool
+	first  bool   // No line written yet on this page
+	row    []byte // Current line, one bit per pixel, 1 is black
+	prev   []byte
+	hex    []byte
+}
+
+// NewZPLWriter creates a writer printing each page copies times
+func NewZPLWriter(w io.Writer, copies int) *ZPLWriter {
+	if copies < 1 {
+		copies = 1
+	}
+	return &ZPLWriter{w: bufio.NewWriter(w), copies: copies}
+}
+
+// BeginPage finishes the current label and starts the graphic of the next
+func (z *ZPLWriter) BeginPage(h PageHeader) error {
+	if err := z.endPage(); err != nil {
+		return err
+	}
+	z.header = h
+	z.inPage = true
+	z.first = true
+	rowBytes := (h.Width + 7) / 8
+	z.row = make([]byte, rowBytes)
+	z.prev = make([]byte, rowBytes)
+
+	total := rowBytes * h.Height
+	_, err := fmt.Fprintf(z.w, "^XA\n^PW%d\n^LL%d\n^FO0,0^GFA,%d,%d,%d,\n", h.Width, h.Height, total, total, rowBytes)
+	return err
+}
+
+// WriteLine adds one uncompressed line to the current label. Lines use
+// ZPL's ASCII compression: a line equal to the one before is written as ":"
+// and trailing white is cut short with ",".
+func (z *ZPLWriter) WriteLine(line []byte) error {
+	z.pack(line)
+	if !z.first && bytes.Equal(z.row, z.prev) {
+		_, err := z.w.WriteString(":\n")
+		return err
+	}
+	z.first = false
+	copy(z.prev, z.row)
+
+	used := len(z.row)
+	for used > 0 && z.row[used-1] == 0 {
+		used--
+	}
+	if n := hex.EncodedLen(used); cap(z.hex) < n+2 {
+		z.hex = make([]byte, n, n+2)
+	} else {
+		z.hex = z.hex[:n]
+	}
+	hex.Encode(z.hex, z.row[:used])
+	for i, c := range z.hex {
+		if c >= 'a' {
+			z.hex[i] = c - 'a' + 'A'
+		}
+	}
+	if used < len(z.row) {
+		z.hex = append(z.hex, ',')
+	}
+	z.hex = append(z.hex, '\n')
+	_, err := z.w.Write(z.hex)
+	return err
+}
+
+// Close finishes the last label and writes any pending data
+func (z *ZPLWriter) Close() error {
+	if err := z.endPage(); err != nil {
+		return err
+	}
+	return z.w.Flush()
+}
+
+func (z *ZPLWriter) endPage() error {
+	if !z.inPage {
+		return nil
+	}
+	z.inPage = false
+	trailer := "^FS\n"
+	if z.copies > 1 {
+		trailer += fmt.Sprintf("^PQ%d\n", z.copies)
+	}
+	_, err := z.w.WriteString(trailer + "^XZ\n")
+	return err
+}
+
+// pack sets the bits of z.row for the dark pixels of line
+func (z *ZPLWriter) pack(line []byte) {
+	for i := range z.row {
+		z.row[i] = 0
+	}
+	bpp := z.header.BytesPerPixel()
+	step := z.header.BitsPerColor / 8 // Only the high byte of 16-bit values is looked at
+	for x := 0; x < z.header.Width && (x+1)*bpp <= len(line); x++ {
+		if dark(z.header.ColorSpace, line[x*bpp:(x+1)*bpp], step) {
+			z.row[x/8] |= 0x80 >> (x % 8)
+		}
+	}
+}
+
+// dark reports whether a pixel is closer to black than white
+func dark(cs ColorSpace, pixel []byte, step int) bool {
+	switch cs {
+	case Gray:
+		return pixel[0] < 128
+	case CMYK:
+		c, m, y, k := int(pixel[0]), int(pixel[step]), int(pixel[2*step]), int(pixel[3*step])
+		return k+(c*30+m*59+y*11)/100 >= 128
+	default:
+		r, g, b := int(pixel[0]), int(pixel[step]), int(pixel[2*step])
+		return (r*299+g*587+b*114)/1000 < 128
+	}
+}
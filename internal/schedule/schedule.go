@@ -0,0 +1,134 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dayNames maps lowercase day abbreviations to time.Weekday
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a recurring weekly time range. A window whose end is not after
+// its start runs past midnight into the next day.
+type Window struct {
+	days  [7]bool
+	start int // minutes since midnight
+	end   int
+}
+
+// Schedule decides when a printer is available. The printer is active when
+// it is inside any Allow window (or no Allow windows are set) and outside
+// every Deny window.
+type Schedule struct {
+	Allow []Window
+	Deny  []Window
+}
+
+// ParseWindow parses a day spec such as "mon-fri" or "sat,sun" (empty means
+// every day) and "HH:MM" start and end times
+func ParseWindow(days, start, end string) (Window, error) {
+	var w Window
+
+	if err := w.parseDays(days); err != nil {
+		return Window{}, err
+	}
+
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return Window{}, err
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return Window{}, err
+	}
+
+	return w, nil
+}
+
+func (w *Window) parseDays(spec string) error {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" || spec == "*" {
+		for i := range w.days {
+			w.days[i] = true
+		}
+		return nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+
+		first, ok := dayNames[from]
+		if !ok {
+			return fmt.Errorf("invalid day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = dayNames[to]; !ok {
+				return fmt.Errorf("invalid day %q", to)
+			}
+		}
+
+		// Ranges may wrap around the week, e.g. fri-mon
+		for d := first; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Contains reports whether t falls inside the window
+func (w Window) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+
+	// Overnight window: the evening part belongs to the start day, the
+	// morning part to the day after
+	if w.days[day] && minute >= w.start {
+		return true
+	}
+	yesterday := (day + 6) % 7
+	return w.days[yesterday] && minute < w.end
+}
+
+// Active reports whether the schedule allows the printer at time t
+func (s Schedule) Active(t time.Time) bool {
+	for _, w := range s.Deny {
+		if w.Contains(t) {
+			return false
+		}
+	}
+	if len(s.Allow) == 0 {
+		return true
+	}
+	for _, w := range s.Allow {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
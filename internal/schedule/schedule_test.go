@@ -0,0 +1,94 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a time in the week of 2024-01-01 (a Monday)
+func at(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2024, 1, 1+int(day+6)%7, hour, minute, 0, 0, time.UTC)
+}
+
+func mustWindow(t *testing.T, days, start, end string) Window {
+	t.Helper()
+	w, err := ParseWindow(days, start, end)
+	if err != nil {
+		t.Fatalf("ParseWindow(%q, %q, %q) error = %v", days, start, end, err)
+	}
+	return w
+}
+
+func TestParseWindow_Invalid(t *testing.T) {
+	tests := []struct {
+		days, start, end string
+	}{
+		{"mon-fry", "08:00", "18:00"},
+		{"mon", "8am", "18:00"},
+		{"mon", "08:00", "25:00"},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseWindow(tt.days, tt.start, tt.end); err == nil {
+			t.Errorf("ParseWindow(%q, %q, %q) expected error", tt.days, tt.start, tt.end)
+		}
+	}
+}
+
+func TestWindow_Contains(t *testing.T) {
+	tests := []struct {
+		name  string
+		days  string
+		start string
+		end   string
+		t     time.Time
+		want  bool
+	}{
+		{"weekday business hours", "mon-fri", "08:00", "18:00", at(time.Wednesday, 12, 0), true},
+		{"before start", "mon-fri", "08:00", "18:00", at(time.Wednesday, 7, 59), false},
+		{"end is exclusive", "mon-fri", "08:00", "18:00", at(time.Wednesday, 18, 0), false},
+		{"weekend excluded", "mon-fri", "08:00", "18:00", at(time.Saturday, 12, 0), false},
+		{"day list", "sat,sun", "10:00", "14:00", at(time.Sunday, 11, 0), true},
+		{"every day", "", "10:00", "14:00", at(time.Tuesday, 11, 0), true},
+		{"wrapping range", "fri-mon", "10:00", "14:00", at(time.Sunday, 11, 0), true},
+		{"wrapping range excludes", "fri-mon", "10:00", "14:00", at(time.Wednesday, 11, 0), false},
+		{"overnight evening", "fri", "22:00", "06:00", at(time.Friday, 23, 0), true},
+		{"overnight next morning", "fri", "22:00", "06:00", at(time.Saturday, 5, 0), true},
+		{"overnight wrong morning", "fri", "22:00", "06:00", at(time.Friday, 5, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := mustWindow(t, tt.days, tt.start, tt.end)
+			if got := w.Contains(tt.t); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_Active(t *testing.T) {
+	office := Schedule{Allow: []Window{mustWindow(t, "mon-fri", "08:00", "18:00")}}
+	exams := Schedule{Deny: []Window{mustWindow(t, "tue", "09:00", "12:00")}}
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		t        time.Time
+		want     bool
+	}{
+		{"empty schedule always active", Schedule{}, at(time.Sunday, 3, 0), true},
+		{"inside allow", office, at(time.Monday, 9, 0), true},
+		{"outside allow", office, at(time.Monday, 20, 0), false},
+		{"inside deny", exams, at(time.Tuesday, 10, 0), false},
+		{"outside deny", exams, at(time.Tuesday, 13, 0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Active(tt.t); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package state keeps what the bridge remembers across restarts in a state
+// directory: the UUID each printer was first advertised with, the jobs it
+// was tracking and the printers it last saw in CUPS.
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+// fileName is the state file within the state directory
+const fileName = "state.json"
+
+// data is what is written to the state file
+type data struct {
+	UUIDs     map[string]string `json:"uuids,omitempty"`    // printer -> UUID
+	Printers  []string          `json:"printers,omitempty"` // Printers seen at the last sync
+	Jobs      []jobs.Job        `json:"jobs,omitempty"`
+	NextJobID int               `json:"next_job_id,omitempty"`
+}
+
+// Store holds the bridge's state in memory and writes it to disk on Save
+type Store struct {
+	path string
+
+	mu    sync.Mutex
+	data  data
+	saved []byte // What was last read or written, to skip unchanged saves
+}
+
+// Open loads the state in dir, creating the directory if needed. A missing
+// state file is an empty state.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	s := &Store{path: filepath.Join(dir, fileName)}
+
+	raw, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if err := json.Unmarshal(raw, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %w", s.path, err)
+	}
+	s.saved = raw
+	return s, nil
+}
+
+// UUID returns the UUID printer was first given, recording newUUID() for
+// printers without one. A printer keeps its UUID even if whatever it was
+// derived from, such as the hostname, changes.
+func (s *Store) UUID(printer string, newUUID func() string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if uuid, ok := s.data.UUIDs[printer]; ok {
+		return uuid
+	}
+	if s.data.UUIDs == nil {
+		s.data.UUIDs = make(map[string]string)
+	}
+	uuid := newUUID()
+	s.data.UUIDs[printer] = uuid
+	return uuid
+}
+
+// Printers returns the printers recorded by the last SetPrinters
+func (s *Store) Printers() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.data.Printers...)
+}
+
+// SetPrinters records the printers currently in CUPS
+func (s *Store) SetPrinters(names []string) {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Printers = sorted
+}
+
+// Jobs returns the recorded jobs and the next job ID to hand out
+func (s *Store) Jobs() ([]jobs.Job, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]jobs.Job(nil), s.data.Jobs...), s.data.NextJobID
+}
+
+// SetJobs records the jobs being tracked and the next job ID
+func (s *Store) SetJobs(tracked []jobs.Job, nextID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Jobs = tracked
+	s.data.NextJobID = nextID
+}
+
+// Save writes the state to disk if it changed since it was last read or
+// written. The file is replaced whole, so a crash never leaves half of it.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if bytes.Equal(raw, s.saved) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), fileName+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	_, err = tmp.Write(raw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	s.saved = raw
+	return nil
+}
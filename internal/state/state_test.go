@@ -0,0 +1,76 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/jobs"
+)
+
+func TestStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	newUUID := func() string {
+		calls++
+		return "uuid-" + string(rune('0'+calls))
+	}
+	if got := s.UUID("Office", newUUID); got != "uuid-1" {
+		t.Errorf("UUID(Office) = %q, want uuid-1", got)
+	}
+	if got := s.UUID("Office", newUUID); got != "uuid-1" || calls != 1 {
+		t.Errorf("UUID(Office) again = %q after %d calls, want uuid-1 after 1", got, calls)
+	}
+
+	s.SetPrinters([]string{"Office", "Lab"})
+	created := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	tracked := []jobs.Job{{ID: 41, CUPSJobID: 1007, Printer: "Office", State: jobs.StatePendingHeld, CreatedAt: created}}
+	s.SetJobs(tracked, 42)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.UUID("Office", newUUID); got != "uuid-1" {
+		t.Errorf("UUID(Office) after reopening = %q, want uuid-1", got)
+	}
+	if got := reopened.Printers(); !reflect.DeepEqual(got, []string{"Lab", "Office"}) {
+		t.Errorf("Printers() = %v, want [Lab Office]", got)
+	}
+	gotJobs, next := reopened.Jobs()
+	if next != 42 || !reflect.DeepEqual(gotJobs, tracked) {
+		t.Errorf("Jobs() = %+v, %d; want %+v, 42", gotJobs, next, tracked)
+	}
+
+	// Unchanged state isn't rewritten
+	path := filepath.Join(dir, fileName)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unchanged state was written again")
+	}
+}
+
+func TestOpen_Corrupt(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, fileName), []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir); err == nil {
+		t.Error("Open() of a corrupt state file succeeded")
+	}
+}
@@ -0,0 +1,141 @@
+package systemd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// journalSocket is where journald takes native protocol datagrams
+var journalSocket = "/run/systemd/journal/socket"
+
+// journalPriorities maps log level names to syslog priorities
+var journalPriorities = map[string]int{
+	"panic": 0,
+	"fatal": 2,
+	"error": 3,
+	"warn":  4,
+	"info":  6,
+	"debug": 7,
+	"trace": 7,
+}
+
+// JournalWriter sends log entries to journald with the native protocol, so
+// their fields can be matched with journalctl, e.g. COMPONENT=ipp. Each
+// write is one JSON object, as zerolog writes them: "message" becomes
+// MESSAGE, "level" PRIORITY, and other keys fields of their own, uppercased.
+type JournalWriter struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// NewJournalWriter connects to journald, tagging entries with identifier
+func NewJournalWriter(identifier string) (*JournalWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return &JournalWriter{conn: conn, identifier: identifier}, nil
+}
+
+// Write sends one entry
+func (j *JournalWriter) Write(p []byte) (int, error) {
+	entry, err := journalEntry(p, j.identifier)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := j.conn.Write(entry); err != nil {
+		return 0, fmt.Errorf("failed to write to journald: %w", err)
+	}
+	return len(p), nil
+}
+
+// Close disconnects from journald
+func (j *JournalWriter) Close() error {
+	return j.conn.Close()
+}
+
+// journalEntry encodes a JSON log entry as a native protocol datagram.
+// journald adds its own timestamp, so "time" is left out.
+func journalEntry(p []byte, identifier string) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(p, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse log entry: %w", err)
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", identifier)
+	priority, ok := journalPriorities[journalValue(fields["level"])]
+	if !ok {
+		priority = journalPriorities["info"]
+	}
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(priority))
+	writeJournalField(&buf, "MESSAGE", journalValue(fields["message"]))
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		switch key {
+		case "level", "message", "time":
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if name := journalFieldName(key); name != "" {
+			writeJournalField(&buf, name, journalValue(fields[key]))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// journalValue returns a JSON string's contents, or any other JSON value as
+// written
+func journalValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// journalFieldName turns a key into a journal field name: uppercase letters,
+// digits and underscores, not starting with an underscore or digit, which
+// journald keeps for its own fields. It returns "" for keys with nothing left.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// writeJournalField appends a field, in the binary form when the value spans
+// lines
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
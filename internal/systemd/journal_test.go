@@ -0,0 +1,72 @@
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram() error = %v", err)
+	}
+	defer conn.Close()
+
+	old := journalSocket
+	journalSocket = path
+	defer func() { journalSocket = old }()
+
+	w, err := NewJournalWriter("airprint-bridge")
+	if err != nil {
+		t.Fatalf("NewJournalWriter() error = %v", err)
+	}
+	defer w.Close()
+	entry := `{"level":"warn","component":"ipp","time":"2026-03-02T14:30:00Z","job_id":7,"message":"printer busy"}`
+	if _, err := w.Write([]byte(entry + "\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	want := "SYSLOG_IDENTIFIER=airprint-bridge\nPRIORITY=4\nMESSAGE=printer busy\nCOMPONENT=ipp\nJOB_ID=7\n"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("received %q, want %q", got, want)
+	}
+}
+
+func TestJournalEntry_Multiline(t *testing.T) {
+	got, err := journalEntry([]byte(`{"message":"a\nb"}`), "x")
+	if err != nil {
+		t.Fatalf("journalEntry() error = %v", err)
+	}
+	want := "SYSLOG_IDENTIFIER=x\nPRIORITY=6\nMESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n"
+	if string(got) != want {
+		t.Errorf("journalEntry() = %q, want %q", got, want)
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"component", "COMPONENT"},
+		{"trace_id", "TRACE_ID"},
+		{"client-ip", "CLIENT_IP"},
+		{"_private", "PRIVATE"},
+		{"2fa", "FA"},
+		{"__", ""},
+	}
+	for _, tt := range tests {
+		if got := journalFieldName(tt.key); got != tt.want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Package upgrade replaces a running bridge with a new binary without
+// closing its listening sockets, so clients never find the printers
+// unreachable during a package upgrade. The old process starts the new one
+// with its sockets, waits until it is serving and advertising, then exits.
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WaffleThief123/airprint-bridge/internal/systemd"
+)
+
+// Environment passed to the new process. These aren't AIRPRINT_BRIDGE_
+// variables, which are read as configuration.
+const (
+	envListeners = "AIRPRINT_UPGRADE_LISTENERS" // addr=fd pairs of inherited sockets
+	envReady     = "AIRPRINT_UPGRADE_READY"     // fd the new process reports readiness on
+)
+
+// ReadyTimeout bounds how long the old process waits for the new one
+var ReadyTimeout = 2 * time.Minute
+
+// Upgrader opens the bridge's listeners, reusing sockets inherited from the
+// process it replaces, and hands them to a new process on Upgrade
+type Upgrader struct {
+	mu        sync.Mutex
+	inherited map[string]*os.File         // addr -> socket from the old process
+	activated []*net.TCPListener          // Sockets from systemd socket activation
+	listeners map[string]*net.TCPListener // addr -> socket opened by Listen
+	ready     *os.File                    // Reports readiness to the old process, nil if there is none
+	log       zerolog.Logger
+}
+
+// New creates an Upgrader, picking up the sockets of the process being
+// replaced if this process was started by Upgrade
+func New(log zerolog.Logger) (*Upgrader, error) {
+	u := &Upgrader{
+		inherited: make(map[string]*os.File),
+		listeners: make(map[string]*net.TCPListener),
+		log:       log.With().Str("component", "upgrade").Logger(),
+	}
+
+	if spec := os.Getenv(envListeners); spec != "" {
+		for _, pair := range strings.Split(spec, ",") {
+			addr, fd, err := parseFD(pair)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", envListeners, err)
+			}
+			u.inherited[addr] = os.NewFile(fd, addr)
+		}
+	}
+	if spec := os.Getenv(envReady); spec != "" {
+		fd, err := strconv.ParseUint(spec, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", envReady, err)
+		}
+		u.ready = os.NewFile(uintptr(fd), "upgrade-ready")
+	}
+	// Don't pass them on to processes this one starts
+	os.Unsetenv(envListeners)
+	os.Unsetenv(envReady)
+	return u, nil
+}
+
+// parseFD parses an addr=fd pair
+func parseFD(pair string) (string, uintptr, error) {
+	i := strings.LastIndex(pair, "=")
+	if i < 0 {
+		return "", 0, fmt.Errorf("%q is not addr=fd", pair)
+	}
+	fd, err := strconv.ParseUint(pair[i+1:], 10, 0)
+	if err != nil {
+		return "", 0, fmt.Errorf("%q is not addr=fd", pair)
+	}
+	return pair[:i], uintptr(fd), nil
+}
+
+// Upgraded reports whether this process took over from another one
+func (u *Upgrader) Upgraded() bool {
+	return u.ready != nil
+}
+
+// Activate adds sockets passed by systemd socket activation. Listen uses
+// one instead of opening its own when it is bound to the address asked for.
+func (u *Upgrader) Activate(files []*os.File) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, f := range files {
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to use activated socket %s: %w", f.Name(), err)
+		}
+		tcp, ok := ln.(*net.TCPListener)
+		if !ok {
+			ln.Close()
+			return fmt.Errorf("activated socket %s is not a TCP listener", f.Name())
+		}
+		u.activated = append(u.activated, tcp)
+	}
+	return nil
+}
+
+// takeActivated removes and returns the activated socket bound to addr, or
+// nil. A socket on every address serves addrs without a host.
+func (u *Upgrader) takeActivated(addr string) *net.TCPListener {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil
+	}
+	for i, ln := range u.activated {
+		bound := ln.Addr().(*net.TCPAddr)
+		if strconv.Itoa(bound.Port) != port {
+			continue
+		}
+		if ip := net.ParseIP(host); (host == "" && bound.IP.IsUnspecified()) || (ip != nil && ip.Equal(bound.IP)) {
+			u.activated = append(u.activated[:i], u.activated[i+1:]...)
+			return ln
+		}
+	}
+	return nil
+}
+
+// Listen returns a TCP listener on addr: the socket the old process was
+// using if it passed one on, or one systemd activated the service with
+func (u *Upgrader) Listen(addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var ln net.Listener
+	if activated := u.takeActivated(addr); activated != nil {
+		u.log.Debug().Str("addr", addr).Msg("using activated socket")
+		ln = activated
+	} else if f, ok := u.inherited[addr]; ok {
+		delete(u.inherited, addr)
+		inherited, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to use inherited socket for %s: %w", addr, err)
+		}
+		u.log.Debug().Str("addr", addr).Msg("took over listener")
+		ln = inherited
+	} else {
+		opened, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		ln = opened
+	}
+
+	tcp, ok := ln.(*net.TCPListener)
+	if !ok {
+		ln.Close()
+		return nil, fmt.Errorf("listener for %s is not TCP", addr)
+	}
+	u.listeners[addr] = tcp
+	return tcp, nil
+}
+
+// Ready tells the old process this one is serving and advertising, so it
+// can exit. Inherited sockets nothing listened on are closed.
+func (u *Upgrader) Ready() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for addr, f := range u.inherited {
+		u.log.Info().Str("addr", addr).Msg("closing listener no longer configured")
+		f.Close()
+		delete(u.inherited, addr)
+	}
+	for _, ln := range u.activated {
+		u.log.Warn().Str("addr", ln.Addr().String()).Msg("closing activated socket no listener is configured on")
+		ln.Close()
+	}
+	u.activated = nil
+	if u.ready == nil {
+		return nil
+	}
+
+	// Under systemd the service's main process is about to change
+	if err := systemd.Notify(fmt.Sprintf("MAINPID=%d", os.Getpid())); err != nil {
+		u.log.Warn().Err(err).Msg("failed to tell systemd the new main PID")
+	}
+	_, err := u.ready.Write([]byte{1})
+	u.ready.Close()
+	u.ready = nil
+	if err != nil {
+		return fmt.Errorf("failed to signal old process: %w", err)
+	}
+	return nil
+}
+
+// Upgrade starts the current executable with the same arguments, passing
+// it the open listeners, and waits until it calls Ready. On success the
+// caller should stop serving and exit without withdrawing advertisements,
+// which the new process now owns. On failure the new process is stopped
+// and the caller carries on.
+func (u *Upgrader) Upgrade() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	u.mu.Lock()
+	var files []*os.File
+	var spec []string
+	for addr, ln := range u.listeners {
+		f, err := ln.File()
+		if err != nil {
+			// Closed since, e.g. a printer's own port
+			delete(u.listeners, addr)
+			continue
+		}
+		// ExtraFiles start at fd 3 in the new process
+		spec = append(spec, fmt.Sprintf("%s=%d", addr, 3+len(files)))
+		files = append(files, f)
+	}
+	u.mu.Unlock()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(childEnv(),
+		envListeners+"="+strings.Join(spec, ","),
+		fmt.Sprintf("%s=%d", envReady, 3+len(files)),
+	)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", exe, err)
+	}
+	u.log.Info().Str("executable", exe).Int("pid", cmd.Process.Pid).Msg("started new process")
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := r.Read(buf)
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err == nil {
+			return cmd.Process.Release()
+		}
+		_ = cmd.Wait()
+		return errors.New("new process exited before it was ready")
+	case <-time.After(ReadyTimeout):
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("new process wasn't ready within %s", ReadyTimeout)
+	}
+}
+
+// childEnv returns the environment for the new process. systemd's watchdog
+// is addressed to this process, but the new one takes it over along with
+// the main PID.
+func childEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "WATCHDOG_PID=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
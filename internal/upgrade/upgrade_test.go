@@ -0,0 +1,97 @@
+package upgrade
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseFD(t *testing.T) {
+	tests := []struct {
+		pair     string
+		wantAddr string
+		wantFD   uintptr
+		wantErr  bool
+	}{
+		{":8631=3", ":8631", 3, false},
+		{"[::1]:8632=4", "[::1]:8632", 4, false},
+		{":8631", "", 0, true},
+		{":8631=x", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		addr, fd, err := parseFD(tt.pair)
+		if (err != nil) != tt.wantErr || addr != tt.wantAddr || fd != tt.wantFD {
+			t.Errorf("parseFD(%q) = %q, %d, %v; want %q, %d", tt.pair, addr, fd, err, tt.wantAddr, tt.wantFD)
+		}
+	}
+}
+
+func TestListen_Inherited(t *testing.T) {
+	orig, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+	f, err := orig.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := orig.Addr().String()
+	u := &Upgrader{
+		inherited: map[string]*os.File{addr: f, "127.0.0.1:1": os.NewFile(^uintptr(0), "unused")},
+		listeners: make(map[string]*net.TCPListener),
+		log:       zerolog.Nop(),
+	}
+	ln, err := u.Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != addr {
+		t.Errorf("listening on %s, want inherited %s", ln.Addr(), addr)
+	}
+
+	if err := u.Ready(); err != nil {
+		t.Fatal(err)
+	}
+	if len(u.inherited) != 0 {
+		t.Errorf("unclaimed sockets left open: %v", u.inherited)
+	}
+}
+
+func TestListen_Activated(t *testing.T) {
+	orig, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+	f, err := orig.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := &Upgrader{
+		inherited: make(map[string]*os.File),
+		listeners: make(map[string]*net.TCPListener),
+		log:       zerolog.Nop(),
+	}
+	if err := u.Activate([]*os.File{f}); err != nil {
+		t.Fatal(err)
+	}
+	addr := orig.Addr().String()
+	ln, err := u.Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != addr {
+		t.Errorf("listening on %s, want activated %s", ln.Addr(), addr)
+	}
+	if len(u.activated) != 0 {
+		t.Errorf("activated socket not taken: %v", u.activated)
+	}
+}
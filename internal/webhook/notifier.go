@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Event types emitted by the bridge
+const (
+	EventFailover  = "printer.failover"
+	EventJobDenied = "job.denied"
+)
+
+// Event is the JSON payload posted to webhook endpoints
+type Event struct {
+	Type      string            `json:"type"`
+	Timestamp time.Time         `json:"timestamp"`
+	Printer   string            `json:"printer,omitempty"`
+	TraceID   string            `json:"trace_id,omitempty"` // The job the event is about, if any
+	Message   string            `json:"message,omitempty"`
+	Data      map[string]string `json:"data,omitempty"`
+}
+
+// Notifier delivers events to the configured webhook URLs
+type Notifier struct {
+	urls       []string
+	httpClient *http.Client
+	log        zerolog.Logger
+}
+
+// NewNotifier creates a notifier posting to the given URLs
+func NewNotifier(urls []string, log zerolog.Logger) *Notifier {
+	return &Notifier{
+		urls: urls,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		log: log.With().Str("component", "webhook").Logger(),
+	}
+}
+
+// Notify sends an event to all webhook URLs in the background.
+// Delivery failures are logged and never block the caller.
+func (n *Notifier) Notify(e Event) {
+	if n == nil || len(n.urls) == 0 {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		n.log.Error().Err(err).Str("event", e.Type).Msg("failed to encode webhook event")
+		return
+	}
+
+	for _, url := range n.urls {
+		go func(url string) {
+			if err := n.post(url, payload); err != nil {
+				n.log.Warn().Err(err).Str("url", url).Str("event", e.Type).Msg("webhook delivery failed")
+			}
+		}(url)
+	}
+}
+
+func (n *Notifier) post(url string, payload []byte) error {
+	resp, err := n.httpClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
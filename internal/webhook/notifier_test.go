@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int // Answer of the endpoint
+	}{
+		{"delivered", http.StatusNoContent},
+		{"endpoint failing", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan Event, 2)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var e Event
+				if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+					t.Errorf("failed to decode event: %v", err)
+				}
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("Content-Type = %q", ct)
+				}
+				w.WriteHeader(tt.status)
+				received <- e
+			}))
+			defer ts.Close()
+
+			n := NewNotifier([]string{ts.URL, ts.URL}, zerolog.Nop())
+			n.Notify(Event{
+				Type:    EventFailover,
+				Printer: "Office",
+				TraceID: "trace",
+				Data:    map[string]string{"backup": "Spare"},
+			})
+
+			for i := 0; i < 2; i++ {
+				select {
+				case e := <-received:
+					if e.Type != EventFailover || e.Printer != "Office" || e.TraceID != "trace" || e.Data["backup"] != "Spare" || e.Timestamp.IsZero() {
+						t.Errorf("event = %+v", e)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("event %d not delivered", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifier_NoURLs(t *testing.T) {
+	// Neither a nil notifier nor one without URLs does anything
+	var n *Notifier
+	n.Notify(Event{Type: EventFailover})
+	NewNotifier(nil, zerolog.Nop()).Notify(Event{Type: EventFailover})
+}
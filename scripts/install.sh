@@ -286,9 +286,13 @@ After=network.target cups.service avahi-daemon.service
 Requires=cups.service avahi-daemon.service
 
 [Service]
-Type=simple
+Type=notify
 ExecStart=$BINDIR/airprint-bridge --config /etc/airprint-bridge/airprint-bridge.yaml
 ExecReload=/bin/kill -HUP \$MAINPID
+# A new binary started with SIGUSR2 reports itself as the main process
+NotifyAccess=all
+# Restart the bridge if its printer polling hangs
+WatchdogSec=120
 Restart=on-failure
 RestartSec=5
 
@@ -297,6 +301,8 @@ NoNewPrivileges=true
 ProtectSystem=strict
 ProtectHome=true
 ReadWritePaths=/etc/avahi/services
+StateDirectory=airprint-bridge
+StateDirectoryMode=0700
 PrivateTmp=true
 
 [Install]
@@ -481,7 +487,7 @@ main() {
             info ""
             info "Next steps:"
             info "  1. Edit config: $CONFDIR/airprint-bridge.yaml"
-            info "  2. Check printers: $BINDIR/$BINARY_NAME --list-printers"
+            info "  2. Check printers: $BINDIR/$BINARY_NAME list-printers"
             info "  3. Start service (see above for commands)"
             ;;
         uninstall)